@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// requireAdmin guards administrative handlers with a bearer token.
+// An empty token leaves the handler open.
+func requireAdmin(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			next(w, r)
+			return
+		}
+
+		provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// ErrClockRegression is returned when setting the clock would move it backwards
+var ErrClockRegression = errors.New("new value is lower than the current timestamp")
+
+// Set moves the clock to value within the current epoch. Unless force is
+// true the clock may only move forward, since going back lets the node
+// reuse timestamps it already handed out.
+func (lc *LamportClock) Set(value int64, force bool) (previous ClockTime, err error) {
+	return lc.set(value, force, ClockSource{})
+}
+
+func (lc *LamportClock) set(value int64, force bool, src ClockSource) (previous ClockTime, err error) {
+	lc.mutex.Lock()
+	defer lc.mutex.Unlock()
+
+	previous = lc.nowLocked()
+	if value < 0 || value > lc.rollover {
+		return previous, fmt.Errorf("value must be between 0 and %d", lc.rollover)
+	}
+	if !force && value < lc.timestamp {
+		return previous, ErrClockRegression
+	}
+	lc.timestamp = value
+	lc.changes.Notify()
+	lc.recordLocked(previous, causeAdminSet, ClockTime{}, false, src)
+	return previous, nil
+}
+
+// Reset moves the clock back to epoch 0, timestamp 0
+func (lc *LamportClock) Reset() (previous ClockTime) {
+	return lc.reset(ClockSource{})
+}
+
+func (lc *LamportClock) reset(src ClockSource) (previous ClockTime) {
+	lc.mutex.Lock()
+	defer lc.mutex.Unlock()
+
+	previous = lc.nowLocked()
+	lc.epoch = 0
+	lc.timestamp = 0
+	lc.changes.Notify()
+	lc.recordLocked(previous, causeAdminReset, ClockTime{}, false, src)
+	return previous
+}
+
+// recordClockAudit logs an administrative clock change from previous to
+// value as an event
+func (s *Server) recordClockAudit(r *http.Request, action string, previous, value ClockTime, force bool) Event {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"previous": previous,
+		"value":    value,
+		"force":    force,
+	})
+	event := Event{
+		ID:        fmt.Sprintf("admin-%d", time.Now().UnixNano()),
+		Message:   fmt.Sprintf("Clock %s by admin (was %s)", action, previous),
+		Type:      "clock." + action,
+		Payload:   payload,
+		RequestID: requestIDFrom(r.Context()),
+	}
+	committed, err := s.commitLocal(event)
+	if err != nil {
+		// The change itself is local and has been made either way
+		s.logger.Warn("Clock audit event not committed", "error", err)
+		return event
+	}
+	return committed
+}
+
+func (s *Server) handleClockReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// The audit event is recorded first, as stamping it afterwards would
+	// tick the clock past the 0 it was reset to
+	previous := s.clock.Now()
+	event := s.recordClockAudit(r, "reset", previous, ClockTime{}, true)
+	s.clock.reset(ClockSource{RequestID: requestIDFrom(r.Context())})
+	s.logger.Warn("Clock reset by admin", append(eventAttrs(event), "previous", previous.String())...)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(event)
+}
+
+func (s *Server) handleClockSet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	value, err := strconv.ParseInt(r.URL.Query().Get("value"), 10, 64)
+	if err != nil {
+		http.Error(w, "Missing or invalid value parameter", http.StatusBadRequest)
+		return
+	}
+	force := r.URL.Query().Get("force") == "true"
+
+	previous, err := s.clock.set(value, force, ClockSource{RequestID: requestIDFrom(r.Context())})
+	if errors.Is(err, ErrClockRegression) {
+		http.Error(w, fmt.Sprintf("%v (current: %s), use force=true to override", err, previous), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	event := s.recordClockAudit(r, "set", previous, s.clock.Now(), force)
+	s.logger.Warn("Clock set by admin", append(eventAttrs(event), "previous", previous.String())...)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(event)
+}
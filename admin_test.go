@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	cases := []struct {
+		name     string
+		token    string
+		header   string
+		expected int
+	}{
+		{"no token configured", "", "", http.StatusNoContent},
+		{"missing header", "secret", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "Bearer nope", http.StatusUnauthorized},
+		{"wrong scheme", "secret", "Basic secret", http.StatusUnauthorized},
+		{"valid token", "secret", "Bearer secret", http.StatusNoContent},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest("POST", "/admin/import", nil)
+		if c.header != "" {
+			req.Header.Set("Authorization", c.header)
+		}
+		w := httptest.NewRecorder()
+
+		requireAdmin(c.token, ok)(w, req)
+
+		if w.Code != c.expected {
+			t.Errorf("%s: expected status %d, got %d", c.name, c.expected, w.Code)
+		}
+	}
+}
+
+func TestClockSet(t *testing.T) {
+	clock := NewLamportClock()
+	clock.Update(10) // 11
+
+	if _, err := clock.Set(5, false); err != ErrClockRegression {
+		t.Errorf("Expected ErrClockRegression, got %v", err)
+	}
+	if clock.GetTime() != 11 {
+		t.Errorf("Expected rejected set to leave clock at 11, got %d", clock.GetTime())
+	}
+
+	previous, err := clock.Set(5, true)
+	if err != nil || previous.Timestamp != 11 || clock.GetTime() != 5 {
+		t.Errorf("Expected forced set from 11 to 5, got previous %s, now %d (err: %v)", previous, clock.GetTime(), err)
+	}
+
+	if _, err := clock.Set(-1, true); err == nil {
+		t.Error("Expected negative value to be rejected")
+	}
+}
+
+func TestClockAdminHandlers(t *testing.T) {
+	server := NewServer()
+	server.clock.Update(41) // 42
+
+	post := func(handler http.HandlerFunc, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", target, nil)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	if w := post(server.handleClockSet, "/admin/clock/set?value=10"); w.Code != http.StatusConflict {
+		t.Errorf("Expected status Conflict for backwards set, got %d", w.Code)
+	}
+
+	w := post(server.handleClockSet, "/admin/clock/set?value=100")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d: %s", w.Code, w.Body.String())
+	}
+	var audit Event
+	json.NewDecoder(w.Body).Decode(&audit)
+	if audit.Type != "clock.set" || audit.Timestamp != 101 {
+		t.Errorf("Expected clock.set audit event at 101, got %s at %d", audit.Type, audit.Timestamp)
+	}
+
+	if w := post(server.handleClockSet, "/admin/clock/set?value=3&force=true"); w.Code != http.StatusOK {
+		t.Errorf("Expected forced set to succeed, got %d", w.Code)
+	}
+
+	w = post(server.handleClockReset, "/admin/clock/reset")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d", w.Code)
+	}
+	json.NewDecoder(w.Body).Decode(&audit)
+	// The audit event is stamped before the reset, which leaves the clock
+	// at 0
+	if audit.Type != "clock.reset" || audit.Timestamp != 5 {
+		t.Errorf("Expected clock.reset audit event at 5, got %s at %d", audit.Type, audit.Timestamp)
+	}
+	if now := server.clock.Now(); now != (ClockTime{}) {
+		t.Errorf("Expected reset to leave the clock at 0:0, got %s", now)
+	}
+
+	var payload struct {
+		Previous ClockTime `json:"previous"`
+		Value    ClockTime `json:"value"`
+	}
+	json.Unmarshal(audit.Payload, &payload)
+	if payload.Previous.Timestamp != 4 || payload.Value != (ClockTime{}) {
+		t.Errorf("Expected audit payload to record the reset from 4 to 0, got %+v", payload)
+	}
+
+	if server.events.Len() != 3 {
+		t.Errorf("Expected 3 audit events, got %d", server.events.Len())
+	}
+
+	if w := post(server.handleClockSet, "/admin/clock/set"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status BadRequest without value, got %d", w.Code)
+	}
+}
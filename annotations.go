@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Annotation holds the labels attached to an event after it was logged.
+// Events are chained and signed, so they never change; their annotations
+// live next to them, versioned by the Lamport timestamp of their last
+// update. Until the first update the version is the event's timestamp.
+type Annotation struct {
+	ID          string            `json:"id"`
+	Annotations map[string]string `json:"annotations"`
+	Version     int64             `json:"lamport_timestamp"`
+	WallTime    time.Time         `json:"wall_time,omitzero"`
+}
+
+// errVersionConflict rejects an update made against a version that is no
+// longer the current one
+var errVersionConflict = errors.New("annotation version conflict")
+
+// AnnotationStore holds the annotations of the events, by event ID
+type AnnotationStore struct {
+	entries map[string]Annotation
+	mutex   sync.Mutex
+}
+
+// NewAnnotationStore creates an empty store
+func NewAnnotationStore() *AnnotationStore {
+	return &AnnotationStore{entries: make(map[string]Annotation)}
+}
+
+// Get returns the current annotations of an event
+func (as *AnnotationStore) Get(event Event) Annotation {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+	return as.currentLocked(event)
+}
+
+// Update applies a patch to the annotations of an event if their version
+// is still expected, stamping them with the timestamp tick returns. Keys
+// patched to nil are removed. On a conflict it returns the current
+// annotations with errVersionConflict. The check and the write happen
+// under one lock, so of two updates made against the same version only
+// one wins.
+func (as *AnnotationStore) Update(event Event, expected int64, patch map[string]*string, tick func() int64) (Annotation, error) {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	current := as.currentLocked(event)
+	if current.Version != expected {
+		return current, errVersionConflict
+	}
+	next := Annotation{ID: event.ID, Annotations: maps.Clone(current.Annotations), WallTime: time.Now()}
+	for k, v := range patch {
+		if v == nil {
+			delete(next.Annotations, k)
+		} else {
+			next.Annotations[k] = *v
+		}
+	}
+	next.Version = tick()
+	as.entries[event.ID] = next
+	return next, nil
+}
+
+func (as *AnnotationStore) currentLocked(event Event) Annotation {
+	if a, ok := as.entries[event.ID]; ok {
+		return a
+	}
+	return Annotation{ID: event.ID, Annotations: map[string]string{}, Version: event.Timestamp}
+}
+
+// annotationETag is the tag of a version of annotations, which If-Match
+// takes back
+func annotationETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// parseIfMatch reads the Lamport timestamp of an If-Match header, given
+// bare or as the tag of annotationETag
+func parseIfMatch(header string) (int64, bool) {
+	v := strings.Trim(strings.TrimPrefix(strings.TrimSpace(header), "W/"), `"`)
+	ts, err := strconv.ParseInt(v, 10, 64)
+	return ts, err == nil && ts >= 0
+}
+
+// handleEventAnnotations serves GET /events/<id>/annotations
+func (s *Server) handleEventAnnotations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, _ := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/events/"), "/annotations")
+	event, ok := s.events.Find(id)
+	if !ok {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+	a := s.annotations.Get(event)
+	w.Header().Set("ETag", annotationETag(a.Version))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a)
+}
+
+// handlePatchEvent serves PATCH /events/<id>, which attaches annotations
+// to an event under an If-Match: <lamport_ts> precondition. The body maps
+// keys to values, null removing a key. An update made against a stale
+// version is rejected with 409 Conflict and the current annotations.
+func (s *Server) handlePatchEvent(w http.ResponseWriter, r *http.Request, id string) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		http.Error(w, "Missing If-Match header", http.StatusPreconditionRequired)
+		return
+	}
+	expected, ok := parseIfMatch(header)
+	if !ok {
+		http.Error(w, "Invalid If-Match header, expected a Lamport timestamp", http.StatusBadRequest)
+		return
+	}
+	var patch map[string]*string
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil || len(patch) == 0 {
+		http.Error(w, "Invalid annotations", http.StatusBadRequest)
+		return
+	}
+	event, ok := s.events.Find(id)
+	if !ok {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+
+	src := ClockSource{RequestID: requestIDFrom(r.Context())}
+	a, err := s.annotations.Update(event, expected, patch, func() int64 {
+		return s.clock.tick(src).Timestamp
+	})
+	w.Header().Set("ETag", annotationETag(a.Version))
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		s.metrics.Inc("lamport_annotation_conflicts_total")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":             "Annotations changed since " + strconv.FormatInt(expected, 10),
+			"lamport_timestamp": a.Version,
+			"annotations":       a.Annotations,
+		})
+		return
+	}
+	s.logger.Info("Event annotated", "id", id, "lamport_timestamp", a.Version)
+	json.NewEncoder(w).Encode(a)
+}
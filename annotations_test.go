@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestAnnotationStoreUpdate(t *testing.T) {
+	as := NewAnnotationStore()
+	event := Event{ID: "e1", Timestamp: 3}
+	next := int64(10)
+	tick := func() int64 { next++; return next }
+	value := func(v string) *string { return &v }
+
+	if a := as.Get(event); a.Version != 3 || len(a.Annotations) != 0 {
+		t.Errorf("Expected the event's timestamp as first version, got %+v", a)
+	}
+	a, err := as.Update(event, 3, map[string]*string{"owner": value("alice"), "tier": value("gold")}, tick)
+	if err != nil || a.Version != 11 || a.Annotations["owner"] != "alice" {
+		t.Fatalf("Expected version 11 with owner alice, got %+v %v", a, err)
+	}
+	if a, err := as.Update(event, 3, map[string]*string{"owner": value("bob")}, tick); err != errVersionConflict || a.Version != 11 {
+		t.Errorf("Expected a conflict at version 11, got %+v %v", a, err)
+	}
+	a, err = as.Update(event, 11, map[string]*string{"tier": nil}, tick)
+	if err != nil || a.Version != 12 || len(a.Annotations) != 1 {
+		t.Errorf("Expected tier removed at version 12, got %+v %v", a, err)
+	}
+}
+
+func TestAnnotationStoreConcurrentUpdates(t *testing.T) {
+	as := NewAnnotationStore()
+	event := Event{ID: "e1", Timestamp: 1}
+	clock := NewLamportClock()
+	clock.Update(1)
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	won := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v := "x"
+			if _, err := as.Update(event, 1, map[string]*string{"k": &v}, clock.Tick); err == nil {
+				mutex.Lock()
+				won++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if won != 1 {
+		t.Errorf("Expected exactly one update against version 1 to win, got %d", won)
+	}
+}
+
+func TestHandlePatchEvent(t *testing.T) {
+	server := NewServer()
+	event := server.logEvent("e1", "First event")
+
+	patch := func(ifMatch, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/events/e1", strings.NewReader(body))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		server.handleEvent(w, req)
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	server.handleEvent(w, httptest.NewRequest(http.MethodGet, "/events/e1", nil))
+	etag := w.Header().Get("ETag")
+	if etag != annotationETag(event.Timestamp) {
+		t.Fatalf("Expected the event's timestamp as ETag, got %q", etag)
+	}
+
+	w = patch(etag, `{"reviewed":"yes"}`)
+	var a Annotation
+	json.NewDecoder(w.Body).Decode(&a)
+	if w.Code != http.StatusOK || a.Annotations["reviewed"] != "yes" || a.Version != server.clock.GetTime() {
+		t.Fatalf("Expected the update to apply at the current time, got %d %+v", w.Code, a)
+	}
+
+	// A second update against the same version lost the race
+	w = patch(etag, `{"reviewed":"no"}`)
+	var conflict struct {
+		Timestamp   int64             `json:"lamport_timestamp"`
+		Annotations map[string]string `json:"annotations"`
+	}
+	json.NewDecoder(w.Body).Decode(&conflict)
+	if w.Code != http.StatusConflict || conflict.Timestamp != a.Version || conflict.Annotations["reviewed"] != "yes" {
+		t.Errorf("Expected 409 with version %d, got %d %+v", a.Version, w.Code, conflict)
+	}
+	if w.Header().Get("ETag") != annotationETag(a.Version) {
+		t.Errorf("Expected the current ETag on a conflict, got %q", w.Header().Get("ETag"))
+	}
+
+	w = httptest.NewRecorder()
+	server.handleEvent(w, httptest.NewRequest(http.MethodGet, "/events/e1/annotations", nil))
+	var got Annotation
+	json.NewDecoder(w.Body).Decode(&got)
+	if got.Version != a.Version || got.Annotations["reviewed"] != "yes" {
+		t.Errorf("Expected the annotations to be read back, got %+v", got)
+	}
+
+	for _, c := range []struct {
+		name, ifMatch, body string
+		want                int
+	}{
+		{"missing If-Match", "", `{"a":"b"}`, http.StatusPreconditionRequired},
+		{"invalid If-Match", "abc", `{"a":"b"}`, http.StatusBadRequest},
+		{"invalid body", "1", `["a"]`, http.StatusBadRequest},
+		{"empty patch", "1", `{}`, http.StatusBadRequest},
+	} {
+		if w := patch(c.ifMatch, c.body); w.Code != c.want {
+			t.Errorf("%s: expected %d, got %d", c.name, c.want, w.Code)
+		}
+	}
+	req := httptest.NewRequest(http.MethodPatch, "/events/missing", strings.NewReader(`{"a":"b"}`))
+	req.Header.Set("If-Match", "1")
+	w = httptest.NewRecorder()
+	server.handleEvent(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing event, got %d", w.Code)
+	}
+}
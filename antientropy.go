@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// syncKey identifies an event across logs, as in the merged cluster history
+type syncKey struct{ node, id string }
+
+func keyOf(e Event) syncKey {
+	return syncKey{e.Node, e.ID}
+}
+
+// bucketKey names the range of timestamps [Start, Start+width) of an epoch
+type bucketKey struct {
+	Epoch int64 `json:"epoch"`
+	Start int64 `json:"start"`
+}
+
+// SyncBucket digests the events of one timestamp range
+type SyncBucket struct {
+	bucketKey
+	Count int    `json:"count"`
+	Hash  string `json:"hash"`
+}
+
+// syncExchange is sent on /peer/sync/events: the buckets whose digests
+// differ with the events the sender has in them. The reply carries the
+// receiver's events in the same buckets.
+type syncExchange struct {
+	Width   int64       `json:"width"`
+	Buckets []bucketKey `json:"buckets"`
+	Events  []Event     `json:"events"`
+	Merged  int         `json:"merged"`
+}
+
+// SyncResult reports one reconciliation with a peer
+type SyncResult struct {
+	Peer    string `json:"peer"`
+	Buckets int    `json:"buckets"` // ranges whose digests differed
+	Pulled  int    `json:"pulled"`  // events merged from the peer
+	Pushed  int    `json:"pushed"`  // events the peer merged from us
+	Error   string `json:"error,omitempty"`
+}
+
+// AntiEntropy reconciles the event log with the logs of the peers so they
+// converge after partitions. Logs are split into ranges of width
+// timestamps and only ranges whose digests differ are exchanged.
+type AntiEntropy struct {
+	server *Server
+	width  int64
+}
+
+// NewAntiEntropy creates the reconciliation of the server's log
+func NewAntiEntropy(server *Server, width int64) *AntiEntropy {
+	server.metrics.Counter("lamport_sync_rounds_total", "Log reconciliations with a peer")
+	server.metrics.Counter("lamport_sync_events_total", "Events transferred by log reconciliation")
+	return &AntiEntropy{server: server, width: width}
+}
+
+func (ae *AntiEntropy) bucketOf(e Event) bucketKey {
+	return bucketKey{Epoch: e.Epoch, Start: e.Timestamp - e.Timestamp%ae.width}
+}
+
+// digest hashes the keys and times of the events in every range. Events
+// are added in key order, so logs holding the same events in a different
+// order have equal digests.
+func (ae *AntiEntropy) digest() []SyncBucket {
+	s := ae.server
+	groups := make(map[bucketKey][]Event)
+	for _, e := range s.events.Events() {
+		b := ae.bucketOf(e)
+		groups[b] = append(groups[b], e)
+	}
+
+	buckets := make([]SyncBucket, 0, len(groups))
+	for b, events := range groups {
+		sort.Slice(events, func(i, j int) bool {
+			if events[i].Node != events[j].Node {
+				return events[i].Node < events[j].Node
+			}
+			return events[i].ID < events[j].ID
+		})
+		h := sha256.New()
+		for _, e := range events {
+			fmt.Fprintf(h, "%q %q %d %d\n", e.Node, e.ID, e.Epoch, e.Timestamp)
+		}
+		buckets = append(buckets, SyncBucket{bucketKey: b, Count: len(events), Hash: hex.EncodeToString(h.Sum(nil))})
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		if buckets[i].Epoch != buckets[j].Epoch {
+			return buckets[i].Epoch < buckets[j].Epoch
+		}
+		return buckets[i].Start < buckets[j].Start
+	})
+	return buckets
+}
+
+// eventsIn returns the events of the given ranges
+func (ae *AntiEntropy) eventsIn(buckets []bucketKey) []Event {
+	wanted := make(map[bucketKey]bool, len(buckets))
+	for _, b := range buckets {
+		wanted[b] = true
+	}
+	events := []Event{}
+	for _, e := range ae.server.events.Events() {
+		if wanted[ae.bucketOf(e)] {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// merge appends the events that are not in the log yet. Their timestamps
+// pass the jump guard and their signatures are checked like messages, but
+// they keep the node, ID and time they were recorded with.
+func (ae *AntiEntropy) merge(peer string, events []Event) int {
+	s := ae.server
+	local := s.events.Events()
+	have := make(map[syncKey]bool, len(local))
+	for _, e := range local {
+		have[keyOf(e)] = true
+	}
+
+	merged := 0
+	for _, e := range events {
+		if e.Node == "" || e.ID == "" || have[keyOf(e)] {
+			continue
+		}
+		have[keyOf(e)] = true
+
+		at := ClockTime{Epoch: e.Epoch, Timestamp: e.Timestamp}
+		if _, err := s.clock.observeFrom(at, ClockSource{Peer: peer}); err != nil {
+			s.logger.Warn("Skipping synced event", "peer", peer, "id", e.ID, "node", e.Node, "error", err)
+			continue
+		}
+		ctx, err := s.checkSignature(context.Background(), "sync", e.KeyID, e.Signature, e.ID, at, e.Message)
+		if err != nil {
+			continue
+		}
+		e.InvalidSignature = invalidSignatureFrom(ctx)
+		if _, err := s.appendEvent(e); err != nil {
+			s.logger.Warn("Skipping synced event", "peer", peer, "id", e.ID, "node", e.Node, "error", err)
+			continue
+		}
+		merged++
+	}
+	return merged
+}
+
+// Sync reconciles the log with one peer: digests are compared, then the
+// events of differing ranges are exchanged in both directions
+func (ae *AntiEntropy) Sync(ctx context.Context, peer string) (SyncResult, error) {
+	s := ae.server
+	result := SyncResult{Peer: peer}
+
+	path := "/peer/sync/digest?width=" + strconv.FormatInt(ae.width, 10)
+	data, err := s.peers.Do(ctx, peer, http.MethodGet, path, nil, nil)
+	if err != nil {
+		return result, err
+	}
+	var remote struct {
+		Buckets []SyncBucket `json:"buckets"`
+	}
+	if err := json.Unmarshal(data, &remote); err != nil {
+		return result, fmt.Errorf("invalid digest: %w", err)
+	}
+
+	theirs := make(map[bucketKey]string, len(remote.Buckets))
+	for _, b := range remote.Buckets {
+		theirs[b.bucketKey] = b.Hash
+	}
+	var differing []bucketKey
+	for _, b := range ae.digest() {
+		if theirs[b.bucketKey] != b.Hash {
+			differing = append(differing, b.bucketKey)
+		}
+		delete(theirs, b.bucketKey)
+	}
+	for b := range theirs {
+		differing = append(differing, b)
+	}
+	result.Buckets = len(differing)
+	if len(differing) == 0 {
+		s.metrics.Inc("lamport_sync_rounds_total", "result", "in_sync")
+		return result, nil
+	}
+
+	body, _ := json.Marshal(syncExchange{Width: ae.width, Buckets: differing, Events: ae.eventsIn(differing)})
+	header := http.Header{"Content-Type": []string{"application/json"}}
+	if data, err = s.peers.Do(ctx, peer, http.MethodPost, "/peer/sync/events", header, body); err != nil {
+		return result, err
+	}
+	var reply syncExchange
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return result, fmt.Errorf("invalid sync reply: %w", err)
+	}
+	result.Pushed = reply.Merged
+	result.Pulled = ae.merge(peer, reply.Events)
+
+	s.metrics.Inc("lamport_sync_rounds_total", "result", "reconciled")
+	s.metrics.Add("lamport_sync_events_total", float64(result.Pulled), "direction", "pulled")
+	s.metrics.Add("lamport_sync_events_total", float64(result.Pushed), "direction", "pushed")
+	s.logger.Info("Log reconciled", "peer", peer, "buckets", result.Buckets, "pulled", result.Pulled, "pushed", result.Pushed)
+	return result, nil
+}
+
+// SyncAll reconciles the log with every peer in turn
+func (ae *AntiEntropy) SyncAll(ctx context.Context, peers []string) []SyncResult {
+	results := make([]SyncResult, 0, len(peers))
+	for _, peer := range peers {
+		result, err := ae.Sync(ctx, peer)
+		if err != nil {
+			ae.server.metrics.Inc("lamport_sync_rounds_total", "result", "failed")
+			ae.server.logger.Warn("Log reconciliation failed", "peer", peer, "error", err)
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// Run reconciles with every peer each interval until ctx is done
+func (ae *AntiEntropy) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			syncCtx, cancel := context.WithTimeout(ctx, clusterTimeout)
+			ae.SyncAll(syncCtx, ae.server.peers.URLs())
+			cancel()
+		}
+	}
+}
+
+// handleSync serves POST /cluster/sync, reconciling with the given peer or
+// with all of them
+func (ae *AntiEntropy) handleSync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), clusterTimeout)
+	defer cancel()
+	peers := ae.server.peers.URLs()
+	if peer := r.URL.Query().Get("peer"); peer != "" {
+		u, err := ae.server.peers.Resolve(ctx, peer)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		peers = []string{u}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"node_id": ae.server.nodeID,
+		"results": ae.SyncAll(ctx, peers),
+	})
+}
+
+// handlePeerDigest serves the digest of the log to a reconciling peer
+func (ae *AntiEntropy) handlePeerDigest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !ae.sameWidth(w, r.URL.Query().Get("width")) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"node_id": ae.server.nodeID,
+		"width":   ae.width,
+		"buckets": ae.digest(),
+	})
+}
+
+// handlePeerEvents merges the events pushed by a reconciling peer and
+// replies with this node's events of the same ranges
+func (ae *AntiEntropy) handlePeerEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var exchange syncExchange
+	if err := json.NewDecoder(r.Body).Decode(&exchange); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if !ae.sameWidth(w, strconv.FormatInt(exchange.Width, 10)) {
+		return
+	}
+
+	reply := syncExchange{Width: ae.width, Buckets: exchange.Buckets, Events: ae.eventsIn(exchange.Buckets)}
+	reply.Merged = ae.merge(r.RemoteAddr, exchange.Events)
+	if reply.Merged > 0 {
+		ae.server.logger.Info("Merged synced events", "remote", r.RemoteAddr, "merged", reply.Merged)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reply)
+}
+
+// sameWidth rejects peers that split their logs into other ranges, whose
+// digests could never match
+func (ae *AntiEntropy) sameWidth(w http.ResponseWriter, width string) bool {
+	if width != strconv.FormatInt(ae.width, 10) {
+		http.Error(w, fmt.Sprintf("Sync bucket width must be %d", ae.width), http.StatusConflict)
+		return false
+	}
+	return true
+}
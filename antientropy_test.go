@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type syncNode struct {
+	server *Server
+	sync   *AntiEntropy
+	url    string
+}
+
+// newSyncNode serves the reconciliation endpoints of a fresh node
+func newSyncNode(t *testing.T, id string, width int64) *syncNode {
+	n := &syncNode{server: NewServer()}
+	n.server.nodeID = id
+	n.server.peers = NewPeers(nil, http.DefaultClient)
+	n.sync = NewAntiEntropy(n.server, width)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/time", n.server.handleGetTime)
+	mux.HandleFunc("/peer/sync/digest", n.sync.handlePeerDigest)
+	mux.HandleFunc("/peer/sync/events", n.sync.handlePeerEvents)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	n.url = ts.URL
+	return n
+}
+
+func TestAntiEntropyConverges(t *testing.T) {
+	a, b := newSyncNode(t, "a", 4), newSyncNode(t, "b", 4)
+	a.server.peers.Add(b.url)
+
+	// Both saw b's first event before a partition, then logged on their own
+	shared := b.server.logEvent("b-1", "Before the partition")
+	a.server.appendEvent(shared)
+	for i := 0; i < 6; i++ {
+		a.server.logEvent("a-"+string(rune('1'+i)), "On a")
+	}
+	b.server.logEvent("b-2", "On b")
+
+	result, err := a.sync.Sync(t.Context(), b.url)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if result.Pulled != 1 || result.Pushed != 6 || result.Buckets == 0 {
+		t.Errorf("Expected 1 pulled and 6 pushed, got %+v", result)
+	}
+	if a.server.events.Len() != 8 || b.server.events.Len() != 8 {
+		t.Fatalf("Expected 8 events on both, got %d and %d", a.server.events.Len(), b.server.events.Len())
+	}
+
+	// Merged events keep their origin and the logs now digest equally
+	for _, e := range eventsOfType(b.server, "") {
+		if strings.HasPrefix(e.ID, "a-") && e.Node != "a" {
+			t.Errorf("Expected %s attributed to a, got %q", e.ID, e.Node)
+		}
+	}
+	if b.server.clock.GetTime() < 6 {
+		t.Errorf("Expected b's clock raised past the merged events, got %d", b.server.clock.GetTime())
+	}
+	if result, _ := a.sync.Sync(t.Context(), b.url); result.Buckets != 0 {
+		t.Errorf("Expected the logs in sync, got %+v", result)
+	}
+	if verifyChain(b.server.events.Events()) != nil {
+		t.Error("Expected merged events chained into the log")
+	}
+}
+
+func TestClusterSyncResolvesNodeID(t *testing.T) {
+	a, b := newSyncNode(t, "a", 100), newSyncNode(t, "b", 100)
+	a.server.peers.Add(b.url)
+	b.server.logEvent("b-1", "On b")
+
+	req := httptest.NewRequest(http.MethodPost, "/cluster/sync?peer=b", nil)
+	w := httptest.NewRecorder()
+	a.sync.handleSync(w, req)
+	var response struct {
+		Results []SyncResult `json:"results"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	if len(response.Results) != 1 || response.Results[0].Peer != b.url || response.Results[0].Pulled != 1 {
+		t.Errorf("Expected one event pulled from b, got %+v", response.Results)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/cluster/sync?peer=c", nil)
+	w = httptest.NewRecorder()
+	a.sync.handleSync(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown peer, got %d", w.Code)
+	}
+}
+
+func TestAntiEntropyRejectsOtherWidth(t *testing.T) {
+	a, b := newSyncNode(t, "a", 10), newSyncNode(t, "b", 100)
+	a.server.peers.Add(b.url)
+
+	if _, err := a.sync.Sync(t.Context(), b.url); err == nil || !strings.Contains(err.Error(), "409") {
+		t.Errorf("Expected a 409 for mismatched widths, got %v", err)
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Segment describes a run of events archived off the log: a gzipped file
+// of their JSON lines, in log order, next to a manifest with this
+// description. Position is that of the first event in the whole log,
+// counting those trimmed off before, and names both objects.
+type Segment struct {
+	Key        string    `json:"key"`
+	Position   int64     `json:"position"`
+	Count      int       `json:"count"`
+	From       ClockTime `json:"from"`
+	To         ClockTime `json:"to"`
+	FirstWall  time.Time `json:"first_wall_time"`
+	LastWall   time.Time `json:"last_wall_time"`
+	Size       int       `json:"size"`
+	SHA256     string    `json:"sha256"`
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+// segmentPrefix is where segments and their manifests are kept
+const segmentPrefix = "segments/"
+
+func segmentKey(position int64) string {
+	return fmt.Sprintf("%s%020d.jsonl.gz", segmentPrefix, position)
+}
+
+// encodeSegment compresses events into a segment starting at position
+func encodeSegment(events []Event, position int64) (Segment, []byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(zw)
+	seg := Segment{Key: segmentKey(position), Position: position, Count: len(events)}
+	for i, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return Segment{}, nil, err
+		}
+		t := e.clockTime()
+		if i == 0 || t.Before(seg.From) {
+			seg.From = t
+		}
+		if i == 0 || seg.To.Before(t) {
+			seg.To = t
+		}
+		if i == 0 || e.WallTime.Before(seg.FirstWall) {
+			seg.FirstWall = e.WallTime
+		}
+		if i == 0 || e.WallTime.After(seg.LastWall) {
+			seg.LastWall = e.WallTime
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return Segment{}, nil, err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	seg.Size = buf.Len()
+	seg.SHA256 = hex.EncodeToString(sum[:])
+	return seg, buf.Bytes(), nil
+}
+
+// decodeSegment checks data against the segment's checksum and returns
+// its events
+func decodeSegment(seg Segment, data []byte) ([]Event, error) {
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != seg.SHA256 {
+		return nil, fmt.Errorf("segment %s does not match its checksum", seg.Key)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(zr)
+	events := make([]Event, 0, seg.Count)
+	for dec.More() {
+		var e Event
+		if err := dec.Decode(&e); err != nil {
+			return nil, fmt.Errorf("segment %s: %w", seg.Key, err)
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// Archiver moves the events logged more than age ago off the log into
+// segments of up to size events in an object store, such as S3. Unlike
+// rollups, archived events can be restored in full.
+type Archiver struct {
+	server   *Server
+	objects  ObjectStore
+	age      time.Duration
+	size     int
+	segments []Segment // by position
+	mutex    sync.RWMutex
+}
+
+// NewArchiver archives the events of a server older than age to objects,
+// in segments of up to size events
+func NewArchiver(server *Server, objects ObjectStore, age time.Duration, size int) *Archiver {
+	server.metrics.Counter("lamport_events_archived_total", "Events archived off the log into segments")
+	server.metrics.Counter("lamport_archive_failures_total", "Segments that failed to archive or restore")
+	return &Archiver{server: server, objects: objects, age: age, size: size}
+}
+
+// Load lists the segments already in the object store, archived before a
+// restart or by another server
+func (a *Archiver) Load(ctx context.Context) error {
+	keys, err := a.objects.List(ctx, segmentPrefix)
+	if err != nil {
+		return err
+	}
+	var segments []Segment
+	for _, key := range keys {
+		if !strings.HasSuffix(key, ".json") {
+			continue
+		}
+		data, err := a.objects.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		var seg Segment
+		if err := json.Unmarshal(data, &seg); err != nil {
+			return fmt.Errorf("manifest %s: %w", key, err)
+		}
+		segments = append(segments, seg)
+	}
+	slices.SortFunc(segments, func(x, y Segment) int { return int(x.Position - y.Position) })
+	a.mutex.Lock()
+	a.segments = segments
+	a.mutex.Unlock()
+	return nil
+}
+
+// errLogTrimmed stops archiving a segment whose events left the log while
+// it was uploaded, overwritten by a ring buffer for instance
+var errLogTrimmed = errors.New("the log was trimmed while archiving")
+
+// Archive moves the events logged before now minus the age off the log,
+// segment by segment, and returns how many it archived. Like rollups, the
+// log is archived from its oldest event up to the first recent one. Each
+// segment is uploaded before its events are trimmed off, so a failed
+// upload loses nothing; the next attempt overwrites it.
+func (a *Archiver) Archive(ctx context.Context, now time.Time) (int, error) {
+	s := a.server
+	cutoff := now.Add(-a.Age())
+	archived := 0
+	for {
+		s.mutex.Lock()
+		events := s.events.Events()
+		position := s.events.Dropped()
+		s.mutex.Unlock()
+		n := 0
+		for n < len(events) && n < a.size && events[n].WallTime.Before(cutoff) {
+			n++
+		}
+		if n == 0 {
+			return archived, nil
+		}
+
+		seg, data, err := encodeSegment(events[:n], position)
+		if err == nil {
+			seg.ArchivedAt = now
+			err = a.upload(ctx, seg, data)
+		}
+		if err != nil {
+			s.metrics.Inc("lamport_archive_failures_total")
+			return archived, err
+		}
+
+		s.mutex.Lock()
+		if s.events.Dropped() != position {
+			s.mutex.Unlock()
+			s.metrics.Inc("lamport_archive_failures_total")
+			return archived, errLogTrimmed
+		}
+		if _, err := trimChecked(s.events, n); err != nil {
+			s.mutex.Unlock()
+			s.metrics.Inc("lamport_archive_failures_total")
+			return archived, err
+		}
+		s.mutex.Unlock()
+
+		a.mutex.Lock()
+		a.segments = append(a.segments, seg)
+		a.mutex.Unlock()
+		archived += n
+		s.metrics.Add("lamport_events_archived_total", float64(n))
+		s.logger.Info("Events archived", "segment", seg.Key, "count", n)
+	}
+}
+
+// upload puts the segment, then its manifest, which lists it
+func (a *Archiver) upload(ctx context.Context, seg Segment, data []byte) error {
+	if err := a.objects.Put(ctx, seg.Key, data); err != nil {
+		return err
+	}
+	manifest, err := json.Marshal(seg)
+	if err != nil {
+		return err
+	}
+	return a.objects.Put(ctx, strings.TrimSuffix(seg.Key, ".jsonl.gz")+".json", manifest)
+}
+
+// Segments returns the segments holding events from from to to,
+// inclusive, in log order
+func (a *Archiver) Segments(from, to ClockTime) []Segment {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	segments := []Segment{}
+	for _, seg := range a.segments {
+		if !seg.To.Before(from) && !to.Before(seg.From) {
+			segments = append(segments, seg)
+		}
+	}
+	return segments
+}
+
+// Restore downloads the segments overlapping from to to and returns their
+// events in that range, in log order
+func (a *Archiver) Restore(ctx context.Context, from, to ClockTime) ([]Event, []Segment, error) {
+	segments := a.Segments(from, to)
+	events := []Event{}
+	for _, seg := range segments {
+		data, err := a.objects.Get(ctx, seg.Key)
+		if err == nil {
+			var archived []Event
+			if archived, err = decodeSegment(seg, data); err == nil {
+				for _, e := range archived {
+					if t := e.clockTime(); !t.Before(from) && !to.Before(t) {
+						events = append(events, e)
+					}
+				}
+			}
+		}
+		if err != nil {
+			a.server.metrics.Inc("lamport_archive_failures_total")
+			return nil, nil, err
+		}
+	}
+	return events, segments, nil
+}
+
+// Age returns how old events are when they are archived
+func (a *Archiver) Age() time.Duration {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return a.age
+}
+
+// SetAge changes the age of the events archived from the next run on
+func (a *Archiver) SetAge(age time.Duration) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.age = age
+}
+
+// Run archives every interval until ctx is done
+func (a *Archiver) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, err := a.Archive(ctx, now); err != nil {
+				a.server.logger.Error("Failed to archive events", "error", err)
+			}
+		}
+	}
+}
+
+// handleArchive lists the archived segments, GET /events/archive
+func (a *Archiver) handleArchive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	segments := a.Segments(ClockTime{}, ClockTime{Epoch: math.MaxInt64, Timestamp: math.MaxInt64})
+	total := 0
+	for _, seg := range segments {
+		total += seg.Count
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"age":      a.Age().String(),
+		"archived": total,
+		"segments": segments,
+	})
+}
+
+// handleRestore rehydrates the archived events of a range of timestamps,
+// POST /events/archive/restore/<from>/<to>[?epoch=<e>], from the segments
+// holding them. The events are returned, not put back into the log, whose
+// chain has moved on.
+func (a *Archiver) handleRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	fromPath, toPath, found := strings.Cut(strings.TrimPrefix(r.URL.Path, "/events/archive/restore/"), "/")
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	s := a.server
+	from, ok := s.parseEventTime(w, r, fromPath)
+	if !ok {
+		return
+	}
+	to, ok := s.parseEventTime(w, r, toPath)
+	if !ok {
+		return
+	}
+	if to.Before(from) {
+		http.Error(w, "Invalid range, to is before from", http.StatusBadRequest)
+		return
+	}
+
+	events, segments, err := a.Restore(r.Context(), from, to)
+	if err != nil {
+		s.logger.Error("Failed to restore events", "error", err)
+		http.Error(w, "Failed to restore archived events", http.StatusBadGateway)
+		return
+	}
+	keys := make([]string, len(segments))
+	for i, seg := range segments {
+		keys[i] = seg.Key
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"events":   events,
+		"count":    len(events),
+		"segments": keys,
+	})
+}
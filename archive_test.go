@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestArchiverMovesOldEvents(t *testing.T) {
+	server := NewServer()
+	objects := dirObjects(t.TempDir())
+	a := NewArchiver(server, objects, time.Hour, 2)
+	now := time.Now()
+	for i, age := range []time.Duration{3 * time.Hour, 2 * time.Hour, 2 * time.Hour, time.Minute, 3 * time.Hour} {
+		ts := int64(i + 1)
+		server.appendEvent(Event{ID: "e" + strconv.FormatInt(ts, 10), Timestamp: ts, WallTime: now.Add(-age)})
+	}
+
+	// The event of a minute ago stops the archive, old as the next one is
+	if n, err := a.Archive(t.Context(), now); n != 3 || err != nil {
+		t.Fatalf("Expected 3 events archived, got %d %v", n, err)
+	}
+	segments := a.Segments(ClockTime{}, ClockTime{Timestamp: 100})
+	if len(segments) != 2 || segments[0].Count != 2 || segments[1].Position != 2 || segments[1].From.Timestamp != 3 {
+		t.Errorf("Expected segments of e1 and e2 and of e3, got %+v", segments)
+	}
+	if verified := verifyLog(t, server); verified["valid"] != true || verified["dropped_count"] != float64(3) {
+		t.Errorf("Expected the kept events to verify, got %v", verified)
+	}
+
+	events, restored, err := a.Restore(t.Context(), ClockTime{Timestamp: 2}, ClockTime{Timestamp: 3})
+	if err != nil || fmt.Sprint(eventIDs(events)) != "[e2 e3]" || len(restored) != 2 {
+		t.Errorf("Expected e2 and e3 restored from both segments, got %v %v", eventIDs(events), err)
+	}
+
+	// A restarted server lists the segments from their manifests
+	reloaded := NewArchiver(NewServer(), objects, time.Hour, 2)
+	if err := reloaded.Load(t.Context()); err != nil || len(reloaded.Segments(ClockTime{}, ClockTime{Timestamp: 100})) != 2 {
+		t.Errorf("Expected 2 segments loaded, got %v", err)
+	}
+}
+
+func TestArchiverRejectsCorruptSegment(t *testing.T) {
+	server := NewServer()
+	objects := dirObjects(t.TempDir())
+	a := NewArchiver(server, objects, 0, 10)
+	server.appendEvent(Event{ID: "e1", Timestamp: 1, WallTime: time.Now().Add(-time.Minute)})
+	a.Archive(t.Context(), time.Now())
+
+	seg := a.Segments(ClockTime{}, ClockTime{Timestamp: 1})[0]
+	objects.Put(t.Context(), seg.Key, []byte("garbage"))
+	if _, _, err := a.Restore(t.Context(), ClockTime{}, ClockTime{Timestamp: 1}); err == nil {
+		t.Error("Expected the checksum mismatch reported")
+	}
+}
+
+func TestHandleArchive(t *testing.T) {
+	server := NewServer()
+	a := NewArchiver(server, dirObjects(t.TempDir()), time.Hour, 100)
+	server.logEvent("e1", "One")
+	a.Archive(t.Context(), time.Now().Add(2*time.Hour))
+	server.logEvent("e2", "Two")
+
+	w := httptest.NewRecorder()
+	a.handleArchive(w, httptest.NewRequest(http.MethodGet, "/events/archive", nil))
+	var listing map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&listing)
+	if w.Code != http.StatusOK || listing["archived"] != float64(1) {
+		t.Errorf("Expected e1 archived, got %d %v", w.Code, listing)
+	}
+
+	restore := func(path string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		a.handleRestore(w, httptest.NewRequest(http.MethodPost, path, nil))
+		var response map[string]interface{}
+		json.NewDecoder(w.Body).Decode(&response)
+		return w, response
+	}
+	if w, response := restore("/events/archive/restore/0/100"); w.Code != http.StatusOK || response["count"] != float64(1) {
+		t.Errorf("Expected e1 restored, got %d %v", w.Code, response)
+	}
+	for _, path := range []string{"/events/archive/restore/5/1", "/events/archive/restore/x/1", "/events/archive/restore/0/1?epoch=-1"} {
+		if w, _ := restore(path); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", path, w.Code)
+		}
+	}
+}
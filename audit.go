@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// auditHistory is how many entries GET /admin/audit keeps in memory. The
+// audit file keeps them all.
+const auditHistory = 10000
+
+// maxAuditBody is how much of a request body an audit entry records
+const maxAuditBody = 4096
+
+// auditSecrets removes secrets, such as those of webhooks, from the JSON
+// bodies audit entries record
+var auditSecrets = redactionRule{fields: []string{"secret", "token", "password"}, replacement: "redacted"}
+
+// AuditEntry records an administrative action: who did it, when in wall
+// and logical time, what they asked for and how it ended
+type AuditEntry struct {
+	Seq       int64               `json:"seq"`
+	Timestamp int64               `json:"lamport_timestamp"`
+	Epoch     int64               `json:"epoch,omitempty"`
+	WallTime  time.Time           `json:"wall_time"`
+	Actor     string              `json:"actor"`
+	Action    string              `json:"action"` // method and path
+	Params    map[string][]string `json:"params,omitempty"`
+	Body      string              `json:"body,omitempty"`
+	Truncated bool                `json:"body_truncated,omitempty"`
+	Status    int                 `json:"status"`
+	RequestID string              `json:"request_id,omitempty"`
+}
+
+// AuditLog is an append-only record of the requests that change state
+// through admin endpoints, kept apart from the event log so importing,
+// rewriting or trimming events leaves it alone. Entries are appended to a
+// file, when one is set, and never rewritten.
+type AuditLog struct {
+	entries []AuditEntry
+	next    int64
+	file    *os.File // nil to keep the log in memory
+	mutex   sync.Mutex
+}
+
+// NewAuditLog creates an audit log kept in memory
+func NewAuditLog() *AuditLog {
+	return &AuditLog{next: 1}
+}
+
+// OpenAuditLog opens or creates the audit file at path, a JSON line per
+// entry, and reads back the newest entries
+func OpenAuditLog(path string) (*AuditLog, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	a := &AuditLog{next: 1, file: file}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("invalid audit entry %d: %w", a.next, err)
+		}
+		a.keepLocked(e)
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+// Close releases the audit file
+func (a *AuditLog) Close() error {
+	if a.file == nil {
+		return nil
+	}
+	return a.file.Close()
+}
+
+func (a *AuditLog) keepLocked(e AuditEntry) {
+	a.entries = append(a.entries, e)
+	if len(a.entries) > auditHistory {
+		a.entries = a.entries[len(a.entries)-auditHistory:]
+	}
+	a.next = e.Seq + 1
+}
+
+// Record numbers an entry and appends it, flushed to the file before
+// Record returns
+func (a *AuditLog) Record(e AuditEntry) (AuditEntry, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	e.Seq = a.next
+	if a.file != nil {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return e, err
+		}
+		if _, err := a.file.Write(append(line, '\n')); err != nil {
+			return e, err
+		}
+		if err := a.file.Sync(); err != nil {
+			return e, err
+		}
+	}
+	a.keepLocked(e)
+	return e, nil
+}
+
+// AuditFilter selects audit entries. Zero fields match everything.
+type AuditFilter struct {
+	Actor  string
+	Action string // prefix of the action, such as "POST /admin/clock"
+	Since  int64  // entries after this sequence number
+	Limit  int    // newest entries up to this many
+}
+
+// Entries returns the entries kept in memory that match f, oldest first
+func (a *AuditLog) Entries(f AuditFilter) []AuditEntry {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	entries := []AuditEntry{}
+	for _, e := range a.entries {
+		if e.Seq > f.Since && (f.Actor == "" || e.Actor == f.Actor) && strings.HasPrefix(e.Action, f.Action) {
+			entries = append(entries, e)
+		}
+	}
+	if f.Limit > 0 && len(entries) > f.Limit {
+		entries = entries[len(entries)-f.Limit:]
+	}
+	return entries
+}
+
+// actor names the caller of r in the audit log: the holder of its API key
+// or the subject of its token, the admin token, the subject of its client
+// certificate or, failing those, its address
+func (s *Server) actor(r *http.Request) string {
+	credential := requestCredential(r)
+	switch {
+	case credential == "":
+	case s.adminToken != "" && subtle.ConstantTimeCompare([]byte(credential), []byte(s.adminToken)) == 1:
+		return "admin-token"
+	case s.access != nil:
+		if holder := s.access.Holder(credential); holder != "" {
+			return holder
+		}
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return "cert:" + r.TLS.VerifiedChains[0][0].Subject.CommonName
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "anonymous@" + host
+}
+
+// audited records the requests of admin handlers that may change state,
+// once they are handled. Reads are not recorded.
+func (s *Server) audited(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next(w, r)
+			return
+		}
+		entry := AuditEntry{
+			Actor:     s.actor(r),
+			Action:    r.Method + " " + r.URL.Path,
+			RequestID: requestIDFrom(r.Context()),
+		}
+		if query := r.URL.Query(); len(query) > 0 {
+			entry.Params = query
+		}
+		if r.Body != nil {
+			head, _ := io.ReadAll(io.LimitReader(r.Body, maxAuditBody+1))
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+			if len(head) > maxAuditBody {
+				head, entry.Truncated = head[:maxAuditBody], true
+			}
+			var body any
+			decoder := json.NewDecoder(bytes.NewReader(head))
+			decoder.UseNumber()
+			if !entry.Truncated && decoder.Decode(&body) == nil {
+				var count int
+				body = auditSecrets.redactJSON(body, &count)
+				head, _ = json.Marshal(body)
+			}
+			entry.Body = string(head)
+		}
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next(sw, r)
+
+		now := s.clock.Now()
+		entry.Timestamp, entry.Epoch, entry.WallTime, entry.Status = now.Timestamp, now.Epoch, time.Now(), sw.status
+		if _, err := s.audit.Record(entry); err != nil {
+			s.logger.Error("Failed to record audit entry", "action", entry.Action, "actor", entry.Actor, "error", err)
+		}
+	}
+}
+
+// statusWriter remembers the status code of a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// handleAudit lists audit entries, GET /admin/audit. ?actor= and ?action=
+// filter them, ?since= returns those after a sequence number and ?limit=
+// the newest ones.
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	f := AuditFilter{Actor: query.Get("actor"), Action: query.Get("action")}
+	if raw := query.Get("since"); raw != "" {
+		since, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || since < 0 {
+			http.Error(w, "Invalid since parameter", http.StatusBadRequest)
+			return
+		}
+		f.Since = since
+	}
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+		f.Limit = limit
+	}
+
+	entries := s.audit.Entries(f)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"entries": entries,
+		"count":   len(entries),
+	})
+}
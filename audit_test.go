@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	server := NewServer()
+	server.adminToken = "admin-token"
+	webhooks := NewWebhooks(server, 1, 0)
+	server.HandleFunc("/webhooks", server.admin(webhooks.handleWebhooks))
+
+	send := func(method, path, token, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		return rec
+	}
+
+	send(http.MethodPost, "/admin/clock/set?value=42", "admin-token", "")
+	send(http.MethodPost, "/admin/clock/reset", "wrong", "")
+	send(http.MethodGet, "/admin/tenants", "admin-token", "")
+	send(http.MethodPost, "/webhooks", "admin-token", `{"url":"http://example.com/hook","secret":"s3cret"}`)
+
+	rec := send(http.MethodGet, "/admin/audit", "admin-token", "")
+	var response struct {
+		Entries []AuditEntry `json:"entries"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	if len(response.Entries) != 3 {
+		t.Fatalf("Expected the three writes recorded, got %+v", response.Entries)
+	}
+	set, refused, hook := response.Entries[0], response.Entries[1], response.Entries[2]
+	if set.Actor != "admin-token" || set.Action != "POST /admin/clock/set" || set.Params["value"][0] != "42" || set.Status != http.StatusOK || set.Timestamp < 42 {
+		t.Errorf("Unexpected entry for the clock set: %+v", set)
+	}
+	if refused.Status != http.StatusUnauthorized || !strings.HasPrefix(refused.Actor, "anonymous@") {
+		t.Errorf("Expected the refused reset recorded, got %+v", refused)
+	}
+	if strings.Contains(hook.Body, "s3cret") || !strings.Contains(hook.Body, "example.com") {
+		t.Errorf("Expected the webhook secret masked, got %s", hook.Body)
+	}
+
+	rec = send(http.MethodGet, "/admin/audit?action=POST+/admin/clock&since=1", "admin-token", "")
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	if len(response.Entries) != 1 || response.Entries[0].Seq != 2 {
+		t.Errorf("Expected the filters applied, got %+v", response.Entries)
+	}
+}
+
+func TestAuditLogFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := OpenAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audit.Record(AuditEntry{Actor: "ops", Action: "POST /admin/chaos"})
+	audit.Record(AuditEntry{Actor: "ops", Action: "POST /admin/heal"})
+	audit.Close()
+
+	audit, err = OpenAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer audit.Close()
+	entry, _ := audit.Record(AuditEntry{Actor: "ci", Action: "POST /admin/import"})
+	if entry.Seq != 3 {
+		t.Errorf("Expected numbering to continue at 3, got %d", entry.Seq)
+	}
+	if entries := audit.Entries(AuditFilter{Actor: "ops"}); len(entries) != 2 {
+		t.Errorf("Expected the entries read back, got %+v", entries)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"sync"
+)
+
+// Bloom clocks (Ramabaja, 2019) replace the vector with a counting Bloom
+// filter of fixed size: every event increments k cells chosen by hashing
+// the event's identity. Stamps stay the same size however large the
+// cluster, in exchange for happened-before answers that may be false
+// positives. Concurrency answers are always right.
+
+// Default Bloom clock dimensions
+const (
+	defaultBloomSize   = 64
+	defaultBloomHashes = 3
+	maxBloomSize       = 1 << 16
+)
+
+// ErrBloomSize is returned when comparing or merging filters of different
+// sizes
+var ErrBloomSize = errors.New("bloom clock size mismatch")
+
+// BloomTime is the cell counts of a Bloom clock
+type BloomTime []uint64
+
+// Compare relates two Bloom times. before and after mean possibly
+// happened before or after, see FalsePositiveRate; concurrent is certain.
+func (t BloomTime) Compare(other BloomTime) (Ordering, error) {
+	if len(t) != len(other) {
+		return "", ErrBloomSize
+	}
+	less, greater := false, false
+	for i := range t {
+		if t[i] < other[i] {
+			less = true
+		} else if t[i] > other[i] {
+			greater = true
+		}
+	}
+	switch {
+	case less && greater:
+		return relationConcurrent, nil
+	case less:
+		return relationBefore, nil
+	case greater:
+		return relationAfter, nil
+	}
+	return relationEqual, nil
+}
+
+// FalsePositiveRate estimates the probability that t would be dominated
+// by other even though t did not happen before it: the chance that each of
+// the increments making up t falls on a cell other has incremented
+func (t BloomTime) FalsePositiveRate(other BloomTime) float64 {
+	if len(t) == 0 {
+		return 0
+	}
+	var sumT, sumOther float64
+	for i := range t {
+		sumT += float64(t[i])
+	}
+	for i := range other {
+		sumOther += float64(other[i])
+	}
+	hit := 1 - math.Pow(1-1/float64(len(t)), sumOther)
+	return math.Pow(hit, sumT)
+}
+
+// MarshalBinary encodes the size followed by the cells, as varints
+func (t BloomTime) MarshalBinary() ([]byte, error) {
+	b := binary.AppendUvarint(nil, uint64(len(t)))
+	for _, c := range t {
+		b = binary.AppendUvarint(b, c)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes cells written by MarshalBinary
+func (t *BloomTime) UnmarshalBinary(data []byte) error {
+	size, n := binary.Uvarint(data)
+	if n <= 0 || size == 0 || size > maxBloomSize {
+		return fmt.Errorf("%w: bad size", ErrInvalidStamp)
+	}
+	data = data[n:]
+	cells := make(BloomTime, size)
+	for i := range cells {
+		c, n := binary.Uvarint(data)
+		if n <= 0 {
+			return fmt.Errorf("%w: bad cell %d", ErrInvalidStamp, i)
+		}
+		cells[i] = c
+		data = data[n:]
+	}
+	if len(data) > 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrInvalidStamp, len(data))
+	}
+	*t = cells
+	return nil
+}
+
+// BloomClock is a fixed-size probabilistic replacement for VectorClock.
+// All processes of a system must use the same size and hash count.
+type BloomClock struct {
+	node   string
+	hashes int
+	events uint64
+	time   BloomTime
+	mutex  sync.Mutex
+}
+
+// NewBloomClock creates a Bloom clock of size cells for the process node,
+// incrementing hashes cells per event. Zero values select the defaults.
+func NewBloomClock(node string, size, hashes int) (*BloomClock, error) {
+	if size == 0 {
+		size = defaultBloomSize
+	}
+	if hashes == 0 {
+		hashes = defaultBloomHashes
+	}
+	if size < 0 || size > maxBloomSize {
+		return nil, fmt.Errorf("bloom clock size must be between 1 and %d", maxBloomSize)
+	}
+	if hashes < 0 || hashes > size {
+		return nil, fmt.Errorf("bloom clock hash count must be between 1 and the size")
+	}
+	return &BloomClock{node: node, hashes: hashes, time: make(BloomTime, size)}, nil
+}
+
+// Now returns a copy of the current cells
+func (bc *BloomClock) Now() BloomTime {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+	return append(BloomTime(nil), bc.time...)
+}
+
+// eventLocked increments the cells of the next event of this process,
+// found by double hashing its identity
+func (bc *BloomClock) eventLocked() {
+	bc.events++
+	h := fnv.New64a()
+	h.Write([]byte(bc.node))
+	h.Write([]byte{0})
+	h.Write(strconv.AppendUint(nil, bc.events, 10))
+	sum := h.Sum64()
+	h1, h2 := sum&math.MaxUint32, sum>>32|1
+
+	size := uint64(len(bc.time))
+	for i := 0; i < bc.hashes; i++ {
+		bc.time[(h1+uint64(i)*h2)%size]++
+	}
+}
+
+// LocalEvent records an internal event
+func (bc *BloomClock) LocalEvent() {
+	bc.mutex.Lock()
+	bc.eventLocked()
+	bc.mutex.Unlock()
+}
+
+// Send records a send event and returns the encoded cells
+func (bc *BloomClock) Send() []byte {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+	bc.eventLocked()
+	stamp, _ := bc.time.MarshalBinary()
+	return stamp
+}
+
+// Receive merges received cells by maximum and records the receive event
+func (bc *BloomClock) Receive(stamp []byte) error {
+	var received BloomTime
+	if err := received.UnmarshalBinary(stamp); err != nil {
+		return err
+	}
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+	if len(received) != len(bc.time) {
+		return ErrBloomSize
+	}
+	for i, c := range received {
+		bc.time[i] = max(bc.time[i], c)
+	}
+	bc.eventLocked()
+	return nil
+}
+
+// Compare decodes and compares two Bloom stamps
+func (bc *BloomClock) Compare(a, b []byte) (Ordering, error) {
+	ta, tb, err := decodeBloomPair(a, b)
+	if err != nil {
+		return "", err
+	}
+	return ta.Compare(tb)
+}
+
+// HappenedBefore reports whether a possibly happened before b, and if so
+// the estimated probability that the answer is a false positive
+func (bc *BloomClock) HappenedBefore(a, b []byte) (bool, float64, error) {
+	ta, tb, err := decodeBloomPair(a, b)
+	if err != nil {
+		return false, 0, err
+	}
+	ordering, err := ta.Compare(tb)
+	if err != nil || ordering != relationBefore {
+		return false, 0, err
+	}
+	return true, ta.FalsePositiveRate(tb), nil
+}
+
+func decodeBloomPair(a, b []byte) (BloomTime, BloomTime, error) {
+	var ta, tb BloomTime
+	if err := ta.UnmarshalBinary(a); err != nil {
+		return nil, nil, fmt.Errorf("stamp a: %w", err)
+	}
+	if err := tb.UnmarshalBinary(b); err != nil {
+		return nil, nil, fmt.Errorf("stamp b: %w", err)
+	}
+	return ta, tb, nil
+}
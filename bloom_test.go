@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"testing"
+)
+
+// simulateSends runs a random message exchange between processes, with
+// one clock of each kind per process, and returns the stamps of all send
+// events per kind
+func simulateSends(seed uint64, processes, steps int, kinds ...func(node string) LogicalClock) [][][]byte {
+	rng := rand.New(rand.NewPCG(seed, 0))
+	clocks := make([][]LogicalClock, processes)
+	for p := range clocks {
+		for _, kind := range kinds {
+			clocks[p] = append(clocks[p], kind(fmt.Sprintf("p%d", p)))
+		}
+	}
+
+	type message struct {
+		to     int
+		stamps [][]byte
+	}
+	var inFlight []message
+	stamps := make([][][]byte, len(kinds))
+	for step := 0; step < steps; step++ {
+		if len(inFlight) > 0 && rng.IntN(2) == 0 {
+			i := rng.IntN(len(inFlight))
+			m := inFlight[i]
+			inFlight = append(inFlight[:i], inFlight[i+1:]...)
+			for k, clock := range clocks[m.to] {
+				clock.Receive(m.stamps[k])
+			}
+			continue
+		}
+		p := rng.IntN(processes)
+		m := message{to: rng.IntN(processes)}
+		for k, clock := range clocks[p] {
+			stamp := clock.Send()
+			m.stamps = append(m.stamps, stamp)
+			stamps[k] = append(stamps[k], stamp)
+		}
+		inFlight = append(inFlight, m)
+	}
+	return stamps
+}
+
+func vectorKind(node string) LogicalClock { return NewVectorClock(node) }
+
+func bloomKind(size, hashes int) func(string) LogicalClock {
+	return func(node string) LogicalClock {
+		bc, _ := NewBloomClock(node, size, hashes)
+		return bc
+	}
+}
+
+// bloomAccuracy returns the share of concurrent pairs a Bloom clock orders
+// and the mean false positive rate it reported for them
+func bloomAccuracy(vector, bloom [][]byte) (measured, reported float64) {
+	vc, bc := NewVectorClock(""), &BloomClock{}
+	var concurrent, falsePositives int
+	for i := range vector {
+		for j := range vector {
+			if i == j {
+				continue
+			}
+			if truth, _ := vc.Compare(vector[i], vector[j]); truth != relationConcurrent {
+				continue
+			}
+			concurrent++
+			if before, rate, _ := bc.HappenedBefore(bloom[i], bloom[j]); before {
+				falsePositives++
+				reported += rate
+			}
+		}
+	}
+	if falsePositives > 0 {
+		reported /= float64(falsePositives)
+	}
+	return float64(falsePositives) / float64(max(concurrent, 1)), reported
+}
+
+func TestBloomClockNoFalseNegatives(t *testing.T) {
+	stamps := simulateSends(7, 20, 600, vectorKind, bloomKind(32, 2))
+	vector, bloom := stamps[0], stamps[1]
+	vc, bc := NewVectorClock(""), &BloomClock{}
+
+	for i := range vector {
+		for j := range vector {
+			truth, _ := vc.Compare(vector[i], vector[j])
+			got, err := bc.Compare(bloom[i], bloom[j])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if truth != relationConcurrent && got != truth {
+				t.Fatalf("Events %d and %d: expected %s, got %s", i, j, truth, got)
+			}
+			if got == relationConcurrent && truth != relationConcurrent {
+				t.Fatalf("Events %d and %d: reported concurrent but %s", i, j, truth)
+			}
+		}
+	}
+
+	measured, reported := bloomAccuracy(vector, bloom)
+	if measured == 0 {
+		t.Errorf("Expected a small filter to report some false positives")
+	}
+	if reported <= 0 || reported > 1 {
+		t.Errorf("Expected a reported rate in (0, 1], got %f", reported)
+	}
+}
+
+func TestBloomClockHappenedBefore(t *testing.T) {
+	a, _ := NewBloomClock("a", 0, 0)
+	b, _ := NewBloomClock("b", 0, 0)
+	sent := a.Send()
+	b.Receive(sent)
+	later := b.Send()
+
+	before, rate, err := a.HappenedBefore(sent, later)
+	if err != nil || !before {
+		t.Fatalf("Expected sent to have happened before, got %v %v", before, err)
+	}
+	if rate <= 0 || rate >= 1 {
+		t.Errorf("Expected a false positive rate in (0, 1), got %f", rate)
+	}
+	if before, _, _ := a.HappenedBefore(later, sent); before {
+		t.Errorf("Expected later not to have happened before sent")
+	}
+}
+
+func TestBloomClockValidation(t *testing.T) {
+	if _, err := NewBloomClock("a", -1, 0); err == nil {
+		t.Errorf("Expected an error for a negative size")
+	}
+	if _, err := NewBloomClock("a", 4, 5); err == nil {
+		t.Errorf("Expected an error for more hashes than cells")
+	}
+
+	small, _ := NewBloomClock("a", 8, 2)
+	large, _ := NewBloomClock("b", 16, 2)
+	if err := large.Receive(small.Send()); !errors.Is(err, ErrBloomSize) {
+		t.Errorf("Expected ErrBloomSize, got %v", err)
+	}
+	if _, err := large.Compare(small.Send(), large.Send()); !errors.Is(err, ErrBloomSize) {
+		t.Errorf("Expected ErrBloomSize, got %v", err)
+	}
+
+	for _, data := range [][]byte{nil, {0}, {2, 1}, {1, 1, 1}} {
+		if err := new(BloomTime).UnmarshalBinary(data); !errors.Is(err, ErrInvalidStamp) {
+			t.Errorf("Expected ErrInvalidStamp for %x, got %v", data, err)
+		}
+	}
+}
+
+// BenchmarkClockStamps measures the stamp size and send cost of vector and
+// Bloom clocks in a cluster of 1000 processes, and the share of concurrent
+// pairs each Bloom size wrongly orders
+func BenchmarkClockStamps(b *testing.B) {
+	const processes = 1000
+	kinds := []struct {
+		name string
+		kind func(string) LogicalClock
+	}{
+		{"vector", vectorKind},
+		{"bloom-64x3", bloomKind(64, 3)},
+		{"bloom-256x3", bloomKind(256, 3)},
+		{"bloom-1024x4", bloomKind(1024, 4)},
+	}
+
+	// Every process has sent one message to process 0, so its clock knows
+	// all of them
+	for _, k := range kinds {
+		b.Run(k.name, func(b *testing.B) {
+			receiver := k.kind("p0")
+			for p := 1; p < processes; p++ {
+				receiver.Receive(k.kind(fmt.Sprintf("p%d", p)).Send())
+			}
+			var size int
+			for b.Loop() {
+				size = len(receiver.Send())
+			}
+			b.ReportMetric(float64(size), "bytes/stamp")
+		})
+	}
+
+	for _, k := range kinds[1:] {
+		b.Run(k.name+"-accuracy", func(b *testing.B) {
+			var measured, reported float64
+			for b.Loop() {
+				stamps := simulateSends(1, 50, 400, vectorKind, k.kind)
+				measured, reported = bloomAccuracy(stamps[0], stamps[1])
+			}
+			b.ReportMetric(measured, "false-positives")
+			b.ReportMetric(reported, "reported-rate")
+		})
+	}
+}
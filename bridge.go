@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Message headers carrying Lamport time across message brokers
+const (
+	headerTimestamp = "Lamport-Timestamp"
+	headerEpoch     = "Lamport-Epoch"
+	headerSender    = "Lamport-Sender"
+	headerEventID   = "Lamport-Event-Id"
+	headerRequestID = "X-Request-ID"
+	headerSignature = "Lamport-Signature"
+	headerKeyID     = "Lamport-Key-Id"
+	// Stamped on requests between peers, to measure propagation delay
+	headerSentAt   = "Lamport-Sent-At"
+	headerSentTime = "Lamport-Sent-Time"
+)
+
+// ErrMissingTimestamp is returned for broker messages without a Lamport
+// timestamp header
+var ErrMissingTimestamp = errors.New("missing " + headerTimestamp + " header")
+
+// parseClockHeaders reads the Lamport time of a broker message. Messages
+// without an epoch header are assumed to be in the current epoch.
+func parseClockHeaders(get func(string) string, currentEpoch int64) (ClockTime, error) {
+	raw := get(headerTimestamp)
+	if raw == "" {
+		return ClockTime{}, ErrMissingTimestamp
+	}
+	timestamp, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || timestamp < 0 {
+		return ClockTime{}, fmt.Errorf("invalid %s header %q", headerTimestamp, raw)
+	}
+
+	received := ClockTime{Epoch: currentEpoch, Timestamp: timestamp}
+	if raw := get(headerEpoch); raw != "" {
+		if received.Epoch, err = strconv.ParseInt(raw, 10, 64); err != nil || received.Epoch < 0 {
+			return ClockTime{}, fmt.Errorf("invalid %s header %q", headerEpoch, raw)
+		}
+	}
+	return received, nil
+}
+
+// clockHeaders returns the headers announcing a local event to a broker
+func clockHeaders(e Event, nodeID string) map[string]string {
+	headers := map[string]string{
+		headerTimestamp: strconv.FormatInt(e.Timestamp, 10),
+		headerEpoch:     strconv.FormatInt(e.Epoch, 10),
+		headerEventID:   e.ID,
+	}
+	if nodeID != "" {
+		headers[headerSender] = nodeID
+	}
+	if e.RequestID != "" {
+		headers[headerRequestID] = e.RequestID
+	}
+	if e.Signature != "" {
+		headers[headerSignature] = e.Signature
+		headers[headerKeyID] = e.KeyID
+	}
+	return headers
+}
+
+// publishable reports whether an event originated on this node and should
+// be announced to brokers. Received and backfilled events are not
+// republished, so nodes sharing a subject do not echo each other.
+func publishable(e Event) bool {
+	return e.SentAt == nil && !e.Backfilled
+}
+
+// receiveBridged merges a message consumed from a broker into the clock.
+// Messages this node published itself and duplicates are ignored and
+// reported as skipped.
+func (s *Server) receiveBridged(transport string, get func(string) string, message string) (Event, bool, error) {
+	sender := get(headerSender)
+	if sender != "" && sender == s.nodeID {
+		return Event{}, false, nil
+	}
+
+	received, err := parseClockHeaders(get, s.clock.Now().Epoch)
+	if err != nil {
+		s.metrics.Inc("lamport_bridge_rejected_total", "transport", transport)
+		return Event{}, false, err
+	}
+
+	ctx := context.Background()
+	if id := get(headerRequestID); validRequestID(id) {
+		ctx = contextWithRequestID(ctx, id)
+	}
+	ctx, err = s.checkSignature(ctx, transport, get(headerKeyID), get(headerSignature), get(headerEventID), received, message)
+	if err != nil {
+		s.metrics.Inc("lamport_bridge_rejected_total", "transport", transport)
+		return Event{}, false, err
+	}
+	event, err := s.receiveMessage(ctx, sender, get(headerEventID), received, message)
+	if errors.Is(err, ErrDuplicateMessage) {
+		s.metrics.Inc("lamport_duplicate_messages_total", "transport", transport)
+		return Event{}, false, nil
+	}
+	if err != nil {
+		s.metrics.Inc("lamport_bridge_rejected_total", "transport", transport)
+		return Event{}, false, err
+	}
+	s.metrics.Inc("lamport_bridge_received_total", "transport", transport)
+	return event, true, nil
+}
+
+// forwardLocalEvents calls publish for every publishable event until ctx is
+// done, including events still buffered at that point
+func (s *Server) forwardLocalEvents(ctx context.Context, publish func(Event)) {
+	sub := s.broker.Subscribe(EventFilter{})
+	defer s.broker.Unsubscribe(sub)
+
+	forward := func(e Event) {
+		if publishable(e) {
+			publish(e)
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case e := <-sub.Events:
+					forward(e)
+				default:
+					return
+				}
+			}
+		case e := <-sub.Events:
+			forward(e)
+		}
+	}
+}
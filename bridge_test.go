@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func headerGetter(headers map[string]string) func(string) string {
+	return func(key string) string { return headers[key] }
+}
+
+func TestParseClockHeaders(t *testing.T) {
+	received, err := parseClockHeaders(headerGetter(map[string]string{headerTimestamp: "42"}), 3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if received != (ClockTime{Epoch: 3, Timestamp: 42}) {
+		t.Errorf("Expected 3:42, got %s", received)
+	}
+
+	received, err = parseClockHeaders(headerGetter(map[string]string{headerTimestamp: "7", headerEpoch: "1"}), 0)
+	if err != nil || received != (ClockTime{Epoch: 1, Timestamp: 7}) {
+		t.Errorf("Expected 1:7, got %s (%v)", received, err)
+	}
+
+	if _, err := parseClockHeaders(headerGetter(nil), 0); !errors.Is(err, ErrMissingTimestamp) {
+		t.Errorf("Expected ErrMissingTimestamp, got %v", err)
+	}
+	for _, headers := range []map[string]string{
+		{headerTimestamp: "soon"},
+		{headerTimestamp: "-1"},
+		{headerTimestamp: "1", headerEpoch: "x"},
+	} {
+		if _, err := parseClockHeaders(headerGetter(headers), 0); err == nil {
+			t.Errorf("Expected headers %v to be rejected", headers)
+		}
+	}
+}
+
+func TestClockHeadersRoundTrip(t *testing.T) {
+	event := Event{ID: "event-1", Timestamp: 9, Epoch: 2, RequestID: "req-1"}
+	headers := clockHeaders(event, "a")
+
+	if headers[headerSender] != "a" || headers[headerEventID] != "event-1" || headers[headerRequestID] != "req-1" {
+		t.Errorf("Unexpected headers: %v", headers)
+	}
+	received, err := parseClockHeaders(headerGetter(headers), 0)
+	if err != nil || received != (ClockTime{Epoch: 2, Timestamp: 9}) {
+		t.Errorf("Expected 2:9, got %s (%v)", received, err)
+	}
+}
+
+func TestReceiveBridged(t *testing.T) {
+	server := NewServer()
+	server.nodeID = "a"
+
+	event, ok, err := server.receiveBridged("test", headerGetter(map[string]string{
+		headerTimestamp: "10",
+		headerSender:    "b",
+		headerRequestID: "req-7",
+	}), "Hello")
+	if err != nil || !ok {
+		t.Fatalf("Expected message to be merged, got %v", err)
+	}
+	if event.Timestamp != 11 || event.Sender != "b" || event.RequestID != "req-7" {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+
+	// Our own publications come back on shared subjects and are skipped
+	_, ok, err = server.receiveBridged("test", headerGetter(map[string]string{
+		headerTimestamp: "50",
+		headerSender:    "a",
+	}), "Echo")
+	if err != nil || ok {
+		t.Errorf("Expected own message to be skipped, got ok=%v err=%v", ok, err)
+	}
+	if server.clock.GetTime() != 11 {
+		t.Errorf("Expected clock to stay at 11, got %d", server.clock.GetTime())
+	}
+
+	if _, _, err := server.receiveBridged("test", headerGetter(nil), "No header"); err == nil {
+		t.Error("Expected message without timestamp to be rejected")
+	}
+	if got := server.metrics.Value("lamport_bridge_received_total", "transport", "test"); got != 1 {
+		t.Errorf("Expected 1 received message, got %v", got)
+	}
+	if got := server.metrics.Value("lamport_bridge_rejected_total", "transport", "test"); got != 1 {
+		t.Errorf("Expected 1 rejected message, got %v", got)
+	}
+}
+
+func TestPublishable(t *testing.T) {
+	if !publishable(Event{ID: "event-1"}) {
+		t.Error("Expected local events to be published")
+	}
+	if publishable(Event{ID: "msg-2", SentAt: &ClockTime{Timestamp: 1}}) {
+		t.Error("Expected received events not to be republished")
+	}
+	if publishable(Event{ID: "legacy-1", Backfilled: true}) {
+		t.Error("Expected backfilled events not to be published")
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// BroadcastResult is the outcome of a broadcast message at one peer: the
+// receive event it produced there, or the error it failed with. Pending
+// peers had not answered yet when the broadcast returned.
+type BroadcastResult struct {
+	Peer      string `json:"peer"`
+	OK        bool   `json:"ok"`
+	Pending   bool   `json:"pending,omitempty"`
+	EventID   string `json:"event_id,omitempty"`
+	Timestamp int64  `json:"lamport_timestamp,omitempty"`
+	Epoch     int64  `json:"epoch,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// broadcast records one send event and posts the message, stamped with it,
+// to the /message of every peer at once. The sender and event ID let peers
+// that receive it again by another path merge it once. With a quorum it
+// returns as soon as that many peers acknowledged; the other requests go on
+// in the background until ctx's deadline.
+func (s *Server) broadcast(ctx context.Context, message string, quorum int) (Event, []BroadcastResult, error) {
+	event, err := s.commitLocal(Event{
+		ID:        localEventID("broadcast-", time.Now()),
+		Message:   message,
+		RequestID: requestIDFrom(ctx),
+	})
+	if err != nil {
+		return Event{}, nil, err
+	}
+
+	query := url.Values{
+		"timestamp": {strconv.FormatInt(event.Timestamp, 10)},
+		"epoch":     {strconv.FormatInt(event.Epoch, 10)},
+		"message":   {message},
+		"sender":    {s.nodeID},
+		"id":        {event.ID},
+	}
+	header := http.Header{"Accept": {"application/json"}}
+	if event.RequestID != "" {
+		header.Set(headerRequestID, event.RequestID)
+	}
+
+	// Requests outlive an early return, but not the deadline
+	sendCtx, cancel := context.WithoutCancel(ctx), context.CancelFunc(func() {})
+	if deadline, ok := ctx.Deadline(); ok {
+		sendCtx, cancel = context.WithDeadline(context.WithoutCancel(ctx), deadline)
+	}
+	urls := s.peers.URLs()
+	answers := make(chan BroadcastResult, len(urls))
+	var sends sync.WaitGroup
+	for _, peer := range urls {
+		sends.Add(1)
+		go func() {
+			defer sends.Done()
+			answers <- s.broadcastTo(sendCtx, peer, "/message?"+query.Encode(), header)
+		}()
+	}
+	go func() {
+		sends.Wait()
+		cancel()
+	}()
+
+	answered := make(map[string]BroadcastResult, len(urls))
+	acknowledged := 0
+collect:
+	for len(answered) < len(urls) && (quorum == 0 || acknowledged < quorum) {
+		select {
+		case result := <-answers:
+			answered[result.Peer] = result
+			if result.OK {
+				acknowledged++
+			}
+		case <-ctx.Done():
+			break collect
+		}
+	}
+
+	results := make([]BroadcastResult, 0, len(urls))
+	for _, peer := range urls {
+		result, ok := answered[peer]
+		if !ok {
+			result = BroadcastResult{Peer: peer, Pending: true}
+		}
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Peer < results[j].Peer })
+	return event, results, nil
+}
+
+// broadcastTo posts a broadcast message to one peer
+func (s *Server) broadcastTo(ctx context.Context, peer, path string, header http.Header) BroadcastResult {
+	result := BroadcastResult{Peer: peer}
+	data, err := s.peers.Do(ctx, peer, http.MethodPost, path, header, nil)
+	var received Event
+	switch {
+	case err != nil:
+		result.Error = err.Error()
+	case json.Unmarshal(data, &received) != nil:
+		result.Error = "invalid response"
+	default:
+		result.OK = true
+		result.EventID = received.ID
+		result.Timestamp = received.Timestamp
+		result.Epoch = received.Epoch
+	}
+	return result
+}
+
+// parseQuorum reads the number of peers that must acknowledge a broadcast:
+// a number up to the number of peers, or majority for a majority of the
+// cluster counting this node. Empty means no quorum.
+func parseQuorum(v string, peers int) (int, error) {
+	switch v {
+	case "":
+		return 0, nil
+	case "majority":
+		return (peers + 1) / 2, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || n > peers {
+		return 0, fmt.Errorf("Invalid quorum, expected majority or a number of peers from 1 to %d", peers)
+	}
+	return n, nil
+}
+
+// handleBroadcast sends a message to all peers with a single tick,
+// POST /broadcast?message=<msg>[&quorum=<n>|majority][&timeout=<d>].
+// Peers that fail are reported in the results rather than failing the
+// request, unless they leave the quorum short: the answer is then 504 when
+// the timeout ran out, 502 when too many peers failed.
+func (s *Server) handleBroadcast(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	message := query.Get("message")
+	if message == "" {
+		http.Error(w, "Missing message parameter", http.StatusBadRequest)
+		return
+	}
+	quorum, err := parseQuorum(query.Get("quorum"), len(s.peers.URLs()))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	timeout := clusterTimeout
+	if v := query.Get("timeout"); v != "" {
+		if timeout, err = time.ParseDuration(v); err != nil || timeout <= 0 || timeout > maxWaitTimeout {
+			http.Error(w, "Invalid timeout, expected a duration up to 5m", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	event, results, err := s.broadcast(ctx, message, quorum)
+	if err != nil {
+		s.writeCommitError(w, err)
+		return
+	}
+
+	delivered, pending := 0, 0
+	for _, result := range results {
+		switch {
+		case result.OK:
+			delivered++
+		case result.Pending:
+			pending++
+		}
+	}
+	response := map[string]interface{}{
+		"event":     event,
+		"peers":     results,
+		"delivered": delivered,
+		"failed":    len(results) - delivered - pending,
+		"pending":   pending,
+	}
+	status := http.StatusOK
+	if quorum > 0 {
+		response["quorum"] = quorum
+		response["quorum_reached"] = delivered >= quorum
+		switch {
+		case delivered >= quorum:
+		case pending > 0:
+			status = http.StatusGatewayTimeout
+		default:
+			status = http.StatusBadGateway
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
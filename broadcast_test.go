@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleBroadcast(t *testing.T) {
+	b := NewServer()
+	b.clock.Update(9) // 10
+	peerB := httptest.NewServer(b)
+	defer peerB.Close()
+	c := NewServer()
+	peerC := httptest.NewServer(c)
+	defer peerC.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	a := NewServer()
+	a.nodeID = "a"
+	a.peers = NewPeers([]string{peerB.URL, peerC.URL, down.URL}, http.DefaultClient)
+
+	w := httptest.NewRecorder()
+	a.handleBroadcast(w, httptest.NewRequest(http.MethodPost, "/broadcast?message=deploy", nil))
+	var response struct {
+		Event     Event             `json:"event"`
+		Peers     []BroadcastResult `json:"peers"`
+		Delivered int               `json:"delivered"`
+		Failed    int               `json:"failed"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	if w.Code != http.StatusOK || response.Event.Timestamp != 1 || response.Delivered != 2 || response.Failed != 1 || len(response.Peers) != 3 {
+		t.Fatalf("Expected one tick delivered to 2 of 3 peers, got %d %+v", w.Code, response)
+	}
+	if a.clock.GetTime() != 1 {
+		t.Errorf("Expected a single tick, got %d", a.clock.GetTime())
+	}
+	for _, result := range response.Peers {
+		var want int64
+		switch result.Peer {
+		case peerB.URL:
+			want = 11
+		case peerC.URL:
+			want = 2
+		default:
+			if result.OK || result.Error == "" {
+				t.Errorf("Expected %s to fail, got %+v", result.Peer, result)
+			}
+			continue
+		}
+		if !result.OK || result.Timestamp != want || result.EventID == "" {
+			t.Errorf("Expected %s to receive at %d, got %+v", result.Peer, want, result)
+		}
+	}
+
+	// A peer receiving the same broadcast again merges it once
+	if _, err := b.receiveMessage(t.Context(), "a", response.Event.ID, ClockTime{Timestamp: 1}, "deploy"); err == nil || b.events.Len() != 1 {
+		t.Errorf("Expected the copy recognized as a duplicate, got %v with %d events", err, b.events.Len())
+	}
+
+	for method, target := range map[string]string{http.MethodPost: "/broadcast", http.MethodGet: "/broadcast?message=x"} {
+		w := httptest.NewRecorder()
+		a.handleBroadcast(w, httptest.NewRequest(method, target, nil))
+		if w.Code != http.StatusBadRequest && w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Expected %s %s refused, got %d", method, target, w.Code)
+		}
+	}
+}
+
+func TestBroadcastQuorum(t *testing.T) {
+	release := make(chan struct{})
+	fast := httptest.NewServer(NewServer())
+	defer fast.Close()
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	a := NewServer()
+	a.nodeID = "a"
+	a.peers = NewPeers([]string{fast.URL, slow.URL, down.URL}, http.DefaultClient)
+	post := func(query string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		a.handleBroadcast(w, httptest.NewRequest(http.MethodPost, "/broadcast?message=deploy&"+query, nil))
+		var response map[string]interface{}
+		json.NewDecoder(w.Body).Decode(&response)
+		return w.Code, response
+	}
+
+	// The broadcast returns once the fast peer answered, without waiting
+	// for the slow one
+	code, response := post("quorum=1&timeout=1m")
+	if code != http.StatusOK || response["quorum_reached"] != true || response["delivered"] != 1.0 {
+		t.Errorf("Expected the quorum of 1 reached, got %d %v", code, response)
+	}
+	code, response = post("quorum=2&timeout=50ms")
+	if code != http.StatusGatewayTimeout || response["quorum_reached"] != false || response["pending"] != 1.0 || response["failed"] != 1.0 {
+		t.Errorf("Expected the quorum of 2 timed out with the slow peer pending, got %d %v", code, response)
+	}
+
+	a.peers = NewPeers([]string{fast.URL, down.URL}, http.DefaultClient)
+	if code, response = post("quorum=2"); code != http.StatusBadGateway || response["failed"] != 1.0 {
+		t.Errorf("Expected 502 once the down peer failed, got %d %v", code, response)
+	}
+	// A majority of 3 nodes is this node and 1 peer
+	if code, response = post("quorum=majority"); code != http.StatusOK || response["quorum"] != 1.0 {
+		t.Errorf("Expected a majority of 1 peer reached, got %d %v", code, response)
+	}
+	for _, query := range []string{"quorum=0", "quorum=3", "quorum=most", "timeout=-1s", "timeout=1h"} {
+		if code, _ := post(query); code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", query, code)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"net/http"
+	"sync"
+)
+
+// ChainBreak describes the first event at which the hash chain of the log
+// does not verify
+type ChainBreak struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id"`
+	Reason   string `json:"reason"`
+	Expected string `json:"expected"`
+	Got      string `json:"got"`
+}
+
+// eventHash is the SHA-256 hash of an event's JSON encoding, which covers
+// the hash of the previous event but not its own
+func eventHash(e Event) string {
+	h := hashers.Get().(*eventHasher)
+	defer func() {
+		h.event = Event{} // do not keep payloads alive in the pool
+		hashers.Put(h)
+	}()
+	// Encoding the pooled copy spares boxing the event on every call
+	h.event = e
+	h.event.Hash = ""
+
+	// Encode adds a newline that json.Marshal, which the chain was defined
+	// with, does not
+	h.buf.Reset()
+	h.enc.Encode(&h.event)
+	data := bytes.TrimSuffix(h.buf.Bytes(), []byte("\n"))
+
+	var sum [sha256.Size]byte
+	var out [2 * sha256.Size]byte
+	h.sha.Reset()
+	h.sha.Write(data)
+	hex.Encode(out[:], h.sha.Sum(sum[:0]))
+	return string(out[:])
+}
+
+// eventHasher holds the buffers of eventHash, reused across events since
+// every append hashes one
+type eventHasher struct {
+	event Event
+	buf   bytes.Buffer
+	enc   *json.Encoder
+	sha   hash.Hash
+}
+
+var hashers = sync.Pool{New: func() any {
+	h := &eventHasher{sha: sha256.New()}
+	h.enc = json.NewEncoder(&h.buf)
+	return h
+}}
+
+// chainLocked links an event to the head of the log and makes it the new
+// head
+func (s *Server) chainLocked(event Event) Event {
+	event.PrevHash = s.head
+	event.Hash = eventHash(event)
+	s.head = event.Hash
+	return event
+}
+
+// sharedLog is an event store several servers append to, such as
+// PostgresStore. lockHead holds off the appends of the others until
+// unlock, and returns the hash of the newest event in the shared log.
+type sharedLog interface {
+	lockHead() (head string, unlock func(), err error)
+}
+
+// syncHeadLocked moves the head to that of a shared log and returns the
+// function releasing it once the caller has appended. If the log cannot be
+// locked the event is chained to this server's own head.
+func (s *Server) syncHeadLocked() (unlock func()) {
+	shared, ok := s.events.(sharedLog)
+	if !ok {
+		return func() {}
+	}
+	head, unlock, err := shared.lockHead()
+	if err != nil {
+		s.logger.Error("Failed to lock the shared log", "error", err)
+		return func() {}
+	}
+	s.head = head
+	return unlock
+}
+
+// rechainLocked recomputes the chain of events from the one at index from
+// on and replaces the log with them. The head is kept when the store fails
+// to write the new log.
+func (s *Server) rechainLocked(events []Event, from int) error {
+	head := s.head
+	s.head = ""
+	if from > 0 {
+		s.head = events[from-1].Hash
+	}
+	for i := from; i < len(events); i++ {
+		events[i] = s.chainLocked(events[i])
+	}
+	if err := replaceChecked(s.events, events); err != nil {
+		s.head = head
+		return err
+	}
+	return nil
+}
+
+// verifyChain replays the chain and returns the first break, or nil when
+// every event links to its predecessor and matches its hash
+func verifyChain(events []Event) *ChainBreak {
+	return verifyChainFrom("", events)
+}
+
+// verifyChainFrom is verifyChain for a log whose older events were
+// dropped, so the first event links to prev rather than to nothing
+func verifyChainFrom(prev string, events []Event) *ChainBreak {
+	for i, e := range events {
+		if e.PrevHash != prev {
+			return &ChainBreak{Index: i, ID: e.ID, Reason: "broken link", Expected: prev, Got: e.PrevHash}
+		}
+		if sum := eventHash(e); e.Hash != sum {
+			return &ChainBreak{Index: i, ID: e.ID, Reason: "hash mismatch", Expected: sum, Got: e.Hash}
+		}
+		prev = e.Hash
+	}
+	return nil
+}
+
+// handleVerifyEvents replays the hash chain of the event log
+func (s *Server) handleVerifyEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mutex.RLock()
+	events := s.events.Events()
+	dropped := s.events.Dropped()
+	head := s.head
+	s.mutex.RUnlock()
+
+	response := map[string]interface{}{
+		"valid":       true,
+		"event_count": len(events),
+		"head":        head,
+	}
+	last := ""
+	if len(events) > 0 {
+		last = events[len(events)-1].Hash
+	}
+	// A ring buffer keeps the chain from the oldest event it still holds
+	first := ""
+	if dropped > 0 && len(events) > 0 {
+		first = events[0].PrevHash
+		response["dropped_count"] = dropped
+	}
+	if broken := verifyChainFrom(first, events); broken != nil {
+		response["valid"] = false
+		response["first_corruption"] = broken
+	} else if last != head {
+		// The events chain up, but the newest ones were removed
+		response["valid"] = false
+		response["first_corruption"] = ChainBreak{Index: len(events), Reason: "head mismatch", Expected: head, Got: last}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func verifyLog(t *testing.T, server *Server) map[string]interface{} {
+	req := httptest.NewRequest(http.MethodGet, "/events/verify", nil)
+	w := httptest.NewRecorder()
+	server.handleVerifyEvents(w, req)
+	var response map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&response)
+	return response
+}
+
+func TestEventsAreChained(t *testing.T) {
+	server := NewServer()
+	first := server.logEvent("e1", "First")
+	second := server.logEvent("e2", "Second")
+
+	if first.PrevHash != "" || len(first.Hash) != 64 {
+		t.Errorf("Expected the first event to start the chain, got %+v", first)
+	}
+	if second.PrevHash != first.Hash || second.Hash != eventHash(second) {
+		t.Errorf("Expected the second event linked to the first, got %+v", second)
+	}
+	if server.head != second.Hash {
+		t.Errorf("Expected head %s, got %s", second.Hash, server.head)
+	}
+	if response := verifyLog(t, server); response["valid"] != true || response["event_count"] != float64(2) {
+		t.Errorf("Expected a valid chain of 2, got %v", response)
+	}
+}
+
+func TestVerifyChainFindsCorruption(t *testing.T) {
+	cases := map[string]struct {
+		tamper func(events []Event) []Event
+		reason string
+		index  float64
+	}{
+		"edited":    {func(events []Event) []Event { events[1].Message = "Forged"; return events }, "hash mismatch", 1},
+		"removed":   {func(events []Event) []Event { return append(events[:1], events[2:]...) }, "broken link", 1},
+		"truncated": {func(events []Event) []Event { return events[:2] }, "head mismatch", 2},
+		"rehashed": {func(events []Event) []Event {
+			events[0].Message = "Forged"
+			events[0].Hash = eventHash(events[0])
+			return events
+		}, "broken link", 1},
+	}
+	for name, c := range cases {
+		server := NewServer()
+		for _, id := range []string{"e1", "e2", "e3"} {
+			server.logEvent(id, id)
+		}
+		server.events.Replace(c.tamper(server.events.Events()))
+
+		response := verifyLog(t, server)
+		broken, _ := response["first_corruption"].(map[string]interface{})
+		if response["valid"] != false || broken["reason"] != c.reason || broken["index"] != c.index {
+			t.Errorf("%s: expected %s at %v, got %v", name, c.reason, c.index, response)
+		}
+	}
+}
+
+func TestImportRechains(t *testing.T) {
+	server := NewServer()
+	base := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	server.rechainLocked([]Event{{ID: "a", Timestamp: 1, WallTime: base}}, 0)
+	server.logEvent("b", "After a")
+
+	imported, err := server.importLegacy([]LegacyRecord{
+		{ID: "early", Message: "Before a", WallTime: base.Add(-time.Minute)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported[0].Hash != server.events.Events()[0].Hash || imported[0].PrevHash != "" {
+		t.Errorf("Expected the imported event to start the chain, got %+v", imported[0])
+	}
+	if verifyChain(server.events.Events()) != nil || server.head != server.events.Events()[2].Hash {
+		t.Errorf("Expected a valid chain after import, got %+v", verifyChain(server.events.Events()))
+	}
+}
+
+func TestEventHashMatchesMarshal(t *testing.T) {
+	event := Event{ID: "e1", Message: "<Hello> & welcome", Timestamp: 3, Node: "a", PrevHash: "ab", Hash: "ignored"}
+	event.Hash = ""
+	data, _ := json.Marshal(event)
+	sum := sha256.Sum256(data)
+	if got := eventHash(event); got != hex.EncodeToString(sum[:]) {
+		t.Errorf("Expected the hash of the marshalled event, got %s", got)
+	}
+}
+
+func BenchmarkEventHash(b *testing.B) {
+	event := Event{ID: "msg-42", Message: "Processed: Hello", Timestamp: 42, Node: "a", PrevHash: "8d7f"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		eventHash(event)
+	}
+}
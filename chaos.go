@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrChaosDropped is returned for peer requests dropped by chaos testing
+var ErrChaosDropped = errors.New("dropped by chaos testing")
+
+// ChaosSettings are the faults injected into requests to peers. Delay is
+// added to every request, plus a random part of up to Jitter. Drop and
+// Duplicate are probabilities between 0 and 1. With Peers set, only
+// requests to those peers are affected.
+type ChaosSettings struct {
+	Delay     time.Duration `json:"-"`
+	Jitter    time.Duration `json:"-"`
+	Drop      float64       `json:"drop"`
+	Duplicate float64       `json:"duplicate"`
+	Peers     []string      `json:"peers,omitempty"`
+}
+
+// chaosJSON is ChaosSettings with durations written like 50ms
+type chaosJSON struct {
+	Delay  string `json:"delay"`
+	Jitter string `json:"jitter"`
+	ChaosSettings
+}
+
+func (c ChaosSettings) MarshalJSON() ([]byte, error) {
+	type plain ChaosSettings
+	return json.Marshal(struct {
+		Delay  string `json:"delay"`
+		Jitter string `json:"jitter"`
+		plain
+	}{c.Delay.String(), c.Jitter.String(), plain(c)})
+}
+
+// Enabled reports whether any fault is injected
+func (c ChaosSettings) Enabled() bool {
+	return c.Delay > 0 || c.Jitter > 0 || c.Drop > 0 || c.Duplicate > 0
+}
+
+func (c ChaosSettings) validate() error {
+	if c.Delay < 0 || c.Jitter < 0 {
+		return errors.New("delay and jitter must not be negative")
+	}
+	if c.Drop < 0 || c.Drop > 1 || c.Duplicate < 0 || c.Duplicate > 1 {
+		return errors.New("drop and duplicate must be between 0 and 1")
+	}
+	return nil
+}
+
+// Chaos injects delays, drops and duplicate deliveries into peer
+// communication. The zero settings inject nothing.
+type Chaos struct {
+	settings ChaosSettings
+	metrics  *Metrics
+	rand     func() float64
+	mutex    sync.RWMutex
+}
+
+// NewChaos creates a chaos injector with no faults
+func NewChaos(metrics *Metrics) *Chaos {
+	metrics.Counter("lamport_chaos_faults_total", "Faults injected into peer requests")
+	return &Chaos{metrics: metrics, rand: rand.Float64}
+}
+
+// Settings returns the current faults
+func (c *Chaos) Settings() ChaosSettings {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.settings
+}
+
+// Set replaces the faults
+func (c *Chaos) Set(settings ChaosSettings) error {
+	if err := settings.validate(); err != nil {
+		return err
+	}
+	for i, peer := range settings.Peers {
+		settings.Peers[i] = cleanPeerURL(peer)
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.settings = settings
+	return nil
+}
+
+// Inject applies the faults to a request to peer before it is sent. It
+// waits out the delay, returns ErrChaosDropped when the request is to be
+// dropped and reports whether it is to be delivered twice.
+func (c *Chaos) Inject(ctx context.Context, peer string) (duplicate bool, err error) {
+	if c == nil {
+		return false, nil
+	}
+	c.mutex.RLock()
+	settings := c.settings
+	roll := c.rand
+	c.mutex.RUnlock()
+	if !settings.Enabled() || (len(settings.Peers) > 0 && !slices.Contains(settings.Peers, peer)) {
+		return false, nil
+	}
+
+	delay := settings.Delay
+	if settings.Jitter > 0 {
+		delay += time.Duration(roll() * float64(settings.Jitter))
+	}
+	if delay > 0 {
+		c.metrics.Inc("lamport_chaos_faults_total", "fault", "delay")
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+
+	if roll() < settings.Drop {
+		c.metrics.Inc("lamport_chaos_faults_total", "fault", "drop")
+		return false, fmt.Errorf("request to %s %w", peer, ErrChaosDropped)
+	}
+	if roll() < settings.Duplicate {
+		c.metrics.Inc("lamport_chaos_faults_total", "fault", "duplicate")
+		return true, nil
+	}
+	return false, nil
+}
+
+// parseChaos reads settings from a JSON body or from the delay, jitter,
+// drop, duplicate and peers parameters
+func parseChaos(r *http.Request) (ChaosSettings, error) {
+	var raw chaosJSON
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+			return ChaosSettings{}, errors.New("Invalid JSON body")
+		}
+	} else {
+		query := r.URL.Query()
+		raw.Delay, raw.Jitter = query.Get("delay"), query.Get("jitter")
+		for name, p := range map[string]*float64{"drop": &raw.Drop, "duplicate": &raw.Duplicate} {
+			if v := query.Get(name); v != "" {
+				f, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					return ChaosSettings{}, fmt.Errorf("Invalid %s parameter", name)
+				}
+				*p = f
+			}
+		}
+		if v := query.Get("peers"); v != "" {
+			raw.Peers = strings.Split(v, ",")
+		}
+	}
+
+	settings := raw.ChaosSettings
+	for _, d := range []struct {
+		name  string
+		value string
+		into  *time.Duration
+	}{{"delay", raw.Delay, &settings.Delay}, {"jitter", raw.Jitter, &settings.Jitter}} {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil {
+			return ChaosSettings{}, fmt.Errorf("Invalid %s parameter", d.name)
+		}
+		*d.into = v
+	}
+	return settings, nil
+}
+
+// handleChaos shows the injected faults on GET, replaces them on POST and
+// turns them off on DELETE
+func (s *Server) handleChaos(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		settings, err := parseChaos(r)
+		if err == nil {
+			err = s.chaos.Set(settings)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.logger.Warn("Chaos testing", "settings", s.chaos.Settings())
+	case http.MethodDelete:
+		s.chaos.Set(ChaosSettings{})
+		s.logger.Info("Chaos testing stopped")
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	settings := s.chaos.Settings()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":  settings.Enabled(),
+		"settings": settings,
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixedRoll makes every random draw of the chaos injector return v
+func fixedRoll(c *Chaos, v float64) {
+	c.rand = func() float64 { return v }
+}
+
+func TestChaosPeerRequests(t *testing.T) {
+	var calls int
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer peer.Close()
+
+	server := NewServer()
+	server.peers = NewPeers([]string{peer.URL}, http.DefaultClient)
+	server.peers.chaos = server.chaos
+
+	server.chaos.Set(ChaosSettings{Drop: 0.5})
+	fixedRoll(server.chaos, 0.25)
+	if _, err := server.peers.Do(t.Context(), peer.URL, http.MethodGet, "/time", nil, nil); !errors.Is(err, ErrChaosDropped) {
+		t.Errorf("Expected ErrChaosDropped, got %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("Expected the dropped request not sent, got %d calls", calls)
+	}
+
+	server.chaos.Set(ChaosSettings{Duplicate: 0.5})
+	if _, err := server.peers.Do(t.Context(), peer.URL, http.MethodGet, "/time", nil, nil); err != nil || calls != 2 {
+		t.Errorf("Expected the request delivered twice, got %v with %d calls", err, calls)
+	}
+
+	fixedRoll(server.chaos, 0.75)
+	server.peers.Do(t.Context(), peer.URL, http.MethodGet, "/time", nil, nil)
+	if calls != 3 {
+		t.Errorf("Expected a single delivery above the probability, got %d calls", calls)
+	}
+
+	server.chaos.Set(ChaosSettings{Drop: 1, Peers: []string{"http://other:8080"}})
+	if _, err := server.peers.Do(t.Context(), peer.URL, http.MethodGet, "/time", nil, nil); err != nil {
+		t.Errorf("Expected peers not listed to be spared, got %v", err)
+	}
+	if got := server.metrics.Value("lamport_chaos_faults_total", "fault", "duplicate"); got != 1 {
+		t.Errorf("Expected 1 duplicate counted, got %v", got)
+	}
+}
+
+func TestChaosDelay(t *testing.T) {
+	c := NewChaos(NewMetrics())
+	c.Set(ChaosSettings{Delay: 20 * time.Millisecond, Jitter: 20 * time.Millisecond})
+	fixedRoll(c, 0.5)
+
+	start := time.Now()
+	if _, err := c.Inject(t.Context(), "http://node-b:8080"); err != nil {
+		t.Fatalf("Inject failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("Expected a delay of 30ms, got %v", elapsed)
+	}
+
+	c.Set(ChaosSettings{Delay: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Inject(ctx, "http://node-b:8080"); err == nil {
+		t.Error("Expected the delay cut short by the context")
+	}
+}
+
+func TestHandleChaos(t *testing.T) {
+	server := NewServer()
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/chaos?delay=50ms&jitter=10ms&drop=0.1&duplicate=0.2", nil)
+	w := httptest.NewRecorder()
+	server.handleChaos(w, req)
+	if got := server.chaos.Settings(); got.Delay != 50*time.Millisecond || got.Jitter != 10*time.Millisecond || got.Drop != 0.1 || got.Duplicate != 0.2 {
+		t.Errorf("Expected the query settings applied, got %+v", got)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/admin/chaos", strings.NewReader(`{"delay":"1s","drop":0.5,"peers":["http://b:8080/"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	server.handleChaos(w, req)
+	var response struct {
+		Enabled  bool `json:"enabled"`
+		Settings struct {
+			Delay string   `json:"delay"`
+			Drop  float64  `json:"drop"`
+			Peers []string `json:"peers"`
+		} `json:"settings"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	if !response.Enabled || response.Settings.Delay != "1s" || response.Settings.Drop != 0.5 || response.Settings.Peers[0] != "http://b:8080" {
+		t.Errorf("Expected the JSON settings applied, got %+v", response)
+	}
+
+	for _, target := range []string{"/admin/chaos?drop=2", "/admin/chaos?delay=soon", "/admin/chaos?jitter=-1s"} {
+		w = httptest.NewRecorder()
+		server.handleChaos(w, httptest.NewRequest(http.MethodPost, target, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", target, w.Code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	server.handleChaos(w, httptest.NewRequest(http.MethodDelete, "/admin/chaos", nil))
+	if server.chaos.Settings().Enabled() {
+		t.Error("Expected chaos testing stopped")
+	}
+}
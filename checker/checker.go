@@ -0,0 +1,211 @@
+// Package checker verifies the Lamport clock invariants over a history of
+// events recorded by several nodes, such as the logs of GET /events
+// exported from every node of a cluster:
+//
+//   - a message is received after it was sent: the receive event's time is
+//     past the sent_at time it carries
+//   - each node's clock only moves forward: the events of a node are
+//     stamped with increasing times, in the order the history lists them
+//   - no node stamps two events with the same time
+//
+// Violations are reported with the events involved, so a report can be
+// processed by other tools. The package only depends on the wire types of
+// the codec package.
+package checker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec"
+)
+
+// Kind names the invariant a violation breaks
+type Kind string
+
+const (
+	// KindReceiveBeforeSend is a receive event not past the time the
+	// message was sent at
+	KindReceiveBeforeSend Kind = "receive-before-send"
+	// KindMissingSend is a receive event from a node of the history that
+	// has no event at the time the message was sent at
+	KindMissingSend Kind = "missing-send"
+	// KindNonMonotonic is an event of a node not past the one before it
+	KindNonMonotonic Kind = "non-monotonic"
+	// KindDuplicate is a second event a node stamped with the same time
+	KindDuplicate Kind = "duplicate"
+)
+
+// Violation is an event breaking an invariant, and the event it conflicts
+// with when there is one
+type Violation struct {
+	Kind      Kind             `json:"kind"`
+	Node      string           `json:"node"`
+	Event     string           `json:"event"`
+	Time      codec.Timestamp  `json:"time"`
+	Other     string           `json:"other,omitempty"`
+	OtherNode string           `json:"other_node,omitempty"`
+	OtherTime *codec.Timestamp `json:"other_time,omitempty"`
+	Detail    string           `json:"detail"`
+}
+
+// Report is the outcome of a check
+type Report struct {
+	Events     int         `json:"events"`
+	Receives   int         `json:"receives"`
+	Nodes      []string    `json:"nodes"`
+	Violations []Violation `json:"violations"`
+}
+
+// OK reports whether the history kept every invariant
+func (r Report) OK() bool {
+	return len(r.Violations) == 0
+}
+
+type stamp struct {
+	node string
+	time codec.Timestamp
+}
+
+// Check verifies the invariants over events. Copies of an event, with the
+// same node and ID, are checked once: logs exported from several nodes
+// share the events delivered to all of them. Backfilled events carry
+// timestamps derived from their wall time rather than the clock, so they
+// are not held to the order of the node's clock.
+func Check(events []codec.Event) Report {
+	report := Report{Nodes: []string{}, Violations: []Violation{}}
+	type copyKey struct{ node, id string }
+	copies := make(map[copyKey]bool, len(events))
+	stamped := make(map[stamp]string, len(events))
+	nodes := make(map[string]bool)
+	last := make(map[string]codec.Event) // newest event of each node not backfilled
+	var receives []codec.Event
+
+	for _, e := range events {
+		if e.ID != "" {
+			k := copyKey{e.Node, e.ID}
+			if copies[k] {
+				continue
+			}
+			copies[k] = true
+		}
+		report.Events++
+		if !nodes[e.Node] {
+			nodes[e.Node] = true
+			report.Nodes = append(report.Nodes, e.Node)
+		}
+		t := timeOf(e)
+
+		if other, ok := stamped[stamp{e.Node, t}]; ok {
+			report.Violations = append(report.Violations, Violation{
+				Kind: KindDuplicate, Node: e.Node, Event: e.ID, Time: t,
+				Other: other, OtherNode: e.Node, OtherTime: &t,
+				Detail: fmt.Sprintf("node %s stamped %s and %s with %s", e.Node, other, e.ID, format(t)),
+			})
+		} else {
+			stamped[stamp{e.Node, t}] = e.ID
+		}
+
+		if !e.Backfilled {
+			if prev, ok := last[e.Node]; ok && !before(timeOf(prev), t) {
+				pt := timeOf(prev)
+				report.Violations = append(report.Violations, Violation{
+					Kind: KindNonMonotonic, Node: e.Node, Event: e.ID, Time: t,
+					Other: prev.ID, OtherNode: e.Node, OtherTime: &pt,
+					Detail: fmt.Sprintf("node %s went from %s to %s", e.Node, format(pt), format(t)),
+				})
+			}
+			last[e.Node] = e
+		}
+
+		if e.Sender != "" && e.SentAt != nil {
+			receives = append(receives, e)
+		}
+	}
+
+	// Sends are matched once the events of every node are known
+	for _, e := range receives {
+		report.Receives++
+		t, sent := timeOf(e), *e.SentAt
+		if !before(sent, t) {
+			report.Violations = append(report.Violations, Violation{
+				Kind: KindReceiveBeforeSend, Node: e.Node, Event: e.ID, Time: t,
+				OtherNode: e.Sender, OtherTime: &sent,
+				Detail: fmt.Sprintf("node %s received at %s a message %s sent at %s", e.Node, format(t), e.Sender, format(sent)),
+			})
+		}
+		// Senders whose log is not part of the history cannot be matched
+		if _, ok := stamped[stamp{e.Sender, sent}]; nodes[e.Sender] && !ok {
+			report.Violations = append(report.Violations, Violation{
+				Kind: KindMissingSend, Node: e.Node, Event: e.ID, Time: t,
+				OtherNode: e.Sender, OtherTime: &sent,
+				Detail: fmt.Sprintf("node %s has no event at %s, when it sent the message %s received", e.Sender, format(sent), e.Node),
+			})
+		}
+	}
+	slices.Sort(report.Nodes)
+	return report
+}
+
+// Read decodes the events of a history: a JSON array of events, an object
+// with an events field such as the response of GET /events, or events as
+// JSON lines. Several of them may follow each other.
+func Read(r io.Reader) ([]codec.Event, error) {
+	dec := json.NewDecoder(r)
+	var events []codec.Event
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); errors.Is(err, io.EOF) {
+			return events, nil
+		} else if err != nil {
+			return nil, err
+		}
+		batch, err := decode(raw)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, batch...)
+	}
+}
+
+func decode(raw json.RawMessage) ([]codec.Event, error) {
+	if raw[0] == '[' {
+		var events []codec.Event
+		err := json.Unmarshal(raw, &events)
+		return events, err
+	}
+	var log struct {
+		Events *[]codec.Event `json:"events"`
+	}
+	if err := json.Unmarshal(raw, &log); err != nil {
+		return nil, err
+	}
+	if log.Events != nil {
+		return *log.Events, nil
+	}
+	var e codec.Event
+	if err := json.Unmarshal(raw, &e); err != nil {
+		return nil, err
+	}
+	return []codec.Event{e}, nil
+}
+
+func timeOf(e codec.Event) codec.Timestamp {
+	return codec.Timestamp{Epoch: e.Epoch, Timestamp: e.Timestamp}
+}
+
+// before orders times by epoch, then timestamp
+func before(a, b codec.Timestamp) bool {
+	return a.Epoch < b.Epoch || a.Epoch == b.Epoch && a.Timestamp < b.Timestamp
+}
+
+// format writes a time as the server does, epoch:timestamp past epoch 0
+func format(t codec.Timestamp) string {
+	if t.Epoch == 0 {
+		return fmt.Sprint(t.Timestamp)
+	}
+	return fmt.Sprintf("%d:%d", t.Epoch, t.Timestamp)
+}
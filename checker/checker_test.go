@@ -0,0 +1,99 @@
+package checker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec"
+)
+
+func event(node, id string, ts int64) codec.Event {
+	return codec.Event{ID: id, Node: node, Timestamp: ts}
+}
+
+func receive(node, id string, ts int64, sender string, sentAt int64) codec.Event {
+	e := event(node, id, ts)
+	e.Sender, e.SentAt = sender, &codec.Timestamp{Timestamp: sentAt}
+	return e
+}
+
+func TestCheckValidHistory(t *testing.T) {
+	history := []codec.Event{
+		event("a", "a1", 1),
+		event("a", "a2", 2), // sent to b
+		receive("b", "msg-3", 3, "a", 2),
+		event("b", "b4", 4),
+		receive("a", "msg-5", 5, "b", 4),
+		receive("a", "msg-6", 6, "client", 1), // sender outside the history
+		event("b", "b4", 4),                   // copy from another export
+		{ID: "old", Node: "b", Timestamp: 1, Backfilled: true},
+		{ID: "e1", Node: "c", Epoch: 1, Timestamp: 1},
+		receive("c", "msg-1-2", 2, "a", 6),
+	}
+	history[len(history)-1].Epoch = 1
+
+	report := Check(history)
+	if !report.OK() {
+		t.Fatalf("Expected no violations, got %+v", report.Violations)
+	}
+	if report.Events != 9 || report.Receives != 4 || strings.Join(report.Nodes, ",") != "a,b,c" {
+		t.Errorf("Expected 9 events, 4 receives on a, b and c, got %+v", report)
+	}
+}
+
+func TestCheckViolations(t *testing.T) {
+	history := []codec.Event{
+		event("a", "a1", 1),
+		event("a", "a2", 2),
+		event("a", "a2-again", 2),
+		receive("b", "msg-2", 2, "a", 2),
+		receive("b", "msg-5", 5, "a", 4),
+		event("b", "b3", 3),
+	}
+
+	want := []struct {
+		kind  Kind
+		event string
+	}{
+		{KindDuplicate, "a2-again"},
+		{KindNonMonotonic, "a2-again"},
+		{KindNonMonotonic, "b3"},
+		{KindReceiveBeforeSend, "msg-2"},
+		{KindMissingSend, "msg-5"},
+	}
+	got := Check(history).Violations
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d violations, got %+v", len(want), got)
+	}
+	for i, w := range want {
+		if got[i].Kind != w.kind || got[i].Event != w.event {
+			t.Errorf("Expected %s of %s, got %+v", w.kind, w.event, got[i])
+		}
+	}
+	if got[0].Other != "a2" || got[2].OtherTime.Timestamp != 5 || got[3].OtherNode != "a" {
+		t.Errorf("Expected the conflicting events reported, got %+v", got)
+	}
+	if got[4].Detail != "node a has no event at 4, when it sent the message b received" {
+		t.Errorf("Unexpected detail %q", got[4].Detail)
+	}
+}
+
+func TestRead(t *testing.T) {
+	input := `{"current_timestamp":2,"events":[{"id":"a1","lamport_timestamp":1,"node":"a"}]}
+[{"id":"b1","lamport_timestamp":1,"node":"b"}]
+{"id":"b2","lamport_timestamp":2,"node":"b","sender":"a","sent_at":{"epoch":0,"lamport_timestamp":1}}
+`
+	events, err := Read(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 || events[0].ID != "a1" || events[1].ID != "b1" || events[2].SentAt == nil {
+		t.Fatalf("Expected the events of all three forms, got %+v", events)
+	}
+
+	for _, input := range []string{`{"events":`, `[{"lamport_timestamp":"x"}]`, `7`} {
+		if _, err := Read(strings.NewReader(input)); err == nil {
+			t.Errorf("Expected %q to be refused", input)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec"
+)
+
+// The admin operations require a token with the admin role
+
+// LegacyRecord is a record of a legacy dataset for POST /admin/import.
+// Records exported by a signing node may carry the Lamport time and
+// signature of the original event.
+type LegacyRecord struct {
+	ID       string    `json:"id,omitempty"`
+	Message  string    `json:"message"`
+	WallTime time.Time `json:"wall_time"`
+
+	Timestamp int64  `json:"lamport_timestamp,omitempty"`
+	Epoch     int64  `json:"epoch,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	KeyID     string `json:"key_id,omitempty"`
+}
+
+// Imported is the answer of POST /admin/import
+type Imported struct {
+	Imported int           `json:"imported"`
+	Events   []codec.Event `json:"events"`
+}
+
+// Chaos are the faults injected into peer requests
+type Chaos struct {
+	Delay     time.Duration
+	Jitter    time.Duration
+	Drop      float64  // drop probability
+	Duplicate float64  // duplication probability
+	Peers     []string // the peers the faults apply to, all of them when empty
+}
+
+// TraceReport is the answer of POST /admin/replay
+type TraceReport struct {
+	Recordings int              `json:"recordings"`
+	Operations int              `json:"operations"`
+	Final      codec.Timestamp  `json:"final"`
+	Divergence *TraceDivergence `json:"divergence,omitempty"`
+}
+
+// TraceDivergence is the first recorded transition the replay did not
+// reproduce
+type TraceDivergence struct {
+	Recorded ClockTransition `json:"recorded"`
+	From     codec.Timestamp `json:"from"`
+	To       codec.Timestamp `json:"to"`
+}
+
+// Feature is an experimental feature of the server
+type Feature struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Runtime     bool   `json:"runtime"` // can be toggled at runtime
+	Enabled     bool   `json:"enabled"`
+}
+
+// FeatureList is the answer of GET /admin/features
+type FeatureList struct {
+	Features []Feature `json:"features"`
+}
+
+// Reload is the answer of POST /admin/reload
+type Reload struct {
+	Applied         []string `json:"applied"`
+	RestartRequired []string `json:"restart_required"`
+}
+
+// AuditFilter selects the entries of the audit log
+type AuditFilter struct {
+	Actor  string
+	Action string // prefix of the actions, such as "POST /admin/"
+	Since  int64  // only entries after this sequence number
+	Limit  int    // newest entries up to this many, when > 0
+}
+
+// AuditEntry is an administrative action of the audit log
+type AuditEntry struct {
+	Seq       int64               `json:"seq"`
+	Timestamp int64               `json:"lamport_timestamp"`
+	Epoch     int64               `json:"epoch,omitempty"`
+	WallTime  time.Time           `json:"wall_time"`
+	Actor     string              `json:"actor"`
+	Action    string              `json:"action"`
+	Params    map[string][]string `json:"params,omitempty"`
+	Body      string              `json:"body,omitempty"`
+	Truncated bool                `json:"body_truncated,omitempty"`
+	Status    int                 `json:"status"`
+	RequestID string              `json:"request_id,omitempty"`
+}
+
+// AuditLog is the answer of GET /admin/audit
+type AuditLog struct {
+	Entries []AuditEntry `json:"entries"`
+	Count   int          `json:"count"`
+}
+
+// Import backfills legacy records into the log
+func (c *Client) Import(ctx context.Context, records []LegacyRecord) (Imported, error) {
+	body, err := json.Marshal(records)
+	if err != nil {
+		return Imported{}, err
+	}
+	var imported Imported
+	err = c.do(ctx, http.MethodPost, "/admin/import", nil, body, "application/json", &imported)
+	return imported, err
+}
+
+// ResetClock moves the clock back to epoch 0, timestamp 0
+func (c *Client) ResetClock(ctx context.Context) (Object, error) {
+	var result Object
+	err := c.do(ctx, http.MethodPost, "/admin/clock/reset", nil, nil, "", &result)
+	return result, err
+}
+
+// SetClock moves the clock to value within the current epoch; only force
+// moves it backwards
+func (c *Client) SetClock(ctx context.Context, value int64, force bool) (Object, error) {
+	query := url.Values{"value": {strconv.FormatInt(value, 10)}}
+	if force {
+		query.Set("force", "true")
+	}
+	var result Object
+	err := c.do(ctx, http.MethodPost, "/admin/clock/set", query, nil, "", &result)
+	return result, err
+}
+
+// AdvanceClock advances the clock by n ticks
+func (c *Client) AdvanceClock(ctx context.Context, n int64) (Object, error) {
+	var result Object
+	err := c.do(ctx, http.MethodPost, "/admin/clock/advance", url.Values{"n": {strconv.FormatInt(n, 10)}}, nil, "", &result)
+	return result, err
+}
+
+// FreezeClock stops the clock from moving
+func (c *Client) FreezeClock(ctx context.Context) (Object, error) {
+	var result Object
+	err := c.do(ctx, http.MethodPost, "/admin/clock/freeze", nil, nil, "", &result)
+	return result, err
+}
+
+// ResumeClock lets a frozen clock move again
+func (c *Client) ResumeClock(ctx context.Context) (Object, error) {
+	var result Object
+	err := c.do(ctx, http.MethodPost, "/admin/clock/resume", nil, nil, "", &result)
+	return result, err
+}
+
+// Tenants lists the tenants of the server
+func (c *Client) Tenants(ctx context.Context) (Object, error) {
+	var tenants Object
+	err := c.do(ctx, http.MethodGet, "/admin/tenants", nil, nil, "", &tenants)
+	return tenants, err
+}
+
+// Partition returns the simulated network partition
+func (c *Client) Partition(ctx context.Context) (Object, error) {
+	var partition Object
+	err := c.do(ctx, http.MethodGet, "/admin/partition", nil, nil, "", &partition)
+	return partition, err
+}
+
+// SetPartition simulates a network partition between groups of node IDs
+// or URLs
+func (c *Client) SetPartition(ctx context.Context, groups [][]string) (Object, error) {
+	parts := make([]string, len(groups))
+	for i, group := range groups {
+		parts[i] = strings.Join(group, ",")
+	}
+	var partition Object
+	err := c.do(ctx, http.MethodPost, "/admin/partition", url.Values{"groups": {strings.Join(parts, "|")}}, nil, "", &partition)
+	return partition, err
+}
+
+// Heal ends the simulated network partition
+func (c *Client) Heal(ctx context.Context) (Object, error) {
+	var result Object
+	err := c.do(ctx, http.MethodPost, "/admin/heal", nil, nil, "", &result)
+	return result, err
+}
+
+// Chaos returns the faults injected into peer requests
+func (c *Client) Chaos(ctx context.Context) (Object, error) {
+	var chaos Object
+	err := c.do(ctx, http.MethodGet, "/admin/chaos", nil, nil, "", &chaos)
+	return chaos, err
+}
+
+// SetChaos injects faults into peer requests
+func (c *Client) SetChaos(ctx context.Context, chaos Chaos) (Object, error) {
+	query := url.Values{}
+	if chaos.Delay > 0 {
+		query.Set("delay", chaos.Delay.String())
+	}
+	if chaos.Jitter > 0 {
+		query.Set("jitter", chaos.Jitter.String())
+	}
+	if chaos.Drop > 0 {
+		query.Set("drop", strconv.FormatFloat(chaos.Drop, 'g', -1, 64))
+	}
+	if chaos.Duplicate > 0 {
+		query.Set("duplicate", strconv.FormatFloat(chaos.Duplicate, 'g', -1, 64))
+	}
+	if len(chaos.Peers) > 0 {
+		query.Set("peers", strings.Join(chaos.Peers, ","))
+	}
+	var result Object
+	err := c.do(ctx, http.MethodPost, "/admin/chaos", query, nil, "", &result)
+	return result, err
+}
+
+// StopChaos stops injecting faults
+func (c *Client) StopChaos(ctx context.Context) (Object, error) {
+	var result Object
+	err := c.do(ctx, http.MethodDelete, "/admin/chaos", nil, nil, "", &result)
+	return result, err
+}
+
+// ReplayTrace replays a clock trace, as JSON lines, against a fresh clock
+func (c *Client) ReplayTrace(ctx context.Context, trace []byte) (TraceReport, error) {
+	var report TraceReport
+	err := c.do(ctx, http.MethodPost, "/admin/replay", nil, trace, "application/x-ndjson", &report)
+	return report, err
+}
+
+// Features lists the experimental features
+func (c *Client) Features(ctx context.Context) (FeatureList, error) {
+	var list FeatureList
+	err := c.do(ctx, http.MethodGet, "/admin/features", nil, nil, "", &list)
+	return list, err
+}
+
+// SetFeature toggles an experimental feature at runtime
+func (c *Client) SetFeature(ctx context.Context, name string, enabled bool) (FeatureList, error) {
+	query := url.Values{"name": {name}, "enabled": {strconv.FormatBool(enabled)}}
+	var list FeatureList
+	err := c.do(ctx, http.MethodPost, "/admin/features", query, nil, "", &list)
+	return list, err
+}
+
+// Reload reloads the configuration file of the server
+func (c *Client) Reload(ctx context.Context) (Reload, error) {
+	var reload Reload
+	err := c.do(ctx, http.MethodPost, "/admin/reload", nil, nil, "", &reload)
+	return reload, err
+}
+
+// Audit lists administrative actions from the audit log
+func (c *Client) Audit(ctx context.Context, filter AuditFilter) (AuditLog, error) {
+	query := url.Values{}
+	if filter.Actor != "" {
+		query.Set("actor", filter.Actor)
+	}
+	if filter.Action != "" {
+		query.Set("action", filter.Action)
+	}
+	if filter.Since > 0 {
+		query.Set("since", strconv.FormatInt(filter.Since, 10))
+	}
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+	var log AuditLog
+	err := c.do(ctx, http.MethodGet, "/admin/audit", query, nil, "", &log)
+	return log, err
+}
@@ -0,0 +1,354 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec"
+)
+
+// ClockTransition is a change of the clock and its cause
+type ClockTransition struct {
+	Seq       uint64          `json:"seq"`
+	From      codec.Timestamp `json:"from"`
+	To        codec.Timestamp `json:"to"`
+	Cause     string          `json:"cause"`
+	Received  codec.Timestamp `json:"received,omitzero"` // merged timestamp, for update and observe
+	Clamped   bool            `json:"clamped,omitempty"`
+	Peer      string          `json:"peer,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+	WallTime  time.Time       `json:"wall_time"`
+}
+
+// ClockHistory is the answer of GET /clock/history
+type ClockHistory struct {
+	CurrentTimestamp int64             `json:"current_timestamp"`
+	Epoch            int64             `json:"epoch"`
+	Recorded         uint64            `json:"recorded"`
+	Capacity         int               `json:"capacity"`
+	Transitions      []ClockTransition `json:"transitions"`
+}
+
+// HistoryFilter selects the transitions of ClockHistory
+type HistoryFilter struct {
+	Cause     string
+	Peer      string
+	RequestID string
+	At        int64  // only the transitions that took the clock to or past At, when > 0
+	Epoch     *int64 // epoch of At, the current one when nil
+	Limit     int
+}
+
+// SkewOptions shape the tick rate report; zero values take the server
+// defaults
+type SkewOptions struct {
+	Window   time.Duration // only the events of this recent past
+	Interval time.Duration // width of the histogram intervals
+	Burst    float64       // ticks per second of an interval in a burst
+	Idle     time.Duration // shortest gap reported as idle
+}
+
+// SkewReport is the answer of GET /analytics/skew
+type SkewReport struct {
+	CurrentTimestamp   int64        `json:"current_timestamp"`
+	Epoch              int64        `json:"epoch"`
+	Recorded           uint64       `json:"recorded"`
+	Capacity           int          `json:"capacity"`
+	Samples            int          `json:"samples"`
+	Start              time.Time    `json:"start,omitzero"`
+	End                time.Time    `json:"end,omitzero"`
+	Ticks              int64        `json:"ticks"`
+	TicksPerSecond     float64      `json:"ticks_per_second"`
+	EventsPerSecond    float64      `json:"events_per_second"`
+	PeakTicksPerSecond float64      `json:"peak_ticks_per_second"`
+	Interval           string       `json:"interval"`
+	Histogram          []SkewBucket `json:"histogram"`
+	Bursts             []SkewBurst  `json:"bursts"`
+	Idle               []SkewIdle   `json:"idle"`
+}
+
+// SkewBucket counts the intervals with a tick rate from Min up to Max,
+// unbounded when Max is 0
+type SkewBucket struct {
+	Min       float64 `json:"min"`
+	Max       float64 `json:"max,omitempty"`
+	Intervals int     `json:"intervals"`
+}
+
+// SkewBurst is a run of intervals ticking faster than the burst rate
+type SkewBurst struct {
+	Start          time.Time       `json:"start"`
+	End            time.Time       `json:"end"`
+	From           codec.Timestamp `json:"from"`
+	To             codec.Timestamp `json:"to"`
+	Ticks          int64           `json:"ticks"`
+	Events         int             `json:"events"`
+	TicksPerSecond float64         `json:"ticks_per_second"`
+}
+
+// SkewIdle is a gap without events
+type SkewIdle struct {
+	Start    time.Time       `json:"start"`
+	End      time.Time       `json:"end"`
+	Duration string          `json:"duration"`
+	At       codec.Timestamp `json:"at"`
+	Ongoing  bool            `json:"ongoing,omitempty"`
+}
+
+// Propagation is the answer of GET /analytics/propagation
+type Propagation struct {
+	Count int               `json:"count"`
+	Peers []PeerPropagation `json:"peers"`
+}
+
+// PeerPropagation is the delay of the messages from one peer
+type PeerPropagation struct {
+	Peer          string              `json:"peer"`
+	Messages      int                 `json:"messages"`
+	Last          time.Time           `json:"last"`
+	AvgMillisec   float64             `json:"avg_ms"`
+	MinMillisec   float64             `json:"min_ms"`
+	MaxMillisec   float64             `json:"max_ms"`
+	WallHistogram []PropagationBucket `json:"wall_histogram"`
+	AvgTicks      float64             `json:"avg_ticks"`
+	MinTicks      int64               `json:"min_ticks"`
+	MaxTicks      int64               `json:"max_ticks"`
+	TickHistogram []PropagationBucket `json:"tick_histogram"`
+}
+
+// PropagationBucket counts the messages with a delay from Min up to Max,
+// unbounded when Max is 0
+type PropagationBucket struct {
+	Min      float64 `json:"min"`
+	Max      float64 `json:"max,omitempty"`
+	Messages int     `json:"messages"`
+}
+
+// SummaryOptions set the bucket widths of the event summary; zero values
+// take the server defaults
+type SummaryOptions struct {
+	Ticks int64         // width of the logical buckets in timestamps
+	Wall  time.Duration // width of the wall time buckets
+	Top   int           // sender and receiver pairs listed
+}
+
+// EventSummary is the answer of GET /analytics/summary
+type EventSummary struct {
+	CurrentTimestamp int64           `json:"current_timestamp"`
+	Epoch            int64           `json:"epoch"`
+	Events           int             `json:"events"`
+	ByNode           map[string]int  `json:"by_node"`
+	ByType           map[string]int  `json:"by_type"`
+	Untyped          int             `json:"untyped"`
+	Logical          []LogicalBucket `json:"logical_buckets"`
+	Wall             []WallBucket    `json:"wall_buckets"`
+	TopTalkers       []Talker        `json:"top_talkers"`
+	Propagation      struct {
+		Messages    int     `json:"messages"`
+		AvgTicks    float64 `json:"avg_ticks"`
+		Matched     int     `json:"matched"`
+		AvgMillisec float64 `json:"avg_ms"`
+	} `json:"propagation"`
+}
+
+// LogicalBucket counts the events with timestamps in [Start, End) of an
+// epoch
+type LogicalBucket struct {
+	Epoch  int64 `json:"epoch"`
+	Start  int64 `json:"start"`
+	End    int64 `json:"end"`
+	Events int   `json:"events"`
+}
+
+// WallBucket counts the events logged from Start on
+type WallBucket struct {
+	Start  time.Time `json:"start"`
+	Events int       `json:"events"`
+}
+
+// Talker counts the messages from a sender to a receiver
+type Talker struct {
+	Sender   string `json:"sender"`
+	Receiver string `json:"receiver"`
+	Messages int    `json:"messages"`
+}
+
+// MemoryUsage is the answer of GET /analytics/memory
+type MemoryUsage struct {
+	HeapAlloc   uint64 `json:"heap_alloc_bytes"`
+	HeapInuse   uint64 `json:"heap_inuse_bytes"`
+	HeapObjects uint64 `json:"heap_objects"`
+	Sys         uint64 `json:"sys_bytes"`
+	GCCycles    uint32 `json:"gc_cycles"`
+	Goroutines  int    `json:"goroutines"`
+	Events      int    `json:"events"`
+	Compression *struct {
+		Blocks          int     `json:"blocks"`
+		BlockSize       int     `json:"block_size"`
+		CompressedBytes int64   `json:"compressed_bytes"`
+		EncodedBytes    int64   `json:"encoded_bytes"`
+		Ratio           float64 `json:"ratio"`
+		TailEvents      int     `json:"tail_events"`
+	} `json:"compression,omitempty"`
+}
+
+// ClockHistory lists recent transitions of the clock and their causes
+func (c *Client) ClockHistory(ctx context.Context, filter HistoryFilter) (ClockHistory, error) {
+	query := url.Values{}
+	for name, value := range map[string]string{"cause": filter.Cause, "peer": filter.Peer, "request_id": filter.RequestID} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	if filter.At > 0 {
+		query.Set("at", strconv.FormatInt(filter.At, 10))
+	}
+	if filter.Epoch != nil {
+		query.Set("epoch", strconv.FormatInt(*filter.Epoch, 10))
+	}
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+	var history ClockHistory
+	err := c.do(ctx, http.MethodGet, "/clock/history", query, nil, "", &history)
+	return history, err
+}
+
+// Skew reports tick rates, bursts and idle periods against wall time
+func (c *Client) Skew(ctx context.Context, opts SkewOptions) (SkewReport, error) {
+	query := url.Values{}
+	if opts.Window > 0 {
+		query.Set("window", opts.Window.String())
+	}
+	if opts.Interval > 0 {
+		query.Set("interval", opts.Interval.String())
+	}
+	if opts.Burst > 0 {
+		query.Set("burst", strconv.FormatFloat(opts.Burst, 'g', -1, 64))
+	}
+	if opts.Idle > 0 {
+		query.Set("idle", opts.Idle.String())
+	}
+	var report SkewReport
+	err := c.do(ctx, http.MethodGet, "/analytics/skew", query, nil, "", &report)
+	return report, err
+}
+
+// Propagation reports the delay of the messages from each peer, or from
+// peer only when it is not empty
+func (c *Client) Propagation(ctx context.Context, peer string) (Propagation, error) {
+	var query url.Values
+	if peer != "" {
+		query = url.Values{"peer": {peer}}
+	}
+	var p Propagation
+	err := c.do(ctx, http.MethodGet, "/analytics/propagation", query, nil, "", &p)
+	return p, err
+}
+
+// Summary counts the events per node, type and time bucket
+func (c *Client) Summary(ctx context.Context, opts SummaryOptions) (EventSummary, error) {
+	query := url.Values{}
+	if opts.Ticks > 0 {
+		query.Set("ticks", strconv.FormatInt(opts.Ticks, 10))
+	}
+	if opts.Wall > 0 {
+		query.Set("wall", opts.Wall.String())
+	}
+	if opts.Top > 0 {
+		query.Set("top", strconv.Itoa(opts.Top))
+	}
+	var summary EventSummary
+	err := c.do(ctx, http.MethodGet, "/analytics/summary", query, nil, "", &summary)
+	return summary, err
+}
+
+// Memory reports the memory used by the server
+func (c *Client) Memory(ctx context.Context) (MemoryUsage, error) {
+	var usage MemoryUsage
+	err := c.do(ctx, http.MethodGet, "/analytics/memory", nil, nil, "", &usage)
+	return usage, err
+}
+
+// SigningKeys lists the public keys events are signed with
+func (c *Client) SigningKeys(ctx context.Context) (Object, error) {
+	var keys Object
+	err := c.do(ctx, http.MethodGet, "/keys", nil, nil, "", &keys)
+	return keys, err
+}
+
+// Metrics returns the metrics of the server in the Prometheus text format
+func (c *Client) Metrics(ctx context.Context) (string, error) {
+	text, err := c.raw(ctx, http.MethodGet, "/metrics", nil)
+	return string(text), err
+}
+
+// Healthz reports whether the server is alive
+func (c *Client) Healthz(ctx context.Context) (Object, error) {
+	var health Object
+	err := c.do(ctx, http.MethodGet, "/healthz", nil, nil, "", &health)
+	return health, err
+}
+
+// Readyz reports whether the server is ready to take writes. A server that
+// is not answers with an *Error with status 503.
+func (c *Client) Readyz(ctx context.Context) (Object, error) {
+	var ready Object
+	err := c.do(ctx, http.MethodGet, "/readyz", nil, nil, "", &ready)
+	return ready, err
+}
+
+// OpenAPI returns the OpenAPI document of the server
+func (c *Client) OpenAPI(ctx context.Context) (Object, error) {
+	var doc Object
+	err := c.do(ctx, http.MethodGet, "/openapi.json", nil, nil, "", &doc)
+	return doc, err
+}
+
+// The profiles are served with -pprof only, in the formats of go tool pprof
+
+// PprofIndex returns the HTML index of the runtime profiles
+func (c *Client) PprofIndex(ctx context.Context) ([]byte, error) {
+	return c.raw(ctx, http.MethodGet, "/debug/pprof/", nil)
+}
+
+// Pprof returns a named runtime profile, such as heap or goroutine, as a
+// text rendering when debug is 1 or 2
+func (c *Client) Pprof(ctx context.Context, profile string, debug int) ([]byte, error) {
+	var query url.Values
+	if debug > 0 {
+		query = url.Values{"debug": {strconv.Itoa(debug)}}
+	}
+	return c.raw(ctx, http.MethodGet, "/debug/pprof/"+url.PathEscape(profile), query)
+}
+
+// PprofCmdline returns the command line of the server
+func (c *Client) PprofCmdline(ctx context.Context) ([]byte, error) {
+	return c.raw(ctx, http.MethodGet, "/debug/pprof/cmdline", nil)
+}
+
+// PprofCPU returns a CPU profile of d, or of the server default when 0
+func (c *Client) PprofCPU(ctx context.Context, d time.Duration) ([]byte, error) {
+	return c.raw(ctx, http.MethodGet, "/debug/pprof/profile", secondsQuery(d))
+}
+
+// PprofSymbol returns the symbol lookup table of the server
+func (c *Client) PprofSymbol(ctx context.Context) ([]byte, error) {
+	return c.raw(ctx, http.MethodGet, "/debug/pprof/symbol", nil)
+}
+
+// PprofTrace returns an execution trace of d, or of the server default
+// when 0
+func (c *Client) PprofTrace(ctx context.Context, d time.Duration) ([]byte, error) {
+	return c.raw(ctx, http.MethodGet, "/debug/pprof/trace", secondsQuery(d))
+}
+
+func secondsQuery(d time.Duration) url.Values {
+	if d <= 0 {
+		return nil
+	}
+	return url.Values{"seconds": {strconv.FormatFloat(d.Seconds(), 'g', -1, 64)}}
+}
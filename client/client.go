@@ -0,0 +1,326 @@
+// Package client is a typed Go client for the HTTP API of the Lamport
+// timestamp server. It has a method for every operation of the OpenAPI
+// document the server publishes at /openapi.json, and responses decode into
+// the types of this package and the wire types of the codec package.
+// Answers the document leaves free-form decode into an Object.
+//
+//	c := client.New("http://localhost:8080", nil)
+//	event, err := c.CreateEvent(ctx, client.NewEvent{Message: "User login"})
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec"
+)
+
+// apiPrefix is the version of the server API the client speaks
+const apiPrefix = "/v1"
+
+// Client calls one server. It is safe for concurrent use.
+type Client struct {
+	base  string
+	http  *http.Client
+	Token string // bearer token sent with every request, when set
+}
+
+// New creates a client for the server at baseURL, using httpClient or
+// http.DefaultClient when it is nil
+func New(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{base: strings.TrimSuffix(baseURL, "/"), http: httpClient}
+}
+
+// Error is an answer other than 2xx. The server reports errors as plain
+// text, kept in Message.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("lamport server: %d %s", e.StatusCode, e.Message)
+}
+
+// Time is the answer of GET /time
+type Time struct {
+	Timestamp int64     `json:"lamport_timestamp"`
+	Epoch     int64     `json:"epoch"`
+	WallTime  time.Time `json:"wall_time"`
+	NodeID    string    `json:"node_id"`
+	TimedOut  bool      `json:"timed_out,omitempty"`
+}
+
+// NewEvent is the body of POST /event
+type NewEvent struct {
+	Message       string            `json:"message,omitempty"`
+	Type          string            `json:"type,omitempty"`
+	SchemaVersion int               `json:"schema_version,omitempty"`
+	Payload       json.RawMessage   `json:"payload,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+}
+
+// Message is a message received from another process, for POST /message
+type Message struct {
+	Message string
+	Sent    codec.Timestamp // the sender's time; a zero epoch means the current one
+	Sender  string
+	ID      string // the event ID at the sender, to merge copies of a message once
+}
+
+// EventList is the answer of GET /events
+type EventList struct {
+	CurrentTimestamp int64         `json:"current_timestamp"`
+	Epoch            int64         `json:"epoch"`
+	EventCount       int           `json:"event_count"`
+	DroppedCount     int           `json:"dropped_count"`
+	Events           []codec.Event `json:"events"`
+	TimedOut         bool          `json:"timed_out,omitempty"`
+
+	// Set on pages only; NextCursor is empty on the last one
+	Count      int    `json:"count,omitempty"`
+	Limit      int    `json:"limit,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// EventsOptions select the order of GET /events, page it and make it wait
+// for new events
+type EventsOptions struct {
+	Total   bool          // Lamport total order instead of arrival order
+	WaitFor int64         // when > 0, wait until the clock is past this timestamp
+	Timeout time.Duration // longest wait for WaitFor, the server default when 0
+
+	// A Limit or a Cursor asks for a page, always in total order: a Limit
+	// alone for the first one, then the NextCursor of the previous page
+	// for the next. Limit is the server default when 0.
+	Cursor string
+	Limit  int
+}
+
+// GraphNode is an event of the happened-before graph
+type GraphNode struct {
+	ID        string `json:"id"`
+	Process   string `json:"process"`
+	Kind      string `json:"kind"`
+	Timestamp int64  `json:"lamport_timestamp"`
+	Epoch     int64  `json:"epoch,omitempty"`
+	Label     string `json:"label"`
+}
+
+// Comparison is the answer of GET /compare
+type Comparison struct {
+	A        GraphNode `json:"a"`
+	B        GraphNode `json:"b"`
+	Relation string    `json:"relation"` // before, after, concurrent or equal
+	Path     []string  `json:"path,omitempty"`
+}
+
+// MerkleRoot is the answer of GET /events/root
+type MerkleRoot struct {
+	Root             string `json:"root"`
+	TreeSize         int    `json:"tree_size"`
+	CurrentTimestamp int64  `json:"current_timestamp"`
+	Epoch            int64  `json:"epoch"`
+}
+
+// Register is a last-writer-wins register of the key-value store
+type Register struct {
+	Key      string    `json:"key"`
+	Value    string    `json:"value"`
+	Version  Version   `json:"version"`
+	WallTime time.Time `json:"wall_time"`
+}
+
+// Version orders the writes of a register: by Lamport time, then by node
+type Version struct {
+	Epoch     int64  `json:"epoch"`
+	Timestamp int64  `json:"lamport_timestamp"`
+	NodeID    string `json:"node_id"`
+}
+
+// Time returns the current Lamport time of the server
+func (c *Client) Time(ctx context.Context) (Time, error) {
+	var t Time
+	err := c.do(ctx, http.MethodGet, "/time", nil, nil, "", &t)
+	return t, err
+}
+
+// WaitTime waits until the clock of the server is past after, or timeout
+// passes, and returns its time
+func (c *Client) WaitTime(ctx context.Context, after int64, timeout time.Duration) (Time, error) {
+	var t Time
+	err := c.do(ctx, http.MethodGet, "/time", waitQuery(after, timeout), nil, "", &t)
+	return t, err
+}
+
+// CreateEvent records a local event
+func (c *Client) CreateEvent(ctx context.Context, e NewEvent) (codec.Event, error) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return codec.Event{}, err
+	}
+	var event codec.Event
+	err = c.do(ctx, http.MethodPost, "/event", nil, body, "application/json", &event)
+	return event, err
+}
+
+// ReceiveMessage merges the timestamp of a received message into the clock
+// of the server and returns the receive event
+func (c *Client) ReceiveMessage(ctx context.Context, m Message) (codec.Event, error) {
+	query := url.Values{
+		"timestamp": {strconv.FormatInt(m.Sent.Timestamp, 10)},
+		"message":   {m.Message},
+	}
+	if m.Sent.Epoch != 0 {
+		query.Set("epoch", strconv.FormatInt(m.Sent.Epoch, 10))
+	}
+	if m.Sender != "" {
+		query.Set("sender", m.Sender)
+	}
+	if m.ID != "" {
+		query.Set("id", m.ID)
+	}
+	var event codec.Event
+	err := c.do(ctx, http.MethodPost, "/message", query, nil, "", &event)
+	return event, err
+}
+
+// Events lists the event log, or a page of it
+func (c *Client) Events(ctx context.Context, opts EventsOptions) (EventList, error) {
+	query := url.Values{}
+	if opts.WaitFor > 0 {
+		query = waitQuery(opts.WaitFor, opts.Timeout)
+	}
+	if opts.Total {
+		query.Set("order", "total")
+	}
+	if opts.Cursor != "" {
+		query.Set("cursor", opts.Cursor)
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	var list EventList
+	err := c.do(ctx, http.MethodGet, "/events", query, nil, "", &list)
+	return list, err
+}
+
+// Compare returns whether event a happened before, after or concurrently
+// with event b
+func (c *Client) Compare(ctx context.Context, a, b string) (Comparison, error) {
+	var cmp Comparison
+	err := c.do(ctx, http.MethodGet, "/compare", url.Values{"a": {a}, "b": {b}}, nil, "", &cmp)
+	return cmp, err
+}
+
+// MerkleRoot returns the Merkle root over the log
+func (c *Client) MerkleRoot(ctx context.Context) (MerkleRoot, error) {
+	var root MerkleRoot
+	err := c.do(ctx, http.MethodGet, "/events/root", nil, nil, "", &root)
+	return root, err
+}
+
+// GetRegister reads a register. Unknown keys return an *Error with status 404.
+func (c *Client) GetRegister(ctx context.Context, key string) (Register, error) {
+	var reg Register
+	err := c.do(ctx, http.MethodGet, "/kv/"+url.PathEscape(key), nil, nil, "", &reg)
+	return reg, err
+}
+
+// PutRegister writes a register
+func (c *Client) PutRegister(ctx context.Context, key, value string) (Register, error) {
+	var reg Register
+	err := c.do(ctx, http.MethodPut, "/kv/"+url.PathEscape(key), nil, []byte(value), "text/plain", &reg)
+	return reg, err
+}
+
+// TickClock records a local event on a virtual clock
+func (c *Client) TickClock(ctx context.Context, name, message string) (codec.Event, error) {
+	var query url.Values
+	if message != "" {
+		query = url.Values{"message": {message}}
+	}
+	var event codec.Event
+	err := c.do(ctx, http.MethodPost, clockPath(name, "/tick"), query, nil, "", &event)
+	return event, err
+}
+
+func waitQuery(after int64, timeout time.Duration) url.Values {
+	query := url.Values{"wait_for": {strconv.FormatInt(after, 10)}}
+	if timeout > 0 {
+		query.Set("timeout", timeout.String())
+	}
+	return query
+}
+
+// do sends a request and decodes a JSON answer into out, unless out is nil
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body []byte, contentType string, out interface{}) error {
+	resp, err := c.send(ctx, method, path, query, nil, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// raw sends a request and returns the answer as it is, for the documents
+// that are not JSON
+func (c *Client) raw(ctx context.Context, method, path string, query url.Values) ([]byte, error) {
+	resp, err := c.send(ctx, method, path, query, nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// send sends a request and returns a 2xx answer, whose body the caller
+// closes; other answers are returned as an *Error
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, header http.Header, body []byte, contentType string) (*http.Response, error) {
+	target := c.base + apiPrefix + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		text, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(text))}
+	}
+	return resp, nil
+}
@@ -0,0 +1,585 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec"
+)
+
+// specOperation is an operation of the server's OpenAPI document
+type specOperation struct {
+	ID          string
+	Pattern     *regexp.Regexp // matches "METHOD path"
+	Query       map[string]bool
+	Status      int             // first success status
+	ContentType string          // first content type of the success answer, empty without a body
+	Body        map[string]bool // properties of a JSON request body, nil when it declares none
+}
+
+// specOperations reads the operations of the server's OpenAPI document
+func specOperations(t *testing.T) []specOperation {
+	t.Helper()
+	data, err := os.ReadFile("../openapi.json")
+	if err != nil {
+		t.Fatalf("Failed to read openapi.json: %v", err)
+	}
+	type parameter struct {
+		Ref  string `json:"$ref"`
+		Name string `json:"name"`
+		In   string `json:"in"`
+	}
+	type schema struct {
+		Ref        string                     `json:"$ref"`
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	var doc struct {
+		Paths map[string]map[string]struct {
+			OperationID string      `json:"operationId"`
+			Parameters  []parameter `json:"parameters"`
+			RequestBody struct {
+				Content map[string]struct {
+					Schema schema `json:"schema"`
+				} `json:"content"`
+			} `json:"requestBody"`
+			Responses map[string]struct {
+				Content map[string]json.RawMessage `json:"content"`
+			} `json:"responses"`
+		} `json:"paths"`
+		Components struct {
+			Parameters map[string]parameter `json:"parameters"`
+			Schemas    map[string]schema    `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Invalid openapi.json: %v", err)
+	}
+	param := regexp.MustCompile(`\\\{[a-z_]+\\\}`)
+	var ops []specOperation
+	for path, methods := range doc.Paths {
+		for method, o := range methods {
+			pattern := param.ReplaceAllString(regexp.QuoteMeta(path), `[^/]+`)
+			op := specOperation{
+				ID:      o.OperationID,
+				Pattern: regexp.MustCompile("^" + strings.ToUpper(method) + " " + pattern + "$"),
+				Query:   map[string]bool{},
+			}
+			for _, p := range o.Parameters {
+				if ref, ok := strings.CutPrefix(p.Ref, "#/components/parameters/"); ok {
+					p = doc.Components.Parameters[ref]
+				}
+				if p.In == "query" {
+					op.Query[p.Name] = true
+				}
+			}
+			if body, ok := o.RequestBody.Content["application/json"]; ok {
+				if ref, ok := strings.CutPrefix(body.Schema.Ref, "#/components/schemas/"); ok {
+					body.Schema = doc.Components.Schemas[ref]
+				}
+				for name := range body.Schema.Properties {
+					if op.Body == nil {
+						op.Body = map[string]bool{}
+					}
+					op.Body[name] = true
+				}
+			}
+			for code, resp := range o.Responses {
+				status, err := strconv.Atoi(code)
+				if err != nil || status < 200 || status > 299 || (op.Status != 0 && op.Status < status) {
+					continue
+				}
+				op.Status, op.ContentType = status, ""
+				for contentType := range resp.Content {
+					if op.ContentType == "" || contentType == "application/json" {
+						op.ContentType = contentType
+					}
+				}
+			}
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
+func TestClient(t *testing.T) {
+	var mutex sync.Mutex
+	var calls []string
+	var lastQuery, lastBody, lastAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		calls = append(calls, r.Method+" "+strings.TrimPrefix(r.URL.Path, apiPrefix))
+		lastQuery, lastBody, lastAuth = r.URL.RawQuery, string(body), r.Header.Get("Authorization")
+		mutex.Unlock()
+		if !strings.HasPrefix(r.URL.Path, apiPrefix+"/") {
+			http.Error(w, "Unversioned request", http.StatusBadRequest)
+			return
+		}
+		r.URL.Path = strings.TrimPrefix(r.URL.Path, apiPrefix)
+		switch {
+		case r.URL.Path == "/time":
+			io.WriteString(w, `{"lamport_timestamp":7,"epoch":1,"wall_time":"2024-01-01T00:00:00Z","node_id":"a"}`)
+		case r.URL.Path == "/events":
+			io.WriteString(w, `{"current_timestamp":2,"epoch":0,"event_count":1,"dropped_count":0,"events":[{"id":"e1","message":"hi","lamport_timestamp":2,"wall_time":"2024-01-01T00:00:00Z"}]}`)
+		case r.URL.Path == "/compare":
+			io.WriteString(w, `{"a":{"id":"e1"},"b":{"id":"e2"},"relation":"before","path":["e1","e2"]}`)
+		case r.URL.Path == "/events/root":
+			io.WriteString(w, `{"root":"ab","tree_size":1,"current_timestamp":2,"epoch":0}`)
+		case strings.HasPrefix(r.URL.Path, "/kv/missing"):
+			http.Error(w, "Key not found", http.StatusNotFound)
+		case strings.HasPrefix(r.URL.Path, "/kv/"):
+			io.WriteString(w, `{"key":"color","value":"blue","version":{"epoch":0,"lamport_timestamp":3,"node_id":"a"},"wall_time":"2024-01-01T00:00:00Z"}`)
+		default:
+			io.WriteString(w, `{"id":"e1","message":"hi","lamport_timestamp":3,"wall_time":"2024-01-01T00:00:00Z"}`)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	c := New(server.URL+"/", nil)
+	c.Token = "t0ken"
+
+	now, err := c.Time(ctx)
+	if err != nil || now.Timestamp != 7 || now.Epoch != 1 || now.NodeID != "a" {
+		t.Errorf("Expected time 1:7 of node a, got %+v (%v)", now, err)
+	}
+	if lastAuth != "Bearer t0ken" {
+		t.Errorf("Expected the bearer token, got %q", lastAuth)
+	}
+
+	if _, err := c.WaitTime(ctx, 5, 2*time.Second); err != nil || lastQuery != "timeout=2s&wait_for=5" {
+		t.Errorf("Expected a long poll query, got %q (%v)", lastQuery, err)
+	}
+
+	event, err := c.CreateEvent(ctx, NewEvent{Message: "hi", Metadata: map[string]string{"k": "v"}})
+	if err != nil || event.ID != "e1" || event.Timestamp != 3 {
+		t.Errorf("Expected event e1 at 3, got %+v (%v)", event, err)
+	}
+	if lastBody != `{"message":"hi","metadata":{"k":"v"}}` {
+		t.Errorf("Expected a JSON body, got %s", lastBody)
+	}
+
+	if _, err := c.ReceiveMessage(ctx, Message{Message: "hi", Sender: "b"}); err != nil || lastQuery != "message=hi&sender=b&timestamp=0" {
+		t.Errorf("Expected the message parameters, got %q (%v)", lastQuery, err)
+	}
+
+	list, err := c.Events(ctx, EventsOptions{Total: true})
+	if err != nil || list.EventCount != 1 || list.Events[0].ID != "e1" || lastQuery != "order=total" {
+		t.Errorf("Expected one event in total order, got %+v %q (%v)", list, lastQuery, err)
+	}
+
+	cmp, err := c.Compare(ctx, "e1", "e2")
+	if err != nil || cmp.Relation != "before" || cmp.B.ID != "e2" || len(cmp.Path) != 2 {
+		t.Errorf("Expected e1 before e2, got %+v (%v)", cmp, err)
+	}
+
+	if root, err := c.MerkleRoot(ctx); err != nil || root.Root != "ab" {
+		t.Errorf("Expected root ab, got %+v (%v)", root, err)
+	}
+
+	reg, err := c.PutRegister(ctx, "color", "blue")
+	if err != nil || reg.Value != "blue" || reg.Version.Timestamp != 3 || reg.Version.NodeID != "a" || lastBody != "blue" {
+		t.Errorf("Expected the written register, got %+v (%v)", reg, err)
+	}
+	c.GetRegister(ctx, "color")
+
+	var apiErr *Error
+	if _, err := c.GetRegister(ctx, "missing"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "Key not found" {
+		t.Errorf("Expected a 404 error, got %v", err)
+	}
+
+	if _, err := c.TickClock(ctx, "worker", "x"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// Every request the client sends is an operation of the API
+	ops := specOperations(t)
+	for _, call := range calls {
+		found := false
+		for _, op := range ops {
+			found = found || op.Pattern.MatchString(call)
+		}
+		if !found {
+			t.Errorf("%s is not an operation of openapi.json", call)
+		}
+	}
+}
+
+func TestEventPages(t *testing.T) {
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		// Three events in pages of two; the cursor names the last event sent
+		switch r.URL.Query().Get("cursor") {
+		case "":
+			io.WriteString(w, `{"current_timestamp":3,"epoch":0,"event_count":3,"dropped_count":0,"count":2,"limit":2,"next_cursor":"0.2","events":[{"id":"e1","lamport_timestamp":1},{"id":"e2","lamport_timestamp":2}]}`)
+		case "0.2":
+			io.WriteString(w, `{"current_timestamp":3,"epoch":0,"event_count":3,"dropped_count":0,"count":1,"limit":2,"events":[{"id":"e3","lamport_timestamp":3}]}`)
+		default:
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	c := New(server.URL, nil)
+	var ids []string
+	opts := EventsOptions{Limit: 2}
+	for {
+		page, err := c.Events(ctx, opts)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if page.Limit != 2 || page.Count != len(page.Events) {
+			t.Errorf("Expected a page of up to 2 events, got %+v", page)
+		}
+		for _, event := range page.Events {
+			ids = append(ids, event.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+	if strings.Join(ids, ",") != "e1,e2,e3" {
+		t.Errorf("Expected e1,e2,e3 across the pages, got %v", ids)
+	}
+	if strings.Join(queries, " ") != "limit=2 cursor=0.2&limit=2" {
+		t.Errorf("Expected the limit on every page and the cursor after the first, got %v", queries)
+	}
+}
+
+// clientOperations calls every operation of the API through the client,
+// keyed by operation ID
+var clientOperations = map[string]func(context.Context, *Client) error{
+	"createEvent": func(ctx context.Context, c *Client) error {
+		_, err := c.CreateEvent(ctx, NewEvent{Message: "hi"})
+		return err
+	},
+	"receiveMessage": func(ctx context.Context, c *Client) error {
+		_, err := c.ReceiveMessage(ctx, Message{Message: "hi", Sent: codec.Timestamp{Epoch: 1, Timestamp: 4}, Sender: "b", ID: "e1"})
+		return err
+	},
+	"listEvents": func(ctx context.Context, c *Client) error {
+		_, err := c.Events(ctx, EventsOptions{Total: true, WaitFor: 3, Timeout: time.Second, Cursor: "c1", Limit: 5})
+		return err
+	},
+	"streamEvents": func(ctx context.Context, c *Client) error {
+		return c.StreamEvents(ctx, StreamFilter{Contains: "a", IDPrefix: "b", MinTimestamp: 2}, func(codec.Event) error { return nil })
+	},
+	"eventGraph":   func(ctx context.Context, c *Client) error { _, err := c.EventGraphDOT(ctx, "clocks"); return err },
+	"verifyEvents": func(ctx context.Context, c *Client) error { _, err := c.VerifyEvents(ctx); return err },
+	"merkleRoot":   func(ctx context.Context, c *Client) error { _, err := c.MerkleRoot(ctx); return err },
+	"getEvent":     func(ctx context.Context, c *Client) error { _, err := c.Event(ctx, "e1"); return err },
+	"annotateEvent": func(ctx context.Context, c *Client) error {
+		_, err := c.Annotate(ctx, "e1", 3, map[string]*string{"k": nil})
+		return err
+	},
+	"eventAnnotations": func(ctx context.Context, c *Client) error { _, err := c.Annotations(ctx, "e1"); return err },
+	"searchEvents":     func(ctx context.Context, c *Client) error { _, err := c.SearchEvents(ctx, "hi", 5); return err },
+	"eventProof":       func(ctx context.Context, c *Client) error { _, err := c.EventProof(ctx, "e1"); return err },
+	"eventsAt":         func(ctx context.Context, c *Client) error { _, err := c.EventsAt(ctx, 3, epoch(1)); return err },
+	"eventsRange":      func(ctx context.Context, c *Client) error { _, err := c.EventsRange(ctx, 1, 3, epoch(1)); return err },
+	"listRollups":      func(ctx context.Context, c *Client) error { _, err := c.Rollups(ctx); return err },
+	"rollupsRange":     func(ctx context.Context, c *Client) error { _, err := c.RollupsRange(ctx, 1, 3, epoch(1)); return err },
+	"archiveSegments":  func(ctx context.Context, c *Client) error { _, err := c.ArchiveSegments(ctx); return err },
+	"archiveRestore": func(ctx context.Context, c *Client) error {
+		_, err := c.RestoreArchive(ctx, 1, 3, epoch(1))
+		return err
+	},
+	"compareEvents": func(ctx context.Context, c *Client) error { _, err := c.Compare(ctx, "e1", "e2"); return err },
+	"clusterEvents": func(ctx context.Context, c *Client) error { _, err := c.ClusterEvents(ctx, "c1", 5); return err },
+	"broadcast": func(ctx context.Context, c *Client) error {
+		_, err := c.Broadcast(ctx, "hi", BroadcastOptions{Quorum: "majority", Timeout: time.Second})
+		return err
+	},
+	"getTime": func(ctx context.Context, c *Client) error { _, err := c.WaitTime(ctx, 3, time.Second); return err },
+	"clockHistory": func(ctx context.Context, c *Client) error {
+		_, err := c.ClockHistory(ctx, HistoryFilter{Cause: "tick", Peer: "b", RequestID: "r", At: 3, Epoch: epoch(1), Limit: 5})
+		return err
+	},
+	"skewAnalytics": func(ctx context.Context, c *Client) error {
+		_, err := c.Skew(ctx, SkewOptions{Window: time.Minute, Interval: time.Second, Burst: 10, Idle: time.Second})
+		return err
+	},
+	"propagationAnalytics": func(ctx context.Context, c *Client) error { _, err := c.Propagation(ctx, "b"); return err },
+	"eventSummary": func(ctx context.Context, c *Client) error {
+		_, err := c.Summary(ctx, SummaryOptions{Ticks: 10, Wall: time.Minute, Top: 3})
+		return err
+	},
+	"memoryUsage":  func(ctx context.Context, c *Client) error { _, err := c.Memory(ctx); return err },
+	"signingKeys":  func(ctx context.Context, c *Client) error { _, err := c.SigningKeys(ctx); return err },
+	"metrics":      func(ctx context.Context, c *Client) error { _, err := c.Metrics(ctx); return err },
+	"healthz":      func(ctx context.Context, c *Client) error { _, err := c.Healthz(ctx); return err },
+	"pprofIndex":   func(ctx context.Context, c *Client) error { _, err := c.PprofIndex(ctx); return err },
+	"pprofProfile": func(ctx context.Context, c *Client) error { _, err := c.Pprof(ctx, "heap", 1); return err },
+	"pprofCmdline": func(ctx context.Context, c *Client) error { _, err := c.PprofCmdline(ctx); return err },
+	"pprofCPU":     func(ctx context.Context, c *Client) error { _, err := c.PprofCPU(ctx, time.Second); return err },
+	"pprofSymbol":  func(ctx context.Context, c *Client) error { _, err := c.PprofSymbol(ctx); return err },
+	"pprofTrace":   func(ctx context.Context, c *Client) error { _, err := c.PprofTrace(ctx, time.Second); return err },
+	"readyz":       func(ctx context.Context, c *Client) error { _, err := c.Readyz(ctx); return err },
+	"openAPI":      func(ctx context.Context, c *Client) error { _, err := c.OpenAPI(ctx); return err },
+	"listSchemas":  func(ctx context.Context, c *Client) error { _, err := c.Schemas(ctx); return err },
+	"registerSchema": func(ctx context.Context, c *Client) error {
+		_, err := c.RegisterSchema(ctx, SchemaDefinition{Type: "login", Schema: json.RawMessage(`{}`)})
+		return err
+	},
+	"getRegister": func(ctx context.Context, c *Client) error { _, err := c.GetRegister(ctx, "color"); return err },
+	"putRegister": func(ctx context.Context, c *Client) error { _, err := c.PutRegister(ctx, "color", "blue"); return err },
+	"listClocks":  func(ctx context.Context, c *Client) error { _, err := c.Clocks(ctx); return err },
+	"deleteClock": func(ctx context.Context, c *Client) error { _, err := c.DeleteClock(ctx, "worker"); return err },
+	"tickClock":   func(ctx context.Context, c *Client) error { _, err := c.TickClock(ctx, "worker", "hi"); return err },
+	"messageClock": func(ctx context.Context, c *Client) error {
+		_, err := c.MessageClock(ctx, "worker", 3, "hi", "other")
+		return err
+	},
+	"clockTime":   func(ctx context.Context, c *Client) error { _, err := c.ClockTime(ctx, "worker"); return err },
+	"clockEvents": func(ctx context.Context, c *Client) error { _, err := c.ClockEvents(ctx, "worker"); return err },
+	"queueMessage": func(ctx context.Context, c *Client) error {
+		_, err := c.QueueMessage(ctx, CausalMessage{Sender: "b", Timestamp: 3, Prev: 2, Message: "hi"})
+		return err
+	},
+	"pendingMessages": func(ctx context.Context, c *Client) error { _, err := c.PendingMessages(ctx); return err },
+	"listScheduled":   func(ctx context.Context, c *Client) error { _, err := c.Scheduled(ctx); return err },
+	"scheduleEvent": func(ctx context.Context, c *Client) error {
+		_, err := c.Schedule(ctx, NewScheduledEvent{DeliverAt: 9, Message: "hi"})
+		return err
+	},
+	"cancelScheduled": func(ctx context.Context, c *Client) error { return c.CancelScheduled(ctx, "s1") },
+	"multicastQueue":  func(ctx context.Context, c *Client) error { _, err := c.MulticastQueue(ctx); return err },
+	"multicast":       func(ctx context.Context, c *Client) error { _, err := c.Multicast(ctx, "hi"); return err },
+	"sendUnacked":     func(ctx context.Context, c *Client) error { _, err := c.Unacked(ctx, "b"); return err },
+	"send":            func(ctx context.Context, c *Client) error { _, err := c.Send(ctx, "b", "hi"); return err },
+	"listOutbox":      func(ctx context.Context, c *Client) error { _, err := c.Outbox(ctx, "pending"); return err },
+	"writeOutbox": func(ctx context.Context, c *Client) error {
+		_, err := c.WriteOutbox(ctx, NewOutboxEvent{Message: "hi", Outbox: []OutboxEntry{{Peer: "b", Message: "hi"}}})
+		return err
+	},
+	"matrixClock":    func(ctx context.Context, c *Client) error { _, err := c.MatrixClock(ctx); return err },
+	"joinCluster":    func(ctx context.Context, c *Client) error { _, err := c.JoinCluster(ctx, "b", "http://b"); return err },
+	"leaveCluster":   func(ctx context.Context, c *Client) error { _, err := c.LeaveCluster(ctx, "b", "http://b"); return err },
+	"clusterMembers": func(ctx context.Context, c *Client) error { _, err := c.ClusterMembers(ctx); return err },
+	"syncCluster":    func(ctx context.Context, c *Client) error { _, err := c.SyncCluster(ctx, "b"); return err },
+	"clusterLeader":  func(ctx context.Context, c *Client) error { _, err := c.ClusterLeader(ctx); return err },
+	"clusterHealth":  func(ctx context.Context, c *Client) error { _, err := c.ClusterHealth(ctx); return err },
+	"raftStatus":     func(ctx context.Context, c *Client) error { _, err := c.RaftStatus(ctx); return err },
+	"querySQL": func(ctx context.Context, c *Client) error {
+		_, err := c.Query(ctx, "SELECT id FROM events WHERE lamport_timestamp > ?", 2)
+		return err
+	},
+	"udpStats": func(ctx context.Context, c *Client) error { _, err := c.UDPStats(ctx); return err },
+	"importEvents": func(ctx context.Context, c *Client) error {
+		_, err := c.Import(ctx, []LegacyRecord{{Message: "hi", WallTime: time.Unix(0, 0)}})
+		return err
+	},
+	"resetClock":   func(ctx context.Context, c *Client) error { _, err := c.ResetClock(ctx); return err },
+	"setClock":     func(ctx context.Context, c *Client) error { _, err := c.SetClock(ctx, 5, true); return err },
+	"advanceClock": func(ctx context.Context, c *Client) error { _, err := c.AdvanceClock(ctx, 5); return err },
+	"freezeClock":  func(ctx context.Context, c *Client) error { _, err := c.FreezeClock(ctx); return err },
+	"resumeClock":  func(ctx context.Context, c *Client) error { _, err := c.ResumeClock(ctx); return err },
+	"tenants":      func(ctx context.Context, c *Client) error { _, err := c.Tenants(ctx); return err },
+	"partition":    func(ctx context.Context, c *Client) error { _, err := c.Partition(ctx); return err },
+	"setPartition": func(ctx context.Context, c *Client) error {
+		_, err := c.SetPartition(ctx, [][]string{{"a"}, {"b", "c"}})
+		return err
+	},
+	"healPartition": func(ctx context.Context, c *Client) error { _, err := c.Heal(ctx); return err },
+	"chaos":         func(ctx context.Context, c *Client) error { _, err := c.Chaos(ctx); return err },
+	"setChaos": func(ctx context.Context, c *Client) error {
+		_, err := c.SetChaos(ctx, Chaos{Delay: time.Millisecond, Jitter: time.Millisecond, Drop: 0.1, Duplicate: 0.1, Peers: []string{"b"}})
+		return err
+	},
+	"stopChaos":    func(ctx context.Context, c *Client) error { _, err := c.StopChaos(ctx); return err },
+	"replayTrace":  func(ctx context.Context, c *Client) error { _, err := c.ReplayTrace(ctx, []byte("{}\n")); return err },
+	"listFeatures": func(ctx context.Context, c *Client) error { _, err := c.Features(ctx); return err },
+	"setFeature":   func(ctx context.Context, c *Client) error { _, err := c.SetFeature(ctx, "x", true); return err },
+	"reloadConfig": func(ctx context.Context, c *Client) error { _, err := c.Reload(ctx); return err },
+	"listAudit": func(ctx context.Context, c *Client) error {
+		_, err := c.Audit(ctx, AuditFilter{Actor: "a", Action: "POST /admin/", Since: 2, Limit: 5})
+		return err
+	},
+	"listWebhooks": func(ctx context.Context, c *Client) error { _, err := c.Webhooks(ctx); return err },
+	"registerWebhook": func(ctx context.Context, c *Client) error {
+		_, err := c.RegisterWebhook(ctx, NewWebhook{URL: "http://hook", Filter: EventFilter{IDPrefix: "e"}})
+		return err
+	},
+	"removeWebhook": func(ctx context.Context, c *Client) error { _, err := c.RemoveWebhook(ctx, "w1"); return err },
+	"webhookDeliveries": func(ctx context.Context, c *Client) error {
+		_, err := c.WebhookDeliveries(ctx, "w1", "failed")
+		return err
+	},
+	"listTimers": func(ctx context.Context, c *Client) error { _, err := c.Timers(ctx); return err },
+	"setTimer": func(ctx context.Context, c *Client) error {
+		_, err := c.SetTimer(ctx, NewClockTimer{URL: "http://hook", After: 3})
+		return err
+	},
+	"cancelTimer": func(ctx context.Context, c *Client) error { return c.CancelTimer(ctx, "t1") },
+	"beginTx":     func(ctx context.Context, c *Client) error { _, err := c.BeginTx(ctx); return err },
+	"getTx":       func(ctx context.Context, c *Client) error { _, err := c.Tx(ctx, "tx1"); return err },
+	"logTxEvent": func(ctx context.Context, c *Client) error {
+		_, err := c.TxEvent(ctx, "tx1", NewEvent{Message: "hi"})
+		return err
+	},
+	"commitTx": func(ctx context.Context, c *Client) error { _, err := c.CommitTx(ctx, "tx1"); return err },
+	"abortTx":  func(ctx context.Context, c *Client) error { _, err := c.AbortTx(ctx, "tx1"); return err },
+	"graphqlGet": func(ctx context.Context, c *Client) error {
+		_, err := c.GraphQLGet(ctx, GraphQLRequest{Query: "{ time }", Variables: map[string]interface{}{"a": 1}, OperationName: "q"})
+		return err
+	},
+	"graphqlPost": func(ctx context.Context, c *Client) error {
+		_, err := c.GraphQL(ctx, GraphQLRequest{Query: "{ time }"})
+		return err
+	},
+}
+
+func epoch(e int64) *int64 { return &e }
+
+// TestClientCoversSpec calls every documented operation and checks that
+// the client sends it to the documented path with documented parameters
+func TestClientCoversSpec(t *testing.T) {
+	var mutex sync.Mutex
+	var op specOperation
+	var calls []*http.Request
+	var bodies [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		calls, bodies = append(calls, r), append(bodies, body)
+		answer := op
+		mutex.Unlock()
+		switch {
+		case answer.ContentType == "":
+			w.WriteHeader(answer.Status)
+		case answer.ContentType == "application/json":
+			w.Header().Set("Content-Type", answer.ContentType)
+			w.WriteHeader(answer.Status)
+			io.WriteString(w, "{}")
+		default:
+			w.Header().Set("Content-Type", answer.ContentType)
+			w.WriteHeader(answer.Status)
+			io.WriteString(w, "text")
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	c := New(server.URL, nil)
+	for _, spec := range specOperations(t) {
+		call, ok := clientOperations[spec.ID]
+		if !ok {
+			t.Errorf("The client has no method for %s (%s)", spec.ID, spec.Pattern)
+			continue
+		}
+		mutex.Lock()
+		op, calls, bodies = spec, nil, nil
+		mutex.Unlock()
+		if err := call(ctx, c); err != nil {
+			t.Errorf("%s: %v", spec.ID, err)
+		}
+		mutex.Lock()
+		sent := calls
+		mutex.Unlock()
+		if len(sent) != 1 {
+			t.Errorf("%s: expected one request, got %d", spec.ID, len(sent))
+			continue
+		}
+		r := sent[0]
+		if got := r.Method + " " + strings.TrimPrefix(r.URL.Path, apiPrefix); !spec.Pattern.MatchString(got) {
+			t.Errorf("%s: sent %s, expected %s", spec.ID, got, spec.Pattern)
+		}
+		for name := range r.URL.Query() {
+			if !spec.Query[name] {
+				t.Errorf("%s: sent undocumented parameter %s", spec.ID, name)
+			}
+		}
+		var fields map[string]json.RawMessage
+		if spec.Body != nil && r.Header.Get("Content-Type") == "application/json" && json.Unmarshal(bodies[0], &fields) == nil {
+			for name := range fields {
+				if !spec.Body[name] {
+					t.Errorf("%s: sent undocumented body property %s", spec.ID, name)
+				}
+			}
+		}
+	}
+	ids := map[string]bool{}
+	for _, spec := range specOperations(t) {
+		ids[spec.ID] = true
+	}
+	for id := range clientOperations {
+		if !ids[id] {
+			t.Errorf("%s is not an operation of openapi.json", id)
+		}
+	}
+}
+
+// TestClientTypesMatchSpec checks the JSON fields of the client types
+// against the schemas of openapi.json
+func TestClientTypesMatchSpec(t *testing.T) {
+	data, err := os.ReadFile("../openapi.json")
+	if err != nil {
+		t.Fatalf("Failed to read openapi.json: %v", err)
+	}
+	var doc struct {
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]json.RawMessage `json:"properties"`
+				Required   []string                   `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Invalid openapi.json: %v", err)
+	}
+
+	types := map[string]interface{}{
+		"ClockTime": codec.Timestamp{}, "Event": codec.Event{},
+		"ClockTransition": ClockTransition{}, "ClockHistory": ClockHistory{}, "SkewReport": SkewReport{},
+		"PropagationBucket": PropagationBucket{}, "PeerPropagation": PeerPropagation{}, "EventSummary": EventSummary{},
+		"Time": Time{}, "NewEvent": NewEvent{}, "EventList": EventList{}, "Rollup": Rollup{}, "RollupList": RollupList{},
+		"Segment": Segment{}, "SegmentList": SegmentList{}, "QueryResult": QueryResult{}, "MerkleRoot": MerkleRoot{},
+		"Comparison": Comparison{}, "GraphNode": GraphNode{}, "Register": Register{}, "SchemaDefinition": SchemaDefinition{},
+		"EventFilter": EventFilter{}, "NewWebhook": NewWebhook{}, "Webhook": Webhook{}, "NewClockTimer": NewClockTimer{},
+		"ClockTimer": ClockTimer{}, "Annotation": Annotation{}, "Transaction": Transaction{}, "TxCommit": TxCommit{},
+		"NewScheduledEvent": NewScheduledEvent{}, "ScheduledEvent": ScheduledEvent{}, "TraceReport": TraceReport{},
+		"SentMessage": SentMessage{}, "SendResult": SendResult{}, "NewOutboxEvent": NewOutboxEvent{},
+		"OutboxMessage": OutboxMessage{}, "BroadcastResult": BroadcastResult{}, "AuditEntry": AuditEntry{},
+		"FeatureList": FeatureList{}, "MemoryUsage": MemoryUsage{}, "ClusterEvents": ClusterEvents{},
+		"GraphQLRequest": GraphQLRequest{}, "GraphQLResponse": GraphQLResponse{},
+	}
+	for name, value := range types {
+		schema, ok := doc.Components.Schemas[name]
+		if !ok {
+			t.Errorf("%s is not a schema of openapi.json", name)
+			continue
+		}
+		fields := map[string]bool{}
+		typ := reflect.TypeOf(value)
+		for i := 0; i < typ.NumField(); i++ {
+			tag, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+			if tag == "" || tag == "-" {
+				continue
+			}
+			fields[tag] = true
+			if _, ok := schema.Properties[tag]; !ok {
+				t.Errorf("%s.%s is not a property of schema %s", typ.Name(), tag, name)
+			}
+		}
+		for _, required := range schema.Required {
+			if !fields[required] {
+				t.Errorf("%s has no field for the required property %s of schema %s", typ.Name(), required, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec"
+)
+
+// The virtual clocks simulate processes inside one server, each created
+// by its first event
+
+// Clocks lists the virtual clocks and their times
+func (c *Client) Clocks(ctx context.Context) (Object, error) {
+	var clocks Object
+	err := c.do(ctx, http.MethodGet, "/clocks", nil, nil, "", &clocks)
+	return clocks, err
+}
+
+// DeleteClock removes a virtual clock and its events
+func (c *Client) DeleteClock(ctx context.Context, name string) (Object, error) {
+	var result Object
+	err := c.do(ctx, http.MethodDelete, clockPath(name, ""), nil, nil, "", &result)
+	return result, err
+}
+
+// MessageClock delivers a message sent at timestamp to a virtual clock
+func (c *Client) MessageClock(ctx context.Context, name string, timestamp int64, message, sender string) (codec.Event, error) {
+	query := url.Values{"timestamp": {strconv.FormatInt(timestamp, 10)}, "message": {message}}
+	if sender != "" {
+		query.Set("sender", sender)
+	}
+	var event codec.Event
+	err := c.do(ctx, http.MethodPost, clockPath(name, "/message"), query, nil, "", &event)
+	return event, err
+}
+
+// ClockTime returns the time of a virtual clock
+func (c *Client) ClockTime(ctx context.Context, name string) (Object, error) {
+	var t Object
+	err := c.do(ctx, http.MethodGet, clockPath(name, "/time"), nil, nil, "", &t)
+	return t, err
+}
+
+// ClockEvents lists the events of a virtual clock
+func (c *Client) ClockEvents(ctx context.Context, name string) (Object, error) {
+	var events Object
+	err := c.do(ctx, http.MethodGet, clockPath(name, "/events"), nil, nil, "", &events)
+	return events, err
+}
+
+func clockPath(name, suffix string) string {
+	return "/clocks/" + url.PathEscape(name) + suffix
+}
@@ -0,0 +1,277 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec"
+)
+
+// BroadcastOptions set how many peers a broadcast waits for, and how long
+type BroadcastOptions struct {
+	Quorum  string        // a number of peers or "majority", all of them when empty
+	Timeout time.Duration // the server default when 0
+}
+
+// Broadcast is the answer of POST /broadcast
+type Broadcast struct {
+	Event         codec.Event       `json:"event"`
+	Delivered     int               `json:"delivered"`
+	Failed        int               `json:"failed"`
+	Peers         []BroadcastResult `json:"peers"`
+	Pending       int               `json:"pending"`
+	Quorum        int               `json:"quorum"`
+	QuorumReached bool              `json:"quorum_reached"`
+}
+
+// BroadcastResult is the delivery of a broadcast to one peer
+type BroadcastResult struct {
+	Peer      string `json:"peer"`
+	OK        bool   `json:"ok"`
+	Pending   bool   `json:"pending,omitempty"`
+	EventID   string `json:"event_id,omitempty"`
+	Timestamp int64  `json:"lamport_timestamp,omitempty"`
+	Epoch     int64  `json:"epoch,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// CausalMessage is a message for causal delivery through POST /queue
+type CausalMessage struct {
+	Sender    string
+	Timestamp int64
+	Prev      int64 // the sender's previous timestamp
+	Message   string
+}
+
+// SentMessage is a message sent to a peer exactly once
+type SentMessage struct {
+	Peer      string    `json:"peer"`
+	Seq       int64     `json:"seq"`
+	EventID   string    `json:"event_id"`
+	Timestamp int64     `json:"lamport_timestamp"`
+	Epoch     int64     `json:"epoch"`
+	Message   string    `json:"message"`
+	RequestID string    `json:"request_id,omitempty"`
+	Created   time.Time `json:"created"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// SendResult is the answer of POST /send
+type SendResult struct {
+	Message   SentMessage `json:"message"`
+	Delivered bool        `json:"delivered"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// Unacked is the answer of GET /send
+type Unacked struct {
+	Count   int           `json:"count"`
+	Unacked []SentMessage `json:"unacked"`
+}
+
+// NewOutboxEvent is an event written together with messages to peers
+type NewOutboxEvent struct {
+	Message       string            `json:"message,omitempty"`
+	Type          string            `json:"type,omitempty"`
+	SchemaVersion int               `json:"schema_version,omitempty"`
+	Payload       json.RawMessage   `json:"payload,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+	Outbox        []OutboxEntry     `json:"outbox"`
+}
+
+// OutboxEntry is a message of a NewOutboxEvent
+type OutboxEntry struct {
+	Peer    string `json:"peer"` // peer URL or node ID
+	Message string `json:"message"`
+}
+
+// OutboxMessage is a message of the outbox and its delivery
+type OutboxMessage struct {
+	ID          string           `json:"id"`
+	EventID     string           `json:"event_id"`
+	Peer        string           `json:"peer"`
+	Message     string           `json:"message"`
+	Status      string           `json:"status"` // pending or delivered
+	SendEventID string           `json:"send_event_id,omitempty"`
+	SentAt      *codec.Timestamp `json:"sent_at,omitempty"`
+	RequestID   string           `json:"request_id,omitempty"`
+	Attempts    int              `json:"attempts"`
+	LastError   string           `json:"last_error,omitempty"`
+	Created     time.Time        `json:"created"`
+	Delivered   *time.Time       `json:"delivered,omitempty"`
+}
+
+// OutboxList is the answer of GET /outbox
+type OutboxList struct {
+	Count    int             `json:"count"`
+	Messages []OutboxMessage `json:"messages"`
+}
+
+// OutboxWrite is the answer of POST /outbox
+type OutboxWrite struct {
+	Event  codec.Event     `json:"event"`
+	Outbox []OutboxMessage `json:"outbox"`
+}
+
+// Broadcast sends a message to every peer with a single tick
+func (c *Client) Broadcast(ctx context.Context, message string, opts BroadcastOptions) (Broadcast, error) {
+	query := url.Values{"message": {message}}
+	if opts.Quorum != "" {
+		query.Set("quorum", opts.Quorum)
+	}
+	if opts.Timeout > 0 {
+		query.Set("timeout", opts.Timeout.String())
+	}
+	var b Broadcast
+	err := c.do(ctx, http.MethodPost, "/broadcast", query, nil, "", &b)
+	return b, err
+}
+
+// QueueMessage hands a message to the causal delivery queue
+func (c *Client) QueueMessage(ctx context.Context, m CausalMessage) (Object, error) {
+	query := url.Values{
+		"sender":    {m.Sender},
+		"timestamp": {strconv.FormatInt(m.Timestamp, 10)},
+		"prev":      {strconv.FormatInt(m.Prev, 10)},
+		"message":   {m.Message},
+	}
+	var result Object
+	err := c.do(ctx, http.MethodPost, "/queue", query, nil, "", &result)
+	return result, err
+}
+
+// PendingMessages lists the messages held back by the causal delivery queue
+func (c *Client) PendingMessages(ctx context.Context) (Object, error) {
+	var pending Object
+	err := c.do(ctx, http.MethodGet, "/queue/pending", nil, nil, "", &pending)
+	return pending, err
+}
+
+// Multicast sends a message to all peers for delivery in total order
+func (c *Client) Multicast(ctx context.Context, message string) (Object, error) {
+	var result Object
+	err := c.do(ctx, http.MethodPost, "/multicast", url.Values{"message": {message}}, nil, "", &result)
+	return result, err
+}
+
+// MulticastQueue lists the multicast messages waiting for delivery
+func (c *Client) MulticastQueue(ctx context.Context) (Object, error) {
+	var queue Object
+	err := c.do(ctx, http.MethodGet, "/multicast", nil, nil, "", &queue)
+	return queue, err
+}
+
+// Send sends a message to one peer, by URL or node ID, exactly once
+func (c *Client) Send(ctx context.Context, peer, message string) (SendResult, error) {
+	var result SendResult
+	err := c.do(ctx, http.MethodPost, "/send", url.Values{"peer": {peer}, "message": {message}}, nil, "", &result)
+	return result, err
+}
+
+// Unacked lists the messages sent to peer, or to any peer when empty, and
+// not acknowledged yet
+func (c *Client) Unacked(ctx context.Context, peer string) (Unacked, error) {
+	var query url.Values
+	if peer != "" {
+		query = url.Values{"peer": {peer}}
+	}
+	var unacked Unacked
+	err := c.do(ctx, http.MethodGet, "/send", query, nil, "", &unacked)
+	return unacked, err
+}
+
+// WriteOutbox records an event together with messages to peers, which are
+// sent once it is stored
+func (c *Client) WriteOutbox(ctx context.Context, e NewOutboxEvent) (OutboxWrite, error) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return OutboxWrite{}, err
+	}
+	var write OutboxWrite
+	err = c.do(ctx, http.MethodPost, "/outbox", nil, body, "application/json", &write)
+	return write, err
+}
+
+// Outbox lists the outbox messages in status, or all of them when empty
+func (c *Client) Outbox(ctx context.Context, status string) (OutboxList, error) {
+	var query url.Values
+	if status != "" {
+		query = url.Values{"status": {status}}
+	}
+	var list OutboxList
+	err := c.do(ctx, http.MethodGet, "/outbox", query, nil, "", &list)
+	return list, err
+}
+
+// MatrixClock returns the matrix clock of the server
+func (c *Client) MatrixClock(ctx context.Context) (Object, error) {
+	var matrix Object
+	err := c.do(ctx, http.MethodGet, "/peers/matrix", nil, nil, "", &matrix)
+	return matrix, err
+}
+
+// JoinCluster registers a node with the cluster
+func (c *Client) JoinCluster(ctx context.Context, node, nodeURL string) (Object, error) {
+	var result Object
+	err := c.do(ctx, http.MethodPost, "/cluster/join", url.Values{"node": {node}, "url": {nodeURL}}, nil, "", &result)
+	return result, err
+}
+
+// LeaveCluster deregisters a node
+func (c *Client) LeaveCluster(ctx context.Context, node, nodeURL string) (Object, error) {
+	var result Object
+	err := c.do(ctx, http.MethodPost, "/cluster/leave", url.Values{"node": {node}, "url": {nodeURL}}, nil, "", &result)
+	return result, err
+}
+
+// ClusterMembers lists the members of the cluster
+func (c *Client) ClusterMembers(ctx context.Context) (Object, error) {
+	var members Object
+	err := c.do(ctx, http.MethodGet, "/cluster/members", nil, nil, "", &members)
+	return members, err
+}
+
+// SyncCluster reconciles the log with a peer, by node ID or URL, or with
+// all peers when peer is empty
+func (c *Client) SyncCluster(ctx context.Context, peer string) (Object, error) {
+	var query url.Values
+	if peer != "" {
+		query = url.Values{"peer": {peer}}
+	}
+	var result Object
+	err := c.do(ctx, http.MethodPost, "/cluster/sync", query, nil, "", &result)
+	return result, err
+}
+
+// ClusterLeader returns the leader of the cluster
+func (c *Client) ClusterLeader(ctx context.Context) (Object, error) {
+	var leader Object
+	err := c.do(ctx, http.MethodGet, "/cluster/leader", nil, nil, "", &leader)
+	return leader, err
+}
+
+// ClusterHealth returns the health of the peers
+func (c *Client) ClusterHealth(ctx context.Context) (Object, error) {
+	var health Object
+	err := c.do(ctx, http.MethodGet, "/cluster/health", nil, nil, "", &health)
+	return health, err
+}
+
+// RaftStatus returns the Raft state of the server
+func (c *Client) RaftStatus(ctx context.Context) (Object, error) {
+	var status Object
+	err := c.do(ctx, http.MethodGet, "/raft/status", nil, nil, "", &status)
+	return status, err
+}
+
+// UDPStats returns the statistics of the UDP clock sync
+func (c *Client) UDPStats(ctx context.Context) (Object, error) {
+	var stats Object
+	err := c.do(ctx, http.MethodGet, "/udp/stats", nil, nil, "", &stats)
+	return stats, err
+}
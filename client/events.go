@@ -0,0 +1,290 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec"
+)
+
+// Object is an answer the API documents as a free-form JSON object
+type Object map[string]interface{}
+
+// StreamFilter selects the events of StreamEvents
+type StreamFilter struct {
+	Contains     string // only messages containing this text
+	IDPrefix     string // only IDs with this prefix
+	MinTimestamp int64  // only events at or after this timestamp, when > 0
+}
+
+// Annotation holds the annotations of an event and their version
+type Annotation struct {
+	ID          string            `json:"id"`
+	Annotations map[string]string `json:"annotations"`
+	Version     int64             `json:"lamport_timestamp"`
+	WallTime    time.Time         `json:"wall_time,omitempty"`
+}
+
+// Rollup counts the events rolled up with timestamps in [Start, End) of
+// an epoch
+type Rollup struct {
+	Epoch         int64     `json:"epoch"`
+	Start         int64     `json:"start"`
+	End           int64     `json:"end"`
+	Count         int       `json:"count"`
+	MinTimestamp  int64     `json:"min_timestamp"`
+	MaxTimestamp  int64     `json:"max_timestamp"`
+	FirstWallTime time.Time `json:"first_wall_time,omitempty"`
+	LastWallTime  time.Time `json:"last_wall_time,omitempty"`
+}
+
+// RollupList is the answer of GET /events/rollups
+type RollupList struct {
+	BucketWidth int64            `json:"bucket_width"`
+	Age         string           `json:"age"`
+	RolledUp    int              `json:"rolled_up"`
+	Rollups     []Rollup         `json:"rollups"`
+	EventsKept  int              `json:"events_kept"`
+	OldestKept  *codec.Timestamp `json:"oldest_kept,omitempty"`
+}
+
+// Segment is an archived segment of the log
+type Segment struct {
+	Key           string          `json:"key"`
+	Position      int64           `json:"position"`
+	Count         int             `json:"count"`
+	From          codec.Timestamp `json:"from"`
+	To            codec.Timestamp `json:"to"`
+	FirstWallTime time.Time       `json:"first_wall_time"`
+	LastWallTime  time.Time       `json:"last_wall_time"`
+	Size          int64           `json:"size"`
+	SHA256        string          `json:"sha256"`
+	ArchivedAt    time.Time       `json:"archived_at"`
+}
+
+// SegmentList is the answer of GET /events/archive
+type SegmentList struct {
+	Age      string    `json:"age"`
+	Archived int       `json:"archived"`
+	Segments []Segment `json:"segments"`
+}
+
+// Restored is the answer of POST /events/archive/restore
+type Restored struct {
+	Events   []codec.Event `json:"events"`
+	Count    int           `json:"count"`
+	Segments []string      `json:"segments"`
+}
+
+// ClusterEvents is a page of the merged history of a node and its peers
+type ClusterEvents struct {
+	Events     []codec.Event     `json:"events"`
+	Count      int               `json:"count"`
+	Total      int               `json:"total"`
+	Limit      int               `json:"limit"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+	Peers      map[string]string `json:"peers"` // ok or the error of each peer
+}
+
+// StreamEvents calls fn with every new event matching filter, until ctx
+// is done, fn returns an error or the server ends the stream
+func (c *Client) StreamEvents(ctx context.Context, filter StreamFilter, fn func(codec.Event) error) error {
+	query := url.Values{}
+	if filter.Contains != "" {
+		query.Set("contains", filter.Contains)
+	}
+	if filter.IDPrefix != "" {
+		query.Set("id_prefix", filter.IDPrefix)
+	}
+	if filter.MinTimestamp > 0 {
+		query.Set("min_timestamp", strconv.FormatInt(filter.MinTimestamp, 10))
+	}
+	resp, err := c.send(ctx, http.MethodGet, "/events/stream", query, nil, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Only data lines carry events; comments and heartbeats are skipped
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var event codec.Event
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// EventGraph returns the happened-before graph of the server log, or of
+// the virtual clocks when scope is "clocks"
+func (c *Client) EventGraph(ctx context.Context, scope string) (Object, error) {
+	var graph Object
+	err := c.do(ctx, http.MethodGet, "/events/graph", scopeQuery(nil, scope), nil, "", &graph)
+	return graph, err
+}
+
+// EventGraphDOT returns the happened-before graph in Graphviz format
+func (c *Client) EventGraphDOT(ctx context.Context, scope string) (string, error) {
+	dot, err := c.raw(ctx, http.MethodGet, "/events/graph", scopeQuery(url.Values{"format": {"dot"}}, scope))
+	return string(dot), err
+}
+
+// VerifyEvents checks the signatures and the hash chain of the log
+func (c *Client) VerifyEvents(ctx context.Context) (Object, error) {
+	var report Object
+	err := c.do(ctx, http.MethodGet, "/events/verify", nil, nil, "", &report)
+	return report, err
+}
+
+// Event returns an event by ID. Unknown IDs return an *Error with status
+// 404.
+func (c *Client) Event(ctx context.Context, id string) (codec.Event, error) {
+	var event codec.Event
+	err := c.do(ctx, http.MethodGet, "/events/"+url.PathEscape(id), nil, nil, "", &event)
+	return event, err
+}
+
+// Annotations returns the annotations of an event
+func (c *Client) Annotations(ctx context.Context, id string) (Annotation, error) {
+	var a Annotation
+	err := c.do(ctx, http.MethodGet, "/events/"+url.PathEscape(id)+"/annotations", nil, nil, "", &a)
+	return a, err
+}
+
+// Annotate sets annotations of an event, made against the version of
+// Annotations; a nil value removes a key. A stale version returns an
+// *Error with status 409.
+func (c *Client) Annotate(ctx context.Context, id string, version int64, set map[string]*string) (Annotation, error) {
+	body, err := json.Marshal(set)
+	if err != nil {
+		return Annotation{}, err
+	}
+	header := http.Header{"If-Match": {strconv.FormatInt(version, 10)}}
+	resp, err := c.send(ctx, http.MethodPatch, "/events/"+url.PathEscape(id), nil, header, body, "application/json")
+	if err != nil {
+		return Annotation{}, err
+	}
+	defer resp.Body.Close()
+	var a Annotation
+	err = json.NewDecoder(resp.Body).Decode(&a)
+	return a, err
+}
+
+// SearchEvents returns up to limit events whose message contains text,
+// all of them when limit is 0
+func (c *Client) SearchEvents(ctx context.Context, text string, limit int) (EventList, error) {
+	query := url.Values{"contains": {text}}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var list EventList
+	err := c.do(ctx, http.MethodGet, "/events/search", query, nil, "", &list)
+	return list, err
+}
+
+// EventProof returns the Merkle inclusion proof of an event
+func (c *Client) EventProof(ctx context.Context, id string) (Object, error) {
+	var proof Object
+	err := c.do(ctx, http.MethodGet, "/events/"+url.PathEscape(id)+"/proof", nil, nil, "", &proof)
+	return proof, err
+}
+
+// EventsAt returns the events stamped with timestamp in epoch, or in the
+// current epoch when epoch is nil
+func (c *Client) EventsAt(ctx context.Context, timestamp int64, epoch *int64) (EventList, error) {
+	var list EventList
+	err := c.do(ctx, http.MethodGet, "/events/at/"+strconv.FormatInt(timestamp, 10), epochQuery(epoch), nil, "", &list)
+	return list, err
+}
+
+// EventsRange returns the events stamped from one timestamp to another,
+// inclusive, in epoch or the current one when epoch is nil
+func (c *Client) EventsRange(ctx context.Context, from, to int64, epoch *int64) (EventList, error) {
+	var list EventList
+	err := c.do(ctx, http.MethodGet, rangePath("/events/range", from, to), epochQuery(epoch), nil, "", &list)
+	return list, err
+}
+
+// Rollups lists the rollups of old events
+func (c *Client) Rollups(ctx context.Context) (RollupList, error) {
+	var list RollupList
+	err := c.do(ctx, http.MethodGet, "/events/rollups", nil, nil, "", &list)
+	return list, err
+}
+
+// RollupsRange lists the rollups overlapping a range of timestamps
+func (c *Client) RollupsRange(ctx context.Context, from, to int64, epoch *int64) (RollupList, error) {
+	var list RollupList
+	err := c.do(ctx, http.MethodGet, rangePath("/events/rollups", from, to), epochQuery(epoch), nil, "", &list)
+	return list, err
+}
+
+// ArchiveSegments lists the archived segments of the log
+func (c *Client) ArchiveSegments(ctx context.Context) (SegmentList, error) {
+	var list SegmentList
+	err := c.do(ctx, http.MethodGet, "/events/archive", nil, nil, "", &list)
+	return list, err
+}
+
+// RestoreArchive returns the archived events of a range of timestamps
+func (c *Client) RestoreArchive(ctx context.Context, from, to int64, epoch *int64) (Restored, error) {
+	var restored Restored
+	err := c.do(ctx, http.MethodPost, rangePath("/events/archive/restore", from, to), epochQuery(epoch), nil, "", &restored)
+	return restored, err
+}
+
+// ClusterEvents returns a page of the merged history of the server and its
+// peers: the first one for an empty cursor, limit events or the server
+// default when 0
+func (c *Client) ClusterEvents(ctx context.Context, cursor string, limit int) (ClusterEvents, error) {
+	query := url.Values{}
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var page ClusterEvents
+	err := c.do(ctx, http.MethodGet, "/cluster/events", query, nil, "", &page)
+	return page, err
+}
+
+func scopeQuery(query url.Values, scope string) url.Values {
+	if scope == "" {
+		return query
+	}
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("scope", scope)
+	return query
+}
+
+func epochQuery(epoch *int64) url.Values {
+	if epoch == nil {
+		return nil
+	}
+	return url.Values{"epoch": {strconv.FormatInt(*epoch, 10)}}
+}
+
+func rangePath(prefix string, from, to int64) string {
+	return prefix + "/" + strconv.FormatInt(from, 10) + "/" + strconv.FormatInt(to, 10)
+}
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+)
+
+// SchemaDefinition is a JSON Schema for the payloads of an event type
+type SchemaDefinition struct {
+	Type    string          `json:"type"`
+	Version int             `json:"version,omitempty"` // 1 when 0
+	Schema  json.RawMessage `json:"schema"`
+}
+
+// QueryResult is the answer of POST /query
+type QueryResult struct {
+	Columns   []string        `json:"columns"`
+	Rows      [][]interface{} `json:"rows"`
+	Truncated bool            `json:"truncated,omitempty"` // more rows matched than were returned
+}
+
+// GraphQLRequest is a GraphQL query and its variables
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+}
+
+// GraphQLResponse is the answer of /graphql
+type GraphQLResponse struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []GraphQLError         `json:"errors,omitempty"`
+}
+
+// GraphQLError is an error of a GraphQL query
+type GraphQLError struct {
+	Message   string `json:"message"`
+	Locations []struct {
+		Line   int `json:"line"`
+		Column int `json:"column"`
+	} `json:"locations,omitempty"`
+	Path []interface{} `json:"path,omitempty"` // field names and list indexes
+}
+
+// Schemas lists the registered schemas
+func (c *Client) Schemas(ctx context.Context) (Object, error) {
+	var schemas Object
+	err := c.do(ctx, http.MethodGet, "/schemas", nil, nil, "", &schemas)
+	return schemas, err
+}
+
+// RegisterSchema registers a schema for the payloads of an event type
+func (c *Client) RegisterSchema(ctx context.Context, def SchemaDefinition) (Object, error) {
+	body, err := json.Marshal(def)
+	if err != nil {
+		return nil, err
+	}
+	var result Object
+	err = c.do(ctx, http.MethodPost, "/schemas", nil, body, "application/json", &result)
+	return result, err
+}
+
+// Query runs a read-only SQL query over the log, with args for the ?
+// placeholders
+func (c *Client) Query(ctx context.Context, sql string, args ...interface{}) (QueryResult, error) {
+	body, err := json.Marshal(struct {
+		SQL  string        `json:"sql"`
+		Args []interface{} `json:"args,omitempty"`
+	}{sql, args})
+	if err != nil {
+		return QueryResult{}, err
+	}
+	var result QueryResult
+	err = c.do(ctx, http.MethodPost, "/query", nil, body, "application/json", &result)
+	return result, err
+}
+
+// GraphQL runs a GraphQL query. Errors of the query are returned in the
+// response, not as an error.
+func (c *Client) GraphQL(ctx context.Context, req GraphQLRequest) (GraphQLResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return GraphQLResponse{}, err
+	}
+	var resp GraphQLResponse
+	err = c.do(ctx, http.MethodPost, "/graphql", nil, body, "application/json", &resp)
+	return resp, err
+}
+
+// GraphQLGet runs a GraphQL query through GET, for caches and proxies
+// that only pass GET requests
+func (c *Client) GraphQLGet(ctx context.Context, req GraphQLRequest) (GraphQLResponse, error) {
+	query := url.Values{"query": {req.Query}}
+	if len(req.Variables) > 0 {
+		variables, err := json.Marshal(req.Variables)
+		if err != nil {
+			return GraphQLResponse{}, err
+		}
+		query.Set("variables", string(variables))
+	}
+	if req.OperationName != "" {
+		query.Set("operationName", req.OperationName)
+	}
+	var resp GraphQLResponse
+	err := c.do(ctx, http.MethodGet, "/graphql", query, nil, "", &resp)
+	return resp, err
+}
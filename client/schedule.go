@@ -0,0 +1,251 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec"
+)
+
+// NewScheduledEvent is an event to log once the clock reaches DeliverAt
+type NewScheduledEvent struct {
+	DeliverAt     int64             `json:"deliver_at_ts"`
+	Epoch         int64             `json:"epoch,omitempty"` // epoch of DeliverAt, the current one when 0
+	Message       string            `json:"message,omitempty"`
+	Type          string            `json:"type,omitempty"`
+	SchemaVersion int               `json:"schema_version,omitempty"`
+	Payload       json.RawMessage   `json:"payload,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+}
+
+// ScheduledEvent is an event waiting for its timestamp
+type ScheduledEvent struct {
+	ID            string            `json:"id"`
+	DeliverAt     int64             `json:"deliver_at_ts"`
+	Epoch         int64             `json:"epoch"`
+	Message       string            `json:"message"`
+	Type          string            `json:"type,omitempty"`
+	SchemaVersion int               `json:"schema_version,omitempty"`
+	Payload       json.RawMessage   `json:"payload,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+	ScheduledAt   codec.Timestamp   `json:"scheduled_at"` // time of the clock when it was scheduled
+	RequestID     string            `json:"request_id,omitempty"`
+}
+
+// ScheduleList is the answer of GET /schedule
+type ScheduleList struct {
+	CurrentTimestamp int64            `json:"current_timestamp"`
+	PendingCount     int              `json:"pending_count"`
+	Pending          []ScheduledEvent `json:"pending"`
+}
+
+// EventFilter selects the events a webhook is called for
+type EventFilter struct {
+	MessageContains string            `json:"message_contains,omitempty"`
+	IDPrefix        string            `json:"id_prefix,omitempty"`
+	MinTimestamp    int64             `json:"min_timestamp,omitempty"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+}
+
+// NewWebhook is the body of POST /webhooks
+type NewWebhook struct {
+	URL    string      `json:"url"`
+	Filter EventFilter `json:"filter"`
+	Secret string      `json:"secret,omitempty"` // key of the HMAC signature of the deliveries
+}
+
+// Webhook is a registered webhook; the server redacts its secret
+type Webhook struct {
+	ID      string      `json:"id"`
+	URL     string      `json:"url"`
+	Filter  EventFilter `json:"filter"`
+	Secret  string      `json:"secret,omitempty"`
+	Created time.Time   `json:"created"`
+}
+
+// NewClockTimer is the body of POST /timers: a callback of URL at a
+// timestamp, or After ticks from now
+type NewClockTimer struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"`
+	At     int64  `json:"at,omitempty"`
+	Epoch  int64  `json:"epoch,omitempty"` // epoch of At, the current one when 0
+	After  int64  `json:"after,omitempty"`
+}
+
+// ClockTimer is a timer waiting for its timestamp; the server redacts its
+// secret
+type ClockTimer struct {
+	ID      string    `json:"id"`
+	At      int64     `json:"at"`
+	Epoch   int64     `json:"epoch"`
+	URL     string    `json:"url"`
+	Secret  string    `json:"secret,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// TimerList is the answer of GET /timers
+type TimerList struct {
+	CurrentTimestamp int64        `json:"current_timestamp"`
+	Count            int          `json:"count"`
+	Timers           []ClockTimer `json:"timers"`
+}
+
+// Transaction holds events back until they are committed together
+type Transaction struct {
+	ID       string        `json:"tx_id"`
+	Events   []codec.Event `json:"events"`
+	OpenedAt time.Time     `json:"opened_at"`
+}
+
+// TxEvent is the answer of POST /tx/{id}/event
+type TxEvent struct {
+	ID    string `json:"tx_id"`
+	Index int    `json:"index"` // position of the event in the transaction
+}
+
+// TxCommit is the answer of POST /tx/{id}/commit
+type TxCommit struct {
+	ID         string        `json:"tx_id"`
+	EventCount int           `json:"event_count"`
+	Events     []codec.Event `json:"events"` // with consecutive timestamps
+}
+
+// TxAbort is the answer of POST /tx/{id}/abort
+type TxAbort struct {
+	ID           string `json:"tx_id"`
+	DroppedCount int    `json:"dropped_count"`
+}
+
+// Scheduled lists the events waiting for their timestamps
+func (c *Client) Scheduled(ctx context.Context) (ScheduleList, error) {
+	var list ScheduleList
+	err := c.do(ctx, http.MethodGet, "/schedule", nil, nil, "", &list)
+	return list, err
+}
+
+// Schedule logs an event once the clock reaches its timestamp
+func (c *Client) Schedule(ctx context.Context, e NewScheduledEvent) (ScheduledEvent, error) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return ScheduledEvent{}, err
+	}
+	var scheduled ScheduledEvent
+	err = c.do(ctx, http.MethodPost, "/schedule", nil, body, "application/json", &scheduled)
+	return scheduled, err
+}
+
+// CancelScheduled drops a scheduled event. Unknown IDs return an *Error
+// with status 404.
+func (c *Client) CancelScheduled(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/schedule/"+url.PathEscape(id), nil, nil, "", nil)
+}
+
+// Webhooks lists the registered webhooks
+func (c *Client) Webhooks(ctx context.Context) (Object, error) {
+	var hooks Object
+	err := c.do(ctx, http.MethodGet, "/webhooks", nil, nil, "", &hooks)
+	return hooks, err
+}
+
+// RegisterWebhook registers a URL to call with the events matching a filter
+func (c *Client) RegisterWebhook(ctx context.Context, hook NewWebhook) (Webhook, error) {
+	body, err := json.Marshal(hook)
+	if err != nil {
+		return Webhook{}, err
+	}
+	var registered Webhook
+	err = c.do(ctx, http.MethodPost, "/webhooks", nil, body, "application/json", &registered)
+	return registered, err
+}
+
+// RemoveWebhook removes a webhook
+func (c *Client) RemoveWebhook(ctx context.Context, id string) (Object, error) {
+	var result Object
+	err := c.do(ctx, http.MethodDelete, "/webhooks", url.Values{"id": {id}}, nil, "", &result)
+	return result, err
+}
+
+// WebhookDeliveries lists the deliveries of webhook, or of all of them
+// when empty, in status, or in any when empty
+func (c *Client) WebhookDeliveries(ctx context.Context, webhook, status string) (Object, error) {
+	query := url.Values{}
+	if webhook != "" {
+		query.Set("webhook", webhook)
+	}
+	if status != "" {
+		query.Set("status", status)
+	}
+	var deliveries Object
+	err := c.do(ctx, http.MethodGet, "/webhooks/deliveries", query, nil, "", &deliveries)
+	return deliveries, err
+}
+
+// Timers lists the timers waiting for their timestamps
+func (c *Client) Timers(ctx context.Context) (TimerList, error) {
+	var list TimerList
+	err := c.do(ctx, http.MethodGet, "/timers", nil, nil, "", &list)
+	return list, err
+}
+
+// SetTimer calls a URL once the clock reaches a timestamp
+func (c *Client) SetTimer(ctx context.Context, timer NewClockTimer) (ClockTimer, error) {
+	body, err := json.Marshal(timer)
+	if err != nil {
+		return ClockTimer{}, err
+	}
+	var set ClockTimer
+	err = c.do(ctx, http.MethodPost, "/timers", nil, body, "application/json", &set)
+	return set, err
+}
+
+// CancelTimer drops a timer. Unknown IDs return an *Error with status 404.
+func (c *Client) CancelTimer(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/timers/"+url.PathEscape(id), nil, nil, "", nil)
+}
+
+// BeginTx opens a transaction
+func (c *Client) BeginTx(ctx context.Context) (Transaction, error) {
+	var tx Transaction
+	err := c.do(ctx, http.MethodPost, "/tx/begin", nil, nil, "", &tx)
+	return tx, err
+}
+
+// Tx returns an open transaction and the events it holds
+func (c *Client) Tx(ctx context.Context, id string) (Transaction, error) {
+	var tx Transaction
+	err := c.do(ctx, http.MethodGet, txPath(id, ""), nil, nil, "", &tx)
+	return tx, err
+}
+
+// TxEvent adds an event to a transaction; it is stamped at commit
+func (c *Client) TxEvent(ctx context.Context, id string, e NewEvent) (TxEvent, error) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return TxEvent{}, err
+	}
+	var added TxEvent
+	err = c.do(ctx, http.MethodPost, txPath(id, "/event"), nil, body, "application/json", &added)
+	return added, err
+}
+
+// CommitTx logs the events of a transaction, all of them or none
+func (c *Client) CommitTx(ctx context.Context, id string) (TxCommit, error) {
+	var commit TxCommit
+	err := c.do(ctx, http.MethodPost, txPath(id, "/commit"), nil, nil, "", &commit)
+	return commit, err
+}
+
+// AbortTx drops a transaction and its events
+func (c *Client) AbortTx(ctx context.Context, id string) (TxAbort, error) {
+	var abort TxAbort
+	err := c.do(ctx, http.MethodPost, txPath(id, "/abort"), nil, nil, "", &abort)
+	return abort, err
+}
+
+func txPath(id, suffix string) string {
+	return "/tx/" + url.PathEscape(id) + suffix
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/clockctx"
+)
+
+// withClockContext moves the clock up to the Lamport-Timestamp header of a
+// request, so the events it records come after the caller's, and carries
+// the resulting time in the request context for clockctx. Unlike a
+// received message the header counts no event of its own. Only peers move
+// the clock this way, as they alone may send /message: the header of
+// other callers, and of any request to a public route, is ignored as if
+// it were missing.
+func (s *Server) withClockContext(pattern string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(headerTimestamp) == "" || slices.Contains(publicRoutes, pattern) || !s.isPeer(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		received, err := parseClockHeaders(r.Header.Get, s.clock.Now().Epoch)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		src := ClockSource{Peer: r.Header.Get(headerSender), RequestID: requestIDFrom(r.Context())}
+		now, err := s.clock.observeFrom(received, src)
+		if errors.Is(err, ErrJumpTooLarge) {
+			http.Error(w, "Timestamp jump exceeds max_jump", http.StatusUnprocessableEntity)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(clockctx.WithTimestamp(r.Context(), now.Timestamp)))
+	})
+}
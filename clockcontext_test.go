@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/clockctx"
+)
+
+func TestClockContextMiddleware(t *testing.T) {
+	server := NewServer()
+	handler := server.withClockContext("/event", http.HandlerFunc(server.handleCreateEvent))
+
+	req := httptest.NewRequest(http.MethodPost, "/event?message=after", nil)
+	req.Header.Set(clockctx.Header, "40")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var event Event
+	json.NewDecoder(w.Body).Decode(&event)
+	if event.Timestamp != 41 {
+		t.Errorf("Expected the event to follow the caller's timestamp, got %d", event.Timestamp)
+	}
+
+	// Malformed headers and rejected jumps do not reach the handler
+	req = httptest.NewRequest(http.MethodPost, "/event", nil)
+	req.Header.Set(clockctx.Header, "x")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a malformed header, got %d", w.Code)
+	}
+
+	server.clock.SetJumpGuard(JumpGuard{MaxJump: 10})
+	req = httptest.NewRequest(http.MethodPost, "/event", nil)
+	req.Header.Set(clockctx.Header, "1000")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnprocessableEntity || server.events.Len() != 1 {
+		t.Errorf("Expected 422 without an event, got %d with %d events", w.Code, server.events.Len())
+	}
+}
+
+func TestPeersForwardClockContext(t *testing.T) {
+	var got string
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(clockctx.Header)
+	}))
+	defer peer.Close()
+
+	peers := NewPeers([]string{peer.URL}, peer.Client())
+	ctx := clockctx.WithTimestamp(context.Background(), 9)
+	if _, err := peers.Do(ctx, peer.URL, http.MethodGet, "/time", nil, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got != "9" {
+		t.Errorf("Expected the carried timestamp to be forwarded, got %q", got)
+	}
+}
+
+func TestClockContextOnlyFromPeers(t *testing.T) {
+	server := NewServer()
+	server.peerCerts = true
+	server.access, _ = NewAccessControl([]RoleConfig{
+		{Name: "dashboard", APIKeys: []string{"read-key"}, Roles: []string{"reader"}},
+		{Name: "node-b", APIKeys: []string{"peer-key"}, Roles: []string{"peer"}},
+	}, nil, nil)
+
+	// Public routes and callers other than peers never move the clock
+	for _, tc := range []struct{ path, key string }{
+		{"/healthz", ""},
+		{"/openapi.json", ""},
+		{"/time", ""},
+		{"/time", "read-key"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		req.Header.Set(clockctx.Header, "4611686018427387904")
+		if tc.key != "" {
+			req.Header.Set("X-API-Key", tc.key)
+		}
+		server.ServeHTTP(httptest.NewRecorder(), req)
+		if now := server.clock.Now().Timestamp; now != 0 {
+			t.Fatalf("%s with key %q: expected the clock unchanged, got %d", tc.path, tc.key, now)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/time", nil)
+	req.Header.Set(clockctx.Header, "40")
+	req.Header.Set("X-API-Key", "peer-key")
+	server.ServeHTTP(httptest.NewRecorder(), req)
+	if now := server.clock.Now().Timestamp; now != 40 {
+		t.Errorf("Expected a peer to move the clock to 40, got %d", now)
+	}
+}
@@ -0,0 +1,97 @@
+// Package clockctx carries Lamport timestamps in contexts, so application
+// code can pass the logical time of a request down its call chains and into
+// the goroutines it starts, and across HTTP calls in the Lamport-Timestamp
+// header understood by the server.
+//
+// A context carries the timestamp of the last event on its causal path.
+// Tick records a new event after it, WithTimestamp and Timestamp set and read
+// it directly, and Middleware and SetHeader move it in and out of HTTP
+// requests.
+package clockctx
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Header is the HTTP header carrying a Lamport timestamp
+const Header = "Lamport-Timestamp"
+
+// Clock is the part of a Lamport clock the helpers use. The server's
+// LamportClock satisfies it.
+type Clock interface {
+	// Tick records a local event and returns its timestamp
+	Tick() int64
+	// Update merges a received timestamp and returns the new time
+	Update(received int64) int64
+}
+
+type timestampKey struct{}
+
+// WithTimestamp returns a copy of ctx carrying ts
+func WithTimestamp(ctx context.Context, ts int64) context.Context {
+	return context.WithValue(ctx, timestampKey{}, ts)
+}
+
+// Timestamp returns the timestamp carried by ctx and whether there is one
+func Timestamp(ctx context.Context) (int64, bool) {
+	ts, ok := ctx.Value(timestampKey{}).(int64)
+	return ts, ok
+}
+
+// Tick records an event on clock and returns a copy of ctx carrying its
+// timestamp. When ctx already carries a timestamp the clock is updated with
+// it instead of ticked, so the event comes after everything earlier on the
+// call chain even if that happened on another clock.
+func Tick(ctx context.Context, clock Clock) (context.Context, int64) {
+	var ts int64
+	if carried, ok := Timestamp(ctx); ok {
+		ts = clock.Update(carried)
+	} else {
+		ts = clock.Tick()
+	}
+	return WithTimestamp(ctx, ts), ts
+}
+
+// FromHeader reads the timestamp of an HTTP header set. ok is false when
+// the header is absent.
+func FromHeader(h http.Header) (ts int64, ok bool, err error) {
+	raw := h.Get(Header)
+	if raw == "" {
+		return 0, false, nil
+	}
+	ts, err = strconv.ParseInt(raw, 10, 64)
+	if err != nil || ts < 0 {
+		return 0, false, fmt.Errorf("invalid %s header %q", Header, raw)
+	}
+	return ts, true, nil
+}
+
+// SetHeader sets the header to the timestamp carried by ctx, if any
+func SetHeader(ctx context.Context, h http.Header) {
+	if ts, ok := Timestamp(ctx); ok {
+		h.Set(Header, strconv.FormatInt(ts, 10))
+	}
+}
+
+// Middleware treats a request carrying the header as a received message:
+// it updates clock with the timestamp and hands the handler a context
+// carrying the result. Requests without the header pass through unchanged
+// and malformed headers are rejected with 400 Bad Request.
+func Middleware(clock Clock) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ts, ok, err := FromHeader(r.Header)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if ok {
+				r = r.WithContext(WithTimestamp(r.Context(), clock.Update(ts)))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package clockctx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// testClock is a minimal Lamport clock
+type testClock struct {
+	time  int64
+	mutex sync.Mutex
+}
+
+func (c *testClock) Tick() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.time++
+	return c.time
+}
+
+func (c *testClock) Update(received int64) int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.time = max(c.time, received) + 1
+	return c.time
+}
+
+func TestTimestamp(t *testing.T) {
+	if _, ok := Timestamp(context.Background()); ok {
+		t.Errorf("Expected no timestamp on a bare context")
+	}
+	ctx := WithTimestamp(context.Background(), 7)
+	if ts, ok := Timestamp(ctx); !ok || ts != 7 {
+		t.Errorf("Expected 7, got %d (%v)", ts, ok)
+	}
+}
+
+func TestTick(t *testing.T) {
+	clock := &testClock{}
+
+	ctx, ts := Tick(context.Background(), clock)
+	if ts != 1 {
+		t.Errorf("Expected a plain tick to 1, got %d", ts)
+	}
+	if carried, _ := Timestamp(ctx); carried != 1 {
+		t.Errorf("Expected the context to carry 1, got %d", carried)
+	}
+
+	// A timestamp from further along the call chain is merged
+	ctx, ts = Tick(WithTimestamp(ctx, 10), clock)
+	if ts != 11 {
+		t.Errorf("Expected the carried timestamp to be merged, got %d", ts)
+	}
+
+	// Goroutines started from ctx follow it
+	done := make(chan int64)
+	go func() {
+		_, ts := Tick(ctx, &testClock{})
+		done <- ts
+	}()
+	if ts := <-done; ts != 12 {
+		t.Errorf("Expected a fresh clock to start after the context, got %d", ts)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	h := http.Header{}
+	SetHeader(context.Background(), h)
+	if _, ok, err := FromHeader(h); ok || err != nil {
+		t.Errorf("Expected no header without a timestamp, got %v (%v)", h, err)
+	}
+
+	SetHeader(WithTimestamp(context.Background(), 42), h)
+	if ts, ok, err := FromHeader(h); !ok || err != nil || ts != 42 {
+		t.Errorf("Expected 42, got %d (%v, %v)", ts, ok, err)
+	}
+
+	for _, raw := range []string{"abc", "-1"} {
+		h.Set(Header, raw)
+		if _, _, err := FromHeader(h); err == nil {
+			t.Errorf("Expected an error for %q", raw)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	clock := &testClock{time: 3}
+	var seen int64
+	var carried bool
+	handler := Middleware(clock)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, carried = Timestamp(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(Header, "20")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if !carried || seen != 21 {
+		t.Errorf("Expected the handler to see 21, got %d (%v)", seen, carried)
+	}
+
+	carried = false
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if carried || clock.time != 21 {
+		t.Errorf("Expected requests without the header to pass through, got %v at %d", carried, clock.time)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(Header, "soon")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a malformed header, got %d", w.Code)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var sent string
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = r.Header.Get(Header)
+		w.Header().Set(Header, "30")
+	}))
+	defer peer.Close()
+
+	clock := &testClock{}
+	client := &http.Client{Transport: NewTransport(clock, nil)}
+	req, _ := http.NewRequestWithContext(WithTimestamp(context.Background(), 4), http.MethodGet, peer.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if sent != "5" {
+		t.Errorf("Expected the request to be sent at 5, got %q", sent)
+	}
+	if req.Header.Get(Header) != "" {
+		t.Errorf("Expected the caller's request to be left alone")
+	}
+	if clock.time != 31 {
+		t.Errorf("Expected the response timestamp to be merged, got %d", clock.time)
+	}
+}
@@ -0,0 +1,283 @@
+// Package clockgrpc provides gRPC interceptors that keep a Lamport clock
+// up to date across calls, carrying timestamps in the lamport-timestamp
+// metadata key.
+//
+// Clients count every call as an event and send its timestamp in the
+// request metadata. Servers merge it into their clock, hand the handler a
+// context carrying the result for the clockctx helpers, and answer with the
+// timestamp of the reply in the trailer, which the client merges in turn.
+// Installing them is one option on each side:
+//
+//	grpc.NewServer(grpc.ChainUnaryInterceptor(clockgrpc.UnaryServerInterceptor(clock)))
+//	grpc.NewClient(target, grpc.WithChainUnaryInterceptor(clockgrpc.UnaryClientInterceptor(clock)))
+//
+// ConnectInterceptor does the same for Connect handlers and clients, which
+// also speak gRPC and gRPC-Web:
+//
+//	lamportpbconnect.NewClockHandler(svc, connect.WithInterceptors(clockgrpc.ConnectInterceptor(clock)))
+package clockgrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"connectrpc.com/connect"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/clockctx"
+)
+
+// MetadataKey is the metadata key carrying a Lamport timestamp
+const MetadataKey = "lamport-timestamp"
+
+// fromMetadata reads the timestamp of a metadata set. ok is false when the
+// key is absent.
+func fromMetadata(md metadata.MD) (ts int64, ok bool, err error) {
+	return parse(md.Get(MetadataKey))
+}
+
+// fromHeader reads the timestamp of the headers or trailers of a Connect
+// call, where metadata keys are header names
+func fromHeader(h http.Header) (ts int64, ok bool, err error) {
+	return parse(h.Values(MetadataKey))
+}
+
+func parse(values []string) (ts int64, ok bool, err error) {
+	if len(values) == 0 {
+		return 0, false, nil
+	}
+	ts, err = strconv.ParseInt(values[0], 10, 64)
+	if err != nil || ts < 0 {
+		return 0, false, fmt.Errorf("invalid %s metadata %q", MetadataKey, values[0])
+	}
+	return ts, true, nil
+}
+
+func stamp(ts int64) metadata.MD {
+	return metadata.Pairs(MetadataKey, strconv.FormatInt(ts, 10))
+}
+
+// receive merges the timestamp of an incoming call into clock and returns
+// a context carrying the result. Calls without one keep their context.
+func receive(ctx context.Context, clock clockctx.Clock) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ts, ok, err := fromMetadata(md)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !ok {
+		return ctx, nil
+	}
+	return clockctx.WithTimestamp(ctx, clock.Update(ts)), nil
+}
+
+// send counts an outgoing call as an event and adds its timestamp to the
+// outgoing metadata
+func send(ctx context.Context, clock clockctx.Clock) context.Context {
+	ctx, ts := clockctx.Tick(ctx, clock)
+	return metadata.AppendToOutgoingContext(ctx, MetadataKey, strconv.FormatInt(ts, 10))
+}
+
+// reply merges the timestamp of a response trailer into clock, if any
+func reply(trailer metadata.MD, clock clockctx.Clock) {
+	if ts, ok, err := fromMetadata(trailer); ok && err == nil {
+		clock.Update(ts)
+	}
+}
+
+// UnaryServerInterceptor merges the timestamp of each call into clock and
+// sends the timestamp of the reply in the trailer. Calls with malformed
+// metadata fail with codes.InvalidArgument.
+func UnaryServerInterceptor(clock clockctx.Clock) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := receive(ctx, clock)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := handler(ctx, req)
+		_, ts := clockctx.Tick(ctx, clock)
+		grpc.SetTrailer(ctx, stamp(ts))
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streams. The
+// trailer carries the timestamp of the end of the stream.
+func StreamServerInterceptor(clock clockctx.Clock) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := receive(ss.Context(), clock)
+		if err != nil {
+			return err
+		}
+		err = handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		_, ts := clockctx.Tick(ctx, clock)
+		ss.SetTrailer(stamp(ts))
+		return err
+	}
+}
+
+// serverStream replaces the context of a stream
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// UnaryClientInterceptor counts each call as an event on clock, sends its
+// timestamp and merges the timestamp of the reply
+func UnaryClientInterceptor(clock clockctx.Clock) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, resp any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		var trailer metadata.MD
+		err := invoker(send(ctx, clock), method, req, resp, cc, append(opts, grpc.Trailer(&trailer))...)
+		reply(trailer, clock)
+		return err
+	}
+}
+
+// StreamClientInterceptor is UnaryClientInterceptor for streams. The
+// timestamp of the reply is merged once the stream ends.
+func StreamClientInterceptor(clock clockctx.Clock) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		cs, err := streamer(send(ctx, clock), desc, cc, method, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &clientStream{ClientStream: cs, clock: clock}, nil
+	}
+}
+
+// clientStream merges the trailer of a stream when it ends
+type clientStream struct {
+	grpc.ClientStream
+	clock clockctx.Clock
+	ended bool
+}
+
+func (s *clientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	// The trailer is available once RecvMsg fails, including with io.EOF
+	if err != nil && !s.ended {
+		s.ended = true
+		reply(s.Trailer(), s.clock)
+	}
+	return err
+}
+
+// ConnectInterceptor is the interceptors above for Connect handlers and
+// clients (connectrpc.com/connect), whatever protocol a call uses.
+// Handlers merge the timestamp of each call into clock, hand the method a
+// context carrying the result and answer with the timestamp of the reply
+// in the trailer; calls with malformed metadata fail with
+// connect.CodeInvalidArgument. Clients count each call as an event, send
+// its timestamp and merge the timestamp of the reply, for streams once
+// they end.
+func ConnectInterceptor(clock clockctx.Clock) connect.Interceptor {
+	return connectInterceptor{clock: clock}
+}
+
+type connectInterceptor struct {
+	clock clockctx.Clock
+}
+
+func (ci connectInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if req.Spec().IsClient {
+			ctx, ts := clockctx.Tick(ctx, ci.clock)
+			req.Header().Set(MetadataKey, strconv.FormatInt(ts, 10))
+			resp, err := next(ctx, req)
+			if trailer := connectTrailer(resp, err); trailer != nil {
+				if ts, ok, err := fromHeader(trailer); ok && err == nil {
+					ci.clock.Update(ts)
+				}
+			}
+			return resp, err
+		}
+
+		ctx, err := ci.receive(ctx, req.Header())
+		if err != nil {
+			return nil, err
+		}
+		resp, err := next(ctx, req)
+		_, ts := clockctx.Tick(ctx, ci.clock)
+		if trailer := connectTrailer(resp, err); trailer != nil {
+			trailer.Set(MetadataKey, strconv.FormatInt(ts, 10))
+		}
+		return resp, err
+	}
+}
+
+func (ci connectInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		ctx, ts := clockctx.Tick(ctx, ci.clock)
+		conn := next(ctx, spec)
+		conn.RequestHeader().Set(MetadataKey, strconv.FormatInt(ts, 10))
+		return &connectClientConn{StreamingClientConn: conn, clock: ci.clock}
+	}
+}
+
+func (ci connectInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		ctx, err := ci.receive(ctx, conn.RequestHeader())
+		if err != nil {
+			return err
+		}
+		err = next(ctx, conn)
+		_, ts := clockctx.Tick(ctx, ci.clock)
+		conn.ResponseTrailer().Set(MetadataKey, strconv.FormatInt(ts, 10))
+		return err
+	}
+}
+
+// receive merges the timestamp of a Connect call, as receive does for
+// grpc-go calls
+func (ci connectInterceptor) receive(ctx context.Context, header http.Header) (context.Context, error) {
+	ts, ok, err := fromHeader(header)
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+	if !ok {
+		return ctx, nil
+	}
+	return clockctx.WithTimestamp(ctx, ci.clock.Update(ts)), nil
+}
+
+// connectTrailer returns the trailer of a unary call, which Connect keeps
+// in the metadata of errors
+func connectTrailer(resp connect.AnyResponse, err error) http.Header {
+	var cerr *connect.Error
+	switch {
+	case err == nil:
+		return resp.Trailer()
+	case errors.As(err, &cerr):
+		return cerr.Meta()
+	}
+	return nil
+}
+
+// connectClientConn merges the trailer of a stream when it ends
+type connectClientConn struct {
+	connect.StreamingClientConn
+	clock clockctx.Clock
+	ended bool
+}
+
+func (c *connectClientConn) Receive(m any) error {
+	err := c.StreamingClientConn.Receive(m)
+	// The trailer is available once Receive fails, including with io.EOF
+	if err != nil && !c.ended {
+		c.ended = true
+		if ts, ok, perr := fromHeader(c.ResponseTrailer()); ok && perr == nil {
+			c.clock.Update(ts)
+		}
+	}
+	return err
+}
@@ -0,0 +1,189 @@
+package clockgrpc
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"connectrpc.com/connect"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/clockctx"
+)
+
+// testClock is a minimal Lamport clock
+type testClock struct {
+	time  int64
+	mutex sync.Mutex
+}
+
+func (c *testClock) Tick() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.time++
+	return c.time
+}
+
+func (c *testClock) Update(received int64) int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.time = max(c.time, received) + 1
+	return c.time
+}
+
+func (c *testClock) now() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.time
+}
+
+// dial serves the health service over an in-memory listener
+func dial(t *testing.T, server, client *testClock) healthpb.HealthClient {
+	listener := bufconn.Listen(1 << 16)
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(UnaryServerInterceptor(server)),
+		grpc.ChainStreamInterceptor(StreamServerInterceptor(server)),
+	)
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(UnaryClientInterceptor(client)),
+		grpc.WithChainStreamInterceptor(StreamClientInterceptor(client)),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn)
+}
+
+func TestUnaryInterceptors(t *testing.T) {
+	server := &testClock{time: 10}
+	client := &testClock{}
+	health := dial(t, server, client)
+
+	if _, err := health.Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// The call is sent at 1, received at 11, answered at 12, merged at 13
+	if server.now() != 12 || client.now() != 13 {
+		t.Errorf("Expected server at 12 and client at 13, got %d and %d", server.now(), client.now())
+	}
+}
+
+func TestStreamInterceptors(t *testing.T) {
+	server := &testClock{time: 10}
+	client := &testClock{}
+	health := dial(t, server, client)
+
+	stream, err := health.Watch(context.Background(), &healthpb.HealthCheckRequest{Service: "unknown"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if server.now() != 11 {
+		t.Errorf("Expected the server to merge the call, got %d", server.now())
+	}
+}
+
+func TestServerInterceptorContext(t *testing.T) {
+	clock := &testClock{}
+	var carried int64
+	handler := func(ctx context.Context, req any) (any, error) {
+		carried, _ = clockctx.Timestamp(ctx)
+		return nil, nil
+	}
+	intercept := UnaryServerInterceptor(clock)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(MetadataKey, "5"))
+	if _, err := intercept(ctx, nil, &grpc.UnaryServerInfo{}, handler); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if carried != 6 {
+		t.Errorf("Expected the handler to see 6, got %d", carried)
+	}
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(MetadataKey, "later"))
+	if _, err := intercept(ctx, nil, &grpc.UnaryServerInfo{}, handler); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for malformed metadata, got %v", err)
+	}
+}
+
+// serveConnect serves a unary and a server streaming procedure through
+// Connect, and returns the URL of the server
+func serveConnect(t *testing.T, server *testClock, carried *int64) string {
+	intercept := connect.WithInterceptors(ConnectInterceptor(server))
+	mux := http.NewServeMux()
+	mux.Handle("/test.v1.Test/Unary", connect.NewUnaryHandler("/test.v1.Test/Unary",
+		func(ctx context.Context, req *connect.Request[emptypb.Empty]) (*connect.Response[emptypb.Empty], error) {
+			*carried, _ = clockctx.Timestamp(ctx)
+			return connect.NewResponse(&emptypb.Empty{}), nil
+		}, intercept))
+	mux.Handle("/test.v1.Test/Stream", connect.NewServerStreamHandler("/test.v1.Test/Stream",
+		func(ctx context.Context, req *connect.Request[emptypb.Empty], stream *connect.ServerStream[emptypb.Empty]) error {
+			*carried, _ = clockctx.Timestamp(ctx)
+			return stream.Send(&emptypb.Empty{})
+		}, intercept))
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+func TestConnectInterceptor(t *testing.T) {
+	server := &testClock{time: 10}
+	client := &testClock{}
+	var carried int64
+	url := serveConnect(t, server, &carried)
+	opt := connect.WithInterceptors(ConnectInterceptor(client))
+	unary := connect.NewClient[emptypb.Empty, emptypb.Empty](http.DefaultClient, url+"/test.v1.Test/Unary", opt)
+	streaming := connect.NewClient[emptypb.Empty, emptypb.Empty](http.DefaultClient, url+"/test.v1.Test/Stream", opt)
+	ctx := context.Background()
+
+	if _, err := unary.CallUnary(ctx, connect.NewRequest(&emptypb.Empty{})); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// The call is sent at 1, received at 11, answered at 12, merged at 13
+	if carried != 11 || server.now() != 12 || client.now() != 13 {
+		t.Errorf("Expected the method at 11, server at 12 and client at 13, got %d, %d and %d", carried, server.now(), client.now())
+	}
+
+	// Sent at 14, received at 15, ended at 16, merged at 17
+	stream, err := streaming.CallServerStream(ctx, connect.NewRequest(&emptypb.Empty{}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for stream.Receive() {
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if carried != 15 || server.now() != 16 || client.now() != 17 {
+		t.Errorf("Expected the stream at 15, server at 16 and client at 17, got %d, %d and %d", carried, server.now(), client.now())
+	}
+
+	plain := connect.NewClient[emptypb.Empty, emptypb.Empty](http.DefaultClient, url+"/test.v1.Test/Unary")
+	req := connect.NewRequest(&emptypb.Empty{})
+	req.Header().Set(MetadataKey, "later")
+	if _, err := plain.CallUnary(ctx, req); connect.CodeOf(err) != connect.CodeInvalidArgument {
+		t.Errorf("Expected invalid_argument for malformed metadata, got %v", err)
+	}
+}
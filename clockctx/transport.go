@@ -0,0 +1,43 @@
+package clockctx
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// transport stamps outgoing requests with a clock
+type transport struct {
+	clock Clock
+	base  http.RoundTripper
+}
+
+// NewTransport returns an http.RoundTripper that counts every request it
+// sends as an event on clock and sends its timestamp in the header. A
+// timestamp carried by the request context is merged first, as in Tick. If
+// the response carries the header too, the clock is updated with it. A nil
+// base uses http.DefaultTransport.
+//
+//	client := &http.Client{Transport: clockctx.NewTransport(clock, nil)}
+func NewTransport(clock Clock, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{clock: clock, base: base}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, ts := Tick(req.Context(), t.clock)
+
+	// RoundTrippers must not modify the request they are given
+	req = req.Clone(ctx)
+	req.Header.Set(Header, strconv.FormatInt(ts, 10))
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if received, ok, err := FromHeader(resp.Header); ok && err == nil {
+		t.clock.Update(received)
+	}
+	return resp, nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultClockHistory is how many transitions are kept without -clock-history
+const defaultClockHistory = 1000
+
+// Causes of clock transitions
+const (
+	causeTick         = "tick"          // local event
+	causeUpdate       = "update"        // received timestamp merged as an event
+	causeObserve      = "observe"       // seen timestamp adopted without an event
+	causeCommit       = "commit"        // timestamp committed through Raft
+	causeRestore      = "restore"       // persisted time restored on start
+	causeUntick       = "untick"        // ticks given back by a failed write
+	causeAdminSet     = "admin-set"     // POST /admin/clock/set
+	causeAdminReset   = "admin-reset"   // POST /admin/clock/reset
+	causeAdminAdvance = "admin-advance" // POST /admin/clock/advance
+	causeAdminFreeze  = "admin-freeze"  // POST /admin/clock/freeze, traced only
+	causeAdminResume  = "admin-resume"  // POST /admin/clock/resume, traced only
+)
+
+// ClockSource names what caused a transition, as far as it is known
+type ClockSource struct {
+	Peer      string `json:"peer,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// ClockTransition is a change of the clock value with its cause
+type ClockTransition struct {
+	Seq      uint64    `json:"seq"`
+	From     ClockTime `json:"from"`
+	To       ClockTime `json:"to"`
+	Cause    string    `json:"cause"`
+	Received ClockTime `json:"received,omitzero"` // merged timestamp, for update and observe
+	Clamped  bool      `json:"clamped,omitempty"` // the jump guard lowered the received timestamp
+	ClockSource
+	WallTime time.Time `json:"wall_time"`
+}
+
+// reached reports whether the transition moved the clock to or past at
+func (t ClockTransition) reached(at ClockTime) bool {
+	return t.From.Before(at) && !t.To.Before(at)
+}
+
+// ClockHistory keeps the newest clock transitions in a ring, separately from
+// the event log, so a jump can be traced back to its cause after the fact.
+// A nil history records nothing.
+type ClockHistory struct {
+	entries []ClockTransition
+	next    uint64 // sequence number of the next transition
+	mutex   sync.RWMutex
+}
+
+// NewClockHistory keeps up to capacity transitions
+func NewClockHistory(capacity int) *ClockHistory {
+	return &ClockHistory{entries: make([]ClockTransition, capacity)}
+}
+
+func (h *ClockHistory) record(t ClockTransition) {
+	if h == nil || len(h.entries) == 0 {
+		return
+	}
+	h.mutex.Lock()
+	h.next++
+	t.Seq = h.next
+	h.entries[(h.next-1)%uint64(len(h.entries))] = t
+	h.mutex.Unlock()
+}
+
+// Transitions returns the kept transitions, newest first
+func (h *ClockHistory) Transitions() []ClockTransition {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	n := min(h.next, uint64(len(h.entries)))
+	out := make([]ClockTransition, 0, n)
+	for seq := h.next; seq > h.next-n; seq-- {
+		out = append(out, h.entries[(seq-1)%uint64(len(h.entries))])
+	}
+	return out
+}
+
+// Total is the number of transitions recorded since the start, including
+// those no longer kept
+func (h *ClockHistory) Total() uint64 {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.next
+}
+
+// recordLocked records a change of the clock from from to its current
+// value. Calls that left the clock where it was are not transitions, but
+// are traced so a replay runs every operation.
+func (lc *LamportClock) recordLocked(from ClockTime, cause string, received ClockTime, clamped bool, src ClockSource) {
+	if lc.history == nil && lc.trace == nil {
+		return
+	}
+	t := ClockTransition{
+		From:        from,
+		To:          lc.nowLocked(),
+		Cause:       cause,
+		Received:    received,
+		Clamped:     clamped,
+		ClockSource: src,
+		WallTime:    lc.wall(),
+	}
+	lc.trace.record(t)
+	if lc.history == nil || t.To == t.From {
+		return
+	}
+	lc.history.record(t)
+}
+
+// handleClockHistory lists the transitions of the clock, newest first.
+// Filters: cause, peer, request_id, and at=<ts>[&epoch=<e>] for the
+// transition that took the clock to or past a value.
+func (s *Server) handleClockHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	history := s.clock.history
+	if history == nil {
+		http.Error(w, "Clock history disabled (-clock-history 0)", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	var at *ClockTime
+	if v := query.Get("at"); v != "" {
+		ts, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || ts < 0 {
+			http.Error(w, "Invalid at parameter", http.StatusBadRequest)
+			return
+		}
+		target := ClockTime{Epoch: s.clock.Now().Epoch, Timestamp: ts}
+		if v := query.Get("epoch"); v != "" {
+			if target.Epoch, err = strconv.ParseInt(v, 10, 64); err != nil || target.Epoch < 0 {
+				http.Error(w, "Invalid epoch parameter", http.StatusBadRequest)
+				return
+			}
+		}
+		at = &target
+	}
+	limit := 0
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	cause, peer, requestID := query.Get("cause"), query.Get("peer"), query.Get("request_id")
+	transitions := []ClockTransition{}
+	for _, t := range history.Transitions() {
+		if (cause != "" && t.Cause != cause) || (peer != "" && t.Peer != peer) ||
+			(requestID != "" && t.RequestID != requestID) || (at != nil && !t.reached(*at)) {
+			continue
+		}
+		transitions = append(transitions, t)
+		if len(transitions) == limit {
+			break
+		}
+	}
+
+	now := s.clock.Now()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"current_timestamp": now.Timestamp,
+		"epoch":             now.Epoch,
+		"recorded":          history.Total(),
+		"capacity":          len(history.entries),
+		"transitions":       transitions,
+	})
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClockHistoryRing(t *testing.T) {
+	history := NewClockHistory(3)
+	for i := int64(1); i <= 5; i++ {
+		history.record(ClockTransition{To: ClockTime{Timestamp: i}, Cause: causeTick})
+	}
+
+	got := history.Transitions()
+	if len(got) != 3 || history.Total() != 5 {
+		t.Fatalf("Expected 3 of 5 transitions kept, got %d of %d", len(got), history.Total())
+	}
+	for i, want := range []int64{5, 4, 3} {
+		if got[i].To.Timestamp != want || got[i].Seq != uint64(want) {
+			t.Errorf("Expected transition %d to reach %d, got %+v", i, want, got[i])
+		}
+	}
+
+	var disabled *ClockHistory
+	disabled.record(ClockTransition{}) // must not panic
+}
+
+func TestClockHistoryCauses(t *testing.T) {
+	server := NewServer()
+	server.clock.SetJumpGuard(JumpGuard{MaxJump: 10, Policy: JumpClamp})
+
+	server.logEvent("e1", "local") // 1
+	req := httptest.NewRequest(http.MethodPost, "/message?timestamp=1000&message=hi&sender=node-b", nil)
+	req = req.WithContext(contextWithRequestID(req.Context(), "req-7"))
+	server.handleReceiveMessage(httptest.NewRecorder(), req) // clamped to 11, then 12
+	server.clock.UpdateTime(ClockTime{Timestamp: 5})         // 13, no source
+	server.clock.Set(100, false)
+
+	got := server.clock.history.Transitions()
+	if len(got) != 4 {
+		t.Fatalf("Expected 4 transitions, got %+v", got)
+	}
+	if got[0].Cause != causeAdminSet || got[0].From.Timestamp != 13 || got[0].To.Timestamp != 100 {
+		t.Errorf("Expected the admin set from 13 to 100 first, got %+v", got[0])
+	}
+	update := got[2]
+	if update.Cause != causeUpdate || update.Peer != "node-b" || update.RequestID != "req-7" {
+		t.Errorf("Expected the update from node-b in req-7, got %+v", update)
+	}
+	if update.Received.Timestamp != 1000 || !update.Clamped || update.To.Timestamp != 12 {
+		t.Errorf("Expected the clamped jump to 12 for 1000, got %+v", update)
+	}
+	if got[3].Cause != causeTick || got[3].From.Timestamp != 0 || got[3].To.Timestamp != 1 {
+		t.Errorf("Expected the first tick from 0 to 1, got %+v", got[3])
+	}
+
+	// Merges that leave the clock alone are not transitions
+	server.clock.ObserveChecked(ClockTime{Timestamp: 50})
+	if server.clock.history.Total() != 4 {
+		t.Errorf("Expected an observe behind the clock not to be recorded, got %d", server.clock.history.Total())
+	}
+}
+
+func TestHandleClockHistory(t *testing.T) {
+	server := NewServer()
+	server.logEvent("e1", "first")                                                 // 1
+	server.clock.updateFrom(ClockTime{Timestamp: 40}, ClockSource{Peer: "node-c"}) // 41
+	server.logEvent("e2", "second")                                                // 42
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.handleClockHistory(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	w := get("/clock/history?at=30")
+	var body struct {
+		Current     int64             `json:"current_timestamp"`
+		Recorded    uint64            `json:"recorded"`
+		Capacity    int               `json:"capacity"`
+		Transitions []ClockTransition `json:"transitions"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	if body.Current != 42 || body.Recorded != 3 || body.Capacity != defaultClockHistory {
+		t.Errorf("Expected 3 transitions recorded at 42, got %+v", body)
+	}
+	if len(body.Transitions) != 1 || body.Transitions[0].Peer != "node-c" || body.Transitions[0].To.Timestamp != 41 {
+		t.Errorf("Expected the jump from node-c to explain 30, got %+v", body.Transitions)
+	}
+
+	json.NewDecoder(get("/clock/history?cause=tick&limit=1").Body).Decode(&body)
+	if len(body.Transitions) != 1 || body.Transitions[0].To.Timestamp != 42 {
+		t.Errorf("Expected only the newest tick, got %+v", body.Transitions)
+	}
+
+	for _, target := range []string{"/clock/history?at=x", "/clock/history?at=1&epoch=-1", "/clock/history?limit=0"} {
+		if w := get(target); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status Bad Request, got %d", target, w.Code)
+		}
+	}
+
+	server.clock.history = nil
+	if w := get("/clock/history"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status Not Found without a history, got %d", w.Code)
+	}
+}
+
+func TestClockHistoryAllocations(t *testing.T) {
+	clock := NewLamportClock()
+	clock.history = NewClockHistory(16)
+	if n := testing.AllocsPerRun(100, func() { clock.TickTime() }); n != 0 {
+		t.Errorf("Expected Tick not to allocate with a history, got %v allocations", n)
+	}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxVirtualClocks bounds how many named clocks clients can create
+const maxVirtualClocks = 1000
+
+var clockNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+var (
+	// ErrTooManyClocks is returned when the virtual clock limit is reached
+	ErrTooManyClocks = errors.New("too many virtual clocks")
+	// ErrEventQuota is returned when a registry holds its maximum of events
+	ErrEventQuota = errors.New("event quota exceeded")
+)
+
+// ClockLimits bound what a registry holds. MaxEvents counts the events of
+// all its clocks; events older than Retention are dropped. Zero values mean
+// unlimited, except MaxClocks which defaults to maxVirtualClocks.
+type ClockLimits struct {
+	MaxClocks int
+	MaxEvents int
+	Retention time.Duration
+}
+
+// VirtualClock is a named logical process hosted by the server, with its
+// own Lamport clock and event log
+type VirtualClock struct {
+	Name     string
+	clock    *LamportClock
+	events   []Event
+	registry *ClockRegistry
+	mutex    sync.RWMutex
+}
+
+// Tick records a local event. When the event quota is used up the clock is
+// left untouched.
+func (vc *VirtualClock) Tick(event Event) (Event, error) {
+	if err := vc.registry.reserve(); err != nil {
+		return Event{}, err
+	}
+	return vc.record(event, vc.clock.TickTime()), nil
+}
+
+// Receive merges a received time through the jump guard and records the
+// event; the ID is derived from the resulting time
+func (vc *VirtualClock) Receive(event Event, received ClockTime) (Event, error) {
+	if err := vc.registry.reserve(); err != nil {
+		return Event{}, err
+	}
+	now, err := vc.clock.UpdateChecked(received)
+	if err != nil {
+		vc.registry.release(1)
+		return Event{}, err
+	}
+	event.ID = vc.Name + "-" + messageID(now)
+	return vc.record(event, now), nil
+}
+
+// record stamps an event with now and appends it to the clock's log
+func (vc *VirtualClock) record(event Event, now ClockTime) Event {
+	event.Timestamp = now.Timestamp
+	event.Epoch = now.Epoch
+
+	vc.mutex.Lock()
+	event.WallTime = time.Now()
+	vc.events = append(vc.events, event)
+	vc.pruneLocked(event.WallTime)
+	vc.mutex.Unlock()
+
+	vc.registry.recorded()
+	return event
+}
+
+// Events returns a copy of the clock's event log
+func (vc *VirtualClock) Events() []Event {
+	vc.mutex.Lock()
+	defer vc.mutex.Unlock()
+	vc.pruneLocked(time.Now())
+	events := make([]Event, len(vc.events))
+	copy(events, vc.events)
+	return events
+}
+
+// pruneLocked drops events that have outlived the retention period. Events
+// are appended in wall time order, so expired ones form a prefix.
+func (vc *VirtualClock) pruneLocked(now time.Time) {
+	retention := vc.registry.limits.Retention
+	if retention <= 0 {
+		return
+	}
+	cutoff := now.Add(-retention)
+	n := sort.Search(len(vc.events), func(i int) bool { return vc.events[i].WallTime.After(cutoff) })
+	if n == 0 {
+		return
+	}
+	vc.events = append([]Event(nil), vc.events[n:]...)
+	vc.registry.release(n)
+}
+
+// ClockRegistry holds a set of virtual clocks, created on first use
+type ClockRegistry struct {
+	clocks map[string]*VirtualClock
+	guard  func() JumpGuard
+	limits ClockLimits
+	stored int
+
+	// tenant and metrics label per tenant series; both are unset for the
+	// default registry
+	tenant  string
+	metrics *Metrics
+
+	mutex sync.RWMutex
+}
+
+// NewClockRegistry creates a registry; new clocks get the jump guard
+// returned by guard
+func NewClockRegistry(guard func() JumpGuard, limits ClockLimits) *ClockRegistry {
+	if limits.MaxClocks <= 0 {
+		limits.MaxClocks = maxVirtualClocks
+	}
+	return &ClockRegistry{clocks: make(map[string]*VirtualClock), guard: guard, limits: limits}
+}
+
+// Get returns the named clock, creating it when create is set
+func (r *ClockRegistry) Get(name string, create bool) (*VirtualClock, error) {
+	r.mutex.RLock()
+	vc, ok := r.clocks[name]
+	r.mutex.RUnlock()
+	if ok || !create {
+		return vc, nil
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if vc, ok := r.clocks[name]; ok {
+		return vc, nil
+	}
+	if len(r.clocks) >= r.limits.MaxClocks {
+		return nil, ErrTooManyClocks
+	}
+	vc = &VirtualClock{Name: name, clock: NewLamportClock(), registry: r}
+	vc.clock.SetJumpGuard(r.guard())
+	r.clocks[name] = vc
+	return vc, nil
+}
+
+// Delete removes the named clock and reports whether it existed
+func (r *ClockRegistry) Delete(name string) bool {
+	r.mutex.Lock()
+	vc, ok := r.clocks[name]
+	delete(r.clocks, name)
+	r.mutex.Unlock()
+
+	if ok {
+		vc.mutex.RLock()
+		n := len(vc.events)
+		vc.mutex.RUnlock()
+		r.release(n)
+	}
+	return ok
+}
+
+// List returns the clocks ordered by name
+func (r *ClockRegistry) List() []*VirtualClock {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	clocks := make([]*VirtualClock, 0, len(r.clocks))
+	for _, vc := range r.clocks {
+		clocks = append(clocks, vc)
+	}
+	sort.Slice(clocks, func(i, j int) bool { return clocks[i].Name < clocks[j].Name })
+	return clocks
+}
+
+// Stored returns the number of events held by all clocks
+func (r *ClockRegistry) Stored() int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.stored
+}
+
+// Prune applies the retention period to every clock
+func (r *ClockRegistry) Prune(now time.Time) {
+	for _, vc := range r.List() {
+		vc.mutex.Lock()
+		vc.pruneLocked(now)
+		vc.mutex.Unlock()
+	}
+}
+
+// reserve claims room for one event
+func (r *ClockRegistry) reserve() error {
+	r.mutex.Lock()
+	if r.limits.MaxEvents > 0 && r.stored >= r.limits.MaxEvents {
+		r.mutex.Unlock()
+		if r.metrics != nil {
+			r.metrics.Inc("lamport_tenant_quota_rejected_total", "tenant", r.tenant)
+		}
+		return ErrEventQuota
+	}
+	r.stored++
+	r.mutex.Unlock()
+	r.report()
+	return nil
+}
+
+// release gives back room for n events
+func (r *ClockRegistry) release(n int) {
+	r.mutex.Lock()
+	r.stored -= n
+	r.mutex.Unlock()
+	r.report()
+}
+
+func (r *ClockRegistry) recorded() {
+	if r.metrics != nil {
+		r.metrics.Inc("lamport_tenant_events_total", "tenant", r.tenant)
+	}
+}
+
+func (r *ClockRegistry) report() {
+	if r.metrics != nil {
+		r.metrics.Set("lamport_tenant_events_stored", float64(r.Stored()), "tenant", r.tenant)
+	}
+}
+
+func (s *Server) handleListClocks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	registry, ok := s.clockRegistry(w, r)
+	if !ok {
+		return
+	}
+
+	clocks := []map[string]interface{}{}
+	for _, vc := range registry.List() {
+		now := vc.clock.Now()
+		clocks = append(clocks, map[string]interface{}{
+			"name":              vc.Name,
+			"lamport_timestamp": now.Timestamp,
+			"epoch":             now.Epoch,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"clocks": clocks,
+		"count":  len(clocks),
+	})
+}
+
+// handleClock serves /clocks/<name>/<action>. Clocks are created by the
+// first tick or message; reads of unknown clocks return 404.
+func (s *Server) handleClock(w http.ResponseWriter, r *http.Request) {
+	registry, ok := s.clockRegistry(w, r)
+	if !ok {
+		return
+	}
+
+	name, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/clocks/"), "/")
+	if !clockNamePattern.MatchString(name) {
+		http.Error(w, "Invalid clock name", http.StatusBadRequest)
+		return
+	}
+
+	method := http.MethodGet
+	switch action {
+	case "tick", "message":
+		method = http.MethodPost
+	case "":
+		method = http.MethodDelete
+	case "time", "events":
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != method {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if method == http.MethodDelete {
+		if !registry.Delete(name) {
+			http.Error(w, "Clock not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	vc, err := registry.Get(name, method == http.MethodPost)
+	if errors.Is(err, ErrTooManyClocks) {
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+		return
+	}
+	if vc == nil {
+		http.Error(w, "Clock not found", http.StatusNotFound)
+		return
+	}
+
+	var response interface{}
+	switch action {
+	case "tick":
+		message := r.URL.Query().Get("message")
+		if message == "" {
+			message = "Local event"
+		}
+		response, err = vc.Tick(Event{
+			ID:        fmt.Sprintf("%s-event-%d", name, time.Now().UnixNano()),
+			Message:   message,
+			RequestID: requestIDFrom(r.Context()),
+		})
+
+	case "message":
+		received, message, perr := parseMessageParams(r, vc.clock.Now().Epoch)
+		if perr != nil {
+			http.Error(w, perr.Error(), http.StatusBadRequest)
+			return
+		}
+		sender := r.URL.Query().Get("sender")
+		if s.split.Cut([]string{sender}, []string{name}) {
+			s.metrics.Inc("lamport_partition_dropped_total", "direction", "inbound")
+			http.Error(w, fmt.Sprintf("Partitioned from %s", sender), http.StatusServiceUnavailable)
+			return
+		}
+		response, err = vc.Receive(Event{
+			Message:   fmt.Sprintf("Processed: %s", message),
+			RequestID: requestIDFrom(r.Context()),
+			Sender:    sender,
+			SentAt:    &received,
+		}, received)
+
+	case "time":
+		now := vc.clock.Now()
+		response = map[string]interface{}{
+			"name":              name,
+			"lamport_timestamp": now.Timestamp,
+			"epoch":             now.Epoch,
+		}
+
+	case "events":
+		events := vc.Events()
+		now := vc.clock.Now()
+		response = map[string]interface{}{
+			"name":              name,
+			"current_timestamp": now.Timestamp,
+			"epoch":             now.Epoch,
+			"events":            events,
+			"event_count":       len(events),
+		}
+	}
+
+	switch {
+	case errors.Is(err, ErrJumpTooLarge):
+		http.Error(w, "Timestamp jump exceeds max_jump", http.StatusUnprocessableEntity)
+		return
+	case errors.Is(err, ErrEventQuota):
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func clockRequest(server *Server, method, target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	w := httptest.NewRecorder()
+	server.handleClock(w, req)
+	return w
+}
+
+func TestVirtualClocksAreIsolated(t *testing.T) {
+	server := NewServer()
+
+	clockRequest(server, http.MethodPost, "/clocks/p1/tick?message=Start")
+	clockRequest(server, http.MethodPost, "/clocks/p1/tick")
+	w := clockRequest(server, http.MethodPost, "/clocks/p2/message?timestamp=2&message=From+p1&sender=p1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var event Event
+	json.NewDecoder(w.Body).Decode(&event)
+	if event.Timestamp != 3 || event.ID != "p2-msg-3" || event.Sender != "p1" {
+		t.Errorf("Unexpected event on p2: %+v", event)
+	}
+
+	// The main clock and log are untouched
+	if server.clock.GetTime() != 0 || server.events.Len() != 0 {
+		t.Errorf("Expected main clock untouched, got %d with %d events", server.clock.GetTime(), server.events.Len())
+	}
+
+	w = clockRequest(server, http.MethodGet, "/clocks/p1/events")
+	var log struct {
+		CurrentTimestamp int64   `json:"current_timestamp"`
+		Events           []Event `json:"events"`
+	}
+	json.NewDecoder(w.Body).Decode(&log)
+	if log.CurrentTimestamp != 2 || len(log.Events) != 2 || log.Events[0].Message != "Start" {
+		t.Errorf("Unexpected p1 log: %+v", log)
+	}
+
+	w = clockRequest(server, http.MethodGet, "/clocks/p2/time")
+	var now map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&now)
+	if now["lamport_timestamp"] != float64(3) {
+		t.Errorf("Expected p2 at 3, got %v", now["lamport_timestamp"])
+	}
+}
+
+func TestVirtualClockRequests(t *testing.T) {
+	server := NewServer()
+	clockRequest(server, http.MethodPost, "/clocks/p1/tick")
+
+	cases := []struct {
+		method, target string
+		expected       int
+	}{
+		{http.MethodGet, "/clocks/missing/time", http.StatusNotFound},
+		{http.MethodGet, "/clocks/p1/tick", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/clocks/p1/time", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/clocks/p1/unknown", http.StatusNotFound},
+		{http.MethodPost, "/clocks/bad%20name/tick", http.StatusBadRequest},
+		{http.MethodPost, "/clocks/p1/message?message=x", http.StatusBadRequest},
+		{http.MethodDelete, "/clocks/p1", http.StatusNoContent},
+		{http.MethodDelete, "/clocks/p1", http.StatusNotFound},
+	}
+	for _, c := range cases {
+		if w := clockRequest(server, c.method, c.target); w.Code != c.expected {
+			t.Errorf("%s %s: expected %d, got %d", c.method, c.target, c.expected, w.Code)
+		}
+	}
+}
+
+func TestVirtualClocksFollowJumpGuard(t *testing.T) {
+	server := NewServer()
+	server.clock.SetJumpGuard(JumpGuard{MaxJump: 10, Policy: JumpReject, OnViolation: server.recordJumpViolation})
+
+	w := clockRequest(server, http.MethodPost, "/clocks/p1/message?timestamp=1000&message=Poison")
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", w.Code)
+	}
+	if got := server.metrics.Value("lamport_rejected_updates_total"); got != 1 {
+		t.Errorf("Expected 1 rejected update, got %v", got)
+	}
+}
+
+func TestListClocks(t *testing.T) {
+	server := NewServer()
+	clockRequest(server, http.MethodPost, "/clocks/b/tick")
+	clockRequest(server, http.MethodPost, "/clocks/a/tick")
+
+	req := httptest.NewRequest(http.MethodGet, "/clocks", nil)
+	w := httptest.NewRecorder()
+	server.handleListClocks(w, req)
+
+	var response struct {
+		Clocks []struct {
+			Name string `json:"name"`
+		} `json:"clocks"`
+		Count int `json:"count"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.Count != 2 || response.Clocks[0].Name != "a" || response.Clocks[1].Name != "b" {
+		t.Errorf("Unexpected clock list: %+v", response)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"connectrpc.com/connect"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/clockctx/clockgrpc"
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec/lamportpb"
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec/lamportpb/lamportpbconnect"
+)
+
+// maxRPCMessage bounds the request messages of the Clock service
+const maxRPCMessage = 4 << 20
+
+// ClockService serves the Clock service of clock.proto to Connect, gRPC
+// and gRPC-Web clients
+type ClockService struct {
+	server *Server
+}
+
+// registerClockService serves the methods of the Clock service at their
+// full names, behind the checks of the endpoints they mirror: Tick is
+// rate limited and queued as POST /event, Update also needs a peer as
+// POST /message, and StreamEvents streams as GET /events/stream. Calls
+// carry their time as the clockgrpc interceptors do, in the
+// lamport-timestamp metadata, which is the Lamport-Timestamp header and
+// so merged like that of any request, for peers only.
+func (s *Server) registerClockService() {
+	s.metrics.Counter("lamport_rpc_requests_total", "Calls of the Clock service by method, protocol and code")
+	_, handler := lamportpbconnect.NewClockHandler(&ClockService{server: s},
+		connect.WithInterceptors(rpcMetrics{s}, clockgrpc.ConnectInterceptor(serviceClock{s.clock})),
+		connect.WithReadMaxBytes(maxRPCMessage),
+	)
+	s.HandleFunc(lamportpbconnect.ClockTickProcedure, s.limit(s.admit(handler.ServeHTTP)))
+	s.HandleFunc(lamportpbconnect.ClockUpdateProcedure, s.limit(s.admit(s.fromPeer(handler.ServeHTTP))))
+	s.Handle(lamportpbconnect.ClockStreamEventsProcedure, handler)
+}
+
+// Tick records a local event, as POST /event
+func (cs *ClockService) Tick(ctx context.Context, req *connect.Request[lamportpb.NewEvent]) (*connect.Response[lamportpb.Event], error) {
+	in := req.Msg
+	event, err := cs.server.createEvent(ctx, Event{
+		Message:       in.GetMessage(),
+		Type:          in.GetType(),
+		SchemaVersion: int(in.GetSchemaVersion()),
+		Payload:       in.GetPayload(),
+		Metadata:      in.GetMetadata(),
+	})
+	switch {
+	case errors.Is(err, ErrInvalidPayload):
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	case err != nil:
+		return nil, connect.NewError(connect.CodeUnavailable, err)
+	}
+	return connect.NewResponse(lamportpb.FromEvent(event.wire())), nil
+}
+
+// Update records a message received from another node, as POST /message.
+// A request without an epoch is in the current one.
+func (cs *ClockService) Update(ctx context.Context, req *connect.Request[lamportpb.UpdateRequest]) (*connect.Response[lamportpb.Event], error) {
+	s, in := cs.server, req.Msg
+	if in.GetMessage() == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("missing message"))
+	}
+	if in.GetLamportTimestamp() > math.MaxInt64 || in.GetEpoch() > math.MaxInt64 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("timestamp out of range"))
+	}
+	received := ClockTime{Epoch: int64(in.GetEpoch()), Timestamp: int64(in.GetLamportTimestamp())}
+	if in.Epoch == nil {
+		received.Epoch = s.clock.Now().Epoch
+	}
+
+	ctx, err := s.checkSignature(ctx, "receive", in.GetKeyId(), in.GetSignature(), in.GetId(), received, in.GetMessage())
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+	event, err := s.receiveMessage(ctx, in.GetSender(), in.GetId(), received, in.GetMessage())
+	switch {
+	case errors.Is(err, ErrDuplicateMessage) && event.ID == "":
+		return nil, connect.NewError(connect.CodeAborted, errors.New("duplicate message still being processed"))
+	case errors.Is(err, ErrDuplicateMessage):
+		// Answered like the first copy, so retries are idempotent
+		s.metrics.Inc("lamport_duplicate_messages_total", "transport", req.Peer().Protocol)
+	case errors.Is(err, ErrJumpTooLarge):
+		return nil, connect.NewError(connect.CodeOutOfRange, errors.New("timestamp jump exceeds max_jump"))
+	case err != nil:
+		return nil, connect.NewError(connect.CodeUnavailable, err)
+	}
+	return connect.NewResponse(lamportpb.FromEvent(event.wire())), nil
+}
+
+// StreamEvents sends new events matching a filter until the call ends, as
+// GET /events/stream
+func (cs *ClockService) StreamEvents(ctx context.Context, req *connect.Request[lamportpb.StreamEventsRequest], stream *connect.ServerStream[lamportpb.Event]) error {
+	s, in := cs.server, req.Msg
+	if in.GetMinTimestamp() > math.MaxInt64 {
+		return connect.NewError(connect.CodeInvalidArgument, errors.New("min_timestamp out of range"))
+	}
+	sub := s.broker.Subscribe(EventFilter{
+		MessageContains: in.GetContains(),
+		IDPrefix:        in.GetIdPrefix(),
+		MinTimestamp:    int64(in.GetMinTimestamp()),
+		Metadata:        in.GetMetadata(),
+	})
+	defer s.broker.Unsubscribe(sub)
+
+	// Sending no message sends the headers, which tell clients the
+	// subscription is in place
+	if err := stream.Send(nil); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.broker.Done():
+			return nil
+		case event, ok := <-sub.Events:
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(lamportpb.FromEvent(event.wire())); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// serviceClock is the clock of a server as the clockgrpc interceptor of
+// the Clock service sees it. The metadata of peers was merged with the
+// Lamport-Timestamp header and that of other callers is ignored, and the
+// reply carries the time of the clock without counting an event for it,
+// so both sides of a call only read the clock.
+type serviceClock struct {
+	clock *LamportClock
+}
+
+func (c serviceClock) Tick() int64 { return c.clock.Now().Timestamp }
+
+func (c serviceClock) Update(int64) int64 { return c.clock.Now().Timestamp }
+
+// rpcMetrics counts the calls of the Clock service by method, protocol and
+// code
+type rpcMetrics struct {
+	s *Server
+}
+
+func (m rpcMetrics) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		resp, err := next(ctx, req)
+		m.count(req.Spec().Procedure, req.Peer().Protocol, err)
+		return resp, err
+	}
+}
+
+func (m rpcMetrics) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (m rpcMetrics) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		err := next(ctx, conn)
+		m.count(conn.Spec().Procedure, conn.Peer().Protocol, err)
+		return err
+	}
+}
+
+func (m rpcMetrics) count(method, protocol string, err error) {
+	code := "ok"
+	if err != nil {
+		code = connect.CodeOf(err).String()
+	}
+	m.s.metrics.Inc("lamport_rpc_requests_total", "method", method, "protocol", protocol, "code", code)
+}
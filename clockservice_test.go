@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/clockctx/clockgrpc"
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec/lamportpb"
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec/lamportpb/lamportpbconnect"
+)
+
+// serveClock serves server over HTTP/1.1 and HTTP/2 without TLS, as the
+// HTTP port does
+func serveClock(t *testing.T, server *Server) *httptest.Server {
+	ts := httptest.NewUnstartedServer(server)
+	ts.Config.Protocols = new(http.Protocols)
+	ts.Config.Protocols.SetHTTP1(true)
+	ts.Config.Protocols.SetUnencryptedHTTP2(true)
+	ts.Start()
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// dialClock connects a gRPC client keeping clock to a server started by
+// serveClock
+func dialClock(t *testing.T, ts *httptest.Server, clock *LamportClock) *grpc.ClientConn {
+	conn, err := grpc.NewClient(ts.Listener.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(clockgrpc.UnaryClientInterceptor(clock)),
+		grpc.WithChainStreamInterceptor(clockgrpc.StreamClientInterceptor(clock)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// withHeader returns a request for msg carrying headers, given as pairs of
+// keys and values
+func withHeader[T any](msg *T, pairs ...string) *connect.Request[T] {
+	req := connect.NewRequest(msg)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		req.Header().Set(pairs[i], pairs[i+1])
+	}
+	return req
+}
+
+func TestClockServiceGRPC(t *testing.T) {
+	server := NewServer(WithNodeID("node-a"))
+	server.clock.Update(20)
+	client := NewLamportClock()
+	conn := dialClock(t, serveClock(t, server), client)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The call stamped 1 is behind the server, which counts the event
+	// alone and answers with its time
+	var event lamportpb.Event
+	if err := conn.Invoke(ctx, lamportpbconnect.ClockTickProcedure, &lamportpb.NewEvent{Message: "Native"}, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.GetMessage() != "Native" || event.GetLamportTimestamp() != 22 || event.GetNode() != "node-a" {
+		t.Errorf("Expected the event at 22, got %v", &event)
+	}
+	if got := server.clock.GetTime(); got != 22 {
+		t.Errorf("Expected the server at 22, got %d", got)
+	}
+	if got := client.GetTime(); got != 23 {
+		t.Errorf("Expected the client past the reply at 22, got %d", got)
+	}
+
+	err := conn.Invoke(ctx, lamportpbconnect.ClockUpdateProcedure, &lamportpb.Event{LamportTimestamp: 5}, &event)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument without a message, got %v", err)
+	}
+
+	desc := &grpc.StreamDesc{ServerStreams: true}
+	stream, err := conn.NewStream(ctx, desc, lamportpbconnect.ClockStreamEventsProcedure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.SendMsg(&lamportpb.StreamEventsRequest{Metadata: map[string]string{"service": "orders"}}); err != nil {
+		t.Fatal(err)
+	}
+	stream.CloseSend()
+	if _, err := stream.Header(); err != nil {
+		t.Fatal(err)
+	}
+	server.logEvent("e1", "No metadata")
+	server.recordLocal(Event{ID: "e2", Message: "Order placed", Metadata: map[string]string{"service": "orders"}})
+	if err := stream.RecvMsg(&event); err != nil || event.GetId() != "e2" {
+		t.Errorf("Expected e2 on the stream, got %v %v", &event, err)
+	}
+}
+
+func TestClockServiceConnect(t *testing.T) {
+	server := NewServer(WithNodeID("node-a"))
+	ts := serveClock(t, server)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for name, client := range map[string]lamportpbconnect.ClockClient{
+		"connect": lamportpbconnect.NewClockClient(ts.Client(), ts.URL, connect.WithProtoJSON()),
+		"grpcweb": lamportpbconnect.NewClockClient(ts.Client(), ts.URL, connect.WithGRPCWeb()),
+	} {
+		before := server.clock.GetTime()
+		resp, err := client.Tick(ctx, connect.NewRequest(&lamportpb.NewEvent{Message: "From " + name, Metadata: map[string]string{"service": "auth"}}))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got := resp.Msg.GetLamportTimestamp(); got != uint64(before+1) || resp.Msg.GetMessage() != "From "+name {
+			t.Errorf("%s: expected the event at %d, got %v", name, before+1, resp.Msg)
+		}
+		if got := resp.Trailer().Get(headerTimestamp); got != strconv.FormatInt(before+1, 10) {
+			t.Errorf("%s: expected the time of the clock in the trailer, got %q", name, got)
+		}
+
+		// Update merges the message as POST /message
+		resp, err = client.Update(ctx, connect.NewRequest(&lamportpb.UpdateRequest{Message: "From b", LamportTimestamp: 100, Sender: "node-b", Id: "b-" + name}))
+		if err != nil || resp.Msg.GetLamportTimestamp() != uint64(max(before+1, 100)+1) {
+			t.Errorf("%s: expected the message merged, got %v %v", name, resp, err)
+		}
+		_, err = client.Update(ctx, connect.NewRequest(&lamportpb.UpdateRequest{LamportTimestamp: 5}))
+		if connect.CodeOf(err) != connect.CodeInvalidArgument {
+			t.Errorf("%s: expected invalid_argument without a message, got %v", name, err)
+		}
+	}
+
+	// Every protocol runs the same interceptors
+	for _, protocol := range []string{connect.ProtocolConnect, connect.ProtocolGRPCWeb} {
+		for _, labels := range [][]string{
+			{"method", lamportpbconnect.ClockTickProcedure, "protocol", protocol, "code", "ok"},
+			{"method", lamportpbconnect.ClockUpdateProcedure, "protocol", protocol, "code", "invalid_argument"},
+		} {
+			if got := server.metrics.Value("lamport_rpc_requests_total", labels...); got != 1 {
+				t.Errorf("Expected a call counted with %v, got %v", labels, got)
+			}
+		}
+	}
+}
+
+func TestClockServiceUpdateEpoch(t *testing.T) {
+	server := NewServer()
+	server.clock.observe(ClockTime{Epoch: 1, Timestamp: 3})
+	ts := serveClock(t, server)
+	client := lamportpbconnect.NewClockClient(ts.Client(), ts.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Epoch 0 is the first epoch, older than the clock's, so the message
+	// only counts as an event
+	resp, err := client.Update(ctx, connect.NewRequest(&lamportpb.UpdateRequest{Message: "Old", LamportTimestamp: 100, Epoch: proto.Uint64(0)}))
+	if err != nil || resp.Msg.GetEpoch() != 1 || resp.Msg.GetLamportTimestamp() != 4 {
+		t.Errorf("Expected the message of epoch 0 received at 1:4, got %v %v", resp, err)
+	}
+	// Without an epoch the message is in the current one
+	resp, err = client.Update(ctx, connect.NewRequest(&lamportpb.UpdateRequest{Message: "Current", LamportTimestamp: 100}))
+	if err != nil || resp.Msg.GetEpoch() != 1 || resp.Msg.GetLamportTimestamp() != 101 {
+		t.Errorf("Expected the message merged at 1:101, got %v %v", resp, err)
+	}
+}
+
+func TestClockServiceStream(t *testing.T) {
+	server := NewServer()
+	ts := serveClock(t, server)
+	client := lamportpbconnect.NewClockClient(ts.Client(), ts.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	stream, err := client.StreamEvents(ctx, connect.NewRequest(&lamportpb.StreamEventsRequest{IdPrefix: "order-"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	// The headers arrive once subscribed
+	server.logEvent("other-1", "skipped")
+	server.logEvent("order-1", "shipped")
+	if !stream.Receive() || stream.Msg().GetId() != "order-1" {
+		t.Fatalf("Expected order-1, got %v %v", stream.Msg(), stream.Err())
+	}
+
+	// The stream ends at the deadline of the call, with the trailer
+	if stream.Receive() {
+		t.Fatalf("Expected the stream to end, got %v", stream.Msg())
+	}
+	if connect.CodeOf(stream.Err()) != connect.CodeDeadlineExceeded {
+		t.Errorf("Expected deadline_exceeded, got %v", stream.Err())
+	}
+}
+
+func TestClockServiceClockGuard(t *testing.T) {
+	server := NewServer()
+	server.clock.SetJumpGuard(JumpGuard{MaxJump: 100, Policy: JumpReject})
+	ts := serveClock(t, server)
+	client := lamportpbconnect.NewClockClient(ts.Client(), ts.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The metadata goes through the jump guard like the header of a request
+	_, err := client.Tick(ctx, withHeader(&lamportpb.NewEvent{}, headerTimestamp, "4611686018427387904"))
+	if err == nil || server.clock.GetTime() != 0 {
+		t.Errorf("Expected the jump refused, got %v at %d", err, server.clock.GetTime())
+	}
+	resp, err := client.Tick(ctx, withHeader(&lamportpb.NewEvent{}, headerTimestamp, "50"))
+	if err != nil || resp.Msg.GetLamportTimestamp() != 51 {
+		t.Errorf("Expected the event after the metadata at 51, got %v %v", resp, err)
+	}
+}
+
+func TestClockServiceAccess(t *testing.T) {
+	server := NewServer()
+	server.access, _ = NewAccessControl([]RoleConfig{
+		{Name: "dashboard", APIKeys: []string{"read-key"}, Roles: []string{"reader"}},
+		{Name: "app", APIKeys: []string{"write-key"}, Roles: []string{"writer"}},
+		{Name: "node-b", APIKeys: []string{"peer-key"}, Roles: []string{"peer"}},
+	}, nil, nil)
+	ts := serveClock(t, server)
+	client := lamportpbconnect.NewClockClient(ts.Client(), ts.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := client.Tick(ctx, withHeader(&lamportpb.NewEvent{}, "X-API-Key", "read-key"))
+	if connect.CodeOf(err) != connect.CodePermissionDenied {
+		t.Errorf("Expected readers refused ticks, got %v", err)
+	}
+
+	// Writers tick, but their metadata does not move the clock
+	resp, err := client.Tick(ctx, withHeader(&lamportpb.NewEvent{}, "X-API-Key", "write-key", headerTimestamp, "40"))
+	if err != nil || resp.Msg.GetLamportTimestamp() != 1 {
+		t.Errorf("Expected the metadata of writers ignored, got %v %v", resp, err)
+	}
+
+	// Only peers send messages, as on /message
+	update := &lamportpb.UpdateRequest{Message: "From b", LamportTimestamp: 10}
+	_, err = client.Update(ctx, withHeader(update, "X-API-Key", "write-key"))
+	if connect.CodeOf(err) != connect.CodePermissionDenied {
+		t.Errorf("Expected writers refused updates, got %v", err)
+	}
+	resp, err = client.Update(ctx, withHeader(update, "X-API-Key", "peer-key"))
+	if err != nil || resp.Msg.GetLamportTimestamp() != 11 {
+		t.Errorf("Expected peers to send messages, got %v %v", resp, err)
+	}
+
+	streamCtx, cancelStream := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancelStream()
+	stream, err := client.StreamEvents(streamCtx, withHeader(&lamportpb.StreamEventsRequest{}, "X-API-Key", "read-key"))
+	if err == nil {
+		for stream.Receive() {
+		}
+		err = stream.Err()
+		stream.Close()
+	}
+	var cerr *connect.Error
+	if !errors.As(err, &cerr) || cerr.Code() != connect.CodeDeadlineExceeded {
+		t.Errorf("Expected readers to stream events until the deadline, got %v", err)
+	}
+
+	// gRPC clients cannot prefix paths, so they are not deprecated
+	if !isUnversioned(lamportpbconnect.ClockTickProcedure) {
+		t.Errorf("Expected the RPC paths unversioned")
+	}
+}
@@ -0,0 +1,243 @@
+// Package clocktest provides a fake Lamport clock for testing code that
+// handles timestamps, without running the server's clock.
+//
+// A Clock behaves like a Lamport clock until told otherwise: it ticks by
+// one and merges received timestamps as max(local, received) + 1. Tests
+// can script the times and orderings it returns next, make its next
+// receives and comparisons fail, and inspect every call made to it.
+//
+// Clock implements the LogicalClock interface of the server and the Clock
+// interface of clockctx. Its stamps are binary codec.Timestamps, the same
+// as the server's LamportClock sends, so the two can exchange them. The
+// fake stays in epoch 0 and ignores the epoch of stamps it receives.
+package clocktest
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec"
+)
+
+// Method names a method of Clock in recorded calls
+type Method string
+
+// Methods of Clock
+const (
+	MethodTick       Method = "Tick"
+	MethodUpdate     Method = "Update"
+	MethodLocalEvent Method = "LocalEvent"
+	MethodSend       Method = "Send"
+	MethodReceive    Method = "Receive"
+	MethodCompare    Method = "Compare"
+)
+
+// Call is a recorded call to a Clock
+type Call struct {
+	Method Method
+	// Received is the timestamp merged by Update and Receive
+	Received int64
+	// Stamps holds the stamp returned by Send, the stamp given to Receive,
+	// or the two stamps given to Compare
+	Stamps [][]byte
+	// Time is the time of the clock after the call
+	Time int64
+	// Ordering is the result of Compare
+	Ordering codec.Ordering
+	// Err is the error the call returned
+	Err error
+}
+
+// Clock is a fake Lamport clock. It is safe for concurrent use.
+type Clock struct {
+	now       int64
+	times     []int64
+	orderings []codec.Ordering
+	failures  map[Method][]error
+	calls     []Call
+	mutex     sync.Mutex
+}
+
+// New creates a fake clock at 0
+func New() *Clock {
+	return &Clock{failures: make(map[Method][]error)}
+}
+
+// Set moves the clock to ts without recording a call
+func (c *Clock) Set(ts int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = ts
+}
+
+// Now returns the time of the clock without recording a call
+func (c *Clock) Now() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// ReturnTimes scripts the times the next calls moving the clock (Tick,
+// Update, LocalEvent, Send and Receive) move it to, one per call, in place
+// of the Lamport rule. They may go backwards, to test how code copes with
+// a clock that misbehaves.
+func (c *Clock) ReturnTimes(times ...int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.times = append(c.times, times...)
+}
+
+// ReturnOrderings scripts the results of the next calls to Compare, one
+// per call
+func (c *Clock) ReturnOrderings(orderings ...codec.Ordering) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.orderings = append(c.orderings, orderings...)
+}
+
+// FailNext makes the next calls to method return errs, one per call.
+// Receive and Compare are the methods that return errors; a failed Receive
+// leaves the clock where it was.
+func (c *Clock) FailNext(method Method, errs ...error) {
+	if method != MethodReceive && method != MethodCompare {
+		panic(fmt.Sprintf("clocktest: %s cannot fail", method))
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.failures[method] = append(c.failures[method], errs...)
+}
+
+// Calls returns the calls made to the clock, oldest first
+func (c *Clock) Calls() []Call {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return slices.Clone(c.calls)
+}
+
+// CallsTo returns the calls made to method, oldest first
+func (c *Clock) CallsTo(method Method) []Call {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var calls []Call
+	for _, call := range c.calls {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Tick records a local event and returns its timestamp
+func (c *Clock) Tick() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.moveLocked(c.now)
+	c.calls = append(c.calls, Call{Method: MethodTick, Time: c.now})
+	return c.now
+}
+
+// Update merges a received timestamp and returns the new time
+func (c *Clock) Update(received int64) int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.moveLocked(received)
+	c.calls = append(c.calls, Call{Method: MethodUpdate, Received: received, Time: c.now})
+	return c.now
+}
+
+// LocalEvent records an internal event
+func (c *Clock) LocalEvent() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.moveLocked(c.now)
+	c.calls = append(c.calls, Call{Method: MethodLocalEvent, Time: c.now})
+}
+
+// Send records a send event and returns its stamp
+func (c *Clock) Send() []byte {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.moveLocked(c.now)
+	stamp := encode(c.now)
+	c.calls = append(c.calls, Call{Method: MethodSend, Stamps: [][]byte{stamp}, Time: c.now})
+	return stamp
+}
+
+// Receive merges the timestamp of a stamp, unless a failure is scripted or
+// the stamp cannot be decoded
+func (c *Clock) Receive(stamp []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	call := Call{Method: MethodReceive, Stamps: [][]byte{slices.Clone(stamp)}}
+	if call.Err = c.failureLocked(MethodReceive); call.Err == nil {
+		var t codec.Timestamp
+		if call.Err = t.UnmarshalBinary(stamp); call.Err == nil {
+			call.Received = t.Timestamp
+			c.moveLocked(t.Timestamp)
+		}
+	}
+	call.Time = c.now
+	c.calls = append(c.calls, call)
+	return call.Err
+}
+
+// Compare orders two stamps by time, unless an ordering or a failure is
+// scripted
+func (c *Clock) Compare(a, b []byte) (codec.Ordering, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	call := Call{Method: MethodCompare, Stamps: [][]byte{slices.Clone(a), slices.Clone(b)}, Time: c.now}
+	if call.Err = c.failureLocked(MethodCompare); call.Err == nil {
+		if len(c.orderings) > 0 {
+			call.Ordering, c.orderings = c.orderings[0], c.orderings[1:]
+		} else {
+			call.Ordering, call.Err = compare(a, b)
+		}
+	}
+	c.calls = append(c.calls, call)
+	return call.Ordering, call.Err
+}
+
+// moveLocked moves the clock to the next scripted time, or past the larger
+// of its time and received
+func (c *Clock) moveLocked(received int64) {
+	if len(c.times) > 0 {
+		c.now, c.times = c.times[0], c.times[1:]
+		return
+	}
+	c.now = max(c.now, received) + 1
+}
+
+func (c *Clock) failureLocked(method Method) error {
+	errs := c.failures[method]
+	if len(errs) == 0 {
+		return nil
+	}
+	c.failures[method] = errs[1:]
+	return errs[0]
+}
+
+func encode(ts int64) []byte {
+	// Encoding a Timestamp cannot fail
+	stamp, _ := codec.Timestamp{Timestamp: ts}.MarshalBinary()
+	return stamp
+}
+
+func compare(a, b []byte) (codec.Ordering, error) {
+	var ta, tb codec.Timestamp
+	if err := ta.UnmarshalBinary(a); err != nil {
+		return "", fmt.Errorf("stamp a: %w", err)
+	}
+	if err := tb.UnmarshalBinary(b); err != nil {
+		return "", fmt.Errorf("stamp b: %w", err)
+	}
+	switch ta.Compare(tb) {
+	case -1:
+		return codec.Before, nil
+	case 1:
+		return codec.After, nil
+	default:
+		return codec.Equal, nil
+	}
+}
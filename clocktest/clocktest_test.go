@@ -0,0 +1,114 @@
+package clocktest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/clockctx"
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec"
+)
+
+var _ clockctx.Clock = (*Clock)(nil)
+
+func TestClockLamportRule(t *testing.T) {
+	c := New()
+	if got := c.Tick(); got != 1 {
+		t.Errorf("Expected the first tick at 1, got %d", got)
+	}
+	if got := c.Update(10); got != 11 {
+		t.Errorf("Expected an update with 10 to give 11, got %d", got)
+	}
+	if got := c.Update(3); got != 12 {
+		t.Errorf("Expected an update with 3 to give 12, got %d", got)
+	}
+
+	other := New()
+	if err := other.Receive(c.Send()); err != nil || other.Now() != 14 {
+		t.Errorf("Expected a receive of 13 to give 14, got %d (err: %v)", other.Now(), err)
+	}
+	if ordering, err := c.Compare(c.Send(), other.Send()); err != nil || ordering != codec.Before {
+		t.Errorf("Expected 14 before 15, got %s (err: %v)", ordering, err)
+	}
+	if _, err := c.Compare([]byte{0x80}, nil); err == nil {
+		t.Error("Expected an error for a truncated stamp")
+	}
+}
+
+func TestClockScripted(t *testing.T) {
+	c := New()
+	c.ReturnTimes(100, 5)
+	c.ReturnOrderings(codec.Concurrent)
+
+	if got := c.Tick(); got != 100 {
+		t.Errorf("Expected the scripted 100, got %d", got)
+	}
+	if got := c.Update(200); got != 5 {
+		t.Errorf("Expected the scripted 5, going backwards, got %d", got)
+	}
+	if got := c.Update(200); got != 201 {
+		t.Errorf("Expected the Lamport rule once the script ran out, got %d", got)
+	}
+	if ordering, _ := c.Compare(nil, nil); ordering != codec.Concurrent {
+		t.Errorf("Expected the scripted ordering, got %s", ordering)
+	}
+
+	// Scripts are used by the clockctx helpers too
+	c.ReturnTimes(42)
+	if _, ts := clockctx.Tick(context.Background(), c); ts != 42 {
+		t.Errorf("Expected clockctx to tick to 42, got %d", ts)
+	}
+}
+
+func TestClockFailures(t *testing.T) {
+	c := New()
+	c.Set(7)
+	errRejected := errors.New("jump too large")
+	c.FailNext(MethodReceive, errRejected)
+	c.FailNext(MethodCompare, errRejected)
+
+	stamp := New().Send()
+	if err := c.Receive(stamp); !errors.Is(err, errRejected) || c.Now() != 7 {
+		t.Errorf("Expected the scripted failure leaving the clock at 7, got %v at %d", err, c.Now())
+	}
+	if err := c.Receive(stamp); err != nil || c.Now() != 8 {
+		t.Errorf("Expected the next receive to succeed, got %v at %d", err, c.Now())
+	}
+	if _, err := c.Compare(stamp, stamp); !errors.Is(err, errRejected) {
+		t.Errorf("Expected the scripted failure, got %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected FailNext to refuse a method without an error")
+		}
+	}()
+	c.FailNext(MethodTick, errRejected)
+}
+
+func TestClockCalls(t *testing.T) {
+	c := New()
+	c.Tick()
+	c.Update(4)
+	c.LocalEvent()
+	stamp := c.Send()
+	c.Receive(stamp)
+	c.Compare(stamp, stamp)
+
+	calls := c.Calls()
+	methods := []Method{MethodTick, MethodUpdate, MethodLocalEvent, MethodSend, MethodReceive, MethodCompare}
+	if len(calls) != len(methods) {
+		t.Fatalf("Expected %d calls, got %+v", len(methods), calls)
+	}
+	for i, m := range methods {
+		if calls[i].Method != m {
+			t.Errorf("Expected call %d to be %s, got %s", i, m, calls[i].Method)
+		}
+	}
+	if calls[1].Received != 4 || calls[1].Time != 5 || calls[4].Received != 7 || calls[5].Ordering != codec.Equal {
+		t.Errorf("Expected the arguments and results recorded, got %+v", calls)
+	}
+	if updates := c.CallsTo(MethodUpdate); len(updates) != 1 || updates[0].Received != 4 {
+		t.Errorf("Expected the update, got %+v", updates)
+	}
+}
@@ -0,0 +1,170 @@
+// Package clocktimer fires callbacks at points of logical time: once a
+// Lamport clock reaches a timestamp, or has advanced by a number of ticks.
+// Algorithms that time out in logical rather than wall time, such as a
+// node giving up on a request after N local events without an answer, use
+// it in place of time.Timer.
+//
+// Timers is a hooks.Hook, so it follows the server's clock once registered
+// on its hooks.Registry. Any other clock drives it by calling Advance with
+// each new time.
+package clocktimer
+
+import (
+	"container/heap"
+	"sync"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec"
+)
+
+// Func is called with the time of the clock when its timer fires
+type Func func(now codec.Timestamp)
+
+// Timers holds the timers of one clock, the next to fire first
+type Timers struct {
+	queue timerHeap
+	now   codec.Timestamp
+	next  uint64
+	mutex sync.Mutex
+}
+
+// Timer is a callback waiting for a logical time
+type Timer struct {
+	at     codec.Timestamp
+	f      Func
+	seq    uint64 // orders timers set for the same time
+	index  int    // position in the heap, -1 once fired or stopped
+	timers *Timers
+}
+
+// New creates a set of timers with the clock at zero
+func New() *Timers {
+	return &Timers{}
+}
+
+// Now returns the latest time the timers were advanced to
+func (t *Timers) Now() codec.Timestamp {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.now
+}
+
+// Len returns the number of timers waiting
+func (t *Timers) Len() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return len(t.queue)
+}
+
+// At sets a timer calling f once the clock reaches at. If it already has,
+// f is called right away, in the calling goroutine.
+func (t *Timers) At(at codec.Timestamp, f Func) *Timer {
+	t.mutex.Lock()
+	t.next++
+	timer := &Timer{at: at, f: f, seq: t.next, index: -1, timers: t}
+	now := t.now
+	if before(at, now) || at == now {
+		t.mutex.Unlock()
+		f(now)
+		return timer
+	}
+	heap.Push(&t.queue, timer)
+	t.mutex.Unlock()
+	return timer
+}
+
+// After sets a timer calling f once the clock has advanced by n ticks from
+// the time the timers were last advanced to
+func (t *Timers) After(n int64, f Func) *Timer {
+	now := t.Now()
+	return t.At(codec.Timestamp{Epoch: now.Epoch, Timestamp: now.Timestamp + n}, f)
+}
+
+// Advance moves the timers to the time of the clock and calls the
+// callbacks of the timers it reached, in the order of their times, outside
+// of any lock. Callbacks may set and stop timers. Times before the latest
+// one are ignored, since clocks do not go back.
+func (t *Timers) Advance(now codec.Timestamp) {
+	t.mutex.Lock()
+	if before(now, t.now) {
+		t.mutex.Unlock()
+		return
+	}
+	t.now = now
+	var due []*Timer
+	for len(t.queue) > 0 && !before(now, t.queue[0].at) {
+		due = append(due, heap.Pop(&t.queue).(*Timer))
+	}
+	t.mutex.Unlock()
+
+	for _, timer := range due {
+		timer.f(now)
+	}
+}
+
+// OnTick and OnUpdate advance the timers with the clock of a hooks.Registry
+func (t *Timers) OnTick(now codec.Timestamp) {
+	t.Advance(now)
+}
+
+func (t *Timers) OnUpdate(received, now codec.Timestamp) {
+	t.Advance(now)
+}
+
+func (t *Timers) OnEvent(codec.Event) {}
+
+// At returns the time the timer fires at
+func (tm *Timer) At() codec.Timestamp {
+	return tm.at
+}
+
+// Stop cancels the timer and reports whether it was still waiting
+func (tm *Timer) Stop() bool {
+	t := tm.timers
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if tm.index < 0 {
+		return false
+	}
+	heap.Remove(&t.queue, tm.index)
+	return true
+}
+
+// before orders times by epoch, then by timestamp
+func before(a, b codec.Timestamp) bool {
+	if a.Epoch != b.Epoch {
+		return a.Epoch < b.Epoch
+	}
+	return a.Timestamp < b.Timestamp
+}
+
+// timerHeap is a priority queue of timers, the next to fire first
+type timerHeap []*Timer
+
+func (h timerHeap) Len() int { return len(h) }
+
+func (h timerHeap) Less(i, j int) bool {
+	if h[i].at != h[j].at {
+		return before(h[i].at, h[j].at)
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h timerHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *timerHeap) Push(x any) {
+	timer := x.(*Timer)
+	timer.index = len(*h)
+	*h = append(*h, timer)
+}
+
+func (h *timerHeap) Pop() any {
+	old := *h
+	timer := old[len(old)-1]
+	old[len(old)-1] = nil
+	timer.index = -1
+	*h = old[:len(old)-1]
+	return timer
+}
@@ -0,0 +1,99 @@
+package clocktimer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec"
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/hooks"
+)
+
+func at(ts int64) codec.Timestamp {
+	return codec.Timestamp{Timestamp: ts}
+}
+
+func TestTimersFireInOrder(t *testing.T) {
+	timers := New()
+	var fired []string
+	record := func(name string) Func {
+		return func(now codec.Timestamp) { fired = append(fired, fmt.Sprintf("%s@%d", name, now.Timestamp)) }
+	}
+	timers.At(at(5), record("c"))
+	timers.At(at(3), record("a"))
+	timers.At(at(3), record("b"))
+	timers.At(codec.Timestamp{Epoch: 1, Timestamp: 1}, record("next-epoch"))
+
+	timers.Advance(at(2))
+	if len(fired) != 0 {
+		t.Fatalf("Expected nothing before 3, got %v", fired)
+	}
+	timers.Advance(at(6))
+	if got := fmt.Sprint(fired); got != "[a@6 b@6 c@6]" {
+		t.Errorf("Expected a, b then c at 6, got %s", got)
+	}
+	// Clocks do not go back
+	timers.Advance(at(1))
+	if timers.Now() != at(6) {
+		t.Errorf("Expected the timers to stay at 6, got %+v", timers.Now())
+	}
+	timers.Advance(codec.Timestamp{Epoch: 1, Timestamp: 1})
+	if timers.Len() != 0 || len(fired) != 4 {
+		t.Errorf("Expected the new epoch to fire the last timer, got %v", fired)
+	}
+}
+
+func TestTimersAfterAndStop(t *testing.T) {
+	timers := New()
+	timers.Advance(at(10))
+
+	fired := 0
+	timeout := timers.After(3, func(codec.Timestamp) { fired++ })
+	if timeout.At() != at(13) {
+		t.Errorf("Expected the timer at 13, got %+v", timeout.At())
+	}
+	if !timeout.Stop() || timeout.Stop() {
+		t.Error("Expected the timer to stop exactly once")
+	}
+	timers.Advance(at(20))
+	if fired != 0 {
+		t.Error("Expected a stopped timer not to fire")
+	}
+
+	past := timers.At(at(15), func(codec.Timestamp) { fired++ })
+	if fired != 1 || past.Stop() {
+		t.Errorf("Expected a timer in the past to fire right away, fired %d", fired)
+	}
+}
+
+func TestTimersCallbacksSetTimers(t *testing.T) {
+	timers := New()
+	var chain []int64
+	var next Func
+	next = func(now codec.Timestamp) {
+		chain = append(chain, now.Timestamp)
+		if len(chain) < 3 {
+			timers.After(2, next)
+		}
+	}
+	timers.After(2, next)
+	for ts := int64(1); ts <= 10; ts++ {
+		timers.Advance(at(ts))
+	}
+	if got := fmt.Sprint(chain); got != "[2 4 6]" {
+		t.Errorf("Expected the timer to rearm itself every 2 ticks, got %s", got)
+	}
+}
+
+func TestTimersAsHook(t *testing.T) {
+	registry := hooks.NewRegistry()
+	timers := New()
+	registry.Register(timers)
+
+	fired := false
+	timers.At(at(4), func(codec.Timestamp) { fired = true })
+	registry.Tick(at(3))
+	registry.Update(at(2), at(4))
+	if !fired {
+		t.Error("Expected the merged timestamp to fire the timer")
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// clusterTimeout bounds how long /cluster/events waits for peers
+const clusterTimeout = 5 * time.Second
+
+// clusterEvents merges the local log with the logs of all peers into one
+// total order. Events are identified by node and ID, so an event returned
+// twice, for instance by a peer listed under two URLs, appears once. The
+// status of each peer is "ok" or the error it failed with.
+func (s *Server) clusterEvents(ctx context.Context) ([]Event, map[string]string) {
+	events := s.events.Events()
+
+	statuses := make(map[string]string)
+	for peer, resp := range s.peers.Gather(ctx, http.MethodGet, "/events", nil, nil) {
+		if resp.Err != nil {
+			statuses[peer] = resp.Err.Error()
+			continue
+		}
+		var log struct {
+			Events []Event `json:"events"`
+		}
+		if err := json.Unmarshal(resp.Body, &log); err != nil {
+			statuses[peer] = "invalid response: " + err.Error()
+			continue
+		}
+		for _, e := range log.Events {
+			// Peers that predate node attribution are named by their URL
+			if e.Node == "" {
+				e.Node = peer
+			}
+			events = append(events, e)
+		}
+		statuses[peer] = "ok"
+	}
+
+	type key struct{ node, id string }
+	seen := make(map[key]bool, len(events))
+	unique := events[:0]
+	for _, e := range events {
+		k := key{e.Node, e.ID}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		unique = append(unique, e)
+	}
+
+	SortEvents(unique, s.ties)
+	return unique, statuses
+}
+
+// handleClusterEvents serves one page of the merged history of the
+// cluster, ?limit= events after ?cursor=. Unreachable peers are reported
+// rather than failing the request.
+func (s *Server) handleClusterEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	page, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), clusterTimeout)
+	defer cancel()
+	events, peers := s.clusterEvents(ctx)
+
+	paged, next := page.Page(events, s.ties)
+	response := map[string]interface{}{
+		"events": paged,
+		"count":  len(paged),
+		"total":  len(events),
+		"limit":  page.Limit,
+		"peers":  peers,
+	}
+	if next != nil {
+		response["next_cursor"] = next.String()
+	}
+	setNextLink(w, r, next)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// peerServer serves the /events of server over HTTP
+func peerServer(t *testing.T, server *Server) *httptest.Server {
+	ts := httptest.NewServer(http.HandlerFunc(server.handleGetEvents))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func clusterEventsRequest(server *Server, query string) (int, map[string]interface{}) {
+	req := httptest.NewRequest(http.MethodGet, "/cluster/events"+query, nil)
+	w := httptest.NewRecorder()
+	server.handleClusterEvents(w, req)
+
+	var response map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&response)
+	return w.Code, response
+}
+
+func TestClusterEventsMergesPeers(t *testing.T) {
+	a, b := NewServer(), NewServer()
+	a.nodeID, b.nodeID = "a", "b"
+	a.logEvent("a1", "First")  // a 1
+	b.logEvent("b1", "First")  // b 1
+	b.logEvent("b2", "Second") // b 2
+	a.logEvent("a2", "Second") // a 2
+	a.logEvent("a3", "Third")  // a 3
+
+	peerB := peerServer(t, b)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	// b is listed twice; its events must appear once
+	a.peers = NewPeers([]string{peerB.URL, peerB.URL + "/", down.URL}, http.DefaultClient)
+
+	code, response := clusterEventsRequest(a, "")
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	var order []string
+	for _, e := range response["events"].([]interface{}) {
+		order = append(order, e.(map[string]interface{})["id"].(string))
+	}
+	want := []string{"a1", "b1", "a2", "b2", "a3"}
+	if len(order) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, order)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("Expected %v, got %v", want, order)
+		}
+	}
+
+	peers := response["peers"].(map[string]interface{})
+	if peers[peerB.URL] != "ok" || peers[down.URL] == "ok" || peers[down.URL] == nil {
+		t.Errorf("Expected b ok and the closed peer failed, got %v", peers)
+	}
+}
+
+func TestClusterEventsPagination(t *testing.T) {
+	server := NewServer()
+	for i := 0; i < 5; i++ {
+		server.logEvent(fmt.Sprintf("e%d", i), "Event")
+	}
+
+	_, response := clusterEventsRequest(server, "?limit=2")
+	cursor, _ := response["next_cursor"].(string)
+	if response["count"] != 2.0 || response["total"] != 5.0 || cursor == "" {
+		t.Fatalf("Expected page of 2 of 5 with a next cursor, got %v", response)
+	}
+	_, response = clusterEventsRequest(server, "?limit=2&cursor="+cursor)
+	cursor, _ = response["next_cursor"].(string)
+	if events := response["events"].([]interface{}); len(events) != 2 || events[0].(map[string]interface{})["id"] != "e2" {
+		t.Errorf("Expected e2 and e3 next, got %v", response)
+	}
+	_, response = clusterEventsRequest(server, "?limit=2&cursor="+cursor)
+	if response["count"] != 1.0 || response["next_cursor"] != nil {
+		t.Errorf("Expected last page of 1, got %v", response)
+	}
+
+	for _, query := range []string{"?limit=0", "?limit=1001", "?offset=2", "?limit=x", "?cursor=x"} {
+		if code, _ := clusterEventsRequest(server, query); code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", query, code)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/checker"
+)
+
+func writeHistory(t *testing.T, dir, name, body string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCheckCommand(t *testing.T) {
+	dir := t.TempDir()
+	// Nodes without -node-id are named after their files
+	a := writeHistory(t, dir, "node-a.json", `{"events":[{"id":"a1","lamport_timestamp":1},{"id":"a2","lamport_timestamp":2}]}`)
+	b := writeHistory(t, dir, "node-b.json", `{"events":[{"id":"msg-3","lamport_timestamp":3,"sender":"node-a","sent_at":{"epoch":0,"lamport_timestamp":2}}]}`)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"check", a, b}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected status 0, got %d: %s", code, stderr.String())
+	}
+	var report checker.Report
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Events != 3 || strings.Join(report.Nodes, ",") != "node-a,node-b" || !report.OK() {
+		t.Errorf("Expected 3 events of node-a and node-b, got %+v", report)
+	}
+
+	// node-a never stamped 4
+	stdin := strings.NewReader(`{"id":"msg-5","node":"node-b","lamport_timestamp":5,"sender":"node-a","sent_at":{"epoch":0,"lamport_timestamp":4}}`)
+	stdout.Reset()
+	if code := run([]string{"check", "-compact", a, "-"}, stdin, &stdout, &stderr); code != 1 {
+		t.Fatalf("Expected status 1, got %d", code)
+	}
+	if !strings.Contains(stdout.String(), `"kind":"missing-send"`) || strings.Count(stdout.String(), "\n") != 1 {
+		t.Errorf("Expected the violation on one line, got %s", stdout.String())
+	}
+}
+
+func TestCheckCommandErrors(t *testing.T) {
+	dir := t.TempDir()
+	bad := writeHistory(t, dir, "bad.json", `{"events":[`)
+	for _, args := range [][]string{
+		nil,
+		{"verify"},
+		{"check"},
+		{"check", filepath.Join(dir, "missing.json")},
+		{"check", bad},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := run(args, nil, &stdout, &stderr); code != 2 || stderr.Len() == 0 {
+			t.Errorf("Expected status 2 with a message for %q, got %d", args, code)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+// Command loadgen drives a Lamport clock server with a mix of local events
+// and received messages and reports throughput, latency percentiles and the
+// final clock value, so regressions in the clock or the event store can be
+// measured end to end.
+//
+//	go run ./cmd/loadgen -target http://localhost:8080 -concurrency 16 -duration 30s -messages 0.5
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// apiPrefix is the version of the server API load is sent to
+const apiPrefix = "/v1"
+
+// Distributions of the timestamps sent with messages, relative to the
+// highest timestamp the server has answered with so far
+var distributions = []string{"current", "behind", "ahead", "uniform"}
+
+// Options configure a load run
+type Options struct {
+	Target      string
+	Concurrency int
+	Duration    time.Duration
+	Requests    int     // stop after this many requests, 0 for no limit
+	Messages    float64 // share of /message calls, the rest go to /event
+	Timestamps  string  // one of distributions
+	Spread      int64   // range of the timestamp distribution
+	Token       string  // bearer token, when the server requires one
+}
+
+func parseOptions(args []string) (Options, bool, error) {
+	var opts Options
+	fs := flag.NewFlagSet("loadgen", flag.ContinueOnError)
+	fs.StringVar(&opts.Target, "target", "http://localhost:8080", "base URL of the server under load")
+	fs.IntVar(&opts.Concurrency, "concurrency", 8, "number of concurrent clients")
+	fs.DurationVar(&opts.Duration, "duration", 10*time.Second, "how long to run")
+	fs.IntVar(&opts.Requests, "requests", 0, "stop after this many requests (0 runs for -duration)")
+	fs.Float64Var(&opts.Messages, "messages", 0.5, "share of requests sent to /message instead of /event (0 to 1)")
+	fs.StringVar(&opts.Timestamps, "timestamps", "current", "timestamp distribution of messages: "+strings.Join(distributions, ", "))
+	fs.Int64Var(&opts.Spread, "spread", 100, "range of the timestamp distribution")
+	fs.StringVar(&opts.Token, "token", "", "bearer token sent with every request")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return opts, false, err
+	}
+
+	opts.Target = strings.TrimRight(opts.Target, "/")
+	switch {
+	case opts.Concurrency < 1:
+		return opts, false, errors.New("-concurrency must be at least 1")
+	case opts.Duration <= 0 && opts.Requests <= 0:
+		return opts, false, errors.New("-duration or -requests must be positive")
+	case opts.Messages < 0 || opts.Messages > 1:
+		return opts, false, errors.New("-messages must be between 0 and 1")
+	case !slices.Contains(distributions, opts.Timestamps):
+		return opts, false, fmt.Errorf("-timestamps must be one of %s", strings.Join(distributions, ", "))
+	case opts.Spread < 0:
+		return opts, false, errors.New("-spread must not be negative")
+	}
+	return opts, *asJSON, nil
+}
+
+// Latencies summarizes the response times of one endpoint
+type Latencies struct {
+	Count int           `json:"count"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+}
+
+// summarize sorts samples and picks the nearest-rank percentiles
+func summarize(samples []time.Duration) Latencies {
+	if len(samples) == 0 {
+		return Latencies{}
+	}
+	slices.Sort(samples)
+	rank := func(p float64) time.Duration {
+		i := int(p*float64(len(samples))+0.999999) - 1
+		return samples[max(0, min(i, len(samples)-1))]
+	}
+	return Latencies{
+		Count: len(samples),
+		P50:   rank(0.50),
+		P90:   rank(0.90),
+		P99:   rank(0.99),
+		Max:   samples[len(samples)-1],
+	}
+}
+
+// Report is the outcome of a load run
+type Report struct {
+	Requests   int                  `json:"requests"`
+	Errors     int                  `json:"errors"`
+	Statuses   map[string]int       `json:"statuses"`
+	Elapsed    time.Duration        `json:"elapsed"`
+	Throughput float64              `json:"throughput"`
+	Latency    Latencies            `json:"latency"`
+	Endpoints  map[string]Latencies `json:"endpoints"`
+	FinalClock int64                `json:"final_clock"`
+	FinalEpoch int64                `json:"final_epoch"`
+}
+
+type sample struct {
+	endpoint string
+	status   string
+	latency  time.Duration
+}
+
+// loader holds the state shared by the clients of a run
+type loader struct {
+	opts    Options
+	client  *http.Client
+	highest atomic.Int64 // highest timestamp answered so far
+	sent    atomic.Int64
+}
+
+// timestamp picks the timestamp of the next message
+func (l *loader) timestamp() int64 {
+	current := l.highest.Load()
+	spread := rand.Int64N(l.opts.Spread + 1)
+	switch l.opts.Timestamps {
+	case "behind":
+		return max(0, current-spread)
+	case "ahead":
+		return current + spread
+	case "uniform":
+		return spread
+	}
+	return current
+}
+
+func (l *loader) do(ctx context.Context, method, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, l.opts.Target+apiPrefix+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if l.opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+l.opts.Token)
+	}
+	return l.client.Do(req)
+}
+
+// call sends one /event or /message request
+func (l *loader) call(ctx context.Context, worker int, n int64) sample {
+	endpoint := "/event"
+	query := url.Values{"message": {fmt.Sprintf("loadgen %d-%d", worker, n)}}
+	if rand.Float64() < l.opts.Messages {
+		endpoint = "/message"
+		query.Set("timestamp", strconv.FormatInt(l.timestamp(), 10))
+		query.Set("sender", fmt.Sprintf("loadgen-%d", worker))
+	}
+
+	start := time.Now()
+	resp, err := l.do(ctx, http.MethodPost, endpoint+"?"+query.Encode())
+	if err != nil {
+		return sample{endpoint: endpoint, status: "error", latency: time.Since(start)}
+	}
+	defer resp.Body.Close()
+
+	var event struct {
+		Timestamp int64 `json:"lamport_timestamp"`
+	}
+	if resp.StatusCode == http.StatusOK && json.NewDecoder(resp.Body).Decode(&event) == nil {
+		for {
+			highest := l.highest.Load()
+			if event.Timestamp <= highest || l.highest.CompareAndSwap(highest, event.Timestamp) {
+				break
+			}
+		}
+	} else {
+		io.Copy(io.Discard, resp.Body)
+	}
+	return sample{endpoint: endpoint, status: strconv.Itoa(resp.StatusCode), latency: time.Since(start)}
+}
+
+// clockTime reads the current time of the server
+func (l *loader) clockTime(ctx context.Context) (int64, int64, error) {
+	resp, err := l.do(ctx, http.MethodGet, "/time")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, 0, fmt.Errorf("GET /time answered %s", resp.Status)
+	}
+	var now struct {
+		Timestamp int64 `json:"lamport_timestamp"`
+		Epoch     int64 `json:"epoch"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&now); err != nil {
+		return 0, 0, err
+	}
+	return now.Timestamp, now.Epoch, nil
+}
+
+// run drives the target until the duration has passed, the request limit
+// is reached or ctx is done
+func run(ctx context.Context, opts Options, client *http.Client) (Report, error) {
+	l := &loader{opts: opts, client: client}
+	start, _, err := l.clockTime(ctx)
+	if err != nil {
+		return Report{}, fmt.Errorf("target not reachable: %w", err)
+	}
+	l.highest.Store(start)
+
+	runCtx := ctx
+	if opts.Duration > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, opts.Duration)
+		defer cancel()
+	}
+
+	began := time.Now()
+	results := make([][]sample, opts.Concurrency)
+	var wg sync.WaitGroup
+	for worker := range opts.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for runCtx.Err() == nil {
+				n := l.sent.Add(1)
+				if opts.Requests > 0 && n > int64(opts.Requests) {
+					return
+				}
+				s := l.call(runCtx, worker, n)
+				if runCtx.Err() != nil && s.status == "error" {
+					return // cut off by the end of the run
+				}
+				results[worker] = append(results[worker], s)
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(began)
+
+	report := Report{
+		Statuses:  make(map[string]int),
+		Elapsed:   elapsed,
+		Endpoints: make(map[string]Latencies),
+	}
+	var all []time.Duration
+	byEndpoint := make(map[string][]time.Duration)
+	for _, samples := range results {
+		for _, s := range samples {
+			report.Requests++
+			report.Statuses[s.status]++
+			if s.status != strconv.Itoa(http.StatusOK) {
+				report.Errors++
+			}
+			all = append(all, s.latency)
+			byEndpoint[s.endpoint] = append(byEndpoint[s.endpoint], s.latency)
+		}
+	}
+	report.Latency = summarize(all)
+	for endpoint, samples := range byEndpoint {
+		report.Endpoints[endpoint] = summarize(samples)
+	}
+	if elapsed > 0 {
+		report.Throughput = float64(report.Requests) / elapsed.Seconds()
+	}
+
+	if report.FinalClock, report.FinalEpoch, err = l.clockTime(ctx); err != nil {
+		return report, fmt.Errorf("reading the final clock: %w", err)
+	}
+	return report, nil
+}
+
+// print writes the report for people
+func (r Report) print(w io.Writer) {
+	fmt.Fprintf(w, "requests:    %d in %v (%d errors)\n", r.Requests, r.Elapsed.Round(time.Millisecond), r.Errors)
+	fmt.Fprintf(w, "throughput:  %.1f req/s\n", r.Throughput)
+	fmt.Fprintf(w, "latency:     p50 %v  p90 %v  p99 %v  max %v\n", r.Latency.P50, r.Latency.P90, r.Latency.P99, r.Latency.Max)
+	for _, endpoint := range slices.Sorted(maps.Keys(r.Endpoints)) {
+		l := r.Endpoints[endpoint]
+		fmt.Fprintf(w, "  %-9s  %d requests, p50 %v  p90 %v  p99 %v  max %v\n", endpoint, l.Count, l.P50, l.P90, l.P99, l.Max)
+	}
+	for _, status := range slices.Sorted(maps.Keys(r.Statuses)) {
+		fmt.Fprintf(w, "status %s:  %d\n", status, r.Statuses[status])
+	}
+	fmt.Fprintf(w, "final clock: %d (epoch %d)\n", r.FinalClock, r.FinalEpoch)
+}
+
+func main() {
+	opts, asJSON, err := parseOptions(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatal("Invalid options: ", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	client := &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{MaxIdleConnsPerHost: opts.Concurrency},
+	}
+	report, err := run(ctx, opts, client)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if asJSON {
+		json.NewEncoder(os.Stdout).Encode(report)
+		return
+	}
+	report.print(os.Stdout)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock serves /time, /event and /message like a Lamport clock server
+func fakeClock(t *testing.T) (*httptest.Server, *int64) {
+	var mu sync.Mutex
+	var clock int64
+	answer := func(w http.ResponseWriter) {
+		json.NewEncoder(w).Encode(map[string]int64{"lamport_timestamp": clock})
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(apiPrefix+"/time", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		answer(w)
+	})
+	mux.HandleFunc(apiPrefix+"/event", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		clock++
+		answer(w)
+	})
+	mux.HandleFunc(apiPrefix+"/message", func(w http.ResponseWriter, r *http.Request) {
+		received, err := strconv.ParseInt(r.URL.Query().Get("timestamp"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid timestamp", http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		clock = max(clock, received) + 1
+		answer(w)
+	})
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts, &clock
+}
+
+func TestRunReportsRequests(t *testing.T) {
+	ts, clock := fakeClock(t)
+	opts := Options{Target: ts.URL, Concurrency: 4, Requests: 200, Messages: 0.5, Timestamps: "ahead", Spread: 10}
+
+	report, err := run(t.Context(), opts, ts.Client())
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if report.Requests != 200 || report.Errors != 0 || report.Statuses["200"] != 200 {
+		t.Errorf("Expected 200 successful requests, got %+v", report)
+	}
+	if report.Endpoints["/event"].Count+report.Endpoints["/message"].Count != 200 {
+		t.Errorf("Expected the requests split over both endpoints, got %+v", report.Endpoints)
+	}
+	if report.FinalClock != *clock || report.FinalClock < 200 {
+		t.Errorf("Expected the final clock %d, got %d", *clock, report.FinalClock)
+	}
+	if report.Latency.P50 > report.Latency.P99 || report.Latency.P99 > report.Latency.Max {
+		t.Errorf("Expected ordered percentiles, got %+v", report.Latency)
+	}
+}
+
+func TestRunStopsAfterDuration(t *testing.T) {
+	ts, _ := fakeClock(t)
+	opts := Options{Target: ts.URL, Concurrency: 2, Duration: 50 * time.Millisecond, Timestamps: "current"}
+
+	report, err := run(t.Context(), opts, ts.Client())
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if report.Requests == 0 || report.Errors != 0 || report.Throughput <= 0 {
+		t.Errorf("Expected requests without errors, got %+v", report)
+	}
+	if report.Elapsed > time.Second {
+		t.Errorf("Expected the run to stop after the duration, took %v", report.Elapsed)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	samples := make([]time.Duration, 100)
+	for i := range samples {
+		samples[i] = time.Duration(100-i) * time.Millisecond
+	}
+	got := summarize(samples)
+	if got.Count != 100 || got.P50 != 50*time.Millisecond || got.P90 != 90*time.Millisecond || got.P99 != 99*time.Millisecond || got.Max != 100*time.Millisecond {
+		t.Errorf("Unexpected percentiles: %+v", got)
+	}
+	if summarize(nil) != (Latencies{}) {
+		t.Error("Expected empty latencies without samples")
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	opts, asJSON, err := parseOptions([]string{"-target", "http://node-a:8080/", "-timestamps", "behind", "-json"})
+	if err != nil || opts.Target != "http://node-a:8080" || opts.Timestamps != "behind" || !asJSON {
+		t.Errorf("Unexpected options %+v (json %v, err %v)", opts, asJSON, err)
+	}
+	for _, args := range [][]string{{"-concurrency", "0"}, {"-messages", "2"}, {"-timestamps", "zipf"}, {"-duration", "0"}} {
+		if _, _, err := parseOptions(args); err == nil {
+			t.Errorf("Expected %v to be refused", args)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+// Package codec defines the wire representation of Lamport timestamps and
+// events, shared by every transport.
+//
+// The binary format is compact: integers are unsigned varints, strings and
+// byte slices carry a varint length prefix, and optional fields are
+// announced in a flags byte. JSON uses the same field names as the HTTP API,
+// so both encodings of a value are interchangeable.
+package codec
+
+import (
+	"cmp"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Version is the version byte that starts every binary event
+const Version = 1
+
+// ErrInvalid is returned for binary data that cannot be decoded
+var ErrInvalid = errors.New("codec: invalid encoding")
+
+// Timestamp is a Lamport time: an epoch and a timestamp within it
+type Timestamp struct {
+	Epoch     int64 `json:"epoch"`
+	Timestamp int64 `json:"lamport_timestamp"`
+}
+
+// AppendBinary appends the varint encoding of t to b
+func (t Timestamp) AppendBinary(b []byte) ([]byte, error) {
+	if t.Epoch < 0 || t.Timestamp < 0 {
+		return nil, fmt.Errorf("codec: negative timestamp %d:%d", t.Epoch, t.Timestamp)
+	}
+	b = binary.AppendUvarint(b, uint64(t.Epoch))
+	return binary.AppendUvarint(b, uint64(t.Timestamp)), nil
+}
+
+// MarshalBinary encodes t
+func (t Timestamp) MarshalBinary() ([]byte, error) {
+	return t.AppendBinary(nil)
+}
+
+// UnmarshalBinary decodes t from data, which must hold exactly one timestamp
+func (t *Timestamp) UnmarshalBinary(data []byte) error {
+	d := decoder{data: data}
+	*t = d.timestamp()
+	return d.finish()
+}
+
+// DecodeTimestamp decodes a timestamp from the start of data and returns the
+// number of bytes it used, for formats that embed timestamps
+func DecodeTimestamp(data []byte) (Timestamp, int, error) {
+	d := decoder{data: data}
+	t := d.timestamp()
+	return t, d.pos, d.err
+}
+
+// Ordering is the causal relation between two logical times, as the API
+// writes it
+type Ordering string
+
+// Relations between two logical times under happened-before
+const (
+	Before     Ordering = "before"
+	After      Ordering = "after"
+	Concurrent Ordering = "concurrent"
+	Equal      Ordering = "equal"
+)
+
+// Compare orders t and other by epoch, then timestamp: -1 when t is
+// earlier, 1 when it is later and 0 when they are equal
+func (t Timestamp) Compare(other Timestamp) int {
+	if c := cmp.Compare(t.Epoch, other.Epoch); c != 0 {
+		return c
+	}
+	return cmp.Compare(t.Timestamp, other.Timestamp)
+}
+
+// Event is a timestamped event as it travels between nodes
+type Event struct {
+	ID        string    `json:"id"`
+	Message   string    `json:"message"`
+	Timestamp int64     `json:"lamport_timestamp"`
+	Epoch     int64     `json:"epoch,omitempty"`
+	WallTime  time.Time `json:"wall_time"`
+
+	Type          string          `json:"type,omitempty"`
+	SchemaVersion int             `json:"schema_version,omitempty"`
+	Payload       json.RawMessage `json:"payload,omitempty"`
+
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+
+	Node   string     `json:"node,omitempty"`
+	Sender string     `json:"sender,omitempty"`
+	SentAt *Timestamp `json:"sent_at,omitempty"`
+
+	Backfilled bool `json:"backfilled,omitempty"`
+
+	Signature        string `json:"signature,omitempty"`
+	KeyID            string `json:"key_id,omitempty"`
+	InvalidSignature bool   `json:"invalid_signature,omitempty"`
+
+	PrevHash string `json:"prev_hash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// Flags announcing optional event fields
+const (
+	flagSentAt = 1 << iota
+	flagBackfilled
+	flagWallTime
+	flagNode
+	flagSignature
+	flagInvalidSignature
+	flagChained
+)
+
+// AppendBinary appends the binary encoding of e to b. Metadata is written
+// in key order, so equal events encode to equal bytes. Only backfilled
+// events may sit in a negative epoch, before all history; it is written as
+// its two's complement.
+func (e Event) AppendBinary(b []byte) ([]byte, error) {
+	if e.Timestamp < 0 || e.Epoch < 0 && !e.Backfilled || e.SchemaVersion < 0 {
+		return nil, fmt.Errorf("codec: negative field in event %q", e.ID)
+	}
+
+	var flags byte
+	if e.SentAt != nil {
+		flags |= flagSentAt
+	}
+	if e.Backfilled {
+		flags |= flagBackfilled
+	}
+	if !e.WallTime.IsZero() {
+		flags |= flagWallTime
+	}
+	if e.Node != "" {
+		flags |= flagNode
+	}
+	if e.Signature != "" {
+		flags |= flagSignature
+	}
+	if e.InvalidSignature {
+		flags |= flagInvalidSignature
+	}
+	if e.Hash != "" {
+		flags |= flagChained
+	}
+
+	b = append(b, Version, flags)
+	b = appendString(b, e.ID)
+	b = appendString(b, e.Message)
+	b = binary.AppendUvarint(b, uint64(e.Epoch))
+	b = binary.AppendUvarint(b, uint64(e.Timestamp))
+	if !e.WallTime.IsZero() {
+		b = binary.AppendVarint(b, e.WallTime.UnixNano())
+	}
+	b = appendString(b, e.Type)
+	b = binary.AppendUvarint(b, uint64(e.SchemaVersion))
+	b = appendString(b, string(e.Payload))
+
+	keys := make([]string, 0, len(e.Metadata))
+	for k := range e.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	b = binary.AppendUvarint(b, uint64(len(keys)))
+	for _, k := range keys {
+		b = appendString(b, k)
+		b = appendString(b, e.Metadata[k])
+	}
+
+	b = appendString(b, e.RequestID)
+	b = appendString(b, e.Sender)
+	if e.SentAt != nil {
+		var err error
+		if b, err = e.SentAt.AppendBinary(b); err != nil {
+			return nil, err
+		}
+	}
+	if e.Node != "" {
+		b = appendString(b, e.Node)
+	}
+	if e.Signature != "" {
+		b = appendString(b, e.Signature)
+		b = appendString(b, e.KeyID)
+	}
+	if e.Hash != "" {
+		b = appendString(b, e.PrevHash)
+		b = appendString(b, e.Hash)
+	}
+	return b, nil
+}
+
+// MarshalBinary encodes e
+func (e Event) MarshalBinary() ([]byte, error) {
+	return e.AppendBinary(nil)
+}
+
+// UnmarshalBinary decodes e from data, which must hold exactly one event
+func (e *Event) UnmarshalBinary(data []byte) error {
+	d := decoder{data: data}
+	if v := d.byte(); d.err == nil && v != Version {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalid, v)
+	}
+	flags := d.byte()
+
+	var out Event
+	out.ID = d.string()
+	out.Message = d.string()
+	if flags&flagBackfilled != 0 {
+		out.Epoch = int64(d.uvarint(math.MaxUint64))
+	} else {
+		out.Epoch = d.int64()
+	}
+	out.Timestamp = d.int64()
+	if flags&flagWallTime != 0 {
+		out.WallTime = time.Unix(0, d.varint()).UTC()
+	}
+	out.Type = d.string()
+	out.SchemaVersion = int(d.uvarint(math.MaxInt32))
+	if payload := d.string(); payload != "" {
+		out.Payload = json.RawMessage(payload)
+	}
+
+	n := d.uvarint(uint64(len(data)))
+	if n > 0 && d.err == nil {
+		out.Metadata = make(map[string]string, n)
+		for i := uint64(0); i < n && d.err == nil; i++ {
+			k := d.string()
+			out.Metadata[k] = d.string()
+		}
+	}
+
+	out.RequestID = d.string()
+	out.Sender = d.string()
+	if flags&flagSentAt != 0 {
+		sentAt := d.timestamp()
+		out.SentAt = &sentAt
+	}
+	if flags&flagNode != 0 {
+		out.Node = d.string()
+	}
+	if flags&flagSignature != 0 {
+		out.Signature = d.string()
+		out.KeyID = d.string()
+	}
+	if flags&flagChained != 0 {
+		out.PrevHash = d.string()
+		out.Hash = d.string()
+	}
+	out.Backfilled = flags&flagBackfilled != 0
+	out.InvalidSignature = flags&flagInvalidSignature != 0
+
+	if err := d.finish(); err != nil {
+		return err
+	}
+	*e = out
+	return nil
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// decoder reads fields in order, remembering the first error so callers
+// can check once at the end
+type decoder struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (d *decoder) fail(format string, args ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: "+format, append([]interface{}{ErrInvalid}, args...)...)
+	}
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if d.pos >= len(d.data) {
+		d.fail("truncated at byte %d", d.pos)
+		return 0
+	}
+	v := d.data[d.pos]
+	d.pos++
+	return v
+}
+
+// uvarint reads an unsigned varint no larger than max
+func (d *decoder) uvarint(max uint64) uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data[d.pos:])
+	if n <= 0 {
+		d.fail("bad varint at byte %d", d.pos)
+		return 0
+	}
+	if v > max {
+		d.fail("value %d out of range at byte %d", v, d.pos)
+		return 0
+	}
+	d.pos += n
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.data[d.pos:])
+	if n <= 0 {
+		d.fail("bad varint at byte %d", d.pos)
+		return 0
+	}
+	d.pos += n
+	return v
+}
+
+func (d *decoder) int64() int64 {
+	return int64(d.uvarint(math.MaxInt64))
+}
+
+func (d *decoder) timestamp() Timestamp {
+	epoch := d.int64()
+	return Timestamp{Epoch: epoch, Timestamp: d.int64()}
+}
+
+// string reads a length prefixed string; the length is checked against the
+// remaining input before anything is allocated
+func (d *decoder) string() string {
+	n := d.uvarint(uint64(len(d.data)))
+	if d.err != nil {
+		return ""
+	}
+	if uint64(len(d.data)-d.pos) < n {
+		d.fail("truncated string at byte %d", d.pos)
+		return ""
+	}
+	s := string(d.data[d.pos : d.pos+int(n)])
+	d.pos += int(n)
+	return s
+}
+
+func (d *decoder) finish() error {
+	if d.err == nil && d.pos != len(d.data) {
+		d.fail("%d trailing bytes", len(d.data)-d.pos)
+	}
+	return d.err
+}
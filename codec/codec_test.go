@@ -0,0 +1,174 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTimestampRoundTrip(t *testing.T) {
+	for _, ts := range []Timestamp{
+		{},
+		{Timestamp: 1},
+		{Epoch: 3, Timestamp: 300},
+		{Epoch: math.MaxInt64, Timestamp: math.MaxInt64},
+	} {
+		data, err := ts.MarshalBinary()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		var decoded Timestamp
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("Unexpected error for %v: %v", ts, err)
+		}
+		if decoded != ts {
+			t.Errorf("Expected %v, got %v", ts, decoded)
+		}
+	}
+
+	// Varints keep small timestamps small
+	if data, _ := (Timestamp{Timestamp: 100}).MarshalBinary(); len(data) != 2 {
+		t.Errorf("Expected 2 bytes, got %d", len(data))
+	}
+	if _, err := (Timestamp{Timestamp: -1}).MarshalBinary(); err == nil {
+		t.Error("Expected negative timestamps to be rejected")
+	}
+}
+
+func TestDecodeTimestampEmbedded(t *testing.T) {
+	data, _ := Timestamp{Epoch: 1, Timestamp: 500}.AppendBinary([]byte{0xff})
+	data = append(data, 0xee)
+
+	ts, n, err := DecodeTimestamp(data[1:])
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ts != (Timestamp{Epoch: 1, Timestamp: 500}) || n != 3 {
+		t.Errorf("Expected 1:500 in 3 bytes, got %v in %d", ts, n)
+	}
+}
+
+func testEvent() Event {
+	return Event{
+		ID:            "event-1",
+		Message:       "User login",
+		Timestamp:     42,
+		Epoch:         1,
+		WallTime:      time.Date(2024, 1, 1, 10, 0, 0, 123, time.UTC),
+		Type:          "user.login",
+		SchemaVersion: 2,
+		Payload:       json.RawMessage(`{"user":"ada"}`),
+		Metadata:      map[string]string{"service": "auth", "region": "eu"},
+		RequestID:     "req-1",
+		Node:          "a",
+		Sender:        "b",
+		SentAt:        &Timestamp{Epoch: 1, Timestamp: 40},
+		Backfilled:    true,
+
+		Signature:        "c2lnbmF0dXJl",
+		KeyID:            "0123456789abcdef",
+		InvalidSignature: true,
+
+		PrevHash: "3a",
+		Hash:     "7f",
+	}
+}
+
+func TestEventRoundTrip(t *testing.T) {
+	// Backfilled events may sit in negative epochs, before all history
+	prehistory := Event{ID: "old", Timestamp: 1, Epoch: -1, Backfilled: true}
+	for _, e := range []Event{testEvent(), {ID: "bare"}, prehistory} {
+		data, err := e.MarshalBinary()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		var decoded Event
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(decoded, e) {
+			t.Errorf("Expected %+v, got %+v", e, decoded)
+		}
+	}
+}
+
+func TestEventRejectsNegativeEpochs(t *testing.T) {
+	if _, err := (Event{ID: "live", Timestamp: 1, Epoch: -1}).MarshalBinary(); err == nil {
+		t.Error("Expected a negative epoch refused for an event that is not backfilled")
+	}
+}
+
+func TestEventEncodingIsDeterministic(t *testing.T) {
+	first, _ := testEvent().MarshalBinary()
+	for i := 0; i < 20; i++ {
+		again, _ := testEvent().MarshalBinary()
+		if !bytes.Equal(first, again) {
+			t.Fatal("Expected equal events to encode to equal bytes")
+		}
+	}
+}
+
+func TestEventBinaryIsCompact(t *testing.T) {
+	e := testEvent()
+	data, _ := e.MarshalBinary()
+	text, _ := json.Marshal(e)
+	if len(data) >= len(text)/2 {
+		t.Errorf("Expected binary (%d bytes) to be under half of JSON (%d bytes)", len(data), len(text))
+	}
+}
+
+func TestEventRejectsInvalidData(t *testing.T) {
+	valid, _ := testEvent().MarshalBinary()
+
+	cases := map[string][]byte{
+		"empty":    nil,
+		"version":  append([]byte{9}, valid[1:]...),
+		"trailing": append(append([]byte(nil), valid...), 0),
+		// A string claiming to be longer than the input
+		"length": {Version, 0, 0xff, 0xff, 0xff, 0xff, 0x0f},
+	}
+	for i := 1; i < len(valid); i++ {
+		var e Event
+		if err := e.UnmarshalBinary(valid[:i]); !errors.Is(err, ErrInvalid) {
+			t.Fatalf("Expected truncation at %d to fail with ErrInvalid, got %v", i, err)
+		}
+	}
+	for name, data := range cases {
+		var e Event
+		if err := e.UnmarshalBinary(data); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: expected ErrInvalid, got %v", name, err)
+		}
+	}
+}
+
+func TestEventJSONFieldNames(t *testing.T) {
+	data, _ := json.Marshal(Event{ID: "e", Message: "m", Timestamp: 5, SentAt: &Timestamp{Timestamp: 4}})
+
+	var fields map[string]interface{}
+	json.Unmarshal(data, &fields)
+	for _, name := range []string{"id", "message", "lamport_timestamp", "wall_time", "sent_at"} {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("Expected JSON field %q in %s", name, data)
+		}
+	}
+}
+
+func TestTimestampCompare(t *testing.T) {
+	cases := []struct {
+		a, b Timestamp
+		want int
+	}{
+		{Timestamp{0, 1}, Timestamp{0, 2}, -1},
+		{Timestamp{1, 1}, Timestamp{0, 9}, 1},
+		{Timestamp{2, 5}, Timestamp{2, 5}, 0},
+	}
+	for _, c := range cases {
+		if got := c.a.Compare(c.b); got != c.want {
+			t.Errorf("Expected %+v compared to %+v to be %d, got %d", c.a, c.b, c.want, got)
+		}
+	}
+}
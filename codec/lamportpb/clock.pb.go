@@ -0,0 +1,285 @@
+// The Clock service, served on the HTTP port of a node to gRPC, gRPC-Web
+// and Connect clients. Calls carry Lamport timestamps in the
+// lamport-timestamp metadata key.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: clock.proto
+
+package lamportpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// UpdateRequest is a message received from another node. Its fields are
+// the parameters of POST /message of the same names, numbered as in Event,
+// so the Event of the sender is a valid request.
+type UpdateRequest struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Id               string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Message          string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	LamportTimestamp uint64                 `protobuf:"varint,3,opt,name=lamport_timestamp,json=lamportTimestamp,proto3" json:"lamport_timestamp,omitempty"`
+	// The current epoch when unset; 0 is the first epoch
+	Epoch         *uint64 `protobuf:"varint,4,opt,name=epoch,proto3,oneof" json:"epoch,omitempty"`
+	Sender        string  `protobuf:"bytes,12,opt,name=sender,proto3" json:"sender,omitempty"`
+	Signature     string  `protobuf:"bytes,15,opt,name=signature,proto3" json:"signature,omitempty"`
+	KeyId         string  `protobuf:"bytes,16,opt,name=key_id,json=keyId,proto3" json:"key_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateRequest) Reset() {
+	*x = UpdateRequest{}
+	mi := &file_clock_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateRequest) ProtoMessage() {}
+
+func (x *UpdateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clock_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateRequest.ProtoReflect.Descriptor instead.
+func (*UpdateRequest) Descriptor() ([]byte, []int) {
+	return file_clock_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *UpdateRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *UpdateRequest) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *UpdateRequest) GetLamportTimestamp() uint64 {
+	if x != nil {
+		return x.LamportTimestamp
+	}
+	return 0
+}
+
+func (x *UpdateRequest) GetEpoch() uint64 {
+	if x != nil && x.Epoch != nil {
+		return *x.Epoch
+	}
+	return 0
+}
+
+func (x *UpdateRequest) GetSender() string {
+	if x != nil {
+		return x.Sender
+	}
+	return ""
+}
+
+func (x *UpdateRequest) GetSignature() string {
+	if x != nil {
+		return x.Signature
+	}
+	return ""
+}
+
+func (x *UpdateRequest) GetKeyId() string {
+	if x != nil {
+		return x.KeyId
+	}
+	return ""
+}
+
+// StreamEventsRequest filters the events of StreamEvents. Events must match
+// every filter set.
+type StreamEventsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The message contains the text
+	Contains string `protobuf:"bytes,1,opt,name=contains,proto3" json:"contains,omitempty"`
+	// The event ID starts with the prefix
+	IdPrefix string `protobuf:"bytes,2,opt,name=id_prefix,json=idPrefix,proto3" json:"id_prefix,omitempty"`
+	// The Lamport timestamp is at least this
+	MinTimestamp uint64 `protobuf:"varint,3,opt,name=min_timestamp,json=minTimestamp,proto3" json:"min_timestamp,omitempty"`
+	// The metadata of the event has these entries
+	Metadata      map[string]string `protobuf:"bytes,4,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamEventsRequest) Reset() {
+	*x = StreamEventsRequest{}
+	mi := &file_clock_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamEventsRequest) ProtoMessage() {}
+
+func (x *StreamEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_clock_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamEventsRequest.ProtoReflect.Descriptor instead.
+func (*StreamEventsRequest) Descriptor() ([]byte, []int) {
+	return file_clock_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *StreamEventsRequest) GetContains() string {
+	if x != nil {
+		return x.Contains
+	}
+	return ""
+}
+
+func (x *StreamEventsRequest) GetIdPrefix() string {
+	if x != nil {
+		return x.IdPrefix
+	}
+	return ""
+}
+
+func (x *StreamEventsRequest) GetMinTimestamp() uint64 {
+	if x != nil {
+		return x.MinTimestamp
+	}
+	return 0
+}
+
+func (x *StreamEventsRequest) GetMetadata() map[string]string {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+var File_clock_proto protoreflect.FileDescriptor
+
+const file_clock_proto_rawDesc = "" +
+	"\n" +
+	"\vclock.proto\x12\n" +
+	"lamport.v1\x1a\rlamport.proto\"\xd8\x01\n" +
+	"\rUpdateRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12+\n" +
+	"\x11lamport_timestamp\x18\x03 \x01(\x04R\x10lamportTimestamp\x12\x19\n" +
+	"\x05epoch\x18\x04 \x01(\x04H\x00R\x05epoch\x88\x01\x01\x12\x16\n" +
+	"\x06sender\x18\f \x01(\tR\x06sender\x12\x1c\n" +
+	"\tsignature\x18\x0f \x01(\tR\tsignature\x12\x15\n" +
+	"\x06key_id\x18\x10 \x01(\tR\x05keyIdB\b\n" +
+	"\x06_epoch\"\xfb\x01\n" +
+	"\x13StreamEventsRequest\x12\x1a\n" +
+	"\bcontains\x18\x01 \x01(\tR\bcontains\x12\x1b\n" +
+	"\tid_prefix\x18\x02 \x01(\tR\bidPrefix\x12#\n" +
+	"\rmin_timestamp\x18\x03 \x01(\x04R\fminTimestamp\x12I\n" +
+	"\bmetadata\x18\x04 \x03(\v2-.lamport.v1.StreamEventsRequest.MetadataEntryR\bmetadata\x1a;\n" +
+	"\rMetadataEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x012\xb6\x01\n" +
+	"\x05Clock\x12/\n" +
+	"\x04Tick\x12\x14.lamport.v1.NewEvent\x1a\x11.lamport.v1.Event\x126\n" +
+	"\x06Update\x12\x19.lamport.v1.UpdateRequest\x1a\x11.lamport.v1.Event\x12D\n" +
+	"\fStreamEvents\x12\x1f.lamport.v1.StreamEventsRequest\x1a\x11.lamport.v1.Event0\x01BHZFgithub.com/lucasgabrielbecker/lamport_timestamp_golang/codec/lamportpbb\x06proto3"
+
+var (
+	file_clock_proto_rawDescOnce sync.Once
+	file_clock_proto_rawDescData []byte
+)
+
+func file_clock_proto_rawDescGZIP() []byte {
+	file_clock_proto_rawDescOnce.Do(func() {
+		file_clock_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_clock_proto_rawDesc), len(file_clock_proto_rawDesc)))
+	})
+	return file_clock_proto_rawDescData
+}
+
+var file_clock_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_clock_proto_goTypes = []any{
+	(*UpdateRequest)(nil),       // 0: lamport.v1.UpdateRequest
+	(*StreamEventsRequest)(nil), // 1: lamport.v1.StreamEventsRequest
+	nil,                         // 2: lamport.v1.StreamEventsRequest.MetadataEntry
+	(*NewEvent)(nil),            // 3: lamport.v1.NewEvent
+	(*Event)(nil),               // 4: lamport.v1.Event
+}
+var file_clock_proto_depIdxs = []int32{
+	2, // 0: lamport.v1.StreamEventsRequest.metadata:type_name -> lamport.v1.StreamEventsRequest.MetadataEntry
+	3, // 1: lamport.v1.Clock.Tick:input_type -> lamport.v1.NewEvent
+	0, // 2: lamport.v1.Clock.Update:input_type -> lamport.v1.UpdateRequest
+	1, // 3: lamport.v1.Clock.StreamEvents:input_type -> lamport.v1.StreamEventsRequest
+	4, // 4: lamport.v1.Clock.Tick:output_type -> lamport.v1.Event
+	4, // 5: lamport.v1.Clock.Update:output_type -> lamport.v1.Event
+	4, // 6: lamport.v1.Clock.StreamEvents:output_type -> lamport.v1.Event
+	4, // [4:7] is the sub-list for method output_type
+	1, // [1:4] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_clock_proto_init() }
+func file_clock_proto_init() {
+	if File_clock_proto != nil {
+		return
+	}
+	file_lamport_proto_init()
+	file_clock_proto_msgTypes[0].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_clock_proto_rawDesc), len(file_clock_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   3,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_clock_proto_goTypes,
+		DependencyIndexes: file_clock_proto_depIdxs,
+		MessageInfos:      file_clock_proto_msgTypes,
+	}.Build()
+	File_clock_proto = out.File
+	file_clock_proto_goTypes = nil
+	file_clock_proto_depIdxs = nil
+}
@@ -0,0 +1,90 @@
+// Package lamportpb holds the protocol buffers messages of the HTTP API and
+// of the Clock service, generated from lamport.proto and clock.proto, and
+// their conversions from and to the wire types of the codec package. The
+// Connect handler and client of the Clock service are in lamportpbconnect.
+package lamportpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --connect-go_out=. --connect-go_opt=paths=source_relative lamport.proto clock.proto
+
+import (
+	"time"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// FromTimestamp converts a codec timestamp
+func FromTimestamp(t codec.Timestamp) *Timestamp {
+	return &Timestamp{Epoch: uint64(t.Epoch), LamportTimestamp: uint64(t.Timestamp)}
+}
+
+// Codec converts t to a codec timestamp
+func (t *Timestamp) Codec() codec.Timestamp {
+	return codec.Timestamp{Epoch: int64(t.GetEpoch()), Timestamp: int64(t.GetLamportTimestamp())}
+}
+
+// FromEvent converts a codec event
+func FromEvent(e codec.Event) *Event {
+	pb := &Event{
+		Id:               e.ID,
+		Message:          e.Message,
+		LamportTimestamp: uint64(e.Timestamp),
+		Epoch:            uint64(e.Epoch),
+		WallTime:         wallTime(e.WallTime),
+		Type:             e.Type,
+		SchemaVersion:    int32(e.SchemaVersion),
+		Payload:          e.Payload,
+		Metadata:         e.Metadata,
+		RequestId:        e.RequestID,
+		Node:             e.Node,
+		Sender:           e.Sender,
+		Backfilled:       e.Backfilled,
+		Signature:        e.Signature,
+		KeyId:            e.KeyID,
+		InvalidSignature: e.InvalidSignature,
+		PrevHash:         e.PrevHash,
+		Hash:             e.Hash,
+	}
+	if e.SentAt != nil {
+		pb.SentAt = FromTimestamp(*e.SentAt)
+	}
+	return pb
+}
+
+// Codec converts e to a codec event
+func (e *Event) Codec() codec.Event {
+	event := codec.Event{
+		ID:               e.GetId(),
+		Message:          e.GetMessage(),
+		Timestamp:        int64(e.GetLamportTimestamp()),
+		Epoch:            int64(e.GetEpoch()),
+		Type:             e.GetType(),
+		SchemaVersion:    int(e.GetSchemaVersion()),
+		Payload:          e.GetPayload(),
+		Metadata:         e.GetMetadata(),
+		RequestID:        e.GetRequestId(),
+		Node:             e.GetNode(),
+		Sender:           e.GetSender(),
+		Backfilled:       e.GetBackfilled(),
+		Signature:        e.GetSignature(),
+		KeyID:            e.GetKeyId(),
+		InvalidSignature: e.GetInvalidSignature(),
+		PrevHash:         e.GetPrevHash(),
+		Hash:             e.GetHash(),
+	}
+	if e.GetWallTime() != nil {
+		event.WallTime = e.GetWallTime().AsTime()
+	}
+	if e.GetSentAt() != nil {
+		sent := e.GetSentAt().Codec()
+		event.SentAt = &sent
+	}
+	return event
+}
+
+func wallTime(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
@@ -0,0 +1,69 @@
+package lamportpb
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestEventRoundTrip(t *testing.T) {
+	event := codec.Event{
+		ID:               "msg-7",
+		Message:          "hello",
+		Timestamp:        7,
+		Epoch:            2,
+		WallTime:         time.Date(2024, 5, 1, 12, 0, 0, 42, time.UTC),
+		Type:             "greeting",
+		SchemaVersion:    3,
+		Payload:          json.RawMessage(`{"to":"bob"}`),
+		Metadata:         map[string]string{"service": "chat"},
+		RequestID:        "req-1",
+		Node:             "a",
+		Sender:           "b",
+		SentAt:           &codec.Timestamp{Epoch: 2, Timestamp: 6},
+		Signature:        "sig",
+		KeyID:            "key",
+		InvalidSignature: true,
+		PrevHash:         "00",
+		Hash:             "ff",
+	}
+
+	data, err := proto.Marshal(FromEvent(event))
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var decoded Event
+	if err := proto.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if got := decoded.Codec(); !reflect.DeepEqual(got, event) {
+		t.Errorf("Expected %+v, got %+v", event, got)
+	}
+}
+
+func TestPreHistoryEventRoundTrip(t *testing.T) {
+	// Backfilled events before all history sit in negative epochs
+	event := codec.Event{ID: "old", Timestamp: 1, Epoch: -2, Backfilled: true}
+	data, err := proto.Marshal(FromEvent(event))
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var decoded Event
+	if err := proto.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if got := decoded.Codec(); !reflect.DeepEqual(got, event) {
+		t.Errorf("Expected %+v, got %+v", event, got)
+	}
+}
+
+func TestMinimalEvent(t *testing.T) {
+	event := codec.Event{ID: "e1", Message: "m", Timestamp: 1}
+	if got := FromEvent(event).Codec(); !reflect.DeepEqual(got, event) {
+		t.Errorf("Expected a zero wall time and no sender time to survive, got %+v", got)
+	}
+}
@@ -0,0 +1,633 @@
+// Messages of the HTTP API in protocol buffers form, served for
+// Accept: application/x-protobuf. Field names match the JSON of the API.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: lamport.proto
+
+package lamportpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Timestamp is a Lamport time: an epoch and a timestamp within it
+type Timestamp struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Epoch            uint64                 `protobuf:"varint,1,opt,name=epoch,proto3" json:"epoch,omitempty"`
+	LamportTimestamp uint64                 `protobuf:"varint,2,opt,name=lamport_timestamp,json=lamportTimestamp,proto3" json:"lamport_timestamp,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *Timestamp) Reset() {
+	*x = Timestamp{}
+	mi := &file_lamport_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Timestamp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Timestamp) ProtoMessage() {}
+
+func (x *Timestamp) ProtoReflect() protoreflect.Message {
+	mi := &file_lamport_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Timestamp.ProtoReflect.Descriptor instead.
+func (*Timestamp) Descriptor() ([]byte, []int) {
+	return file_lamport_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Timestamp) GetEpoch() uint64 {
+	if x != nil {
+		return x.Epoch
+	}
+	return 0
+}
+
+func (x *Timestamp) GetLamportTimestamp() uint64 {
+	if x != nil {
+		return x.LamportTimestamp
+	}
+	return 0
+}
+
+// Event is a timestamped event, as returned by POST /event, POST /message
+// and GET /events
+type Event struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Id               string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Message          string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	LamportTimestamp uint64                 `protobuf:"varint,3,opt,name=lamport_timestamp,json=lamportTimestamp,proto3" json:"lamport_timestamp,omitempty"`
+	// Backfilled events imported before all history sit in negative epochs,
+	// sent as their two's complement
+	Epoch         uint64                 `protobuf:"varint,4,opt,name=epoch,proto3" json:"epoch,omitempty"`
+	WallTime      *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=wall_time,json=wallTime,proto3" json:"wall_time,omitempty"`
+	Type          string                 `protobuf:"bytes,6,opt,name=type,proto3" json:"type,omitempty"`
+	SchemaVersion int32                  `protobuf:"varint,7,opt,name=schema_version,json=schemaVersion,proto3" json:"schema_version,omitempty"`
+	// JSON document validated against the schema of the type
+	Payload          []byte            `protobuf:"bytes,8,opt,name=payload,proto3" json:"payload,omitempty"`
+	Metadata         map[string]string `protobuf:"bytes,9,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	RequestId        string            `protobuf:"bytes,10,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	Node             string            `protobuf:"bytes,11,opt,name=node,proto3" json:"node,omitempty"`
+	Sender           string            `protobuf:"bytes,12,opt,name=sender,proto3" json:"sender,omitempty"`
+	SentAt           *Timestamp        `protobuf:"bytes,13,opt,name=sent_at,json=sentAt,proto3" json:"sent_at,omitempty"`
+	Backfilled       bool              `protobuf:"varint,14,opt,name=backfilled,proto3" json:"backfilled,omitempty"`
+	Signature        string            `protobuf:"bytes,15,opt,name=signature,proto3" json:"signature,omitempty"`
+	KeyId            string            `protobuf:"bytes,16,opt,name=key_id,json=keyId,proto3" json:"key_id,omitempty"`
+	InvalidSignature bool              `protobuf:"varint,17,opt,name=invalid_signature,json=invalidSignature,proto3" json:"invalid_signature,omitempty"`
+	PrevHash         string            `protobuf:"bytes,18,opt,name=prev_hash,json=prevHash,proto3" json:"prev_hash,omitempty"`
+	Hash             string            `protobuf:"bytes,19,opt,name=hash,proto3" json:"hash,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_lamport_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_lamport_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_lamport_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Event) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Event) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Event) GetLamportTimestamp() uint64 {
+	if x != nil {
+		return x.LamportTimestamp
+	}
+	return 0
+}
+
+func (x *Event) GetEpoch() uint64 {
+	if x != nil {
+		return x.Epoch
+	}
+	return 0
+}
+
+func (x *Event) GetWallTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.WallTime
+	}
+	return nil
+}
+
+func (x *Event) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Event) GetSchemaVersion() int32 {
+	if x != nil {
+		return x.SchemaVersion
+	}
+	return 0
+}
+
+func (x *Event) GetPayload() []byte {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *Event) GetMetadata() map[string]string {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+func (x *Event) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *Event) GetNode() string {
+	if x != nil {
+		return x.Node
+	}
+	return ""
+}
+
+func (x *Event) GetSender() string {
+	if x != nil {
+		return x.Sender
+	}
+	return ""
+}
+
+func (x *Event) GetSentAt() *Timestamp {
+	if x != nil {
+		return x.SentAt
+	}
+	return nil
+}
+
+func (x *Event) GetBackfilled() bool {
+	if x != nil {
+		return x.Backfilled
+	}
+	return false
+}
+
+func (x *Event) GetSignature() string {
+	if x != nil {
+		return x.Signature
+	}
+	return ""
+}
+
+func (x *Event) GetKeyId() string {
+	if x != nil {
+		return x.KeyId
+	}
+	return ""
+}
+
+func (x *Event) GetInvalidSignature() bool {
+	if x != nil {
+		return x.InvalidSignature
+	}
+	return false
+}
+
+func (x *Event) GetPrevHash() string {
+	if x != nil {
+		return x.PrevHash
+	}
+	return ""
+}
+
+func (x *Event) GetHash() string {
+	if x != nil {
+		return x.Hash
+	}
+	return ""
+}
+
+// NewEvent is the body of POST /event
+type NewEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Message       string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	SchemaVersion int32                  `protobuf:"varint,3,opt,name=schema_version,json=schemaVersion,proto3" json:"schema_version,omitempty"`
+	// JSON document validated against the schema of the type
+	Payload       []byte            `protobuf:"bytes,4,opt,name=payload,proto3" json:"payload,omitempty"`
+	Metadata      map[string]string `protobuf:"bytes,5,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *NewEvent) Reset() {
+	*x = NewEvent{}
+	mi := &file_lamport_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NewEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NewEvent) ProtoMessage() {}
+
+func (x *NewEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_lamport_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NewEvent.ProtoReflect.Descriptor instead.
+func (*NewEvent) Descriptor() ([]byte, []int) {
+	return file_lamport_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *NewEvent) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *NewEvent) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *NewEvent) GetSchemaVersion() int32 {
+	if x != nil {
+		return x.SchemaVersion
+	}
+	return 0
+}
+
+func (x *NewEvent) GetPayload() []byte {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *NewEvent) GetMetadata() map[string]string {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+// Time is the answer of GET /time
+type Time struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	LamportTimestamp uint64                 `protobuf:"varint,1,opt,name=lamport_timestamp,json=lamportTimestamp,proto3" json:"lamport_timestamp,omitempty"`
+	Epoch            uint64                 `protobuf:"varint,2,opt,name=epoch,proto3" json:"epoch,omitempty"`
+	WallTime         *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=wall_time,json=wallTime,proto3" json:"wall_time,omitempty"`
+	NodeId           string                 `protobuf:"bytes,4,opt,name=node_id,json=nodeId,proto3" json:"node_id,omitempty"`
+	TimedOut         bool                   `protobuf:"varint,5,opt,name=timed_out,json=timedOut,proto3" json:"timed_out,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *Time) Reset() {
+	*x = Time{}
+	mi := &file_lamport_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Time) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Time) ProtoMessage() {}
+
+func (x *Time) ProtoReflect() protoreflect.Message {
+	mi := &file_lamport_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Time.ProtoReflect.Descriptor instead.
+func (*Time) Descriptor() ([]byte, []int) {
+	return file_lamport_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Time) GetLamportTimestamp() uint64 {
+	if x != nil {
+		return x.LamportTimestamp
+	}
+	return 0
+}
+
+func (x *Time) GetEpoch() uint64 {
+	if x != nil {
+		return x.Epoch
+	}
+	return 0
+}
+
+func (x *Time) GetWallTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.WallTime
+	}
+	return nil
+}
+
+func (x *Time) GetNodeId() string {
+	if x != nil {
+		return x.NodeId
+	}
+	return ""
+}
+
+func (x *Time) GetTimedOut() bool {
+	if x != nil {
+		return x.TimedOut
+	}
+	return false
+}
+
+// EventList is the answer of GET /events
+type EventList struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	CurrentTimestamp uint64                 `protobuf:"varint,1,opt,name=current_timestamp,json=currentTimestamp,proto3" json:"current_timestamp,omitempty"`
+	Epoch            uint64                 `protobuf:"varint,2,opt,name=epoch,proto3" json:"epoch,omitempty"`
+	EventCount       uint64                 `protobuf:"varint,3,opt,name=event_count,json=eventCount,proto3" json:"event_count,omitempty"`
+	DroppedCount     uint64                 `protobuf:"varint,4,opt,name=dropped_count,json=droppedCount,proto3" json:"dropped_count,omitempty"`
+	Events           []*Event               `protobuf:"bytes,5,rep,name=events,proto3" json:"events,omitempty"`
+	TimedOut         bool                   `protobuf:"varint,6,opt,name=timed_out,json=timedOut,proto3" json:"timed_out,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *EventList) Reset() {
+	*x = EventList{}
+	mi := &file_lamport_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EventList) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EventList) ProtoMessage() {}
+
+func (x *EventList) ProtoReflect() protoreflect.Message {
+	mi := &file_lamport_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EventList.ProtoReflect.Descriptor instead.
+func (*EventList) Descriptor() ([]byte, []int) {
+	return file_lamport_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *EventList) GetCurrentTimestamp() uint64 {
+	if x != nil {
+		return x.CurrentTimestamp
+	}
+	return 0
+}
+
+func (x *EventList) GetEpoch() uint64 {
+	if x != nil {
+		return x.Epoch
+	}
+	return 0
+}
+
+func (x *EventList) GetEventCount() uint64 {
+	if x != nil {
+		return x.EventCount
+	}
+	return 0
+}
+
+func (x *EventList) GetDroppedCount() uint64 {
+	if x != nil {
+		return x.DroppedCount
+	}
+	return 0
+}
+
+func (x *EventList) GetEvents() []*Event {
+	if x != nil {
+		return x.Events
+	}
+	return nil
+}
+
+func (x *EventList) GetTimedOut() bool {
+	if x != nil {
+		return x.TimedOut
+	}
+	return false
+}
+
+var File_lamport_proto protoreflect.FileDescriptor
+
+const file_lamport_proto_rawDesc = "" +
+	"\n" +
+	"\rlamport.proto\x12\n" +
+	"lamport.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"N\n" +
+	"\tTimestamp\x12\x14\n" +
+	"\x05epoch\x18\x01 \x01(\x04R\x05epoch\x12+\n" +
+	"\x11lamport_timestamp\x18\x02 \x01(\x04R\x10lamportTimestamp\"\xaa\x05\n" +
+	"\x05Event\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12+\n" +
+	"\x11lamport_timestamp\x18\x03 \x01(\x04R\x10lamportTimestamp\x12\x14\n" +
+	"\x05epoch\x18\x04 \x01(\x04R\x05epoch\x127\n" +
+	"\twall_time\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\bwallTime\x12\x12\n" +
+	"\x04type\x18\x06 \x01(\tR\x04type\x12%\n" +
+	"\x0eschema_version\x18\a \x01(\x05R\rschemaVersion\x12\x18\n" +
+	"\apayload\x18\b \x01(\fR\apayload\x12;\n" +
+	"\bmetadata\x18\t \x03(\v2\x1f.lamport.v1.Event.MetadataEntryR\bmetadata\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\n" +
+	" \x01(\tR\trequestId\x12\x12\n" +
+	"\x04node\x18\v \x01(\tR\x04node\x12\x16\n" +
+	"\x06sender\x18\f \x01(\tR\x06sender\x12.\n" +
+	"\asent_at\x18\r \x01(\v2\x15.lamport.v1.TimestampR\x06sentAt\x12\x1e\n" +
+	"\n" +
+	"backfilled\x18\x0e \x01(\bR\n" +
+	"backfilled\x12\x1c\n" +
+	"\tsignature\x18\x0f \x01(\tR\tsignature\x12\x15\n" +
+	"\x06key_id\x18\x10 \x01(\tR\x05keyId\x12+\n" +
+	"\x11invalid_signature\x18\x11 \x01(\bR\x10invalidSignature\x12\x1b\n" +
+	"\tprev_hash\x18\x12 \x01(\tR\bprevHash\x12\x12\n" +
+	"\x04hash\x18\x13 \x01(\tR\x04hash\x1a;\n" +
+	"\rMetadataEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xf6\x01\n" +
+	"\bNewEvent\x12\x18\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12%\n" +
+	"\x0eschema_version\x18\x03 \x01(\x05R\rschemaVersion\x12\x18\n" +
+	"\apayload\x18\x04 \x01(\fR\apayload\x12>\n" +
+	"\bmetadata\x18\x05 \x03(\v2\".lamport.v1.NewEvent.MetadataEntryR\bmetadata\x1a;\n" +
+	"\rMetadataEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xb8\x01\n" +
+	"\x04Time\x12+\n" +
+	"\x11lamport_timestamp\x18\x01 \x01(\x04R\x10lamportTimestamp\x12\x14\n" +
+	"\x05epoch\x18\x02 \x01(\x04R\x05epoch\x127\n" +
+	"\twall_time\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\bwallTime\x12\x17\n" +
+	"\anode_id\x18\x04 \x01(\tR\x06nodeId\x12\x1b\n" +
+	"\ttimed_out\x18\x05 \x01(\bR\btimedOut\"\xdc\x01\n" +
+	"\tEventList\x12+\n" +
+	"\x11current_timestamp\x18\x01 \x01(\x04R\x10currentTimestamp\x12\x14\n" +
+	"\x05epoch\x18\x02 \x01(\x04R\x05epoch\x12\x1f\n" +
+	"\vevent_count\x18\x03 \x01(\x04R\n" +
+	"eventCount\x12#\n" +
+	"\rdropped_count\x18\x04 \x01(\x04R\fdroppedCount\x12)\n" +
+	"\x06events\x18\x05 \x03(\v2\x11.lamport.v1.EventR\x06events\x12\x1b\n" +
+	"\ttimed_out\x18\x06 \x01(\bR\btimedOutBHZFgithub.com/lucasgabrielbecker/lamport_timestamp_golang/codec/lamportpbb\x06proto3"
+
+var (
+	file_lamport_proto_rawDescOnce sync.Once
+	file_lamport_proto_rawDescData []byte
+)
+
+func file_lamport_proto_rawDescGZIP() []byte {
+	file_lamport_proto_rawDescOnce.Do(func() {
+		file_lamport_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_lamport_proto_rawDesc), len(file_lamport_proto_rawDesc)))
+	})
+	return file_lamport_proto_rawDescData
+}
+
+var file_lamport_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_lamport_proto_goTypes = []any{
+	(*Timestamp)(nil),             // 0: lamport.v1.Timestamp
+	(*Event)(nil),                 // 1: lamport.v1.Event
+	(*NewEvent)(nil),              // 2: lamport.v1.NewEvent
+	(*Time)(nil),                  // 3: lamport.v1.Time
+	(*EventList)(nil),             // 4: lamport.v1.EventList
+	nil,                           // 5: lamport.v1.Event.MetadataEntry
+	nil,                           // 6: lamport.v1.NewEvent.MetadataEntry
+	(*timestamppb.Timestamp)(nil), // 7: google.protobuf.Timestamp
+}
+var file_lamport_proto_depIdxs = []int32{
+	7, // 0: lamport.v1.Event.wall_time:type_name -> google.protobuf.Timestamp
+	5, // 1: lamport.v1.Event.metadata:type_name -> lamport.v1.Event.MetadataEntry
+	0, // 2: lamport.v1.Event.sent_at:type_name -> lamport.v1.Timestamp
+	6, // 3: lamport.v1.NewEvent.metadata:type_name -> lamport.v1.NewEvent.MetadataEntry
+	7, // 4: lamport.v1.Time.wall_time:type_name -> google.protobuf.Timestamp
+	1, // 5: lamport.v1.EventList.events:type_name -> lamport.v1.Event
+	6, // [6:6] is the sub-list for method output_type
+	6, // [6:6] is the sub-list for method input_type
+	6, // [6:6] is the sub-list for extension type_name
+	6, // [6:6] is the sub-list for extension extendee
+	0, // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_lamport_proto_init() }
+func file_lamport_proto_init() {
+	if File_lamport_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_lamport_proto_rawDesc), len(file_lamport_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_lamport_proto_goTypes,
+		DependencyIndexes: file_lamport_proto_depIdxs,
+		MessageInfos:      file_lamport_proto_msgTypes,
+	}.Build()
+	File_lamport_proto = out.File
+	file_lamport_proto_goTypes = nil
+	file_lamport_proto_depIdxs = nil
+}
@@ -0,0 +1,174 @@
+// The Clock service, served on the HTTP port of a node to gRPC, gRPC-Web
+// and Connect clients. Calls carry Lamport timestamps in the
+// lamport-timestamp metadata key.
+
+// Code generated by protoc-gen-connect-go. DO NOT EDIT.
+//
+// Source: clock.proto
+
+package lamportpbconnect
+
+import (
+	connect "connectrpc.com/connect"
+	context "context"
+	errors "errors"
+	lamportpb "github.com/lucasgabrielbecker/lamport_timestamp_golang/codec/lamportpb"
+	http "net/http"
+	strings "strings"
+)
+
+// This is a compile-time assertion to ensure that this generated file and the connect package are
+// compatible. If you get a compiler error that this constant is not defined, this code was
+// generated with a version of connect newer than the one compiled into your binary. You can fix the
+// problem by either regenerating this code with an older version of connect or updating the connect
+// version compiled into your binary.
+const _ = connect.IsAtLeastVersion1_13_0
+
+const (
+	// ClockName is the fully-qualified name of the Clock service.
+	ClockName = "lamport.v1.Clock"
+)
+
+// These constants are the fully-qualified names of the RPCs defined in this package. They're
+// exposed at runtime as Spec.Procedure and as the final two segments of the HTTP route.
+//
+// Note that these are different from the fully-qualified method names used by
+// google.golang.org/protobuf/reflect/protoreflect. To convert from these constants to
+// reflection-formatted method names, remove the leading slash and convert the remaining slash to a
+// period.
+const (
+	// ClockTickProcedure is the fully-qualified name of the Clock's Tick RPC.
+	ClockTickProcedure = "/lamport.v1.Clock/Tick"
+	// ClockUpdateProcedure is the fully-qualified name of the Clock's Update RPC.
+	ClockUpdateProcedure = "/lamport.v1.Clock/Update"
+	// ClockStreamEventsProcedure is the fully-qualified name of the Clock's StreamEvents RPC.
+	ClockStreamEventsProcedure = "/lamport.v1.Clock/StreamEvents"
+)
+
+// ClockClient is a client for the lamport.v1.Clock service.
+type ClockClient interface {
+	// Tick records a local event, as POST /event
+	Tick(context.Context, *connect.Request[lamportpb.NewEvent]) (*connect.Response[lamportpb.Event], error)
+	// Update records a message received from another node, as POST /message
+	Update(context.Context, *connect.Request[lamportpb.UpdateRequest]) (*connect.Response[lamportpb.Event], error)
+	// StreamEvents follows new events, as GET /events/stream
+	StreamEvents(context.Context, *connect.Request[lamportpb.StreamEventsRequest]) (*connect.ServerStreamForClient[lamportpb.Event], error)
+}
+
+// NewClockClient constructs a client for the lamport.v1.Clock service. By default, it uses the
+// Connect protocol with the binary Protobuf Codec, asks for gzipped responses, and sends
+// uncompressed requests. To use the gRPC or gRPC-Web protocols, supply the connect.WithGRPC() or
+// connect.WithGRPCWeb() options.
+//
+// The URL supplied here should be the base URL for the Connect or gRPC server (for example,
+// http://api.acme.com or https://acme.com/grpc).
+func NewClockClient(httpClient connect.HTTPClient, baseURL string, opts ...connect.ClientOption) ClockClient {
+	baseURL = strings.TrimRight(baseURL, "/")
+	clockMethods := lamportpb.File_clock_proto.Services().ByName("Clock").Methods()
+	return &clockClient{
+		tick: connect.NewClient[lamportpb.NewEvent, lamportpb.Event](
+			httpClient,
+			baseURL+ClockTickProcedure,
+			connect.WithSchema(clockMethods.ByName("Tick")),
+			connect.WithClientOptions(opts...),
+		),
+		update: connect.NewClient[lamportpb.UpdateRequest, lamportpb.Event](
+			httpClient,
+			baseURL+ClockUpdateProcedure,
+			connect.WithSchema(clockMethods.ByName("Update")),
+			connect.WithClientOptions(opts...),
+		),
+		streamEvents: connect.NewClient[lamportpb.StreamEventsRequest, lamportpb.Event](
+			httpClient,
+			baseURL+ClockStreamEventsProcedure,
+			connect.WithSchema(clockMethods.ByName("StreamEvents")),
+			connect.WithClientOptions(opts...),
+		),
+	}
+}
+
+// clockClient implements ClockClient.
+type clockClient struct {
+	tick         *connect.Client[lamportpb.NewEvent, lamportpb.Event]
+	update       *connect.Client[lamportpb.UpdateRequest, lamportpb.Event]
+	streamEvents *connect.Client[lamportpb.StreamEventsRequest, lamportpb.Event]
+}
+
+// Tick calls lamport.v1.Clock.Tick.
+func (c *clockClient) Tick(ctx context.Context, req *connect.Request[lamportpb.NewEvent]) (*connect.Response[lamportpb.Event], error) {
+	return c.tick.CallUnary(ctx, req)
+}
+
+// Update calls lamport.v1.Clock.Update.
+func (c *clockClient) Update(ctx context.Context, req *connect.Request[lamportpb.UpdateRequest]) (*connect.Response[lamportpb.Event], error) {
+	return c.update.CallUnary(ctx, req)
+}
+
+// StreamEvents calls lamport.v1.Clock.StreamEvents.
+func (c *clockClient) StreamEvents(ctx context.Context, req *connect.Request[lamportpb.StreamEventsRequest]) (*connect.ServerStreamForClient[lamportpb.Event], error) {
+	return c.streamEvents.CallServerStream(ctx, req)
+}
+
+// ClockHandler is an implementation of the lamport.v1.Clock service.
+type ClockHandler interface {
+	// Tick records a local event, as POST /event
+	Tick(context.Context, *connect.Request[lamportpb.NewEvent]) (*connect.Response[lamportpb.Event], error)
+	// Update records a message received from another node, as POST /message
+	Update(context.Context, *connect.Request[lamportpb.UpdateRequest]) (*connect.Response[lamportpb.Event], error)
+	// StreamEvents follows new events, as GET /events/stream
+	StreamEvents(context.Context, *connect.Request[lamportpb.StreamEventsRequest], *connect.ServerStream[lamportpb.Event]) error
+}
+
+// NewClockHandler builds an HTTP handler from the service implementation. It returns the path on
+// which to mount the handler and the handler itself.
+//
+// By default, handlers support the Connect, gRPC, and gRPC-Web protocols with the binary Protobuf
+// and JSON codecs. They also support gzip compression.
+func NewClockHandler(svc ClockHandler, opts ...connect.HandlerOption) (string, http.Handler) {
+	clockMethods := lamportpb.File_clock_proto.Services().ByName("Clock").Methods()
+	clockTickHandler := connect.NewUnaryHandler(
+		ClockTickProcedure,
+		svc.Tick,
+		connect.WithSchema(clockMethods.ByName("Tick")),
+		connect.WithHandlerOptions(opts...),
+	)
+	clockUpdateHandler := connect.NewUnaryHandler(
+		ClockUpdateProcedure,
+		svc.Update,
+		connect.WithSchema(clockMethods.ByName("Update")),
+		connect.WithHandlerOptions(opts...),
+	)
+	clockStreamEventsHandler := connect.NewServerStreamHandler(
+		ClockStreamEventsProcedure,
+		svc.StreamEvents,
+		connect.WithSchema(clockMethods.ByName("StreamEvents")),
+		connect.WithHandlerOptions(opts...),
+	)
+	return "/lamport.v1.Clock/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case ClockTickProcedure:
+			clockTickHandler.ServeHTTP(w, r)
+		case ClockUpdateProcedure:
+			clockUpdateHandler.ServeHTTP(w, r)
+		case ClockStreamEventsProcedure:
+			clockStreamEventsHandler.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// UnimplementedClockHandler returns CodeUnimplemented from all methods.
+type UnimplementedClockHandler struct{}
+
+func (UnimplementedClockHandler) Tick(context.Context, *connect.Request[lamportpb.NewEvent]) (*connect.Response[lamportpb.Event], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("lamport.v1.Clock.Tick is not implemented"))
+}
+
+func (UnimplementedClockHandler) Update(context.Context, *connect.Request[lamportpb.UpdateRequest]) (*connect.Response[lamportpb.Event], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("lamport.v1.Clock.Update is not implemented"))
+}
+
+func (UnimplementedClockHandler) StreamEvents(context.Context, *connect.Request[lamportpb.StreamEventsRequest], *connect.ServerStream[lamportpb.Event]) error {
+	return connect.NewError(connect.CodeUnimplemented, errors.New("lamport.v1.Clock.StreamEvents is not implemented"))
+}
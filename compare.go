@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec"
+)
+
+// Relations between two events under happened-before
+const (
+	relationBefore     = codec.Before
+	relationAfter      = codec.After
+	relationConcurrent = codec.Concurrent
+	relationEqual      = codec.Equal
+)
+
+// compareEvents relates two nodes of a causality graph. It returns the
+// relation and, for before and after, the chain of events proving it.
+func compareEvents(g CausalityGraph, a, b string) (Ordering, []string) {
+	if a == b {
+		return relationEqual, nil
+	}
+	if path := g.path(a, b); path != nil {
+		return relationBefore, path
+	}
+	if path := g.path(b, a); path != nil {
+		return relationAfter, path
+	}
+	return relationConcurrent, nil
+}
+
+// handleCompare reports whether event a happened before, after or
+// concurrently with event b, following process order and message links
+// rather than comparing Lamport timestamps
+func (s *Server) handleCompare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	a, b := r.URL.Query().Get("a"), r.URL.Query().Get("b")
+	if a == "" || b == "" {
+		http.Error(w, "Missing a or b parameter", http.StatusBadRequest)
+		return
+	}
+
+	graph, ok := s.graphScope(w, r)
+	if !ok {
+		return
+	}
+	nodeA, okA := graph.node(a)
+	nodeB, okB := graph.node(b)
+	if !okA || !okB {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+
+	relation, path := compareEvents(graph, a, b)
+	response := map[string]interface{}{
+		"a":        nodeA,
+		"b":        nodeB,
+		"relation": relation,
+	}
+	if path != nil {
+		response["path"] = path
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func compareRequest(server *Server, query string) (int, map[string]interface{}) {
+	req := httptest.NewRequest(http.MethodGet, "/compare?"+query, nil)
+	w := httptest.NewRecorder()
+	server.handleCompare(w, req)
+
+	var response map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&response)
+	return w.Code, response
+}
+
+func TestCompareVirtualClocks(t *testing.T) {
+	server := NewServer()
+	// alice: a1 -> a2 (send) ; bob: b1, b2 receives a2 ; carol: c1
+	clockRequest(server, http.MethodPost, "/clocks/alice/tick?message=a1")                           // alice 1
+	clockRequest(server, http.MethodPost, "/clocks/alice/tick?message=a2")                           // alice 2
+	clockRequest(server, http.MethodPost, "/clocks/bob/tick?message=b1")                             // bob 1
+	clockRequest(server, http.MethodPost, "/clocks/bob/tick?message=b1b")                            // bob 2
+	clockRequest(server, http.MethodPost, "/clocks/bob/tick?message=b1c")                            // bob 3
+	clockRequest(server, http.MethodPost, "/clocks/carol/tick?message=c1")                           // carol 1
+	clockRequest(server, http.MethodPost, "/clocks/carol/tick?message=c2")                           // carol 2
+	clockRequest(server, http.MethodPost, "/clocks/carol/tick?message=c3")                           // carol 3
+	clockRequest(server, http.MethodPost, "/clocks/carol/tick?message=c4")                           // carol 4
+	clockRequest(server, http.MethodPost, "/clocks/carol/tick?message=c5")                           // carol 5
+	clockRequest(server, http.MethodPost, "/clocks/bob/message?timestamp=2&message=hi&sender=alice") // bob 4
+
+	id := func(clock string, i int) string {
+		vc, _ := server.clocks.Get(clock, false)
+		return vc.Events()[i].ID
+	}
+	a1, a2, b1, received, c5 := id("alice", 0), id("alice", 1), id("bob", 0), id("bob", 3), id("carol", 4)
+
+	cases := []struct {
+		a, b     string
+		relation Ordering
+	}{
+		{a1, received, relationBefore},
+		{received, a1, relationAfter},
+		{a2, b1, relationConcurrent},
+		// c5 has the higher timestamp, yet nothing links it to bob
+		{received, c5, relationConcurrent},
+		{a1, a1, relationEqual},
+	}
+	for _, c := range cases {
+		code, response := compareRequest(server, "scope=clocks&a="+c.a+"&b="+c.b)
+		if code != http.StatusOK || response["relation"] != string(c.relation) {
+			t.Errorf("%s vs %s: expected %s, got %d %v", c.a, c.b, c.relation, code, response["relation"])
+		}
+	}
+
+	_, response := compareRequest(server, "scope=clocks&a="+a1+"&b="+received)
+	path, _ := response["path"].([]interface{})
+	if len(path) != 3 || path[0] != a1 || path[1] != a2 || path[2] != received {
+		t.Errorf("Expected path through the send event, got %v", response["path"])
+	}
+}
+
+func TestCompareMainLog(t *testing.T) {
+	server := NewServer()
+	server.logEvent("e1", "Local")                                                 // 1
+	server.receiveMessage(t.Context(), "b", "", ClockTime{Timestamp: 5}, "From b") // 6
+	server.receiveMessage(t.Context(), "c", "", ClockTime{Timestamp: 3}, "From c") // 7
+
+	if _, r := compareRequest(server, "a=e1&b=msg-7"); r["relation"] != string(relationBefore) {
+		t.Errorf("Expected local events to be ordered, got %v", r["relation"])
+	}
+	// Sends on b and c are only linked through this node
+	if _, r := compareRequest(server, "a=send:b:5&b=send:c:3"); r["relation"] != string(relationConcurrent) {
+		t.Errorf("Expected sends of different peers to be concurrent, got %v", r["relation"])
+	}
+
+	if code, _ := compareRequest(server, "a=e1"); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without b, got %d", code)
+	}
+	if code, _ := compareRequest(server, "a=e1&b=missing"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown event, got %d", code)
+	}
+	if code, _ := compareRequest(server, "a=e1&b=e1&scope=all"); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for unknown scope, got %d", code)
+	}
+}
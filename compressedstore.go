@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/snappy"
+)
+
+// CompressedStore keeps the event log in memory in blocks of events,
+// encoded as JSON lines and compressed with snappy, and the newest events
+// in an uncompressed tail that is sealed into a block when it fills up.
+// Reads decompress the blocks they need lazily; the block decoded last is
+// kept, so lookups close together pay for one decompression. The log is
+// indexed by time and ID but not by trigram, whose index would take more
+// memory than compression saves, so searches decompress every block.
+type CompressedStore struct {
+	blocks    []compressedBlock
+	tail      []Event
+	blockSize int
+	first     int64 // position of the oldest event kept
+	n         int
+	dropped   int64
+	times     timeIndex
+	ids       map[string][]int64
+	decoded   atomic.Pointer[decodedBlock] // block decoded last
+	mutex     sync.RWMutex
+}
+
+// compressedBlock holds the events from position first on, in order
+type compressedBlock struct {
+	first   int64
+	n       int
+	encoded int // bytes before compression
+	data    []byte
+}
+
+type decodedBlock struct {
+	first  int64
+	events []Event
+}
+
+// CompressionStats describes the memory the compressed log takes
+type CompressionStats struct {
+	Blocks          int     `json:"blocks"`
+	BlockSize       int     `json:"block_size"`
+	CompressedBytes int64   `json:"compressed_bytes"`
+	EncodedBytes    int64   `json:"encoded_bytes"` // the blocks before compression
+	Ratio           float64 `json:"ratio"`
+	TailEvents      int     `json:"tail_events"`
+}
+
+// NewCompressedStore creates an empty store compressing blocks of
+// blockSize events
+func NewCompressedStore(blockSize int) *CompressedStore {
+	blockSize = max(blockSize, 1)
+	return &CompressedStore{blockSize: blockSize, tail: make([]Event, 0, blockSize), ids: make(map[string][]int64)}
+}
+
+// tailFirst is the position of the oldest event of the tail
+func (st *CompressedStore) tailFirst() int64 {
+	if len(st.blocks) == 0 {
+		return st.first
+	}
+	last := st.blocks[len(st.blocks)-1]
+	return last.first + int64(last.n)
+}
+
+func (st *CompressedStore) Append(event Event) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	st.appendLocked(event)
+}
+
+func (st *CompressedStore) appendLocked(event Event) {
+	seq := st.tailFirst() + int64(len(st.tail))
+	st.tail = append(st.tail, event)
+	st.times.add(timeEntry{event.clockTime(), seq})
+	st.ids[event.ID] = append(st.ids[event.ID], seq)
+	st.n++
+	if len(st.tail) >= st.blockSize {
+		st.blocks = append(st.blocks, compressBlock(st.tailFirst(), st.tail))
+		st.tail = make([]Event, 0, st.blockSize)
+	}
+}
+
+// compressBlock encodes and compresses events stored from position first
+func compressBlock(first int64, events []Event) compressedBlock {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for i := range events {
+		// Events are built from JSON, so they always encode
+		enc.Encode(&events[i])
+	}
+	return compressedBlock{first: first, n: len(events), encoded: buf.Len(), data: snappy.Encode(nil, buf.Bytes())}
+}
+
+// decode returns the events of a block, from the last decoded block when
+// it is the same one. The blocks are made by compressBlock, so a block
+// that does not decode means memory was corrupted.
+func (st *CompressedStore) decode(b compressedBlock) []Event {
+	if cached := st.decoded.Load(); cached != nil && cached.first == b.first && len(cached.events) == b.n {
+		return cached.events
+	}
+	data, err := snappy.Decode(nil, b.data)
+	if err != nil {
+		panic(fmt.Sprintf("corrupt compressed block at %d: %v", b.first, err))
+	}
+	events := make([]Event, 0, b.n)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var e Event
+		if err := dec.Decode(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			panic(fmt.Sprintf("corrupt compressed block at %d: %v", b.first, err))
+		}
+		events = append(events, e)
+	}
+	st.decoded.Store(&decodedBlock{first: b.first, events: events})
+	return events
+}
+
+// at returns the event at position seq, decompressing its block
+func (st *CompressedStore) at(seq int64) Event {
+	if tail := st.tailFirst(); seq >= tail {
+		return st.tail[seq-tail]
+	}
+	i := sort.Search(len(st.blocks), func(i int) bool { return st.blocks[i].first > seq }) - 1
+	b := st.blocks[i]
+	return st.decode(b)[seq-b.first]
+}
+
+func (st *CompressedStore) Events() []Event {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	events := make([]Event, 0, st.n)
+	for _, b := range st.blocks {
+		events = append(events, st.decode(b)...)
+	}
+	return append(events, st.tail...)
+}
+
+func (st *CompressedStore) Len() int {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	return st.n
+}
+
+func (st *CompressedStore) Dropped() int64 {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	return st.dropped
+}
+
+// Trim drops whole blocks, and recompresses what is left of a block cut
+// in the middle
+func (st *CompressedStore) Trim(n int) []Event {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	k := min(max(n, 0), st.n)
+	trimmed := make([]Event, 0, k)
+	for k > 0 && len(st.blocks) > 0 {
+		b := st.blocks[0]
+		events := st.decode(b)
+		if b.n <= k {
+			trimmed = append(trimmed, events...)
+			st.blocks = st.blocks[1:]
+			k -= b.n
+			continue
+		}
+		trimmed = append(trimmed, events[:k]...)
+		st.blocks[0] = compressBlock(b.first+int64(k), events[k:])
+		k = 0
+	}
+	trimmed = append(trimmed, st.tail[:k]...)
+	st.tail = append(st.tail[:0:0], st.tail[k:]...)
+
+	for i, e := range trimmed {
+		seq := st.first + int64(i)
+		st.times.remove(e.clockTime(), seq)
+		if list := removeSeq(st.ids[e.ID], seq); len(list) > 0 {
+			st.ids[e.ID] = list
+		} else {
+			delete(st.ids, e.ID)
+		}
+	}
+	st.first += int64(len(trimmed))
+	st.n -= len(trimmed)
+	st.dropped += int64(len(trimmed))
+	st.decoded.Store(nil)
+	return trimmed
+}
+
+func (st *CompressedStore) Replace(events []Event) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	st.blocks, st.tail = nil, make([]Event, 0, st.blockSize)
+	st.first, st.n = 0, 0
+	st.times.reset()
+	st.ids = make(map[string][]int64)
+	st.decoded.Store(nil)
+	for _, e := range events {
+		st.appendLocked(e)
+	}
+}
+
+func (st *CompressedStore) Between(from, to ClockTime) []Event {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	entries := st.times.between(from, to)
+	events := make([]Event, len(entries))
+	for i, entry := range entries {
+		events[i] = st.at(entry.seq)
+	}
+	return events
+}
+
+func (st *CompressedStore) Find(id string) (Event, bool) {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	if list := st.ids[id]; len(list) > 0 {
+		return st.at(list[0]), true
+	}
+	return Event{}, false
+}
+
+func (st *CompressedStore) Search(text string) []Event {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	var events []Event
+	for _, b := range st.blocks {
+		for _, e := range st.decode(b) {
+			if strings.Contains(e.Message, text) {
+				events = append(events, e)
+			}
+		}
+	}
+	for _, e := range st.tail {
+		if strings.Contains(e.Message, text) {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// Stats reports the size of the blocks
+func (st *CompressedStore) Stats() CompressionStats {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	stats := CompressionStats{Blocks: len(st.blocks), BlockSize: st.blockSize, TailEvents: len(st.tail)}
+	for _, b := range st.blocks {
+		stats.CompressedBytes += int64(len(b.data))
+		stats.EncodedBytes += int64(b.encoded)
+	}
+	if stats.CompressedBytes > 0 {
+		stats.Ratio = float64(stats.EncodedBytes) / float64(stats.CompressedBytes)
+	}
+	return stats
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCompressedStoreBlocks(t *testing.T) {
+	st := NewCompressedStore(4)
+	wall := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := 1; i <= 10; i++ {
+		st.Append(Event{ID: fmt.Sprintf("e%d", i), Timestamp: int64(i), WallTime: wall, Message: "payment", Metadata: map[string]string{"n": fmt.Sprint(i)}})
+	}
+	if stats := st.Stats(); stats.Blocks != 2 || stats.TailEvents != 2 || stats.CompressedBytes == 0 || stats.Ratio <= 1 {
+		t.Errorf("Expected 2 compressed blocks and a tail of 2, got %+v", stats)
+	}
+	events := st.Events()
+	if len(events) != 10 || events[5].ID != "e6" || events[5].Metadata["n"] != "6" || !events[5].WallTime.Equal(wall) {
+		t.Fatalf("Expected the events back as appended, got %v", events)
+	}
+	if e, ok := st.Find("e7"); !ok || e.Timestamp != 7 {
+		t.Errorf("Expected e7 from the second block, got %+v %v", e, ok)
+	}
+
+	// Trimming into a block recompresses what is left of it
+	if trimmed := st.Trim(6); len(trimmed) != 6 || trimmed[5].ID != "e6" {
+		t.Fatalf("Expected e1 to e6 trimmed, got %v", eventIDs(trimmed))
+	}
+	if stats := st.Stats(); stats.Blocks != 1 || st.Len() != 4 || st.Dropped() != 6 {
+		t.Errorf("Expected 1 block of 2 left with 6 dropped, got %+v, %d and %d", stats, st.Len(), st.Dropped())
+	}
+	if got := fmt.Sprint(eventIDs(st.Between(ClockTime{Timestamp: 1}, ClockTime{Timestamp: 8}))); got != "[e7 e8]" {
+		t.Errorf("Expected e7 and e8, got %s", got)
+	}
+	for i := 11; i <= 13; i++ {
+		st.Append(Event{ID: fmt.Sprintf("e%d", i), Timestamp: int64(i)})
+	}
+	if events := st.Events(); len(events) != 7 || events[0].ID != "e7" || events[6].ID != "e13" {
+		t.Errorf("Expected e7 to e13, got %v", eventIDs(events))
+	}
+	if e, ok := st.Find("e12"); !ok || e.Timestamp != 12 {
+		t.Errorf("Expected e12 after the trim, got %+v %v", e, ok)
+	}
+}
+
+func TestMemoryEndpoint(t *testing.T) {
+	server := NewServer()
+	server.events = NewCompressedStore(2)
+	for _, id := range []string{"e1", "e2", "e3"} {
+		server.logEvent(id, "hello")
+	}
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/analytics/memory", nil))
+	var usage MemoryUsage
+	if err := json.NewDecoder(rec.Body).Decode(&usage); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("Expected the memory usage, got %d %v", rec.Code, err)
+	}
+	if usage.HeapAlloc == 0 || usage.Goroutines == 0 || usage.Events != 3 {
+		t.Errorf("Expected the heap and 3 events, got %+v", usage)
+	}
+	if usage.Compression == nil || usage.Compression.Blocks != 1 || usage.Compression.TailEvents != 1 {
+		t.Errorf("Expected a block and a tail event, got %+v", usage.Compression)
+	}
+
+	server.events = NewShardedStore(4)
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/analytics/memory", nil))
+	if usage := (MemoryUsage{}); json.Unmarshal(rec.Body.Bytes(), &usage) != nil || usage.Compression != nil {
+		t.Errorf("Expected no compression stats without a compressed log, got %s", rec.Body)
+	}
+}
+
+// heapInUse is the live heap after a collection
+func heapInUse() uint64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+// BenchmarkEventLogFootprint reports the heap a log of a million events
+// takes, kept as it is or compressed
+func BenchmarkEventLogFootprint(b *testing.B) {
+	const events = 1_000_000
+	wall := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for name, newStore := range map[string]func() EventStore{
+		"sharded":    func() EventStore { return NewShardedStore(defaultEventShards) },
+		"compressed": func() EventStore { return NewCompressedStore(1024) },
+	} {
+		b.Run(name, func(b *testing.B) {
+			for b.Loop() {
+				before := heapInUse()
+				st := newStore()
+				for i := range events {
+					st.Append(Event{
+						ID:        fmt.Sprintf("node-1-%d", i),
+						Message:   "order shipped",
+						Timestamp: int64(i),
+						WallTime:  wall.Add(time.Duration(i) * time.Millisecond),
+						Node:      "node-1",
+					})
+				}
+				b.ReportMetric(float64(heapInUse()-before)/events, "bytes/event")
+				runtime.KeepAlive(st)
+			}
+		})
+	}
+}
+
+func BenchmarkCompressedStoreAppend(b *testing.B) {
+	st := NewCompressedStore(1024)
+	i := 0
+	for b.Loop() {
+		st.Append(Event{ID: fmt.Sprintf("e%d", i), Message: "order shipped", Timestamp: int64(i)})
+		i++
+	}
+}
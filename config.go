@@ -0,0 +1,723 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// Config holds the runtime configuration of the server
+type Config struct {
+	// ConfigFile holds flag values as a JSON object, read on start and on
+	// reload. Flags given on the command line take precedence.
+	ConfigFile string
+
+	// Addr is the address the HTTP server listens on
+	Addr string
+
+	// The server gives clients ReadHeaderTimeout to send the headers of a
+	// request, ReadTimeout for all of it, and closes connections idle for
+	// IdleTimeout. Limits.Timeout bounds how long handlers run, with
+	// overrides per path, and Limits.WriteTimeout the time left to write
+	// the response after that. Request bodies are cut at Limits.MaxBody.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	IdleTimeout       time.Duration
+	Limits            RequestLimits
+
+	// CORS lets pages of other origins call the API; no origins disables it
+	CORS CORS
+
+	// PathPrefix, such as /lamport, is where every route is served behind a
+	// reverse proxy or next to other services; empty serves them at the root
+	PathPrefix string
+
+	// NodeID identifies this node to its peers and breaks timestamp ties
+	NodeID string
+
+	// Peers are the base URLs of the other nodes in the cluster
+	Peers []string
+
+	// Join is the base URL of a cluster member to register with on startup.
+	// AdvertiseURL is the base URL other nodes reach this one at; nodes
+	// with it set accept joins even without static peers.
+	Join         string
+	AdvertiseURL string
+
+	// PeerTransport carries requests between nodes: http, or grpc and udp,
+	// which listen on TransportAddr and list peers by the host:port of
+	// their own transport listener
+	PeerTransport string
+	TransportAddr string
+
+	// TLSCertFile and TLSKeyFile enable HTTPS when both are set. The same
+	// key pair is presented as client certificate on outgoing peer links.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// TLSCAFile is the CA bundle used to verify peer certificates. When set,
+	// inter-node endpoints require a client certificate signed by it.
+	TLSCAFile string
+
+	// AdminToken guards the /admin endpoints. Admin endpoints are open when
+	// it is empty, which is only meant for local experiments.
+	AdminToken string
+
+	// AdminDenyDefault refuses admin endpoints when AdminToken is empty,
+	// instead of leaving them open
+	AdminDenyDefault bool
+
+	// RolesFile maps API keys to roles, and JWTSecret verifies bearer tokens
+	// whose roles claim grants them. Either makes every endpoint require the
+	// role of its group; requests without credentials get AnonymousRoles.
+	// PeerToken is sent to peers, which must grant it the peer role.
+	RolesFile      string
+	JWTSecret      string
+	AnonymousRoles []string
+	PeerToken      string
+
+	// MaxJump bounds how far a received timestamp may move the clock ahead
+	// of local time; zero disables the check
+	MaxJump       int64
+	MaxJumpPolicy JumpPolicy
+
+	// SigningKey is the Ed25519 key file events are signed with, created
+	// when missing. TrustedKeys lists the public keys of other nodes whose
+	// signatures are verified; SignaturePolicy decides what happens to
+	// messages whose signature does not verify.
+	SigningKey      string
+	TrustedKeys     string
+	SignaturePolicy SignaturePolicy
+
+	// EventShards is the number of independently locked shards the event
+	// log is spread over. With EventCapacity set the log is a ring buffer
+	// of that many events instead, overwriting the oldest.
+	EventShards   int
+	EventCapacity int
+
+	// EventCompression keeps the event log in snappy compressed blocks of
+	// this many events, decompressed when read (0 keeps events as they are)
+	EventCompression int
+
+	// EventDB keeps the event log in an SQLite database at this path, kept
+	// across restarts and queried with POST /query
+	EventDB string
+
+	// EventPostgres keeps the event log and the clock in the PostgreSQL
+	// database at this URL, shared by every server pointed at it
+	EventPostgres string
+
+	// WALFile keeps the event log in memory but writes every change, and
+	// the clock, to a write-ahead log at this path first, replayed on
+	// start. WALSync decides when it is flushed to disk: on every write, every
+	// WALSyncInterval or when the operating system sees fit.
+	WALFile         string
+	WALSync         SyncPolicy
+	WALSyncInterval time.Duration
+
+	// EncryptionKeyEnv names the environment variable holding the keys that
+	// encrypt event messages and payloads in the persistent store, or
+	// EncryptionKeyCommand is run to print them, as with a key management
+	// service. Events are kept in the clear when both are empty.
+	EncryptionKeyEnv     string
+	EncryptionKeyCommand string
+
+	// Events logged more than RollupAge ago are trimmed off the log every
+	// RollupInterval and only counted per bucket of RollupBucket timestamps.
+	// Zero RollupAge keeps every event in full.
+	RollupAge      time.Duration
+	RollupBucket   int64
+	RollupInterval time.Duration
+
+	// ArchiveURL enables archival: every ArchiveInterval, events logged more
+	// than ArchiveAge ago move off the log into segments of up to
+	// ArchiveSegment events, kept at s3://bucket/prefix on ArchiveEndpoint
+	// or in a file:// directory.
+	ArchiveURL      string
+	ArchiveEndpoint string
+	ArchiveAge      time.Duration
+	ArchiveInterval time.Duration
+	ArchiveSegment  int
+
+	// HeartbeatInterval is how often the failure detector polls every peer.
+	// Peers silent for SuspectAfter are suspected, for DeadAfter dead.
+	HeartbeatInterval time.Duration
+	SuspectAfter      time.Duration
+	DeadAfter         time.Duration
+
+	// SyncInterval is how often the log is reconciled with every peer, zero
+	// leaving it to POST /cluster/sync. Logs are compared in ranges of
+	// SyncBucket timestamps.
+	SyncInterval time.Duration
+	SyncBucket   int64
+
+	// SendFile keeps the sequence numbers and unacknowledged messages of
+	// POST /send across restarts, in memory only when empty. Unacknowledged
+	// messages are sent again every SendRetry.
+	SendFile  string
+	SendRetry time.Duration
+
+	// OutboxFile keeps the messages written with POST /outbox until they
+	// are delivered; pending ones are dispatched again every
+	// OutboxInterval.
+	OutboxFile     string
+	OutboxInterval time.Duration
+
+	// ElectionInterval is how often the elected leader announces itself to
+	// its peers; a new election starts once nothing was heard from it for
+	// ElectionTimeout
+	ElectionInterval time.Duration
+	ElectionTimeout  time.Duration
+
+	// TieBreaker orders events with equal Lamport times in total order
+	// listings and multicast delivery
+	TieBreaker TieBreaker
+
+	// RateLimit is the sustained number of state-changing requests per second
+	// allowed per client, with bursts of up to RateBurst; zero disables it
+	RateLimit float64
+	RateBurst int
+
+	// IngestQueue bounds the events and messages waiting for one of the
+	// IngestWorkers; beyond it, or after waiting IngestTimeout, requests are
+	// turned away with 503. Zero disables the queue.
+	IngestQueue   int
+	IngestWorkers int
+	IngestTimeout time.Duration
+	// RateLimitByAPIKey keys clients by their X-API-Key header instead of IP
+	RateLimitByAPIKey bool
+
+	// LogLevel and LogFormat (json or text) configure the structured logger.
+	// When LogFile is set logs are written there and rotated once they reach
+	// LogMaxSizeMB, keeping LogMaxBackups old files.
+	LogLevel      string
+	LogFormat     string
+	LogFile       string
+	LogMaxSizeMB  int
+	LogMaxBackups int
+
+	// ClockFile is where the clock is persisted every ClockPersistInterval
+	// and on shutdown. On startup the clock resumes from the saved value plus
+	// ClockSafetyMargin, which must exceed the ticks issued per interval.
+	ClockFile            string
+	ClockPersistInterval time.Duration
+	ClockSafetyMargin    int64
+
+	// NATSURL enables the NATS bridge. Messages on NATSSubject are merged
+	// through the clock; local events are published to NATSPublishSubject
+	// when it is set.
+	NATSURL            string
+	NATSSubject        string
+	NATSPublishSubject string
+
+	// KafkaBrokers enables the Kafka bridge. Records on KafkaTopic are merged
+	// through the clock, committing offsets for KafkaGroup; local events are
+	// produced to KafkaPublishTopic when it is set. The timestamp is read from
+	// the KafkaTimestampHeader header, or from the KafkaTimestampField field
+	// of JSON values when that is set.
+	KafkaBrokers         []string
+	KafkaTopic           string
+	KafkaGroup           string
+	KafkaPublishTopic    string
+	KafkaTimestampHeader string
+	KafkaTimestampField  string
+
+	// MQTTBroker enables the MQTT bridge. Envelopes on MQTTTopic (which may
+	// contain wildcards) are merged through the clock; local events are
+	// published to MQTTPublishTopic when it is set.
+	MQTTBroker       string
+	MQTTTopic        string
+	MQTTPublishTopic string
+	MQTTQoS          byte
+	MQTTClientID     string
+	MQTTUsername     string
+	MQTTPassword     string
+
+	// UDPAddr enables the UDP synchronization listener. Every UDPInterval the
+	// current time is sent to UDPPeers (host:port addresses), the only
+	// addresses beacons are merged from.
+	UDPAddr     string
+	UDPPeers    []string
+	UDPInterval time.Duration
+
+	// TextAddr enables the line based text protocol listener over TCP
+	TextAddr string
+
+	// TenantsFile lists tenants with their API keys, quotas and retention.
+	// When set, virtual clocks are scoped to the tenant of the request.
+	TenantsFile string
+
+	// Pprof serves runtime profiles and execution traces to the admin
+	Pprof bool
+
+	// Features turns on experimental subsystems, which are off by default
+	Features []string
+
+	// AuditFile keeps the audit log of administrative actions, appended to
+	// as JSON lines, across restarts
+	AuditFile string
+
+	// RedactionFile lists rules removing personal data from events before
+	// they are stored
+	RedactionFile string
+
+	// RaftDir enables the Raft consensus mode, keeping the replicated log
+	// and snapshots in this directory. RaftAddr is the host:port Raft
+	// listens on and advertises. With RaftBootstrap set, a node without
+	// state bootstraps a cluster of itself and RaftPeers.
+	RaftDir       string
+	RaftAddr      string
+	RaftBootstrap bool
+	RaftPeers     []raft.Server
+
+	// HookPlugins are Go plugins exporting a hooks.Hook notified of every
+	// tick, merge and event
+	HookPlugins []string
+
+	// TUI replaces the log output on the terminal with an interactive view
+	// of the clock, the events and the peers
+	TUI bool
+
+	// Failed webhook deliveries are retried until WebhookAttempts were made,
+	// waiting WebhookBackoff after the first failure and twice as long after
+	// each further one
+	WebhookAttempts int
+	WebhookBackoff  time.Duration
+
+	// TraceFile records every clock operation to this file, to be replayed
+	// with ReplayFile or POST /admin/replay
+	TraceFile string
+
+	// ReplayFile replays a recorded trace against a fresh server, prints
+	// the report and exits instead of serving
+	ReplayFile string
+
+	// ClockHistory is how many clock transitions GET /clock/history keeps,
+	// 0 to record none
+	ClockHistory int
+
+	// SkewSamples is how many events GET /analytics/skew samples, 0 to
+	// sample none
+	SkewSamples int
+
+	// DedupEntries is how many received messages are remembered to drop
+	// copies arriving by another path, 0 to deduplicate none
+	DedupEntries int
+
+	// LegacySunset is announced in the Sunset header of the deprecated
+	// unprefixed routes, zero when no date is planned
+	LegacySunset time.Time
+
+	// flags holds the value of every flag, to tell what a reload changed
+	flags map[string]string
+}
+
+// parseConfig builds a Config from command line arguments
+func parseConfig(args []string) (*Config, error) {
+	cfg := &Config{}
+
+	fs := flag.NewFlagSet("lamport_timestamp", flag.ContinueOnError)
+	hostname, _ := os.Hostname()
+
+	fs.StringVar(&cfg.ConfigFile, "config", "", "JSON file of flag values, re-read on SIGHUP and POST /admin/reload")
+	fs.StringVar(&cfg.Addr, "addr", ":8080", "address to listen on")
+	fs.DurationVar(&cfg.ReadHeaderTimeout, "read-header-timeout", 10*time.Second, "time allowed to read the headers of a request")
+	fs.DurationVar(&cfg.ReadTimeout, "read-timeout", 30*time.Second, "time allowed to read a whole request (0 for none)")
+	fs.DurationVar(&cfg.IdleTimeout, "idle-timeout", 2*time.Minute, "how long idle keep-alive connections stay open")
+	fs.DurationVar(&cfg.Limits.WriteTimeout, "write-timeout", 30*time.Second, "time allowed to write a response after the handler timeout")
+	fs.DurationVar(&cfg.Limits.Timeout, "handler-timeout", 30*time.Second, "deadline of request handlers (0 for none)")
+	handlerTimeouts := fs.String("handler-timeouts", "", "comma separated path=duration handler timeouts overriding -handler-timeout, by path prefix")
+	maxBody := fs.String("max-body", "1MiB", "largest request body, in bytes or with a KiB, MiB or GiB suffix (0 for no limit)")
+	bodyLimits := fs.String("body-limits", "", "comma separated path=size body limits overriding -max-body, by path prefix")
+	corsOrigins := fs.String("cors-origins", "", "comma separated origins browser pages may call the API from, * for any (disabled when empty)")
+	corsMethods := fs.String("cors-methods", "GET,POST,PUT,PATCH,DELETE", "comma separated methods allowed across origins")
+	corsHeaders := fs.String("cors-headers", "Content-Type,Authorization,X-API-Key,X-Request-ID,If-Match,If-None-Match,Lamport-Timestamp,Lamport-Epoch,Lamport-Sender,Connect-Protocol-Version,Connect-Timeout-Ms,Grpc-Timeout,X-Grpc-Web,X-User-Agent", "comma separated request headers allowed across origins")
+	fs.DurationVar(&cfg.CORS.MaxAge, "cors-max-age", 10*time.Minute, "how long browsers may cache preflight answers")
+	fs.BoolVar(&cfg.CORS.Credentials, "cors-credentials", false, "allow cross-origin requests with cookies or HTTP authentication")
+	fs.StringVar(&cfg.PathPrefix, "path-prefix", "", "path every route is served under, such as /lamport")
+	fs.StringVar(&cfg.NodeID, "node-id", hostname, "identifier of this node")
+	peers := fs.String("peers", "", "comma separated base URLs of peer nodes")
+	fs.StringVar(&cfg.Join, "join", "", "base URL of a cluster member to join on startup (and leave on shutdown)")
+	fs.StringVar(&cfg.AdvertiseURL, "advertise-url", "", "base URL other nodes reach this node at")
+	fs.StringVar(&cfg.PeerTransport, "peer-transport", transportHTTP, "transport of requests between nodes: http, grpc or udp")
+	fs.StringVar(&cfg.TransportAddr, "transport-addr", "", "address the grpc or udp peer transport listens on")
+	fs.StringVar(&cfg.TLSCertFile, "tls-cert", "", "TLS certificate file (enables HTTPS)")
+	fs.StringVar(&cfg.TLSKeyFile, "tls-key", "", "TLS private key file")
+	fs.StringVar(&cfg.TLSCAFile, "tls-ca", "", "CA bundle used to verify peer client certificates (enables mTLS on inter-node endpoints)")
+
+	fs.StringVar(&cfg.AdminToken, "admin-token", "", "bearer token required by /admin endpoints")
+	fs.BoolVar(&cfg.AdminDenyDefault, "admin-deny-default", false, "refuse admin endpoints when no admin token or roles are configured, instead of leaving them open")
+	fs.StringVar(&cfg.RolesFile, "roles-file", "", "JSON file mapping API keys to the roles reader, writer, admin and peer; endpoints then require the role of their group")
+	fs.StringVar(&cfg.JWTSecret, "jwt-secret", "", "HS256 secret verifying bearer tokens whose roles claim grants roles; endpoints then require the role of their group")
+	anonymousRoles := fs.String("anonymous-roles", "", "comma separated roles of requests without credentials, with -roles-file or -jwt-secret")
+	fs.StringVar(&cfg.PeerToken, "peer-token", "", "bearer token sent on requests to peers, granted the peer role by their -roles-file")
+
+	fs.Int64Var(&cfg.MaxJump, "max-jump", 0, "largest accepted jump between a received timestamp and local time (0 disables)")
+	policy := fs.String("max-jump-policy", string(JumpReject), "action on max jump violations: reject, clamp or alert")
+	fs.StringVar(&cfg.SigningKey, "signing-key", "", "Ed25519 private key file events are signed with, created when missing (disabled when empty)")
+	fs.StringVar(&cfg.TrustedKeys, "trusted-keys", "", "PEM file with the public keys of nodes whose signatures are accepted")
+	signaturePolicy := fs.String("signature-policy", string(SignatureReject), "action on invalid signatures: reject or flag")
+	fs.Float64Var(&cfg.RateLimit, "rate-limit", 0, "requests per second allowed per client on POST endpoints (0 disables)")
+	fs.IntVar(&cfg.RateBurst, "rate-burst", 20, "burst size of the per client rate limit")
+	fs.IntVar(&cfg.IngestQueue, "ingest-queue", 1024, "events and messages waiting to be appended before requests are turned away with 503 (0 disables the queue)")
+	fs.IntVar(&cfg.IngestWorkers, "ingest-workers", 8, "workers appending the queued events and messages")
+	fs.DurationVar(&cfg.IngestTimeout, "ingest-timeout", 5*time.Second, "longest wait in the ingestion queue before a request is turned away")
+	fs.StringVar(&cfg.LogLevel, "log-level", "info", "minimum log level: debug, info, warn or error")
+	fs.StringVar(&cfg.LogFormat, "log-format", "json", "log output format: json or text")
+	fs.StringVar(&cfg.LogFile, "log-file", "", "write logs to this file instead of stderr, with rotation")
+	fs.IntVar(&cfg.LogMaxSizeMB, "log-max-size", 100, "size in megabytes at which the log file is rotated")
+	fs.IntVar(&cfg.LogMaxBackups, "log-max-backups", 5, "number of rotated log files to keep")
+	fs.StringVar(&cfg.ClockFile, "clock-file", "", "file the clock is persisted to (disabled when empty)")
+	fs.DurationVar(&cfg.ClockPersistInterval, "clock-persist-interval", time.Second, "how often the clock is persisted")
+	fs.Int64Var(&cfg.ClockSafetyMargin, "clock-safety-margin", 10000, "ticks added to the persisted clock on startup")
+	fs.StringVar(&cfg.NATSURL, "nats-url", "", "NATS server URL (enables the NATS bridge)")
+	fs.StringVar(&cfg.NATSSubject, "nats-subject", "lamport.messages", "NATS subject consumed as received messages (empty disables)")
+	fs.StringVar(&cfg.NATSPublishSubject, "nats-publish-subject", "", "NATS subject local events are published to (empty disables)")
+	kafkaBrokers := fs.String("kafka-brokers", "", "comma separated Kafka broker addresses (enables the Kafka bridge)")
+	fs.StringVar(&cfg.KafkaTopic, "kafka-topic", "", "Kafka topic consumed as received messages (empty disables)")
+	fs.StringVar(&cfg.KafkaGroup, "kafka-group", "", "Kafka consumer group (default lamport-<node-id>)")
+	fs.StringVar(&cfg.KafkaPublishTopic, "kafka-publish-topic", "", "Kafka topic local events are produced to (empty disables)")
+	fs.StringVar(&cfg.KafkaTimestampHeader, "kafka-timestamp-header", headerTimestamp, "Kafka header carrying the Lamport timestamp")
+	fs.StringVar(&cfg.KafkaTimestampField, "kafka-timestamp-field", "", "read the Lamport timestamp from this field of JSON values instead of a header")
+	fs.StringVar(&cfg.MQTTBroker, "mqtt-broker", "", "MQTT broker URL, e.g. tcp://localhost:1883 (enables the MQTT bridge)")
+	fs.StringVar(&cfg.MQTTTopic, "mqtt-topic", "lamport/messages", "MQTT topic filter consumed as received messages (empty disables)")
+	fs.StringVar(&cfg.MQTTPublishTopic, "mqtt-publish-topic", "", "MQTT topic local events are published to (empty disables)")
+	qos := fs.Uint("mqtt-qos", 1, "MQTT quality of service: 0, 1 or 2")
+	fs.StringVar(&cfg.MQTTClientID, "mqtt-client-id", "", "MQTT client ID (default lamport-<node-id>)")
+	fs.StringVar(&cfg.MQTTUsername, "mqtt-username", "", "MQTT username")
+	fs.StringVar(&cfg.MQTTPassword, "mqtt-password", "", "MQTT password")
+	fs.StringVar(&cfg.UDPAddr, "udp-addr", "", "address of the UDP clock synchronization listener (disabled when empty)")
+	udpPeers := fs.String("udp-peers", "", "comma separated host:port UDP addresses of peers")
+	fs.DurationVar(&cfg.UDPInterval, "udp-interval", 100*time.Millisecond, "how often the clock is sent to UDP peers")
+	fs.StringVar(&cfg.TextAddr, "text-addr", "", "address of the TCP text protocol listener (disabled when empty)")
+	fs.BoolVar(&cfg.Pprof, "pprof", false, "serve runtime profiles and execution traces under /debug/pprof/ to the admin")
+	features := fs.String("features", "", "comma separated experimental features to enable: "+featureNames())
+	fs.StringVar(&cfg.AuditFile, "audit-file", "", "append the audit log of administrative actions to this file (kept in memory when empty)")
+	fs.StringVar(&cfg.TenantsFile, "tenants-file", "", "JSON file of tenants; scopes virtual clocks to the tenant of each API key")
+	fs.StringVar(&cfg.RedactionFile, "redaction-file", "", "JSON file of rules redacting personal data from events before they are stored")
+	tieBreaker := fs.String("tie-breaker", "node", "how events with equal timestamps are ordered: node, hash, arrival or meta:<key>")
+	rateKey := fs.String("rate-limit-key", "ip", "how clients are identified for rate limiting: ip or api-key")
+	fs.DurationVar(&cfg.HeartbeatInterval, "heartbeat-interval", time.Second, "how often the failure detector polls peers")
+	fs.DurationVar(&cfg.SuspectAfter, "suspect-after", 3*time.Second, "silence after which a peer is suspected")
+	fs.DurationVar(&cfg.DeadAfter, "dead-after", 10*time.Second, "silence after which a peer is declared dead")
+	fs.DurationVar(&cfg.SyncInterval, "sync-interval", 0, "how often the log is reconciled with every peer (0 disables)")
+	fs.IntVar(&cfg.EventShards, "event-shards", defaultEventShards, "number of independently locked shards of the event log")
+	fs.IntVar(&cfg.EventCapacity, "event-capacity", 0, "keep only the newest events up to this many, overwriting the oldest (0 keeps all)")
+	fs.IntVar(&cfg.EventCompression, "event-compression", 0, "keep the event log in memory in compressed blocks of this many events (0 disables)")
+	fs.StringVar(&cfg.EventDB, "event-db", "", "keep the event log in an SQLite database at this path")
+	fs.StringVar(&cfg.EventPostgres, "event-postgres", "", "keep the event log and the clock in the PostgreSQL database at this URL, shared between servers")
+	fs.StringVar(&cfg.WALFile, "wal", "", "write the event log and the clock to a write-ahead log at this path (disabled when empty)")
+	walSync := fs.String("wal-sync", string(SyncInterval), "when the write-ahead log is flushed to disk: always, interval or no")
+	fs.DurationVar(&cfg.WALSyncInterval, "wal-sync-interval", 100*time.Millisecond, "how often the write-ahead log is flushed with -wal-sync interval")
+	fs.StringVar(&cfg.EncryptionKeyEnv, "encryption-key-env", "", "encrypt stored event messages and payloads with the base64 AES keys in this environment variable, newest first")
+	fs.StringVar(&cfg.EncryptionKeyCommand, "encryption-key-command", "", "encrypt stored event messages and payloads with the base64 AES keys this shell command prints, newest first")
+	fs.DurationVar(&cfg.RollupAge, "rollup-age", 0, "roll up events logged longer ago than this into per bucket counts (0 keeps all in full)")
+	fs.Int64Var(&cfg.RollupBucket, "rollup-bucket", 1000, "width in timestamps of the rollup buckets")
+	fs.DurationVar(&cfg.RollupInterval, "rollup-interval", time.Minute, "how often old events are rolled up")
+	fs.StringVar(&cfg.ArchiveURL, "archive-url", "", "archive old events in segments to s3://bucket/prefix or file:///dir (disabled when empty)")
+	fs.StringVar(&cfg.ArchiveEndpoint, "archive-endpoint", "https://s3.amazonaws.com", "URL of the S3 compatible service of -archive-url")
+	fs.DurationVar(&cfg.ArchiveAge, "archive-age", 24*time.Hour, "archive events logged longer ago than this")
+	fs.DurationVar(&cfg.ArchiveInterval, "archive-interval", 10*time.Minute, "how often old events are archived")
+	fs.IntVar(&cfg.ArchiveSegment, "archive-segment", 10000, "most events per archived segment")
+	fs.Int64Var(&cfg.SyncBucket, "sync-bucket", 100, "width in timestamps of the ranges compared by log reconciliation")
+	fs.StringVar(&cfg.SendFile, "send-file", "", "file the sequence numbers and unacknowledged messages of /send are kept in (in memory when empty)")
+	fs.DurationVar(&cfg.SendRetry, "send-retry", defaultSendRetry, "how often unacknowledged /send messages are sent again")
+	fs.StringVar(&cfg.OutboxFile, "outbox-file", "", "file the messages written with /outbox are kept in until delivered (in memory when empty)")
+	fs.DurationVar(&cfg.OutboxInterval, "outbox-interval", defaultOutboxInterval, "how often pending /outbox messages are dispatched again")
+	fs.DurationVar(&cfg.ElectionInterval, "election-interval", time.Second, "how often the cluster leader announces itself to peers")
+	fs.DurationVar(&cfg.ElectionTimeout, "election-timeout", 3*time.Second, "silence from the leader after which a new election starts")
+	fs.StringVar(&cfg.RaftDir, "raft-dir", "", "directory of the Raft log and snapshots (enables Raft consensus mode)")
+	fs.StringVar(&cfg.RaftAddr, "raft-addr", "", "host:port the Raft transport listens on and advertises")
+	fs.BoolVar(&cfg.RaftBootstrap, "raft-bootstrap", false, "bootstrap the Raft cluster from -raft-peers on first start")
+	fs.IntVar(&cfg.WebhookAttempts, "webhook-attempts", 5, "attempts made to deliver an event to a webhook")
+	fs.DurationVar(&cfg.WebhookBackoff, "webhook-backoff", time.Second, "wait before retrying a failed webhook delivery, doubled after every attempt")
+	fs.BoolVar(&cfg.TUI, "tui", false, "show an interactive terminal UI instead of logging to stderr")
+	fs.StringVar(&cfg.TraceFile, "trace-file", "", "record every clock operation to this file (disabled when empty)")
+	fs.StringVar(&cfg.ReplayFile, "replay", "", "replay a trace recorded with -trace-file, print the report and exit")
+	fs.IntVar(&cfg.ClockHistory, "clock-history", defaultClockHistory, "clock transitions kept for /clock/history (0 disables the history)")
+	fs.IntVar(&cfg.SkewSamples, "skew-samples", defaultSkewSamples, "events sampled for /analytics/skew (0 disables the analytics)")
+	fs.IntVar(&cfg.DedupEntries, "dedup-entries", defaultDedupEntries, "received messages remembered by sender, time and event ID to drop duplicates (0 disables deduplication)")
+	legacySunset := fs.String("legacy-sunset", "", "date (YYYY-MM-DD or RFC 3339) the unprefixed routes will be removed, sent in their Sunset header")
+	hookPlugins := fs.String("hook-plugins", "", "comma separated Go plugin files exporting a hooks.Hook")
+	raftPeers := fs.String("raft-peers", "", "comma separated id@host:port Raft addresses of the other voters")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if cfg.ConfigFile != "" {
+		if err := applyConfigFile(fs, cfg.ConfigFile); err != nil {
+			return nil, err
+		}
+	}
+	cfg.flags = make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		cfg.flags[f.Name] = f.Value.String()
+	})
+
+	if *peers != "" {
+		cfg.Peers = strings.Split(*peers, ",")
+	}
+
+	var err error
+	if cfg.Limits.MaxBody, err = parseByteSize(*maxBody); err != nil {
+		return nil, fmt.Errorf("-max-body: %w", err)
+	}
+	if cfg.Limits.Timeouts, err = parsePathLimits(*handlerTimeouts, defaultHandlerTimeouts, parseTimeout); err != nil {
+		return nil, fmt.Errorf("-handler-timeouts: %w", err)
+	}
+	if cfg.Limits.BodyLimits, err = parsePathLimits(*bodyLimits, defaultBodyLimits, parseByteSize); err != nil {
+		return nil, fmt.Errorf("-body-limits: %w", err)
+	}
+
+	cfg.KafkaBrokers = splitList(*kafkaBrokers)
+	cfg.UDPPeers = splitList(*udpPeers)
+	cfg.CORS.Origins = splitList(*corsOrigins)
+	cfg.CORS.Methods = splitList(*corsMethods)
+	cfg.CORS.Headers = splitList(*corsHeaders)
+	cfg.HookPlugins = splitList(*hookPlugins)
+	cfg.AnonymousRoles = splitList(*anonymousRoles)
+	cfg.Features = splitList(*features)
+	if cfg.KafkaGroup == "" {
+		cfg.KafkaGroup = "lamport-" + cfg.NodeID
+	}
+
+	if *qos > 2 {
+		return nil, fmt.Errorf("invalid MQTT QoS %d", *qos)
+	}
+	cfg.MQTTQoS = byte(*qos)
+	if cfg.MQTTClientID == "" {
+		cfg.MQTTClientID = "lamport-" + cfg.NodeID
+	}
+
+	switch *rateKey {
+	case "ip":
+	case "api-key":
+		cfg.RateLimitByAPIKey = true
+	default:
+		return nil, fmt.Errorf("unknown rate limit key %q", *rateKey)
+	}
+
+	if cfg.MaxJumpPolicy, err = parseJumpPolicy(*policy); err != nil {
+		return nil, err
+	}
+	if cfg.SignaturePolicy, err = parseSignaturePolicy(*signaturePolicy); err != nil {
+		return nil, err
+	}
+	if cfg.WALSync, err = parseSyncPolicy(*walSync); err != nil {
+		return nil, err
+	}
+	if cfg.TieBreaker, err = parseTieBreaker(*tieBreaker); err != nil {
+		return nil, err
+	}
+	if cfg.RaftPeers, err = parseRaftPeers(*raftPeers); err != nil {
+		return nil, err
+	}
+	if *legacySunset != "" {
+		if cfg.LegacySunset, err = time.Parse(time.DateOnly, *legacySunset); err != nil {
+			if cfg.LegacySunset, err = time.Parse(time.RFC3339, *legacySunset); err != nil {
+				return nil, fmt.Errorf("invalid -legacy-sunset %q, expected YYYY-MM-DD or RFC 3339", *legacySunset)
+			}
+		}
+	}
+	if cfg.Join != "" && cfg.AdvertiseURL == "" {
+		return nil, errors.New("-join requires -advertise-url")
+	}
+	switch cfg.PeerTransport {
+	case transportHTTP:
+	case transportGRPC, transportUDP:
+		if cfg.TransportAddr == "" {
+			return nil, fmt.Errorf("-peer-transport %s requires -transport-addr", cfg.PeerTransport)
+		}
+		// gRPC connections carry the TLS of the node, datagrams none
+		if cfg.PeerTransport == transportUDP && cfg.TLSCAFile != "" {
+			return nil, errors.New("-peer-transport udp does not support -tls-ca")
+		}
+		if cfg.PeerTransport == transportGRPC && cfg.TLSCAFile != "" && !cfg.TLSEnabled() {
+			return nil, errors.New("-peer-transport grpc with -tls-ca requires -tls-cert and -tls-key")
+		}
+	default:
+		return nil, fmt.Errorf("invalid -peer-transport %q, expected http, grpc or udp", cfg.PeerTransport)
+	}
+	if cfg.HeartbeatInterval <= 0 || cfg.SuspectAfter <= 0 || cfg.DeadAfter <= cfg.SuspectAfter {
+		return nil, errors.New("-dead-after must exceed -suspect-after, and both -heartbeat-interval and -suspect-after must be positive")
+	}
+	if cfg.EventShards < 1 || cfg.EventCapacity < 0 {
+		return nil, errors.New("-event-shards must be at least 1 and -event-capacity not negative")
+	}
+	if cfg.EventCompression < 0 {
+		return nil, errors.New("-event-compression must not be negative")
+	}
+	if cfg.EventCompression > 0 && (cfg.EventCapacity > 0 || cfg.EventDB != "" || cfg.EventPostgres != "") {
+		return nil, errors.New("-event-compression cannot be combined with -event-capacity, -event-db or -event-postgres")
+	}
+	if cfg.SyncBucket <= 0 || cfg.SyncInterval < 0 {
+		return nil, errors.New("-sync-bucket must be positive and -sync-interval not negative")
+	}
+	if cfg.ElectionInterval <= 0 || cfg.ElectionTimeout <= cfg.ElectionInterval {
+		return nil, errors.New("-election-timeout must exceed a positive -election-interval")
+	}
+	if cfg.ClockHistory < 0 {
+		return nil, errors.New("-clock-history must not be negative")
+	}
+	if cfg.RollupAge < 0 || cfg.RollupBucket < 1 || cfg.RollupInterval <= 0 {
+		return nil, errors.New("-rollup-age must not be negative, -rollup-bucket and -rollup-interval positive")
+	}
+	if cfg.ArchiveAge < 0 || cfg.ArchiveInterval <= 0 || cfg.ArchiveSegment < 1 {
+		return nil, errors.New("-archive-age must not be negative, -archive-interval and -archive-segment positive")
+	}
+	// Both move old events off the log
+	if cfg.ArchiveURL != "" && cfg.RollupAge > 0 {
+		return nil, errors.New("-archive-url cannot be combined with -rollup-age")
+	}
+	if cfg.ReadHeaderTimeout <= 0 || cfg.ReadTimeout < 0 || cfg.IdleTimeout < 0 || cfg.Limits.WriteTimeout <= 0 || cfg.Limits.Timeout < 0 {
+		return nil, errors.New("-read-header-timeout and -write-timeout must be positive, -read-timeout, -idle-timeout and -handler-timeout not negative")
+	}
+	// Browsers refuse credentials with a wildcard origin
+	if cfg.CORS.Credentials && slices.Contains(cfg.CORS.Origins, "*") {
+		return nil, errors.New("-cors-credentials cannot be combined with -cors-origins *")
+	}
+	if cfg.CORS.MaxAge < 0 {
+		return nil, errors.New("-cors-max-age must not be negative")
+	}
+	cfg.PathPrefix = strings.TrimSuffix(cfg.PathPrefix, "/")
+	if cfg.PathPrefix != "" && !strings.HasPrefix(cfg.PathPrefix, "/") {
+		return nil, errors.New("-path-prefix must start with /")
+	}
+	if cfg.IngestQueue < 0 || cfg.IngestWorkers < 1 || cfg.IngestTimeout <= 0 {
+		return nil, errors.New("-ingest-queue must not be negative, -ingest-workers and -ingest-timeout positive")
+	}
+	if cfg.SendRetry <= 0 {
+		return nil, errors.New("-send-retry must be positive")
+	}
+	if cfg.OutboxInterval <= 0 {
+		return nil, errors.New("-outbox-interval must be positive")
+	}
+	if cfg.SkewSamples < 0 {
+		return nil, errors.New("-skew-samples must not be negative")
+	}
+	if cfg.DedupEntries < 0 {
+		return nil, errors.New("-dedup-entries must not be negative")
+	}
+	if cfg.WebhookAttempts < 1 || cfg.WebhookBackoff <= 0 {
+		return nil, errors.New("-webhook-attempts must be at least 1 and -webhook-backoff positive")
+	}
+	for _, name := range cfg.Features {
+		if _, err := lookupFeature(name); err != nil {
+			return nil, fmt.Errorf("-features: %w", err)
+		}
+	}
+	if cfg.RaftDir != "" && cfg.RaftAddr == "" {
+		return nil, errors.New("-raft-dir requires -raft-addr")
+	}
+	// The flags starting a subsystem imply its feature
+	if cfg.RaftDir != "" && !slices.Contains(cfg.Features, FeatureRaft) {
+		cfg.Features = append(cfg.Features, FeatureRaft)
+	}
+	if cfg.UDPAddr != "" && !slices.Contains(cfg.Features, FeatureUDPSync) {
+		cfg.Features = append(cfg.Features, FeatureUDPSync)
+	}
+	// The Raft log already persists the events and replays them on start
+	if cfg.EventDB != "" && (cfg.EventCapacity > 0 || cfg.RaftDir != "") {
+		return nil, errors.New("-event-db cannot be combined with -event-capacity or -raft-dir")
+	}
+	// The clock is persisted to the database along with the events
+	if cfg.EventPostgres != "" && (cfg.EventDB != "" || cfg.EventCapacity > 0 || cfg.RaftDir != "" || cfg.ClockFile != "") {
+		return nil, errors.New("-event-postgres cannot be combined with -event-db, -event-capacity, -raft-dir or -clock-file")
+	}
+	if cfg.WALFile != "" && (cfg.EventDB != "" || cfg.EventPostgres != "" || cfg.RaftDir != "" || cfg.ClockFile != "") {
+		return nil, errors.New("-wal cannot be combined with -event-db, -event-postgres, -raft-dir or -clock-file")
+	}
+	if cfg.WALSyncInterval <= 0 {
+		return nil, errors.New("-wal-sync-interval must be positive")
+	}
+	if _, err := parseRoles(cfg.AnonymousRoles); err != nil {
+		return nil, fmt.Errorf("invalid -anonymous-roles: %w", err)
+	}
+	if len(cfg.AnonymousRoles) > 0 && cfg.RolesFile == "" && cfg.JWTSecret == "" {
+		return nil, errors.New("-anonymous-roles requires -roles-file or -jwt-secret")
+	}
+	if cfg.AdminDenyDefault && slices.Contains(cfg.AnonymousRoles, "admin") {
+		return nil, errors.New("-admin-deny-default cannot be combined with anonymous admins")
+	}
+	// Profiles expose the command line and memory of the process
+	if cfg.Pprof && cfg.AdminToken == "" && cfg.RolesFile == "" && cfg.JWTSecret == "" {
+		return nil, errors.New("-pprof requires -admin-token, -roles-file or -jwt-secret")
+	}
+	if cfg.EncryptionKeyEnv != "" && cfg.EncryptionKeyCommand != "" {
+		return nil, errors.New("-encryption-key-env cannot be combined with -encryption-key-command")
+	}
+	if (cfg.EncryptionKeyEnv != "" || cfg.EncryptionKeyCommand != "") && cfg.EventDB == "" && cfg.EventPostgres == "" && cfg.WALFile == "" {
+		return nil, errors.New("encryption requires -event-db, -event-postgres or -wal")
+	}
+	return cfg, nil
+}
+
+// applyConfigFile sets the flags of fs not given on the command line from
+// a JSON object of flag names to values. Lists may be given as arrays.
+func applyConfigFile(fs *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var values map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return fmt.Errorf("invalid config file: %w", err)
+	}
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	for name, value := range values {
+		if fs.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("config file: unknown flag %q", name)
+		}
+		if given[name] {
+			continue
+		}
+		var text string
+		switch v := value.(type) {
+		case string:
+			text = v
+		case json.Number, bool:
+			text = fmt.Sprint(v)
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			text = strings.Join(items, ",")
+		default:
+			return fmt.Errorf("config file: invalid value of %q", name)
+		}
+		if err := fs.Set(name, text); err != nil {
+			return fmt.Errorf("config file: %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// splitList reads a comma separated list, skipping empty items
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// TLSEnabled reports whether the server should serve HTTPS
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORS lets browser pages of other origins, such as dashboards and
+// teaching tools, call the API directly
+type CORS struct {
+	// Origins are allowed origins such as https://dash.example.com, with
+	// * allowing any and https://*.example.com any subdomain
+	Origins     []string
+	Methods     []string
+	Headers     []string
+	MaxAge      time.Duration
+	Credentials bool
+}
+
+// corsExposed are the response headers pages may read
+var corsExposed = strings.Join([]string{
+	"ETag", "Retry-After", "X-Request-ID", "Deprecation", "Sunset", "Link", headerSessionToken,
+	"Grpc-Status", "Grpc-Message", "Grpc-Status-Details-Bin", "Trailer-" + headerTimestamp,
+}, ", ")
+
+// allows reports whether requests from origin are allowed
+func (c *CORS) allows(origin string) bool {
+	for _, allowed := range c.Origins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+		if scheme, domain, ok := strings.Cut(allowed, "://*."); ok {
+			rest, found := strings.CutPrefix(origin, scheme+"://")
+			if found && strings.HasSuffix(rest, "."+domain) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// withCORS answers preflight requests and marks the responses of allowed
+// origins. Requests without an Origin, from servers and curl, pass as
+// before; pages of other origins get no CORS headers, so browsers keep
+// their responses from them.
+func withCORS(c *CORS, next http.Handler) http.Handler {
+	methods := strings.Join(c.Methods, ", ")
+	headers := strings.Join(c.Headers, ", ")
+	maxAge := strconv.Itoa(int(c.MaxAge.Seconds()))
+	anyOrigin := slices.Contains(c.Origins, "*") && !c.Credentials
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if !c.allows(origin) {
+			if preflight {
+				http.Error(w, "Origin not allowed", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if anyOrigin {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if c.Credentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Methods", methods)
+			h.Set("Access-Control-Allow-Headers", headers)
+			h.Set("Access-Control-Max-Age", maxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.Set("Access-Control-Expose-Headers", corsExposed)
+		next.ServeHTTP(w, r)
+	})
+}
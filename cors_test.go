@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	c := &CORS{
+		Origins: []string{"https://dash.example.com", "https://*.lab.edu"},
+		Methods: []string{"GET", "POST"},
+		Headers: []string{"Content-Type", "Authorization"},
+		MaxAge:  10 * time.Minute,
+	}
+	served := false
+	h := withCORS(c, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = true
+		w.WriteHeader(http.StatusOK)
+	}))
+	request := func(method, origin string) *httptest.ResponseRecorder {
+		served = false
+		r := httptest.NewRequest(method, "/events", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		if method == http.MethodOptions {
+			r.Header.Set("Access-Control-Request-Method", "POST")
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := request(http.MethodOptions, "https://dash.example.com")
+	if w.Code != http.StatusNoContent || served || w.Header().Get("Access-Control-Allow-Origin") != "https://dash.example.com" ||
+		w.Header().Get("Access-Control-Allow-Methods") != "GET, POST" || w.Header().Get("Access-Control-Allow-Headers") != "Content-Type, Authorization" ||
+		w.Header().Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("Expected a preflight answer, got %d %v", w.Code, w.Header())
+	}
+
+	w = request(http.MethodGet, "https://course.lab.edu")
+	if !served || w.Header().Get("Access-Control-Allow-Origin") != "https://course.lab.edu" || w.Header().Get("Access-Control-Expose-Headers") == "" {
+		t.Errorf("Expected a subdomain allowed, got %v", w.Header())
+	}
+
+	for _, origin := range []string{"https://evil.example.com", "http://course.lab.edu", "https://lab.edu.evil.com"} {
+		if w := request(http.MethodGet, origin); !served || w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("%s: expected no CORS headers, got %v", origin, w.Header())
+		}
+		if w := request(http.MethodOptions, origin); w.Code != http.StatusForbidden || served {
+			t.Errorf("%s: expected the preflight refused, got %d", origin, w.Code)
+		}
+	}
+
+	if w := request(http.MethodGet, ""); !served || w.Header().Get("Vary") != "" {
+		t.Errorf("Expected requests without an origin untouched, got %v", w.Header())
+	}
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	h := withCORS(&CORS{Origins: []string{"*"}}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	r := httptest.NewRequest(http.MethodGet, "/clock", nil)
+	r.Header.Set("Origin", "http://localhost:3000")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("Expected any origin allowed, got %v", w.Header())
+	}
+
+	// With credentials the origin is echoed, as browsers require
+	h = withCORS(&CORS{Origins: []string{"http://localhost:3000"}, Credentials: true}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Header().Get("Access-Control-Allow-Origin") != "http://localhost:3000" || w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("Expected the origin echoed with credentials, got %v", w.Header())
+	}
+}
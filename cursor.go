@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// Page sizes of the endpoints paged with cursors
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// ErrInvalidCursor is returned for a cursor this server did not hand out
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor marks the last event of a page by its Lamport time, node and ID.
+// Pages are in total order, so the next one starts after that event
+// wherever it now is: events appended or pruned since do not shift or
+// repeat the events of later pages, as offsets would. Events appended
+// before the cursor, such as late messages with old timestamps, are not
+// seen by clients paging past them.
+type Cursor struct {
+	Epoch     int64  `json:"e,omitempty"`
+	Timestamp int64  `json:"t"`
+	Node      string `json:"n,omitempty"`
+	ID        string `json:"i"`
+}
+
+// cursorOf marks the position of an event
+func cursorOf(e Event) Cursor {
+	return Cursor{Epoch: e.Epoch, Timestamp: e.Timestamp, Node: e.Node, ID: e.ID}
+}
+
+// String encodes the cursor as an opaque, URL safe token
+func (c Cursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseCursor decodes a token made by Cursor.String
+func ParseCursor(token string) (Cursor, error) {
+	var c Cursor
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || json.Unmarshal(data, &c) != nil || c.ID == "" {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+func (c Cursor) clockTime() ClockTime {
+	return ClockTime{Epoch: c.Epoch, Timestamp: c.Timestamp}
+}
+
+// after returns the index of the first event after the cursor in events,
+// sorted by SortEvents with tie. An event still there is found by node and
+// ID; one pruned since is compared with tie from its node and ID alone,
+// which only places it exactly for the node and hash tie breakers.
+func (c Cursor) after(events []Event, tie TieBreaker) int {
+	at := c.clockTime()
+	start := sort.Search(len(events), func(i int) bool { return events[i].clockTime().Compare(at) >= 0 })
+	end := start + sort.Search(len(events)-start, func(i int) bool { return events[start+i].clockTime().Compare(at) > 0 })
+	for i := start; i < end; i++ {
+		if events[i].Node == c.Node && events[i].ID == c.ID {
+			return i + 1
+		}
+	}
+	marker := Event{Epoch: c.Epoch, Timestamp: c.Timestamp, Node: c.Node, ID: c.ID}
+	for i := start; i < end; i++ {
+		if tie.Less(marker, events[i]) {
+			return i
+		}
+	}
+	return end
+}
+
+// PageRequest is the ?cursor= and ?limit= of a paged request
+type PageRequest struct {
+	Cursor *Cursor // nil for the first page
+	Limit  int
+}
+
+// parsePage reads the page a request asks for, answering 400 when it is
+// invalid
+func parsePage(w http.ResponseWriter, r *http.Request) (PageRequest, bool) {
+	query := r.URL.Query()
+	page := PageRequest{Limit: defaultPageLimit}
+	if query.Has("offset") {
+		http.Error(w, "Offsets are no longer supported, page with cursor", http.StatusBadRequest)
+		return page, false
+	}
+	if v := query.Get("cursor"); v != "" {
+		c, err := ParseCursor(v)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return page, false
+		}
+		page.Cursor = &c
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxPageLimit {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return page, false
+		}
+		page.Limit = n
+	}
+	return page, true
+}
+
+// from is the earliest Lamport time the page can hold
+func (p PageRequest) from() ClockTime {
+	if p.Cursor == nil {
+		return ClockTime{Epoch: math.MinInt64, Timestamp: math.MinInt64}
+	}
+	return p.Cursor.clockTime()
+}
+
+// Page cuts the page out of events, sorted by SortEvents with tie, and
+// returns the cursor of the next page, or nil on the last one
+func (p PageRequest) Page(events []Event, tie TieBreaker) ([]Event, *Cursor) {
+	start := 0
+	if p.Cursor != nil {
+		start = p.Cursor.after(events, tie)
+	}
+	end := start + min(p.Limit, len(events)-start)
+	if end == len(events) {
+		return events[start:end], nil
+	}
+	next := cursorOf(events[end-1])
+	return events[start:end], &next
+}
+
+// setNextLink points the Link header of a page at the next one, relative
+// to the path the request was sent to
+func setNextLink(w http.ResponseWriter, r *http.Request, next *Cursor) {
+	if next == nil {
+		return
+	}
+	query := r.URL.Query()
+	query.Set("cursor", next.String())
+	w.Header().Add("Link", "<?"+query.Encode()+`>; rel="next"`)
+}
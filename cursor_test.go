@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// eventsPage gets a page of /events
+func eventsPage(t *testing.T, server *Server, query string) (*httptest.ResponseRecorder, []string, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/events"+query, nil))
+	var response struct {
+		Events     []Event `json:"events"`
+		NextCursor string  `json:"next_cursor"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	return rec, eventIDs(response.Events), response.NextCursor
+}
+
+func TestEventsPagination(t *testing.T) {
+	server := NewServer()
+	for i := 1; i <= 5; i++ {
+		server.logEvent(fmt.Sprintf("e%d", i), "Event")
+	}
+
+	rec, ids, cursor := eventsPage(t, server, "?limit=2")
+	if fmt.Sprint(ids) != "[e1 e2]" || cursor == "" {
+		t.Fatalf("Expected e1 and e2 with a cursor, got %v %q", ids, cursor)
+	}
+	if link := rec.Header().Get("Link"); !strings.Contains(link, "cursor="+cursor) || !strings.HasSuffix(link, `rel="next"`) {
+		t.Errorf("Expected a link to the next page, got %q", link)
+	}
+
+	// Pruning and appending do not move the next page
+	server.events.Trim(1)
+	server.logEvent("e6", "Event")
+	_, ids, cursor = eventsPage(t, server, "?limit=2&cursor="+cursor)
+	if fmt.Sprint(ids) != "[e3 e4]" {
+		t.Errorf("Expected e3 and e4 after pruning e1, got %v", ids)
+	}
+
+	// A cursor whose event was pruned resumes after it all the same
+	server.events.Trim(3)
+	_, ids, cursor = eventsPage(t, server, "?limit=2&cursor="+cursor)
+	if fmt.Sprint(ids) != "[e5 e6]" || cursor != "" {
+		t.Errorf("Expected e5 and e6 on the last page, got %v %q", ids, cursor)
+	}
+
+	for _, query := range []string{"?limit=2&order=log", "?offset=1", "?cursor=e3", "?limit=-1"} {
+		if rec, _, _ := eventsPage(t, server, query); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestCursorTies(t *testing.T) {
+	events := []Event{
+		{ID: "x", Node: "b", Timestamp: 3},
+		{ID: "y", Node: "a", Timestamp: 3},
+		{ID: "z", Node: "c", Timestamp: 3},
+		{ID: "w", Node: "a", Timestamp: 4},
+	}
+	SortEvents(events, NodeTieBreaker)
+
+	var ids []string
+	page := PageRequest{Limit: 1}
+	for {
+		events, next := page.Page(events, NodeTieBreaker)
+		ids = append(ids, eventIDs(events)...)
+		if next == nil {
+			break
+		}
+		parsed, err := ParseCursor(next.String())
+		if err != nil || parsed != *next {
+			t.Fatalf("Expected the cursor to round trip, got %+v %v", parsed, err)
+		}
+		page.Cursor = &parsed
+	}
+	if fmt.Sprint(ids) != "[y x z w]" {
+		t.Errorf("Expected every event once through the ties, got %v", ids)
+	}
+
+	// Resuming after an event gone from the ties
+	missing := Cursor{Timestamp: 3, Node: "b", ID: "gone"}
+	if i := missing.after(events, NodeTieBreaker); events[i].ID != "x" {
+		t.Errorf("Expected to resume at x, got %s", events[i].ID)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"sync"
+)
+
+// defaultDedupEntries is how many messages are remembered without
+// -dedup-entries
+const defaultDedupEntries = 10000
+
+// ErrDuplicateMessage is returned for a message already received, by
+// another path or as a retry. The event it produced is returned along.
+var ErrDuplicateMessage = errors.New("duplicate message")
+
+// headerDuplicate marks the answer to a message already received
+const headerDuplicate = "Lamport-Duplicate"
+
+// messageKey identifies a message by the node it originates from, the
+// time it was sent at and the ID of the event it announces
+type messageKey struct {
+	origin string
+	sent   ClockTime
+	id     string
+}
+
+type seenMessage struct {
+	event Event // zero while the message is being processed
+	slot  int
+}
+
+// SeenMessages remembers the newest messages received, so a message
+// reaching the node by several paths, such as gossip and a direct send,
+// is merged into the clock and logged once. The oldest are forgotten
+// first. A nil set remembers nothing.
+type SeenMessages struct {
+	seen  map[messageKey]seenMessage
+	ring  []messageKey // keys in the order they were claimed
+	next  int          // number of keys claimed
+	mutex sync.Mutex
+}
+
+// NewSeenMessages remembers up to capacity messages
+func NewSeenMessages(capacity int) *SeenMessages {
+	return &SeenMessages{seen: make(map[messageKey]seenMessage, capacity), ring: make([]messageKey, capacity)}
+}
+
+// claim marks a message as received and reports whether it was new. For a
+// duplicate it returns the event the message produced, zero while the
+// first copy is still being processed.
+func (sm *SeenMessages) claim(k messageKey) (Event, bool) {
+	if sm == nil || len(sm.ring) == 0 {
+		return Event{}, true
+	}
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	if m, ok := sm.seen[k]; ok {
+		return m.event, false
+	}
+	slot := sm.next % len(sm.ring)
+	if sm.next >= len(sm.ring) {
+		// The key in the slot may have been forgotten and claimed again since
+		if old, ok := sm.seen[sm.ring[slot]]; ok && old.slot == slot {
+			delete(sm.seen, sm.ring[slot])
+		}
+	}
+	sm.ring[slot] = k
+	sm.seen[k] = seenMessage{slot: slot}
+	sm.next++
+	return Event{}, true
+}
+
+// done records the event a claimed message produced
+func (sm *SeenMessages) done(k messageKey, event Event) {
+	if sm == nil {
+		return
+	}
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	if m, ok := sm.seen[k]; ok {
+		m.event = event
+		sm.seen[k] = m
+	}
+}
+
+// forget releases a claimed message that failed, so it can be received
+// again
+func (sm *SeenMessages) forget(k messageKey) {
+	if sm == nil {
+		return
+	}
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	delete(sm.seen, k)
+}
+
+// Len is the number of messages remembered
+func (sm *SeenMessages) Len() int {
+	if sm == nil {
+		return 0
+	}
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	return len(sm.seen)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSeenMessages(t *testing.T) {
+	sm := NewSeenMessages(2)
+	key := func(id string) messageKey { return messageKey{origin: "b", sent: ClockTime{Timestamp: 5}, id: id} }
+
+	if _, ok := sm.claim(key("e1")); !ok {
+		t.Fatal("Expected the first copy to be new")
+	}
+	if event, ok := sm.claim(key("e1")); ok || event.ID != "" {
+		t.Errorf("Expected a copy in flight without an event, got %v %+v", ok, event)
+	}
+	sm.done(key("e1"), Event{ID: "msg-6"})
+	if event, ok := sm.claim(key("e1")); ok || event.ID != "msg-6" {
+		t.Errorf("Expected the copy answered with msg-6, got %v %+v", ok, event)
+	}
+	if _, ok := sm.claim(messageKey{origin: "c", sent: ClockTime{Timestamp: 5}, id: "e1"}); !ok {
+		t.Error("Expected the same ID from another origin to be new")
+	}
+
+	// A third message evicts the oldest
+	sm.claim(key("e2"))
+	if _, ok := sm.claim(key("e1")); !ok || sm.Len() != 2 {
+		t.Errorf("Expected e1 forgotten once evicted, %d remembered", sm.Len())
+	}
+
+	// A forgotten message claimed again is not evicted by its old slot
+	sm = NewSeenMessages(2)
+	sm.claim(key("e1"))
+	sm.forget(key("e1"))
+	sm.claim(key("e2"))
+	sm.claim(key("e1"))
+	sm.claim(key("e3")) // evicts the slot e1 first had
+	if _, ok := sm.claim(key("e1")); ok {
+		t.Error("Expected e1 still remembered")
+	}
+
+	var none *SeenMessages
+	if _, ok := none.claim(key("e1")); !ok {
+		t.Error("Expected a nil set to see every message as new")
+	}
+}
+
+func TestReceiveMessageOnce(t *testing.T) {
+	server := NewServer()
+	post := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.handleReceiveMessage(w, httptest.NewRequest(http.MethodPost, "/message?"+query, nil))
+		return w
+	}
+
+	first := post("timestamp=5&message=hello&sender=b&id=event-42")
+	second := post("timestamp=5&message=hello&sender=b&id=event-42")
+	var a, b Event
+	json.NewDecoder(first.Body).Decode(&a)
+	json.NewDecoder(second.Body).Decode(&b)
+	if second.Code != http.StatusOK || second.Header().Get(headerDuplicate) != "true" || b.ID != a.ID {
+		t.Errorf("Expected the copy answered with %s, got %d %s", a.ID, second.Code, b.ID)
+	}
+	if first.Header().Get(headerDuplicate) != "" {
+		t.Error("Expected the first copy not marked as a duplicate")
+	}
+	if server.clock.GetTime() != 6 || server.events.Len() != 1 {
+		t.Errorf("Expected one receive event at 6, got %d events at %d", server.events.Len(), server.clock.GetTime())
+	}
+	if got := server.metrics.Value("lamport_duplicate_messages_total", "transport", "http"); got != 1 {
+		t.Errorf("Expected 1 duplicate counted, got %v", got)
+	}
+
+	// Without an ID, or at another time, messages are merged again
+	post("timestamp=5&message=hello&sender=b")
+	post("timestamp=7&message=hello&sender=b&id=event-42")
+	if server.clock.GetTime() != 8 {
+		t.Errorf("Expected both merged up to 8, got %d", server.clock.GetTime())
+	}
+
+	// Rejected messages can be sent again
+	server.clock.SetJumpGuard(JumpGuard{MaxJump: 10})
+	if w := post("timestamp=1000&message=far&sender=c&id=e1"); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected the jump rejected, got %d", w.Code)
+	}
+	server.clock.SetJumpGuard(JumpGuard{})
+	if w := post("timestamp=1000&message=far&sender=c&id=e1"); w.Code != http.StatusOK || w.Header().Get(headerDuplicate) != "" {
+		t.Errorf("Expected the rejected message merged when sent again, got %d", w.Code)
+	}
+}
+
+func TestReceiveBridgedOnce(t *testing.T) {
+	server := NewServer()
+	server.nodeID = "a"
+	headers := headerGetter(map[string]string{
+		headerTimestamp: "10",
+		headerSender:    "b",
+		headerEventID:   "event-1",
+	})
+	for i, want := range []bool{true, false} {
+		_, ok, err := server.receiveBridged("test", headers, "Hello")
+		if err != nil || ok != want {
+			t.Errorf("Expected copy %d merged %v, got %v (err: %v)", i, want, ok, err)
+		}
+	}
+	if server.clock.GetTime() != 11 {
+		t.Errorf("Expected the clock at 11, got %d", server.clock.GetTime())
+	}
+	if got := server.metrics.Value("lamport_duplicate_messages_total", "transport", "test"); got != 1 {
+		t.Errorf("Expected 1 duplicate counted, got %v", got)
+	}
+}
+
+func TestReceiveMessageWithoutDedup(t *testing.T) {
+	server := NewServer()
+	server.seen = nil
+	for range 3 {
+		if _, err := server.receiveMessage(t.Context(), "b", "e1", ClockTime{Timestamp: 5}, "hello"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if server.clock.GetTime() != 8 {
+		t.Errorf("Expected every copy merged up to 8, got %d", server.clock.GetTime())
+	}
+}
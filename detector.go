@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PeerState is what the failure detector believes about a peer
+type PeerState string
+
+// Peer states, from answering heartbeats to silent for longer than the
+// dead threshold
+const (
+	PeerAlive   PeerState = "alive"
+	PeerSuspect PeerState = "suspect"
+	PeerDead    PeerState = "dead"
+)
+
+// PeerHealth is the failure detector's view of one peer. LastTime is the
+// peer's clock at its latest heartbeat.
+type PeerHealth struct {
+	URL         string    `json:"url"`
+	Node        string    `json:"node,omitempty"`
+	State       PeerState `json:"state"`
+	LastHeard   time.Time `json:"last_heard"`
+	LastTime    ClockTime `json:"last_time"`
+	Missed      int       `json:"missed"`
+	LastFailure string    `json:"last_failure,omitempty"`
+}
+
+// FailureDetector sends heartbeats to every peer and classifies them by how
+// long ago they last answered: alive, suspect after suspectAfter and dead
+// after deadAfter. Peers start out alive. Subscribers are told about every
+// state change.
+type FailureDetector struct {
+	server       *Server
+	interval     time.Duration
+	suspectAfter time.Duration
+	deadAfter    time.Duration
+
+	peers       map[string]*PeerHealth
+	subscribers []func(PeerHealth, PeerState)
+	mutex       sync.Mutex
+}
+
+// NewFailureDetector creates a detector over the server's peers
+func NewFailureDetector(server *Server, interval, suspectAfter, deadAfter time.Duration) *FailureDetector {
+	server.metrics.Counter("lamport_peer_state_changes_total", "Peer state changes seen by the failure detector")
+	return &FailureDetector{
+		server:       server,
+		interval:     interval,
+		suspectAfter: suspectAfter,
+		deadAfter:    deadAfter,
+		peers:        make(map[string]*PeerHealth),
+	}
+}
+
+// Subscribe registers fn to be called with the peer and its previous state
+// whenever a peer changes state. Calls happen on the detector's goroutine.
+func (d *FailureDetector) Subscribe(fn func(peer PeerHealth, previous PeerState)) {
+	d.mutex.Lock()
+	d.subscribers = append(d.subscribers, fn)
+	d.mutex.Unlock()
+}
+
+// State returns the state of a peer; unknown peers are alive
+func (d *FailureDetector) State(peer string) PeerState {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if p, ok := d.peers[peer]; ok {
+		return p.State
+	}
+	return PeerAlive
+}
+
+// Peers returns the health of every peer ordered by URL
+func (d *FailureDetector) Peers() []PeerHealth {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	peers := make([]PeerHealth, 0, len(d.peers))
+	for _, p := range d.peers {
+		peers = append(peers, *p)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].URL < peers[j].URL })
+	return peers
+}
+
+// Run sends heartbeats every interval until ctx is done
+func (d *FailureDetector) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		d.heartbeat(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// heartbeat asks every peer for its time, then reclassifies the peers
+func (d *FailureDetector) heartbeat(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, d.interval)
+	defer cancel()
+	responses := d.server.peers.Gather(ctx, http.MethodGet, "/time", nil, nil)
+
+	now := time.Now()
+	d.mutex.Lock()
+	for url := range d.peers {
+		if _, ok := responses[url]; !ok {
+			delete(d.peers, url) // left the cluster
+		}
+	}
+	for url, resp := range responses {
+		p, ok := d.peers[url]
+		if !ok {
+			p = &PeerHealth{URL: url, State: PeerAlive, LastHeard: now}
+			d.peers[url] = p
+		}
+		var reply struct {
+			Node      string `json:"node_id"`
+			Timestamp int64  `json:"lamport_timestamp"`
+			Epoch     int64  `json:"epoch"`
+		}
+		err := resp.Err
+		if err == nil {
+			err = json.Unmarshal(resp.Body, &reply)
+		}
+		if err != nil {
+			p.Missed++
+			p.LastFailure = err.Error()
+			continue
+		}
+		p.LastHeard = now
+		p.LastTime = ClockTime{Epoch: reply.Epoch, Timestamp: reply.Timestamp}
+		p.Missed = 0
+		p.LastFailure = ""
+		if reply.Node != "" {
+			p.Node = reply.Node
+		}
+	}
+	changes := d.classifyLocked(now)
+	subscribers := append([]func(PeerHealth, PeerState){}, d.subscribers...)
+	d.mutex.Unlock()
+
+	for _, c := range changes {
+		d.server.metrics.Inc("lamport_peer_state_changes_total", "state", string(c.peer.State))
+		d.server.logger.Warn("Peer state changed", "peer", c.peer.URL, "node", c.peer.Node,
+			"from", string(c.previous), "to", string(c.peer.State))
+		for _, fn := range subscribers {
+			fn(c.peer, c.previous)
+		}
+	}
+}
+
+type peerStateChange struct {
+	peer     PeerHealth
+	previous PeerState
+}
+
+// classifyLocked updates every peer's state from the time since it was
+// last heard and returns the changes
+func (d *FailureDetector) classifyLocked(now time.Time) []peerStateChange {
+	var changes []peerStateChange
+	for _, p := range d.peers {
+		state := PeerAlive
+		switch silent := now.Sub(p.LastHeard); {
+		case silent >= d.deadAfter:
+			state = PeerDead
+		case silent >= d.suspectAfter:
+			state = PeerSuspect
+		}
+		if state != p.State {
+			previous := p.State
+			p.State = state
+			changes = append(changes, peerStateChange{peer: *p, previous: previous})
+		}
+	}
+	return changes
+}
+
+func (d *FailureDetector) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"node_id":            d.server.nodeID,
+		"peers":              d.Peers(),
+		"heartbeat_interval": d.interval.String(),
+		"suspect_after":      d.suspectAfter.String(),
+		"dead_after":         d.deadAfter.String(),
+	})
+}
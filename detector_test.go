@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTimePeer serves GET /time of a fresh node
+func newTimePeer(t *testing.T, id string) *httptest.Server {
+	peer := NewServer()
+	peer.nodeID = id
+	peer.clock.Update(40)
+	ts := httptest.NewServer(http.HandlerFunc(peer.handleGetTime))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestFailureDetectorClassifiesPeers(t *testing.T) {
+	alive := newTimePeer(t, "b")
+	down := newTimePeer(t, "c")
+	down.Close()
+
+	server := NewServer()
+	server.nodeID = "a"
+	server.peers = NewPeers([]string{alive.URL, down.URL}, http.DefaultClient)
+	d := NewFailureDetector(server, 20*time.Millisecond, 30*time.Millisecond, 80*time.Millisecond)
+
+	var changes []PeerHealth
+	d.Subscribe(func(peer PeerHealth, previous PeerState) {
+		changes = append(changes, peer)
+	})
+
+	d.heartbeat(t.Context())
+	if d.State(down.URL) != PeerAlive {
+		t.Errorf("Expected peers to start alive, got %s", d.State(down.URL))
+	}
+	time.Sleep(40 * time.Millisecond)
+	d.heartbeat(t.Context())
+	if d.State(down.URL) != PeerSuspect {
+		t.Errorf("Expected suspect, got %s", d.State(down.URL))
+	}
+	time.Sleep(50 * time.Millisecond)
+	d.heartbeat(t.Context())
+	if d.State(down.URL) != PeerDead {
+		t.Errorf("Expected dead, got %s", d.State(down.URL))
+	}
+	if d.State(alive.URL) != PeerAlive {
+		t.Errorf("Expected alive, got %s", d.State(alive.URL))
+	}
+
+	if len(changes) != 2 || changes[0].State != PeerSuspect || changes[1].State != PeerDead {
+		t.Errorf("Expected suspect then dead, got %+v", changes)
+	}
+	if changes[1].Missed != 3 || changes[1].LastFailure == "" {
+		t.Errorf("Expected 3 missed heartbeats with a failure, got %+v", changes[1])
+	}
+
+	peers := d.Peers()
+	for _, p := range peers {
+		if p.URL == alive.URL && (p.Node != "b" || p.LastTime.Timestamp != 41) {
+			t.Errorf("Expected b's node ID and time, got %+v", p)
+		}
+	}
+
+	// Removed peers are forgotten
+	server.peers.Remove(down.URL)
+	d.heartbeat(t.Context())
+	if len(d.Peers()) != 1 {
+		t.Errorf("Expected 1 peer after removal, got %d", len(d.Peers()))
+	}
+}
+
+func TestFailureDetectorSignals(t *testing.T) {
+	server := NewServer()
+	server.nodeID = "b"
+	server.peers = NewPeers(nil, http.DefaultClient)
+	d := NewFailureDetector(server, time.Second, 3*time.Second, 10*time.Second)
+
+	election := NewElection(server, time.Second, 3*time.Second)
+	election.watch(d)
+	election.accept("a", ClockTime{Timestamp: 1})
+	multicast := NewMulticast(server)
+	multicast.watch(d)
+	multicast.Join("a")
+
+	// Simulate the leader falling silent
+	d.peers["http://a:8080"] = &PeerHealth{URL: "http://a:8080", Node: "a", State: PeerAlive,
+		LastHeard: time.Now().Add(-time.Minute)}
+	changes := d.classifyLocked(time.Now())
+	for _, c := range changes {
+		for _, fn := range d.subscribers {
+			fn(c.peer, c.previous)
+		}
+	}
+
+	select {
+	case <-election.kick:
+	default:
+		t.Error("Expected an election when the leader dies")
+	}
+	if multicast.queue.members != 1 {
+		t.Errorf("Expected the dead peer to leave the group, got %d members", multicast.queue.members)
+	}
+
+	// Coming back readmits it
+	back := PeerHealth{URL: "http://a:8080", Node: "a", State: PeerAlive}
+	for _, fn := range d.subscribers {
+		fn(back, PeerDead)
+	}
+	if multicast.queue.members != 2 {
+		t.Errorf("Expected the peer to rejoin, got %d members", multicast.queue.members)
+	}
+}
+
+func TestHandleClusterHealth(t *testing.T) {
+	server := NewServer()
+	server.nodeID = "a"
+	server.peers = NewPeers(nil, http.DefaultClient)
+	d := NewFailureDetector(server, time.Second, 3*time.Second, 10*time.Second)
+
+	req := httptest.NewRequest(http.MethodGet, "/cluster/health", nil)
+	w := httptest.NewRecorder()
+	d.handleHealth(w, req)
+
+	var response map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&response)
+	if response["dead_after"] != "10s" || response["suspect_after"] != "3s" {
+		t.Errorf("Expected the thresholds, got %v", response)
+	}
+	if peers, ok := response["peers"].([]interface{}); !ok || len(peers) != 0 {
+		t.Errorf("Expected an empty peer list, got %v", response["peers"])
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/cluster/health", nil)
+	w = httptest.NewRecorder()
+	d.handleHealth(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", w.Code)
+	}
+}
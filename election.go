@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Election message kinds
+const (
+	electionCall        = "election"
+	electionCoordinator = "coordinator"
+)
+
+// ElectionMessage is exchanged between nodes on /peer/election. Messages
+// carry the sender's current time without counting as events, so
+// heartbeats do not inflate timestamps.
+type ElectionMessage struct {
+	Kind      string `json:"kind"`
+	Node      string `json:"node"`
+	Timestamp int64  `json:"lamport_timestamp"`
+	Epoch     int64  `json:"epoch,omitempty"`
+}
+
+// ElectionReply answers an election message. Defer is set when the
+// replying node outranks the sender and will run its own election.
+type ElectionReply struct {
+	Node   string `json:"node"`
+	Defer  bool   `json:"defer"`
+	Leader string `json:"leader,omitempty"`
+}
+
+// Election elects a coordinator among the server and its peers with the
+// bully algorithm. Nodes are ranked by node ID, the lowest ID winning,
+// which matches how the node tie breaker orders events with equal
+// timestamps. The leader announces itself every interval; when nobody has
+// heard from it for timeout, a new election starts.
+type Election struct {
+	server   *Server
+	interval time.Duration
+	timeout  time.Duration
+
+	leader    string
+	elected   ClockTime // time of the leader's first announcement
+	lastHeard time.Time
+	electing  bool
+	nodes     map[string]string // peer URL to node ID, learned from replies
+
+	// kick starts an election without waiting for the next interval
+	kick  chan struct{}
+	mutex sync.Mutex
+}
+
+// NewElection creates the election of the server and its peers
+func NewElection(server *Server, interval, timeout time.Duration) *Election {
+	server.metrics.Counter("lamport_election_leader_changes_total", "Times this node saw the cluster leader change")
+	e := &Election{
+		server:   server,
+		interval: interval,
+		timeout:  timeout,
+		nodes:    make(map[string]string),
+		kick:     make(chan struct{}, 1),
+	}
+	server.metrics.GaugeFunc("lamport_election_is_leader", "1 when this node is the elected leader", func() float64 {
+		if e.IsLeader() {
+			return 1
+		}
+		return 0
+	})
+	return e
+}
+
+// outranks reports whether node a wins an election against node b
+func outranks(a, b string) bool {
+	return a < b
+}
+
+// Leader returns the ID of the current leader, empty while none is known
+func (e *Election) Leader() string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.leader
+}
+
+// IsLeader reports whether this node is the leader
+func (e *Election) IsLeader() bool {
+	return e.Leader() == e.server.nodeID
+}
+
+// Run holds an election, then keeps announcing or watching the leader
+// until ctx is done
+func (e *Election) Run(ctx context.Context) {
+	e.elect(ctx)
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.kick:
+			e.elect(ctx)
+		case <-ticker.C:
+			if e.IsLeader() {
+				e.announce(ctx)
+				continue
+			}
+			e.mutex.Lock()
+			expired := time.Since(e.lastHeard) > e.timeout
+			e.mutex.Unlock()
+			if expired {
+				e.server.logger.Warn("Leader timed out, starting election", "leader", e.Leader())
+				e.elect(ctx)
+			}
+		}
+	}
+}
+
+// elect calls an election. Peers that outrank this node defer it and hold
+// their own; when none does, this node becomes the leader.
+func (e *Election) elect(ctx context.Context) {
+	e.mutex.Lock()
+	e.electing = true
+	e.mutex.Unlock()
+	defer func() {
+		e.mutex.Lock()
+		e.electing = false
+		e.mutex.Unlock()
+	}()
+
+	deferred := false
+	for _, reply := range e.send(ctx, electionCall) {
+		deferred = deferred || reply.Defer
+	}
+	if deferred {
+		// Give the higher ranked nodes one timeout to announce themselves
+		e.mutex.Lock()
+		e.lastHeard = time.Now()
+		e.mutex.Unlock()
+		return
+	}
+
+	e.accept(e.server.nodeID, e.server.clock.Now())
+	e.announce(ctx)
+}
+
+// announce tells every peer this node is the leader
+func (e *Election) announce(ctx context.Context) {
+	e.send(ctx, electionCoordinator)
+}
+
+// send sends a message to every peer, returning the replies of the peers
+// that answered
+func (e *Election) send(ctx context.Context, kind string) map[string]ElectionReply {
+	now := e.server.clock.Now()
+	body, _ := json.Marshal(ElectionMessage{Kind: kind, Node: e.server.nodeID, Timestamp: now.Timestamp, Epoch: now.Epoch})
+	header := http.Header{"Content-Type": []string{"application/json"}}
+
+	ctx, cancel := context.WithTimeout(ctx, e.interval)
+	defer cancel()
+
+	replies := make(map[string]ElectionReply)
+	for peer, resp := range e.server.peers.Gather(ctx, http.MethodPost, "/peer/election", header, body) {
+		var reply ElectionReply
+		if resp.Err != nil || json.Unmarshal(resp.Body, &reply) != nil {
+			continue
+		}
+		replies[peer] = reply
+		if reply.Node != "" {
+			e.mutex.Lock()
+			e.nodes[peer] = reply.Node
+			e.mutex.Unlock()
+		}
+	}
+	return replies
+}
+
+// accept records node as the leader
+func (e *Election) accept(node string, at ClockTime) {
+	e.mutex.Lock()
+	changed := e.leader != node
+	if changed {
+		e.leader = node
+		e.elected = at
+	}
+	e.lastHeard = time.Now()
+	e.mutex.Unlock()
+
+	if changed {
+		e.server.metrics.Inc("lamport_election_leader_changes_total")
+		e.server.logger.Info("Leader elected", "leader", node, "lamport_timestamp", at.Timestamp)
+	}
+}
+
+// watch starts an election as soon as the failure detector declares the
+// leader dead, without waiting for the election timeout
+func (e *Election) watch(d *FailureDetector) {
+	d.Subscribe(func(peer PeerHealth, _ PeerState) {
+		if peer.State == PeerDead && peer.Node != "" && peer.Node == e.Leader() {
+			e.trigger()
+		}
+	})
+}
+
+// trigger starts an election unless one is already queued
+func (e *Election) trigger() {
+	select {
+	case e.kick <- struct{}{}:
+	default:
+	}
+}
+
+func (e *Election) handlePeerElection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var msg ElectionMessage
+	err := json.NewDecoder(r.Body).Decode(&msg)
+	if err != nil || msg.Node == "" || msg.Node == e.server.nodeID ||
+		(msg.Kind != electionCall && msg.Kind != electionCoordinator) {
+		http.Error(w, "Invalid election message", http.StatusBadRequest)
+		return
+	}
+	at := ClockTime{Epoch: msg.Epoch, Timestamp: msg.Timestamp}
+	if _, err := e.server.clock.observeFrom(at, ClockSource{Peer: msg.Node, RequestID: requestIDFrom(r.Context())}); errors.Is(err, ErrJumpTooLarge) {
+		http.Error(w, "Timestamp jump exceeds max_jump", http.StatusUnprocessableEntity)
+		return
+	}
+
+	// A lower ranked node calling an election or claiming to lead is
+	// bullied into deferring to this node
+	reply := ElectionReply{Node: e.server.nodeID}
+	if outranks(e.server.nodeID, msg.Node) {
+		reply.Defer = true
+		e.trigger()
+	} else if msg.Kind == electionCoordinator {
+		e.accept(msg.Node, at)
+	}
+	reply.Leader = e.Leader()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reply)
+}
+
+// handleLeader shows the current leader
+func (e *Election) handleLeader(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	e.mutex.Lock()
+	state := "follower"
+	switch {
+	case e.electing:
+		state = "electing"
+	case e.leader == e.server.nodeID:
+		state = "leader"
+	}
+	response := map[string]interface{}{
+		"node_id":    e.server.nodeID,
+		"leader":     e.leader,
+		"state":      state,
+		"elected_at": e.elected,
+	}
+	for url, id := range e.nodes {
+		if id == e.leader {
+			response["leader_url"] = url
+		}
+	}
+	if !e.lastHeard.IsZero() {
+		response["last_heard"] = e.lastHeard
+	}
+	e.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
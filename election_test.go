@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type electionNode struct {
+	election *Election
+	ts       *httptest.Server
+	stop     context.CancelFunc
+	done     sync.WaitGroup
+}
+
+// newElectionCluster starts nodes that elect a leader over HTTP
+func newElectionCluster(t *testing.T, ids ...string) []*electionNode {
+	nodes := make([]*electionNode, len(ids))
+	urls := make([]string, len(ids))
+	for i, id := range ids {
+		server := NewServer()
+		server.nodeID = id
+		node := &electionNode{}
+		node.ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			node.election.handlePeerElection(w, r)
+		}))
+		t.Cleanup(node.ts.Close)
+		urls[i] = node.ts.URL
+		node.election = NewElection(server, 20*time.Millisecond, 100*time.Millisecond)
+		nodes[i] = node
+	}
+	for i, node := range nodes {
+		var peers []string
+		for j, u := range urls {
+			if j != i {
+				peers = append(peers, u)
+			}
+		}
+		node.election.server.peers = NewPeers(peers, http.DefaultClient)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		node.stop = cancel
+		node.done.Add(1)
+		go func() {
+			defer node.done.Done()
+			node.election.Run(ctx)
+		}()
+		t.Cleanup(node.halt)
+	}
+	return nodes
+}
+
+// halt stops the node as if it had crashed
+func (n *electionNode) halt() {
+	n.stop()
+	n.done.Wait()
+	n.ts.Close()
+}
+
+// waitForLeader waits until every node agrees on want
+func waitForLeader(t *testing.T, nodes []*electionNode, want string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for _, n := range nodes {
+		for n.election.Leader() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected leader %s on %s, got %q", want, n.election.server.nodeID, n.election.Leader())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+}
+
+func TestElectionLowestNodeWins(t *testing.T) {
+	nodes := newElectionCluster(t, "c", "a", "b")
+	waitForLeader(t, nodes, "a")
+
+	if !nodes[1].election.IsLeader() || nodes[0].election.IsLeader() {
+		t.Error("Expected only a to lead")
+	}
+}
+
+func TestElectionReelectsOnLeaderFailure(t *testing.T) {
+	nodes := newElectionCluster(t, "a", "b", "c")
+	waitForLeader(t, nodes, "a")
+
+	nodes[0].halt()
+	waitForLeader(t, nodes[1:], "b")
+}
+
+func TestPeerElectionBullies(t *testing.T) {
+	server := NewServer()
+	server.nodeID = "a"
+	e := NewElection(server, time.Second, 3*time.Second)
+
+	post := func(msg ElectionMessage) (int, ElectionReply) {
+		body, _ := json.Marshal(msg)
+		req := httptest.NewRequest(http.MethodPost, "/peer/election", strings.NewReader(string(body)))
+		w := httptest.NewRecorder()
+		e.handlePeerElection(w, req)
+		var reply ElectionReply
+		json.NewDecoder(w.Body).Decode(&reply)
+		return w.Code, reply
+	}
+
+	// A higher node claiming to lead is told to defer
+	code, reply := post(ElectionMessage{Kind: electionCoordinator, Node: "b", Timestamp: 7})
+	if code != http.StatusOK || !reply.Defer {
+		t.Errorf("Expected a deferral, got %d %+v", code, reply)
+	}
+	if e.Leader() != "" {
+		t.Errorf("Expected no leader accepted, got %q", e.Leader())
+	}
+	select {
+	case <-e.kick:
+	default:
+		t.Error("Expected an election to be triggered")
+	}
+	if server.clock.GetTime() != 7 {
+		t.Errorf("Expected clock raised to 7, got %d", server.clock.GetTime())
+	}
+
+	if code, _ := post(ElectionMessage{Kind: "vote", Node: "b"}); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for unknown kind, got %d", code)
+	}
+	if code, _ := post(ElectionMessage{Kind: electionCall, Node: "a"}); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for own node ID, got %d", code)
+	}
+}
+
+func TestPeerElectionAcceptsHigherRankedLeader(t *testing.T) {
+	server := NewServer()
+	server.nodeID = "b"
+	e := NewElection(server, time.Second, 3*time.Second)
+
+	body := `{"kind":"coordinator","node":"a","lamport_timestamp":3}`
+	req := httptest.NewRequest(http.MethodPost, "/peer/election", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	e.handlePeerElection(w, req)
+
+	var reply ElectionReply
+	json.NewDecoder(w.Body).Decode(&reply)
+	if reply.Defer || reply.Leader != "a" {
+		t.Errorf("Expected a accepted, got %+v", reply)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/cluster/leader", nil)
+	w = httptest.NewRecorder()
+	e.handleLeader(w, req)
+	var response map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&response)
+	if response["leader"] != "a" || response["state"] != "follower" {
+		t.Errorf("Expected follower of a, got %v", response)
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// encryptedPrefix starts every value EventCipher encrypted. Values
+// without it were stored before encryption was enabled and are read as
+// they are.
+const encryptedPrefix = "enc:v1:"
+
+// keyIDSize is the length of the key fingerprint stored with each value
+const keyIDSize = 4
+
+// ErrUnknownEncryptionKey is returned for a value encrypted with none of
+// the keys
+var ErrUnknownEncryptionKey = errors.New("encrypted with an unknown key")
+
+// KeySource returns the encryption keys, newest first. It is the hook for
+// key management services: a KeySource can fetch or unwrap the keys from
+// one instead of reading them from the environment.
+type KeySource func(ctx context.Context) ([][]byte, error)
+
+// EnvKeySource reads the keys from the environment variable name, as
+// base64, separated by commas
+func EnvKeySource(name string) KeySource {
+	return func(ctx context.Context) ([][]byte, error) {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s is not set", name)
+		}
+		return parseKeys(value)
+	}
+}
+
+// CommandKeySource runs command with the shell and reads the keys from
+// its output, as base64, separated by commas or lines. Key management
+// services are reached through their command-line clients this way.
+func CommandKeySource(command string) KeySource {
+	return func(ctx context.Context) ([][]byte, error) {
+		cmd := exec.CommandContext(ctx, "sh", "-c", command)
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("running key command: %w", err)
+		}
+		return parseKeys(strings.ReplaceAll(string(out), "\n", ","))
+	}
+}
+
+func parseKeys(value string) ([][]byte, error) {
+	var keys [][]byte
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(field)
+		if err != nil {
+			return nil, fmt.Errorf("key %d is not base64: %w", len(keys)+1, err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no encryption key")
+	}
+	return keys, nil
+}
+
+// EventCipher encrypts the messages and payloads of events with AES-GCM.
+// The first key encrypts; all of them decrypt, so keys can be rotated by
+// putting the new one first. Each value is bound to the ID of its event,
+// so it cannot be moved to another one.
+type EventCipher struct {
+	keys map[[keyIDSize]byte]cipher.AEAD
+	id   [keyIDSize]byte // of the key that encrypts
+}
+
+// NewEventCipher creates a cipher from 16, 24 or 32 byte keys
+func NewEventCipher(keys [][]byte) (*EventCipher, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no encryption key")
+	}
+	c := &EventCipher{keys: make(map[[keyIDSize]byte]cipher.AEAD, len(keys))}
+	for i, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", i+1, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		id := keyID(key)
+		if i == 0 {
+			c.id = id
+		}
+		c.keys[id] = aead
+	}
+	return c, nil
+}
+
+// LoadEventCipher creates a cipher from the keys source returns
+func LoadEventCipher(ctx context.Context, source KeySource) (*EventCipher, error) {
+	keys, err := source(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewEventCipher(keys)
+}
+
+func keyID(key []byte) (id [keyIDSize]byte) {
+	sum := sha256.Sum256(key)
+	copy(id[:], sum[:])
+	return id
+}
+
+// Encrypt seals value for the event with the given ID
+func (c *EventCipher) Encrypt(eventID, value string) string {
+	aead := c.keys[c.id]
+	nonce := make([]byte, aead.NonceSize(), keyIDSize+aead.NonceSize()+len(value)+aead.Overhead())
+	rand.Read(nonce)
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(eventID))
+	return encryptedPrefix + base64.RawStdEncoding.EncodeToString(append(c.id[:], sealed...))
+}
+
+// Decrypt opens a value Encrypt sealed for the event with the given ID.
+// Values that were not encrypted are returned as they are.
+func (c *EventCipher) Decrypt(eventID, value string) (string, error) {
+	encoded, ok := strings.CutPrefix(value, encryptedPrefix)
+	if !ok {
+		return value, nil
+	}
+	data, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(data) < keyIDSize {
+		return "", errors.New("malformed encrypted value")
+	}
+	aead, ok := c.keys[[keyIDSize]byte(data[:keyIDSize])]
+	if !ok {
+		return "", ErrUnknownEncryptionKey
+	}
+	data = data[keyIDSize:]
+	if len(data) < aead.NonceSize() {
+		return "", errors.New("malformed encrypted value")
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(eventID))
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// EncryptEvent returns the event with its message and payload encrypted.
+// The payload becomes a JSON string, so stores keep it as JSON.
+func (c *EventCipher) EncryptEvent(e Event) Event {
+	if e.Message != "" {
+		e.Message = c.Encrypt(e.ID, e.Message)
+	}
+	if len(e.Payload) > 0 {
+		e.Payload, _ = json.Marshal(c.Encrypt(e.ID, string(e.Payload)))
+	}
+	return e
+}
+
+// DecryptEvent reverses EncryptEvent
+func (c *EventCipher) DecryptEvent(e Event) (Event, error) {
+	message, err := c.Decrypt(e.ID, e.Message)
+	if err != nil {
+		return e, fmt.Errorf("decrypting message: %w", err)
+	}
+	e.Message = message
+	var sealed string
+	if json.Unmarshal(e.Payload, &sealed) == nil && strings.HasPrefix(sealed, encryptedPrefix) {
+		payload, err := c.Decrypt(e.ID, sealed)
+		if err != nil {
+			return e, fmt.Errorf("decrypting payload: %w", err)
+		}
+		e.Payload = json.RawMessage(payload)
+	}
+	return e, nil
+}
+
+// EncryptedStore encrypts the messages and payloads of the events it
+// appends to a persistent store, and decrypts them as they are read back,
+// so they never reach the disk or the database in the clear. Events that
+// cannot be decrypted are logged and returned as stored.
+type EncryptedStore struct {
+	inner  EventStore
+	cipher *EventCipher
+	logger *slog.Logger
+}
+
+// encryptedSharedLog is an EncryptedStore over a shared log, which it
+// keeps locking through
+type encryptedSharedLog struct {
+	*EncryptedStore
+	sharedLog
+}
+
+// NewEncryptedStore encrypts the events kept in inner
+func NewEncryptedStore(inner EventStore, cipher *EventCipher, logger *slog.Logger) EventStore {
+	st := &EncryptedStore{inner: inner, cipher: cipher, logger: logger}
+	if shared, ok := inner.(sharedLog); ok {
+		return encryptedSharedLog{st, shared}
+	}
+	return st
+}
+
+func (st *EncryptedStore) decrypt(events []Event) []Event {
+	for i, e := range events {
+		events[i] = st.decryptOne(e)
+	}
+	return events
+}
+
+func (st *EncryptedStore) decryptOne(e Event) Event {
+	plain, err := st.cipher.DecryptEvent(e)
+	if err != nil {
+		st.logger.Error("Failed to decrypt stored event", "event_id", e.ID, "error", err)
+	}
+	return plain
+}
+
+func (st *EncryptedStore) encrypt(events []Event) []Event {
+	sealed := make([]Event, len(events))
+	for i, e := range events {
+		sealed[i] = st.cipher.EncryptEvent(e)
+	}
+	return sealed
+}
+
+func (st *EncryptedStore) Append(event Event) {
+	st.inner.Append(st.cipher.EncryptEvent(event))
+}
+
+func (st *EncryptedStore) Events() []Event {
+	return st.decrypt(st.inner.Events())
+}
+
+func (st *EncryptedStore) Len() int {
+	return st.inner.Len()
+}
+
+func (st *EncryptedStore) Replace(events []Event) {
+	st.inner.Replace(st.encrypt(events))
+}
+
+func (st *EncryptedStore) Dropped() int64 {
+	return st.inner.Dropped()
+}
+
+func (st *EncryptedStore) Trim(n int) []Event {
+	return st.decrypt(st.inner.Trim(n))
+}
+
+// The checked writes pass the failures of the inner store on
+
+func (st *EncryptedStore) appendChecked(event Event) error {
+	return appendChecked(st.inner, st.cipher.EncryptEvent(event))
+}
+
+func (st *EncryptedStore) appendAllChecked(events []Event) error {
+	return appendAllChecked(st.inner, st.encrypt(events))
+}
+
+func (st *EncryptedStore) trimChecked(n int) ([]Event, error) {
+	trimmed, err := trimChecked(st.inner, n)
+	return st.decrypt(trimmed), err
+}
+
+func (st *EncryptedStore) replaceChecked(events []Event) error {
+	return replaceChecked(st.inner, st.encrypt(events))
+}
+
+func (st *EncryptedStore) writeErr() error {
+	return storeWriteErr(st.inner)
+}
+
+func (st *EncryptedStore) Between(from, to ClockTime) []Event {
+	return st.decrypt(st.inner.Between(from, to))
+}
+
+func (st *EncryptedStore) Find(id string) (Event, bool) {
+	e, ok := st.inner.Find(id)
+	if !ok {
+		return e, false
+	}
+	return st.decryptOne(e), true
+}
+
+// Search matches the decrypted messages, as the stored ones are sealed
+func (st *EncryptedStore) Search(text string) []Event {
+	var found []Event
+	for _, e := range st.Events() {
+		if strings.Contains(e.Message, text) {
+			found = append(found, e)
+		}
+	}
+	return found
+}
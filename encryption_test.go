@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	return []byte(strings.Repeat(string(rune(b)), 32))
+}
+
+func TestEventCipher(t *testing.T) {
+	old, err := NewEventCipher([][]byte{testKey('a')})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed := old.EncryptEvent(Event{ID: "e1", Message: "secret", Payload: json.RawMessage(`{"card":"4111"}`)})
+	if strings.Contains(sealed.Message, "secret") || strings.Contains(string(sealed.Payload), "4111") || !json.Valid(sealed.Payload) {
+		t.Fatalf("Expected the message and payload sealed as JSON, got %+v", sealed)
+	}
+
+	// The new key encrypts and the old one still decrypts
+	rotated, _ := NewEventCipher([][]byte{testKey('b'), testKey('a')})
+	if e, err := rotated.DecryptEvent(sealed); err != nil || e.Message != "secret" || string(e.Payload) != `{"card":"4111"}` {
+		t.Errorf("Expected the event decrypted with the old key, got %+v (err: %v)", e, err)
+	}
+	if _, err := old.DecryptEvent(rotated.EncryptEvent(Event{ID: "e2", Message: "new"})); !errors.Is(err, ErrUnknownEncryptionKey) {
+		t.Errorf("Expected the new key unknown to the old cipher, got %v", err)
+	}
+
+	// A value moved to another event does not open
+	sealed.ID = "e3"
+	if _, err := old.DecryptEvent(sealed); err == nil {
+		t.Error("Expected a value sealed for another event refused")
+	}
+	// Values stored before encryption read as they are
+	if e, err := old.DecryptEvent(Event{ID: "e4", Message: "plain", Payload: json.RawMessage(`"text"`)}); err != nil || e.Message != "plain" || string(e.Payload) != `"text"` {
+		t.Errorf("Expected a plaintext event unchanged, got %+v (err: %v)", e, err)
+	}
+	if _, err := NewEventCipher([][]byte{[]byte("short")}); err == nil {
+		t.Error("Expected a key of the wrong size refused")
+	}
+}
+
+func TestEnvKeySource(t *testing.T) {
+	t.Setenv("TEST_EVENT_KEYS", base64.StdEncoding.EncodeToString(testKey('a'))+", "+base64.StdEncoding.EncodeToString(testKey('b')))
+	if keys, err := EnvKeySource("TEST_EVENT_KEYS")(t.Context()); err != nil || len(keys) != 2 || string(keys[1]) != string(testKey('b')) {
+		t.Errorf("Expected two keys, got %d (err: %v)", len(keys), err)
+	}
+	if _, err := EnvKeySource("TEST_EVENT_KEYS_UNSET")(t.Context()); err == nil {
+		t.Error("Expected an unset variable refused")
+	}
+	if keys, err := CommandKeySource("echo " + base64.StdEncoding.EncodeToString(testKey('c')))(t.Context()); err != nil || len(keys) != 1 {
+		t.Errorf("Expected the key printed by the command, got %d (err: %v)", len(keys), err)
+	}
+}
+
+func TestEncryptedSQLiteStore(t *testing.T) {
+	db := openTestSQLiteStore(t, filepath.Join(t.TempDir(), "events.db"))
+	cipher, _ := NewEventCipher([][]byte{testKey('a')})
+	st := NewEncryptedStore(db, cipher, slog.Default())
+
+	st.Append(Event{ID: "e1", Message: "card 4111", Timestamp: 1})
+	st.Append(Event{ID: "e2", Message: "hello", Timestamp: 2, Payload: json.RawMessage(`{"n":1}`)})
+
+	result, err := db.Query(t.Context(), "SELECT message, data FROM events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range result.Rows {
+		for _, column := range row {
+			if s, _ := column.(string); strings.Contains(s, "4111") || strings.Contains(s, "hello") {
+				t.Fatalf("Expected nothing stored in the clear, got %v", row)
+			}
+		}
+	}
+
+	if e, ok := st.Find("e2"); !ok || e.Message != "hello" || string(e.Payload) != `{"n":1}` {
+		t.Errorf("Expected e2 decrypted, got %+v", e)
+	}
+	if found := st.Search("4111"); len(found) != 1 || found[0].ID != "e1" {
+		t.Errorf("Expected e1 found by its decrypted message, got %+v", found)
+	}
+	if events := st.Between(ClockTime{}, ClockTime{Timestamp: 2}); len(events) != 2 || events[0].Message != "card 4111" {
+		t.Errorf("Expected both events decrypted, got %+v", events)
+	}
+
+	// Without the key the events are returned as stored
+	other, _ := NewEventCipher([][]byte{testKey('b')})
+	if e, _ := NewEncryptedStore(db, other, slog.Default()).Find("e1"); !strings.HasPrefix(e.Message, encryptedPrefix) {
+		t.Errorf("Expected the sealed message without the key, got %q", e.Message)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// defaultRollover leaves headroom below MaxInt64 so that a merge with a
+// received timestamp close to the limit can still increment safely
+const defaultRollover = math.MaxInt64 - 1<<20
+
+// ClockTime is a point in logical time. Timestamps restart from zero in
+// every epoch, so pairs are ordered by epoch first.
+type ClockTime struct {
+	Epoch     int64 `json:"epoch"`
+	Timestamp int64 `json:"lamport_timestamp"`
+}
+
+// Compare returns -1, 0 or +1 depending on whether ct is before, equal to
+// or after other
+func (ct ClockTime) Compare(other ClockTime) int {
+	switch {
+	case ct.Epoch < other.Epoch:
+		return -1
+	case ct.Epoch > other.Epoch:
+		return 1
+	case ct.Timestamp < other.Timestamp:
+		return -1
+	case ct.Timestamp > other.Timestamp:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Before reports whether ct is strictly before other
+func (ct ClockTime) Before(other ClockTime) bool {
+	return ct.Compare(other) < 0
+}
+
+func (ct ClockTime) String() string {
+	if ct.Epoch == 0 {
+		return fmt.Sprintf("%d", ct.Timestamp)
+	}
+	return fmt.Sprintf("%d:%d", ct.Epoch, ct.Timestamp)
+}
+
+// distance returns how far ahead to is from ct, given the rollover threshold
+// of the epochs in between. ok is false when the distance does not fit in an
+// int64 or to is not ahead at all.
+func (ct ClockTime) distance(to ClockTime, rollover int64) (d int64, ok bool) {
+	switch {
+	case to.Compare(ct) <= 0:
+		return 0, false
+	case to.Epoch == ct.Epoch:
+		return to.Timestamp - ct.Timestamp, true
+	case to.Epoch == ct.Epoch+1:
+		rest := rollover - ct.Timestamp
+		if rest < 0 || to.Timestamp > math.MaxInt64-rest {
+			return 0, false
+		}
+		return rest + to.Timestamp, true
+	default:
+		return 0, false
+	}
+}
+
+// advance returns ct moved forward by n ticks, carrying into the next epoch
+func (ct ClockTime) advance(n, rollover int64) ClockTime {
+	if n <= rollover-ct.Timestamp {
+		return ClockTime{Epoch: ct.Epoch, Timestamp: ct.Timestamp + n}
+	}
+	return ClockTime{Epoch: ct.Epoch + 1, Timestamp: n - (rollover - ct.Timestamp)}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClockTimeCompare(t *testing.T) {
+	cases := []struct {
+		a, b     ClockTime
+		expected int
+	}{
+		{ClockTime{0, 1}, ClockTime{0, 2}, -1},
+		{ClockTime{0, 2}, ClockTime{0, 1}, 1},
+		{ClockTime{0, 5}, ClockTime{0, 5}, 0},
+		{ClockTime{0, math.MaxInt64}, ClockTime{1, 1}, -1},
+		{ClockTime{2, 1}, ClockTime{1, 1000}, 1},
+	}
+
+	for _, c := range cases {
+		if got := c.a.Compare(c.b); got != c.expected {
+			t.Errorf("%s.Compare(%s): expected %d, got %d", c.a, c.b, c.expected, got)
+		}
+	}
+}
+
+func TestTickRollsOverAtThreshold(t *testing.T) {
+	clock := NewLamportClock()
+	clock.rollover = 3
+
+	expected := []ClockTime{{0, 1}, {0, 2}, {0, 3}, {1, 1}, {1, 2}}
+	for i, want := range expected {
+		if got := clock.TickTime(); got != want {
+			t.Errorf("Tick %d: expected %s, got %s", i+1, want, got)
+		}
+	}
+}
+
+func TestDefaultRolloverNearMaxInt64(t *testing.T) {
+	clock := NewLamportClock()
+	clock.Update(defaultRollover - 2)
+
+	if got := clock.TickTime(); got != (ClockTime{Epoch: 0, Timestamp: defaultRollover}) {
+		t.Errorf("Expected last timestamp of epoch 0 to be the threshold, got %s", got)
+	}
+	if got := clock.TickTime(); got != (ClockTime{Epoch: 1, Timestamp: 1}) {
+		t.Errorf("Expected clock to roll over to epoch 1, got %s", got)
+	}
+}
+
+func TestUpdateWithMaxInt64DoesNotOverflow(t *testing.T) {
+	clock := NewLamportClock()
+
+	ts := clock.Update(math.MaxInt64)
+	if ts <= 0 {
+		t.Fatalf("Update overflowed to %d", ts)
+	}
+	if now := clock.Now(); now != (ClockTime{Epoch: 1, Timestamp: 1}) {
+		t.Errorf("Expected clock at 1:1 after receiving MaxInt64, got %s", now)
+	}
+}
+
+func TestUpdateTimeAcrossEpochs(t *testing.T) {
+	clock := NewLamportClock()
+	clock.Update(500) // 0:501
+
+	// A message from a newer epoch wins even with a smaller timestamp
+	if got := clock.UpdateTime(ClockTime{Epoch: 1, Timestamp: 7}); got != (ClockTime{Epoch: 1, Timestamp: 8}) {
+		t.Errorf("Expected 1:8, got %s", got)
+	}
+
+	// A message from an older epoch only ticks the clock
+	if got := clock.UpdateTime(ClockTime{Epoch: 0, Timestamp: 9000}); got != (ClockTime{Epoch: 1, Timestamp: 9}) {
+		t.Errorf("Expected 1:9, got %s", got)
+	}
+}
+
+func TestReceiveMessageHandlerEpoch(t *testing.T) {
+	server := NewServer()
+
+	req := httptest.NewRequest("POST", "/message?timestamp=4&epoch=2&message=rolled", nil)
+	w := httptest.NewRecorder()
+	server.handleReceiveMessage(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d", w.Code)
+	}
+	if now := server.clock.Now(); now != (ClockTime{Epoch: 2, Timestamp: 5}) {
+		t.Errorf("Expected clock at 2:5, got %s", now)
+	}
+	if server.events.Events()[0].Epoch != 2 {
+		t.Errorf("Expected event epoch 2, got %d", server.events.Events()[0].Epoch)
+	}
+
+	req2 := httptest.NewRequest("POST", "/message?timestamp=4&epoch=-1&message=bad", nil)
+	w2 := httptest.NewRecorder()
+	server.handleReceiveMessage(w2, req2)
+	if w2.Code != http.StatusBadRequest {
+		t.Errorf("Expected status BadRequest for negative epoch, got %d", w2.Code)
+	}
+}
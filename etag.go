@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Read endpoints tag their responses with the logical time they reflect.
+// The tags are weak: /time carries the wall time and /events may be
+// gzipped, so equal tags promise equivalent rather than identical bodies.
+
+// timeETag changes whenever the clock moves
+func timeETag(now ClockTime) string {
+	return fmt.Sprintf(`W/"t%d.%d"`, now.Epoch, now.Timestamp)
+}
+
+// eventsETag changes whenever the clock moves or the log changes, including
+// merges and imports that leave the clock where it was. The ordering is
+// part of the tag since it changes the body.
+func eventsETag(now ClockTime, count int, head, order string) string {
+	if len(head) > 16 {
+		head = head[:16]
+	}
+	if order == "" {
+		order = "log"
+	}
+	return fmt.Sprintf(`W/"e%d.%d.%d.%s.%s"`, now.Epoch, now.Timestamp, count, head, order)
+}
+
+// notModified sets the ETag of a response and reports whether the request
+// already holds it, in which case 304 Not Modified has been written
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	if !etagMatches(r.Header.Get("If-None-Match"), etag) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches compares an If-None-Match list with a tag, weakly as RFC 9110
+// requires for If-None-Match
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func getWithETag(handler http.HandlerFunc, target, etag string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w
+}
+
+func TestEventsETag(t *testing.T) {
+	server := NewServer()
+	server.logEvent("e1", "First")
+
+	first := getWithETag(server.handleGetEvents, "/events", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Expected a tagged response, got %d with %q", first.Code, etag)
+	}
+	if w := getWithETag(server.handleGetEvents, "/events", etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("Expected 304 without a body for an unchanged log, got %d", w.Code)
+	}
+	if w := getWithETag(server.handleGetEvents, "/events?order=total", etag); w.Code != http.StatusOK {
+		t.Errorf("Expected another ordering to have its own tag, got %d", w.Code)
+	}
+
+	// Merged events change the tag even when they leave the clock alone
+	server.appendEvent(Event{ID: "old", Node: "b", Timestamp: 1})
+	if w := getWithETag(server.handleGetEvents, "/events", etag); w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("Expected a new tag after a merge, got %d with %q", w.Code, w.Header().Get("ETag"))
+	}
+}
+
+func TestTimeETag(t *testing.T) {
+	server := NewServer()
+	etag := getWithETag(server.handleGetTime, "/time", "").Header().Get("ETag")
+
+	if w := getWithETag(server.handleGetTime, "/time", `"other", `+etag); w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for a listed tag, got %d", w.Code)
+	}
+	server.clock.Tick()
+	if w := getWithETag(server.handleGetTime, "/time", etag); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 once the clock moved, got %d", w.Code)
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	cases := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"*", true},
+		{`W/"t0.1"`, true},
+		{`"t0.1"`, true},
+		{`"a", W/"t0.1"`, true},
+		{`W/"t0.2"`, false},
+	}
+	for _, c := range cases {
+		if got := etagMatches(c.header, `W/"t0.1"`); got != c.want {
+			t.Errorf("%q: expected %v, got %v", c.header, c.want, got)
+		}
+	}
+}
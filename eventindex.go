@@ -0,0 +1,187 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// trigram is three consecutive bytes of a message
+type trigram [3]byte
+
+// logIndex holds the secondary indexes of a log, or of one shard of it:
+// the time, the ID and the trigrams of the message of every event, each
+// pointing to positions in the log. Positions are added in increasing
+// order, so every list of them is sorted. Callers synchronize, the stores
+// under the lock of the events indexed.
+type logIndex struct {
+	times timeIndex
+	ids   map[string][]int64
+	grams map[trigram][]int64
+}
+
+func (ix *logIndex) add(seq int64, e Event) {
+	if ix.ids == nil {
+		ix.ids = make(map[string][]int64)
+		ix.grams = make(map[trigram][]int64)
+	}
+	ix.times.add(timeEntry{e.clockTime(), seq})
+	ix.ids[e.ID] = append(ix.ids[e.ID], seq)
+	for i := 0; i+3 <= len(e.Message); i++ {
+		g := trigram{e.Message[i], e.Message[i+1], e.Message[i+2]}
+		if list := ix.grams[g]; len(list) == 0 || list[len(list)-1] != seq {
+			ix.grams[g] = append(list, seq)
+		}
+	}
+}
+
+// remove drops the event at position seq from the indexes, as rings do
+// when they overwrite it
+func (ix *logIndex) remove(seq int64, e Event) {
+	ix.times.remove(e.clockTime(), seq)
+	if list := removeSeq(ix.ids[e.ID], seq); len(list) > 0 {
+		ix.ids[e.ID] = list
+	} else {
+		delete(ix.ids, e.ID)
+	}
+	for i := 0; i+3 <= len(e.Message); i++ {
+		g := trigram{e.Message[i], e.Message[i+1], e.Message[i+2]}
+		if list := removeSeq(ix.grams[g], seq); len(list) > 0 {
+			ix.grams[g] = list
+		} else {
+			delete(ix.grams, g)
+		}
+	}
+}
+
+func (ix *logIndex) reset() {
+	ix.times.reset()
+	ix.ids, ix.grams = nil, nil
+}
+
+// first returns the position of the first event with the ID
+func (ix *logIndex) first(id string) (int64, bool) {
+	if list := ix.ids[id]; len(list) > 0 {
+		return list[0], true
+	}
+	return 0, false
+}
+
+// search returns the positions of the events whose messages hold every
+// trigram of text, in order. They are candidates the caller still checks
+// for the whole text. indexed is false for texts shorter than a trigram,
+// which have to be looked for in every message.
+func (ix *logIndex) search(text string) (candidates []int64, indexed bool) {
+	if len(text) < 3 {
+		return nil, false
+	}
+	var lists [][]int64
+	for i := 0; i+3 <= len(text); i++ {
+		list := ix.grams[trigram{text[i], text[i+1], text[i+2]}]
+		if len(list) == 0 {
+			return nil, true
+		}
+		lists = append(lists, list)
+	}
+	// Starting from the rarest trigram keeps the intersections small
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+	candidates = slices.Clone(lists[0])
+	for _, list := range lists[1:] {
+		candidates = intersectSeqs(candidates, list)
+		if len(candidates) == 0 {
+			break
+		}
+	}
+	return candidates, true
+}
+
+// removeSeq removes seq from a sorted list of positions
+func removeSeq(list []int64, seq int64) []int64 {
+	i := sort.Search(len(list), func(i int) bool { return list[i] >= seq })
+	if i == len(list) || list[i] != seq {
+		return list
+	}
+	if i == 0 {
+		return list[1:]
+	}
+	return slices.Delete(list, i, i+1)
+}
+
+// intersectSeqs keeps the positions of a that are also in b, both sorted,
+// reusing a
+func intersectSeqs(a, b []int64) []int64 {
+	out := a[:0]
+	j := 0
+	for _, seq := range a {
+		for j < len(b) && b[j] < seq {
+			j++
+		}
+		if j == len(b) {
+			break
+		}
+		if b[j] == seq {
+			out = append(out, seq)
+		}
+	}
+	return out
+}
+
+// handleEvent serves GET and PATCH /events/<id>, and the inclusion proofs
+// and annotations below it
+func (s *Server) handleEvent(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/proof"):
+		s.handleEventProof(w, r)
+		return
+	case strings.HasSuffix(r.URL.Path, "/annotations"):
+		s.handleEventAnnotations(w, r)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/events/")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPatch:
+		s.handlePatchEvent(w, r, id)
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	event, ok := s.events.Find(id)
+	if !ok {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("ETag", annotationETag(s.annotations.Get(event).Version))
+	writeEvent(w, r, event)
+}
+
+// handleSearchEvents lists the events whose message contains a text,
+// GET /events/search?contains=<text>[&limit=<n>], in log order
+func (s *Server) handleSearchEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	text := r.URL.Query().Get("contains")
+	if text == "" {
+		http.Error(w, "Missing contains parameter", http.StatusBadRequest)
+		return
+	}
+	events := s.events.Search(text)
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+		events = events[:min(limit, len(events))]
+	}
+	writeEventList(w, r, events, s.clock.Now(), s.events.Dropped())
+}
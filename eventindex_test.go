@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestStoresFindAndSearch(t *testing.T) {
+	stores := map[string]EventStore{"sharded": NewShardedStore(4), "ring": NewRingStore(100), "compressed": NewCompressedStore(3)}
+	for name, st := range stores {
+		st.Append(Event{ID: "a", Message: "payment received"})
+		st.Append(Event{ID: "b", Message: "order shipped"})
+		st.Append(Event{ID: "c", Message: "payment refunded"})
+		st.Append(Event{ID: "a", Message: "duplicate"})
+
+		if e, ok := st.Find("a"); !ok || e.Message != "payment received" {
+			t.Errorf("%s: expected the first a, got %+v %v", name, e, ok)
+		}
+		if _, ok := st.Find("x"); ok {
+			t.Errorf("%s: expected x not to be found", name)
+		}
+		if got := fmt.Sprint(eventIDs(st.Search("payment"))); got != "[a c]" {
+			t.Errorf("%s: expected a and c for payment, got %s", name, got)
+		}
+		// Every trigram is in some message, but not the whole text
+		if got := st.Search("paymentshipped"); len(got) != 0 {
+			t.Errorf("%s: expected no match, got %v", name, eventIDs(got))
+		}
+		if got := fmt.Sprint(eventIDs(st.Search("re"))); got != "[a c]" {
+			t.Errorf("%s: expected short texts to be scanned for, got %s", name, got)
+		}
+
+		st.Replace([]Event{{ID: "z", Message: "payment failed"}})
+		if _, ok := st.Find("a"); ok {
+			t.Errorf("%s: expected the index to follow a replace", name)
+		}
+		if got := fmt.Sprint(eventIDs(st.Search("payment"))); got != "[z]" {
+			t.Errorf("%s: expected only z after a replace, got %s", name, got)
+		}
+	}
+}
+
+func TestRingStoreIndexDropsOverwritten(t *testing.T) {
+	st := NewRingStore(2)
+	st.Append(Event{ID: "e1", Message: "first"})
+	st.Append(Event{ID: "e2", Message: "second"})
+	st.Append(Event{ID: "e3", Message: "third"})
+
+	if _, ok := st.Find("e1"); ok {
+		t.Error("Expected the overwritten e1 not to be found")
+	}
+	if got := st.Search("first"); len(got) != 0 {
+		t.Errorf("Expected no match in overwritten events, got %v", eventIDs(got))
+	}
+	if len(st.index.ids) != 2 {
+		t.Errorf("Expected 2 indexed IDs, got %d", len(st.index.ids))
+	}
+	if _, ok := st.index.grams[trigram{'f', 'i', 'r'}]; ok {
+		t.Error("Expected the trigrams of e1 to be dropped")
+	}
+}
+
+func TestStoresIndexConcurrentAppends(t *testing.T) {
+	stores := map[string]EventStore{"sharded": NewShardedStore(4), "ring": NewRingStore(50), "compressed": NewCompressedStore(16)}
+	for name, st := range stores {
+		var wg sync.WaitGroup
+		for w := 0; w < 4; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					st.Append(Event{ID: fmt.Sprintf("w%d-%d", w, i), Message: fmt.Sprintf("worker %d", w)})
+					st.Find(fmt.Sprintf("w%d-%d", w, i/2))
+					st.Search("worker")
+				}
+			}()
+		}
+		wg.Wait()
+		for _, e := range st.Search("worker") {
+			if found, ok := st.Find(e.ID); !ok || found.Message != e.Message {
+				t.Errorf("%s: expected %s to be found as %+v, got %+v", name, e.ID, e, found)
+			}
+		}
+	}
+}
+
+func TestHandleEventAndSearch(t *testing.T) {
+	server := NewServer()
+	server.logEvent("e1", "First event")
+	server.logEvent("e2", "Second event")
+
+	get := func(handler http.HandlerFunc, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	var event Event
+	json.NewDecoder(get(server.handleEvent, "/events/e2").Body).Decode(&event)
+	if event.ID != "e2" || event.Message != "Second event" {
+		t.Errorf("Expected e2, got %+v", event)
+	}
+	var body struct {
+		EventCount int     `json:"event_count"`
+		Events     []Event `json:"events"`
+	}
+	json.NewDecoder(get(server.handleSearchEvents, "/events/search?contains=event").Body).Decode(&body)
+	if got := fmt.Sprint(eventIDs(body.Events)); got != "[e1 e2]" {
+		t.Errorf("Expected e1 and e2, got %s", got)
+	}
+	json.NewDecoder(get(server.handleSearchEvents, "/events/search?contains=event&limit=1").Body).Decode(&body)
+	if body.EventCount != 1 || body.Events[0].ID != "e1" {
+		t.Errorf("Expected only e1 with a limit, got %+v", body)
+	}
+
+	for _, c := range []struct {
+		handler http.HandlerFunc
+		target  string
+		want    int
+	}{
+		{server.handleEvent, "/events/missing", http.StatusNotFound},
+		{server.handleEvent, "/events/e1/other", http.StatusNotFound},
+		{server.handleEvent, "/events/e1/proof", http.StatusOK},
+		{server.handleSearchEvents, "/events/search", http.StatusBadRequest},
+		{server.handleSearchEvents, "/events/search?contains=x&limit=0", http.StatusBadRequest},
+	} {
+		if w := get(c.handler, c.target); w.Code != c.want {
+			t.Errorf("%s: expected %d, got %d", c.target, c.want, w.Code)
+		}
+	}
+}
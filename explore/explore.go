@@ -0,0 +1,168 @@
+// Package explore runs small distributed systems under a deterministic
+// scheduler instead of goroutines and a network, and checks their safety
+// properties in every interleaving it reaches.
+//
+// A Model lists the steps that may happen next, such as a node acting or
+// a message arriving, and the Explorer picks one at a time, so the names
+// of the picked steps replay a run exactly. Exhaustive explores every
+// interleaving up to a depth, shortest runs first; Random takes random
+// walks through configurations too large for that. A violation is
+// reported as a Counterexample: the shortest one when exploring
+// exhaustively, and one shrunk until no step can be left out after a
+// random walk.
+package explore
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+)
+
+// Model is a small distributed system run step by step
+type Model interface {
+	// Steps names the enabled steps; names are unique among them
+	Steps() []string
+	// Take runs the i-th enabled step
+	Take(i int)
+	// Check reports a violated safety property
+	Check() error
+	// State identifies the state for pruning runs that reach it again
+	State() string
+}
+
+// Counterexample is a run ending in a violated property
+type Counterexample struct {
+	Trace []string
+	Err   error
+}
+
+func (c *Counterexample) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v after %d steps:", c.Err, len(c.Trace))
+	for i, step := range c.Trace {
+		fmt.Fprintf(&b, "\n  %d. %s", i+1, step)
+	}
+	return b.String()
+}
+
+// Explorer runs a model through its interleavings. Model returns a fresh
+// model in its initial state; runs are replayed from it rather than
+// copied, so models need no way to clone themselves.
+type Explorer struct {
+	Model func() Model
+	Depth int // the most steps of a run
+}
+
+// Replay runs the model through the steps named by trace, skipping the
+// ones that are not enabled. It returns the steps taken up to the first
+// violation, if any.
+func (e *Explorer) Replay(trace []string) ([]string, error) {
+	m := e.Model()
+	var taken []string
+	for _, name := range trace {
+		i := slices.Index(m.Steps(), name)
+		if i < 0 {
+			continue
+		}
+		m.Take(i)
+		taken = append(taken, name)
+		if err := m.Check(); err != nil {
+			return taken, err
+		}
+	}
+	return taken, nil
+}
+
+// Exhaustive explores every interleaving up to the depth and returns how
+// many states it visited and a shortest counterexample, if any. Deeper
+// runs are only explored once every shorter one passed, so violations
+// close to the start are found fast.
+func (e *Explorer) Exhaustive() (int, *Counterexample) {
+	var states int
+	for limit := 1; limit <= e.Depth; limit++ {
+		var found *Counterexample
+		var truncated bool
+		states, found, truncated = e.bounded(limit)
+		if found != nil || !truncated {
+			return states, found
+		}
+	}
+	return states, nil
+}
+
+// bounded explores every interleaving of up to limit steps. It reports
+// whether runs were cut at the limit with steps left to take. States
+// reached again no deeper than before are not explored twice.
+func (e *Explorer) bounded(limit int) (states int, found *Counterexample, truncated bool) {
+	visited := make(map[string]int)
+	var visit func(trace []string)
+	visit = func(trace []string) {
+		m := e.Model()
+		for _, name := range trace {
+			m.Take(slices.Index(m.Steps(), name))
+		}
+		if len(trace) > 0 {
+			if err := m.Check(); err != nil {
+				found = &Counterexample{Trace: slices.Clone(trace), Err: err}
+				return
+			}
+		}
+		state := m.State()
+		if depth, ok := visited[state]; ok && depth <= len(trace) {
+			return
+		}
+		visited[state] = len(trace)
+
+		steps := m.Steps()
+		if len(trace) == limit {
+			truncated = truncated || len(steps) > 0
+			return
+		}
+		for _, step := range steps {
+			if visit(append(trace, step)); found != nil {
+				return
+			}
+		}
+	}
+	visit(nil)
+	return len(visited), found, truncated
+}
+
+// Random takes runs random walks of up to depth steps and returns the
+// first counterexample, shrunk so that no single step can be left out.
+// The same seed takes the same walks.
+func (e *Explorer) Random(seed uint64, runs int) *Counterexample {
+	rng := rand.New(rand.NewPCG(seed, 0))
+	for range runs {
+		m := e.Model()
+		var trace []string
+		for len(trace) < e.Depth {
+			steps := m.Steps()
+			if len(steps) == 0 {
+				break
+			}
+			i := rng.IntN(len(steps))
+			trace = append(trace, steps[i])
+			m.Take(i)
+			if err := m.Check(); err != nil {
+				return e.Shrink(&Counterexample{Trace: trace, Err: err})
+			}
+		}
+	}
+	return nil
+}
+
+// Shrink leaves steps out of a counterexample for as long as the rest
+// still ends in a violation
+func (e *Explorer) Shrink(c *Counterexample) *Counterexample {
+	for i := 0; i < len(c.Trace); {
+		candidate := slices.Delete(slices.Clone(c.Trace), i, i+1)
+		if taken, err := e.Replay(candidate); err != nil {
+			c = &Counterexample{Trace: taken, Err: err}
+			continue
+		}
+		i++
+	}
+	return c
+}
@@ -0,0 +1,132 @@
+package explore
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// counterModel has processes increment a shared counter once each. Unless
+// atomic is set, an increment reads the counter in one step and writes
+// it in the next, so concurrent increments can be lost.
+type counterModel struct {
+	counter int
+	writes  int
+	read    []int // the value each process read, -1 before it reads
+	done    []bool
+	atomic  bool
+}
+
+func newCounterModel(processes int, atomic bool) *counterModel {
+	m := &counterModel{read: make([]int, processes), done: make([]bool, processes), atomic: atomic}
+	for i := range m.read {
+		m.read[i] = -1
+	}
+	return m
+}
+
+func (m *counterModel) Steps() []string {
+	var steps []string
+	for i := range m.read {
+		name := string(rune('a' + i))
+		switch {
+		case m.done[i]:
+		case m.atomic:
+			steps = append(steps, name+" increments")
+		case m.read[i] < 0:
+			steps = append(steps, name+" reads")
+		default:
+			steps = append(steps, name+" writes")
+		}
+	}
+	return steps
+}
+
+func (m *counterModel) Take(i int) {
+	name, action, _ := strings.Cut(m.Steps()[i], " ")
+	p := int(name[0] - 'a')
+	switch action {
+	case "increments":
+		m.counter++
+		m.writes++
+		m.done[p] = true
+	case "reads":
+		m.read[p] = m.counter
+	case "writes":
+		m.counter = m.read[p] + 1
+		m.writes++
+		m.done[p] = true
+	}
+}
+
+func (m *counterModel) Check() error {
+	if m.counter != m.writes {
+		return fmt.Errorf("counter is %d after %d increments", m.counter, m.writes)
+	}
+	return nil
+}
+
+func (m *counterModel) State() string {
+	return fmt.Sprint(m.counter, m.writes, m.read, m.done)
+}
+
+func TestExhaustive(t *testing.T) {
+	e := &Explorer{Model: func() Model { return newCounterModel(3, true) }, Depth: 10}
+	states, found := e.Exhaustive()
+	if found != nil {
+		t.Fatalf("Expected atomic increments to be safe: %s", found)
+	}
+	// Every subset of the three processes is done or not
+	if states != 8 {
+		t.Errorf("Expected 8 states, got %d", states)
+	}
+}
+
+func TestExhaustiveShortestCounterexample(t *testing.T) {
+	e := &Explorer{Model: func() Model { return newCounterModel(3, false) }, Depth: 10}
+	_, found := e.Exhaustive()
+	if found == nil {
+		t.Fatal("Expected split increments to lose one")
+	}
+	want := []string{"a reads", "b reads", "a writes", "b writes"}
+	if !slices.Equal(found.Trace, want) {
+		t.Errorf("Expected the shortest counterexample %v, got:\n%s", want, found)
+	}
+	if !strings.HasPrefix(found.String(), "counter is 1 after 2 increments after 4 steps:\n  1. a reads") {
+		t.Errorf("Unexpected report:\n%s", found)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	e := &Explorer{Model: func() Model { return newCounterModel(2, false) }, Depth: 10}
+
+	// Steps that are not enabled are skipped, and the run stops at the
+	// violation
+	taken, err := e.Replay([]string{"a writes", "a reads", "b reads", "a writes", "b writes", "c reads"})
+	if err == nil || !slices.Equal(taken, []string{"a reads", "b reads", "a writes", "b writes"}) {
+		t.Errorf("Expected the replay to end in the violation, got %v (err: %v)", taken, err)
+	}
+	if _, err := e.Replay([]string{"a reads", "a writes", "b reads", "b writes"}); err != nil {
+		t.Errorf("Expected increments one after the other to be safe, got %v", err)
+	}
+}
+
+func TestRandomShrinks(t *testing.T) {
+	e := &Explorer{Model: func() Model { return newCounterModel(4, false) }, Depth: 10}
+	found := e.Random(1, 100)
+	if found == nil {
+		t.Fatal("Expected random runs to find the violation")
+	}
+	if len(found.Trace) != 4 {
+		t.Errorf("Expected a shrunk counterexample of 4 steps, got:\n%s", found)
+	}
+	if again := e.Random(1, 100); !slices.Equal(again.Trace, found.Trace) {
+		t.Errorf("Expected the same seed to find the same counterexample, got %v and %v", found.Trace, again.Trace)
+	}
+
+	e.Model = func() Model { return newCounterModel(4, true) }
+	if found := e.Random(1, 100); found != nil {
+		t.Errorf("Expected atomic increments to be safe: %s", found)
+	}
+}
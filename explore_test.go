@@ -0,0 +1,445 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/explore"
+)
+
+// simNames are the node IDs of simulated clusters
+var simNames = []string{"a", "b", "c", "d"}
+
+// simChannel is a directed link between two nodes of a model
+type simChannel struct{ from, to int }
+
+func (c simChannel) String() string {
+	return simNames[c.from] + "→" + simNames[c.to]
+}
+
+// multicastModel runs the total order multicast of nodes that publish a
+// number of messages each. Envelopes travel on FIFO channels, as the
+// protocol requires, unless fifo is off.
+type multicastModel struct {
+	groups    []*Multicast
+	links     map[simChannel][]MulticastEnvelope
+	left      []int
+	delivered [][]string
+	total     int
+	fifo      bool
+}
+
+func newMulticastModel(nodes, publishes int, fifo bool) *multicastModel {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	m := &multicastModel{links: make(map[simChannel][]MulticastEnvelope), total: nodes * publishes, fifo: fifo}
+	for i := range nodes {
+		// Multicast needs no more of the server than its clock, peers,
+		// metrics and logger, and a bare one keeps replays cheap
+		server := &Server{clock: NewLamportClock(), metrics: NewMetrics(), logger: logger, nodeID: simNames[i], ties: NodeTieBreaker}
+		var peers []string
+		for j := range nodes {
+			if j != i {
+				peers = append(peers, "http://"+simNames[j])
+			}
+		}
+		server.peers = NewPeers(peers, http.DefaultClient)
+		g := NewMulticast(server)
+		g.onDeliver = func(msg MulticastMessage) {
+			m.delivered[i] = append(m.delivered[i], msg.Message)
+		}
+		m.groups = append(m.groups, g)
+		m.left = append(m.left, publishes)
+	}
+	m.delivered = make([][]string, nodes)
+	return m
+}
+
+// channels lists the channels with envelopes in flight, in a fixed order
+func (m *multicastModel) channels() []simChannel {
+	var out []simChannel
+	for from := range m.groups {
+		for to := range m.groups {
+			if len(m.links[simChannel{from, to}]) > 0 {
+				out = append(out, simChannel{from, to})
+			}
+		}
+	}
+	return out
+}
+
+// simArrival is the i-th envelope in flight on a channel
+type simArrival struct {
+	link simChannel
+	i    int
+}
+
+// arrivals lists the envelopes that may arrive next: the first of every
+// channel, or any of them without FIFO
+func (m *multicastModel) arrivals() []simArrival {
+	var out []simArrival
+	for _, c := range m.channels() {
+		n := 1
+		if !m.fifo {
+			n = len(m.links[c])
+		}
+		for i := range n {
+			out = append(out, simArrival{c, i})
+		}
+	}
+	return out
+}
+
+func (m *multicastModel) Steps() []string {
+	var steps []string
+	for i, left := range m.left {
+		if left > 0 {
+			steps = append(steps, simNames[i]+" publishes")
+		}
+	}
+	for _, a := range m.arrivals() {
+		env := m.links[a.link][a.i]
+		steps = append(steps, fmt.Sprintf("%s %s@%d", a.link, env.Kind, env.Timestamp))
+	}
+	return steps
+}
+
+func (m *multicastModel) Take(i int) {
+	ctx := context.Background()
+	for node, left := range m.left {
+		if left == 0 {
+			continue
+		}
+		if i == 0 {
+			m.left[node]--
+			g := m.groups[node]
+			g.Publish(ctx, fmt.Sprintf("%s%d", g.server.nodeID, m.left[node]), "")
+			m.send(node)
+			return
+		}
+		i--
+	}
+	a := m.arrivals()[i]
+	env := m.links[a.link][a.i]
+	m.links[a.link] = slices.Delete(m.links[a.link], a.i, a.i+1)
+	m.groups[a.link.to].Receive(ctx, env)
+	m.send(a.link.to)
+}
+
+// send moves the envelopes a node queued onto its channels to every peer
+func (m *multicastModel) send(node int) {
+	for {
+		select {
+		case env := <-m.groups[node].outbox:
+			for to := range m.groups {
+				if to != node {
+					c := simChannel{node, to}
+					m.links[c] = append(m.links[c], env)
+				}
+			}
+		default:
+			return
+		}
+	}
+}
+
+// Check verifies that nodes deliver every message once and in the same
+// order, and that nothing is left undelivered once all envelopes arrived
+func (m *multicastModel) Check() error {
+	for i, order := range m.delivered {
+		if len(order) != len(slices.Compact(slices.Sorted(slices.Values(order)))) {
+			return fmt.Errorf("node %s delivered a message twice: %v", simNames[i], order)
+		}
+		for j := range i {
+			other := m.delivered[j]
+			n := min(len(order), len(other))
+			if !slices.Equal(order[:n], other[:n]) {
+				return fmt.Errorf("nodes %s and %s delivered in different orders: %v and %v", simNames[j], simNames[i], other, order)
+			}
+		}
+	}
+	if len(m.Steps()) == 0 {
+		for i, order := range m.delivered {
+			if len(order) != m.total {
+				return fmt.Errorf("node %s delivered %d of %d messages", simNames[i], len(order), m.total)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *multicastModel) State() string {
+	var b strings.Builder
+	for i, g := range m.groups {
+		fmt.Fprintf(&b, "%d %s %v %v %v|", m.left[i], g.server.clock.Now(), g.queue.matrix.Snapshot(), m.delivered[i], len(g.queue.Pending()))
+	}
+	for _, c := range m.channels() {
+		fmt.Fprintf(&b, "%s", c)
+		for _, env := range m.links[c] {
+			fmt.Fprintf(&b, " %s@%d", env.Kind, env.Timestamp)
+		}
+		b.WriteString("|")
+	}
+	return b.String()
+}
+
+// Mutual exclusion message kinds
+const (
+	mutexRequest = "request"
+	mutexReply   = "reply"
+	mutexRelease = "release"
+)
+
+type mutexMessage struct {
+	kind string
+	time ClockTime
+}
+
+// mutexNode is a node of Lamport's mutual exclusion algorithm
+type mutexNode struct {
+	clock    *LamportClock
+	requests map[int]ClockTime // requests of every node, by node
+	heard    []ClockTime       // latest time received from every node
+	request  ClockTime         // this node's request, zero when idle
+	critical bool
+	rounds   int // times the node still wants the critical section
+}
+
+// mutexModel runs Lamport's mutual exclusion: a node enters the critical
+// section once its request is the earliest it knows of and every other
+// node has sent it something later. Unless waitReplies is set, nodes skip
+// the second condition, which is not safe.
+type mutexModel struct {
+	nodes       []*mutexNode
+	links       map[simChannel][]mutexMessage
+	waitReplies bool
+}
+
+func newMutexModel(nodes, rounds int, waitReplies bool) *mutexModel {
+	m := &mutexModel{links: make(map[simChannel][]mutexMessage), waitReplies: waitReplies}
+	for range nodes {
+		m.nodes = append(m.nodes, &mutexNode{
+			clock:    NewLamportClock(),
+			requests: make(map[int]ClockTime),
+			heard:    make([]ClockTime, nodes),
+			rounds:   rounds,
+		})
+	}
+	return m
+}
+
+// earlier orders requests by time, then by node
+func earlier(a ClockTime, i int, b ClockTime, j int) bool {
+	if c := a.Compare(b); c != 0 {
+		return c < 0
+	}
+	return i < j
+}
+
+// mayEnter reports whether node i may enter the critical section
+func (m *mutexModel) mayEnter(i int) bool {
+	n := m.nodes[i]
+	if n.request == (ClockTime{}) || n.critical {
+		return false
+	}
+	for j, t := range n.requests {
+		if j != i && earlier(t, j, n.request, i) {
+			return false
+		}
+	}
+	if !m.waitReplies {
+		return true
+	}
+	for j, t := range n.heard {
+		if j != i && !n.request.Before(t) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *mutexModel) broadcast(from int, msg mutexMessage) {
+	for to := range m.nodes {
+		if to != from {
+			c := simChannel{from, to}
+			m.links[c] = append(m.links[c], msg)
+		}
+	}
+}
+
+func (m *mutexModel) channels() []simChannel {
+	var out []simChannel
+	for from := range m.nodes {
+		for to := range m.nodes {
+			if len(m.links[simChannel{from, to}]) > 0 {
+				out = append(out, simChannel{from, to})
+			}
+		}
+	}
+	return out
+}
+
+// actions lists what the nodes may do next
+func (m *mutexModel) actions() []string {
+	var actions []string
+	for i, n := range m.nodes {
+		name := simNames[i]
+		switch {
+		case n.critical:
+			actions = append(actions, name+" exits")
+		case n.request == (ClockTime{}) && n.rounds > 0:
+			actions = append(actions, name+" requests")
+		case m.mayEnter(i):
+			actions = append(actions, name+" enters")
+		}
+	}
+	return actions
+}
+
+func (m *mutexModel) Steps() []string {
+	steps := m.actions()
+	for _, c := range m.channels() {
+		msg := m.links[c][0]
+		steps = append(steps, fmt.Sprintf("%s %s@%s", c, msg.kind, msg.time))
+	}
+	return steps
+}
+
+func (m *mutexModel) Take(i int) {
+	actions := m.actions()
+	if i < len(actions) {
+		name, action, _ := strings.Cut(actions[i], " ")
+		node := slices.Index(simNames, name)
+		n := m.nodes[node]
+		switch action {
+		case "requests":
+			n.rounds--
+			n.request = n.clock.TickTime()
+			n.requests[node] = n.request
+			m.broadcast(node, mutexMessage{kind: mutexRequest, time: n.request})
+		case "enters":
+			n.critical = true
+		case "exits":
+			n.critical = false
+			n.request = ClockTime{}
+			delete(n.requests, node)
+			m.broadcast(node, mutexMessage{kind: mutexRelease, time: n.clock.TickTime()})
+		}
+		return
+	}
+
+	c := m.channels()[i-len(actions)]
+	msg := m.links[c][0]
+	m.links[c] = m.links[c][1:]
+	n := m.nodes[c.to]
+	now := n.clock.UpdateTime(msg.time)
+	n.heard[c.from] = msg.time
+	switch msg.kind {
+	case mutexRequest:
+		n.requests[c.from] = msg.time
+		back := simChannel{c.to, c.from}
+		m.links[back] = append(m.links[back], mutexMessage{kind: mutexReply, time: now})
+	case mutexRelease:
+		delete(n.requests, c.from)
+	}
+}
+
+// Check verifies that at most one node is in the critical section
+func (m *mutexModel) Check() error {
+	var inside []string
+	for i, n := range m.nodes {
+		if n.critical {
+			inside = append(inside, simNames[i])
+		}
+	}
+	if len(inside) > 1 {
+		return fmt.Errorf("nodes %s are in the critical section together", strings.Join(inside, " and "))
+	}
+	return nil
+}
+
+func (m *mutexModel) State() string {
+	var b strings.Builder
+	for _, n := range m.nodes {
+		fmt.Fprintf(&b, "%s %v %v %s %v %d|", n.clock.Now(), n.requests, n.heard, n.request, n.critical, n.rounds)
+	}
+	for _, c := range m.channels() {
+		fmt.Fprintf(&b, "%s %v|", c, m.links[c])
+	}
+	return b.String()
+}
+
+func TestExploreMulticastTotalOrder(t *testing.T) {
+	for _, config := range []struct{ nodes, publishes int }{{2, 1}, {2, 2}} {
+		e := &explore.Explorer{Model: func() explore.Model { return newMulticastModel(config.nodes, config.publishes, true) }, Depth: 64}
+		states, found := e.Exhaustive()
+		if found != nil {
+			t.Fatalf("%d nodes publishing %d: %s", config.nodes, config.publishes, found)
+		}
+		t.Logf("%d nodes publishing %d: %d states", config.nodes, config.publishes, states)
+	}
+
+	// Larger clusters have too many interleavings to explore them all
+	e := &explore.Explorer{Model: func() explore.Model { return newMulticastModel(3, 2, true) }, Depth: 64}
+	if found := e.Random(1, 200); found != nil {
+		t.Fatal(found)
+	}
+}
+
+func TestExploreMulticastNeedsFIFO(t *testing.T) {
+	e := &explore.Explorer{Model: func() explore.Model { return newMulticastModel(3, 1, false) }, Depth: 64}
+	_, found := e.Exhaustive()
+	if found == nil {
+		t.Fatal("Expected reordered channels to break the total order")
+	}
+	// The counterexample replays, and no step of it can be left out
+	if _, err := e.Replay(found.Trace); err == nil {
+		t.Errorf("Expected the counterexample to replay:\n%s", found)
+	}
+	if shrunk := e.Shrink(found); len(shrunk.Trace) != len(found.Trace) {
+		t.Errorf("Expected a minimal counterexample, shrunk from %d to %d steps:\n%s", len(found.Trace), len(shrunk.Trace), shrunk)
+	}
+	t.Log(found)
+}
+
+func TestExploreMutualExclusion(t *testing.T) {
+	for _, config := range []struct{ nodes, rounds int }{{2, 1}, {2, 2}} {
+		e := &explore.Explorer{Model: func() explore.Model { return newMutexModel(config.nodes, config.rounds, true) }, Depth: 64}
+		states, found := e.Exhaustive()
+		if found != nil {
+			t.Fatalf("%d nodes, %d rounds: %s", config.nodes, config.rounds, found)
+		}
+		t.Logf("%d nodes, %d rounds: %d states", config.nodes, config.rounds, states)
+	}
+
+	e := &explore.Explorer{Model: func() explore.Model { return newMutexModel(3, 2, true) }, Depth: 200}
+	if found := e.Random(1, 200); found != nil {
+		t.Fatal(found)
+	}
+}
+
+func TestExploreMutualExclusionCounterexample(t *testing.T) {
+	e := &explore.Explorer{Model: func() explore.Model { return newMutexModel(2, 1, false) }, Depth: 64}
+	_, found := e.Exhaustive()
+	if found == nil {
+		t.Fatal("Expected entering without replies to break mutual exclusion")
+	}
+	want := []string{"a requests", "a enters", "b requests", "b enters"}
+	if !slices.Equal(found.Trace, want) {
+		t.Errorf("Expected the shortest counterexample %v, got:\n%s", want, found)
+	}
+
+	// Random runs find longer ones, shrunk to a minimal form
+	e.Model = func() explore.Model { return newMutexModel(3, 2, false) }
+	if found = e.Random(7, 100); found == nil {
+		t.Fatal("Expected random runs to find the violation")
+	}
+	if len(found.Trace) != len(want) {
+		t.Errorf("Expected a shrunk counterexample of %d steps, got:\n%s", len(want), found)
+	}
+}
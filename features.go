@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Experimental subsystems gated by feature flags
+const (
+	FeatureRaft    = "raft"
+	FeatureUDPSync = "udp-sync"
+)
+
+// Feature describes an experimental subsystem. Features are off unless a
+// node enables them, so new capabilities can ship dark and be turned on
+// node by node.
+type Feature struct {
+	Name        string
+	Description string
+	Runtime     bool // can be toggled while the node runs
+}
+
+// knownFeatures lists every feature, in the order they are listed
+var knownFeatures = []Feature{
+	{Name: FeatureRaft, Description: "Raft consensus mode, implied by -raft-dir"},
+	{Name: FeatureUDPSync, Description: "Clock beacons exchanged with -udp-peers over -udp-addr, which implies it", Runtime: true},
+}
+
+var (
+	// ErrUnknownFeature is returned for a feature name that is not known
+	ErrUnknownFeature = errors.New("unknown feature")
+	// ErrFeatureAtStartup is returned when toggling a feature that is only
+	// read on startup
+	ErrFeatureAtStartup = errors.New("feature can only be changed at startup")
+)
+
+// lookupFeature finds a known feature by name
+func lookupFeature(name string) (Feature, error) {
+	for _, f := range knownFeatures {
+		if f.Name == name {
+			return f, nil
+		}
+	}
+	return Feature{}, fmt.Errorf("%w %q", ErrUnknownFeature, name)
+}
+
+// featureNames lists the known features for the usage of -features
+func featureNames() string {
+	names := make([]string, len(knownFeatures))
+	for i, f := range knownFeatures {
+		names[i] = f.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// Features holds the feature flags of a node. A nil Features has every
+// feature off.
+type Features struct {
+	enabled map[string]bool
+	metrics *Metrics
+	mutex   sync.RWMutex
+}
+
+// NewFeatures creates the feature flags of a node, all off
+func NewFeatures(metrics *Metrics) *Features {
+	f := &Features{enabled: make(map[string]bool), metrics: metrics}
+	metrics.family("lamport_feature_enabled", "gauge", "1 for each enabled feature")
+	for _, feature := range knownFeatures {
+		metrics.Set("lamport_feature_enabled", 0, "feature", feature.Name)
+	}
+	return f
+}
+
+// Enabled reports whether a feature is on
+func (f *Features) Enabled(name string) bool {
+	if f == nil {
+		return false
+	}
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return f.enabled[name]
+}
+
+// Set turns a feature on or off while the node runs. Features read only on
+// startup are refused with ErrFeatureAtStartup.
+func (f *Features) Set(name string, on bool) error {
+	feature, err := lookupFeature(name)
+	if err != nil {
+		return err
+	}
+	if !feature.Runtime && on != f.Enabled(name) {
+		return fmt.Errorf("%s: %w", name, ErrFeatureAtStartup)
+	}
+	f.set(name, on)
+	return nil
+}
+
+// enable turns features on at startup
+func (f *Features) enable(names []string) error {
+	for _, name := range names {
+		if _, err := lookupFeature(name); err != nil {
+			return err
+		}
+		f.set(name, true)
+	}
+	return nil
+}
+
+func (f *Features) set(name string, on bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.enabled[name] = on
+	value := 0.0
+	if on {
+		value = 1
+	}
+	f.metrics.Set("lamport_feature_enabled", value, "feature", name)
+}
+
+// handleFeatures lists the features and whether they are on, GET
+// /admin/features, or toggles one, POST /admin/features?name=<f>&enabled=
+// <bool>
+func (s *Server) handleFeatures(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		name := r.URL.Query().Get("name")
+		on, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+		if err != nil {
+			http.Error(w, "Invalid enabled parameter", http.StatusBadRequest)
+			return
+		}
+		err = s.features.Set(name, on)
+		switch {
+		case errors.Is(err, ErrUnknownFeature):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, ErrFeatureAtStartup):
+			http.Error(w, err.Error()+", with -features", http.StatusConflict)
+			return
+		}
+		s.logger.Warn("Feature toggled by admin", "feature", name, "enabled", on, "request_id", requestIDFrom(r.Context()))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	features := make([]map[string]interface{}, 0, len(knownFeatures))
+	for _, f := range knownFeatures {
+		features = append(features, map[string]interface{}{
+			"name":        f.Name,
+			"description": f.Description,
+			"runtime":     f.Runtime,
+			"enabled":     s.features.Enabled(f.Name),
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"features": features})
+}
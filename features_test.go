@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestFeatures(t *testing.T) {
+	server := NewServer()
+	server.features.enable([]string{FeatureRaft})
+
+	send := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	rec := send(http.MethodPost, "/admin/features?name=udp-sync&enabled=true")
+	if rec.Code != http.StatusOK || !server.features.Enabled(FeatureUDPSync) {
+		t.Fatalf("Expected udp-sync enabled, got %d %s", rec.Code, rec.Body)
+	}
+	if server.metrics.Value("lamport_feature_enabled", "feature", FeatureUDPSync) != 1 {
+		t.Error("Expected the feature gauge set")
+	}
+	var listed struct {
+		Features []struct {
+			Name    string `json:"name"`
+			Enabled bool   `json:"enabled"`
+		} `json:"features"`
+	}
+	json.Unmarshal(send(http.MethodGet, "/admin/features").Body.Bytes(), &listed)
+	if len(listed.Features) != len(knownFeatures) || !listed.Features[0].Enabled || !listed.Features[1].Enabled {
+		t.Errorf("Expected both features listed as on, got %+v", listed)
+	}
+
+	for path, want := range map[string]int{
+		"/admin/features?name=raft&enabled=false":  http.StatusConflict,
+		"/admin/features?name=hlc&enabled=true":    http.StatusNotFound,
+		"/admin/features?name=udp-sync&enabled=on": http.StatusBadRequest,
+	} {
+		if rec := send(http.MethodPost, path); rec.Code != want {
+			t.Errorf("%s: expected %d, got %d", path, want, rec.Code)
+		}
+	}
+}
+
+func TestFeaturesConfig(t *testing.T) {
+	// The flags of a subsystem imply its feature
+	cfg, err := parseConfig([]string{"-raft-dir", t.TempDir(), "-raft-addr", "127.0.0.1:0", "-udp-addr", "127.0.0.1:0"})
+	if err != nil || !slices.Contains(cfg.Features, FeatureRaft) || !slices.Contains(cfg.Features, FeatureUDPSync) {
+		t.Errorf("Expected raft and udp-sync implied, got %v %v", cfg, err)
+	}
+	cfg, err = parseConfig([]string{"-features", "udp-sync", "-udp-addr", "127.0.0.1:0"})
+	if err != nil || len(cfg.Features) != 1 {
+		t.Errorf("Expected udp-sync listed once, got %v %v", cfg, err)
+	}
+	if _, err := parseConfig([]string{"-features", "hlc"}); err == nil {
+		t.Error("Expected an unknown feature refused")
+	}
+}
+
+func TestFeatureUDPSyncOff(t *testing.T) {
+	server := NewServer()
+	u, err := ListenUDP("127.0.0.1:0", []string{"127.0.0.1:9"}, 0, server)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer u.conn.Close()
+	if !server.features.Enabled(FeatureUDPSync) {
+		t.Fatal("Expected the listener to turn udp-sync on")
+	}
+
+	data, _ := UDPPacket{NodeID: "b", Seq: 1, Time: ClockTime{Timestamp: 50}}.MarshalBinary()
+	from := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9}
+	server.features.Set(FeatureUDPSync, false)
+	u.handlePacket(data, from)
+	if server.clock.GetTime() != 0 || u.Stats().Received != 0 {
+		t.Error("Expected beacons ignored while the feature is off")
+	}
+	server.features.Set(FeatureUDPSync, true)
+	u.handlePacket(data, from)
+	if server.clock.GetTime() != 50 {
+		t.Errorf("Expected the beacon merged once the feature is on, got %d", server.clock.GetTime())
+	}
+}
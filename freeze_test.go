@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestClockFreeze(t *testing.T) {
+	lc := NewLamportClock(WithRollover(100))
+	lc.TickTime() // 1
+	lc.Freeze()
+
+	if now := lc.TickTime(); now.Timestamp != 1 {
+		t.Errorf("Expected a frozen tick to stay at 1, got %s", now)
+	}
+	if now := lc.UpdateTime(ClockTime{Timestamp: 50}); now.Timestamp != 1 {
+		t.Errorf("Expected a frozen merge to stay at 1, got %s", now)
+	}
+	if _, err := lc.tickN(3, ClockSource{}); !errors.Is(err, errClockFrozen) || lc.GetTime() != 1 {
+		t.Errorf("Expected a group of frozen ticks refused at 1, got %v at %d", err, lc.GetTime())
+	}
+	if !lc.Frozen() {
+		t.Error("Expected the clock to be frozen")
+	}
+
+	previous, err := lc.Advance(100)
+	if err != nil || previous.Timestamp != 1 || lc.Now() != (ClockTime{Epoch: 1, Timestamp: 1}) {
+		t.Errorf("Expected an advance from 1 to 1:1, got %s to %s (err: %v)", previous, lc.Now(), err)
+	}
+	for _, n := range []int64{0, -1, 101} {
+		if _, err := lc.Advance(n); err == nil {
+			t.Errorf("Expected an advance by %d to be refused", n)
+		}
+	}
+
+	lc.Resume()
+	if now := lc.TickTime(); now != (ClockTime{Epoch: 1, Timestamp: 2}) || lc.Frozen() {
+		t.Errorf("Expected the resumed clock to tick to 1:2, got %s", now)
+	}
+}
+
+func TestClockFreezeHandlers(t *testing.T) {
+	server := NewServer()
+	server.clock.Update(9) // 10
+
+	post := func(handler http.HandlerFunc, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, target, nil))
+		return w
+	}
+
+	w := post(server.handleClockFreeze, "/admin/clock/freeze")
+	var state struct {
+		Timestamp int64 `json:"lamport_timestamp"`
+		Frozen    bool  `json:"frozen"`
+	}
+	json.NewDecoder(w.Body).Decode(&state)
+	if w.Code != http.StatusOK || !state.Frozen || state.Timestamp != 10 {
+		t.Fatalf("Expected the clock frozen at 10, got %d %+v", w.Code, state)
+	}
+	server.logEvent("e1", "frozen")
+
+	w = post(server.handleClockAdvance, "/admin/clock/advance?n=5")
+	var audit Event
+	json.NewDecoder(w.Body).Decode(&audit)
+	if w.Code != http.StatusOK || audit.Type != "clock.advance" || audit.Timestamp != 15 {
+		t.Errorf("Expected a clock.advance audit event at 15, got %d %s at %d", w.Code, audit.Type, audit.Timestamp)
+	}
+
+	for _, target := range []string{"/admin/clock/advance", "/admin/clock/advance?n=0", "/admin/clock/advance?n=x"} {
+		if w := post(server.handleClockAdvance, target); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", target, w.Code)
+		}
+	}
+
+	w = post(server.handleClockResume, "/admin/clock/resume")
+	json.NewDecoder(w.Body).Decode(&state)
+	if state.Frozen || server.logEvent("e2", "resumed").Timestamp != 16 {
+		t.Errorf("Expected the resumed clock to tick to 16, got %+v", state)
+	}
+
+	w = httptest.NewRecorder()
+	server.handleClockFreeze(w, httptest.NewRequest(http.MethodGet, "/admin/clock/freeze", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", w.Code)
+	}
+}
+
+func TestClockFreezeReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clock.trace")
+	trace, err := OpenClockTrace(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lc := NewLamportClock()
+	trace.Record(lc, "")
+	lc.TickTime()
+	lc.Freeze()
+	lc.TickTime()
+	lc.UpdateTime(ClockTime{Timestamp: 40})
+	lc.Advance(7)
+	lc.Resume()
+	lc.TickTime()
+	trace.Close()
+
+	report, err := replayTraceFile(path, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Divergence != nil || report.Operations != 7 || report.Final.Timestamp != 9 {
+		t.Errorf("Expected 7 operations replayed to 9, got %+v", report)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"math/rand/v2"
+	"sync"
+	"testing"
+	"time"
+)
+
+// simNodes is how many clocks a simulation runs
+const simNodes = 3
+
+// clockSim runs Lamport clocks through a schedule of local events, sends
+// and deliveries. Messages in flight are delivered in any order the
+// schedule picks, so one schedule is one interleaving, replayed exactly.
+// Vector clocks along the same run tell which events happened before
+// which.
+type clockSim struct {
+	clocks   []*LamportClock
+	vectors  []*VectorClock
+	inFlight []simMessage
+	events   []simEvent
+}
+
+type simMessage struct {
+	to     int
+	time   ClockTime
+	vector []byte
+}
+
+type simEvent struct {
+	node   int
+	time   ClockTime
+	vector VectorTime
+}
+
+func newClockSim(rollover int64) *clockSim {
+	sim := &clockSim{}
+	epoch := time.Unix(0, 0)
+	for i := range simNodes {
+		sim.clocks = append(sim.clocks, NewLamportClock(
+			WithRollover(rollover),
+			WithWallClock(func() time.Time { return epoch }),
+		))
+		sim.clocks[i].history = NewClockHistory(16)
+		sim.vectors = append(sim.vectors, NewVectorClock(string(rune('a'+i))))
+	}
+	return sim
+}
+
+// step runs the operation encoded by op on the nodes or messages picked by
+// a and b
+func (sim *clockSim) step(t *testing.T, op, a, b byte) {
+	from, to := int(a)%simNodes, int(b)%simNodes
+	switch op % 3 {
+	case 0:
+		now := sim.clocks[from].TickTime()
+		sim.vectors[from].LocalEvent()
+		sim.record(t, from, now)
+	case 1:
+		now := sim.clocks[from].TickTime()
+		stamp := sim.vectors[from].Send()
+		sim.inFlight = append(sim.inFlight, simMessage{to: to, time: now, vector: stamp})
+		sim.record(t, from, now)
+	case 2:
+		if len(sim.inFlight) == 0 {
+			return
+		}
+		i := int(a) % len(sim.inFlight)
+		m := sim.inFlight[i]
+		sim.inFlight = append(sim.inFlight[:i], sim.inFlight[i+1:]...)
+		now := sim.clocks[m.to].UpdateTime(m.time)
+		if !m.time.Before(now) {
+			t.Fatalf("Node %d received %s and moved to %s, not past it", m.to, m.time, now)
+		}
+		if err := sim.vectors[m.to].Receive(m.vector); err != nil {
+			t.Fatal(err)
+		}
+		sim.record(t, m.to, now)
+	}
+}
+
+// record checks that the clock of node moved forward and logs the event
+func (sim *clockSim) record(t *testing.T, node int, now ClockTime) {
+	for i := len(sim.events) - 1; i >= 0; i-- {
+		if prev := sim.events[i]; prev.node == node {
+			if !prev.time.Before(now) {
+				t.Fatalf("Node %d went from %s to %s", node, prev.time, now)
+			}
+			break
+		}
+	}
+	sim.events = append(sim.events, simEvent{node: node, time: now, vector: sim.vectors[node].Now()})
+}
+
+// check verifies the invariants over all events of the run: timestamps
+// paired with node IDs are unique, and an event that happened before
+// another has a smaller timestamp
+func (sim *clockSim) check(t *testing.T) {
+	type stamp struct {
+		node int
+		time ClockTime
+	}
+	seen := make(map[stamp]bool, len(sim.events))
+	for _, e := range sim.events {
+		if seen[stamp{e.node, e.time}] {
+			t.Fatalf("Node %d stamped two events %s", e.node, e.time)
+		}
+		seen[stamp{e.node, e.time}] = true
+	}
+	for _, a := range sim.events {
+		for _, b := range sim.events {
+			if a.vector.Compare(b.vector) == relationBefore && !a.time.Before(b.time) {
+				t.Fatalf("Event %s of node %d happened before event %s of node %d", a.time, a.node, b.time, b.node)
+			}
+		}
+	}
+}
+
+// runSchedule decodes a schedule into steps of three bytes
+func runSchedule(t *testing.T, rollover int64, schedule []byte) {
+	sim := newClockSim(rollover)
+	for i := 0; i+2 < len(schedule); i += 3 {
+		sim.step(t, schedule[i], schedule[i+1], schedule[i+2])
+	}
+	sim.check(t)
+}
+
+func FuzzClockInvariants(f *testing.F) {
+	f.Add(uint8(0), []byte{0, 0, 0, 1, 0, 1, 2, 0, 0})
+	f.Add(uint8(2), []byte{1, 0, 1, 1, 1, 2, 1, 2, 0, 2, 1, 0, 2, 0, 0, 2, 0, 0, 0, 2, 2})
+	f.Add(uint8(5), []byte{1, 0, 1, 0, 0, 0, 0, 0, 0, 1, 0, 2, 2, 1, 0, 2, 0, 0, 1, 1, 0, 2, 0, 0})
+	f.Fuzz(func(t *testing.T, rollover uint8, schedule []byte) {
+		// Small rollovers exercise epochs, 0 leaves the default
+		limit := int64(defaultRollover)
+		if rollover > 0 {
+			limit = int64(rollover)
+		}
+		if len(schedule) > 3*256 {
+			schedule = schedule[:3*256]
+		}
+		runSchedule(t, limit, schedule)
+	})
+}
+
+func FuzzClockUpdate(f *testing.F) {
+	f.Add(int64(0), int64(0), int64(0), int64(0))
+	f.Add(int64(5), int64(1), int64(9), int64(0))
+	f.Add(int64(defaultRollover), int64(0), int64(defaultRollover), int64(0))
+	f.Add(int64(3), int64(2), int64(1<<62), int64(1))
+	f.Fuzz(func(t *testing.T, local, localEpoch, received, receivedEpoch int64) {
+		if local < 0 || localEpoch < 0 || received < 0 || receivedEpoch < 0 || localEpoch == 1<<63-1 || receivedEpoch == 1<<63-1 {
+			t.Skip()
+		}
+		lc := NewLamportClock()
+		lc.epoch, lc.timestamp = localEpoch, min(local, defaultRollover)
+		before := lc.Now()
+		sent := ClockTime{Epoch: receivedEpoch, Timestamp: received}
+
+		now := lc.UpdateTime(sent)
+		if !before.Before(now) || !sent.Before(now) {
+			t.Errorf("Update of %s with %s gave %s, not past both", before, sent, now)
+		}
+		if next := lc.TickTime(); !now.Before(next) {
+			t.Errorf("Tick after %s gave %s", now, next)
+		}
+	})
+}
+
+// TestClockInvariants runs random schedules as a property test, so the
+// invariants are checked on every test run and not only while fuzzing
+func TestClockInvariants(t *testing.T) {
+	for seed := range uint64(200) {
+		rng := rand.New(rand.NewPCG(seed, 0))
+		schedule := make([]byte, 3*rng.IntN(200))
+		for i := range schedule {
+			schedule[i] = byte(rng.UintN(256))
+		}
+		rollover := int64(defaultRollover)
+		if seed%2 == 0 {
+			rollover = int64(1 + rng.IntN(8))
+		}
+		runSchedule(t, rollover, schedule)
+	}
+}
+
+func TestClockInvariantsConcurrent(t *testing.T) {
+	lc := NewLamportClock(WithRollover(1000))
+	const workers, steps = 8, 500
+
+	// Every tick and update moves the clock under its lock, so no two
+	// calls return the same time and each worker sees its times rise
+	var wg sync.WaitGroup
+	results := make([][]ClockTime, workers)
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewPCG(uint64(w), 1))
+			for range steps {
+				if rng.IntN(2) == 0 {
+					results[w] = append(results[w], lc.TickTime())
+				} else {
+					results[w] = append(results[w], lc.UpdateTime(ClockTime{Timestamp: rng.Int64N(1200)}))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[ClockTime]bool, workers*steps)
+	for w, times := range results {
+		for i, now := range times {
+			if seen[now] {
+				t.Fatalf("Time %s returned twice", now)
+			}
+			seen[now] = true
+			if i > 0 && !times[i-1].Before(now) {
+				t.Fatalf("Worker %d saw %s after %s", w, now, times[i-1])
+			}
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// GraphNode is an event in the happened-before graph. Send nodes stand for
+// the send events of remote processes, known only from the messages they sent.
+type GraphNode struct {
+	ID        string `json:"id"`
+	Process   string `json:"process"`
+	Kind      string `json:"kind"`
+	Timestamp int64  `json:"lamport_timestamp"`
+	Epoch     int64  `json:"epoch,omitempty"`
+	Label     string `json:"label"`
+}
+
+// GraphEdge is a happened-before relation between two nodes. Process edges
+// link consecutive events of one process, message edges link a send to its
+// receive.
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+}
+
+// CausalityGraph is the happened-before graph of an event log
+type CausalityGraph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+const (
+	unknownSender = "unknown"
+	kindEvent     = "event"
+	kindSend      = "send"
+	kindProcess   = "process"
+	kindMessage   = "message"
+)
+
+// buildCausalityGraph builds the happened-before graph of events recorded by
+// the process named local
+func buildCausalityGraph(local string, events []Event) CausalityGraph {
+	return buildProcessGraph(map[string][]Event{local: events})
+}
+
+// buildProcessGraph builds the happened-before graph of several processes,
+// given their event logs. A received event is linked to the sender's event
+// at the timestamp the message carried when the sender's log has one;
+// otherwise a send node stands in for it.
+func buildProcessGraph(logs map[string][]Event) CausalityGraph {
+	graph := CausalityGraph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	byProcess := make(map[string][]GraphNode)
+	sends := make(map[string]bool)
+
+	// Events of known processes by time, to resolve message senders
+	sentBy := make(map[string]map[ClockTime]string)
+	for process, events := range logs {
+		sentBy[process] = make(map[ClockTime]string, len(events))
+		for _, e := range events {
+			sentBy[process][ClockTime{Epoch: e.Epoch, Timestamp: e.Timestamp}] = e.ID
+		}
+	}
+
+	for process, events := range logs {
+		for _, e := range events {
+			byProcess[process] = append(byProcess[process], GraphNode{
+				ID:        e.ID,
+				Process:   process,
+				Kind:      kindEvent,
+				Timestamp: e.Timestamp,
+				Epoch:     e.Epoch,
+				Label:     e.Message,
+			})
+
+			if e.SentAt == nil {
+				continue
+			}
+			sender := e.Sender
+			if sender == "" {
+				sender = unknownSender
+			}
+			if id, ok := sentBy[sender][*e.SentAt]; ok {
+				graph.Edges = append(graph.Edges, GraphEdge{From: id, To: e.ID, Kind: kindMessage})
+				continue
+			}
+
+			sendID := fmt.Sprintf("send:%s:%s", sender, e.SentAt)
+			if !sends[sendID] {
+				sends[sendID] = true
+				byProcess[sender] = append(byProcess[sender], GraphNode{
+					ID:        sendID,
+					Process:   sender,
+					Kind:      kindSend,
+					Timestamp: e.SentAt.Timestamp,
+					Epoch:     e.SentAt.Epoch,
+					Label:     "send",
+				})
+			}
+			graph.Edges = append(graph.Edges, GraphEdge{From: sendID, To: e.ID, Kind: kindMessage})
+		}
+	}
+
+	processes := make([]string, 0, len(byProcess))
+	for p := range byProcess {
+		processes = append(processes, p)
+	}
+	sort.Strings(processes)
+
+	for _, p := range processes {
+		nodes := byProcess[p]
+		// Within a process, Lamport order is the order the events happened in
+		sort.SliceStable(nodes, func(i, j int) bool {
+			a := ClockTime{Epoch: nodes[i].Epoch, Timestamp: nodes[i].Timestamp}
+			b := ClockTime{Epoch: nodes[j].Epoch, Timestamp: nodes[j].Timestamp}
+			return a.Before(b)
+		})
+		for i, n := range nodes {
+			graph.Nodes = append(graph.Nodes, n)
+			if i > 0 {
+				graph.Edges = append(graph.Edges, GraphEdge{From: nodes[i-1].ID, To: n.ID, Kind: kindProcess})
+			}
+		}
+	}
+	sortEdges(graph.Edges)
+	return graph
+}
+
+// sortEdges orders edges so output does not depend on map iteration
+func sortEdges(edges []GraphEdge) {
+	sort.SliceStable(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+}
+
+// path returns a chain of edges from one node to another, or nil when the
+// first did not happen before the second
+func (g CausalityGraph) path(from, to string) []string {
+	next := make(map[string][]string)
+	for _, e := range g.Edges {
+		next[e.From] = append(next[e.From], e.To)
+	}
+
+	parent := map[string]string{from: ""}
+	queue := []string{from}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, m := range next[n] {
+			if _, seen := parent[m]; seen {
+				continue
+			}
+			parent[m] = n
+			if m == to {
+				var path []string
+				for at := to; at != ""; at = parent[at] {
+					path = append([]string{at}, path...)
+				}
+				return path
+			}
+			queue = append(queue, m)
+		}
+	}
+	return nil
+}
+
+// node returns the node with the given ID
+func (g CausalityGraph) node(id string) (GraphNode, bool) {
+	for _, n := range g.Nodes {
+		if n.ID == id {
+			return n, true
+		}
+	}
+	return GraphNode{}, false
+}
+
+// graphScope returns the graph a request asks for: the server's own log,
+// or with scope=clocks the virtual clocks it may use
+func (s *Server) graphScope(w http.ResponseWriter, r *http.Request) (CausalityGraph, bool) {
+	switch r.URL.Query().Get("scope") {
+	case "", "events":
+		events := s.events.Events()
+
+		local := s.nodeID
+		if local == "" {
+			local = "local"
+		}
+		return buildCausalityGraph(local, events), true
+
+	case "clocks":
+		registry, ok := s.clockRegistry(w, r)
+		if !ok {
+			return CausalityGraph{}, false
+		}
+		logs := make(map[string][]Event)
+		for _, vc := range registry.List() {
+			logs[vc.Name] = vc.Events()
+		}
+		return buildProcessGraph(logs), true
+
+	default:
+		http.Error(w, "Invalid scope, expected events or clocks", http.StatusBadRequest)
+		return CausalityGraph{}, false
+	}
+}
+
+// WriteDOT renders the graph in Graphviz DOT, one cluster per process
+func (g CausalityGraph) WriteDOT(w io.Writer) {
+	fmt.Fprintln(w, "digraph happened_before {")
+	fmt.Fprintln(w, "  rankdir=LR;")
+	fmt.Fprintln(w, "  node [shape=box];")
+
+	cluster := -1
+	process := ""
+	for _, n := range g.Nodes {
+		if cluster < 0 || n.Process != process {
+			if cluster >= 0 {
+				fmt.Fprintln(w, "  }")
+			}
+			cluster++
+			process = n.Process
+			fmt.Fprintf(w, "  subgraph cluster_%d {\n    label=%s;\n", cluster, dotQuote(process))
+		}
+		label := fmt.Sprintf("%s\n%s", ClockTime{Epoch: n.Epoch, Timestamp: n.Timestamp}, n.Label)
+		style := ""
+		if n.Kind == kindSend {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(w, "    %s [label=%s%s];\n", dotQuote(n.ID), dotQuote(label), style)
+	}
+	if cluster >= 0 {
+		fmt.Fprintln(w, "  }")
+	}
+
+	for _, e := range g.Edges {
+		style := ""
+		if e.Kind == kindMessage {
+			style = " [style=dashed, color=blue]"
+		}
+		fmt.Fprintf(w, "  %s -> %s%s;\n", dotQuote(e.From), dotQuote(e.To), style)
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// dotQuote quotes s as a DOT string
+func dotQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", "")
+	return `"` + r.Replace(s) + `"`
+}
+
+func (s *Server) handleEventGraph(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "dot" {
+		http.Error(w, "Invalid format, expected dot or json", http.StatusBadRequest)
+		return
+	}
+
+	graph, ok := s.graphScope(w, r)
+	if !ok {
+		return
+	}
+
+	if format == "dot" {
+		w.Header().Set("Content-Type", "text/vnd.graphviz")
+		graph.WriteDOT(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(graph)
+}
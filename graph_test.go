@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCausalityGraph(t *testing.T) {
+	server := NewServer()
+	server.nodeID = "a"
+	server.logEvent("e1", "Local work")                                              // ts: 1
+	server.receiveMessage(t.Context(), "b", "", ClockTime{Timestamp: 5}, "Hello")    // ts: 6
+	server.receiveMessage(t.Context(), "b", "", ClockTime{Timestamp: 8}, "Again")    // ts: 9
+	server.receiveMessage(t.Context(), "", "", ClockTime{Timestamp: 2}, "Anonymous") // ts: 10
+
+	server.mutex.RLock()
+	graph := buildCausalityGraph("a", server.events.Events())
+	server.mutex.RUnlock()
+
+	if len(graph.Nodes) != 7 {
+		t.Fatalf("Expected 4 events and 3 send nodes, got %d nodes", len(graph.Nodes))
+	}
+
+	edges := make(map[GraphEdge]bool)
+	for _, e := range graph.Edges {
+		edges[e] = true
+	}
+	expected := []GraphEdge{
+		{From: "e1", To: "msg-6", Kind: kindProcess},
+		{From: "msg-6", To: "msg-9", Kind: kindProcess},
+		{From: "msg-9", To: "msg-10", Kind: kindProcess},
+		{From: "send:b:5", To: "msg-6", Kind: kindMessage},
+		{From: "send:b:8", To: "msg-9", Kind: kindMessage},
+		{From: "send:b:5", To: "send:b:8", Kind: kindProcess},
+		{From: "send:unknown:2", To: "msg-10", Kind: kindMessage},
+	}
+	for _, e := range expected {
+		if !edges[e] {
+			t.Errorf("Expected edge %+v", e)
+		}
+	}
+	if len(graph.Edges) != len(expected) {
+		t.Errorf("Expected %d edges, got %d", len(expected), len(graph.Edges))
+	}
+}
+
+func TestHandleEventGraph(t *testing.T) {
+	server := NewServer()
+	server.logEvent("e1", `Say "hi"`)
+	server.receiveMessage(t.Context(), "b", "", ClockTime{Timestamp: 3}, "Reply")
+
+	req := httptest.NewRequest(http.MethodGet, "/events/graph?format=dot", nil)
+	w := httptest.NewRecorder()
+	server.handleEventGraph(w, req)
+
+	body := w.Body.String()
+	if !strings.HasPrefix(body, "digraph happened_before {") {
+		t.Errorf("Expected DOT output, got %q", body)
+	}
+	if !strings.Contains(body, `"send:b:3" -> "msg-4" [style=dashed, color=blue];`) {
+		t.Errorf("Expected message edge in DOT output, got %q", body)
+	}
+	if !strings.Contains(body, `Say \"hi\"`) {
+		t.Errorf("Expected quotes to be escaped, got %q", body)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/events/graph", nil)
+	w = httptest.NewRecorder()
+	server.handleEventGraph(w, req)
+
+	var graph CausalityGraph
+	if err := json.NewDecoder(w.Body).Decode(&graph); err != nil {
+		t.Fatalf("Failed to decode graph: %v", err)
+	}
+	if len(graph.Nodes) != 3 || len(graph.Edges) != 2 {
+		t.Errorf("Expected 3 nodes and 2 edges, got %d and %d", len(graph.Nodes), len(graph.Edges))
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/events/graph?format=svg", nil)
+	w = httptest.NewRecorder()
+	server.handleEventGraph(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown format, got %d", w.Code)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+)
+
+// maxGraphQLDepth bounds how deeply selections nest, so a query cannot
+// fan out without end
+const maxGraphQLDepth = 16
+
+// errGraphQLSubscription is how graphql-go answers subscriptions sent to
+// Exec, which only runs queries
+const errGraphQLSubscription = "graphql-ws protocol header is missing"
+
+// gqlRequest is a GraphQL request, the body of POST /graphql or the query
+// string of GET
+type gqlRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// gqlRoot is the root resolver of graphQLSDL: queries and subscriptions
+// have resolvers of their own, as both have an events field
+type gqlRoot struct {
+	s *Server
+}
+
+func (r *gqlRoot) Query() *gqlQuery               { return &gqlQuery{r.s} }
+func (r *gqlRoot) Subscription() *gqlSubscription { return &gqlSubscription{r.s} }
+
+// newGraphQLSchema binds graphQLSDL to the resolvers of s. The schema is
+// part of the binary, so an invalid one is a bug caught by the tests.
+func newGraphQLSchema(s *Server) *graphql.Schema {
+	panics := gqlPanics{s}
+	return graphql.MustParseSchema(graphQLSDL, &gqlRoot{s},
+		graphql.UseStringDescriptions(),
+		graphql.MaxDepth(maxGraphQLDepth),
+		graphql.PanicHandler(panics),
+		graphql.Logger(panics),
+	)
+}
+
+// gqlPanics turns the panics recovered by graphql-go into errors of the
+// response. graphql-go reads Int literals in 32 bits and panics beyond,
+// which is the client's mistake: larger Int64 values are sent as strings
+// or variables. Any other panic is a bug, and logged.
+type gqlPanics struct {
+	s *Server
+}
+
+// literalOutOfRange reports whether a panic is that of a large Int literal
+func literalOutOfRange(value any) bool {
+	err, ok := value.(error)
+	return ok && errors.Is(err, strconv.ErrRange)
+}
+
+func (p gqlPanics) MakePanicError(_ context.Context, value any) *gqlerrors.QueryError {
+	if literalOutOfRange(value) {
+		return gqlerrors.Errorf("integer literal out of range, send Int64 values beyond 32 bits as strings or variables")
+	}
+	return gqlerrors.Errorf("internal error")
+}
+
+func (p gqlPanics) LogPanic(_ context.Context, value any) {
+	if !literalOutOfRange(value) {
+		p.s.logger.Error("GraphQL resolver panicked", "panic", value, "stack", string(debug.Stack()))
+	}
+}
+
+// wantsEventStream reports whether a request asks for server-sent events
+func wantsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// handleGraphQL runs GraphQL queries, GET or POST /graphql, and streams
+// subscriptions as server-sent events, one next event per event logged
+func (s *Server) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req gqlRequest
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		req.Query, req.OperationName = query.Get("query"), query.Get("operationName")
+		if v := query.Get("variables"); v != "" {
+			decoder := json.NewDecoder(strings.NewReader(v))
+			decoder.UseNumber()
+			if err := decoder.Decode(&req.Variables); err != nil {
+				http.Error(w, "Invalid variables parameter", http.StatusBadRequest)
+				return
+			}
+		}
+	case http.MethodPost:
+		decoder := json.NewDecoder(r.Body)
+		decoder.UseNumber()
+		if err := decoder.Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		http.Error(w, "Missing query", http.StatusBadRequest)
+		return
+	}
+	req.Variables = graphQLNumbers(req.Variables).(map[string]any)
+
+	if errs := s.graphql.ValidateWithVariables(req.Query, req.Variables); len(errs) > 0 {
+		writeGraphQL(w, http.StatusBadRequest, &graphql.Response{Errors: errs})
+		return
+	}
+	if wantsEventStream(r) {
+		s.streamGraphQL(w, r, req)
+		return
+	}
+	response := s.graphql.Exec(r.Context(), req.Query, req.OperationName, req.Variables)
+	if len(response.Errors) == 1 && response.Errors[0].Message == errGraphQLSubscription {
+		writeGraphQL(w, http.StatusNotAcceptable, &graphql.Response{Errors: []*gqlerrors.QueryError{{Message: "Subscriptions are streamed, send Accept: text/event-stream."}}})
+		return
+	}
+	writeGraphQL(w, http.StatusOK, response)
+}
+
+// graphQLNumbers turns the numbers of decoded variables into the int or
+// float64 graphql-go expects, so that Int64 values keep all their digits
+func graphQLNumbers(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return int(n)
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		if v == nil {
+			v = map[string]any{}
+		}
+		for key, item := range v {
+			v[key] = graphQLNumbers(item)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = graphQLNumbers(item)
+		}
+		return v
+	}
+	return value
+}
+
+func writeGraphQL(w http.ResponseWriter, status int, response *graphql.Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// streamGraphQL runs an operation over server-sent events, following the
+// distinct connections mode of GraphQL over SSE: a subscription sends a
+// next event per event logged, a query its only result, and both end with
+// complete
+func (s *Server) streamGraphQL(w http.ResponseWriter, r *http.Request, req gqlRequest) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	// The subscription is in place once Subscribe returns
+	responses, err := s.graphql.Subscribe(r.Context(), req.Query, req.OperationName, req.Variables)
+	if err != nil {
+		writeGraphQL(w, http.StatusOK, &graphql.Response{Errors: []*gqlerrors.QueryError{{Message: err.Error()}}})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, ": lamport_timestamp %d\n\n", s.clock.GetTime())
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case response, ok := <-responses:
+			if !ok {
+				if r.Context().Err() == nil {
+					fmt.Fprint(w, "event: complete\ndata:\n\n")
+					flusher.Flush()
+				}
+				return
+			}
+			data, err := json.Marshal(response)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: next\ndata: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
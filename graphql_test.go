@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// postGraphQL posts a request to /graphql
+func postGraphQL(server *Server, query string, variables map[string]any) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]any{"query": query, "variables": variables})
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body))))
+	return rec
+}
+
+// graphQL posts a request to /graphql and decodes the response
+func graphQL(t *testing.T, server *Server, query string, variables map[string]any) (int, map[string]any) {
+	t.Helper()
+	rec := postGraphQL(server, query, variables)
+	var response map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Expected a JSON response, got %d %s", rec.Code, rec.Body)
+	}
+	return rec.Code, response
+}
+
+func TestGraphQLQuery(t *testing.T) {
+	server := NewServer(WithNodeID("node-a"))
+	for _, id := range []string{"e1", "e2", "e3"} {
+		server.logEvent(id, "payment "+id)
+	}
+	server.logEvent("x1", "other")
+
+	rec := postGraphQL(server, `
+		query Log($first: Int!, $contains: String) {
+			clock { node timestamp }
+			page: events(first: $first, contains: $contains) { count total nextCursor events { ...eventFields } }
+			event(id: "x1") { id message label(key: "missing") }
+			missing: event(id: "nope") { id }
+		}
+		fragment eventFields on Event { id timestamp __typename }`,
+		map[string]any{"first": 2, "contains": "payment"})
+	// Fields come back in the order they were selected
+	want := `{"data":{"clock":{"node":"node-a","timestamp":4},"page":{"count":2,"total":3,"nextCursor":"` +
+		cursorOf(Event{ID: "e2", Timestamp: 2, Node: "node-a"}).String() +
+		`","events":[{"id":"e1","timestamp":1,"__typename":"Event"},{"id":"e2","timestamp":2,"__typename":"Event"}]},"event":{"id":"x1","message":"other","label":null},"missing":null}}`
+	if got := strings.TrimSpace(rec.Body.String()); rec.Code != http.StatusOK || got != want {
+		t.Fatalf("Expected\n%s\ngot %d\n%s", want, rec.Code, got)
+	}
+
+	// The next page follows the cursor
+	cursor := cursorOf(Event{ID: "e2", Timestamp: 2, Node: "node-a"}).String()
+	_, response := graphQL(t, server, `query($after: String) { events(first: 2, after: $after, contains: "payment") { events { id } nextCursor } }`, map[string]any{"after": cursor})
+	if data, _ := json.Marshal(response["data"]); string(data) != `{"events":{"events":[{"id":"e3"}],"nextCursor":null}}` {
+		t.Errorf("Expected e3 on the last page, got %s", data)
+	}
+
+	// GET runs queries too, with skip and include
+	rec = httptest.NewRecorder()
+	query := url.Values{"query": {`query($skip: Boolean!) { clock { node @skip(if: $skip) epoch @include(if: false) timestamp } }`}, "variables": {`{"skip":true}`}}
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/graphql?"+query.Encode(), nil))
+	if got := strings.TrimSpace(rec.Body.String()); got != `{"data":{"clock":{"timestamp":4}}}` {
+		t.Errorf("Expected only the timestamp, got %s", got)
+	}
+}
+
+func TestGraphQLErrors(t *testing.T) {
+	server := NewServer()
+	server.logEvent("e1", "hello")
+
+	for query, message := range map[string]string{
+		`{ clock { nodes } }`:                `Cannot query field "nodes" on type "Clock". Did you mean "node"?`,
+		`{ clock }`:                          `Field "clock" of type "Clock!" must have a selection of subfields. Did you mean "clock { ... }"?`,
+		`{ event { id } }`:                   `Field "event" argument "id" of type "ID!" is required, but it was not provided.`,
+		`{ events(first: "x") { count } }`:   "Argument \"first\" has invalid value \"x\".\nExpected type \"Int\", found \"x\".",
+		`query { event(id: $id) { id } }`:    `Variable "$id" is not defined.`,
+		`{ clock { node ...missing } }`:      `Unknown fragment "missing". Unable to evaluate depth.`,
+		`{ clock { node }`:                   `syntax error: unexpected "", expecting Ident`,
+		`query($n: Int!) { clock { node } }`: `Variable "n" has invalid value null.` + "\nExpected type \"Int!\", found null.",
+	} {
+		code, response := graphQL(t, server, query, nil)
+		errs, _ := response["errors"].([]any)
+		if code != http.StatusBadRequest || len(errs) == 0 || errs[0].(map[string]any)["message"] != message || response["data"] != nil {
+			t.Errorf("%s: expected 400 with %q, got %d %v", query, message, code, response)
+		}
+	}
+
+	// Mutations are not served
+	code, response := graphQL(t, server, `mutation { clock { node } }`, nil)
+	if errs, _ := response["errors"].([]any); code != http.StatusOK || len(errs) != 1 || response["data"] != nil {
+		t.Errorf("Expected mutations refused, got %d %v", code, response)
+	}
+
+	// Field errors null the field and keep the rest
+	code, response = graphQL(t, server, `{ events(after: "bad") { count } clock { timestamp } }`, nil)
+	errs, _ := response["errors"].([]any)
+	data, _ := response["data"].(map[string]any)
+	if code != http.StatusOK || len(errs) != 1 || data != nil {
+		t.Fatalf("Expected the error of the non-null events to null the data, got %d %v", code, response)
+	}
+	if path := errs[0].(map[string]any)["path"]; len(path.([]any)) != 1 || path.([]any)[0] != "events" {
+		t.Errorf("Expected the path of events, got %v", path)
+	}
+	_, response = graphQL(t, server, `{ summary(ticks: 0) { events } }`, nil)
+	if response["data"] != nil || response["errors"] == nil {
+		t.Errorf("Expected an invalid summary to fail, got %v", response)
+	}
+}
+
+func TestGraphQLDocuments(t *testing.T) {
+	server := NewServer(WithNodeID("node-a"))
+	server.logEvent("e1", "payment")
+	server.clock.Update(1 << 40)
+	server.logEvent("e2", "late payment")
+
+	// Aliases, inline fragments and nested named fragments
+	rec := postGraphQL(server, `
+		query Pages($first: Int = 1) {
+			head: events(first: $first) { ...page }
+			all: events(first: 10) { count events { ... on Event { id } } }
+		}
+		fragment page on EventPage { count events { ...ids } }
+		fragment ids on Event { id }`, nil)
+	if got := strings.TrimSpace(rec.Body.String()); got != `{"data":{"head":{"count":1,"events":[{"id":"e1"}]},"all":{"count":2,"events":[{"id":"e1"},{"id":"e2"}]}}}` {
+		t.Errorf("Expected both pages, got %s", got)
+	}
+
+	// Int64 values past 32 bits come as variables or strings, never rounded
+	late := int64(1<<40) + 2
+	var response map[string]any
+	for _, variables := range []map[string]any{{"from": late}, {"from": strconv.FormatInt(late, 10)}} {
+		_, response = graphQL(t, server, `query($from: Int64) { events(from: $from) { events { id timestamp } } }`, variables)
+		if data, _ := json.Marshal(response["data"]); string(data) != `{"events":{"events":[{"id":"e2","timestamp":1099511627778}]}}` {
+			t.Errorf("%v: expected e2 from %d, got %s %v", variables, late, data, response["errors"])
+		}
+	}
+	_, response = graphQL(t, server, `{ events(from: 1099511627778) { count } }`, nil)
+	if errs, _ := response["errors"].([]any); len(errs) != 1 || !strings.Contains(errs[0].(map[string]any)["message"].(string), "out of range") {
+		t.Errorf("Expected the literal refused, got %v", response)
+	}
+
+	// The operation is chosen by name
+	body, _ := json.Marshal(map[string]any{"query": `query A { clock { node } } query B { clock { epoch } }`, "operationName": "B"})
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body))))
+	if got := strings.TrimSpace(rec.Body.String()); got != `{"data":{"clock":{"epoch":0}}}` {
+		t.Errorf("Expected operation B, got %s", got)
+	}
+}
+
+func TestGraphQLDepthLimit(t *testing.T) {
+	server := NewServer()
+	// The schema nests only a few levels, introspection as deep as asked
+	nest := func(depth int) string {
+		return `{ __type(name: "Event") { ` + strings.Repeat("ofType { ", depth-2) + "name" + strings.Repeat(" }", depth-2) + " } }"
+	}
+	if code, response := graphQL(t, server, "query "+nest(maxGraphQLDepth), nil); code != http.StatusOK {
+		t.Errorf("Expected %d levels served, got %d %v", maxGraphQLDepth, code, response)
+	}
+	code, response := graphQL(t, server, "query "+nest(maxGraphQLDepth+1), nil)
+	errs, _ := response["errors"].([]any)
+	if code != http.StatusBadRequest || len(errs) == 0 || !strings.Contains(errs[0].(map[string]any)["message"].(string), "exceeds max depth") {
+		t.Errorf("Expected %d levels refused, got %d %v", maxGraphQLDepth+1, code, response)
+	}
+}
+
+func TestGraphQLIntrospection(t *testing.T) {
+	server := NewServer()
+	_, response := graphQL(t, server, `{
+		__schema { queryType { name } subscriptionType { name } types { name kind } directives { name } }
+		__type(name: "Event") { name fields { name type { kind name ofType { kind name } } } }
+	}`, nil)
+	if response["errors"] != nil {
+		t.Fatalf("Expected introspection to run, got %v", response["errors"])
+	}
+	data := response["data"].(map[string]any)
+	schema := data["__schema"].(map[string]any)
+	if schema["queryType"].(map[string]any)["name"] != "Query" || schema["subscriptionType"].(map[string]any)["name"] != "Subscription" {
+		t.Errorf("Expected the root types, got %v", schema)
+	}
+	names := map[string]bool{}
+	for _, typ := range schema["types"].([]any) {
+		names[typ.(map[string]any)["name"].(string)] = true
+	}
+	for _, name := range []string{"Event", "Clock", "Int64", "__Type", "String"} {
+		if !names[name] {
+			t.Errorf("Expected type %s listed", name)
+		}
+	}
+	event := data["__type"].(map[string]any)
+	fields, _ := json.Marshal(event["fields"].([]any)[0])
+	if string(fields) != `{"name":"id","type":{"kind":"NON_NULL","name":null,"ofType":{"kind":"SCALAR","name":"ID"}}}` {
+		t.Errorf("Expected id as ID!, got %s", fields)
+	}
+}
+
+func TestGraphQLSubscription(t *testing.T) {
+	server := NewServer()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	body := `{"query":"subscription { events(idPrefix: \"order-\") { id message } }"}`
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, ts.URL+"/graphql", strings.NewReader(body))
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %s", resp.Header.Get("Content-Type"))
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	reader.ReadString('\n') // the comment sent once subscribed
+	server.logEvent("other-1", "skipped")
+	server.logEvent("order-1", "shipped")
+	var frames []string
+	for len(frames) < 2 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			frames = append(frames, line)
+		}
+	}
+	if frames[0] != "event: next" || frames[1] != `data: {"data":{"events":{"id":"order-1","message":"shipped"}}}` {
+		t.Errorf("Expected order-1 as the next event, got %q", frames)
+	}
+
+	// Without the event stream accepted, subscriptions are refused
+	code, _ := graphQL(t, server, `subscription { events { id } }`, nil)
+	if code != http.StatusNotAcceptable {
+		t.Errorf("Expected 406 without Accept: text/event-stream, got %d", code)
+	}
+}
+
+func TestGraphQLReaderRole(t *testing.T) {
+	server := NewServer()
+	server.access, _ = NewAccessControl([]RoleConfig{{Name: "dashboard", APIKeys: []string{"read-key"}, Roles: []string{"reader"}}}, nil, nil)
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{"query":"{ clock { timestamp } }"}`))
+	req.Header.Set("X-API-Key", "read-key")
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected readers to query with POST, got %d %s", rec.Code, rec.Body)
+	}
+}
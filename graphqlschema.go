@@ -0,0 +1,559 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/graph-gophers/graphql-go"
+)
+
+// graphQLSDL is the schema of /graphql
+const graphQLSDL = `
+"Lamport timestamps and epochs, which outgrow Int, as JSON numbers"
+scalar Int64
+
+type Query {
+  "The clock of this node"
+  clock: Clock!
+  "A page of the event log in total order, first events after the cursor after, filtered as asked. from and to bound the timestamps in epoch, the current one by default."
+  events(first: Int = 100, after: String, contains: String, idPrefix: String, epoch: Int64, from: Int64, to: Int64): EventPage!
+  "The first event logged with an ID"
+  event(id: ID!): Event
+  "The peers of this node, with their state when the failure detector runs"
+  peers: [Peer!]!
+  "Aggregates of the event log, as GET /analytics/summary"
+  summary(ticks: Int64 = 1000, wall: String = "1m", top: Int = 10): Summary!
+}
+
+type Subscription {
+  "Events as they are logged, filtered as GET /events/stream"
+  events(contains: String, idPrefix: String, minTimestamp: Int64): Event!
+}
+
+type Clock {
+  node: String!
+  timestamp: Int64!
+  epoch: Int64!
+  wallTime: String!
+  "Events held in the log"
+  events: Int!
+  "Events dropped from the log"
+  dropped: Int64!
+}
+
+type Event {
+  id: ID!
+  message: String!
+  timestamp: Int64!
+  epoch: Int64!
+  wallTime: String
+  type: String
+  schemaVersion: Int
+  "The payload as JSON text"
+  payload: String
+  metadata: [Label!]!
+  "The metadata value of a key"
+  label(key: String!): String
+  node: String
+  sender: String
+  sentAt: ClockTime
+  requestId: String
+}
+
+type Label {
+  key: String!
+  value: String!
+}
+
+type ClockTime {
+  epoch: Int64!
+  timestamp: Int64!
+}
+
+type EventPage {
+  events: [Event!]!
+  count: Int!
+  "Events matching the filters"
+  total: Int!
+  "The cursor of the next page, null on the last one"
+  nextCursor: String
+}
+
+type Peer {
+  url: String!
+  node: String
+  "alive, suspect or dead"
+  state: String
+  lastHeard: String
+  lastTime: ClockTime
+  missed: Int
+}
+
+type Summary {
+  events: Int!
+  untyped: Int!
+  byNode: [Count!]!
+  byType: [Count!]!
+  logicalBuckets: [LogicalBucket!]!
+  wallBuckets: [WallBucket!]!
+  topTalkers: [Talker!]!
+  propagation: Propagation!
+}
+
+type Count {
+  key: String!
+  count: Int!
+}
+
+type LogicalBucket {
+  epoch: Int64!
+  start: Int64!
+  end: Int64!
+  events: Int!
+}
+
+type WallBucket {
+  start: String!
+  events: Int!
+}
+
+type Talker {
+  sender: String!
+  receiver: String!
+  messages: Int!
+}
+
+type Propagation {
+  messages: Int!
+  avgTicks: Float!
+  matched: Int!
+  avgMs: Float!
+}
+`
+
+// gqlInt64 is the Int64 scalar. Values beyond the 32 bits of Int literals
+// are sent as variables, or as strings.
+type gqlInt64 int64
+
+func (gqlInt64) ImplementsGraphQLType(name string) bool {
+	return name == "Int64"
+}
+
+func (n *gqlInt64) UnmarshalGraphQL(input any) error {
+	switch v := input.(type) {
+	case int32:
+		*n = gqlInt64(v)
+	case int:
+		*n = gqlInt64(v)
+	case int64:
+		*n = gqlInt64(v)
+	case float64:
+		if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+			return fmt.Errorf("%v is not an Int64", v)
+		}
+		*n = gqlInt64(v)
+	case string:
+		return n.parse(v)
+	default:
+		return fmt.Errorf("%v is not an Int64", input)
+	}
+	return nil
+}
+
+func (n *gqlInt64) parse(s string) error {
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%q is not an Int64", s)
+	}
+	*n = gqlInt64(v)
+	return nil
+}
+
+func (n gqlInt64) MarshalJSON() ([]byte, error) {
+	return strconv.AppendInt(nil, int64(n), 10), nil
+}
+
+// optional is a nullable String, null when empty
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// wallTime formats a wall time for the schema, or null when unset
+func wallTime(t time.Time) *string {
+	if t.IsZero() {
+		return nil
+	}
+	return optional(t.Format(time.RFC3339Nano))
+}
+
+// int64Arg is the value of an optional Int64 argument
+func int64Arg(arg *gqlInt64) (int64, bool) {
+	if arg == nil {
+		return 0, false
+	}
+	return int64(*arg), true
+}
+
+// stringArg is the value of an optional String argument, empty when not
+// given
+func stringArg(arg *string) string {
+	if arg == nil {
+		return ""
+	}
+	return *arg
+}
+
+// gqlQuery resolves the fields of Query and Subscription
+type gqlQuery struct {
+	s *Server
+}
+
+func (q gqlQuery) Clock() gqlClock {
+	s := q.s
+	return gqlClock{now: s.clock.Now(), wall: time.Now(), node: s.nodeID, events: s.events.Len(), dropped: s.events.Dropped()}
+}
+
+// gqlEventsArgs are the arguments of Query.events
+type gqlEventsArgs struct {
+	First    int32
+	After    *string
+	Contains *string
+	IDPrefix *string
+	Epoch    *gqlInt64
+	From     *gqlInt64
+	To       *gqlInt64
+}
+
+func (q gqlQuery) Events(args gqlEventsArgs) (gqlEventPage, error) {
+	return q.s.graphQLEvents(args)
+}
+
+func (q gqlQuery) Event(args struct{ ID graphql.ID }) *gqlEvent {
+	if e, ok := q.s.events.Find(string(args.ID)); ok {
+		return &gqlEvent{&e}
+	}
+	return nil
+}
+
+func (q gqlQuery) Peers() []gqlPeer {
+	s := q.s
+	health := make(map[string]PeerHealth)
+	if s.monitor != nil {
+		for _, p := range s.monitor.Peers() {
+			health[p.URL] = p
+		}
+	}
+	peers := []gqlPeer{}
+	for _, u := range s.peers.URLs() {
+		p, ok := health[u]
+		if !ok {
+			p = PeerHealth{URL: u}
+		}
+		peers = append(peers, gqlPeer{p})
+	}
+	return peers
+}
+
+func (q gqlQuery) Summary(args struct {
+	Ticks gqlInt64
+	Wall  string
+	Top   int32
+}) (gqlSummary, error) {
+	width, err := time.ParseDuration(args.Wall)
+	if err != nil || width <= 0 || args.Ticks < 1 || args.Top < 0 {
+		return gqlSummary{}, errors.New("invalid ticks, wall or top")
+	}
+	return gqlSummary{summarize(q.s.events.Events(), int64(args.Ticks), width, int(args.Top))}, nil
+}
+
+// gqlEventsFilter are the arguments of Subscription.events
+type gqlEventsFilter struct {
+	Contains     *string
+	IDPrefix     *string
+	MinTimestamp *gqlInt64
+}
+
+// gqlSubscription resolves the fields of Subscription
+type gqlSubscription struct {
+	s *Server
+}
+
+// Events resolves Subscription.events: the events of a broker
+// subscription, until the request or the broker is done
+func (q *gqlSubscription) Events(ctx context.Context, args gqlEventsFilter) <-chan *gqlEvent {
+	filter := EventFilter{MessageContains: stringArg(args.Contains), IDPrefix: stringArg(args.IDPrefix)}
+	filter.MinTimestamp, _ = int64Arg(args.MinTimestamp)
+	broker := q.s.broker
+	sub := broker.Subscribe(filter)
+	events := make(chan *gqlEvent)
+	go func() {
+		defer close(events)
+		defer broker.Unsubscribe(sub)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-broker.Done():
+				return
+			case event, ok := <-sub.Events:
+				if !ok {
+					return
+				}
+				select {
+				case events <- &gqlEvent{&event}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events
+}
+
+// gqlClock is the clock of Query.clock
+type gqlClock struct {
+	now     ClockTime
+	wall    time.Time
+	node    string
+	events  int
+	dropped int64
+}
+
+func (c gqlClock) Node() string        { return c.node }
+func (c gqlClock) Timestamp() gqlInt64 { return gqlInt64(c.now.Timestamp) }
+func (c gqlClock) Epoch() gqlInt64     { return gqlInt64(c.now.Epoch) }
+func (c gqlClock) WallTime() string    { return c.wall.Format(time.RFC3339Nano) }
+func (c gqlClock) Events() int32       { return int32(c.events) }
+func (c gqlClock) Dropped() gqlInt64   { return gqlInt64(c.dropped) }
+
+// gqlEvent is an event of the log
+type gqlEvent struct {
+	e *Event
+}
+
+func (e gqlEvent) ID() graphql.ID      { return graphql.ID(e.e.ID) }
+func (e gqlEvent) Message() string     { return e.e.Message }
+func (e gqlEvent) Timestamp() gqlInt64 { return gqlInt64(e.e.Timestamp) }
+func (e gqlEvent) Epoch() gqlInt64     { return gqlInt64(e.e.Epoch) }
+func (e gqlEvent) WallTime() *string   { return wallTime(e.e.WallTime) }
+func (e gqlEvent) Type() *string       { return optional(e.e.Type) }
+func (e gqlEvent) Payload() *string    { return optional(string(e.e.Payload)) }
+func (e gqlEvent) Node() *string       { return optional(e.e.Node) }
+func (e gqlEvent) Sender() *string     { return optional(e.e.Sender) }
+func (e gqlEvent) RequestID() *string  { return optional(e.e.RequestID) }
+
+func (e gqlEvent) SchemaVersion() *int32 {
+	if e.e.SchemaVersion == 0 {
+		return nil
+	}
+	v := int32(e.e.SchemaVersion)
+	return &v
+}
+
+func (e gqlEvent) Metadata() []gqlLabel {
+	labels := make([]gqlLabel, 0, len(e.e.Metadata))
+	for _, key := range slices.Sorted(maps.Keys(e.e.Metadata)) {
+		labels = append(labels, gqlLabel{key, e.e.Metadata[key]})
+	}
+	return labels
+}
+
+func (e gqlEvent) Label(args struct{ Key string }) *string {
+	if value, ok := e.e.Metadata[args.Key]; ok {
+		return &value
+	}
+	return nil
+}
+
+func (e gqlEvent) SentAt() *gqlClockTime {
+	if e.e.SentAt == nil {
+		return nil
+	}
+	return &gqlClockTime{*e.e.SentAt}
+}
+
+// gqlLabel is a metadata entry of an event
+type gqlLabel struct{ key, value string }
+
+func (l gqlLabel) Key() string   { return l.key }
+func (l gqlLabel) Value() string { return l.value }
+
+// gqlClockTime is a ClockTime
+type gqlClockTime struct{ t ClockTime }
+
+func (t gqlClockTime) Epoch() gqlInt64     { return gqlInt64(t.t.Epoch) }
+func (t gqlClockTime) Timestamp() gqlInt64 { return gqlInt64(t.t.Timestamp) }
+
+// gqlEventPage is a page of Query.events
+type gqlEventPage struct {
+	events []Event
+	total  int
+	next   *Cursor
+}
+
+func (p gqlEventPage) Events() []gqlEvent {
+	events := make([]gqlEvent, len(p.events))
+	for i := range p.events {
+		events[i] = gqlEvent{&p.events[i]}
+	}
+	return events
+}
+
+func (p gqlEventPage) Count() int32 { return int32(len(p.events)) }
+func (p gqlEventPage) Total() int32 { return int32(p.total) }
+
+func (p gqlEventPage) NextCursor() *string {
+	if p.next == nil {
+		return nil
+	}
+	return optional(p.next.String())
+}
+
+// gqlPeer is a peer of Query.peers. Its state is only known while the
+// failure detector runs.
+type gqlPeer struct{ p PeerHealth }
+
+func (p gqlPeer) URL() string        { return p.p.URL }
+func (p gqlPeer) Node() *string      { return optional(p.p.Node) }
+func (p gqlPeer) State() *string     { return optional(string(p.p.State)) }
+func (p gqlPeer) LastHeard() *string { return wallTime(p.p.LastHeard) }
+
+func (p gqlPeer) LastTime() *gqlClockTime {
+	if p.p.State == "" {
+		return nil
+	}
+	return &gqlClockTime{p.p.LastTime}
+}
+
+func (p gqlPeer) Missed() *int32 {
+	if p.p.State == "" {
+		return nil
+	}
+	missed := int32(p.p.Missed)
+	return &missed
+}
+
+// gqlSummary is the summary of Query.summary
+type gqlSummary struct{ s EventSummary }
+
+func (s gqlSummary) Events() int32               { return int32(s.s.Events) }
+func (s gqlSummary) Untyped() int32              { return int32(s.s.Untyped) }
+func (s gqlSummary) ByNode() []gqlCount          { return counts(s.s.ByNode) }
+func (s gqlSummary) ByType() []gqlCount          { return counts(s.s.ByType) }
+func (s gqlSummary) Propagation() gqlPropagation { return gqlPropagation{s.s.Propagation} }
+
+func (s gqlSummary) LogicalBuckets() []gqlLogicalBucket {
+	buckets := make([]gqlLogicalBucket, len(s.s.Logical))
+	for i, b := range s.s.Logical {
+		buckets[i] = gqlLogicalBucket{b}
+	}
+	return buckets
+}
+
+func (s gqlSummary) WallBuckets() []gqlWallBucket {
+	buckets := make([]gqlWallBucket, len(s.s.Wall))
+	for i, b := range s.s.Wall {
+		buckets[i] = gqlWallBucket{b}
+	}
+	return buckets
+}
+
+func (s gqlSummary) TopTalkers() []gqlTalker {
+	talkers := make([]gqlTalker, len(s.s.TopTalkers))
+	for i, t := range s.s.TopTalkers {
+		talkers[i] = gqlTalker{t}
+	}
+	return talkers
+}
+
+// gqlCount is an entry of the counts of a summary
+type gqlCount struct {
+	key   string
+	count int
+}
+
+func (c gqlCount) Key() string  { return c.key }
+func (c gqlCount) Count() int32 { return int32(c.count) }
+
+// counts lists the entries of a map by key
+func counts(m map[string]int) []gqlCount {
+	list := make([]gqlCount, 0, len(m))
+	for _, key := range slices.Sorted(maps.Keys(m)) {
+		list = append(list, gqlCount{key, m[key]})
+	}
+	return list
+}
+
+type gqlLogicalBucket struct{ b LogicalBucket }
+
+func (b gqlLogicalBucket) Epoch() gqlInt64 { return gqlInt64(b.b.Epoch) }
+func (b gqlLogicalBucket) Start() gqlInt64 { return gqlInt64(b.b.Start) }
+func (b gqlLogicalBucket) End() gqlInt64   { return gqlInt64(b.b.End) }
+func (b gqlLogicalBucket) Events() int32   { return int32(b.b.Events) }
+
+type gqlWallBucket struct{ b WallBucket }
+
+func (b gqlWallBucket) Start() string { return b.b.Start.Format(time.RFC3339Nano) }
+func (b gqlWallBucket) Events() int32 { return int32(b.b.Events) }
+
+type gqlTalker struct{ t Talker }
+
+func (t gqlTalker) Sender() string   { return t.t.Sender }
+func (t gqlTalker) Receiver() string { return t.t.Receiver }
+func (t gqlTalker) Messages() int32  { return int32(t.t.Messages) }
+
+type gqlPropagation struct{ p Propagation }
+
+func (p gqlPropagation) Messages() int32   { return int32(p.p.Messages) }
+func (p gqlPropagation) AvgTicks() float64 { return p.p.AvgTicks }
+func (p gqlPropagation) Matched() int32    { return int32(p.p.Matched) }
+func (p gqlPropagation) AvgMs() float64    { return p.p.AvgMillisec }
+
+// graphQLEvents resolves Query.events: the events in the time range, if
+// any, matching the filters, in total order and paged as /events
+func (s *Server) graphQLEvents(args gqlEventsArgs) (gqlEventPage, error) {
+	if args.First < 1 || args.First > maxPageLimit {
+		return gqlEventPage{}, fmt.Errorf("first must be from 1 to %d", maxPageLimit)
+	}
+	page := PageRequest{Limit: int(args.First)}
+	if after := stringArg(args.After); after != "" {
+		c, err := ParseCursor(after)
+		if err != nil {
+			return gqlEventPage{}, err
+		}
+		page.Cursor = &c
+	}
+
+	var events []Event
+	from, fromSet := int64Arg(args.From)
+	to, toSet := int64Arg(args.To)
+	epoch, epochSet := int64Arg(args.Epoch)
+	if fromSet || toSet {
+		if !epochSet {
+			epoch = s.clock.Now().Epoch
+		}
+		if !toSet {
+			to = math.MaxInt64
+		}
+		events = s.events.Between(ClockTime{Epoch: epoch, Timestamp: from}, ClockTime{Epoch: epoch, Timestamp: to})
+	} else {
+		events = s.events.Events()
+	}
+	filter := EventFilter{MessageContains: stringArg(args.Contains), IDPrefix: stringArg(args.IDPrefix)}
+	events = slices.DeleteFunc(events, func(e Event) bool { return !filter.Match(e) })
+	if epochSet && !fromSet && !toSet {
+		events = slices.DeleteFunc(events, func(e Event) bool { return e.Epoch != epoch })
+	}
+	SortEvents(events, s.ties)
+	paged, next := page.Page(events, s.ties)
+	return gqlEventPage{events: paged, total: len(events), next: next}, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// readinessTimeout bounds how long a readiness probe may take
+const readinessTimeout = 2 * time.Second
+
+// CheckResult is the outcome of a single readiness check
+type CheckResult struct {
+	Status  string                 `json:"status"` // ok or failed
+	Error   string                 `json:"error,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+func checkOK(details map[string]interface{}) CheckResult {
+	return CheckResult{Status: "ok", Details: details}
+}
+
+func checkFailed(err error, details map[string]interface{}) CheckResult {
+	return CheckResult{Status: "failed", Error: err.Error(), Details: details}
+}
+
+// checkEventStore verifies the event log accepts writes, i.e. its lock can
+// be taken before the deadline
+func (s *Server) checkEventStore(ctx context.Context) CheckResult {
+	start := time.Now()
+	for !s.mutex.TryLock() {
+		select {
+		case <-ctx.Done():
+			return checkFailed(errors.New("event store is not accepting writes"), nil)
+		case <-time.After(time.Millisecond):
+		}
+	}
+	s.mutex.Unlock()
+	if err := storeWriteErr(s.events); err != nil {
+		return checkFailed(err, nil)
+	}
+
+	return checkOK(map[string]interface{}{
+		"latency_ms": time.Since(start).Milliseconds(),
+	})
+}
+
+// checkPeers verifies that this node can reach a quorum of the cluster,
+// counting itself as one member
+func (s *Server) checkPeers(ctx context.Context) CheckResult {
+	urls := s.peers.URLs()
+	required := (len(urls) + 1) / 2 // majority of the cluster, minus this node
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	statuses := make(map[string]string, len(urls))
+	reachable := 0
+	for _, peer := range urls {
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+			_, err := s.peers.Do(ctx, peer, http.MethodGet, "/healthz", nil, nil)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				statuses[peer] = err.Error()
+				return
+			}
+			statuses[peer] = "ok"
+			reachable++
+		}(peer)
+	}
+	wg.Wait()
+
+	details := map[string]interface{}{
+		"reachable": reachable,
+		"required":  required,
+		"peers":     statuses,
+	}
+	if reachable < required {
+		return checkFailed(errors.New("quorum of peers not reachable"), details)
+	}
+	return checkOK(details)
+}
+
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":            "ok",
+		"lamport_timestamp": s.clock.GetTime(),
+	})
+}
+
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	checks := map[string]CheckResult{
+		"event_store": s.checkEventStore(ctx),
+	}
+	if len(s.peers.URLs()) > 0 {
+		checks["peers"] = s.checkPeers(ctx)
+	}
+
+	status := "ready"
+	code := http.StatusOK
+	for _, c := range checks {
+		if c.Status != "ok" {
+			status = "not_ready"
+			code = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": status,
+		"checks": checks,
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type readiness struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+func getReadyz(t *testing.T, server *Server) (int, readiness) {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/readyz", nil)
+	w := httptest.NewRecorder()
+	server.handleReadyz(w, req)
+
+	var body readiness
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return w.Code, body
+}
+
+func TestHealthz(t *testing.T) {
+	server := NewServer()
+	req := httptest.NewRequest("GET", "/healthz", nil)
+	w := httptest.NewRecorder()
+	server.handleHealthz(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status OK, got %d", w.Code)
+	}
+}
+
+func TestReadyzStandalone(t *testing.T) {
+	server := NewServer()
+
+	code, body := getReadyz(t, server)
+	if code != http.StatusOK || body.Status != "ready" {
+		t.Errorf("Expected standalone server to be ready, got %d %s", code, body.Status)
+	}
+	if body.Checks["event_store"].Status != "ok" {
+		t.Errorf("Expected event store check to pass, got %+v", body.Checks["event_store"])
+	}
+	if _, ok := body.Checks["peers"]; ok {
+		t.Error("Expected no peers check without configured peers")
+	}
+}
+
+func TestReadyzBlockedEventStore(t *testing.T) {
+	server := NewServer()
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	code, body := getReadyz(t, server)
+	if code != http.StatusServiceUnavailable || body.Checks["event_store"].Status != "failed" {
+		t.Errorf("Expected wedged store to fail readiness, got %d %+v", code, body.Checks)
+	}
+}
+
+func TestReadyzPeerQuorum(t *testing.T) {
+	healthy := NewServer()
+	up := httptest.NewServer(http.HandlerFunc(healthy.handleHealthz))
+	defer up.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	defer down.Close()
+
+	// Three peers: a cluster of four needs two reachable peers
+	server := NewServer()
+	server.peers = NewPeers([]string{up.URL, down.URL, down.URL + "/x"}, http.DefaultClient)
+
+	code, body := getReadyz(t, server)
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status ServiceUnavailable without quorum, got %d", code)
+	}
+	peers := body.Checks["peers"]
+	if peers.Details["reachable"] != float64(1) || peers.Details["required"] != float64(2) {
+		t.Errorf("Expected 1 of 2 required peers reachable, got %+v", peers.Details)
+	}
+
+	// With two peers one healthy peer plus this node is a majority
+	server.peers = NewPeers([]string{up.URL, down.URL}, http.DefaultClient)
+	if code, body := getReadyz(t, server); code != http.StatusOK {
+		t.Errorf("Expected quorum with 1 of 2 peers, got %d %+v", code, body.Checks["peers"])
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/hooks"
+)
+
+// ticked and updated notify the hooks of a clock. Times are only converted
+// to wire types when a hook is registered, so the hot path stays free of
+// allocations.
+func (lc *LamportClock) ticked(now ClockTime) {
+	if lc.hooks.Enabled() {
+		lc.hooks.Tick(now.wire())
+	}
+}
+
+func (lc *LamportClock) updated(received, now ClockTime) {
+	if lc.hooks.Enabled() {
+		lc.hooks.Update(received.wire(), now.wire())
+	}
+}
+
+// RegisterHook registers a hook on the main clock and the event log and
+// returns a function removing it again
+func (s *Server) RegisterHook(h hooks.Hook) (unregister func()) {
+	return s.hooks.Register(h)
+}
+
+// loadHooks registers the hooks exported by Go plugins
+func (s *Server) loadHooks(paths []string) error {
+	for _, path := range paths {
+		h, err := hooks.Load(path)
+		if err != nil {
+			return fmt.Errorf("loading hook plugin: %w", err)
+		}
+		s.RegisterHook(h)
+		s.logger.Info("Hook plugin loaded", "path", path)
+	}
+	return nil
+}
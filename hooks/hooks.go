@@ -0,0 +1,156 @@
+// Package hooks lets external code react to the activity of a Lamport
+// clock server without forking it: every tick, every merged timestamp and
+// every event added to the log.
+//
+// Hooks are registered on a Registry, either in code or by loading a Go
+// plugin that exports a Hook variable (see Load). They only depend on the
+// wire types of the codec package, so plugins do not import the server.
+package hooks
+
+import (
+	"fmt"
+	"plugin"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec"
+)
+
+// Hook is notified of clock activity. Hooks are called synchronously after
+// the change and outside of any lock, so they must return quickly: hooks
+// forwarding to slow systems should queue the work and do it elsewhere.
+type Hook interface {
+	// OnTick is called after a local event advanced the clock to now
+	OnTick(now codec.Timestamp)
+	// OnUpdate is called after a received timestamp was merged into the clock
+	OnUpdate(received, now codec.Timestamp)
+	// OnEvent is called after an event was added to the log
+	OnEvent(e codec.Event)
+}
+
+// Funcs is a Hook built from functions. Nil functions are skipped.
+type Funcs struct {
+	Tick   func(now codec.Timestamp)
+	Update func(received, now codec.Timestamp)
+	Event  func(e codec.Event)
+}
+
+func (f Funcs) OnTick(now codec.Timestamp) {
+	if f.Tick != nil {
+		f.Tick(now)
+	}
+}
+
+func (f Funcs) OnUpdate(received, now codec.Timestamp) {
+	if f.Update != nil {
+		f.Update(received, now)
+	}
+}
+
+func (f Funcs) OnEvent(e codec.Event) {
+	if f.Event != nil {
+		f.Event(e)
+	}
+}
+
+// Registry holds the registered hooks. Notifying reads the list without
+// locking, so checking for hooks is cheap on hot paths. A nil Registry has
+// no hooks.
+type Registry struct {
+	hooks atomic.Pointer[[]*entry]
+	mutex sync.Mutex // serializes registration
+}
+
+// entry gives every registration an identity, since hooks themselves need
+// not be comparable
+type entry struct {
+	hook Hook
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a hook and returns a function removing it again
+func (r *Registry) Register(h Hook) (unregister func()) {
+	e := &entry{hook: h}
+	r.mutex.Lock()
+	list := append(slices.Clone(r.list()), e)
+	r.hooks.Store(&list)
+	r.mutex.Unlock()
+
+	return func() {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		list := slices.DeleteFunc(slices.Clone(r.list()), func(other *entry) bool {
+			return other == e
+		})
+		r.hooks.Store(&list)
+	}
+}
+
+func (r *Registry) list() []*entry {
+	if r == nil {
+		return nil
+	}
+	if list := r.hooks.Load(); list != nil {
+		return *list
+	}
+	return nil
+}
+
+// Enabled reports whether any hook is registered, so callers can skip
+// preparing notifications nobody receives
+func (r *Registry) Enabled() bool {
+	return len(r.list()) > 0
+}
+
+// Tick notifies the hooks of a tick
+func (r *Registry) Tick(now codec.Timestamp) {
+	for _, e := range r.list() {
+		e.hook.OnTick(now)
+	}
+}
+
+// Update notifies the hooks of a merged timestamp
+func (r *Registry) Update(received, now codec.Timestamp) {
+	for _, e := range r.list() {
+		e.hook.OnUpdate(received, now)
+	}
+}
+
+// Event notifies the hooks of a new event
+func (r *Registry) Event(event codec.Event) {
+	for _, e := range r.list() {
+		e.hook.OnEvent(event)
+	}
+}
+
+// Load opens a Go plugin and returns the Hook it exports as the variable
+// Hook. The plugin must be built with -buildmode=plugin against the same
+// version of this module as the server:
+//
+//	package main
+//
+//	var Hook hooks.Hook = hooks.Funcs{Event: func(e codec.Event) { forward(e) }}
+func Load(path string) (Hook, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup("Hook")
+	if err != nil {
+		return nil, err
+	}
+	switch h := sym.(type) {
+	case *Hook:
+		if *h != nil {
+			return *h, nil
+		}
+	case Hook:
+		return h, nil
+	}
+	return nil, fmt.Errorf("plugin %s: Hook is %T, expected a non-nil hooks.Hook", path, sym)
+}
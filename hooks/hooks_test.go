@@ -0,0 +1,48 @@
+package hooks
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	if r.Enabled() {
+		t.Errorf("Expected an empty registry to be disabled")
+	}
+
+	var ticks, events []int64
+	removeTicks := r.Register(Funcs{Tick: func(now codec.Timestamp) { ticks = append(ticks, now.Timestamp) }})
+	r.Register(Funcs{Event: func(e codec.Event) { events = append(events, e.Timestamp) }})
+
+	r.Tick(codec.Timestamp{Timestamp: 1})
+	r.Update(codec.Timestamp{Timestamp: 5}, codec.Timestamp{Timestamp: 6}) // nobody listens
+	r.Event(codec.Event{Timestamp: 1})
+	removeTicks()
+	removeTicks()
+	r.Tick(codec.Timestamp{Timestamp: 2})
+
+	if len(ticks) != 1 || ticks[0] != 1 {
+		t.Errorf("Expected one tick before unregistering, got %v", ticks)
+	}
+	if len(events) != 1 || !r.Enabled() {
+		t.Errorf("Expected the event hook to stay registered, got %v", events)
+	}
+}
+
+func TestNilRegistry(t *testing.T) {
+	var r *Registry
+	if r.Enabled() {
+		t.Errorf("Expected a nil registry to be disabled")
+	}
+	r.Tick(codec.Timestamp{})
+	r.Event(codec.Event{})
+}
+
+func TestLoadMissingPlugin(t *testing.T) {
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.so")); err == nil {
+		t.Errorf("Expected an error for a missing plugin")
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec"
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/hooks"
+)
+
+// recordingHook collects everything it is notified of
+type recordingHook struct {
+	ticks   []codec.Timestamp
+	updates [][2]codec.Timestamp
+	events  []codec.Event
+}
+
+func (h *recordingHook) OnTick(now codec.Timestamp) {
+	h.ticks = append(h.ticks, now)
+}
+
+func (h *recordingHook) OnUpdate(received, now codec.Timestamp) {
+	h.updates = append(h.updates, [2]codec.Timestamp{received, now})
+}
+
+func (h *recordingHook) OnEvent(e codec.Event) {
+	h.events = append(h.events, e)
+}
+
+func TestServerHooks(t *testing.T) {
+	server := NewServer()
+	hook := &recordingHook{}
+	unregister := server.RegisterHook(hook)
+
+	server.logEvent("e1", "Local")
+	if _, err := server.receiveMessage(context.Background(), "b", "", ClockTime{Timestamp: 10}, "hello"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(hook.ticks) != 1 || hook.ticks[0].Timestamp != 1 {
+		t.Errorf("Expected a tick at 1, got %v", hook.ticks)
+	}
+	if len(hook.updates) != 1 || hook.updates[0][0].Timestamp != 10 || hook.updates[0][1].Timestamp != 11 {
+		t.Errorf("Expected an update from 10 to 11, got %v", hook.updates)
+	}
+	if len(hook.events) != 2 || hook.events[0].ID != "e1" || hook.events[1].Hash == "" {
+		t.Errorf("Expected both events as stored, got %+v", hook.events)
+	}
+
+	// Rejected jumps change nothing and are not reported
+	server.clock.SetJumpGuard(JumpGuard{MaxJump: 5})
+	server.clock.UpdateChecked(ClockTime{Timestamp: 1000})
+	unregister()
+	server.logEvent("e2", "Unhooked")
+	if len(hook.updates) != 1 || len(hook.ticks) != 1 || len(hook.events) != 2 {
+		t.Errorf("Expected no further notifications, got %d ticks, %d updates, %d events", len(hook.ticks), len(hook.updates), len(hook.events))
+	}
+}
+
+func TestHooksOnlyWatchMainClock(t *testing.T) {
+	server := NewServer()
+	hook := &recordingHook{}
+	server.RegisterHook(hooks.Funcs{Tick: hook.OnTick})
+
+	vc, err := server.clocks.Get("virtual", true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	vc.clock.Tick()
+	if len(hook.ticks) != 0 {
+		t.Errorf("Expected virtual clocks not to notify hooks, got %v", hook.ticks)
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// LegacyRecord is an entry of a legacy dataset that only carries wall time.
+// Records exported by a signing node may carry the Lamport time and
+// signature of the original event, which are verified on import.
+type LegacyRecord struct {
+	ID       string    `json:"id"`
+	Message  string    `json:"message"`
+	WallTime time.Time `json:"wall_time"`
+
+	Timestamp int64  `json:"lamport_timestamp,omitempty"`
+	Epoch     int64  `json:"epoch,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	KeyID     string `json:"key_id,omitempty"`
+
+	invalid bool // signature flagged under the flag policy
+}
+
+// correlationPoint maps a wall-clock instant to the Lamport time reached by then
+type correlationPoint struct {
+	wallTime time.Time
+	time     ClockTime
+}
+
+// wallCorrelation relates wall time to Lamport time using the recorded history
+type wallCorrelation []correlationPoint
+
+// newWallCorrelation builds the correlation table from a list of events.
+// Times are turned into a running maximum so the table is monotonic even if
+// some events were appended slightly out of wall-clock order.
+func newWallCorrelation(events []Event) wallCorrelation {
+	table := make(wallCorrelation, 0, len(events))
+	for _, e := range events {
+		table = append(table, correlationPoint{wallTime: e.WallTime, time: ClockTime{Epoch: e.Epoch, Timestamp: e.Timestamp}})
+	}
+	sort.SliceStable(table, func(i, j int) bool {
+		return table[i].wallTime.Before(table[j].wallTime)
+	})
+
+	var highest ClockTime
+	for i := range table {
+		if highest.Before(table[i].time) {
+			highest = table[i].time
+		}
+		table[i].time = highest
+	}
+	return table
+}
+
+// gapAt returns the Lamport time reached at the given wall time and the
+// next time of the history, which the timestamps of events at that wall
+// time must stay below. Before all history nothing was reached yet. ok is
+// false past all history, where the gap is only bounded by the live clock.
+func (wc wallCorrelation) gapAt(wallTime time.Time) (reached, next ClockTime, ok bool) {
+	// First point strictly after wallTime
+	i := sort.Search(len(wc), func(i int) bool {
+		return wc[i].wallTime.After(wallTime)
+	})
+	if i > 0 {
+		reached = wc[i-1].time
+	}
+	if i == len(wc) {
+		return reached, ClockTime{}, false
+	}
+	return reached, wc[i].time, true
+}
+
+// preHistoryEpoch returns the epoch records older than all of the events
+// are stamped in: the one before the earliest epoch of the events, which
+// the clock has never been in. It may be negative.
+func preHistoryEpoch(events []Event) int64 {
+	epoch := events[0].Epoch
+	for _, e := range events[1:] {
+		epoch = min(epoch, e.Epoch)
+	}
+	return epoch - 1
+}
+
+// importLegacy assigns Lamport timestamps to legacy records based on their
+// wall time and merges them into the event log in wall-clock order. Each
+// record gets a timestamp of its own: the next free one after the time the
+// system had reached at its wall time, within the same epoch, as long as
+// that stays below the next event of the history. Records older than all
+// history are stamped from 1 in an epoch of their own, before the history.
+// Records past all history, and those whose gap has no free timestamp
+// left, are stamped with ticks of the clock instead, as are the records
+// after them, so they come after every existing event and imports keep
+// their wall-clock order. Those are refused while the clock is frozen.
+// Nothing is imported, and the ticks are given back, when the store fails
+// to write the merged log.
+func (s *Server) importLegacy(records []LegacyRecord) ([]Event, error) {
+	sorted := make([]LegacyRecord, len(records))
+	copy(sorted, records)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].WallTime.Before(sorted[j].WallTime)
+	})
+
+	s.mutex.Lock()
+	existing := s.events.Events()
+	table := newWallCorrelation(existing)
+
+	// Records before preHistory are older than all history, those from
+	// interleaved on are stamped with ticks
+	stamps := make([]ClockTime, len(sorted))
+	preHistory := 0
+	if len(table) > 0 {
+		epoch := preHistoryEpoch(existing)
+		for preHistory < len(sorted) && sorted[preHistory].WallTime.Before(table[0].wallTime) {
+			stamps[preHistory] = ClockTime{Epoch: epoch, Timestamp: int64(preHistory) + 1}
+			preHistory++
+		}
+	}
+	interleaved := len(sorted)
+	var last ClockTime
+	for i := preHistory; i < len(sorted); i++ {
+		reached, next, ok := table.gapAt(sorted[i].WallTime)
+		if reached.Before(last) {
+			reached = last
+		}
+		stamp := ClockTime{Epoch: reached.Epoch, Timestamp: reached.Timestamp + 1}
+		if !ok || reached.Timestamp == math.MaxInt64 || !stamp.Before(next) {
+			interleaved = i
+			break
+		}
+		stamps[i], last = stamp, stamp
+	}
+	ticked := len(sorted) - interleaved
+	var first ClockTime
+	if ticked > 0 {
+		var err error
+		if first, err = s.clock.tickN(ticked, ClockSource{}); err != nil {
+			s.mutex.Unlock()
+			return nil, err
+		}
+		for i := range ticked {
+			stamps[interleaved+i] = ClockTime{Epoch: first.Epoch, Timestamp: first.Timestamp + int64(i)}
+		}
+	}
+
+	imported := make([]Event, len(sorted))
+	for i, rec := range sorted {
+		id := rec.ID
+		if id == "" {
+			id = fmt.Sprintf("import-%d-%d", rec.WallTime.UnixNano(), i)
+		}
+		imported[i] = s.sign(s.pii.Redact(Event{
+			ID:         id,
+			Message:    rec.Message,
+			Timestamp:  stamps[i].Timestamp,
+			Epoch:      stamps[i].Epoch,
+			WallTime:   rec.WallTime,
+			Backfilled: true,
+
+			InvalidSignature: rec.invalid,
+		}))
+	}
+
+	// Stable merge by wall time; existing events keep their relative order
+	// and ticked records follow all of them
+	merged := make([]Event, 0, len(existing)+len(imported))
+	positions := make([]int, 0, len(imported))
+	for _, e := range existing {
+		for len(positions) < interleaved && imported[len(positions)].WallTime.Before(e.WallTime) {
+			positions = append(positions, len(merged))
+			merged = append(merged, imported[len(positions)-1])
+		}
+		merged = append(merged, e)
+	}
+	for len(positions) < len(imported) {
+		positions = append(positions, len(merged))
+		merged = append(merged, imported[len(positions)-1])
+	}
+	// The hash chain is rebuilt from the earliest imported event on
+	if len(positions) > 0 {
+		if err := s.rechainLocked(merged, positions[0]); err != nil {
+			if ticked > 0 {
+				s.clock.untickN(first, ticked)
+			}
+			s.mutex.Unlock()
+			return nil, err
+		}
+	}
+	merged = s.events.Events()
+	for i, p := range positions {
+		imported[i] = merged[p]
+		s.observeLocked(imported[i])
+	}
+	s.mutex.Unlock()
+	s.logged.Notify()
+
+	for _, e := range imported {
+		s.broker.Publish(e)
+	}
+
+	s.logger.Info("Legacy events imported", "count", len(imported), "ticked", ticked, "pre_history", preHistory)
+	return imported, nil
+}
+
+func (s *Server) handleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var records []LegacyRecord
+	if err := json.NewDecoder(r.Body).Decode(&records); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	for i, rec := range records {
+		if rec.WallTime.IsZero() {
+			http.Error(w, fmt.Sprintf("Record %d is missing wall_time", i), http.StatusBadRequest)
+			return
+		}
+		at := ClockTime{Epoch: rec.Epoch, Timestamp: rec.Timestamp}
+		ctx, err := s.checkSignature(r.Context(), "import", rec.KeyID, rec.Signature, rec.ID, at, rec.Message)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Record %d: %v", i, err), http.StatusUnprocessableEntity)
+			return
+		}
+		records[i].invalid = invalidSignatureFrom(ctx)
+	}
+
+	imported, err := s.importLegacy(records)
+	switch {
+	case errors.Is(err, errClockFrozen):
+		http.Error(w, "Clock is frozen, import after it resumes", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf("Events not imported: %v", err), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"imported": len(imported),
+		"events":   imported,
+	})
+}
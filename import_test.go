@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWallCorrelationGapAt(t *testing.T) {
+	base := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	table := newWallCorrelation([]Event{
+		{Timestamp: 1, WallTime: base},
+		{Timestamp: 5, WallTime: base.Add(2 * time.Minute)},
+		{Timestamp: 3, WallTime: base.Add(3 * time.Minute)}, // out of order, running max keeps 5
+		{Timestamp: 9, WallTime: base.Add(5 * time.Minute)},
+		{Epoch: 1, Timestamp: 2, WallTime: base.Add(6 * time.Minute)},
+	})
+
+	cases := []struct {
+		wall          time.Time
+		reached, next ClockTime
+		bounded       bool
+	}{
+		{base.Add(-time.Minute), ClockTime{}, ClockTime{Timestamp: 1}, true},
+		{base, ClockTime{Timestamp: 1}, ClockTime{Timestamp: 5}, true},
+		{base.Add(time.Minute), ClockTime{Timestamp: 1}, ClockTime{Timestamp: 5}, true},
+		{base.Add(3 * time.Minute), ClockTime{Timestamp: 5}, ClockTime{Timestamp: 9}, true},
+		{base.Add(5 * time.Minute), ClockTime{Timestamp: 9}, ClockTime{Epoch: 1, Timestamp: 2}, true},
+		{base.Add(time.Hour), ClockTime{Epoch: 1, Timestamp: 2}, ClockTime{}, false},
+	}
+
+	for _, c := range cases {
+		reached, next, bounded := table.gapAt(c.wall)
+		if reached != c.reached || next != c.next || bounded != c.bounded {
+			t.Errorf("gapAt(%s): expected %v to %v (%v), got %v to %v (%v)", c.wall.Format(time.TimeOnly), c.reached, c.next, c.bounded, reached, next, bounded)
+		}
+	}
+}
+
+// checkImported checks the log holds the events of ids, in order, stamped
+// with timestamps
+func checkImported(t *testing.T, server *Server, ids []string, timestamps []int64) {
+	t.Helper()
+	events := server.events.Events()
+	if len(events) != len(ids) {
+		t.Fatalf("Expected %d events in log, got %d", len(ids), len(events))
+	}
+	for i, e := range events {
+		if e.ID != ids[i] || e.Timestamp != timestamps[i] {
+			t.Errorf("Position %d: expected %s at %d, got %s at %d", i, ids[i], timestamps[i], e.ID, e.Timestamp)
+		}
+	}
+}
+
+func TestImportLegacyInterleaves(t *testing.T) {
+	server := NewServer()
+	base := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	server.events.Replace([]Event{
+		{ID: "a", Timestamp: 10, WallTime: base},
+		{ID: "b", Timestamp: 20, WallTime: base.Add(10 * time.Minute)},
+	})
+	server.clock.Update(19) // clock at 20
+
+	imported, err := server.importLegacy([]LegacyRecord{
+		{ID: "late", Message: "after b", WallTime: base.Add(20 * time.Minute)},
+		{ID: "early", Message: "before a", WallTime: base.Add(-time.Minute)},
+		{ID: "mid-2", Message: "between a and b", WallTime: base.Add(6 * time.Minute)},
+		{ID: "mid-1", Message: "between a and b", WallTime: base.Add(5 * time.Minute)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(imported) != 4 {
+		t.Fatalf("Expected 4 imported events, got %d", len(imported))
+	}
+	for _, e := range imported {
+		if !e.Backfilled {
+			t.Errorf("Expected event %s to be marked backfilled", e.ID)
+		}
+	}
+
+	// Records take the free timestamps of their gap, one each, the one
+	// before all history the epoch before it and the one past all history a
+	// tick of the clock
+	checkImported(t, server, []string{"early", "a", "mid-1", "mid-2", "b", "late"}, []int64{1, 10, 11, 12, 20, 21})
+	if early := server.events.Events()[0]; early.Epoch != -1 {
+		t.Errorf("Expected early in epoch -1, got %d", early.Epoch)
+	}
+	if server.clock.GetTime() != 21 {
+		t.Errorf("Expected the clock at the tick of late, got %d", server.clock.GetTime())
+	}
+}
+
+func TestImportLegacyEpochs(t *testing.T) {
+	server := NewServer()
+	base := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	server.events.Replace([]Event{
+		{ID: "a", Epoch: 2, Timestamp: 1, WallTime: base},
+		{ID: "b", Epoch: 3, Timestamp: 1, WallTime: base.Add(10 * time.Minute)},
+	})
+	server.clock.UpdateTime(ClockTime{Epoch: 3, Timestamp: 1})
+
+	imported, err := server.importLegacy([]LegacyRecord{
+		{ID: "early", WallTime: base.Add(-time.Minute)},
+		{ID: "mid", WallTime: base.Add(5 * time.Minute)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each record is stamped in the epoch reached at its wall time, and
+	// records before all history in the epoch before it
+	if imported[0].Epoch != 1 || imported[0].Timestamp != 1 || imported[1].Epoch != 2 || imported[1].Timestamp != 2 {
+		t.Errorf("Expected early at 1 of epoch 1 and mid at 2 of epoch 2, got %+v", imported)
+	}
+}
+
+func TestImportLegacyWithoutRoom(t *testing.T) {
+	server := NewServer()
+	base := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	server.events.Replace([]Event{
+		{ID: "a", Timestamp: 1, WallTime: base},
+		{ID: "b", Timestamp: 2, WallTime: base.Add(10 * time.Minute)},
+		{ID: "c", Timestamp: 4, WallTime: base.Add(20 * time.Minute)},
+	})
+	server.clock.Update(3) // clock at 4
+	records := []LegacyRecord{
+		{ID: "mid", WallTime: base.Add(15 * time.Minute)},
+		{ID: "early", WallTime: base.Add(5 * time.Minute)},
+		{ID: "mid-2", WallTime: base.Add(16 * time.Minute)},
+	}
+
+	// A frozen clock has no ticks to give
+	server.clock.Freeze()
+	if _, err := server.importLegacy(records); !errors.Is(err, errClockFrozen) || len(server.events.Events()) != 3 {
+		t.Errorf("Expected the import refused while frozen, got %v", err)
+	}
+	server.clock.Resume()
+
+	if _, err := server.importLegacy(records); err != nil {
+		t.Fatal(err)
+	}
+	// a and b leave no timestamp between them, so early and the records
+	// after it are stamped with ticks, after all history, rather than tie
+	checkImported(t, server, []string{"a", "b", "c", "early", "mid", "mid-2"}, []int64{1, 2, 4, 5, 6, 7})
+}
+
+func TestImportLegacyBeforeHistory(t *testing.T) {
+	server := NewServer()
+	server.logEvent("init", "Node started")
+	base := server.events.Events()[0].WallTime.Add(-time.Hour)
+	records := make([]LegacyRecord, 5)
+	for i := range records {
+		records[i] = LegacyRecord{ID: fmt.Sprintf("old-%d", i), WallTime: base.Add(time.Duration(i) * time.Minute)}
+	}
+
+	if _, err := server.importLegacy(records); err != nil {
+		t.Fatal(err)
+	}
+	// The whole legacy log fits before the first event, in an epoch of its
+	// own, and the clock is left alone
+	checkImported(t, server, []string{"old-0", "old-1", "old-2", "old-3", "old-4", "init"}, []int64{1, 2, 3, 4, 5, 1})
+	for _, e := range server.events.Events()[:5] {
+		if e.Epoch != -1 {
+			t.Errorf("Expected %s in epoch -1, got %d", e.ID, e.Epoch)
+		}
+	}
+	if now := server.clock.Now(); now != (ClockTime{Timestamp: 1}) {
+		t.Errorf("Expected the clock at 1, got %v", now)
+	}
+
+	// Records older still go into the epoch before
+	if _, err := server.importLegacy([]LegacyRecord{{ID: "older", WallTime: base.Add(-time.Hour)}}); err != nil {
+		t.Fatal(err)
+	}
+	if first := server.events.Events()[0]; first.ID != "older" || first.Epoch != -2 || first.Timestamp != 1 {
+		t.Errorf("Expected older at 1 of epoch -2, got %s at %d of %d", first.ID, first.Timestamp, first.Epoch)
+	}
+}
+
+func TestImportLegacyRefusedByStore(t *testing.T) {
+	server := NewServer()
+	st := openTestWALStore(t, filepath.Join(t.TempDir(), "events.wal"))
+	server.events = st
+	server.logEvent("live", "Live event")
+	crashAfter(st, 0)
+
+	late := []LegacyRecord{{ID: "late", WallTime: time.Now().Add(time.Hour)}}
+	if _, err := server.importLegacy(late); err == nil {
+		t.Fatal("Expected the failed write refused")
+	}
+	// The tick taken for the record is given back
+	if now := server.clock.Now(); now != (ClockTime{Timestamp: 1}) {
+		t.Errorf("Expected the clock back at 1, got %v", now)
+	}
+	if got := len(server.events.Events()); got != 1 {
+		t.Errorf("Expected nothing imported, got %d events", got)
+	}
+}
+
+func TestImportHandler(t *testing.T) {
+	server := NewServer()
+	server.logEvent("live", "Live event")
+
+	body := `[{"id":"legacy-1","message":"old audit entry","wall_time":"2020-05-01T12:00:00Z"}]`
+	req := httptest.NewRequest("POST", "/admin/import", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	server.handleImport(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d", w.Code)
+	}
+
+	var response struct {
+		Imported int     `json:"imported"`
+		Events   []Event `json:"events"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Imported != 1 || len(response.Events) != 1 {
+		t.Fatalf("Expected 1 imported event, got %d", response.Imported)
+	}
+	if got := response.Events[0]; got.Epoch != -1 || got.Timestamp != 1 {
+		t.Errorf("Expected legacy event older than history at 1 of epoch -1, got %d of %d", got.Timestamp, got.Epoch)
+	}
+	if server.events.Events()[0].ID != "legacy-1" {
+		t.Errorf("Expected legacy event to be placed first, got %s", server.events.Events()[0].ID)
+	}
+
+	// Missing wall time is rejected
+	req2 := httptest.NewRequest("POST", "/admin/import", strings.NewReader(`[{"message":"no time"}]`))
+	w2 := httptest.NewRecorder()
+	server.handleImport(w2, req2)
+	if w2.Code != http.StatusBadRequest {
+		t.Errorf("Expected status BadRequest for missing wall_time, got %d", w2.Code)
+	}
+
+	// Wrong method
+	req3 := httptest.NewRequest("GET", "/admin/import", nil)
+	w3 := httptest.NewRecorder()
+	server.handleImport(w3, req3)
+	if w3.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status MethodNotAllowed, got %d", w3.Code)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ingestRetryAfter is the Retry-After of requests turned away by a full
+// ingestion queue, in seconds
+const ingestRetryAfter = 1
+
+// ingestJob is a request waiting for an ingestion worker
+type ingestJob struct {
+	w        http.ResponseWriter
+	r        *http.Request
+	handler  http.HandlerFunc
+	enqueued time.Time
+	done     chan struct{}
+}
+
+// Ingest puts a bounded queue between the handlers that append events and
+// the store, worked off by a fixed number of workers. When the queue is
+// full, requests are turned away with 503 and Retry-After rather than
+// piling up, and requests that waited in the queue longer than timeout are
+// turned away when their turn comes, so latency stays bounded under
+// overload.
+type Ingest struct {
+	queue   chan *ingestJob
+	workers int
+	timeout time.Duration
+	metrics *Metrics
+	stopped chan struct{} // closed once Run returned
+}
+
+// NewIngest creates a pipeline queueing up to size requests for workers
+func NewIngest(size, workers int, timeout time.Duration, metrics *Metrics) *Ingest {
+	in := &Ingest{
+		queue:   make(chan *ingestJob, size),
+		workers: workers,
+		timeout: timeout,
+		metrics: metrics,
+		stopped: make(chan struct{}),
+	}
+	metrics.Counter("lamport_ingest_rejected_total", "Ingestion requests turned away by a full or slow queue")
+	metrics.GaugeFunc("lamport_ingest_queue_depth", "Ingestion requests waiting for a worker", func() float64 {
+		return float64(len(in.queue))
+	})
+	metrics.GaugeFunc("lamport_ingest_queue_capacity", "Ingestion requests the queue holds", func() float64 {
+		return float64(cap(in.queue))
+	})
+	return in
+}
+
+// Run works off the queue until ctx is done. Requests still queued then,
+// or queued later, are turned away.
+func (in *Ingest) Run(ctx context.Context) {
+	defer close(in.stopped)
+	var wg sync.WaitGroup
+	for range in.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-in.queue:
+					in.process(job)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for {
+		select {
+		case job := <-in.queue:
+			in.reject(job.w, "Server shutting down")
+			close(job.done)
+		default:
+			return
+		}
+	}
+}
+
+// process runs a queued request unless its client gave up or it waited
+// too long
+func (in *Ingest) process(job *ingestJob) {
+	defer close(job.done)
+	if job.r.Context().Err() != nil {
+		return
+	}
+	if waited := time.Since(job.enqueued); waited > in.timeout {
+		in.reject(job.w, fmt.Sprintf("Ingestion queue wait exceeded %s", in.timeout))
+		return
+	}
+	job.handler(job.w, job.r)
+}
+
+func (in *Ingest) reject(w http.ResponseWriter, reason string) {
+	in.metrics.Inc("lamport_ingest_rejected_total")
+	w.Header().Set("Retry-After", strconv.Itoa(ingestRetryAfter))
+	http.Error(w, reason, http.StatusServiceUnavailable)
+}
+
+// Admit queues the state-changing requests of a handler. Reads bypass the
+// queue.
+func (in *Ingest) Admit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next(w, r)
+			return
+		}
+		job := &ingestJob{w: w, r: r, handler: next, enqueued: time.Now(), done: make(chan struct{})}
+		select {
+		case in.queue <- job:
+		default:
+			in.reject(w, "Ingestion queue full, retry later")
+			return
+		}
+		// The response is written by the worker, which owns w until done
+		select {
+		case <-job.done:
+		case <-in.stopped:
+			select {
+			case <-job.done:
+			default:
+				in.reject(w, "Server shutting down")
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIngestTurnsAwayWhenFull(t *testing.T) {
+	metrics := NewMetrics()
+	in := NewIngest(1, 1, time.Minute, metrics)
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go in.Run(ctx)
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	handler := in.Admit(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	})
+	post := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, "/event", nil))
+		return w
+	}
+
+	// One request is worked on and one waits in the queue
+	var wg sync.WaitGroup
+	codes := make(chan int, 2)
+	wg.Add(1)
+	go func() { defer wg.Done(); codes <- post().Code }()
+	<-started
+	wg.Add(1)
+	go func() { defer wg.Done(); codes <- post().Code }()
+	for len(in.queue) != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	w := post()
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected 503 with Retry-After, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	var out strings.Builder
+	metrics.WriteText(&out)
+	if !strings.Contains(out.String(), "lamport_ingest_queue_depth 1") || !strings.Contains(out.String(), "lamport_ingest_rejected_total 1") {
+		t.Errorf("Expected the queue depth and the rejection exported, got:\n%s", out.String())
+	}
+
+	close(release)
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusCreated {
+			t.Errorf("Expected the admitted requests handled, got %d", code)
+		}
+	}
+}
+
+func TestIngestTurnsAwayStaleRequests(t *testing.T) {
+	in := NewIngest(4, 1, time.Millisecond, NewMetrics())
+	handled := false
+	handler := in.Admit(func(w http.ResponseWriter, r *http.Request) { handled = true })
+
+	// Queued while no worker runs, the request is stale by its turn
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler(w, httptest.NewRequest(http.MethodPost, "/message", nil))
+	}()
+	for len(in.queue) != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(5 * time.Millisecond)
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go in.Run(ctx)
+	<-done
+	if handled || w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected a stale request turned away, got %d handled=%v", w.Code, handled)
+	}
+}
+
+func TestIngestReadsBypassQueue(t *testing.T) {
+	in := NewIngest(1, 1, time.Second, NewMetrics())
+	handler := in.Admit(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) })
+	// No worker runs, yet reads are served
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/event", nil))
+	if w.Code != http.StatusTeapot {
+		t.Errorf("Expected the read served directly, got %d", w.Code)
+	}
+}
+
+func TestIngestShutdownTurnsAwayQueued(t *testing.T) {
+	in := NewIngest(4, 1, time.Minute, NewMetrics())
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	in.Run(ctx)
+
+	w := httptest.NewRecorder()
+	in.Admit(func(w http.ResponseWriter, r *http.Request) {})(w, httptest.NewRequest(http.MethodPost, "/event", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 after shutdown, got %d", w.Code)
+	}
+}
@@ -0,0 +1,455 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Interval Tree Clocks (Almeida, Baquero and Fonte, 2008) give each process
+// a share of the unit interval as its identity instead of a fixed entry.
+// Processes fork to hand part of their share to a newcomer and join to take
+// back the share of one that leaves, so stamps stay small however many
+// processes come and go.
+
+// itcGrowCost penalizes growing the event tree in depth over incrementing
+// an existing branch
+const itcGrowCost = 1000
+
+// maxITCDepth bounds the nesting of decoded trees
+const maxITCDepth = 128
+
+// ErrOverlappingIDs is returned when joining clocks that share part of
+// their identity, which means one of them was not forked from the other
+var ErrOverlappingIDs = errors.New("overlapping interval tree clock IDs")
+
+// itcID is a share of the interval: a leaf owns all (one) or none of its
+// range, a node splits it between its children
+type itcID struct {
+	one         bool
+	left, right *itcID
+}
+
+var (
+	itcZero = &itcID{}
+	itcOne  = &itcID{one: true}
+)
+
+func (i *itcID) isZero() bool { return i.left == nil && !i.one }
+func (i *itcID) isOne() bool  { return i.left == nil && i.one }
+
+// newITCID builds a normalized ID node
+func newITCID(left, right *itcID) *itcID {
+	switch {
+	case left.isZero() && right.isZero():
+		return itcZero
+	case left.isOne() && right.isOne():
+		return itcOne
+	}
+	return &itcID{left: left, right: right}
+}
+
+// splitID divides an ID into two disjoint halves
+func splitID(i *itcID) (*itcID, *itcID) {
+	switch {
+	case i.isZero():
+		return itcZero, itcZero
+	case i.isOne():
+		return newITCID(itcOne, itcZero), newITCID(itcZero, itcOne)
+	case i.left.isZero():
+		a, b := splitID(i.right)
+		return newITCID(itcZero, a), newITCID(itcZero, b)
+	case i.right.isZero():
+		a, b := splitID(i.left)
+		return newITCID(a, itcZero), newITCID(b, itcZero)
+	}
+	return newITCID(i.left, itcZero), newITCID(itcZero, i.right)
+}
+
+// sumID merges two disjoint IDs
+func sumID(a, b *itcID) (*itcID, error) {
+	switch {
+	case a.isZero():
+		return b, nil
+	case b.isZero():
+		return a, nil
+	case a.left == nil || b.left == nil:
+		return nil, ErrOverlappingIDs
+	}
+	left, err := sumID(a.left, b.left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := sumID(a.right, b.right)
+	if err != nil {
+		return nil, err
+	}
+	return newITCID(left, right), nil
+}
+
+// itcTree counts the events seen over the interval: a node adds n to the
+// counts of both its halves
+type itcTree struct {
+	n           uint64
+	left, right *itcTree
+}
+
+func itcLeaf(n uint64) *itcTree { return &itcTree{n: n} }
+
+func (e *itcTree) leaf() bool { return e.left == nil }
+
+func (e *itcTree) min() uint64 {
+	if e.leaf() {
+		return e.n
+	}
+	return e.n + min(e.left.min(), e.right.min())
+}
+
+func (e *itcTree) max() uint64 {
+	if e.leaf() {
+		return e.n
+	}
+	return e.n + max(e.left.max(), e.right.max())
+}
+
+// lift returns e with m added to its root
+func (e *itcTree) lift(m uint64) *itcTree {
+	return &itcTree{n: e.n + m, left: e.left, right: e.right}
+}
+
+func (e *itcTree) equal(other *itcTree) bool {
+	if e.n != other.n || e.leaf() != other.leaf() {
+		return false
+	}
+	return e.leaf() || e.left.equal(other.left) && e.right.equal(other.right)
+}
+
+// newITCTree builds a normalized tree node, pulling the common minimum of
+// the children up into the root
+func newITCTree(n uint64, left, right *itcTree) *itcTree {
+	if left.leaf() && right.leaf() && left.n == right.n {
+		return itcLeaf(n + left.n)
+	}
+	m := min(left.min(), right.min())
+	return &itcTree{
+		n:     n + m,
+		left:  &itcTree{n: left.n - m, left: left.left, right: left.right},
+		right: &itcTree{n: right.n - m, left: right.left, right: right.right},
+	}
+}
+
+// leqTree reports whether every count in a is at most the one in b
+func leqTree(a, b *itcTree) bool {
+	switch {
+	case a.n > b.n:
+		return false
+	case a.leaf():
+		return true
+	case b.leaf():
+		return leqTree(a.left.lift(a.n), b) && leqTree(a.right.lift(a.n), b)
+	}
+	return leqTree(a.left.lift(a.n), b.left.lift(b.n)) &&
+		leqTree(a.right.lift(a.n), b.right.lift(b.n))
+}
+
+// joinTree returns the pointwise maximum of two trees
+func joinTree(a, b *itcTree) *itcTree {
+	if a.leaf() && b.leaf() {
+		return itcLeaf(max(a.n, b.n))
+	}
+	if a.leaf() {
+		a = &itcTree{n: a.n, left: itcLeaf(0), right: itcLeaf(0)}
+	}
+	if b.leaf() {
+		b = &itcTree{n: b.n, left: itcLeaf(0), right: itcLeaf(0)}
+	}
+	if a.n > b.n {
+		a, b = b, a
+	}
+	d := b.n - a.n
+	return newITCTree(a.n, joinTree(a.left, b.left.lift(d)), joinTree(a.right, b.right.lift(d)))
+}
+
+// fillTree raises the parts of e owned by i as far as possible without
+// going above what the rest of the tree has already seen
+func fillTree(i *itcID, e *itcTree) *itcTree {
+	switch {
+	case i.isZero():
+		return e
+	case i.isOne():
+		return itcLeaf(e.max())
+	case e.leaf():
+		return e
+	case i.left.isOne():
+		right := fillTree(i.right, e.right)
+		return newITCTree(e.n, itcLeaf(max(e.left.max(), right.min())), right)
+	case i.right.isOne():
+		left := fillTree(i.left, e.left)
+		return newITCTree(e.n, left, itcLeaf(max(e.right.max(), left.min())))
+	}
+	return newITCTree(e.n, fillTree(i.left, e.left), fillTree(i.right, e.right))
+}
+
+// growTree increments e somewhere within i, preferring the change that
+// adds the fewest nodes. It returns the new tree and the cost.
+func growTree(i *itcID, e *itcTree) (*itcTree, uint64) {
+	if e.leaf() {
+		if i.isOne() {
+			return itcLeaf(e.n + 1), 0
+		}
+		grown, cost := growTree(i, &itcTree{n: e.n, left: itcLeaf(0), right: itcLeaf(0)})
+		return grown, cost + itcGrowCost
+	}
+	if i.isOne() {
+		return itcLeaf(e.max() + 1), 0
+	}
+	switch {
+	case i.left.isZero():
+		right, cost := growTree(i.right, e.right)
+		return newITCTree(e.n, e.left, right), cost + 1
+	case i.right.isZero():
+		left, cost := growTree(i.left, e.left)
+		return newITCTree(e.n, left, e.right), cost + 1
+	}
+	left, costLeft := growTree(i.left, e.left)
+	right, costRight := growTree(i.right, e.right)
+	if costLeft < costRight {
+		return newITCTree(e.n, left, e.right), costLeft + 1
+	}
+	return newITCTree(e.n, e.left, right), costRight + 1
+}
+
+// IntervalTreeClock is a logical clock for systems whose membership
+// changes. A new process obtains its clock by forking an existing one; a
+// process leaving is joined back into one that stays. Stamps of events
+// compare like vector times, detecting concurrency.
+type IntervalTreeClock struct {
+	id     *itcID
+	events *itcTree
+	mutex  sync.Mutex
+}
+
+// NewIntervalTreeClock creates the seed clock owning the whole interval.
+// Every other clock of the system must be forked from it.
+func NewIntervalTreeClock() *IntervalTreeClock {
+	return &IntervalTreeClock{id: itcOne, events: itcLeaf(0)}
+}
+
+// Fork gives half of the clock's identity to a new clock with the same
+// history
+func (c *IntervalTreeClock) Fork() *IntervalTreeClock {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var forked *itcID
+	c.id, forked = splitID(c.id)
+	return &IntervalTreeClock{id: forked, events: c.events}
+}
+
+// Join takes over the identity and history of other, which is left
+// anonymous and should be discarded
+func (c *IntervalTreeClock) Join(other *IntervalTreeClock) error {
+	if c == other {
+		return ErrOverlappingIDs
+	}
+	other.mutex.Lock()
+	defer other.mutex.Unlock()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	id, err := sumID(c.id, other.id)
+	if err != nil {
+		return err
+	}
+	c.id = id
+	c.events = joinTree(c.events, other.events)
+	other.id = itcZero
+	return nil
+}
+
+// eventLocked records an event. Anonymous clocks own no part of the
+// interval and cannot record events.
+func (c *IntervalTreeClock) eventLocked() {
+	if c.id.isZero() {
+		return
+	}
+	if filled := fillTree(c.id, c.events); !filled.equal(c.events) {
+		c.events = filled
+		return
+	}
+	c.events, _ = growTree(c.id, c.events)
+}
+
+// LocalEvent records an internal event
+func (c *IntervalTreeClock) LocalEvent() {
+	c.mutex.Lock()
+	c.eventLocked()
+	c.mutex.Unlock()
+}
+
+// Send records a send event and returns the event tree with an anonymous
+// ID, as the receiver only needs the history
+func (c *IntervalTreeClock) Send() []byte {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.eventLocked()
+	return appendITCTree(appendITCID(nil, itcZero), c.events)
+}
+
+// Receive merges the history carried by stamp and records the receive
+// event
+func (c *IntervalTreeClock) Receive(stamp []byte) error {
+	_, events, err := decodeITCStamp(stamp)
+	if err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	c.events = joinTree(c.events, events)
+	c.eventLocked()
+	c.mutex.Unlock()
+	return nil
+}
+
+// Compare relates two stamps by their histories
+func (c *IntervalTreeClock) Compare(a, b []byte) (Ordering, error) {
+	_, ea, err := decodeITCStamp(a)
+	if err != nil {
+		return "", fmt.Errorf("stamp a: %w", err)
+	}
+	_, eb, err := decodeITCStamp(b)
+	if err != nil {
+		return "", fmt.Errorf("stamp b: %w", err)
+	}
+	aBefore, bBefore := leqTree(ea, eb), leqTree(eb, ea)
+	switch {
+	case aBefore && bBefore:
+		return relationEqual, nil
+	case aBefore:
+		return relationBefore, nil
+	case bBefore:
+		return relationAfter, nil
+	}
+	return relationConcurrent, nil
+}
+
+// MarshalBinary encodes the clock's identity and history, for handing a
+// forked clock to the process that will own it. IDs are written in
+// preorder as 0 and 1 for leaves and 2 for nodes; trees as 0 and the count
+// for leaves and 1 and the count for nodes, with counts as varints.
+func (c *IntervalTreeClock) MarshalBinary() ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return appendITCTree(appendITCID(nil, c.id), c.events), nil
+}
+
+// UnmarshalBinary restores a clock encoded with MarshalBinary
+func (c *IntervalTreeClock) UnmarshalBinary(data []byte) error {
+	id, events, err := decodeITCStamp(data)
+	if err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	c.id, c.events = id, events
+	c.mutex.Unlock()
+	return nil
+}
+
+func appendITCID(b []byte, i *itcID) []byte {
+	switch {
+	case i.isZero():
+		return append(b, 0)
+	case i.isOne():
+		return append(b, 1)
+	}
+	return appendITCID(appendITCID(append(b, 2), i.left), i.right)
+}
+
+func appendITCTree(b []byte, e *itcTree) []byte {
+	if e.leaf() {
+		return binary.AppendUvarint(append(b, 0), e.n)
+	}
+	b = binary.AppendUvarint(append(b, 1), e.n)
+	return appendITCTree(appendITCTree(b, e.left), e.right)
+}
+
+// itcDecoder reads stamps, recording the first error
+type itcDecoder struct {
+	data []byte
+	err  error
+}
+
+func (d *itcDecoder) fail(format string, args ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: %s", ErrInvalidStamp, fmt.Sprintf(format, args...))
+	}
+}
+
+func (d *itcDecoder) byte() byte {
+	if d.err != nil || len(d.data) == 0 {
+		d.fail("truncated")
+		return 0
+	}
+	b := d.data[0]
+	d.data = d.data[1:]
+	return b
+}
+
+func (d *itcDecoder) id(depth int) *itcID {
+	if depth > maxITCDepth {
+		d.fail("ID nested too deep")
+		return itcZero
+	}
+	switch tag := d.byte(); tag {
+	case 0:
+		return itcZero
+	case 1:
+		return itcOne
+	case 2:
+		left := d.id(depth + 1)
+		return newITCID(left, d.id(depth+1))
+	default:
+		d.fail("bad ID tag %d", tag)
+		return itcZero
+	}
+}
+
+func (d *itcDecoder) tree(depth int) *itcTree {
+	if depth > maxITCDepth {
+		d.fail("tree nested too deep")
+		return itcLeaf(0)
+	}
+	tag := d.byte()
+	if d.err != nil {
+		return itcLeaf(0)
+	}
+	n, used := binary.Uvarint(d.data)
+	if used <= 0 {
+		d.fail("bad count")
+		return itcLeaf(0)
+	}
+	d.data = d.data[used:]
+	switch tag {
+	case 0:
+		return itcLeaf(n)
+	case 1:
+		left := d.tree(depth + 1)
+		right := d.tree(depth + 1)
+		if d.err != nil {
+			return itcLeaf(0)
+		}
+		return newITCTree(n, left, right)
+	default:
+		d.fail("bad tree tag %d", tag)
+		return itcLeaf(0)
+	}
+}
+
+func decodeITCStamp(data []byte) (*itcID, *itcTree, error) {
+	d := &itcDecoder{data: data}
+	id := d.id(0)
+	events := d.tree(0)
+	if d.err == nil && len(d.data) > 0 {
+		d.fail("%d trailing bytes", len(d.data))
+	}
+	return id, events, d.err
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"testing"
+)
+
+// itcSnapshot is the time of one event under both clocks
+type itcSnapshot struct {
+	itc, vector []byte
+}
+
+func TestITCMatchesVectorClocks(t *testing.T) {
+	type process struct {
+		itc    *IntervalTreeClock
+		vector *VectorClock
+	}
+	type message struct {
+		to          *process
+		itc, vector []byte
+	}
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	processes := []*process{{itc: NewIntervalTreeClock(), vector: NewVectorClock("p0")}}
+	var inFlight []message
+	var snapshots []itcSnapshot
+	created := 1
+
+	snapshot := func(p *process) {
+		itc, _ := p.itc.MarshalBinary()
+		vector, _ := p.vector.Now().MarshalBinary()
+		snapshots = append(snapshots, itcSnapshot{itc, vector})
+	}
+
+	for step := 0; step < 400; step++ {
+		p := processes[rng.IntN(len(processes))]
+		switch op := rng.IntN(10); {
+		case op < 3:
+			p.itc.LocalEvent()
+			p.vector.LocalEvent()
+			snapshot(p)
+
+		case op < 6:
+			to := processes[rng.IntN(len(processes))]
+			inFlight = append(inFlight, message{to: to, itc: p.itc.Send(), vector: p.vector.Send()})
+			snapshot(p)
+
+		case op < 8 && len(inFlight) > 0:
+			i := rng.IntN(len(inFlight))
+			m := inFlight[i]
+			inFlight = append(inFlight[:i], inFlight[i+1:]...)
+			if err := m.to.itc.Receive(m.itc); err != nil {
+				t.Fatalf("ITC receive failed: %v", err)
+			}
+			if err := m.to.vector.Receive(m.vector); err != nil {
+				t.Fatalf("Vector receive failed: %v", err)
+			}
+			snapshot(m.to)
+
+		case op == 8 && len(processes) < 8:
+			child := &process{itc: p.itc.Fork(), vector: NewVectorClock(fmt.Sprintf("p%d", created))}
+			child.vector.Join(p.vector)
+			created++
+			processes = append(processes, child)
+
+		case op == 9 && len(processes) > 2:
+			i := rng.IntN(len(processes))
+			leaving := processes[i]
+			if leaving == p {
+				continue
+			}
+			if err := p.itc.Join(leaving.itc); err != nil {
+				t.Fatalf("ITC join failed: %v", err)
+			}
+			p.vector.Join(leaving.vector)
+			processes = append(processes[:i], processes[i+1:]...)
+			for j := range inFlight {
+				if inFlight[j].to == leaving {
+					inFlight[j].to = p
+				}
+			}
+		}
+	}
+
+	if len(snapshots) < 200 {
+		t.Fatalf("Expected a few hundred events, got %d", len(snapshots))
+	}
+	itc, vector := NewIntervalTreeClock(), NewVectorClock("")
+	concurrent := 0
+	for i := range snapshots {
+		for j := i; j < len(snapshots); j++ {
+			want, err := vector.Compare(snapshots[i].vector, snapshots[j].vector)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := itc.Compare(snapshots[i].itc, snapshots[j].itc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Fatalf("Events %d and %d: expected %s, got %s", i, j, want, got)
+			}
+			if got == relationConcurrent {
+				concurrent++
+			}
+		}
+	}
+	if concurrent == 0 {
+		t.Errorf("Expected some concurrent events")
+	}
+}
+
+func TestITCForkJoin(t *testing.T) {
+	seed := NewIntervalTreeClock()
+	a := seed.Fork()
+	b := a.Fork()
+
+	seed.LocalEvent()
+	b.LocalEvent()
+	first, second := seed.Send(), b.Send()
+	if ordering, _ := seed.Compare(first, second); ordering != relationConcurrent {
+		t.Errorf("Expected events of forked clocks to be concurrent, got %s", ordering)
+	}
+
+	if err := seed.Join(a); err != nil {
+		t.Fatal(err)
+	}
+	if err := seed.Join(b); err != nil {
+		t.Fatal(err)
+	}
+	if !seed.id.isOne() {
+		t.Errorf("Expected joining every fork to restore the whole interval")
+	}
+	if ordering, _ := seed.Compare(second, seed.Send()); ordering != relationBefore {
+		t.Errorf("Expected joined history to precede the next event, got %s", ordering)
+	}
+
+	// a and b are anonymous now; joining again would double count
+	other := NewIntervalTreeClock()
+	if err := seed.Join(other); !errors.Is(err, ErrOverlappingIDs) {
+		t.Errorf("Expected ErrOverlappingIDs, got %v", err)
+	}
+}
+
+func TestITCSerialization(t *testing.T) {
+	seed := NewIntervalTreeClock()
+	forked := seed.Fork()
+	seed.LocalEvent()
+	forked.Receive(seed.Send())
+
+	data, _ := forked.MarshalBinary()
+	var restored IntervalTreeClock
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	again, _ := restored.MarshalBinary()
+	if string(again) != string(data) {
+		t.Errorf("Expected round trip to preserve the clock, got %x want %x", again, data)
+	}
+
+	// The restored clock keeps forked's identity
+	if err := seed.Join(&restored); err != nil {
+		t.Errorf("Expected restored clock to join its parent, got %v", err)
+	}
+
+	for _, data := range [][]byte{nil, {3}, {2, 1}, {0, 1}, {0, 0, 1, 2}, {0, 0, 0, 0}} {
+		if err := new(IntervalTreeClock).UnmarshalBinary(data); !errors.Is(err, ErrInvalidStamp) {
+			t.Errorf("Expected ErrInvalidStamp for %x, got %v", data, err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// streamFlushEvery is how many events are written between flushes, so a
+// response holds at most that many encoded events in memory
+const streamFlushEvery = 256
+
+// acceptsGzip reports whether the client accepts gzip responses, that is
+// lists gzip or * in Accept-Encoding without q=0
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// writeEventStream writes a JSON object of fields and an "events" array,
+// encoding the events one at a time and flushing every streamFlushEvery of
+// them, so the response is sent in chunks instead of being buffered whole.
+// The body is gzipped when the client accepts it.
+func writeEventStream(w http.ResponseWriter, r *http.Request, fields map[string]interface{}, events []Event) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	var out io.Writer = w
+	var zw *gzip.Writer
+	if acceptsGzip(r) {
+		w.Header().Set("Content-Encoding", "gzip")
+		zw = gzip.NewWriter(w)
+		defer zw.Close()
+		out = zw
+	}
+	bw := bufio.NewWriter(out)
+	flush := func() {
+		bw.Flush()
+		if zw != nil {
+			zw.Flush()
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	defer bw.Flush()
+
+	enc := json.NewEncoder(bw)
+	bw.WriteByte('{')
+	for _, key := range slices.Sorted(maps.Keys(fields)) {
+		name, _ := json.Marshal(key)
+		bw.Write(name)
+		bw.WriteByte(':')
+		if err := enc.Encode(fields[key]); err != nil {
+			return
+		}
+		bw.WriteByte(',')
+	}
+
+	bw.WriteString(`"events":[`)
+	for i := range events {
+		if i > 0 {
+			bw.WriteByte(',')
+		}
+		if err := enc.Encode(&events[i]); err != nil {
+			return
+		}
+		if i%streamFlushEvery == streamFlushEvery-1 {
+			flush()
+			if r.Context().Err() != nil {
+				return // the client went away
+			}
+		}
+	}
+	bw.WriteString("]}\n")
+}
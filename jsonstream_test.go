@@ -0,0 +1,91 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+type eventsResponse struct {
+	CurrentTimestamp int64   `json:"current_timestamp"`
+	EventCount       int     `json:"event_count"`
+	Events           []Event `json:"events"`
+}
+
+func TestHandleGetEventsStreams(t *testing.T) {
+	server := NewServer()
+	for i := 0; i < 3*streamFlushEvery+7; i++ {
+		server.logEvent(fmt.Sprintf("e%d", i), "Streamed")
+	}
+	ts := httptest.NewServer(http.HandlerFunc(server.handleGetEvents))
+	defer ts.Close()
+
+	// Ask for identity so the transport does not negotiate gzip on its own
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/events", nil)
+	req.Header.Set("Accept-Encoding", "identity")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if len(resp.TransferEncoding) == 0 || resp.TransferEncoding[0] != "chunked" {
+		t.Errorf("Expected a chunked response, got %v", resp.TransferEncoding)
+	}
+
+	var response eventsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatalf("Expected valid JSON, got %v", err)
+	}
+	if response.EventCount != 3*streamFlushEvery+7 || len(response.Events) != response.EventCount {
+		t.Fatalf("Expected %d events, got %d of %d", 3*streamFlushEvery+7, len(response.Events), response.EventCount)
+	}
+	if response.Events[10].ID != "e10" || response.CurrentTimestamp != int64(response.EventCount) {
+		t.Errorf("Unexpected content: %+v at %d", response.Events[10], response.CurrentTimestamp)
+	}
+}
+
+func TestHandleGetEventsGzip(t *testing.T) {
+	server := NewServer()
+	server.logEvent("e1", "Compressed")
+
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	req.Header.Set("Accept-Encoding", "br, gzip;q=0.8")
+	w := httptest.NewRecorder()
+	server.handleGetEvents(w, req)
+	if w.Header().Get("Content-Encoding") != "gzip" || !slices.Contains(w.Header().Values("Vary"), "Accept-Encoding") {
+		t.Fatalf("Expected a gzipped response, got headers %v", w.Header())
+	}
+
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Expected a gzip body, got %v", err)
+	}
+	var response eventsResponse
+	if err := json.NewDecoder(zr).Decode(&response); err != nil || len(response.Events) != 1 {
+		t.Errorf("Expected one event after decompressing, got %+v (%v)", response, err)
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	cases := map[string]bool{
+		"":                   false,
+		"gzip":               true,
+		"deflate, GZIP":      true,
+		"gzip;q=0":           false,
+		"gzip; q=0.5":        true,
+		"*":                  true,
+		"identity, *;q=0":    false,
+		"br;q=1.0, gzip;q=0": false,
+	}
+	for header, want := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/events", nil)
+		req.Header.Set("Accept-Encoding", header)
+		if got := acceptsGzip(req); got != want {
+			t.Errorf("%q: expected %v, got %v", header, want, got)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// JumpPolicy decides what happens when a received timestamp is too far ahead
+type JumpPolicy string
+
+const (
+	// JumpReject refuses the update and leaves the clock untouched
+	JumpReject JumpPolicy = "reject"
+	// JumpClamp advances the clock by at most MaxJump
+	JumpClamp JumpPolicy = "clamp"
+	// JumpAlert accepts the update but reports the violation
+	JumpAlert JumpPolicy = "alert"
+)
+
+// ErrJumpTooLarge is returned when a received timestamp is rejected
+var ErrJumpTooLarge = errors.New("timestamp jump exceeds max_jump")
+
+// JumpGuard limits how far a single received timestamp may move the clock
+type JumpGuard struct {
+	// MaxJump is the largest allowed difference between a received timestamp
+	// and the local time. Zero disables the guard.
+	MaxJump int64
+	Policy  JumpPolicy
+
+	// OnViolation is called after every violation, outside the clock lock
+	OnViolation func(JumpViolation)
+}
+
+// JumpViolation describes a received timestamp that exceeded MaxJump
+type JumpViolation struct {
+	Received ClockTime
+	Local    ClockTime
+	Policy   JumpPolicy
+}
+
+// parseJumpPolicy validates a policy name from configuration
+func parseJumpPolicy(name string) (JumpPolicy, error) {
+	switch p := JumpPolicy(name); p {
+	case JumpReject, JumpClamp, JumpAlert:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown max jump policy %q", name)
+	}
+}
+
+// SetJumpGuard installs the policy applied by UpdateChecked
+func (lc *LamportClock) SetJumpGuard(guard JumpGuard) {
+	lc.mutex.Lock()
+	defer lc.mutex.Unlock()
+	lc.guard = guard
+}
+
+// JumpGuard returns the installed policy
+func (lc *LamportClock) JumpGuard() JumpGuard {
+	lc.mutex.RLock()
+	defer lc.mutex.RUnlock()
+	return lc.guard
+}
+
+// UpdateChecked is UpdateTime for timestamps coming from untrusted sources.
+// It enforces the configured JumpGuard before applying the Lamport rule.
+func (lc *LamportClock) UpdateChecked(received ClockTime) (ClockTime, error) {
+	return lc.mergeChecked(received, true, ClockSource{})
+}
+
+// ObserveChecked moves the clock up to a timestamp seen from another node
+// without counting an event, which suits periodic synchronization beacons.
+// The JumpGuard applies as for UpdateChecked.
+func (lc *LamportClock) ObserveChecked(received ClockTime) (ClockTime, error) {
+	return lc.mergeChecked(received, false, ClockSource{})
+}
+
+// updateFrom and observeFrom are UpdateChecked and ObserveChecked recording
+// where the timestamp came from in the clock history
+func (lc *LamportClock) updateFrom(received ClockTime, src ClockSource) (ClockTime, error) {
+	return lc.mergeChecked(received, true, src)
+}
+
+func (lc *LamportClock) observeFrom(received ClockTime, src ClockSource) (ClockTime, error) {
+	return lc.mergeChecked(received, false, src)
+}
+
+// updateApplied is updateFrom also returning the timestamp as it was
+// applied, which the JumpClamp policy moves back from received
+func (lc *LamportClock) updateApplied(received ClockTime, src ClockSource) (now, applied ClockTime, err error) {
+	return lc.mergeGuarded(received, true, src)
+}
+
+func (lc *LamportClock) mergeChecked(received ClockTime, increment bool, src ClockSource) (ClockTime, error) {
+	now, _, err := lc.mergeGuarded(received, increment, src)
+	return now, err
+}
+
+func (lc *LamportClock) mergeGuarded(received ClockTime, increment bool, src ClockSource) (now, applied ClockTime, err error) {
+	lc.mutex.Lock()
+
+	guard := lc.guard
+	local := lc.nowLocked()
+	original := received
+	var violation *JumpViolation
+	if guard.MaxJump > 0 && local.Before(received) {
+		jump, ok := local.distance(received, lc.rollover)
+		if !ok || jump > guard.MaxJump {
+			violation = &JumpViolation{Received: received, Local: local, Policy: guard.Policy}
+
+			switch guard.Policy {
+			case JumpClamp:
+				received = local.advance(guard.MaxJump, lc.rollover)
+			case JumpAlert:
+				// accept as is
+			default:
+				lc.mutex.Unlock()
+				if guard.OnViolation != nil {
+					guard.OnViolation(*violation)
+				}
+				return local, ClockTime{}, ErrJumpTooLarge
+			}
+		}
+	}
+
+	cause := causeObserve
+	if increment {
+		lc.mergeLocked(received)
+		cause = causeUpdate
+	} else {
+		lc.maxLocked(received)
+	}
+	lc.recordLocked(local, cause, original, received != original, src)
+	now = lc.nowLocked()
+	lc.mutex.Unlock()
+
+	lc.updated(original, now)
+	if violation != nil && guard.OnViolation != nil {
+		guard.OnViolation(*violation)
+	}
+	return now, received, nil
+}
+
+// recordJumpViolation counts and logs jump violations
+func (s *Server) recordJumpViolation(v JumpViolation) {
+	switch v.Policy {
+	case JumpClamp:
+		s.metrics.Inc("lamport_clamped_updates_total")
+	case JumpAlert:
+		s.metrics.Inc("lamport_jump_alerts_total")
+	default:
+		s.metrics.Inc("lamport_rejected_updates_total")
+	}
+	s.logger.Warn("Timestamp jump violation",
+		"received", v.Received.String(),
+		"lamport_timestamp", v.Local.Timestamp,
+		"policy", v.Policy)
+}
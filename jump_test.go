@@ -0,0 +1,158 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUpdateCheckedReject(t *testing.T) {
+	clock := NewLamportClock()
+	var violations []JumpViolation
+	clock.SetJumpGuard(JumpGuard{
+		MaxJump:     100,
+		Policy:      JumpReject,
+		OnViolation: func(v JumpViolation) { violations = append(violations, v) },
+	})
+
+	// Within the bound behaves like Update
+	ts, err := clock.UpdateChecked(ClockTime{Timestamp: 100})
+	if err != nil || ts.Timestamp != 101 {
+		t.Errorf("Expected update within bound to return 101, got %d (err: %v)", ts, err)
+	}
+
+	// Too far ahead is rejected and leaves the clock untouched
+	_, err = clock.UpdateChecked(ClockTime{Timestamp: 1 << 62})
+	if err != ErrJumpTooLarge {
+		t.Errorf("Expected ErrJumpTooLarge, got %v", err)
+	}
+	if clock.GetTime() != 101 {
+		t.Errorf("Expected clock to stay at 101, got %d", clock.GetTime())
+	}
+
+	if len(violations) != 1 || violations[0].Local.Timestamp != 101 || violations[0].Received.Timestamp != 1<<62 {
+		t.Errorf("Expected one recorded violation, got %+v", violations)
+	}
+}
+
+func TestUpdateCheckedClamp(t *testing.T) {
+	clock := NewLamportClock()
+	clock.SetJumpGuard(JumpGuard{MaxJump: 10, Policy: JumpClamp})
+	clock.Tick() // 1
+
+	// Clamped to local + max_jump, then incremented
+	ts, err := clock.UpdateChecked(ClockTime{Timestamp: 1000})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ts.Timestamp != 12 {
+		t.Errorf("Expected clamped update to return 12, got %d", ts)
+	}
+}
+
+func TestObserveChecked(t *testing.T) {
+	clock := NewLamportClock()
+	clock.SetJumpGuard(JumpGuard{MaxJump: 100, Policy: JumpReject})
+
+	// Observing raises the clock without incrementing it
+	ts, err := clock.ObserveChecked(ClockTime{Timestamp: 50})
+	if err != nil || ts.Timestamp != 50 {
+		t.Errorf("Expected 50, got %d (err: %v)", ts.Timestamp, err)
+	}
+	if ts, _ := clock.ObserveChecked(ClockTime{Timestamp: 20}); ts.Timestamp != 50 {
+		t.Errorf("Expected older time to be ignored, got %d", ts.Timestamp)
+	}
+
+	if _, err := clock.ObserveChecked(ClockTime{Timestamp: 1000}); err != ErrJumpTooLarge {
+		t.Errorf("Expected ErrJumpTooLarge, got %v", err)
+	}
+}
+
+func TestUpdateCheckedAlert(t *testing.T) {
+	clock := NewLamportClock()
+	alerted := false
+	clock.SetJumpGuard(JumpGuard{
+		MaxJump:     10,
+		Policy:      JumpAlert,
+		OnViolation: func(JumpViolation) { alerted = true },
+	})
+
+	ts, err := clock.UpdateChecked(ClockTime{Timestamp: 1000})
+	if err != nil || ts.Timestamp != 1001 {
+		t.Errorf("Expected alert policy to accept update with 1001, got %d (err: %v)", ts, err)
+	}
+	if !alerted {
+		t.Error("Expected violation callback to be called")
+	}
+}
+
+func TestUpdateCheckedDisabled(t *testing.T) {
+	clock := NewLamportClock()
+
+	ts, err := clock.UpdateChecked(ClockTime{Timestamp: 1 << 62})
+	if err != nil || ts.Timestamp != 1<<62+1 {
+		t.Errorf("Expected unguarded clock to accept any jump, got %d (err: %v)", ts, err)
+	}
+}
+
+func TestReceiveMessageHandlerMaxJump(t *testing.T) {
+	server := NewServer()
+	server.clock.SetJumpGuard(JumpGuard{
+		MaxJump:     50,
+		Policy:      JumpReject,
+		OnViolation: server.recordJumpViolation,
+	})
+
+	req := httptest.NewRequest("POST", "/message?timestamp=4611686018427387904&message=poison", nil)
+	w := httptest.NewRecorder()
+	server.handleReceiveMessage(w, req)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status UnprocessableEntity, got %d", w.Code)
+	}
+	if server.events.Len() != 0 {
+		t.Errorf("Expected rejected message not to be logged, got %d events", server.events.Len())
+	}
+	if got := server.metrics.Value("lamport_rejected_updates_total"); got != 1 {
+		t.Errorf("Expected rejected counter to be 1, got %v", got)
+	}
+
+	// The counter is exposed on /metrics
+	req2 := httptest.NewRequest("GET", "/metrics", nil)
+	w2 := httptest.NewRecorder()
+	server.handleMetrics(w2, req2)
+	if !strings.Contains(w2.Body.String(), "lamport_rejected_updates_total 1") {
+		t.Errorf("Expected metrics output to contain rejected counter, got:\n%s", w2.Body.String())
+	}
+}
+
+func TestParseJumpPolicy(t *testing.T) {
+	if _, err := parseJumpPolicy("clamp"); err != nil {
+		t.Errorf("Expected clamp to be valid, got %v", err)
+	}
+	if _, err := parseJumpPolicy("ignore"); err == nil {
+		t.Error("Expected unknown policy to be rejected")
+	}
+}
+
+func TestUpdateCheckedAcrossEpochs(t *testing.T) {
+	clock := NewLamportClock()
+	clock.rollover = 100
+	clock.SetJumpGuard(JumpGuard{MaxJump: 10, Policy: JumpReject})
+	clock.UpdateTime(ClockTime{Timestamp: 95}) // 96
+
+	// The peer already rolled over: (1, 3) is only 7 ticks ahead
+	now, err := clock.UpdateChecked(ClockTime{Epoch: 1, Timestamp: 3})
+	if err != nil {
+		t.Fatalf("Expected small jump across epochs to be accepted, got %v", err)
+	}
+	if now != (ClockTime{Epoch: 1, Timestamp: 4}) {
+		t.Errorf("Expected clock at 1:4, got %s", now)
+	}
+
+	// Two epochs ahead is always too far
+	if _, err := clock.UpdateChecked(ClockTime{Epoch: 3, Timestamp: 1}); err != ErrJumpTooLarge {
+		t.Errorf("Expected ErrJumpTooLarge for jump over whole epochs, got %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaTimeout bounds commits and writes that must finish during shutdown
+const kafkaTimeout = 5 * time.Second
+
+// kafkaReader is the part of *kafka.Reader used by the bridge
+type kafkaReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// kafkaWriter is the part of *kafka.Writer used by the bridge
+type kafkaWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// KafkaBridge consumes timestamped messages from one topic and produces
+// local events to another. The Lamport timestamp is read from a header or,
+// when TimestampField is set, from a field of a JSON message value.
+type KafkaBridge struct {
+	reader          kafkaReader // nil when not consuming
+	writer          kafkaWriter // nil when not producing
+	server          *Server
+	timestampHeader string
+	timestampField  string
+	logger          *slog.Logger
+}
+
+// NewKafkaBridge creates a bridge from the Kafka settings in cfg
+func NewKafkaBridge(cfg *Config, server *Server) *KafkaBridge {
+	b := &KafkaBridge{
+		server:          server,
+		timestampHeader: cfg.KafkaTimestampHeader,
+		timestampField:  cfg.KafkaTimestampField,
+		logger:          server.logger.With("transport", "kafka"),
+	}
+	if cfg.KafkaTopic != "" {
+		b.reader = kafka.NewReader(kafka.ReaderConfig{
+			Brokers: cfg.KafkaBrokers,
+			Topic:   cfg.KafkaTopic,
+			GroupID: cfg.KafkaGroup,
+		})
+	}
+	if cfg.KafkaPublishTopic != "" {
+		// Keying by node keeps each node's events in order on one partition
+		b.writer = &kafka.Writer{
+			Addr:         kafka.TCP(cfg.KafkaBrokers...),
+			Topic:        cfg.KafkaPublishTopic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+		}
+	}
+	return b
+}
+
+// Run consumes and produces until ctx is done
+func (b *KafkaBridge) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	if b.reader != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.consume(ctx)
+		}()
+	}
+
+	if b.writer != nil {
+		b.server.forwardLocalEvents(ctx, b.produce)
+	}
+	wg.Wait()
+
+	if b.reader != nil {
+		b.reader.Close()
+	}
+	if b.writer != nil {
+		return b.writer.Close()
+	}
+	return nil
+}
+
+// consume merges messages and commits their offsets once they are logged,
+// so a crash redelivers rather than loses them
+func (b *KafkaBridge) consume(ctx context.Context) {
+	for {
+		msg, err := b.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			b.logger.Warn("Failed to fetch Kafka message", "error", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		b.handleMessage(msg)
+
+		commitCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), kafkaTimeout)
+		if err := b.reader.CommitMessages(commitCtx, msg); err != nil {
+			b.logger.Warn("Failed to commit Kafka offset", "offset", msg.Offset, "error", err)
+		}
+		cancel()
+	}
+}
+
+func (b *KafkaBridge) handleMessage(msg kafka.Message) {
+	get, message := b.extract(msg)
+	event, ok, err := b.server.receiveBridged("kafka", get, message)
+	if err != nil {
+		b.logger.Warn("Rejected Kafka message",
+			"topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset, "error", err)
+		return
+	}
+	if ok {
+		b.logger.Debug("Merged Kafka message", eventAttrs(event)...)
+	}
+}
+
+// extract returns a lookup of the clock headers of a message and its text.
+// In field mode the timestamp and epoch come from the JSON value, and the
+// message is its "message" field when present.
+func (b *KafkaBridge) extract(msg kafka.Message) (func(string) string, string) {
+	headers := make(map[string]string, len(msg.Headers))
+	for _, h := range msg.Headers {
+		headers[strings.ToLower(h.Key)] = string(h.Value)
+	}
+	get := func(key string) string {
+		if key == headerTimestamp {
+			key = b.timestampHeader
+		}
+		return headers[strings.ToLower(key)]
+	}
+	message := string(msg.Value)
+
+	if b.timestampField == "" {
+		return get, message
+	}
+
+	// Values that are not JSON objects carry no timestamp field
+	var fields map[string]json.RawMessage
+	json.Unmarshal(msg.Value, &fields)
+	var text string
+	if json.Unmarshal(fields["message"], &text) == nil && text != "" {
+		message = text
+	}
+	return func(key string) string {
+		switch key {
+		case headerTimestamp:
+			return jsonScalar(fields[b.timestampField])
+		case headerEpoch:
+			if raw, ok := fields["epoch"]; ok {
+				return jsonScalar(raw)
+			}
+		}
+		return get(key)
+	}, message
+}
+
+// jsonScalar returns a JSON number or string as text
+func jsonScalar(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var n json.Number
+	if json.Unmarshal(raw, &n) == nil {
+		return n.String()
+	}
+	return ""
+}
+
+func (b *KafkaBridge) produce(e Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), kafkaTimeout)
+	defer cancel()
+	if err := b.writer.WriteMessages(ctx, b.kafkaMessage(e)); err != nil {
+		b.logger.Warn("Failed to produce event", append(eventAttrs(e), "error", err)...)
+		return
+	}
+	b.server.metrics.Inc("lamport_bridge_published_total", "transport", "kafka")
+}
+
+// kafkaMessage builds the record announcing a local event, stamped in the
+// configured header and, in field mode, in the JSON value as well
+func (b *KafkaBridge) kafkaMessage(e Event) kafka.Message {
+	nodeID := b.server.nodeID
+	msg := kafka.Message{Key: []byte(nodeID), Value: []byte(e.Message)}
+	for key, value := range clockHeaders(e, nodeID) {
+		if key == headerTimestamp {
+			key = b.timestampHeader
+		}
+		msg.Headers = append(msg.Headers, kafka.Header{Key: key, Value: []byte(value)})
+	}
+
+	if b.timestampField != "" {
+		value, _ := json.Marshal(map[string]interface{}{
+			b.timestampField: e.Timestamp,
+			"epoch":          e.Epoch,
+			"id":             e.ID,
+			"message":        e.Message,
+		})
+		msg.Value = value
+	}
+	return msg
+}
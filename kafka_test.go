@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeKafka serves queued records to the bridge and records what it commits
+// and produces
+type fakeKafka struct {
+	records   chan kafka.Message
+	mutex     sync.Mutex
+	committed []int64
+	produced  []kafka.Message
+}
+
+func newFakeKafka(records ...kafka.Message) *fakeKafka {
+	f := &fakeKafka{records: make(chan kafka.Message, len(records))}
+	for _, r := range records {
+		f.records <- r
+	}
+	return f
+}
+
+func (f *fakeKafka) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case msg := <-f.records:
+		return msg, nil
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+func (f *fakeKafka) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, m := range msgs {
+		f.committed = append(f.committed, m.Offset)
+	}
+	return nil
+}
+
+func (f *fakeKafka) commits() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return len(f.committed)
+}
+
+func (f *fakeKafka) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.produced = append(f.produced, msgs...)
+	return nil
+}
+
+func (f *fakeKafka) Close() error { return nil }
+
+func newTestKafkaBridge(server *Server, field string) *KafkaBridge {
+	return NewKafkaBridge(&Config{KafkaTimestampHeader: "ts", KafkaTimestampField: field}, server)
+}
+
+func TestKafkaExtractHeader(t *testing.T) {
+	b := newTestKafkaBridge(NewServer(), "")
+	get, message := b.extract(kafka.Message{
+		Value:   []byte("Hello"),
+		Headers: []kafka.Header{{Key: "TS", Value: []byte("12")}, {Key: headerSender, Value: []byte("b")}},
+	})
+
+	if get(headerTimestamp) != "12" || get(headerSender) != "b" || message != "Hello" {
+		t.Errorf("Unexpected extraction: ts=%q sender=%q message=%q", get(headerTimestamp), get(headerSender), message)
+	}
+}
+
+func TestKafkaExtractField(t *testing.T) {
+	b := newTestKafkaBridge(NewServer(), "clock")
+
+	get, message := b.extract(kafka.Message{Value: []byte(`{"clock":12,"epoch":"1","message":"Order created"}`)})
+	if get(headerTimestamp) != "12" || get(headerEpoch) != "1" || message != "Order created" {
+		t.Errorf("Unexpected extraction: ts=%q epoch=%q message=%q", get(headerTimestamp), get(headerEpoch), message)
+	}
+
+	// Non-JSON values have no timestamp even if a header is present
+	get, _ = b.extract(kafka.Message{
+		Value:   []byte("plain"),
+		Headers: []kafka.Header{{Key: "ts", Value: []byte("3")}},
+	})
+	if get(headerTimestamp) != "" {
+		t.Errorf("Expected no timestamp, got %q", get(headerTimestamp))
+	}
+}
+
+func TestKafkaBridgeConsumesAndProduces(t *testing.T) {
+	server := NewServer()
+	server.nodeID = "a"
+	b := newTestKafkaBridge(server, "")
+	fake := newFakeKafka(
+		kafka.Message{Offset: 1, Value: []byte("First"), Headers: []kafka.Header{{Key: "ts", Value: []byte("10")}}},
+		kafka.Message{Offset: 2, Value: []byte("No timestamp")},
+	)
+	b.reader = fake
+	b.writer = fake
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.Run(ctx) }()
+
+	deadline := time.Now().Add(time.Second)
+	for server.broker.Count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	for fake.commits() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	local, _ := server.recordLocal(Event{ID: "event-1", Message: "Local"})
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if local.Timestamp != 12 {
+		t.Errorf("Expected local event at 12 after merging 10, got %d", local.Timestamp)
+	}
+	if len(fake.committed) != 2 {
+		t.Errorf("Expected both offsets committed, got %v", fake.committed)
+	}
+	// Only the local event is produced, not the merged record
+	if len(fake.produced) != 1 {
+		t.Fatalf("Expected 1 produced record, got %d", len(fake.produced))
+	}
+	produced := fake.produced[0]
+	if string(produced.Key) != "a" || string(produced.Value) != "Local" {
+		t.Errorf("Unexpected record: key=%q value=%q", produced.Key, produced.Value)
+	}
+	get, _ := b.extract(produced)
+	if get(headerTimestamp) != "12" {
+		t.Errorf("Expected produced record stamped 12, got %q", get(headerTimestamp))
+	}
+}
+
+func TestKafkaMessageFieldMode(t *testing.T) {
+	server := NewServer()
+	server.nodeID = "a"
+	b := newTestKafkaBridge(server, "clock")
+
+	msg := b.kafkaMessage(Event{ID: "event-1", Message: "Local", Timestamp: 7})
+	get, message := b.extract(msg)
+	if get(headerTimestamp) != "7" || message != "Local" {
+		t.Errorf("Expected field mode round trip, got ts=%q message=%q", get(headerTimestamp), message)
+	}
+}
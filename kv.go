@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errStaleWrite is returned for a local write that loses against the
+// stored version, such as after the clock was reset
+var errStaleWrite = errors.New("a newer write of the register is stored")
+
+// Version orders register writes: Lamport time first, node ID as tie-break,
+// so every replica picks the same winner
+type Version struct {
+	ClockTime
+	NodeID string `json:"node_id"`
+}
+
+// Compare orders versions; see Version
+func (v Version) Compare(other Version) int {
+	if c := v.ClockTime.Compare(other.ClockTime); c != 0 {
+		return c
+	}
+	return strings.Compare(v.NodeID, other.NodeID)
+}
+
+// Register is the state of one key in the last-writer-wins store
+type Register struct {
+	Key      string    `json:"key"`
+	Value    string    `json:"value"`
+	Version  Version   `json:"version"`
+	WallTime time.Time `json:"wall_time"`
+}
+
+// KVStore is a set of last-writer-wins registers
+type KVStore struct {
+	registers map[string]Register
+	mutex     sync.RWMutex
+}
+
+// NewKVStore creates an empty store
+func NewKVStore() *KVStore {
+	return &KVStore{registers: make(map[string]Register)}
+}
+
+// Get returns the register stored under key
+func (kv *KVStore) Get(key string) (Register, bool) {
+	kv.mutex.RLock()
+	defer kv.mutex.RUnlock()
+	reg, ok := kv.registers[key]
+	return reg, ok
+}
+
+// Merge applies a write if it is newer than the stored one and reports
+// whether it won. Merging is commutative and idempotent, so replicas
+// converge regardless of delivery order.
+func (kv *KVStore) Merge(reg Register) bool {
+	kv.mutex.Lock()
+	defer kv.mutex.Unlock()
+
+	current, ok := kv.registers[reg.Key]
+	if ok && reg.Version.Compare(current.Version) <= 0 {
+		return false
+	}
+	kv.registers[reg.Key] = reg
+	return true
+}
+
+// putRegister stamps a local write with a fresh timestamp and stores it.
+// A frozen clock has no fresh timestamp to give, so the write is refused
+// with errClockFrozen; a write losing against the stored version is
+// refused with errStaleWrite and its tick given back.
+func (s *Server) putRegister(key, value string, src ClockSource) (Register, error) {
+	now, err := s.clock.tickN(1, src)
+	if err != nil {
+		return Register{}, err
+	}
+	reg := Register{
+		Key:      key,
+		Value:    value,
+		Version:  Version{ClockTime: now, NodeID: s.nodeID},
+		WallTime: time.Now(),
+	}
+	if !s.kv.Merge(reg) {
+		s.clock.untickN(now, 1)
+		return Register{}, errStaleWrite
+	}
+
+	s.logger.Info("Register written", "key", key, "lamport_timestamp", reg.Version.Timestamp)
+	return reg, nil
+}
+
+// replicateRegister pushes a local write to all peers
+func (s *Server) replicateRegister(reg Register) {
+	body, err := json.Marshal(reg)
+	if err != nil {
+		s.logger.Error("Failed to encode register", "key", reg.Key, "error", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	header := http.Header{"Content-Type": []string{"application/json"}}
+	for peer, err := range s.peers.Broadcast(ctx, http.MethodPost, "/peer/kv", header, body) {
+		if err != nil {
+			s.logger.Warn("Failed to replicate register", "key", reg.Key, "peer", peer, "error", err)
+		}
+	}
+}
+
+// mergeReplica applies a write received from a peer. The peer's timestamp
+// goes through the jump guard like any other received timestamp; a write
+// the JumpClamp policy clamped is stored at the clamped version, so no
+// register is newer than the clock.
+func (s *Server) mergeReplica(reg Register) (bool, error) {
+	_, applied, err := s.clock.updateApplied(reg.Version.ClockTime, ClockSource{Peer: reg.Version.NodeID})
+	if err != nil {
+		return false, err
+	}
+	reg.Version.ClockTime = applied
+	return s.kv.Merge(reg), nil
+}
+
+func (s *Server) handleKV(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/kv/")
+	if key == "" || strings.Contains(key, "/") {
+		http.Error(w, "Invalid key", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		reg, ok := s.kv.Get(key)
+		if !ok {
+			http.Error(w, "Key not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reg)
+
+	case http.MethodPut:
+		value, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Failed to read body", http.StatusBadRequest)
+			return
+		}
+
+		reg, err := s.putRegister(key, string(value), ClockSource{RequestID: requestIDFrom(r.Context())})
+		switch {
+		case errors.Is(err, errClockFrozen):
+			http.Error(w, "Clock is frozen, write after it resumes", http.StatusConflict)
+			return
+		case errors.Is(err, errStaleWrite):
+			http.Error(w, "A newer write of the key is stored", http.StatusConflict)
+			return
+		}
+		if s.peers != nil {
+			go s.replicateRegister(reg)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reg)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handlePeerKV(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var reg Register
+	if err := json.NewDecoder(r.Body).Decode(&reg); err != nil || reg.Key == "" {
+		http.Error(w, "Invalid register", http.StatusBadRequest)
+		return
+	}
+
+	applied, err := s.mergeReplica(reg)
+	if err != nil {
+		http.Error(w, "Timestamp jump exceeds max_jump", http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"applied":           applied,
+		"lamport_timestamp": s.clock.GetTime(),
+	})
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVersionCompare(t *testing.T) {
+	a := Version{ClockTime: ClockTime{Timestamp: 5}, NodeID: "a"}
+	b := Version{ClockTime: ClockTime{Timestamp: 5}, NodeID: "b"}
+	c := Version{ClockTime: ClockTime{Timestamp: 6}, NodeID: "a"}
+
+	if a.Compare(b) >= 0 {
+		t.Error("Expected equal timestamps to be ordered by node ID")
+	}
+	if c.Compare(b) <= 0 {
+		t.Error("Expected higher timestamp to win regardless of node ID")
+	}
+	if a.Compare(a) != 0 {
+		t.Error("Expected version to equal itself")
+	}
+}
+
+func TestKVStoreMergeConverges(t *testing.T) {
+	writes := []Register{
+		{Key: "color", Value: "red", Version: Version{ClockTime{0, 3}, "a"}},
+		{Key: "color", Value: "blue", Version: Version{ClockTime{0, 3}, "b"}},
+		{Key: "color", Value: "green", Version: Version{ClockTime{0, 2}, "c"}},
+	}
+
+	// Apply the same writes in two different orders
+	forward, backward := NewKVStore(), NewKVStore()
+	for i := range writes {
+		forward.Merge(writes[i])
+		backward.Merge(writes[len(writes)-1-i])
+	}
+	// Re-delivery is harmless
+	forward.Merge(writes[0])
+
+	f, _ := forward.Get("color")
+	b, _ := backward.Get("color")
+	if f.Value != "blue" || b.Value != "blue" {
+		t.Errorf("Expected both replicas to converge on blue, got %s and %s", f.Value, b.Value)
+	}
+}
+
+func TestKVHandler(t *testing.T) {
+	server := NewServer()
+	server.nodeID = "node-a"
+
+	req := httptest.NewRequest("PUT", "/kv/greeting", strings.NewReader("hello"))
+	w := httptest.NewRecorder()
+	server.handleKV(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d", w.Code)
+	}
+	var written Register
+	json.NewDecoder(w.Body).Decode(&written)
+	if written.Version.Timestamp != 1 || written.Version.NodeID != "node-a" {
+		t.Errorf("Expected write stamped 1@node-a, got %+v", written.Version)
+	}
+
+	req2 := httptest.NewRequest("GET", "/kv/greeting", nil)
+	w2 := httptest.NewRecorder()
+	server.handleKV(w2, req2)
+
+	var read Register
+	json.NewDecoder(w2.Body).Decode(&read)
+	if read.Value != "hello" {
+		t.Errorf("Expected value hello, got %q", read.Value)
+	}
+
+	req3 := httptest.NewRequest("GET", "/kv/missing", nil)
+	w3 := httptest.NewRecorder()
+	server.handleKV(w3, req3)
+	if w3.Code != http.StatusNotFound {
+		t.Errorf("Expected status NotFound, got %d", w3.Code)
+	}
+
+	req4 := httptest.NewRequest("DELETE", "/kv/greeting", nil)
+	w4 := httptest.NewRecorder()
+	server.handleKV(w4, req4)
+	if w4.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status MethodNotAllowed, got %d", w4.Code)
+	}
+}
+
+func TestKVReplication(t *testing.T) {
+	nodeA := NewServer()
+	nodeA.nodeID = "a"
+	nodeB := NewServer()
+	nodeB.nodeID = "b"
+
+	peerB := httptest.NewServer(http.HandlerFunc(nodeB.handlePeerKV))
+	defer peerB.Close()
+	nodeA.peers = NewPeers([]string{peerB.URL}, peerB.Client())
+
+	// Node B is ahead, so its concurrent write carries a higher timestamp
+	nodeB.clock.Update(10)
+	local, err := nodeB.putRegister("owner", "b", ClockSource{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Node A writes and replicates; it loses against B's newer write
+	written, err := nodeA.putRegister("owner", "a", ClockSource{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeA.replicateRegister(written)
+
+	reg, _ := nodeB.kv.Get("owner")
+	if reg.Value != "b" || reg.Version != local.Version {
+		t.Errorf("Expected node B to keep its newer write, got %+v", reg)
+	}
+
+	// Receiving the replica ticks B past its own write
+	if nodeB.clock.GetTime() != 13 {
+		t.Errorf("Expected node B clock to be 13, got %d", nodeB.clock.GetTime())
+	}
+
+	// A newer write from A replaces B's value
+	nodeA.clock.Update(50)
+	written, err = nodeA.putRegister("owner", "a2", ClockSource{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeA.replicateRegister(written)
+
+	reg, _ = nodeB.kv.Get("owner")
+	if reg.Value != "a2" {
+		t.Errorf("Expected replicated newer write to win, got %q", reg.Value)
+	}
+}
+
+func TestPeerKVRejectsJump(t *testing.T) {
+	server := NewServer()
+	server.clock.SetJumpGuard(JumpGuard{MaxJump: 10, Policy: JumpReject})
+
+	body := `{"key":"k","value":"v","version":{"epoch":0,"lamport_timestamp":1000,"node_id":"evil"}}`
+	req := httptest.NewRequest("POST", "/peer/kv", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	server.handlePeerKV(w, req)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status UnprocessableEntity, got %d", w.Code)
+	}
+	if _, ok := server.kv.Get("k"); ok {
+		t.Error("Expected rejected write not to be stored")
+	}
+}
+
+func TestKVRefusesWrites(t *testing.T) {
+	server := NewServer()
+	server.clock.Freeze()
+
+	req := httptest.NewRequest("PUT", "/kv/k", strings.NewReader("v"))
+	w := httptest.NewRecorder()
+	server.handleKV(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status Conflict on a frozen clock, got %d", w.Code)
+	}
+	if _, ok := server.kv.Get("k"); ok {
+		t.Error("Expected refused write not to be stored")
+	}
+
+	// A write older than the stored one loses and gives its tick back
+	server.clock.Resume()
+	server.kv.Merge(Register{Key: "k", Value: "newer", Version: Version{ClockTime{0, 5}, "other"}})
+	w = httptest.NewRecorder()
+	server.handleKV(w, httptest.NewRequest("PUT", "/kv/k", strings.NewReader("v")))
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status Conflict for a stale write, got %d", w.Code)
+	}
+	if reg, _ := server.kv.Get("k"); reg.Value != "newer" {
+		t.Errorf("Expected stored write to be kept, got %q", reg.Value)
+	}
+	if server.clock.GetTime() != 0 {
+		t.Errorf("Expected the stale write's tick to be given back, got %d", server.clock.GetTime())
+	}
+}
+
+func TestKVWriteRecordsRequest(t *testing.T) {
+	server := NewServer()
+
+	req := httptest.NewRequest("PUT", "/kv/k", strings.NewReader("v"))
+	req = req.WithContext(contextWithRequestID(req.Context(), "req-1"))
+	server.handleKV(httptest.NewRecorder(), req)
+
+	history := server.clock.history.Transitions()
+	if len(history) == 0 || history[0].Cause != causeTick || history[0].RequestID != "req-1" {
+		t.Errorf("Expected the write's tick to record its request, got %+v", history)
+	}
+}
+
+func TestPeerKVStoresClampedVersion(t *testing.T) {
+	server := NewServer()
+	server.clock.SetJumpGuard(JumpGuard{MaxJump: 10, Policy: JumpClamp})
+
+	body := `{"key":"k","value":"v","version":{"epoch":0,"lamport_timestamp":1000,"node_id":"far"}}`
+	w := httptest.NewRecorder()
+	server.handlePeerKV(w, httptest.NewRequest("POST", "/peer/kv", strings.NewReader(body)))
+
+	reg, ok := server.kv.Get("k")
+	if !ok || reg.Version.Timestamp != 10 {
+		t.Errorf("Expected write stored at the clamped version 10, got %+v", reg.Version)
+	}
+	if server.clock.GetTime() != 11 {
+		t.Errorf("Expected clock at 11, got %d", server.clock.GetTime())
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec/lamportpb/lamportpbconnect"
+)
+
+// Built-in limits of endpoints unlike the others: event streams run until
+// the client leaves, profiles for the seconds asked, and imports and
+// replays carry whole logs
+var (
+	defaultHandlerTimeouts = map[string]time.Duration{"/events/stream": 0, "/debug/pprof/": 0, lamportpbconnect.ClockStreamEventsProcedure: 0}
+	defaultBodyLimits      = map[string]int64{"/admin/import": 64 << 20, "/admin/replay": 64 << 20}
+)
+
+// RequestLimits bounds how long handlers run and how large request bodies
+// are, by default and per path prefix. Zero lifts a limit.
+type RequestLimits struct {
+	Timeout    time.Duration
+	Timeouts   map[string]time.Duration
+	MaxBody    int64
+	BodyLimits map[string]int64
+	// WriteTimeout is the time left to write the response after the
+	// handler's deadline
+	WriteTimeout time.Duration
+}
+
+// forPath returns the limit of the longest prefix of path in limits, or
+// fallback
+func forPath[T any](limits map[string]T, path string, fallback T) T {
+	best := -1
+	for prefix, limit := range limits {
+		if strings.HasPrefix(path, prefix) && len(prefix) > best {
+			best, fallback = len(prefix), limit
+		}
+	}
+	return fallback
+}
+
+// timeout returns how long a request may take. Long polls may take their
+// wait on top.
+func (l *RequestLimits) timeout(r *http.Request) time.Duration {
+	// GraphQL subscriptions stream for as long as the client listens
+	if r.URL.Path == "/graphql" && wantsEventStream(r) {
+		return 0
+	}
+	timeout := forPath(l.Timeouts, r.URL.Path, l.Timeout)
+	if timeout > 0 && r.URL.Query().Get("wait_for") != "" {
+		wait := defaultWaitTimeout
+		if v, err := time.ParseDuration(r.URL.Query().Get("timeout")); err == nil && v > 0 && v <= maxWaitTimeout {
+			wait = v
+		}
+		timeout += wait
+	}
+	return timeout
+}
+
+// withRequestLimits applies the limits to every request: its context ends
+// at the handler's deadline, its response must be written by then plus
+// the write timeout, and its body is cut at the size limit, answering
+// 413 right away when the declared length exceeds it
+func withRequestLimits(limits *RequestLimits, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limit := forPath(limits.BodyLimits, r.URL.Path, limits.MaxBody); limit > 0 {
+			if r.ContentLength > limit {
+				http.Error(w, fmt.Sprintf("Request body exceeds %d bytes", limit), http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+
+		// Not every ResponseWriter supports deadlines, such as recorders
+		rc := http.NewResponseController(w)
+		timeout := limits.timeout(r)
+		if timeout <= 0 {
+			rc.SetWriteDeadline(time.Time{})
+			next.ServeHTTP(w, r)
+			return
+		}
+		rc.SetWriteDeadline(time.Now().Add(timeout + limits.WriteTimeout))
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// parsePathLimits reads comma separated path=value pairs, such as
+// /query=10s,/admin/import=2m, over the given defaults
+func parsePathLimits[T any](list string, defaults map[string]T, parse func(string) (T, error)) (map[string]T, error) {
+	limits := make(map[string]T, len(defaults))
+	for path, limit := range defaults {
+		limits[path] = limit
+	}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		path, value, ok := strings.Cut(item, "=")
+		if !ok || !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("invalid limit %q, expected /path=value", item)
+		}
+		limit, err := parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid limit %q: %w", item, err)
+		}
+		limits[path] = limit
+	}
+	return limits, nil
+}
+
+// parseByteSize reads a size in bytes, with an optional KiB, MiB or GiB
+// suffix
+func parseByteSize(v string) (int64, error) {
+	unit := int64(1)
+	for suffix, size := range map[string]int64{"KiB": 1 << 10, "MiB": 1 << 20, "GiB": 1 << 30} {
+		if trimmed, ok := strings.CutSuffix(v, suffix); ok {
+			v, unit = trimmed, size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", v)
+	}
+	return n * unit, nil
+}
+
+// parseTimeout reads a non-negative duration
+func parseTimeout(v string) (time.Duration, error) {
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid timeout %q", v)
+	}
+	return d, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testLimits(t *testing.T) *RequestLimits {
+	t.Helper()
+	timeouts, err := parsePathLimits("/query=10s,/events=1m", defaultHandlerTimeouts, parseTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bodies, err := parsePathLimits("/schemas=2KiB", defaultBodyLimits, parseByteSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &RequestLimits{Timeout: 30 * time.Second, Timeouts: timeouts, MaxBody: 16, BodyLimits: bodies, WriteTimeout: time.Second}
+}
+
+func TestRequestLimitsDeadlines(t *testing.T) {
+	limits := testLimits(t)
+	for path, want := range map[string]time.Duration{
+		"/event":                               30 * time.Second,
+		"/query":                               10 * time.Second,
+		"/events/abc":                          time.Minute,
+		"/events/stream":                       0,
+		"/events?wait_for=5&timeout=2m":        3 * time.Minute,
+		"/events?wait_for=5":                   time.Minute + defaultWaitTimeout,
+		"/events/stream?wait_for=5&timeout=1m": 0,
+	} {
+		var deadline time.Time
+		var ok bool
+		h := withRequestLimits(limits, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			deadline, ok = r.Context().Deadline()
+		}))
+		start := time.Now()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		if want == 0 {
+			if ok {
+				t.Errorf("%s: expected no deadline, got %v", path, deadline)
+			}
+			continue
+		}
+		if got := deadline.Sub(start); !ok || got < want-time.Second || got > want+time.Second {
+			t.Errorf("%s: expected a deadline in %v, got %v", path, want, got)
+		}
+	}
+}
+
+func TestRequestLimitsBodies(t *testing.T) {
+	limits := testLimits(t)
+	var readErr error
+	h := withRequestLimits(limits, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, readErr = io.ReadAll(r.Body)
+	}))
+
+	// A declared length over the limit is refused before the handler runs
+	w := httptest.NewRecorder()
+	readErr = nil
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/event", strings.NewReader(strings.Repeat("x", 17))))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413, got %d", w.Code)
+	}
+
+	// A body of unknown length is cut at the limit
+	r := httptest.NewRequest(http.MethodPost, "/event", io.NopCloser(strings.NewReader(strings.Repeat("x", 17))))
+	r.ContentLength = -1
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	var tooLarge *http.MaxBytesError
+	if !errors.As(readErr, &tooLarge) || tooLarge.Limit != 16 {
+		t.Errorf("Expected the body cut at 16 bytes, got %v", readErr)
+	}
+
+	for path, size := range map[string]int{"/schemas": 2048, "/admin/import": 64 << 20, "/event": 16} {
+		readErr = nil
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(strings.Repeat("x", min(size, 4096)))))
+		if w.Code != http.StatusOK || readErr != nil {
+			t.Errorf("%s: expected a body of %d bytes accepted, got %d %v", path, min(size, 4096), w.Code, readErr)
+		}
+	}
+}
+
+func TestParsePathLimits(t *testing.T) {
+	if size, err := parseByteSize("3MiB"); err != nil || size != 3<<20 {
+		t.Errorf("Expected 3 MiB, got %d %v", size, err)
+	}
+	for _, list := range []string{"query=1s", "/query", "/query=-1s", "/query=soon"} {
+		if _, err := parsePathLimits(list, defaultHandlerTimeouts, parseTimeout); err == nil {
+			t.Errorf("%s: expected an error", list)
+		}
+	}
+	limits, err := parsePathLimits("/events/stream=1h", defaultHandlerTimeouts, parseTimeout)
+	if err != nil || limits["/events/stream"] != time.Hour || defaultHandlerTimeouts["/events/stream"] != 0 {
+		t.Errorf("Expected the default overridden without changing it, got %v %v", limits, err)
+	}
+}
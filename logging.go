@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// parseLogLevel maps a level name from configuration to a slog level
+func parseLogLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", name)
+	}
+	return level, nil
+}
+
+// newLogger builds the server logger from configuration. Logs go to stderr
+// unless a file is configured, in which case it is rotated by size.
+func newLogger(cfg *Config) (*slog.Logger, error) {
+	return newLoggerTo(cfg, os.Stderr, new(slog.LevelVar))
+}
+
+// newLoggerTo is newLogger writing to stderr instead of os.Stderr, at a
+// level that can be changed later through level
+func newLoggerTo(cfg *Config, stderr io.Writer, level *slog.LevelVar) (*slog.Logger, error) {
+	parsed, err := parseLogLevel(cfg.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	level.Set(parsed)
+
+	out := stderr
+	if cfg.LogFile != "" {
+		out = &lumberjack.Logger{
+			Filename:   cfg.LogFile,
+			MaxSize:    cfg.LogMaxSizeMB,
+			MaxBackups: cfg.LogMaxBackups,
+			Compress:   true,
+		}
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(cfg.LogFormat) {
+	case "json":
+		handler = slog.NewJSONHandler(out, opts)
+	case "text":
+		handler = slog.NewTextHandler(out, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", cfg.LogFormat)
+	}
+
+	return slog.New(handler).With("node_id", cfg.NodeID), nil
+}
+
+// eventAttrs are the attributes logged for every recorded event
+func eventAttrs(e Event) []any {
+	attrs := []any{
+		"event_id", e.ID,
+		"lamport_timestamp", e.Timestamp,
+	}
+	if e.Epoch != 0 {
+		attrs = append(attrs, "epoch", e.Epoch)
+	}
+	if e.RequestID != "" {
+		attrs = append(attrs, "request_id", e.RequestID)
+	}
+	return attrs
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEventLogsAreStructured(t *testing.T) {
+	var buf bytes.Buffer
+	server := NewServer()
+	server.logger = slog.New(slog.NewJSONHandler(&buf, nil)).With("node_id", "node-a")
+
+	server.logEvent("evt-1", "Structured")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected a JSON log line, got %q: %v", buf.String(), err)
+	}
+
+	expected := map[string]interface{}{
+		"msg":               "Event logged",
+		"node_id":           "node-a",
+		"event_id":          "evt-1",
+		"lamport_timestamp": float64(1),
+		"message":           "Structured",
+	}
+	for key, value := range expected {
+		if entry[key] != value {
+			t.Errorf("Expected %s to be %v, got %v", key, value, entry[key])
+		}
+	}
+}
+
+func TestNewLoggerWritesToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	logger, err := newLogger(&Config{
+		NodeID:        "node-b",
+		LogLevel:      "warn",
+		LogFormat:     "json",
+		LogFile:       path,
+		LogMaxSizeMB:  1,
+		LogMaxBackups: 1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	logger.Info("filtered out")
+	logger.Warn("kept")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	out := string(data)
+	if strings.Contains(out, "filtered out") {
+		t.Error("Expected info message to be filtered at warn level")
+	}
+	if !strings.Contains(out, `"msg":"kept"`) || !strings.Contains(out, `"node_id":"node-b"`) {
+		t.Errorf("Expected warn message with node ID in log file, got %q", out)
+	}
+}
+
+func TestNewLoggerRejectsInvalidConfig(t *testing.T) {
+	if _, err := newLogger(&Config{LogLevel: "loud", LogFormat: "json"}); err == nil {
+		t.Error("Expected unknown level to be rejected")
+	}
+	if _, err := newLogger(&Config{LogLevel: "info", LogFormat: "xml"}); err == nil {
+		t.Error("Expected unknown format to be rejected")
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec"
+)
+
+// Ordering is the causal relation between two logical times. It is the
+// codec type, so clocks outside this package, such as the fakes of
+// clocktest, implement LogicalClock too.
+type Ordering = codec.Ordering
+
+// LogicalClock is implemented by the clocks a process can stamp events
+// with. Stamps travel in encoded form, so processes only need to agree on
+// the kind of clock.
+type LogicalClock interface {
+	// LocalEvent records an internal event
+	LocalEvent()
+	// Send records a send event and returns the stamp to attach to the
+	// message
+	Send() []byte
+	// Receive records the receipt of a message carrying stamp
+	Receive(stamp []byte) error
+	// Compare relates two stamps returned by Send
+	Compare(a, b []byte) (Ordering, error)
+}
+
+var (
+	_ LogicalClock = (*LamportClock)(nil)
+	_ LogicalClock = (*VectorClock)(nil)
+	_ LogicalClock = (*IntervalTreeClock)(nil)
+	_ LogicalClock = (*BloomClock)(nil)
+)
+
+// LocalEvent is Tick for the LogicalClock interface
+func (lc *LamportClock) LocalEvent() {
+	lc.TickTime()
+}
+
+// Send ticks and returns the time in codec encoding
+func (lc *LamportClock) Send() []byte {
+	// Encoding a Timestamp cannot fail
+	stamp, _ := lc.TickTime().wire().MarshalBinary()
+	return stamp
+}
+
+// Receive decodes a stamp and merges it through the jump guard
+func (lc *LamportClock) Receive(stamp []byte) error {
+	var t codec.Timestamp
+	if err := t.UnmarshalBinary(stamp); err != nil {
+		return err
+	}
+	_, err := lc.UpdateChecked(clockTimeFromWire(t))
+	return err
+}
+
+// Compare orders two stamps by time. Lamport timestamps cannot detect
+// concurrency, so distinct times are always before or after.
+func (lc *LamportClock) Compare(a, b []byte) (Ordering, error) {
+	var ta, tb codec.Timestamp
+	if err := ta.UnmarshalBinary(a); err != nil {
+		return "", fmt.Errorf("stamp a: %w", err)
+	}
+	if err := tb.UnmarshalBinary(b); err != nil {
+		return "", fmt.Errorf("stamp b: %w", err)
+	}
+	switch clockTimeFromWire(ta).Compare(clockTimeFromWire(tb)) {
+	case -1:
+		return relationBefore, nil
+	case 1:
+		return relationAfter, nil
+	default:
+		return relationEqual, nil
+	}
+}
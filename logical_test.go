@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/clocktest"
+)
+
+func TestLamportClockAsLogicalClock(t *testing.T) {
+	var a, b LogicalClock = NewLamportClock(), NewLamportClock()
+
+	a.LocalEvent()
+	sent := a.Send()
+	if err := b.Receive(sent); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.(*LamportClock).GetTime(); got != 3 {
+		t.Errorf("Expected receiver at 3, got %d", got)
+	}
+
+	// Concurrent events still come out ordered: Lamport time cannot tell
+	other := NewLamportClock().Send()
+	if ordering, _ := a.Compare(other, sent); ordering != relationBefore {
+		t.Errorf("Expected %s, got %s", relationBefore, ordering)
+	}
+	if ordering, _ := a.Compare(sent, sent); ordering != relationEqual {
+		t.Errorf("Expected %s, got %s", relationEqual, ordering)
+	}
+	if _, err := a.Compare([]byte{0x80}, sent); err == nil {
+		t.Errorf("Expected an error for a truncated stamp")
+	}
+}
+
+func TestFakeClockAsLogicalClock(t *testing.T) {
+	var fake LogicalClock = clocktest.New()
+	lamport := NewLamportClock()
+
+	// Stamps travel both ways between the fake and the real clock
+	if err := lamport.Receive(fake.Send()); err != nil || lamport.GetTime() != 2 {
+		t.Errorf("Expected the real clock at 2, got %d (err: %v)", lamport.GetTime(), err)
+	}
+	if err := fake.Receive(lamport.Send()); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.(*clocktest.Clock).Now(); got != 4 {
+		t.Errorf("Expected the fake clock at 4, got %d", got)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWaitTimeout = 30 * time.Second
+	maxWaitTimeout     = 5 * time.Minute
+)
+
+// notifier wakes everyone waiting for a change. The channel is only made
+// once somebody waits, so notifying without waiters does not allocate.
+type notifier struct {
+	ch    chan struct{}
+	mutex sync.Mutex
+}
+
+// C returns a channel that is closed on the next Notify
+func (n *notifier) C() <-chan struct{} {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if n.ch == nil {
+		n.ch = make(chan struct{})
+	}
+	return n.ch
+}
+
+// Notify wakes the current waiters
+func (n *notifier) Notify() {
+	n.mutex.Lock()
+	if n.ch != nil {
+		close(n.ch)
+		n.ch = nil
+	}
+	n.mutex.Unlock()
+}
+
+// waitFor blocks until done reports true, re-checking it on every change,
+// and returns false if ctx ends first. Waiters register before checking, so
+// a change between the check and the wait is not missed.
+func waitFor(ctx context.Context, changes *notifier, done func() bool) bool {
+	for {
+		ch := changes.C()
+		if done() {
+			return true
+		}
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// parseWait reads the long polling parameters wait_for, a timestamp in the
+// current epoch, and timeout. ok is false when the request does not wait.
+func parseWait(r *http.Request, epoch int64) (target ClockTime, timeout time.Duration, ok bool, err error) {
+	query := r.URL.Query()
+	v := query.Get("wait_for")
+	if v == "" {
+		return ClockTime{}, 0, false, nil
+	}
+	ts, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || ts < 0 {
+		return ClockTime{}, 0, false, errors.New("Invalid wait_for")
+	}
+
+	timeout = defaultWaitTimeout
+	if v := query.Get("timeout"); v != "" {
+		if timeout, err = time.ParseDuration(v); err != nil || timeout <= 0 || timeout > maxWaitTimeout {
+			return ClockTime{}, 0, false, errors.New("Invalid timeout, expected a duration up to 5m")
+		}
+	}
+	return ClockTime{Epoch: epoch, Timestamp: ts}, timeout, true, nil
+}
+
+// Wait blocks until the clock is past target or ctx ends, and reports
+// whether the clock got there
+func (lc *LamportClock) Wait(ctx context.Context, target ClockTime) bool {
+	return waitFor(ctx, &lc.changes, func() bool {
+		return target.Before(lc.Now())
+	})
+}
+
+// waitForEvents blocks until the log holds an event stamped after target
+// or ctx ends
+func (s *Server) waitForEvents(ctx context.Context, target ClockTime) bool {
+	return waitFor(ctx, &s.logged, func() bool {
+		s.mutex.RLock()
+		defer s.mutex.RUnlock()
+		return target.Before(s.latest)
+	})
+}
+
+// longPoll applies the wait_for and timeout parameters of a read request.
+// It reports whether the response may be written, with timedOut set when
+// the wait ended without the condition being met.
+func (s *Server) longPoll(w http.ResponseWriter, r *http.Request, wait func(context.Context, ClockTime) bool) (timedOut, ok bool) {
+	target, timeout, waiting, err := parseWait(r, s.clock.Now().Epoch)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false, false
+	}
+	if !waiting {
+		return false, true
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	// Answer early on shutdown, like event streams, so the server drains
+	go func() {
+		select {
+		case <-s.broker.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	if wait(ctx, target) {
+		return false, true
+	}
+	if r.Context().Err() != nil {
+		return true, false // the client went away
+	}
+	return true, true
+}
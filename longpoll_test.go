@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeWaitFor(t *testing.T) {
+	server := NewServer()
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		w := httptest.NewRecorder()
+		server.handleGetTime(w, httptest.NewRequest(http.MethodGet, "/time?wait_for=2&timeout=5s", nil))
+		done <- w
+	}()
+
+	server.clock.Tick()
+	server.clock.Tick()
+	select {
+	case <-done:
+		t.Fatal("Expected the request to wait until the clock passes 2")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	server.clock.Update(5)
+	select {
+	case w := <-done:
+		var response map[string]interface{}
+		json.NewDecoder(w.Body).Decode(&response)
+		if response["lamport_timestamp"] != float64(6) || response["timed_out"] != nil {
+			t.Errorf("Expected the time after the update, got %v", response)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the request to return once the clock passed 2")
+	}
+}
+
+func TestTimeWaitForTimesOut(t *testing.T) {
+	server := NewServer()
+	start := time.Now()
+	w := httptest.NewRecorder()
+	server.handleGetTime(w, httptest.NewRequest(http.MethodGet, "/time?wait_for=10&timeout=30ms", nil))
+
+	var response map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&response)
+	if w.Code != http.StatusOK || response["timed_out"] != true || time.Since(start) < 30*time.Millisecond {
+		t.Errorf("Expected the current time after the timeout, got %d %v", w.Code, response)
+	}
+
+	for _, target := range []string{"/time?wait_for=x", "/time?wait_for=1&timeout=1h", "/time?wait_for=-1"} {
+		w := httptest.NewRecorder()
+		server.handleGetTime(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", target, w.Code)
+		}
+	}
+}
+
+func TestEventsWaitFor(t *testing.T) {
+	server := NewServer()
+	server.logEvent("e1", "Before")
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		w := httptest.NewRecorder()
+		server.handleGetEvents(w, httptest.NewRequest(http.MethodGet, "/events?wait_for=1&timeout=5s", nil))
+		done <- w
+	}()
+
+	// Moving the clock alone does not answer, a new event does
+	server.clock.Tick()
+	select {
+	case <-done:
+		t.Fatal("Expected the request to wait for an event after 1")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	server.logEvent("e2", "After")
+	select {
+	case w := <-done:
+		var response eventsResponse
+		json.NewDecoder(w.Body).Decode(&response)
+		if len(response.Events) != 2 || response.Events[1].ID != "e2" {
+			t.Errorf("Expected both events, got %+v", response.Events)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the request to return on the new event")
+	}
+}
+
+func TestWaitForShutdown(t *testing.T) {
+	server := NewServer()
+	server.broker.Shutdown()
+
+	w := httptest.NewRecorder()
+	start := time.Now()
+	server.handleGetEvents(w, httptest.NewRequest(http.MethodGet, "/events?wait_for=100", nil))
+	if time.Since(start) > time.Second || w.Code != http.StatusOK {
+		t.Errorf("Expected an answer right away on shutdown, got %d after %v", w.Code, time.Since(start))
+	}
+}
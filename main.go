@@ -1,48 +1,113 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"math"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
 	"sync"
+	"syscall"
 	"time"
+
+	"github.com/graph-gophers/graphql-go"
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/hooks"
+	"golang.org/x/term"
+	"google.golang.org/protobuf/proto"
 )
 
 // LamportClock represents a Lamport logical clock
 type LamportClock struct {
 	timestamp int64
+	epoch     int64
+	rollover  int64 // timestamp at which the clock moves to the next epoch
+	guard     JumpGuard
+	changes   notifier         // wakes long polls whenever the time changes
+	hooks     *hooks.Registry  // notified of ticks and merges, nil for virtual clocks
+	history   *ClockHistory    // transitions with their causes, nil for virtual clocks
+	wall      func() time.Time // stamps the transitions in the history
+	trace     *ClockTrace      // records every operation, nil unless tracing
+	frozen    bool             // ticks and merges leave the clock alone, see Freeze
 	mutex     sync.RWMutex
 }
 
-// NewLamportClock creates a new Lamport clock initialized to 0
-func NewLamportClock() *LamportClock {
-	return &LamportClock{
+// NewLamportClock creates a new Lamport clock initialized to 0, configured
+// by opts
+func NewLamportClock(opts ...ClockOption) *LamportClock {
+	lc := &LamportClock{
 		timestamp: 0,
+		rollover:  defaultRollover,
+		wall:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(lc)
 	}
+	return lc
 }
 
 // Tick increments the logical clock for a local event
 func (lc *LamportClock) Tick() int64 {
+	return lc.TickTime().Timestamp
+}
+
+// TickTime is Tick returning the epoch along with the timestamp
+func (lc *LamportClock) TickTime() ClockTime {
+	return lc.tick(ClockSource{})
+}
+
+// tick is TickTime recording what caused the event
+func (lc *LamportClock) tick(src ClockSource) ClockTime {
 	lc.mutex.Lock()
-	defer lc.mutex.Unlock()
+	from := lc.nowLocked()
+	lc.incrementLocked()
+	lc.recordLocked(from, causeTick, ClockTime{}, false, src)
+	now := lc.nowLocked()
+	lc.mutex.Unlock()
 
-	lc.timestamp++
-	return lc.timestamp
+	lc.ticked(now)
+	return now
 }
 
 // Update updates the clock when receiving a message with a timestamp
 // This implements the Lamport algorithm: max(local_time, received_time) + 1
 func (lc *LamportClock) Update(receivedTimestamp int64) int64 {
+	return lc.updateInEpoch(receivedTimestamp).Timestamp
+}
+
+// UpdateTime applies the Lamport rule to an (epoch, timestamp) pair
+func (lc *LamportClock) UpdateTime(received ClockTime) ClockTime {
 	lc.mutex.Lock()
-	defer lc.mutex.Unlock()
+	from := lc.nowLocked()
+	lc.mergeLocked(received)
+	lc.recordLocked(from, causeUpdate, received, false, ClockSource{})
+	now := lc.nowLocked()
+	lc.mutex.Unlock()
 
-	if receivedTimestamp > lc.timestamp {
-		lc.timestamp = receivedTimestamp
-	}
-	lc.timestamp++
-	return lc.timestamp
+	lc.updated(received, now)
+	return now
+}
+
+// updateInEpoch applies a timestamp that belongs to the current epoch
+func (lc *LamportClock) updateInEpoch(receivedTimestamp int64) ClockTime {
+	lc.mutex.Lock()
+	from := lc.nowLocked()
+	received := ClockTime{Epoch: lc.epoch, Timestamp: receivedTimestamp}
+	lc.mergeLocked(received)
+	lc.recordLocked(from, causeUpdate, received, false, ClockSource{})
+	now := lc.nowLocked()
+	lc.mutex.Unlock()
+
+	lc.updated(received, now)
+	return now
 }
 
 // GetTime returns the current logical time (read-only)
@@ -52,67 +117,376 @@ func (lc *LamportClock) GetTime() int64 {
 	return lc.timestamp
 }
 
+// Now returns the current epoch and timestamp (read-only)
+func (lc *LamportClock) Now() ClockTime {
+	lc.mutex.RLock()
+	defer lc.mutex.RUnlock()
+	return lc.nowLocked()
+}
+
+func (lc *LamportClock) nowLocked() ClockTime {
+	return ClockTime{Epoch: lc.epoch, Timestamp: lc.timestamp}
+}
+
+// mergeLocked takes the maximum of local and received time, then increments
+func (lc *LamportClock) mergeLocked(received ClockTime) {
+	lc.maxLocked(received)
+	lc.incrementLocked()
+}
+
+// maxLocked moves the clock up to received if it is ahead
+func (lc *LamportClock) maxLocked(received ClockTime) {
+	if lc.frozen {
+		return
+	}
+	if received.Epoch > lc.epoch {
+		lc.epoch = received.Epoch
+		lc.timestamp = received.Timestamp
+	} else if received.Epoch == lc.epoch && received.Timestamp > lc.timestamp {
+		lc.timestamp = received.Timestamp
+	} else {
+		return
+	}
+	lc.changes.Notify()
+}
+
+// incrementLocked advances the clock by one, starting a new epoch instead of
+// overflowing once the rollover threshold is reached
+func (lc *LamportClock) incrementLocked() {
+	if lc.frozen {
+		return
+	}
+	if lc.timestamp >= lc.rollover {
+		lc.epoch++
+		lc.timestamp = 0
+	}
+	lc.timestamp++
+	lc.changes.Notify()
+}
+
 // Event represents a timestamped event
 type Event struct {
 	ID        string    `json:"id"`
 	Message   string    `json:"message"`
 	Timestamp int64     `json:"lamport_timestamp"`
+	Epoch     int64     `json:"epoch,omitempty"`
 	WallTime  time.Time `json:"wall_time"`
+
+	// Type, SchemaVersion and Payload carry structured application data.
+	// Payloads are validated against the schema registered for their type.
+	Type          string          `json:"type,omitempty"`
+	SchemaVersion int             `json:"schema_version,omitempty"`
+	Payload       json.RawMessage `json:"payload,omitempty"`
+
+	// Metadata holds free-form labels that stream subscribers can filter on
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// RequestID is the ID of the HTTP request that created the event
+	RequestID string `json:"request_id,omitempty"`
+
+	// Node is the ID of the node that recorded the event
+	Node string `json:"node,omitempty"`
+
+	// Sender and SentAt describe the message a receive event was produced by
+	Sender string     `json:"sender,omitempty"`
+	SentAt *ClockTime `json:"sent_at,omitempty"`
+
+	// Backfilled marks events imported from legacy data whose Lamport
+	// timestamp was derived from their wall time instead of the live clock
+	Backfilled bool `json:"backfilled,omitempty"`
+
+	// Signature is the recording node's Ed25519 signature over the ID, time
+	// and message, made with the key whose fingerprint is KeyID
+	Signature string `json:"signature,omitempty"`
+	KeyID     string `json:"key_id,omitempty"`
+
+	// InvalidSignature marks events produced by a message whose signature
+	// did not verify, accepted under the flag policy
+	InvalidSignature bool `json:"invalid_signature,omitempty"`
+
+	// PrevHash is the Hash of the previous event in the log and Hash the
+	// SHA-256 hash of this one, chaining the log to make it tamper-evident
+	PrevHash string `json:"prev_hash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
 }
 
 // Server holds the Lamport clock and event log
 type Server struct {
-	clock  *LamportClock
-	events []Event
-	mutex  sync.RWMutex
+	clock   *LamportClock
+	events  EventStore
+	metrics *Metrics
+	kv      *KVStore
+	queue   *CausalQueue
+	schemas *SchemaRegistry
+	broker  *EventBroker
+	clocks  *ClockRegistry
+	tenants *Tenants // nil when virtual clocks are not tenant scoped
+	nodeID  string
+	ties    TieBreaker       // orders events with equal timestamps
+	peers   *Peers           // nil when running standalone
+	replica *RaftLog         // nil unless the log is replicated through Raft
+	elector *Election        // nil when running standalone
+	monitor *FailureDetector // nil when running standalone
+	signer  *Signer          // nil unless events are signed or verified
+	pii     *Redactor        // nil unless personal data is redacted
+	audit   *AuditLog        // administrative actions
+	head    string           // hash of the newest event in the log
+	split   *Partition       // simulated network partition
+	chaos   *Chaos           // faults injected into peer requests
+	latest  ClockTime        // newest time of any event in the log
+	logged  notifier         // wakes long polls on /events
+	hooks   *hooks.Registry  // notified of clock activity and new events
+	logger  *slog.Logger
+	mutex   sync.RWMutex
+
+	annotations *AnnotationStore    // labels attached to logged events
+	txs         *Transactions       // open groups of events
+	skew        *SkewTracker        // wall and Lamport time of recent events, nil when disabled
+	propagation *PropagationTracker // delay of messages from each peer
+	seen        *SeenMessages       // recent messages by origin, nil when not deduplicated
+
+	mux        *http.ServeMux // routes of the API
+	prefix     string         // path the routes are served under
+	limiter    *RateLimiter   // per client rate limit, nil when not limited
+	ingest     *Ingest        // queue of appends, nil when disabled
+	adminToken string         // guards admin endpoints when set
+	denyAdmin  bool           // admin endpoints refuse requests without the admin token
+	peerCerts  bool           // inter-node endpoints require client certificates
+	access     *AccessControl // roles of API keys and tokens, nil when endpoints are not role based
+	features   *Features      // feature flags of experimental subsystems
+
+	graphql *graphql.Schema // schema of /graphql, bound to the server
 }
 
-// NewServer creates a new server with a Lamport clock
-func NewServer() *Server {
-	return &Server{
-		clock:  NewLamportClock(),
-		events: make([]Event, 0),
+// NewServer creates a new server with a Lamport clock, configured by opts.
+// The server is an http.Handler serving its API, so it can run on its own
+// or be mounted in another application.
+func NewServer(opts ...ServerOption) *Server {
+	metrics := NewMetrics()
+	s := &Server{
+		clock:   NewLamportClock(),
+		hooks:   hooks.NewRegistry(),
+		events:  NewShardedStore(defaultEventShards),
+		metrics: metrics,
+		kv:      NewKVStore(),
+		queue:   NewCausalQueue(),
+		schemas: NewSchemaRegistry(),
+		broker:  NewEventBroker(metrics),
+		logger:  slog.Default(),
+		ties:    NodeTieBreaker,
+		split:   NewPartition(),
+		chaos:   NewChaos(metrics),
+		audit:   NewAuditLog(),
+
+		annotations: NewAnnotationStore(),
+		txs:         NewTransactions(),
+		skew:        NewSkewTracker(defaultSkewSamples),
+		propagation: NewPropagationTracker(),
+		seen:        NewSeenMessages(defaultDedupEntries),
+		features:    NewFeatures(metrics),
 	}
-}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.mux == nil {
+		s.mux = http.NewServeMux()
+	}
+	s.clock.hooks = s.hooks
+	if s.clock.history == nil {
+		s.clock.history = NewClockHistory(defaultClockHistory)
+	}
+	// Virtual clocks follow the jump guard of the main clock
+	s.clocks = NewClockRegistry(s.clock.JumpGuard, ClockLimits{})
 
-// logEvent creates and logs an event with Lamport timestamp
-func (s *Server) logEvent(id, message string) Event {
-	timestamp := s.clock.Tick()
+	s.metrics.GaugeFunc("lamport_clock_timestamp", "Current Lamport timestamp", func() float64 {
+		return float64(s.clock.GetTime())
+	})
+	s.metrics.Counter("lamport_rejected_updates_total", "Received timestamps rejected by the max jump guard")
+	s.metrics.Counter("lamport_clamped_updates_total", "Received timestamps clamped by the max jump guard")
+	s.metrics.Counter("lamport_jump_alerts_total", "Received timestamps accepted despite exceeding max jump")
+	s.metrics.Counter("lamport_rate_limited_total", "Requests rejected by the per client rate limit")
+	s.metrics.Counter("lamport_bridge_received_total", "Messages merged from message brokers")
+	s.metrics.Counter("lamport_bridge_rejected_total", "Broker messages rejected for missing or invalid timestamps")
+	s.metrics.Counter("lamport_bridge_published_total", "Local events published to message brokers")
+	s.metrics.Counter("lamport_duplicate_messages_total", "Messages received again by another path and ignored")
+	s.metrics.Counter("lamport_signature_failures_total", "Received signatures that did not verify")
+	s.metrics.GaugeFunc("lamport_events_dropped", "Events overwritten to stay within -event-capacity or rolled up", func() float64 {
+		return float64(s.events.Dropped())
+	})
+	s.metrics.Counter("lamport_partition_dropped_total", "Requests dropped by a simulated partition")
+	s.metrics.Counter("lamport_annotation_conflicts_total", "Event annotation updates rejected by If-Match")
 
-	event := Event{
-		ID:        id,
-		Message:   message,
-		Timestamp: timestamp,
-		WallTime:  time.Now(),
+	s.resumeLog()
+	s.registerRoutes()
+	return s
+}
+
+// appendEvent adds an event to the log and notifies stream subscribers.
+// It returns the event as stored, redacted, attributed to this node unless
+// it names the node that proposed it and chained to the previous event.
+// Events of this node are signed when signing is enabled. An event the
+// store failed to write is not logged, and the error is returned.
+func (s *Server) appendEvent(event Event) (Event, error) {
+	event = s.pii.Redact(event)
+	if event.Node == "" {
+		event.Node = s.nodeID
+	}
+	if event.Node == s.nodeID {
+		event = s.sign(event)
 	}
 
 	s.mutex.Lock()
-	s.events = append(s.events, event)
+	unlock := s.syncHeadLocked()
+	head := s.head
+	event = s.chainLocked(event)
+	err := appendChecked(s.events, event)
+	unlock()
+	if err != nil {
+		s.head = head
+		s.mutex.Unlock()
+		return Event{}, err
+	}
+	s.observeLocked(event)
+	s.skew.record(ClockTime{Epoch: event.Epoch, Timestamp: event.Timestamp}, time.Now())
 	s.mutex.Unlock()
+	s.logged.Notify()
+
+	s.broker.Publish(event)
+	if s.hooks.Enabled() {
+		s.hooks.Event(event.wire())
+	}
+	return event, nil
+}
 
-	log.Printf("Event logged: %s (Lamport: %d)", message, timestamp)
+// observeLocked keeps track of the newest event time in the log
+func (s *Server) observeLocked(e Event) {
+	if t := (ClockTime{Epoch: e.Epoch, Timestamp: e.Timestamp}); s.latest.Before(t) {
+		s.latest = t
+	}
+}
+
+// logEvent creates and logs an event with Lamport timestamp. Failures of
+// the store are reported by the store.
+func (s *Server) logEvent(id, message string) Event {
+	event, _ := s.recordLocal(Event{ID: id, Message: message})
 	return event
 }
 
+// recordLocal stamps a local event with a fresh timestamp and appends it.
+// While the store refuses writes no timestamp is taken.
+func (s *Server) recordLocal(event Event) (Event, error) {
+	if err := storeWriteErr(s.events); err != nil {
+		return Event{}, err
+	}
+	now := s.clock.tick(ClockSource{RequestID: event.RequestID})
+	event.Timestamp = now.Timestamp
+	event.Epoch = now.Epoch
+	event.WallTime = time.Now()
+
+	event, err := s.appendEvent(event)
+	if err != nil {
+		return Event{}, err
+	}
+
+	// Building the attributes allocates, so skip it when nobody listens
+	if s.logger.Enabled(context.Background(), slog.LevelInfo) {
+		s.logger.Info("Event logged", append(eventAttrs(event), "message", event.Message)...)
+	}
+	return event, nil
+}
+
 // processMessage simulates processing a message from another node
 func (s *Server) processMessage(receivedTimestamp int64, message string) Event {
 	// Update our clock based on received timestamp
-	newTimestamp := s.clock.Update(receivedTimestamp)
+	now := s.clock.updateInEpoch(receivedTimestamp)
+	event, _ := s.recordMessage(context.Background(), "", ClockTime{Epoch: now.Epoch, Timestamp: receivedTimestamp}, now, message)
+	return event
+}
 
-	event := Event{
-		ID:        fmt.Sprintf("msg-%d", newTimestamp),
-		Message:   fmt.Sprintf("Processed: %s", message),
-		Timestamp: newTimestamp,
+// receiveMessage processes a message from an untrusted source, applying the
+// clock's jump guard before the timestamp is merged. The sender is optional.
+// A message naming its sender and the ID of its event at the sender is
+// processed once; copies return ErrDuplicateMessage with the event the
+// first one produced. In Raft mode the event is committed through the
+// replicated log.
+func (s *Server) receiveMessage(ctx context.Context, sender, id string, received ClockTime, message string) (Event, error) {
+	if sender == "" || id == "" {
+		return s.mergeMessage(ctx, sender, received, message)
+	}
+	key := messageKey{origin: sender, sent: received, id: id}
+	if event, ok := s.seen.claim(key); !ok {
+		return event, ErrDuplicateMessage
+	}
+	event, err := s.mergeMessage(ctx, sender, received, message)
+	if err != nil {
+		s.seen.forget(key)
+		return Event{}, err
+	}
+	s.seen.done(key, event)
+	return event, nil
+}
+
+func (s *Server) mergeMessage(ctx context.Context, sender string, received ClockTime, message string) (Event, error) {
+	if s.replica != nil {
+		return s.replica.ProposeMessage(ctx, sender, received, message)
+	}
+	// While the store refuses writes the clock is left as it is
+	if err := storeWriteErr(s.events); err != nil {
+		return Event{}, err
+	}
+	now, err := s.clock.updateFrom(received, ClockSource{Peer: sender, RequestID: requestIDFrom(ctx)})
+	if err != nil {
+		return Event{}, err
+	}
+	return s.recordMessage(ctx, sender, received, now, message)
+}
+
+// messageID names the event of a message received at now
+func messageID(now ClockTime) string {
+	var buf [48]byte
+	id := append(buf[:0], "msg-"...)
+	if now.Epoch > 0 {
+		id = strconv.AppendInt(id, now.Epoch, 10)
+		id = append(id, '-')
+	}
+	return string(strconv.AppendInt(id, now.Timestamp, 10))
+}
+
+// localEventID names a local event by the wall time it was created at
+func localEventID(prefix string, t time.Time) string {
+	var buf [48]byte
+	return string(strconv.AppendInt(append(buf[:0], prefix...), t.UnixNano(), 10))
+}
+
+// messageEvent is the event produced by a message received at now
+func (s *Server) messageEvent(ctx context.Context, sender string, received, now ClockTime, message string) Event {
+	return Event{
+		ID:        messageID(now),
+		Message:   "Processed: " + message,
+		Timestamp: now.Timestamp,
+		Epoch:     now.Epoch,
 		WallTime:  time.Now(),
+		RequestID: requestIDFrom(ctx),
+		Sender:    sender,
+		SentAt:    &received,
+
+		InvalidSignature: invalidSignatureFrom(ctx),
 	}
+}
 
-	s.mutex.Lock()
-	s.events = append(s.events, event)
-	s.mutex.Unlock()
+// recordMessage appends the event produced by a received message
+func (s *Server) recordMessage(ctx context.Context, sender string, received, now ClockTime, message string) (Event, error) {
+	event, err := s.appendEvent(s.messageEvent(ctx, sender, received, now, message))
+	if err != nil {
+		return Event{}, err
+	}
 
-	log.Printf("Message processed: %s (Received: %d, New: %d)",
-		message, receivedTimestamp, newTimestamp)
-	return event
+	if s.logger.Enabled(ctx, slog.LevelInfo) {
+		s.logger.Info("Message processed", append(eventAttrs(event),
+			"message", event.Message,
+			"received_timestamp", received.Timestamp)...)
+	}
+	return event, nil
 }
 
 // HTTP Handlers
@@ -123,16 +497,60 @@ func (s *Server) handleCreateEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	message := r.URL.Query().Get("message")
-	if message == "" {
-		message = "Local event"
+	event, ok, err := decodeEventBody(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+	if !ok {
+		event.Message = r.URL.Query().Get("message")
+	}
+
+	event, err = s.createEvent(r.Context(), event)
+	switch {
+	case errors.Is(err, ErrInvalidPayload):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		s.writeCommitError(w, err)
+		return
+	}
+
+	writeEvent(w, r, event)
+}
 
-	eventID := fmt.Sprintf("event-%d", time.Now().UnixNano())
-	event := s.logEvent(eventID, message)
+// createEvent records a local event with the message, type, payload and
+// metadata of event, once its payload matches the schema of its type
+func (s *Server) createEvent(ctx context.Context, event Event) (Event, error) {
+	event, err := s.localEvent(ctx, event)
+	if err != nil {
+		return Event{}, err
+	}
+	event.ID = localEventID("event-", time.Now())
+	return s.commitLocal(event)
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(event)
+// localEvent checks an event sent by a client, /event or a transaction,
+// against the schema of its type. It keeps only the fields clients set:
+// identity and timing are always assigned by the server.
+func (s *Server) localEvent(ctx context.Context, event Event) (Event, error) {
+	if event.Message == "" {
+		event.Message = "Local event"
+	}
+	if event.Type != "" && event.SchemaVersion == 0 {
+		event.SchemaVersion = s.schemas.Latest(event.Type)
+	}
+	if err := s.schemas.Validate(event.Type, event.SchemaVersion, event.Payload); err != nil {
+		return Event{}, err
+	}
+	return Event{
+		Message:       event.Message,
+		Type:          event.Type,
+		SchemaVersion: event.SchemaVersion,
+		Payload:       event.Payload,
+		Metadata:      event.Metadata,
+		RequestID:     requestIDFrom(ctx),
+	}, nil
 }
 
 func (s *Server) handleReceiveMessage(w http.ResponseWriter, r *http.Request) {
@@ -141,24 +559,63 @@ func (s *Server) handleReceiveMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	received, message, err := parseMessageParams(r, s.clock.Now().Epoch)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// A signing sender names the event it sent and its signature
+	query := r.URL.Query()
+	ctx, err := s.checkSignature(r.Context(), "receive", query.Get("key_id"), query.Get("signature"), query.Get("id"), received, message)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Rejected message: %v", err), http.StatusUnprocessableEntity)
+		return
+	}
+
+	event, err := s.receiveMessage(ctx, query.Get("sender"), query.Get("id"), received, message)
+	switch {
+	case errors.Is(err, ErrDuplicateMessage) && event.ID == "":
+		http.Error(w, "Duplicate message still being processed", http.StatusConflict)
+		return
+	case errors.Is(err, ErrDuplicateMessage):
+		// Answered like the first copy, so retries are idempotent
+		s.metrics.Inc("lamport_duplicate_messages_total", "transport", "http")
+		w.Header().Set(headerDuplicate, "true")
+	case errors.Is(err, ErrJumpTooLarge):
+		http.Error(w, "Timestamp jump exceeds max_jump", http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		s.writeCommitError(w, err)
+		return
+	}
+
+	writeEvent(w, r, event)
+}
+
+// parseMessageParams reads the timestamp, optional epoch and message of a
+// received message. Peers that do not know about epochs are assumed to be in
+// the current one.
+func parseMessageParams(r *http.Request, currentEpoch int64) (ClockTime, string, error) {
 	timestampStr := r.URL.Query().Get("timestamp")
 	message := r.URL.Query().Get("message")
 
 	if timestampStr == "" || message == "" {
-		http.Error(w, "Missing timestamp or message parameter", http.StatusBadRequest)
-		return
+		return ClockTime{}, "", errors.New("Missing timestamp or message parameter")
 	}
 
 	timestamp, err := strconv.ParseInt(timestampStr, 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid timestamp", http.StatusBadRequest)
-		return
+		return ClockTime{}, "", errors.New("Invalid timestamp")
 	}
 
-	event := s.processMessage(timestamp, message)
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(event)
+	received := ClockTime{Epoch: currentEpoch, Timestamp: timestamp}
+	if epochStr := r.URL.Query().Get("epoch"); epochStr != "" {
+		if received.Epoch, err = strconv.ParseInt(epochStr, 10, 64); err != nil || received.Epoch < 0 {
+			return ClockTime{}, "", errors.New("Invalid epoch")
+		}
+	}
+	return received, message, nil
 }
 
 func (s *Server) handleGetEvents(w http.ResponseWriter, r *http.Request) {
@@ -167,17 +624,88 @@ func (s *Server) handleGetEvents(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	query := r.URL.Query()
+	order := query.Get("order")
+	if order != "" && order != "log" && order != "total" {
+		http.Error(w, "Invalid order, expected log or total", http.StatusBadRequest)
+		return
+	}
+	// Pages follow the total order, the only one cursors can resume
+	paged := query.Has("limit") || query.Has("cursor") || query.Has("offset")
+	var page PageRequest
+	if paged {
+		if order == "log" {
+			http.Error(w, "Pages are in total order, order=log cannot be paged", http.StatusBadRequest)
+			return
+		}
+		var ok bool
+		if page, ok = parsePage(w, r); !ok {
+			return
+		}
+		order = "total"
+	}
+
+	timedOut, ok := s.longPoll(w, r, s.waitForEvents)
+	if !ok {
+		return
+	}
+	media := negotiate(w, r)
+
+	// The tag is taken before the snapshot, so the body is never older
+	// than the tag it is sent with
 	s.mutex.RLock()
-	events := make([]Event, len(s.events))
-	copy(events, s.events)
+	tagged := order
+	if paged {
+		tagged = fmt.Sprintf("page-%d", page.Limit)
+		if page.Cursor != nil {
+			tagged += "-" + page.Cursor.String()
+		}
+	}
+	tag := eventsETag(s.clock.Now(), s.events.Len(), s.head, tagged)
 	s.mutex.RUnlock()
+	if notModified(w, r, mediaETag(tag, media)) {
+		return
+	}
+
+	var events []Event
+	var next *Cursor
+	if paged {
+		// Events before the cursor are left out before sorting
+		events = s.events.Between(page.from(), ClockTime{Epoch: math.MaxInt64, Timestamp: math.MaxInt64})
+		SortEvents(events, s.ties)
+		events, next = page.Page(events, s.ties)
+	} else {
+		events = s.events.Events()
+		if order == "total" {
+			SortEvents(events, s.ties)
+		}
+	}
+	now := s.clock.Now()
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"current_timestamp": s.clock.GetTime(),
-		"events":            events,
+	fields := map[string]interface{}{
+		"current_timestamp": now.Timestamp,
+		"epoch":             now.Epoch,
 		"event_count":       len(events),
-	})
+		"dropped_count":     s.events.Dropped(),
+	}
+	if paged {
+		fields["event_count"], fields["count"], fields["limit"] = s.events.Len(), len(events), page.Limit
+		if next != nil {
+			fields["next_cursor"] = next.String()
+		}
+		setNextLink(w, r, next)
+	}
+	if timedOut {
+		fields["timed_out"] = true
+	}
+	if media != mediaJSON {
+		fields["events"] = events
+		writeAs(w, media, fields, func() proto.Message {
+			return eventListMessage(now, events, s.events.Dropped(), timedOut)
+		})
+		return
+	}
+	writeEventStream(w, r, fields, events)
 }
 
 func (s *Server) handleGetTime(w http.ResponseWriter, r *http.Request) {
@@ -186,48 +714,794 @@ func (s *Server) handleGetTime(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"lamport_timestamp": s.clock.GetTime(),
-		"wall_time":         time.Now(),
+	timedOut, ok := s.longPoll(w, r, s.clock.Wait)
+	if !ok {
+		return
+	}
+	media := negotiate(w, r)
+	now := s.clock.Now()
+	if notModified(w, r, mediaETag(timeETag(now), media)) {
+		return
+	}
+
+	wall := time.Now()
+	response := map[string]interface{}{
+		"lamport_timestamp": now.Timestamp,
+		"epoch":             now.Epoch,
+		"wall_time":         wall,
+		"node_id":           s.nodeID,
+	}
+	if timedOut {
+		response["timed_out"] = true
+	}
+
+	writeAs(w, media, response, func() proto.Message {
+		return timeMessage(now, wall, s.nodeID, timedOut)
 	})
 }
 
 func main() {
-	server := NewServer()
+	cfg, err := parseConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+	if cfg.ReplayFile != "" {
+		report, err := replayTraceFile(cfg.ReplayFile, os.Stdout)
+		if err != nil {
+			log.Fatal("Failed to replay trace: ", err)
+		}
+		if report.Divergence != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// The TUI shows the newest log lines itself instead of scrolling over them
+	var logs *logTail
+	var stderr io.Writer = os.Stderr
+	if cfg.TUI {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			log.Fatal("-tui needs an interactive terminal")
+		}
+		if cfg.LogFile == "" {
+			logs = newLogTail()
+			stderr = logs
+		}
+	}
+	logLevel := new(slog.LevelVar)
+	logger, err := newLoggerTo(cfg, stderr, logLevel)
+	if err != nil {
+		log.Fatal("Invalid logging configuration: ", err)
+	}
+	fatal := func(msg string, err error) {
+		logger.Error(msg, "error", err)
+		os.Exit(1)
+	}
+
+	var events EventStore = NewShardedStore(cfg.EventShards)
+	if cfg.EventCapacity > 0 {
+		events = NewRingStore(cfg.EventCapacity)
+	}
+	if cfg.EventCompression > 0 {
+		events = NewCompressedStore(cfg.EventCompression)
+	}
+	server := NewServer(WithNodeID(cfg.NodeID), WithLogger(logger), WithStore(events))
+	server.ties = cfg.TieBreaker
+	server.adminToken = cfg.AdminToken
+	server.denyAdmin = cfg.AdminDenyDefault
+	if err := server.features.enable(cfg.Features); err != nil {
+		fatal("Invalid features", err)
+	}
+	if cfg.AuditFile != "" {
+		if server.audit, err = OpenAuditLog(cfg.AuditFile); err != nil {
+			fatal("Failed to open audit log", err)
+		}
+		defer server.audit.Close()
+	}
+	if cfg.RolesFile != "" || cfg.JWTSecret != "" {
+		var roles []RoleConfig
+		if cfg.RolesFile != "" {
+			if roles, err = LoadRoles(cfg.RolesFile); err != nil {
+				fatal("Failed to load roles", err)
+			}
+		}
+		if server.access, err = NewAccessControl(roles, []byte(cfg.JWTSecret), cfg.AnonymousRoles); err != nil {
+			fatal("Invalid roles", err)
+		}
+		logger.Info("Endpoints are role based", "api_key_holders", len(roles), "jwt", cfg.JWTSecret != "")
+	}
+	server.peerCerts = cfg.TLSEnabled() && cfg.TLSCAFile != ""
+	// Persistent stores keep event messages and payloads encrypted
+	encrypted := func(st EventStore) EventStore { return st }
+	if cfg.EncryptionKeyEnv != "" || cfg.EncryptionKeyCommand != "" {
+		source := EnvKeySource(cfg.EncryptionKeyEnv)
+		if cfg.EncryptionKeyCommand != "" {
+			source = CommandKeySource(cfg.EncryptionKeyCommand)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), clusterTimeout)
+		cipher, err := LoadEventCipher(ctx, source)
+		cancel()
+		if err != nil {
+			fatal("Failed to load encryption keys", err)
+		}
+		encrypted = func(st EventStore) EventStore { return NewEncryptedStore(st, cipher, logger) }
+	}
+	var eventDB *SQLiteStore
+	if cfg.EventDB != "" {
+		if eventDB, err = OpenSQLiteStore(cfg.EventDB, logger); err != nil {
+			fatal("Failed to open event database", err)
+		}
+		defer eventDB.Close()
+		server.events = encrypted(eventDB)
+		server.resumeLog()
+	}
+	var clockStorage ClockStorage
+	if cfg.ClockFile != "" {
+		clockStorage = clockFile(cfg.ClockFile)
+	}
+	if cfg.EventPostgres != "" {
+		eventPostgres, err := OpenPostgresStore(context.Background(), cfg.EventPostgres, logger)
+		if err != nil {
+			fatal("Failed to open PostgreSQL event store", err)
+		}
+		defer eventPostgres.Close()
+		server.events = encrypted(eventPostgres)
+		server.resumeLog()
+		clockStorage = eventPostgres
+	}
+	var wal *WALStore
+	if cfg.WALFile != "" {
+		if wal, err = OpenWALStore(cfg.WALFile, server.events, cfg.WALSync, server.metrics, logger); err != nil {
+			fatal("Failed to open write-ahead log", err)
+		}
+		defer wal.Close()
+		server.events = encrypted(wal)
+		server.resumeLog()
+		clockStorage = wal
+	}
+	server.clock.history = nil
+	if cfg.ClockHistory > 0 {
+		server.clock.history = NewClockHistory(cfg.ClockHistory)
+	}
+	if cfg.TraceFile != "" {
+		trace, err := OpenClockTrace(cfg.TraceFile)
+		if err != nil {
+			fatal("Failed to open trace file", err)
+		}
+		defer trace.Close()
+		if err := trace.Record(server.clock, cfg.NodeID); err != nil {
+			fatal("Failed to start trace", err)
+		}
+	}
+	server.skew = nil
+	if cfg.SkewSamples > 0 {
+		server.skew = NewSkewTracker(cfg.SkewSamples)
+	}
+	server.seen = nil
+	if cfg.DedupEntries > 0 {
+		server.seen = NewSeenMessages(cfg.DedupEntries)
+	}
+	if err := server.loadHooks(cfg.HookPlugins); err != nil {
+		fatal("Invalid hook plugin", err)
+	}
+	// Nodes that may be joined at runtime need a peer set even when empty
+	var transport Transport
+	if len(cfg.Peers) > 0 || cfg.Join != "" || cfg.AdvertiseURL != "" {
+		client, err := newPeerClient(cfg)
+		if err != nil {
+			fatal("Invalid peer TLS configuration", err)
+		}
+		if transport, err = newTransport(cfg, client); err != nil {
+			fatal("Failed to start peer transport", err)
+		}
+		server.peers = NewPeersOver(cfg.Peers, transport)
+		server.peers.node = cfg.NodeID
+		server.peers.partitioned = server.partitioned
+		server.peers.chaos = server.chaos
+		server.peers.clock = server.clock.Now
+		server.peers.token = cfg.PeerToken
+	}
+	server.clock.SetJumpGuard(JumpGuard{
+		MaxJump:     cfg.MaxJump,
+		Policy:      cfg.MaxJumpPolicy,
+		OnViolation: server.recordJumpViolation,
+	})
+	if cfg.SigningKey != "" || cfg.TrustedKeys != "" {
+		if server.signer, err = LoadSigner(cfg); err != nil {
+			fatal("Failed to load signing keys", err)
+		}
+		logger.Info("Event signatures enabled", "key_id", server.signer.KeyID(), "policy", string(cfg.SignaturePolicy))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Background workers run until the HTTP server has drained
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	var background sync.WaitGroup
+
+	if wal != nil {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			wal.Run(bgCtx, cfg.WALSyncInterval)
+		}()
+	}
+
+	if server.clock.trace != nil {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			server.clock.trace.Run(bgCtx)
+		}()
+	}
+
+	// Resume the clock before anything can tick it
+	if clockStorage != nil {
+		persister := NewClockPersisterTo(clockStorage, server.clock, cfg.ClockPersistInterval, logger)
+		resumed, err := persister.Restore(cfg.ClockSafetyMargin)
+		if err != nil {
+			fatal("Failed to restore clock", err)
+		}
+		logger.Info("Clock restored", "lamport_timestamp", resumed.Timestamp, "epoch", resumed.Epoch)
+
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			persister.Run(bgCtx)
+		}()
+	}
+
+	if cfg.RedactionFile != "" {
+		redactor, err := LoadRedactor(cfg.RedactionFile, server.metrics)
+		if err != nil {
+			fatal("Failed to load redaction rules", err)
+		}
+		server.pii = redactor
+		logger.Info("Events are redacted", "rules", len(redactor.rules))
+	}
+
+	if cfg.TenantsFile != "" {
+		tenants, err := LoadTenants(cfg.TenantsFile, server.metrics, server.clock.JumpGuard)
+		if err != nil {
+			fatal("Failed to load tenants", err)
+		}
+		server.tenants = tenants
+		logger.Info("Virtual clocks are tenant scoped", "tenants", len(tenants.list))
+
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			tenants.Run(bgCtx)
+		}()
+	}
+
+	// In Raft mode the event log is only appended to by committed entries
+	var replica *RaftLog
+	if cfg.RaftDir != "" {
+		if replica, err = OpenRaftLog(cfg, server); err != nil {
+			fatal("Failed to start Raft", err)
+		}
+		logger.Info("Raft consensus mode enabled", "raft_addr", cfg.RaftAddr, "bootstrap", cfg.RaftBootstrap)
+	}
+
+	// The failure detector watches the peers for the subsystems below
+	var detector *FailureDetector
+	if server.peers != nil {
+		detector = NewFailureDetector(server, cfg.HeartbeatInterval, cfg.SuspectAfter, cfg.DeadAfter)
+		server.monitor = detector
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			detector.Run(bgCtx)
+		}()
+	}
+
+	// The peers elect a coordinator among themselves
+	var election *Election
+	if server.peers != nil {
+		election = NewElection(server, cfg.ElectionInterval, cfg.ElectionTimeout)
+		election.watch(detector)
+		server.elector = election
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			election.Run(bgCtx)
+		}()
+	}
+
+	// Total order multicast needs the whole group, so it runs with peers
+	var multicast *Multicast
+	if server.peers != nil {
+		multicast = NewMulticast(server)
+		multicast.watch(detector)
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			multicast.Run(bgCtx)
+		}()
+	}
+
+	// Messages sent to a single peer are delivered exactly once
+	var channels *Channels
+	if server.peers != nil {
+		if channels, err = NewChannels(server, cfg.SendFile); err != nil {
+			fatal("Failed to load send state", err)
+		}
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			channels.Run(bgCtx, cfg.SendRetry)
+		}()
+	}
+
+	// Messages written with their events are dispatched to peers
+	var outbox *Outbox
+	if server.peers != nil {
+		if outbox, err = NewOutbox(server, cfg.OutboxFile); err != nil {
+			fatal("Failed to load outbox", err)
+		}
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			outbox.Run(bgCtx, cfg.OutboxInterval)
+		}()
+	}
+
+	// Webhooks are registered at runtime, so the workers always run
+	webhooks := NewWebhooks(server, cfg.WebhookAttempts, cfg.WebhookBackoff)
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		webhooks.Run(bgCtx)
+	}()
+	timers := NewClockTimers(server, webhooks)
+
+	rollups := NewRollups(server, cfg.RollupAge, cfg.RollupBucket)
+	if cfg.RollupAge > 0 {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			rollups.Run(bgCtx, cfg.RollupInterval)
+		}()
+	}
+	var archiver *Archiver
+	if cfg.ArchiveURL != "" {
+		objects, err := OpenObjectStore(cfg.ArchiveURL, cfg.ArchiveEndpoint)
+		if err != nil {
+			fatal("Invalid archive configuration", err)
+		}
+		archiver = NewArchiver(server, objects, cfg.ArchiveAge, cfg.ArchiveSegment)
+		if err := archiver.Load(ctx); err != nil {
+			fatal("Failed to list archived segments", err)
+		}
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			archiver.Run(bgCtx, cfg.ArchiveInterval)
+		}()
+	}
+
+	// Scheduled events wait for the clock, so the scheduler always runs
+	scheduler := NewScheduler(server)
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		scheduler.Run(bgCtx)
+	}()
+
+	var membership *Membership
+	if server.peers != nil {
+		membership = NewMembership(server, multicast)
+	}
+
+	// Logs are reconciled with the peers, except in Raft mode where they
+	// are replicated already
+	var antiEntropy *AntiEntropy
+	if server.peers != nil && replica == nil {
+		antiEntropy = NewAntiEntropy(server, cfg.SyncBucket)
+		if cfg.SyncInterval > 0 {
+			background.Add(1)
+			go func() {
+				defer background.Done()
+				antiEntropy.Run(bgCtx, cfg.SyncInterval)
+			}()
+		}
+	}
+
+	// Message broker bridges stop before the clock is persisted for the
+	// last time, so their final merges are saved
+	bridgeCtx, stopBridges := context.WithCancel(context.Background())
+	var bridges sync.WaitGroup
+
+	if cfg.NATSURL != "" {
+		conn, err := connectNATS(cfg, logger)
+		if err != nil {
+			fatal("Failed to connect to NATS", err)
+		}
+		bridge := NewNATSBridge(conn, server, cfg.NATSSubject, cfg.NATSPublishSubject)
+		bridges.Add(1)
+		go func() {
+			defer bridges.Done()
+			if err := bridge.Run(bridgeCtx); err != nil {
+				logger.Error("NATS bridge failed", "error", err)
+			}
+		}()
+	}
+
+	if len(cfg.KafkaBrokers) > 0 {
+		bridge := NewKafkaBridge(cfg, server)
+		bridges.Add(1)
+		go func() {
+			defer bridges.Done()
+			if err := bridge.Run(bridgeCtx); err != nil {
+				logger.Error("Kafka bridge failed", "error", err)
+			}
+		}()
+	}
+
+	if cfg.MQTTBroker != "" {
+		bridge := NewMQTTBridge(cfg, server)
+		bridges.Add(1)
+		go func() {
+			defer bridges.Done()
+			bridge.Run(bridgeCtx)
+		}()
+	}
+
+	if cfg.UDPAddr != "" {
+		udp, err := ListenUDP(cfg.UDPAddr, cfg.UDPPeers, cfg.UDPInterval, server)
+		if err != nil {
+			fatal("Failed to start UDP listener", err)
+		}
+		logger.Info("UDP clock synchronization enabled", "addr", udp.Addr().String(), "peers", len(cfg.UDPPeers))
+		server.HandleFunc("/udp/stats", udp.handleStats)
+		bridges.Add(1)
+		go func() {
+			defer bridges.Done()
+			udp.Run(bridgeCtx)
+		}()
+	}
+
+	if cfg.TextAddr != "" {
+		// The text protocol is served over TLS like the HTTP port
+		var textTLS *tls.Config
+		if cfg.TLSEnabled() {
+			var err error
+			if textTLS, err = serverTLSConfig(cfg); err != nil {
+				fatal("Invalid TLS configuration", err)
+			}
+		}
+		text, err := ListenText(cfg.TextAddr, cfg.Limits.Timeout, textTLS, server)
+		if err != nil {
+			fatal("Failed to start text protocol listener", err)
+		}
+		logger.Info("Text protocol enabled", "addr", text.Addr().String())
+		bridges.Add(1)
+		go func() {
+			defer bridges.Done()
+			text.Run(bridgeCtx)
+		}()
+	}
+
+	// State-changing requests are rate limited per client
+	server.limiter = NewRateLimiter(cfg.RateLimit, cfg.RateBurst, cfg.RateLimitByAPIKey)
+	server.limiter.known = server.knownAPIKey
+	limit := server.limit
+
+	// Appends wait in a bounded queue rather than piling up under overload
+	if cfg.IngestQueue > 0 {
+		server.ingest = NewIngest(cfg.IngestQueue, cfg.IngestWorkers, cfg.IngestTimeout, server.metrics)
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			server.ingest.Run(bgCtx)
+		}()
+	}
+
+	// SIGHUP reloads the configuration, as POST /admin/reload does
+	reloader := NewReloader(server, os.Args[1:], cfg, logLevel)
+	if cfg.RollupAge > 0 {
+		reloader.rollups = rollups
+	}
+	reloader.archiver = archiver
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		for {
+			select {
+			case <-bgCtx.Done():
+				return
+			case <-hangup:
+				if _, _, err := reloader.Reload(); err != nil {
+					logger.Error("Failed to reload configuration", "error", err)
+				}
+			}
+		}
+	}()
 
 	// Set up HTTP routes
-	http.HandleFunc("/event", server.handleCreateEvent)
-	http.HandleFunc("/message", server.handleReceiveMessage)
-	http.HandleFunc("/events", server.handleGetEvents)
-	http.HandleFunc("/time", server.handleGetTime)
+	server.HandleFunc("/events/rollups", rollups.handleRollups)
+	server.HandleFunc("/events/rollups/", rollups.handleRollups)
+	if archiver != nil {
+		server.HandleFunc("/events/archive", archiver.handleArchive)
+		server.HandleFunc("/events/archive/restore/", server.admin(archiver.handleRestore))
+	}
+	server.HandleFunc("/schedule", limit(scheduler.handleSchedule))
+	server.HandleFunc("/schedule/", limit(scheduler.handleCancelScheduled))
+	if server.signer != nil {
+		server.HandleFunc("/keys", server.handleKeys)
+	}
+	if multicast != nil {
+		server.HandleFunc("/multicast", limit(multicast.handleMulticast))
+		server.HandleFunc("/peer/multicast", limit(server.fromPeer(multicast.handlePeerMulticast)))
+		server.HandleFunc("/peers/matrix", multicast.handleMatrix)
+	}
+	if channels != nil {
+		server.HandleFunc("/send", limit(channels.handleSend))
+		server.HandleFunc("/peer/send", limit(server.fromPeer(channels.handlePeerSend)))
+	}
+	if outbox != nil {
+		server.HandleFunc("/outbox", limit(outbox.handleOutbox))
+	}
+	if membership != nil {
+		server.HandleFunc("/cluster/join", limit(server.fromPeer(membership.handleChange(memberJoin))))
+		server.HandleFunc("/cluster/leave", limit(server.fromPeer(membership.handleChange(memberLeave))))
+		server.HandleFunc("/cluster/members", membership.handleMembers)
+		server.HandleFunc("/peer/membership", limit(server.fromPeer(membership.handlePeerMembership)))
+	}
+	if antiEntropy != nil {
+		server.HandleFunc("/cluster/sync", limit(antiEntropy.handleSync))
+		server.HandleFunc("/peer/sync/digest", server.fromPeer(antiEntropy.handlePeerDigest))
+		server.HandleFunc("/peer/sync/events", limit(server.fromPeer(antiEntropy.handlePeerEvents)))
+	}
+	if election != nil {
+		server.HandleFunc("/cluster/leader", election.handleLeader)
+		server.HandleFunc("/cluster/health", detector.handleHealth)
+		server.HandleFunc("/peer/election", limit(server.fromPeer(election.handlePeerElection)))
+	}
+	if eventDB != nil {
+		server.HandleFunc("/query", server.admin(eventDB.handleQuery))
+	}
+	if replica != nil {
+		server.HandleFunc("/raft/status", replica.handleStatus)
+	} else {
+		// Raft commits events one by one, so it cannot keep a group together
+		server.HandleFunc("/tx/", limit(server.handleTx))
+	}
+	server.HandleFunc("/webhooks", server.admin(webhooks.handleWebhooks))
+	server.HandleFunc("/webhooks/deliveries", server.admin(webhooks.handleDeliveries))
+	server.HandleFunc("/timers", server.admin(timers.handleTimers))
+	server.HandleFunc("/timers/", server.admin(timers.handleTimer))
+	server.HandleFunc("/admin/reload", server.admin(reloader.handleReload))
+	if cfg.Pprof {
+		server.registerProfiling()
+	}
 
 	// Welcome endpoint
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	server.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, `Lamport Timestamp Server
 
-Available endpoints:
-- POST /event?message=<msg>     : Create a local event
-- POST /message?timestamp=<ts>&message=<msg> : Process received message
-- GET  /events                  : Get all events with timestamps
-- GET  /time                    : Get current Lamport timestamp
+Available endpoints, served under /v1 (the paths without it are deprecated):
+- POST /event?message=<msg>     : Create a local event (or JSON body with type/payload)
+- POST /message?timestamp=<ts>&message=<msg>[&epoch=<e>][&sender=<id>][&id=<id>][&signature=<sig>&key_id=<key>] : Process received message once per sender and event ID
+- GET  /events[?order=total][&limit=<n>][&cursor=<c>][&wait_for=<ts>&timeout=<d>] : Get all events with timestamps, in log or total order, or a page of them
+- GET  /events/stream           : Stream new events (SSE), filters: contains, id_prefix, min_timestamp, meta.<key>
+- GET  /events/graph?format=dot|json : Happened-before graph of the log
+- GET  /events/verify           : Replay the hash chain of the log and report the first corruption
+- GET  /events/root             : Merkle root over the log
+- GET  /events/<id>             : One event by ID
+- PATCH /events/<id>            : Annotate an event, with If-Match: <lamport_ts>
+- GET  /events/<id>/annotations : Annotations of an event with their version
+- GET  /events/<id>/proof       : Inclusion proof of an event against the current root
+- GET  /events/search?contains=<text>[&limit=<n>] : Events whose message contains a text
+- GET  /events/at/<ts>[?epoch=<e>] : Events stamped with a Lamport timestamp
+- GET  /events/range/<from>/<to>[?epoch=<e>] : Events stamped from one timestamp to another, inclusive
+- GET  /events/rollups[/<from>/<to>][?epoch=<e>] : Counts of the events rolled up with -rollup-age
+- GET  /events/archive         : Segments of events archived with -archive-url
+- POST /events/archive/restore/<from>/<to>[?epoch=<e>] : Archived events of a range of timestamps
+- GET  /compare?a=<id>&b=<id>   : Whether a happened before, after or concurrently with b
+- POST /tx/begin                : Open a transaction
+- POST /tx/<id>/event           : Log an event under a transaction
+- POST /tx/<id>/commit          : Append the events of a transaction with consecutive timestamps
+- POST /tx/<id>/abort           : Drop the events of a transaction
+- GET  /tx/<id>                 : Events held back under a transaction
+- GET  /cluster/events[?limit=<n>][&cursor=<c>] : Merged, totally ordered history of this node and its peers
+- POST /broadcast?message=<msg>[&quorum=<n>|majority] : Send a message to every peer with a single tick
+- GET  /cluster/leader          : Coordinator elected among the peers (with -peers)
+- POST /cluster/join?node=<id>&url=<url> : Register a node with the cluster
+- POST /cluster/leave?node=<id>&url=<url> : Deregister a node
+- GET  /cluster/members         : Current peers
+- GET  /cluster/health          : Failure detector state of every peer
+- POST /cluster/sync[?peer=<id>] : Reconcile the log with a peer, or all of them
+- GET  /time[?wait_for=<ts>&timeout=<d>] : Get current Lamport timestamp
+- GET  /clock/history[?at=<ts>][&cause=<c>][&peer=<id>][&request_id=<id>][&limit=<n>] : Recent clock transitions and their causes
+- GET  /analytics/skew[?window=<d>][&interval=<d>][&burst=<rate>][&idle=<d>] : Tick rates, bursts and idle periods against wall time
+- GET  /analytics/propagation[?peer=<id>] : Wall and logical delay of the messages from each peer, with histograms
+- GET  /analytics/summary[?ticks=<n>][&wall=<d>][&top=<n>] : Event counts per node, type and time bucket, top talkers and propagation delay
+- GET  /analytics/memory : Heap in use and the compression of the event log
+- GET|POST /graphql        : GraphQL queries of events, clock, peers and analytics; subscriptions over SSE
+- POST /lamport.v1.Clock/<Tick|Update|StreamEvents> : Clock service over gRPC, gRPC-Web and Connect
+- GET  /keys                    : Public signing key and trusted key IDs (with -signing-key or -trusted-keys)
+- GET  /ui/                     : Web dashboard
+- GET  /metrics                 : Prometheus metrics
+- GET  /healthz, /readyz        : Liveness and readiness probes
+- GET  /debug/pprof/            : Runtime profiles and execution traces (with -pprof)
+- GET  /openapi.json            : OpenAPI 3 description of this API
+- GET  /udp/stats               : UDP synchronization statistics (with -udp-addr)
+- POST /schemas                 : Register a JSON Schema for an event type
+- PUT  /kv/<key>                : Write a last-writer-wins register
+- GET  /kv/<key>                : Read a register
+- GET  /clocks                   : List virtual clocks
+- POST /clocks/<name>/tick[?message=<msg>] : Local event on a virtual clock
+- POST /clocks/<name>/message?timestamp=<ts>&message=<msg> : Message received by a virtual clock
+- GET  /clocks/<name>/time, /clocks/<name>/events : Time and log of a virtual clock
+- POST /queue?sender=<id>&timestamp=<ts>&prev=<ts>&message=<msg> : Causally ordered delivery
+- GET  /queue/pending           : Messages waiting for their predecessors
+- POST /schedule                : Log an event once the clock reaches deliver_at_ts (JSON body)
+- GET  /schedule                : Events waiting for their scheduled time
+- DELETE /schedule/<id>         : Cancel a scheduled event
+- POST /multicast?message=<msg> : Send to all peers for delivery in total order (with -peers)
+- GET  /multicast               : Total order queue and retained messages
+- GET  /peers/matrix            : Matrix clock of the multicast group
+- POST /send?peer=<url|id>&message=<msg> : Send a message to one peer exactly once (with -peers)
+- GET  /send[?peer=<url>]       : Messages sent to peers and not acknowledged yet
+- POST /outbox                  : Log an event with messages to send after it (JSON body, with -peers)
+- GET  /outbox[?status=<s>]     : Outbox messages and their delivery
+- GET  /raft/status             : Raft state, leader and log indexes (with -raft-dir)
+- POST /query                   : Read-only SQL on the events table (JSON: sql, args; with -event-db)
+- POST /admin/import            : Backfill legacy events (JSON array body)
+- POST /admin/clock/reset       : Reset the clock to 0
+- POST /admin/clock/set?value=<n>[&force=true] : Set the clock
+- POST /admin/clock/advance?n=<n> : Advance the clock by n ticks
+- POST /admin/clock/freeze      : Stop ticks and merges from moving the clock
+- POST /admin/clock/resume      : Let ticks and merges move the clock again
+- GET  /admin/tenants           : Tenant usage and quotas
+- POST /admin/partition?groups=a,b|c : Simulate a partition between nodes or virtual clocks
+- POST /admin/heal              : Heal the simulated partition
+- POST /admin/chaos?delay=<d>&jitter=<d>&drop=<p>&duplicate=<p> : Inject faults into peer requests
+- POST /admin/replay           : Replay a clock trace recorded with -trace-file (JSON lines body)
+- GET  /admin/features          : Experimental features, POST ?name=<f>&enabled=<bool> toggles one
+- POST /admin/reload           : Re-read the configuration and apply the changes safe at runtime
+- GET  /admin/audit[?actor=<a>&action=<prefix>&since=<seq>&limit=<n>] : Administrative actions
+- POST /webhooks : Register a webhook receiving new events (JSON: url, filter, secret)
+- GET /webhooks/deliveries[?webhook=<id>&status=<s>] : Show recent webhook deliveries
+- POST /timers : Call a URL once the clock reaches a timestamp (JSON: url, at or after, secret)
+- GET /timers : Timers waiting for their time
+- DELETE /timers/<id> : Cancel a timer
 
 Example usage:
-curl -X POST "http://localhost:8080/event?message=User login"
-curl -X POST "http://localhost:8080/message?timestamp=5&message=External event"
-curl http://localhost:8080/events
+curl -X POST "http://localhost:8080/v1/event?message=User login"
+curl -X POST "http://localhost:8080/v1/message?timestamp=5&message=External event"
+curl http://localhost:8080/v1/events
 `)
 	})
 
+	if cfg.AdminToken == "" {
+		logger.Warn("No -admin-token set, admin endpoints are unauthenticated")
+	}
+
+	// Every route is served under /v1/ and, deprecated, without the prefix
+	routes := withRequestLimits(&cfg.Limits, server)
+	api := NewAPIVersions(routes, cfg.LegacySunset, server.metrics)
+	api.Handle(apiVersion, routes)
+	var handler http.Handler = api
+	if cfg.PathPrefix != "" {
+		api.base = cfg.PathPrefix
+		handler = http.StripPrefix(cfg.PathPrefix, api)
+	}
+
+	handler = withRequestID(handler)
+	if transport != nil {
+		if err := transport.Receive(withRequestID(routes)); err != nil {
+			fatal("Failed to start peer transport", err)
+		}
+		defer transport.Close()
+	}
+	if len(cfg.CORS.Origins) > 0 {
+		handler = withCORS(&cfg.CORS, handler)
+	}
+
 	// Start server
-	port := ":8080"
-	log.Printf("Starting Lamport timestamp server on port %s", port)
-	log.Printf("Visit http://localhost%s for usage instructions", port)
+	httpServer := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		// Handlers set their own write deadlines, within their timeout
+		WriteTimeout: cfg.Limits.Timeout + cfg.Limits.WriteTimeout,
+	}
+	// HTTP/2 without TLS too, for the gRPC clients of the Clock service
+	httpServer.Protocols = new(http.Protocols)
+	httpServer.Protocols.SetHTTP1(true)
+	httpServer.Protocols.SetHTTP2(true)
+	httpServer.Protocols.SetUnencryptedHTTP2(true)
+	httpServer.RegisterOnShutdown(server.broker.Shutdown)
+	scheme := "http"
+	if cfg.TLSEnabled() {
+		tlsConfig, err := serverTLSConfig(cfg)
+		if err != nil {
+			fatal("Invalid TLS configuration", err)
+		}
+		httpServer.TLSConfig = tlsConfig
+		scheme = "https"
+	}
 
-	// Log initial state
-	server.logEvent("init", "Server started")
+	logger.Info("Starting Lamport timestamp server", "addr", cfg.Addr, "peers", len(cfg.Peers))
+	logger.Info(fmt.Sprintf("Visit %s://localhost%s for usage instructions", scheme, cfg.Addr))
+
+	if cfg.Join != "" {
+		joinCtx, cancel := context.WithTimeout(ctx, clusterTimeout)
+		err := membership.JoinCluster(joinCtx, cfg.Join, cfg.AdvertiseURL)
+		cancel()
+		if err != nil {
+			fatal("Failed to join cluster", err)
+		}
+		logger.Info("Joined cluster", "seed", cfg.Join, "peers", len(server.peers.URLs()))
+	}
 
-	if err := http.ListenAndServe(port, nil); err != nil {
-		log.Fatal("Server failed to start:", err)
+	// Log initial state. A replicated log only holds proposals committed
+	// through the leader, so Raft nodes skip it.
+	if replica == nil {
+		server.logEvent("init", "Server started")
 	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if cfg.TLSEnabled() {
+			serveErr <- httpServer.ListenAndServeTLS("", "")
+		} else {
+			serveErr <- httpServer.ListenAndServe()
+		}
+	}()
+
+	// Quitting the TUI shuts the server down
+	if cfg.TUI {
+		go func() {
+			if err := NewTUI(server, logs).Run(ctx); err != nil {
+				logger.Error("Terminal UI failed", "error", err)
+			}
+			stop()
+		}()
+	}
+
+	select {
+	case err := <-serveErr:
+		fatal("Server failed to start", err)
+	case <-ctx.Done():
+	}
+
+	logger.Info("Shutting down")
+	if cfg.Join != "" {
+		leaveCtx, cancel := context.WithTimeout(context.Background(), clusterTimeout)
+		if err := membership.LeaveCluster(leaveCtx, cfg.AdvertiseURL); err != nil {
+			logger.Warn("Failed to leave cluster", "error", err)
+		}
+		cancel()
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Graceful shutdown failed", "error", err)
+	}
+
+	stopBridges()
+	bridges.Wait()
+
+	if replica != nil {
+		if err := replica.Close(); err != nil {
+			logger.Error("Raft shutdown failed", "error", err)
+		}
+	}
+
+	// Background workers flush their state once stopped
+	stopBackground()
+	background.Wait()
 }
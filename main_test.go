@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"sync"
@@ -133,7 +136,7 @@ func TestServerEventCreation(t *testing.T) {
 
 	// Check events are stored
 	server.mutex.RLock()
-	eventCount := len(server.events)
+	eventCount := server.events.Len()
 	server.mutex.RUnlock()
 
 	if eventCount != 2 {
@@ -396,6 +399,55 @@ func BenchmarkConcurrentTicks(b *testing.B) {
 	})
 }
 
+// quietServer logs at the warn level, as busy deployments do, so the
+// benchmarks measure the event path rather than the logger
+func quietServer() *Server {
+	server := NewServer()
+	server.logger = slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	server.events = NewRingStore(1024)
+	return server
+}
+
+func BenchmarkLogEvent(b *testing.B) {
+	server := quietServer()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		server.logEvent("bench", "Benchmark")
+	}
+}
+
+func BenchmarkReceiveMessage(b *testing.B) {
+	server := quietServer()
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		server.receiveMessage(ctx, "b", "", ClockTime{Timestamp: int64(i)}, "Hello")
+	}
+}
+
+func TestHotPathAllocations(t *testing.T) {
+	clock := NewLamportClock()
+	if n := testing.AllocsPerRun(100, func() { clock.TickTime() }); n != 0 {
+		t.Errorf("Expected Tick not to allocate, got %v allocations", n)
+	}
+	if n := testing.AllocsPerRun(100, func() { clock.UpdateTime(ClockTime{Timestamp: 5}) }); n != 0 {
+		t.Errorf("Expected Update not to allocate, got %v allocations", n)
+	}
+	if n := testing.AllocsPerRun(100, func() { messageID(ClockTime{Epoch: 2, Timestamp: 42}) }); n > 1 {
+		t.Errorf("Expected message IDs to allocate only the string, got %v allocations", n)
+	}
+	if got := messageID(ClockTime{Epoch: 2, Timestamp: 42}); got != "msg-2-42" {
+		t.Errorf("Expected msg-2-42, got %s", got)
+	}
+	if got := messageID(ClockTime{Timestamp: 7}); got != "msg-7" {
+		t.Errorf("Expected msg-7, got %s", got)
+	}
+}
+
 // Test helper to verify Lamport timestamp properties
 func TestLamportProperties(t *testing.T) {
 	server := NewServer()
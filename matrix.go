@@ -0,0 +1,145 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// Matrix maps each node to what it knows of every node's clock: row i,
+// column j is the highest timestamp of j that i has received directly
+type Matrix map[string]map[string]int64
+
+// clone returns a deep copy of m
+func (m Matrix) clone() Matrix {
+	c := make(Matrix, len(m))
+	for i, row := range m {
+		c[i] = make(map[string]int64, len(row))
+		for j, t := range row {
+			c[i][j] = t
+		}
+	}
+	return c
+}
+
+// raise sets m[i][j] to t unless it is already higher
+func (m Matrix) raise(i, j string, t int64) {
+	row := m[i]
+	if row == nil {
+		row = make(map[string]int64)
+		m[i] = row
+	}
+	if t > row[j] {
+		row[j] = t
+	}
+}
+
+// MatrixClock tracks what this node knows about what every other node has
+// received. A message from j stamped t that every node's row covers has
+// reached everyone and no longer needs to be kept for anyone.
+type MatrixClock struct {
+	node  string
+	rows  Matrix
+	mutex sync.RWMutex
+}
+
+// NewMatrixClock creates an empty matrix for node
+func NewMatrixClock(node string) *MatrixClock {
+	return &MatrixClock{node: node, rows: Matrix{node: {}}}
+}
+
+// Tick records the node's own time
+func (mc *MatrixClock) Tick(t int64) {
+	mc.mutex.Lock()
+	mc.rows.raise(mc.node, mc.node, t)
+	mc.mutex.Unlock()
+}
+
+// Observe records a message stamped t received directly from a node, along
+// with the matrix it carried. The node's own row only changes through
+// direct receipt: knowing that a peer heard from j does not mean this node
+// did.
+func (mc *MatrixClock) Observe(from string, t int64, theirs Matrix) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	mc.rows.raise(mc.node, from, t)
+	mc.rows.raise(from, from, t)
+	for i, row := range theirs {
+		if i == mc.node {
+			continue
+		}
+		for j, v := range row {
+			mc.rows.raise(i, j, v)
+		}
+	}
+}
+
+// Track adds an empty row and column for a node that joined the group
+func (mc *MatrixClock) Track(node string) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	if node == mc.node {
+		return
+	}
+	if mc.rows[node] == nil {
+		mc.rows[node] = make(map[string]int64)
+	}
+	if _, ok := mc.rows[mc.node][node]; !ok {
+		mc.rows[mc.node][node] = 0
+	}
+}
+
+// Forget drops the row and column of a node that left the group, so it no
+// longer holds back delivery or collection
+func (mc *MatrixClock) Forget(node string) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	if node == mc.node {
+		return
+	}
+	delete(mc.rows, node)
+	for _, row := range mc.rows {
+		delete(row, node)
+	}
+}
+
+// Known returns the highest timestamp received directly from node
+func (mc *MatrixClock) Known(node string) int64 {
+	mc.mutex.RLock()
+	defer mc.mutex.RUnlock()
+	return mc.rows[mc.node][node]
+}
+
+// Nodes returns this node and every node it has heard from, sorted
+func (mc *MatrixClock) Nodes() []string {
+	mc.mutex.RLock()
+	defer mc.mutex.RUnlock()
+	nodes := make([]string, 0, len(mc.rows[mc.node])+1)
+	nodes = append(nodes, mc.node)
+	for j := range mc.rows[mc.node] {
+		if j != mc.node {
+			nodes = append(nodes, j)
+		}
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// Stable reports whether every one of nodes is known to have received the
+// message of sender stamped t
+func (mc *MatrixClock) Stable(sender string, t int64, nodes []string) bool {
+	mc.mutex.RLock()
+	defer mc.mutex.RUnlock()
+	for _, i := range nodes {
+		if mc.rows[i][sender] < t {
+			return false
+		}
+	}
+	return true
+}
+
+// Snapshot returns a copy of the matrix
+func (mc *MatrixClock) Snapshot() Matrix {
+	mc.mutex.RLock()
+	defer mc.mutex.RUnlock()
+	return mc.rows.clone()
+}
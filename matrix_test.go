@@ -0,0 +1,66 @@
+package main
+
+import "testing"
+
+func TestMatrixClockObserve(t *testing.T) {
+	a := NewMatrixClock("a")
+	a.Tick(3)
+
+	// b heard from c at 5 and says so, but a has not heard from c
+	a.Observe("b", 6, Matrix{"b": {"b": 6, "c": 5}, "a": {"a": 100}})
+
+	if got := a.Known("b"); got != 6 {
+		t.Errorf("Expected a to know b at 6, got %d", got)
+	}
+	if got := a.Known("c"); got != 0 {
+		t.Errorf("Expected relayed knowledge to stay out of a's row, got %d", got)
+	}
+	snapshot := a.Snapshot()
+	if snapshot["b"]["c"] != 5 || snapshot["a"]["a"] != 3 {
+		t.Errorf("Expected b's row merged and a's own row kept, got %v", snapshot)
+	}
+
+	nodes := a.Nodes()
+	if len(nodes) != 2 || nodes[0] != "a" || nodes[1] != "b" {
+		t.Errorf("Expected [a b], got %v", nodes)
+	}
+}
+
+func TestMatrixClockStable(t *testing.T) {
+	a := NewMatrixClock("a")
+	a.Tick(2)
+	nodes := []string{"a", "b", "c"}
+
+	a.Observe("b", 3, Matrix{"b": {"a": 2}})
+	if a.Stable("a", 2, nodes) {
+		t.Errorf("Expected a's message unstable before c acknowledged")
+	}
+	a.Observe("c", 4, Matrix{"c": {"a": 2}})
+	if !a.Stable("a", 2, nodes) {
+		t.Errorf("Expected a's message stable once every row covers it")
+	}
+	if a.Stable("b", 3, nodes) {
+		t.Errorf("Expected b's message unstable while c has not reported it")
+	}
+}
+
+func TestMatrixClockForget(t *testing.T) {
+	mc := NewMatrixClock("a")
+	mc.Observe("b", 3, Matrix{"b": {"b": 3, "c": 2}, "c": {"c": 2}})
+	mc.Track("c")
+	if nodes := mc.Nodes(); len(nodes) != 3 {
+		t.Errorf("Expected a, b and c, got %v", nodes)
+	}
+
+	mc.Forget("c")
+	snap := mc.Snapshot()
+	if _, ok := snap["c"]; ok {
+		t.Error("Expected c's row removed")
+	}
+	if _, ok := snap["b"]["c"]; ok {
+		t.Error("Expected c's column removed")
+	}
+	if nodes := mc.Nodes(); len(nodes) != 2 {
+		t.Errorf("Expected a and b, got %v", nodes)
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Membership change kinds
+const (
+	memberJoin  = "join"
+	memberLeave = "leave"
+)
+
+// MembershipChange is a node joining or leaving the cluster. The node that
+// accepted the change stamps it and forwards it to every other member on
+// /peer/membership.
+type MembershipChange struct {
+	Kind      string `json:"kind"`
+	Node      string `json:"node"`
+	URL       string `json:"url"`
+	Origin    string `json:"origin"`
+	Timestamp int64  `json:"lamport_timestamp"`
+	Epoch     int64  `json:"epoch,omitempty"`
+}
+
+// Member is a peer with its node ID, empty for statically configured peers
+// that have not joined through the API
+type Member struct {
+	URL  string `json:"url"`
+	Node string `json:"node,omitempty"`
+}
+
+// Membership lets nodes join and leave the cluster at runtime. Changes are
+// recorded as events of type cluster.join and cluster.leave, and the
+// multicast group grows and shrinks with them.
+type Membership struct {
+	server    *Server
+	multicast *Multicast        // nil when total order multicast is off
+	nodes     map[string]string // peer URL to node ID
+	mutex     sync.Mutex
+}
+
+// NewMembership manages the peers of server
+func NewMembership(server *Server, multicast *Multicast) *Membership {
+	return &Membership{server: server, multicast: multicast, nodes: make(map[string]string)}
+}
+
+// Members returns the peers ordered by URL
+func (ms *Membership) Members() []Member {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	members := []Member{}
+	for _, u := range ms.server.peers.URLs() {
+		members = append(members, Member{URL: u, Node: ms.nodes[u]})
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].URL < members[j].URL })
+	return members
+}
+
+// apply updates the peer list and the multicast group. Changes about this
+// node itself only concern the others.
+func (ms *Membership) apply(kind, node, peer string) {
+	if node == ms.server.nodeID {
+		return
+	}
+	var changed bool
+	ms.mutex.Lock()
+	if kind == memberJoin {
+		changed = ms.server.peers.Add(peer)
+		ms.nodes[peer] = node
+	} else {
+		changed = ms.server.peers.Remove(peer)
+		delete(ms.nodes, peer)
+	}
+	ms.mutex.Unlock()
+
+	if changed && ms.multicast != nil {
+		if kind == memberJoin {
+			ms.multicast.Join(node)
+		} else {
+			ms.multicast.Leave(node)
+		}
+	}
+}
+
+// membershipEvent describes a change in the event log
+func membershipEvent(kind, node, peer string) Event {
+	verb := "joined"
+	if kind == memberLeave {
+		verb = "left"
+	}
+	payload, _ := json.Marshal(Member{URL: peer, Node: node})
+	return Event{
+		Message: fmt.Sprintf("Node %s %s at %s", node, verb, peer),
+		Type:    "cluster." + kind,
+		Payload: payload,
+	}
+}
+
+// Change accepts a node joining or leaving, records it and forwards it to
+// the other members
+func (ms *Membership) Change(ctx context.Context, kind, node, peer string) (MembershipChange, Event, error) {
+	event := membershipEvent(kind, node, peer)
+	event.ID = fmt.Sprintf("member-%d", time.Now().UnixNano())
+	event.RequestID = requestIDFrom(ctx)
+	event, err := ms.server.commitLocal(event)
+	if err != nil {
+		return MembershipChange{}, Event{}, err
+	}
+	ms.apply(kind, node, peer)
+
+	change := MembershipChange{
+		Kind:      kind,
+		Node:      node,
+		URL:       peer,
+		Origin:    ms.server.nodeID,
+		Timestamp: event.Timestamp,
+		Epoch:     event.Epoch,
+	}
+	ms.forward(ctx, change)
+	return change, event, nil
+}
+
+// forward sends a change to every member except the node it is about
+func (ms *Membership) forward(ctx context.Context, change MembershipChange) {
+	body, _ := json.Marshal(change)
+	header := http.Header{"Content-Type": []string{"application/json"}}
+
+	ctx, cancel := context.WithTimeout(ctx, clusterTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, peer := range ms.server.peers.URLs() {
+		if peer == change.URL {
+			continue
+		}
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+			if _, err := ms.server.peers.Do(ctx, peer, http.MethodPost, "/peer/membership", header, body); err != nil {
+				ms.server.logger.Warn("Failed to forward membership change", "peer", peer, "kind", change.Kind, "error", err)
+			}
+		}(peer)
+	}
+	wg.Wait()
+}
+
+// Receive applies a change forwarded by another member, recording it like
+// a received message. In Raft mode the origin's event is replicated
+// already, so only the peer list changes.
+func (ms *Membership) Receive(ctx context.Context, change MembershipChange) (Event, error) {
+	received := ClockTime{Epoch: change.Epoch, Timestamp: change.Timestamp}
+	if ms.server.replica != nil {
+		if _, err := ms.server.clock.observeFrom(received, ClockSource{Peer: change.Origin, RequestID: requestIDFrom(ctx)}); err != nil {
+			return Event{}, err
+		}
+		ms.apply(change.Kind, change.Node, change.URL)
+		return Event{}, nil
+	}
+
+	now, err := ms.server.clock.updateFrom(received, ClockSource{Peer: change.Origin, RequestID: requestIDFrom(ctx)})
+	if err != nil {
+		return Event{}, err
+	}
+	ms.apply(change.Kind, change.Node, change.URL)
+
+	event := membershipEvent(change.Kind, change.Node, change.URL)
+	event.ID = messageID(now)
+	event.Timestamp = now.Timestamp
+	event.Epoch = now.Epoch
+	event.WallTime = time.Now()
+	event.RequestID = requestIDFrom(ctx)
+	event.Sender = change.Origin
+	event.SentAt = &received
+	event, err = ms.server.appendEvent(event)
+	if err != nil {
+		return Event{}, err
+	}
+
+	ms.server.logger.Info("Membership changed", append(eventAttrs(event), "kind", change.Kind, "node", change.Node, "url", change.URL)...)
+	return event, nil
+}
+
+// JoinCluster registers this node, reachable at self, with the member at
+// seed and adopts the seed's peers
+func (ms *Membership) JoinCluster(ctx context.Context, seed, self string) error {
+	query := url.Values{"node": {ms.server.nodeID}, "url": {self}}
+	data, err := ms.server.peers.Do(ctx, cleanPeerURL(seed), http.MethodPost, "/cluster/join?"+query.Encode(), nil, nil)
+	if err != nil {
+		return err
+	}
+	var response struct {
+		Node    string           `json:"node"`
+		Change  MembershipChange `json:"change"`
+		Members []Member         `json:"members"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return fmt.Errorf("invalid join response: %w", err)
+	}
+
+	ms.apply(memberJoin, response.Node, cleanPeerURL(seed))
+	for _, m := range response.Members {
+		if m.URL != cleanPeerURL(self) {
+			ms.apply(memberJoin, m.Node, m.URL)
+		}
+	}
+	_, err = ms.Receive(ctx, response.Change)
+	return err
+}
+
+// LeaveCluster deregisters this node through the first member that accepts
+func (ms *Membership) LeaveCluster(ctx context.Context, self string) error {
+	query := url.Values{"node": {ms.server.nodeID}, "url": {self}}
+	err := errors.New("no peers")
+	for _, peer := range ms.server.peers.URLs() {
+		if _, err = ms.server.peers.Do(ctx, peer, http.MethodPost, "/cluster/leave?"+query.Encode(), nil, nil); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// parseMember reads the node and URL parameters of a join or leave
+func parseMember(r *http.Request) (string, string, error) {
+	node := r.URL.Query().Get("node")
+	peer := cleanPeerURL(r.URL.Query().Get("url"))
+	if node == "" || peer == "" {
+		return "", "", errors.New("Missing node or url parameter")
+	}
+	if u, err := url.Parse(peer); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", "", errors.New("Invalid url, expected http(s)://host:port")
+	}
+	return node, peer, nil
+}
+
+// handleChange serves POST /cluster/join and /cluster/leave
+func (ms *Membership) handleChange(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		node, peer, err := parseMember(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if node == ms.server.nodeID {
+			http.Error(w, "Node ID is already in use by this node", http.StatusConflict)
+			return
+		}
+
+		change, event, err := ms.Change(r.Context(), kind, node, peer)
+		if err != nil {
+			ms.server.writeCommitError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"node":    ms.server.nodeID,
+			"change":  change,
+			"event":   event,
+			"members": ms.Members(),
+		})
+	}
+}
+
+func (ms *Membership) handlePeerMembership(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var change MembershipChange
+	err := json.NewDecoder(r.Body).Decode(&change)
+	if err != nil || change.Node == "" || change.Origin == "" || change.Timestamp <= 0 ||
+		(change.Kind != memberJoin && change.Kind != memberLeave) {
+		http.Error(w, "Invalid membership change", http.StatusBadRequest)
+		return
+	}
+	if change.URL = cleanPeerURL(change.URL); change.URL == "" {
+		http.Error(w, "Invalid membership change", http.StatusBadRequest)
+		return
+	}
+
+	event, err := ms.Receive(r.Context(), change)
+	if errors.Is(err, ErrJumpTooLarge) {
+		http.Error(w, "Timestamp jump exceeds max_jump", http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(event)
+}
+
+// handleMembers lists the current peers
+func (ms *Membership) handleMembers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	members := ms.Members()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"node":    ms.server.nodeID,
+		"members": members,
+		"count":   len(members),
+	})
+}
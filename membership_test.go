@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type memberNode struct {
+	server     *Server
+	membership *Membership
+	url        string
+}
+
+// newMemberNode serves the membership endpoints of a fresh node
+func newMemberNode(t *testing.T, id string) *memberNode {
+	n := &memberNode{server: NewServer()}
+	n.server.nodeID = id
+	n.server.peers = NewPeers(nil, http.DefaultClient)
+	n.membership = NewMembership(n.server, nil)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cluster/join", n.membership.handleChange(memberJoin))
+	mux.HandleFunc("/cluster/leave", n.membership.handleChange(memberLeave))
+	mux.HandleFunc("/peer/membership", n.membership.handlePeerMembership)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	n.url = ts.URL
+	return n
+}
+
+func eventsOfType(s *Server, eventType string) []Event {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var events []Event
+	for _, e := range s.events.Events() {
+		if e.Type == eventType {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+func TestMembershipJoinAndLeave(t *testing.T) {
+	a, b, c := newMemberNode(t, "a"), newMemberNode(t, "b"), newMemberNode(t, "c")
+	a.server.peers.Add(b.url)
+	b.server.peers.Add(a.url)
+
+	if err := c.membership.JoinCluster(t.Context(), a.url, c.url); err != nil {
+		t.Fatalf("Join failed: %v", err)
+	}
+	for _, n := range []*memberNode{a, b, c} {
+		if got := len(n.server.peers.URLs()); got != 2 {
+			t.Errorf("Expected 2 peers on %s, got %v", n.server.nodeID, n.server.peers.URLs())
+		}
+		joins := eventsOfType(n.server, "cluster.join")
+		if len(joins) != 1 {
+			t.Fatalf("Expected 1 join event on %s, got %d", n.server.nodeID, len(joins))
+		}
+	}
+	// The change is stamped by a and received by the others after it
+	stamped := eventsOfType(a.server, "cluster.join")[0]
+	for _, n := range []*memberNode{b, c} {
+		received := eventsOfType(n.server, "cluster.join")[0]
+		if received.Sender != "a" || received.Timestamp <= stamped.Timestamp {
+			t.Errorf("Expected %s to receive a's change after %d, got %s at %d",
+				n.server.nodeID, stamped.Timestamp, received.Sender, received.Timestamp)
+		}
+	}
+	if members := a.membership.Members(); members[0].Node == "" && members[1].Node == "" {
+		t.Errorf("Expected the joined node ID to be known, got %v", members)
+	}
+
+	if err := c.membership.LeaveCluster(t.Context(), c.url); err != nil {
+		t.Fatalf("Leave failed: %v", err)
+	}
+	for _, n := range []*memberNode{a, b} {
+		if got := n.server.peers.URLs(); len(got) != 1 {
+			t.Errorf("Expected c removed on %s, got %v", n.server.nodeID, got)
+		}
+		if len(eventsOfType(n.server, "cluster.leave")) != 1 {
+			t.Errorf("Expected a leave event on %s", n.server.nodeID)
+		}
+	}
+}
+
+func TestClusterJoinValidation(t *testing.T) {
+	n := newMemberNode(t, "a")
+	cases := []struct {
+		query string
+		code  int
+	}{
+		{"", http.StatusBadRequest},
+		{"?node=b", http.StatusBadRequest},
+		{"?node=b&url=ftp://b", http.StatusBadRequest},
+		{"?node=a&url=http://b:8080", http.StatusConflict},
+		{"?node=b&url=http://b:8080/", http.StatusOK},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/cluster/join"+c.query, nil)
+		w := httptest.NewRecorder()
+		n.membership.handleChange(memberJoin)(w, req)
+		if w.Code != c.code {
+			t.Errorf("%q: expected %d, got %d", c.query, c.code, w.Code)
+		}
+	}
+	if got := n.server.peers.URLs(); len(got) != 1 || got[0] != "http://b:8080" {
+		t.Errorf("Expected the cleaned URL, got %v", got)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/cluster/members", nil)
+	w := httptest.NewRecorder()
+	n.membership.handleMembers(w, req)
+	var response map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&response)
+	if response["count"] != float64(1) {
+		t.Errorf("Expected 1 member, got %v", response["count"])
+	}
+}
+
+func TestMembershipResizesMulticastGroup(t *testing.T) {
+	server := NewServer()
+	server.nodeID = "a"
+	server.peers = NewPeers(nil, http.DefaultClient)
+	multicast := NewMulticast(server)
+	ms := NewMembership(server, multicast)
+
+	ms.apply(memberJoin, "b", "http://b:8080")
+	if multicast.queue.members != 2 {
+		t.Errorf("Expected 2 members, got %d", multicast.queue.members)
+	}
+	if nodes := multicast.queue.matrix.Nodes(); len(nodes) != 2 || nodes[1] != "b" {
+		t.Errorf("Expected b tracked, got %v", nodes)
+	}
+
+	// A message waiting for b's acknowledgment is delivered once b leaves
+	multicast.queue.Add(MulticastMessage{Sender: "a", Timestamp: 1})
+	if delivered, _ := multicast.queue.Deliver(); len(delivered) != 0 {
+		t.Fatal("Expected delivery to wait for b")
+	}
+	ms.apply(memberLeave, "b", "http://b:8080")
+	if multicast.queue.members != 1 {
+		t.Errorf("Expected 1 member, got %d", multicast.queue.members)
+	}
+	if seq, _ := multicast.queue.Totals(); seq != 1 {
+		t.Errorf("Expected the message delivered, got %d deliveries", seq)
+	}
+}
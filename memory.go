@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+)
+
+// MemoryUsage describes the memory of the process and of the event log
+type MemoryUsage struct {
+	HeapAlloc   uint64            `json:"heap_alloc_bytes"`
+	HeapInuse   uint64            `json:"heap_inuse_bytes"`
+	HeapObjects uint64            `json:"heap_objects"`
+	Sys         uint64            `json:"sys_bytes"`
+	GCCycles    uint32            `json:"gc_cycles"`
+	Goroutines  int               `json:"goroutines"`
+	Events      int               `json:"events"`
+	Compression *CompressionStats `json:"compression,omitempty"`
+}
+
+// compressedStoreOf finds the compressed store under the layers wrapping
+// an event store, or returns nil
+func compressedStoreOf(st EventStore) *CompressedStore {
+	for {
+		switch s := st.(type) {
+		case *CompressedStore:
+			return s
+		case *WALStore:
+			st = s.EventStore
+		case *EncryptedStore:
+			st = s.inner
+		default:
+			return nil
+		}
+	}
+}
+
+// handleMemory reports the memory in use, GET /analytics/memory. The
+// compression of the event log is included when -event-compression is set.
+func (s *Server) handleMemory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	usage := MemoryUsage{
+		HeapAlloc:   stats.HeapAlloc,
+		HeapInuse:   stats.HeapInuse,
+		HeapObjects: stats.HeapObjects,
+		Sys:         stats.Sys,
+		GCCycles:    stats.NumGC,
+		Goroutines:  runtime.NumGoroutine(),
+		Events:      s.events.Len(),
+	}
+	if st := compressedStoreOf(s.events); st != nil {
+		compression := st.Stats()
+		usage.Compression = &compression
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// The Merkle tree over the event log follows RFC 6962: leaves and interior
+// nodes are hashed with different prefixes, so a proof for one cannot be
+// passed off as the other.
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+// merkleLeaf hashes an event, as encoded in JSON by the API
+func merkleLeaf(e Event) []byte {
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(append([]byte{merkleLeafPrefix}, data...))
+	return sum[:]
+}
+
+func merkleNode(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{merkleNodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// merkleSplit is the largest power of two smaller than n
+func merkleSplit(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// merkleRoot is the root hash of the tree over leaves
+func merkleRoot(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		sum := sha256.Sum256(nil)
+		return sum[:]
+	case 1:
+		return leaves[0]
+	}
+	k := merkleSplit(len(leaves))
+	return merkleNode(merkleRoot(leaves[:k]), merkleRoot(leaves[k:]))
+}
+
+// merklePath is the audit path of leaf m: the sibling hashes needed to
+// recompute the root from it, from the bottom up
+func merklePath(m int, leaves [][]byte) [][]byte {
+	if len(leaves) <= 1 {
+		return nil
+	}
+	k := merkleSplit(len(leaves))
+	if m < k {
+		return append(merklePath(m, leaves[:k]), merkleRoot(leaves[k:]))
+	}
+	return append(merklePath(m-k, leaves[k:]), merkleRoot(leaves[:k]))
+}
+
+// verifyMerklePath checks that leaf is at index in a tree of size leaves
+// with the given root
+func verifyMerklePath(index, size int, leaf []byte, path [][]byte, root []byte) bool {
+	if index < 0 || index >= size {
+		return false
+	}
+	fn, sn := index, size-1
+	r := leaf
+	for _, p := range path {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			r = merkleNode(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = merkleNode(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && bytes.Equal(r, root)
+}
+
+// merkleLeaves hashes every event of the log
+func (s *Server) merkleLeaves() ([]Event, [][]byte) {
+	events := s.events.Events()
+	leaves := make([][]byte, len(events))
+	for i, e := range events {
+		leaves[i] = merkleLeaf(e)
+	}
+	return events, leaves
+}
+
+func hexHashes(hashes [][]byte) []string {
+	out := make([]string, len(hashes))
+	for i, h := range hashes {
+		out[i] = hex.EncodeToString(h)
+	}
+	return out
+}
+
+// handleMerkleRoot shows the root of the tree over the current log
+func (s *Server) handleMerkleRoot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	_, leaves := s.merkleLeaves()
+	now := s.clock.Now()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"root":              hex.EncodeToString(merkleRoot(leaves)),
+		"tree_size":         len(leaves),
+		"current_timestamp": now.Timestamp,
+		"epoch":             now.Epoch,
+	})
+}
+
+// handleEventProof serves GET /events/<id>/proof, the inclusion proof of an
+// event against the current root. The first event with the ID is proven.
+func (s *Server) handleEventProof(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/events/"), "/proof")
+	if !ok || id == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	events, leaves := s.merkleLeaves()
+	index := -1
+	for i, e := range events {
+		if e.ID == id {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"event":      events[index],
+		"index":      index,
+		"tree_size":  len(leaves),
+		"leaf_hash":  hex.EncodeToString(leaves[index]),
+		"audit_path": hexHashes(merklePath(index, leaves)),
+		"root":       hex.EncodeToString(merkleRoot(leaves)),
+	})
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMerklePathsVerify(t *testing.T) {
+	for size := 1; size <= 17; size++ {
+		leaves := make([][]byte, size)
+		for i := range leaves {
+			leaves[i] = merkleLeaf(Event{ID: fmt.Sprintf("e%d", i)})
+		}
+		root := merkleRoot(leaves)
+		for i := range leaves {
+			path := merklePath(i, leaves)
+			if !verifyMerklePath(i, size, leaves[i], path, root) {
+				t.Errorf("size %d: expected the path of leaf %d to verify", size, i)
+			}
+			if size > 1 && verifyMerklePath((i+1)%size, size, leaves[i], path, root) {
+				t.Errorf("size %d: expected leaf %d not to verify at another index", size, i)
+			}
+			if verifyMerklePath(i, size, merkleLeaf(Event{ID: "forged"}), path, root) {
+				t.Errorf("size %d: expected a forged leaf %d not to verify", size, i)
+			}
+		}
+	}
+}
+
+func TestMerkleRootMatchesRFC6962(t *testing.T) {
+	empty := sha256.Sum256(nil)
+	if got := hex.EncodeToString(merkleRoot(nil)); got != hex.EncodeToString(empty[:]) {
+		t.Errorf("Expected the hash of the empty string, got %s", got)
+	}
+
+	// Three leaves split into a balanced pair and a lone right leaf
+	a, b, c := []byte("a"), []byte("b"), []byte("c")
+	want := merkleNode(merkleNode(a, b), c)
+	if got := merkleRoot([][]byte{a, b, c}); hex.EncodeToString(got) != hex.EncodeToString(want) {
+		t.Errorf("Expected %x, got %x", want, got)
+	}
+}
+
+func TestHandleEventProof(t *testing.T) {
+	server := NewServer()
+	for _, id := range []string{"e1", "e2", "e3", "e4", "e5"} {
+		server.logEvent(id, "Message "+id)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/events/root", nil)
+	w := httptest.NewRecorder()
+	server.handleMerkleRoot(w, req)
+	var root struct {
+		Root string `json:"root"`
+		Size int    `json:"tree_size"`
+	}
+	json.NewDecoder(w.Body).Decode(&root)
+	if root.Size != 5 {
+		t.Fatalf("Expected a tree of 5, got %d", root.Size)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/events/e4/proof", nil)
+	w = httptest.NewRecorder()
+	server.handleEventProof(w, req)
+	var proof struct {
+		Event     json.RawMessage `json:"event"`
+		Index     int             `json:"index"`
+		TreeSize  int             `json:"tree_size"`
+		LeafHash  string          `json:"leaf_hash"`
+		AuditPath []string        `json:"audit_path"`
+		Root      string          `json:"root"`
+	}
+	json.NewDecoder(w.Body).Decode(&proof)
+	if proof.Index != 3 || proof.Root != root.Root {
+		t.Fatalf("Expected e4 at 3 against %s, got %+v", root.Root, proof)
+	}
+
+	// A client verifies with nothing but the proof and the root
+	sum := sha256.Sum256(append([]byte{merkleLeafPrefix}, proof.Event...))
+	if hex.EncodeToString(sum[:]) != proof.LeafHash {
+		t.Errorf("Expected the leaf hash of the returned event, got %s", proof.LeafHash)
+	}
+	path := make([][]byte, len(proof.AuditPath))
+	for i, h := range proof.AuditPath {
+		path[i], _ = hex.DecodeString(h)
+	}
+	want, _ := hex.DecodeString(root.Root)
+	if !verifyMerklePath(proof.Index, proof.TreeSize, sum[:], path, want) {
+		t.Error("Expected the proof to verify")
+	}
+
+	for _, target := range []string{"/events/missing/proof", "/events/e4", "/events//proof"} {
+		req = httptest.NewRequest(http.MethodGet, target, nil)
+		w = httptest.NewRecorder()
+		server.handleEventProof(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", target, w.Code)
+		}
+	}
+}
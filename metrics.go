@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Metrics is a small registry of counters and gauges exposed in the
+// Prometheus text format on /metrics
+type Metrics struct {
+	mutex    sync.Mutex
+	families map[string]*metricFamily
+}
+
+type metricFamily struct {
+	name   string
+	kind   string // counter or gauge
+	help   string
+	values map[string]float64 // keyed by rendered label set
+	source func() float64     // gauges computed at scrape time
+}
+
+// NewMetrics creates an empty registry
+func NewMetrics() *Metrics {
+	return &Metrics{families: make(map[string]*metricFamily)}
+}
+
+// Counter declares a counter so it is exported even before its first increment
+func (m *Metrics) Counter(name, help string) {
+	m.family(name, "counter", help)
+}
+
+// GaugeFunc declares a gauge whose value is read from fn on every scrape
+func (m *Metrics) GaugeFunc(name, help string, fn func() float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.familyLocked(name, "gauge", help).source = fn
+}
+
+// Inc increments a counter. Labels are given as alternating name/value pairs.
+func (m *Metrics) Inc(name string, labels ...string) {
+	m.Add(name, 1, labels...)
+}
+
+// Add adds delta to a counter
+func (m *Metrics) Add(name string, delta float64, labels ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.familyLocked(name, "counter", "").values[renderLabels(labels)] += delta
+}
+
+// Set sets a gauge to value
+func (m *Metrics) Set(name string, value float64, labels ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.familyLocked(name, "gauge", "").values[renderLabels(labels)] = value
+}
+
+// Value returns the current value of a series, mostly useful in tests
+func (m *Metrics) Value(name string, labels ...string) float64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	f, ok := m.families[name]
+	if !ok {
+		return 0
+	}
+	if f.source != nil {
+		return f.source()
+	}
+	return f.values[renderLabels(labels)]
+}
+
+func (m *Metrics) family(name, kind, help string) *metricFamily {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.familyLocked(name, kind, help)
+}
+
+func (m *Metrics) familyLocked(name, kind, help string) *metricFamily {
+	f, ok := m.families[name]
+	if !ok {
+		f = &metricFamily{name: name, kind: kind, values: make(map[string]float64)}
+		m.families[name] = f
+	}
+	if help != "" {
+		f.help = help
+	}
+	return f
+}
+
+// renderLabels turns name/value pairs into a Prometheus label set
+func renderLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[i+1])
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, labels[i], value))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// WriteText writes all metrics in the Prometheus text exposition format
+func (m *Metrics) WriteText(w io.Writer) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	names := make([]string, 0, len(m.families))
+	for name := range m.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := m.families[name]
+		if f.help != "" {
+			fmt.Fprintf(w, "# HELP %s %s\n", f.name, f.help)
+		}
+		fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+
+		if f.source != nil {
+			fmt.Fprintf(w, "%s %g\n", f.name, f.source())
+			continue
+		}
+		if len(f.values) == 0 {
+			fmt.Fprintf(w, "%s 0\n", f.name)
+			continue
+		}
+		keys := make([]string, 0, len(f.values))
+		for k := range f.values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s%s %g\n", f.name, k, f.values[k])
+		}
+	}
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	s.metrics.WriteText(w)
+}
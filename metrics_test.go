@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMetricsExposition(t *testing.T) {
+	m := NewMetrics()
+	m.Counter("requests_total", "Handled requests")
+	m.Inc("requests_total", "path", "/event")
+	m.Inc("requests_total", "path", "/event")
+	m.Inc("requests_total", "path", "/time")
+	m.GaugeFunc("clock", "Current clock", func() float64 { return 42 })
+	m.Counter("idle_total", "Never incremented")
+
+	var buf bytes.Buffer
+	m.WriteText(&buf)
+	out := buf.String()
+
+	expected := []string{
+		"# HELP requests_total Handled requests",
+		"# TYPE requests_total counter",
+		`requests_total{path="/event"} 2`,
+		`requests_total{path="/time"} 1`,
+		"# TYPE clock gauge",
+		"clock 42",
+		"idle_total 0",
+	}
+	for _, line := range expected {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("Expected output to contain %q, got:\n%s", line, out)
+		}
+	}
+
+	if got := m.Value("requests_total", "path", "/event"); got != 2 {
+		t.Errorf("Expected value 2, got %v", got)
+	}
+}
+
+func TestRenderLabelsEscaping(t *testing.T) {
+	got := renderLabels([]string{"msg", `say "hi"`})
+	if got != `{msg="say \"hi\""}` {
+		t.Errorf("Unexpected label rendering: %s", got)
+	}
+}
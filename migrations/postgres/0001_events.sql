@@ -0,0 +1,24 @@
+-- The shared event log. seq orders the log; data holds the JSON encoding
+-- of the event, the other columns the fields worth querying by.
+CREATE TABLE events (
+    seq               BIGSERIAL   PRIMARY KEY,
+    id                TEXT        NOT NULL,
+    epoch             BIGINT      NOT NULL,
+    lamport_timestamp BIGINT      NOT NULL,
+    wall_time         TIMESTAMPTZ NOT NULL,
+    node              TEXT        NOT NULL,
+    type              TEXT        NOT NULL,
+    message           TEXT        NOT NULL,
+    sender            TEXT        NOT NULL,
+    hash              TEXT        NOT NULL,
+    data              JSONB       NOT NULL
+);
+
+CREATE INDEX events_time ON events (epoch, lamport_timestamp, seq);
+CREATE INDEX events_id ON events (id, seq);
+
+-- Counters of the store, such as the events trimmed off the log
+CREATE TABLE store_state (
+    key   TEXT   PRIMARY KEY,
+    value BIGINT NOT NULL
+);
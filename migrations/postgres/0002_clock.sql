@@ -0,0 +1,7 @@
+-- The clock shared by the servers of the log, only ever moved forward
+CREATE TABLE clock (
+    id                BOOLEAN     PRIMARY KEY DEFAULT TRUE CHECK (id),
+    epoch             BIGINT      NOT NULL,
+    lamport_timestamp BIGINT      NOT NULL,
+    saved_at          TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// mqttTimeout bounds how long a publish or the final disconnect may take
+const mqttTimeout = 5 * time.Second
+
+// MQTTEnvelope is the payload of MQTT messages. MQTT 3.1.1 has no headers,
+// so the Lamport time travels next to the message.
+type MQTTEnvelope struct {
+	Timestamp *int64 `json:"lamport_timestamp"`
+	Epoch     *int64 `json:"epoch,omitempty"`
+	Sender    string `json:"sender,omitempty"`
+	ID        string `json:"id,omitempty"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	KeyID     string `json:"key_id,omitempty"`
+}
+
+// MQTTBridge lets devices take part in the clock through an MQTT broker.
+// Envelopes on Topic are merged through the clock, and local events are
+// published to PublishTopic.
+type MQTTBridge struct {
+	client       mqtt.Client
+	server       *Server
+	topic        string
+	publishTopic string
+	qos          byte
+	logger       *slog.Logger
+}
+
+// NewMQTTBridge creates a bridge from the MQTT settings in cfg
+func NewMQTTBridge(cfg *Config, server *Server) *MQTTBridge {
+	b := &MQTTBridge{
+		server:       server,
+		topic:        cfg.MQTTTopic,
+		publishTopic: cfg.MQTTPublishTopic,
+		qos:          cfg.MQTTQoS,
+		logger:       server.logger.With("transport", "mqtt"),
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.MQTTBroker).
+		SetClientID(cfg.MQTTClientID).
+		SetUsername(cfg.MQTTUsername).
+		SetPassword(cfg.MQTTPassword).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			b.logger.Warn("MQTT connection lost", "error", err)
+		}).
+		// Subscriptions do not survive a clean session, so renew them on
+		// every (re)connect
+		SetOnConnectHandler(b.subscribe)
+	b.client = mqtt.NewClient(opts)
+	return b
+}
+
+// Run connects and bridges until ctx is done, then disconnects
+func (b *MQTTBridge) Run(ctx context.Context) {
+	b.client.Connect()
+
+	if b.publishTopic != "" {
+		b.server.forwardLocalEvents(ctx, b.publish)
+	} else {
+		<-ctx.Done()
+	}
+	b.client.Disconnect(uint(mqttTimeout.Milliseconds()))
+}
+
+func (b *MQTTBridge) subscribe(client mqtt.Client) {
+	if b.topic == "" {
+		return
+	}
+	token := client.Subscribe(b.topic, b.qos, func(_ mqtt.Client, msg mqtt.Message) {
+		b.handleMessage(msg.Topic(), msg.Payload())
+	})
+	if token.WaitTimeout(mqttTimeout) && token.Error() == nil {
+		b.logger.Info("Subscribed to MQTT", "topic", b.topic)
+		return
+	}
+	b.logger.Error("Failed to subscribe to MQTT", "topic", b.topic, "error", token.Error())
+}
+
+// handleMessage merges an envelope. Devices that do not name themselves are
+// identified by the topic they publish on.
+func (b *MQTTBridge) handleMessage(topic string, payload []byte) {
+	var env MQTTEnvelope
+	if err := json.Unmarshal(payload, &env); err != nil {
+		b.server.metrics.Inc("lamport_bridge_rejected_total", "transport", "mqtt")
+		b.logger.Warn("Rejected MQTT message", "topic", topic, "error", err)
+		return
+	}
+	if env.Sender == "" {
+		env.Sender = topic
+	}
+
+	event, ok, err := b.server.receiveBridged("mqtt", env.get, env.Message)
+	if err != nil {
+		b.logger.Warn("Rejected MQTT message", "topic", topic, "error", err)
+		return
+	}
+	if ok {
+		b.logger.Debug("Merged MQTT message", eventAttrs(event)...)
+	}
+}
+
+// get exposes the envelope under the broker header names
+func (env MQTTEnvelope) get(key string) string {
+	switch key {
+	case headerTimestamp:
+		if env.Timestamp != nil {
+			return strconv.FormatInt(*env.Timestamp, 10)
+		}
+	case headerEpoch:
+		if env.Epoch != nil {
+			return strconv.FormatInt(*env.Epoch, 10)
+		}
+	case headerSender:
+		return env.Sender
+	case headerEventID:
+		return env.ID
+	case headerRequestID:
+		return env.RequestID
+	case headerSignature:
+		return env.Signature
+	case headerKeyID:
+		return env.KeyID
+	}
+	return ""
+}
+
+func (b *MQTTBridge) publish(e Event) {
+	token := b.client.Publish(b.publishTopic, b.qos, false, mqttPayload(e, b.server.nodeID))
+	if !token.WaitTimeout(mqttTimeout) {
+		b.logger.Warn("Timed out publishing event", eventAttrs(e)...)
+		return
+	}
+	if err := token.Error(); err != nil {
+		b.logger.Warn("Failed to publish event", append(eventAttrs(e), "error", err)...)
+		return
+	}
+	b.server.metrics.Inc("lamport_bridge_published_total", "transport", "mqtt")
+}
+
+// mqttPayload encodes a local event as an envelope
+func mqttPayload(e Event, nodeID string) []byte {
+	payload, _ := json.Marshal(MQTTEnvelope{
+		Timestamp: &e.Timestamp,
+		Epoch:     &e.Epoch,
+		Sender:    nodeID,
+		ID:        e.ID,
+		Message:   e.Message,
+		RequestID: e.RequestID,
+		Signature: e.Signature,
+		KeyID:     e.KeyID,
+	})
+	return payload
+}
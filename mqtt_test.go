@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+)
+
+func newTestMQTTBridge(server *Server) *MQTTBridge {
+	return NewMQTTBridge(&Config{MQTTBroker: "tcp://127.0.0.1:1", MQTTTopic: "devices/+/clock"}, server)
+}
+
+func TestMQTTHandleMessage(t *testing.T) {
+	server := NewServer()
+	server.nodeID = "a"
+	b := newTestMQTTBridge(server)
+
+	b.handleMessage("devices/sensor-1/clock", []byte(`{"lamport_timestamp":20,"message":"Reading"}`))
+	b.handleMessage("devices/sensor-2/clock", []byte(`{"lamport_timestamp":3,"sender":"sensor-2","message":"Boot"}`))
+	b.handleMessage("devices/sensor-3/clock", []byte(`{"message":"No clock"}`))
+	b.handleMessage("devices/sensor-4/clock", []byte(`not json`))
+
+	server.mutex.RLock()
+	defer server.mutex.RUnlock()
+	if server.events.Len() != 2 {
+		t.Fatalf("Expected 2 merged messages, got %d", server.events.Len())
+	}
+	if e := server.events.Events()[0]; e.Timestamp != 21 || e.Sender != "devices/sensor-1/clock" || e.Message != "Processed: Reading" {
+		t.Errorf("Unexpected first event: %+v", e)
+	}
+	if e := server.events.Events()[1]; e.Timestamp != 22 || e.Sender != "sensor-2" {
+		t.Errorf("Unexpected second event: %+v", e)
+	}
+	if got := server.metrics.Value("lamport_bridge_rejected_total", "transport", "mqtt"); got != 2 {
+		t.Errorf("Expected 2 rejected messages, got %v", got)
+	}
+}
+
+func TestMQTTPayloadRoundTrip(t *testing.T) {
+	sender := NewServer()
+	sender.nodeID = "b"
+	sent, _ := sender.recordLocal(Event{ID: "event-1", Message: "Hello"})
+
+	receiver := NewServer()
+	receiver.nodeID = "a"
+	newTestMQTTBridge(receiver).handleMessage("lamport/messages", mqttPayload(sent, "b"))
+	if receiver.clock.GetTime() != 2 {
+		t.Errorf("Expected clock 2, got %d", receiver.clock.GetTime())
+	}
+
+	// Publications of this node are skipped when they come back
+	newTestMQTTBridge(sender).handleMessage("lamport/messages", mqttPayload(sent, "b"))
+	if sender.clock.GetTime() != 1 {
+		t.Errorf("Expected own message to be skipped, clock at %d", sender.clock.GetTime())
+	}
+}
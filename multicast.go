@@ -0,0 +1,510 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// multicastOutbox bounds the envelopes waiting to be sent to peers
+	multicastOutbox = 1024
+	// multicastRetry is the delay before resending to a peer that failed
+	multicastRetry = 500 * time.Millisecond
+)
+
+// Multicast envelope kinds
+const (
+	multicastMessage = "message"
+	multicastAck     = "ack"
+)
+
+// MulticastEnvelope is what nodes exchange on /peer/multicast: a message or
+// the acknowledgment of one, stamped with the sender's clock and carrying
+// its matrix
+type MulticastEnvelope struct {
+	Kind      string `json:"kind"`
+	Sender    string `json:"sender"`
+	Timestamp int64  `json:"timestamp"`
+	Message   string `json:"message,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	Matrix    Matrix `json:"matrix"`
+}
+
+// MulticastMessage is a message in the total order queue. Seq is its
+// position in the delivery order, 0 until delivered.
+type MulticastMessage struct {
+	Sender     string    `json:"sender"`
+	Timestamp  int64     `json:"timestamp"`
+	Message    string    `json:"message"`
+	RequestID  string    `json:"request_id,omitempty"`
+	ReceivedAt time.Time `json:"received_at"`
+	Seq        int64     `json:"seq,omitempty"`
+}
+
+// event is the message as seen by tie breakers. The ID is derived from
+// the sender and timestamp, so it is the same on every node.
+func (m MulticastMessage) event() Event {
+	return Event{
+		ID:        fmt.Sprintf("%s-%d", m.Sender, m.Timestamp),
+		Message:   m.Message,
+		Timestamp: m.Timestamp,
+		WallTime:  m.ReceivedAt,
+		Node:      m.Sender,
+		RequestID: m.RequestID,
+	}
+}
+
+// TotalOrderQueue delivers multicast messages in the same order on every
+// node, following Lamport's algorithm: the earliest message is delivered
+// once every other member has sent something later, so nothing earlier can
+// still arrive. Channels between nodes must be FIFO.
+//
+// Delivered messages are kept until the matrix clock shows that every
+// member has received them.
+type TotalOrderQueue struct {
+	members   int // expected number of nodes, including this one
+	matrix    *MatrixClock
+	tie       TieBreaker
+	pending   []MulticastMessage // ordered by before
+	delivered []MulticastMessage // awaiting stability, in delivery order
+	seq       int64
+	collected int
+	mutex     sync.Mutex
+}
+
+// NewTotalOrderQueue creates a queue for node in a group of members nodes.
+// Messages with equal timestamps are ordered by tie, which must give the
+// same answer on every node.
+func NewTotalOrderQueue(node string, members int, tie TieBreaker) *TotalOrderQueue {
+	return &TotalOrderQueue{members: members, matrix: NewMatrixClock(node), tie: tie}
+}
+
+// before orders messages by timestamp, then by the tie breaker
+func (q *TotalOrderQueue) before(a, b MulticastMessage) bool {
+	if a.Timestamp != b.Timestamp {
+		return a.Timestamp < b.Timestamp
+	}
+	return q.tie.Less(a.event(), b.event())
+}
+
+// Add inserts a message; duplicates are ignored
+func (q *TotalOrderQueue) Add(m MulticastMessage) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	i := sort.Search(len(q.pending), func(i int) bool { return !q.before(q.pending[i], m) })
+	if i < len(q.pending) && q.pending[i].Sender == m.Sender && q.pending[i].Timestamp == m.Timestamp {
+		return nil
+	}
+	if len(q.pending) >= maxPendingMessages {
+		return ErrQueueFull
+	}
+	q.pending = append(q.pending, MulticastMessage{})
+	copy(q.pending[i+1:], q.pending[i:])
+	q.pending[i] = m
+	return nil
+}
+
+// Deliver removes every deliverable message in order and returns them,
+// then drops delivered messages that became stable. It returns how many
+// were dropped.
+func (q *TotalOrderQueue) Deliver() ([]MulticastMessage, int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	nodes := q.matrix.Nodes()
+	if len(nodes) < q.members {
+		return nil, 0
+	}
+
+	var delivered []MulticastMessage
+	for len(q.pending) > 0 && q.deliverableLocked(q.pending[0], nodes) {
+		m := q.pending[0]
+		q.pending = q.pending[1:]
+		q.seq++
+		m.Seq = q.seq
+		q.delivered = append(q.delivered, m)
+		delivered = append(delivered, m)
+	}
+
+	kept := q.delivered[:0]
+	for _, m := range q.delivered {
+		if !q.matrix.Stable(m.Sender, m.Timestamp, nodes) {
+			kept = append(kept, m)
+		}
+	}
+	collected := len(q.delivered) - len(kept)
+	q.delivered = kept
+	q.collected += collected
+	return delivered, collected
+}
+
+// deliverableLocked checks that every other node has reached m's
+// timestamp. Nodes send in timestamp order and stamp new messages above
+// anything they sent before, so no message at or before m can still
+// arrive, whatever the tie breaker.
+func (q *TotalOrderQueue) deliverableLocked(m MulticastMessage, nodes []string) bool {
+	for _, j := range nodes {
+		if j != q.matrix.node && q.matrix.Known(j) < m.Timestamp {
+			return false
+		}
+	}
+	return true
+}
+
+// Join grows the group by a member. The node is tracked right away when
+// its ID is known, otherwise once it is first heard from.
+func (q *TotalOrderQueue) Join(node string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.members++
+	if node != "" {
+		q.matrix.Track(node)
+	}
+}
+
+// Leave shrinks the group by a member. Its pending messages are still
+// delivered, but it no longer has to acknowledge anything.
+func (q *TotalOrderQueue) Leave(node string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.members > 1 {
+		q.members--
+	}
+	if node != "" {
+		q.matrix.Forget(node)
+	}
+}
+
+// Pending returns the messages not yet delivered, in order
+func (q *TotalOrderQueue) Pending() []MulticastMessage {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return append([]MulticastMessage(nil), q.pending...)
+}
+
+// Delivered returns the delivered messages not yet known to be stable
+func (q *TotalOrderQueue) Delivered() []MulticastMessage {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return append([]MulticastMessage(nil), q.delivered...)
+}
+
+// Totals returns how many messages were delivered and how many of those
+// were dropped as stable
+func (q *TotalOrderQueue) Totals() (int64, int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.seq, q.collected
+}
+
+// Multicast sends messages to every peer for delivery in total order
+type Multicast struct {
+	server *Server
+	queue  *TotalOrderQueue
+	outbox chan MulticastEnvelope
+	// onDeliver, when set, is called with every delivered message in
+	// delivery order
+	onDeliver func(MulticastMessage)
+	// send makes envelopes enter the outbox in timestamp order, which
+	// together with the single sender keeps channels FIFO
+	send sync.Mutex
+	// delivering keeps concurrent deliveries from reaching onDeliver out
+	// of order
+	delivering sync.Mutex
+}
+
+// NewMulticast creates the multicast group of the server and its peers
+func NewMulticast(server *Server) *Multicast {
+	server.metrics.Counter("lamport_multicast_delivered_total", "Multicast messages delivered in total order")
+	server.metrics.Counter("lamport_multicast_collected_total", "Delivered multicast messages dropped once every node had them")
+	// Arrival order differs between nodes and cannot order deliveries
+	tie := server.ties
+	if _, ok := tie.(arrivalTieBreaker); ok {
+		tie = NodeTieBreaker
+	}
+	m := &Multicast{
+		server: server,
+		queue:  NewTotalOrderQueue(server.nodeID, len(server.peers.URLs())+1, tie),
+		outbox: make(chan MulticastEnvelope, multicastOutbox),
+	}
+	server.metrics.GaugeFunc("lamport_multicast_pending", "Multicast messages waiting for delivery", func() float64 {
+		return float64(len(m.queue.Pending()))
+	})
+	return m
+}
+
+// Publish stamps a message and sends it to all peers. It is delivered
+// locally like everywhere else, once the peers acknowledged it.
+func (m *Multicast) Publish(ctx context.Context, message, requestID string) (MulticastMessage, error) {
+	m.send.Lock()
+	defer m.send.Unlock()
+
+	now := m.server.clock.TickTime()
+	msg := MulticastMessage{
+		Sender:     m.server.nodeID,
+		Timestamp:  now.Timestamp,
+		Message:    message,
+		RequestID:  requestID,
+		ReceivedAt: time.Now(),
+	}
+	if err := m.queue.Add(msg); err != nil {
+		return MulticastMessage{}, err
+	}
+	m.queue.matrix.Tick(now.Timestamp)
+
+	err := m.enqueue(ctx, MulticastEnvelope{
+		Kind:      multicastMessage,
+		Sender:    msg.Sender,
+		Timestamp: msg.Timestamp,
+		Message:   message,
+		RequestID: requestID,
+		Matrix:    m.queue.matrix.Snapshot(),
+	})
+	m.deliver()
+	return msg, err
+}
+
+// Receive handles an envelope from a peer and acknowledges messages
+func (m *Multicast) Receive(ctx context.Context, env MulticastEnvelope) (ClockTime, error) {
+	received := ClockTime{Epoch: m.server.clock.Now().Epoch, Timestamp: env.Timestamp}
+	now, err := m.server.clock.updateFrom(received, ClockSource{Peer: env.Sender, RequestID: requestIDFrom(ctx)})
+	if err != nil {
+		return ClockTime{}, err
+	}
+	m.queue.matrix.Observe(env.Sender, env.Timestamp, env.Matrix)
+	m.queue.matrix.Tick(now.Timestamp)
+
+	if env.Kind == multicastMessage {
+		err = m.queue.Add(MulticastMessage{
+			Sender:     env.Sender,
+			Timestamp:  env.Timestamp,
+			Message:    env.Message,
+			RequestID:  env.RequestID,
+			ReceivedAt: time.Now(),
+		})
+		if err == nil {
+			err = m.ack(ctx)
+		}
+	}
+	m.deliver()
+	return now, err
+}
+
+// ack tells every peer that this node's clock has passed the message just
+// received
+func (m *Multicast) ack(ctx context.Context) error {
+	m.send.Lock()
+	defer m.send.Unlock()
+	now := m.server.clock.Now()
+	m.queue.matrix.Tick(now.Timestamp)
+	return m.enqueue(ctx, MulticastEnvelope{
+		Kind:      multicastAck,
+		Sender:    m.server.nodeID,
+		Timestamp: now.Timestamp,
+		Matrix:    m.queue.matrix.Snapshot(),
+	})
+}
+
+func (m *Multicast) enqueue(ctx context.Context, env MulticastEnvelope) error {
+	select {
+	case m.outbox <- env:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *Multicast) deliver() {
+	m.delivering.Lock()
+	defer m.delivering.Unlock()
+	delivered, collected := m.queue.Deliver()
+	for _, msg := range delivered {
+		m.server.metrics.Inc("lamport_multicast_delivered_total")
+		if m.onDeliver != nil {
+			m.onDeliver(msg)
+		}
+		m.server.logger.Info("Multicast message delivered",
+			"sender", msg.Sender, "lamport_timestamp", msg.Timestamp, "seq", msg.Seq, "request_id", msg.RequestID)
+	}
+	for i := 0; i < collected; i++ {
+		m.server.metrics.Inc("lamport_multicast_collected_total")
+	}
+}
+
+// Join adds a member that joined the cluster
+func (m *Multicast) Join(node string) {
+	m.queue.Join(node)
+}
+
+// Leave removes a member that left the cluster. Messages that were only
+// waiting for it are delivered.
+func (m *Multicast) Leave(node string) {
+	m.queue.Leave(node)
+	m.deliver()
+}
+
+// watch follows the failure detector: a dead member leaves the group, so
+// it stops holding back delivery, and joins again once it answers. It
+// does not get the messages sent while it was dead.
+func (m *Multicast) watch(d *FailureDetector) {
+	d.Subscribe(func(peer PeerHealth, previous PeerState) {
+		switch {
+		case peer.State == PeerDead:
+			m.Leave(peer.Node)
+		case previous == PeerDead:
+			m.Join(peer.Node)
+		}
+	})
+}
+
+// Run sends envelopes to the peers one at a time until ctx is done. A peer
+// that fails is retried until it accepts, since skipping an envelope would
+// break FIFO order; while a member is unreachable nothing is delivered,
+// unless the failure detector declares it dead.
+func (m *Multicast) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case env := <-m.outbox:
+			m.broadcast(ctx, env)
+		}
+	}
+}
+
+func (m *Multicast) broadcast(ctx context.Context, env MulticastEnvelope) {
+	body, err := json.Marshal(env)
+	if err != nil {
+		m.server.logger.Error("Failed to encode multicast envelope", "error", err)
+		return
+	}
+	header := http.Header{"Content-Type": []string{"application/json"}}
+
+	var failed []string
+	for peer, err := range m.server.peers.Broadcast(ctx, http.MethodPost, "/peer/multicast", header, body) {
+		if err != nil {
+			m.server.logger.Warn("Multicast send failed, retrying", "peer", peer, "kind", env.Kind, "error", err)
+			failed = append(failed, peer)
+		}
+	}
+	for len(failed) > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(multicastRetry):
+		}
+		remaining := failed[:0]
+		for _, peer := range failed {
+			if m.server.monitor != nil && m.server.monitor.State(peer) == PeerDead {
+				m.server.logger.Warn("Multicast peer is dead, dropping envelope", "peer", peer, "kind", env.Kind)
+				continue
+			}
+			if _, err := m.server.peers.Do(ctx, peer, http.MethodPost, "/peer/multicast", header, body); err != nil {
+				remaining = append(remaining, peer)
+			}
+		}
+		failed = remaining
+	}
+}
+
+// handleMulticast publishes a message with POST and shows the queue with GET
+func (m *Multicast) handleMulticast(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		message := r.URL.Query().Get("message")
+		if message == "" {
+			http.Error(w, "Missing message parameter", http.StatusBadRequest)
+			return
+		}
+		msg, err := m.Publish(r.Context(), message, requestIDFrom(r.Context()))
+		if errors.Is(err, ErrQueueFull) {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(msg)
+
+	case http.MethodGet:
+		seq, collected := m.queue.Totals()
+		pending := m.queue.Pending()
+		delivered := m.queue.Delivered()
+
+		response := map[string]interface{}{
+			"pending":         pending,
+			"delivered":       delivered,
+			"delivered_total": seq,
+			"collected_total": collected,
+			"nodes":           m.queue.matrix.Nodes(),
+			"members":         m.queue.members,
+		}
+		if m.server.elector != nil {
+			response["coordinator"] = m.server.elector.Leader()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (m *Multicast) handlePeerMulticast(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var env MulticastEnvelope
+	err := json.NewDecoder(r.Body).Decode(&env)
+	if err != nil || env.Sender == "" || env.Sender == m.server.nodeID || env.Timestamp <= 0 ||
+		(env.Kind != multicastMessage && env.Kind != multicastAck) {
+		http.Error(w, "Invalid multicast envelope", http.StatusBadRequest)
+		return
+	}
+
+	now, err := m.Receive(r.Context(), env)
+	switch {
+	case errors.Is(err, ErrJumpTooLarge):
+		http.Error(w, "Timestamp jump exceeds max_jump", http.StatusUnprocessableEntity)
+		return
+	case errors.Is(err, ErrQueueFull):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"lamport_timestamp": now.Timestamp,
+	})
+}
+
+// handleMatrix shows the matrix clock: what this node knows each node has
+// received from every other
+func (m *Multicast) handleMatrix(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"node":   m.server.nodeID,
+		"matrix": m.queue.matrix.Snapshot(),
+	})
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newMulticastCluster starts nodes that multicast to each other over HTTP
+func newMulticastCluster(t *testing.T, ids ...string) []*Multicast {
+	servers := make([]*Server, len(ids))
+	urls := make([]string, len(ids))
+	groups := make([]*Multicast, len(ids))
+	for i, id := range ids {
+		servers[i] = NewServer()
+		servers[i].nodeID = id
+		i := i
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			groups[i].handlePeerMulticast(w, r)
+		}))
+		t.Cleanup(ts.Close)
+		urls[i] = ts.URL
+	}
+	for i, s := range servers {
+		var peers []string
+		for j, u := range urls {
+			if j != i {
+				peers = append(peers, u)
+			}
+		}
+		s.peers = NewPeers(peers, http.DefaultClient)
+		groups[i] = NewMulticast(s)
+		go groups[i].Run(t.Context())
+	}
+	return groups
+}
+
+func waitDelivered(t *testing.T, groups []*Multicast, total int64) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for _, g := range groups {
+		for {
+			if delivered, _ := g.queue.Totals(); delivered == total {
+				break
+			}
+			if time.Now().After(deadline) {
+				delivered, _ := g.queue.Totals()
+				t.Fatalf("Node %s delivered %d of %d messages", g.server.nodeID, delivered, total)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestMulticastTotalOrder(t *testing.T) {
+	groups := newMulticastCluster(t, "a", "b", "c")
+
+	var mu sync.Mutex
+	orders := make([][]string, len(groups))
+	for i, g := range groups {
+		i := i
+		g.onDeliver = func(m MulticastMessage) {
+			mu.Lock()
+			orders[i] = append(orders[i], m.Message)
+			mu.Unlock()
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, g := range groups {
+		wg.Add(1)
+		go func(g *Multicast) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				if _, err := g.Publish(t.Context(), fmt.Sprintf("%s-%d", g.server.nodeID, i), ""); err != nil {
+					t.Errorf("Publish failed: %v", err)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	waitDelivered(t, groups, 30)
+	mu.Lock()
+	defer mu.Unlock()
+	for i := range orders[1:] {
+		if strings.Join(orders[i+1], ",") != strings.Join(orders[0], ",") {
+			t.Fatalf("Expected the same delivery order everywhere, got %v and %v", orders[0], orders[i+1])
+		}
+	}
+
+	// Once everything is acknowledged no delivered message may be retained
+	deadline := time.Now().Add(5 * time.Second)
+	for _, g := range groups {
+		for len(g.queue.Delivered()) > 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+			g.deliver()
+		}
+		if retained := g.queue.Delivered(); len(retained) > 0 {
+			t.Errorf("Node %s still retains %d acknowledged messages", g.server.nodeID, len(retained))
+		}
+		if _, collected := g.queue.Totals(); collected != 30 {
+			t.Errorf("Node %s: expected 30 collected, got %d", g.server.nodeID, collected)
+		}
+		if pending := g.queue.Pending(); len(pending) > 0 {
+			t.Errorf("Node %s: expected nothing pending, got %d", g.server.nodeID, len(pending))
+		}
+	}
+}
+
+func TestTotalOrderQueueSameOrderEverywhere(t *testing.T) {
+	// Two nodes receive the same messages in different orders and must
+	// deliver them identically
+	deliverAll := func(order []MulticastMessage) []string {
+		q := NewTotalOrderQueue("x", 3, NodeTieBreaker)
+		for _, m := range order {
+			q.Add(m)
+			q.matrix.Observe(m.Sender, m.Timestamp, nil)
+		}
+		q.matrix.Observe("a", 10, nil)
+		q.matrix.Observe("b", 10, nil)
+		delivered, _ := q.Deliver()
+		var ids []string
+		for _, m := range delivered {
+			ids = append(ids, fmt.Sprintf("%s@%d", m.Sender, m.Timestamp))
+		}
+		return ids
+	}
+
+	a1 := MulticastMessage{Sender: "a", Timestamp: 1}
+	b1 := MulticastMessage{Sender: "b", Timestamp: 1}
+	a3 := MulticastMessage{Sender: "a", Timestamp: 3}
+	first := deliverAll([]MulticastMessage{a1, b1, a3})
+	second := deliverAll([]MulticastMessage{b1, a3, a1})
+	if strings.Join(first, ",") != "a@1,b@1,a@3" || strings.Join(first, ",") != strings.Join(second, ",") {
+		t.Errorf("Expected a@1,b@1,a@3 on both nodes, got %v and %v", first, second)
+	}
+}
+
+func TestTotalOrderQueueWaitsForAllMembers(t *testing.T) {
+	q := NewTotalOrderQueue("x", 3, NodeTieBreaker)
+	q.Add(MulticastMessage{Sender: "a", Timestamp: 2})
+	q.matrix.Observe("a", 2, nil)
+
+	if delivered, _ := q.Deliver(); len(delivered) != 0 {
+		t.Errorf("Expected no delivery before hearing from every member, got %v", delivered)
+	}
+	// b may still send a message at 2, which would order first
+	q.matrix.Observe("b", 1, nil)
+	if delivered, _ := q.Deliver(); len(delivered) != 0 {
+		t.Errorf("Expected no delivery while b is behind, got %v", delivered)
+	}
+	q.matrix.Observe("b", 2, nil)
+	if delivered, _ := q.Deliver(); len(delivered) != 1 || delivered[0].Seq != 1 {
+		t.Errorf("Expected a@2 delivered as seq 1, got %v", delivered)
+	}
+}
+
+func TestTotalOrderQueueTieBreaker(t *testing.T) {
+	q := NewTotalOrderQueue("x", 3, HashTieBreaker)
+	a := MulticastMessage{Sender: "a", Timestamp: 4}
+	b := MulticastMessage{Sender: "b", Timestamp: 4}
+	q.Add(a)
+	q.Add(b)
+	q.Add(a)
+	q.matrix.Observe("a", 4, nil)
+	q.matrix.Observe("b", 4, nil)
+
+	delivered, _ := q.Deliver()
+	if len(delivered) != 2 {
+		t.Fatalf("Expected 2 messages delivered once, got %v", delivered)
+	}
+	first := HashTieBreaker.Less(a.event(), b.event())
+	if (delivered[0].Sender == "a") != first {
+		t.Errorf("Expected delivery ordered by the hash tie breaker, got %v", delivered)
+	}
+}
+
+func TestMulticastIgnoresArrivalTieBreaker(t *testing.T) {
+	server := NewServer()
+	server.ties = ArrivalTieBreaker
+	m := NewMulticast(server)
+	if _, ok := m.queue.tie.(arrivalTieBreaker); ok {
+		t.Errorf("Expected arrival order to be replaced for multicast delivery")
+	}
+}
+
+func TestPeerMulticastValidation(t *testing.T) {
+	server := NewServer()
+	server.nodeID = "a"
+	m := NewMulticast(server)
+
+	for _, body := range []string{
+		`not json`,
+		`{"kind":"message","sender":"","timestamp":1}`,
+		`{"kind":"message","sender":"a","timestamp":1}`,
+		`{"kind":"other","sender":"b","timestamp":1}`,
+		`{"kind":"ack","sender":"b","timestamp":0}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/peer/multicast", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		m.handlePeerMulticast(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, w.Code)
+		}
+	}
+}
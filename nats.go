@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATSBridge connects the clock to NATS. Messages on Subject are merged
+// through the clock, and local events are published to PublishSubject.
+type NATSBridge struct {
+	conn           *nats.Conn
+	server         *Server
+	subject        string
+	publishSubject string
+	logger         *slog.Logger
+}
+
+// connectNATS dials the NATS server, retrying in the background when it is
+// not reachable yet
+func connectNATS(cfg *Config, logger *slog.Logger) (*nats.Conn, error) {
+	return nats.Connect(cfg.NATSURL,
+		nats.Name("lamport-"+cfg.NodeID),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.DrainTimeout(natsDrainTimeout),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			logger.Warn("NATS disconnected", "error", err)
+		}),
+		nats.ReconnectHandler(func(c *nats.Conn) {
+			logger.Info("NATS reconnected", "url", c.ConnectedUrl())
+		}),
+	)
+}
+
+// NewNATSBridge creates a bridge; an empty subject disables that direction
+func NewNATSBridge(conn *nats.Conn, server *Server, subject, publishSubject string) *NATSBridge {
+	return &NATSBridge{
+		conn:           conn,
+		server:         server,
+		subject:        subject,
+		publishSubject: publishSubject,
+		logger:         server.logger.With("transport", "nats"),
+	}
+}
+
+// Run consumes and publishes until ctx is done, then drains the connection
+func (b *NATSBridge) Run(ctx context.Context) error {
+	if b.subject != "" {
+		if _, err := b.conn.Subscribe(b.subject, b.handleMsg); err != nil {
+			return err
+		}
+		b.logger.Info("Subscribed to NATS", "subject", b.subject)
+	}
+
+	if b.publishSubject != "" {
+		b.server.forwardLocalEvents(ctx, b.publish)
+	} else {
+		<-ctx.Done()
+	}
+	return b.drain()
+}
+
+// drain processes buffered incoming messages and flushes outgoing ones,
+// waiting until the connection is closed
+func (b *NATSBridge) drain() error {
+	if err := b.conn.Drain(); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(natsDrainTimeout)
+	for !b.conn.IsClosed() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+func (b *NATSBridge) handleMsg(msg *nats.Msg) {
+	event, ok, err := b.server.receiveBridged("nats", msg.Header.Get, string(msg.Data))
+	if err != nil {
+		b.logger.Warn("Rejected NATS message", "subject", msg.Subject, "error", err)
+		return
+	}
+	if ok {
+		b.logger.Debug("Merged NATS message", eventAttrs(event)...)
+	}
+}
+
+func (b *NATSBridge) publish(e Event) {
+	if err := b.conn.PublishMsg(natsMessage(b.publishSubject, e, b.server.nodeID)); err != nil {
+		b.logger.Warn("Failed to publish event", append(eventAttrs(e), "error", err)...)
+		return
+	}
+	b.server.metrics.Inc("lamport_bridge_published_total", "transport", "nats")
+}
+
+// natsMessage builds the NATS message announcing a local event. Its
+// Nats-Msg-Id is unique per node and event so JetStream can deduplicate.
+func natsMessage(subject string, e Event, nodeID string) *nats.Msg {
+	msg := nats.NewMsg(subject)
+	for key, value := range clockHeaders(e, nodeID) {
+		msg.Header.Set(key, value)
+	}
+	msg.Header.Set(nats.MsgIdHdr, nodeID+"/"+e.ID)
+	msg.Data = []byte(e.Message)
+	return msg
+}
+
+// natsDrainTimeout bounds how long shutdown waits for pending NATS messages
+const natsDrainTimeout = 5 * time.Second
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestNATSMessage(t *testing.T) {
+	msg := natsMessage("lamport.messages", Event{ID: "event-1", Message: "Hello", Timestamp: 4}, "a")
+
+	if msg.Subject != "lamport.messages" || string(msg.Data) != "Hello" {
+		t.Errorf("Unexpected message: %s %q", msg.Subject, msg.Data)
+	}
+	if msg.Header.Get(headerTimestamp) != "4" || msg.Header.Get(headerSender) != "a" {
+		t.Errorf("Unexpected headers: %v", msg.Header)
+	}
+	if msg.Header.Get(nats.MsgIdHdr) != "a/event-1" {
+		t.Errorf("Expected message ID a/event-1, got %q", msg.Header.Get(nats.MsgIdHdr))
+	}
+}
+
+func TestNATSBridgeHandleMsg(t *testing.T) {
+	sender := NewServer()
+	sender.nodeID = "b"
+	for i := 0; i < 4; i++ {
+		sender.logEvent("e", "Work")
+	}
+	sent, _ := sender.recordLocal(Event{ID: "event-5", Message: "From b"})
+
+	receiver := NewServer()
+	receiver.nodeID = "a"
+	bridge := NewNATSBridge(nil, receiver, "lamport.messages", "")
+	bridge.handleMsg(natsMessage("lamport.messages", sent, sender.nodeID))
+
+	if receiver.clock.GetTime() != 6 {
+		t.Errorf("Expected clock 6 after receiving timestamp 5, got %d", receiver.clock.GetTime())
+	}
+	receiver.mutex.RLock()
+	defer receiver.mutex.RUnlock()
+	if receiver.events.Len() != 1 || receiver.events.Events()[0].Sender != "b" {
+		t.Errorf("Expected one event from b, got %+v", receiver.events.Events())
+	}
+
+	// Messages without a timestamp header are dropped
+	bridge.handleMsg(&nats.Msg{Subject: "lamport.messages", Data: []byte("bare")})
+	if receiver.events.Len() != 1 {
+		t.Errorf("Expected message without timestamp to be dropped")
+	}
+}
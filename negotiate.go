@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	msgpack "github.com/hashicorp/go-msgpack/v2/codec"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec/lamportpb"
+)
+
+// Representations of the event and time endpoints. Protocol buffers use the
+// messages of codec/lamportpb; msgpack uses the field names of the JSON.
+const (
+	mediaJSON     = "application/json"
+	mediaProtobuf = "application/x-protobuf"
+	mediaMsgpack  = "application/msgpack"
+)
+
+// mediaAliases maps the other names in use for the representations
+var mediaAliases = map[string]string{
+	mediaJSON:               mediaJSON,
+	mediaProtobuf:           mediaProtobuf,
+	"application/protobuf":  mediaProtobuf,
+	mediaMsgpack:            mediaMsgpack,
+	"application/x-msgpack": mediaMsgpack,
+}
+
+// msgpackHandle encodes structs by their json tags and time as the msgpack
+// timestamp extension
+var msgpackHandle = &msgpack.MsgpackHandle{WriteExt: true}
+
+// negotiate picks the representation of a response from the Accept header
+// and marks the response as varying with it. JSON is the default, also for
+// wildcards and types it does not know, so browsers and curl get JSON.
+func negotiate(w http.ResponseWriter, r *http.Request) string {
+	w.Header().Add("Vary", "Accept")
+	best, bestQ := mediaJSON, 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		media, ok := mediaAliases[mediaType]
+		if !ok && (mediaType == "*/*" || mediaType == "application/*") {
+			media, ok = mediaJSON, true
+		}
+		if ok && q > bestQ {
+			best, bestQ = media, q
+		}
+	}
+	return best
+}
+
+// mediaETag gives each representation its own entity tag
+func mediaETag(tag, media string) string {
+	switch media {
+	case mediaProtobuf:
+		return strings.TrimSuffix(tag, `"`) + `.pb"`
+	case mediaMsgpack:
+		return strings.TrimSuffix(tag, `"`) + `.msgpack"`
+	}
+	return tag
+}
+
+// writeAs encodes a response in the negotiated representation: msgpack and
+// JSON encode v, protocol buffers the message built by pb
+func writeAs(w http.ResponseWriter, media string, v interface{}, pb func() proto.Message) {
+	switch media {
+	case mediaProtobuf:
+		data, err := proto.Marshal(pb())
+		if err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", mediaProtobuf)
+		w.Write(data)
+	case mediaMsgpack:
+		w.Header().Set("Content-Type", mediaMsgpack)
+		msgpack.NewEncoder(w, msgpackHandle).Encode(v)
+	default:
+		w.Header().Set("Content-Type", mediaJSON)
+		json.NewEncoder(w).Encode(v)
+	}
+}
+
+// writeEvent answers with a single event
+func writeEvent(w http.ResponseWriter, r *http.Request, event Event) {
+	writeAs(w, negotiate(w, r), event, func() proto.Message {
+		return lamportpb.FromEvent(event.wire())
+	})
+}
+
+// writeEventList answers with events in the form of an /events answer
+func writeEventList(w http.ResponseWriter, r *http.Request, events []Event, now ClockTime, dropped int64) {
+	writeAs(w, negotiate(w, r), map[string]interface{}{
+		"current_timestamp": now.Timestamp,
+		"epoch":             now.Epoch,
+		"event_count":       len(events),
+		"dropped_count":     dropped,
+		"events":            events,
+	}, func() proto.Message {
+		return eventListMessage(now, events, dropped, false)
+	})
+}
+
+// timeMessage is the protocol buffers form of a /time answer
+func timeMessage(now ClockTime, wall time.Time, node string, timedOut bool) *lamportpb.Time {
+	return &lamportpb.Time{
+		LamportTimestamp: uint64(now.Timestamp),
+		Epoch:            uint64(now.Epoch),
+		WallTime:         timestamppb.New(wall),
+		NodeId:           node,
+		TimedOut:         timedOut,
+	}
+}
+
+// eventListMessage is the protocol buffers form of an /events answer
+func eventListMessage(now ClockTime, events []Event, dropped int64, timedOut bool) *lamportpb.EventList {
+	list := &lamportpb.EventList{
+		CurrentTimestamp: uint64(now.Timestamp),
+		Epoch:            uint64(now.Epoch),
+		EventCount:       uint64(len(events)),
+		DroppedCount:     uint64(dropped),
+		Events:           make([]*lamportpb.Event, len(events)),
+		TimedOut:         timedOut,
+	}
+	for i, e := range events {
+		list.Events[i] = lamportpb.FromEvent(e.wire())
+	}
+	return list
+}
+
+// decodeEventBody reads a new event from a JSON, protocol buffers or
+// msgpack body. ok is false for requests without a body of those types.
+func decodeEventBody(r *http.Request) (event Event, ok bool, err error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaAliases[mediaType] {
+	case mediaJSON:
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			return Event{}, true, errors.New("Invalid JSON body")
+		}
+	case mediaProtobuf:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return Event{}, true, errors.New("Failed to read body")
+		}
+		var pb lamportpb.NewEvent
+		if err := proto.Unmarshal(data, &pb); err != nil {
+			return Event{}, true, errors.New("Invalid protobuf body")
+		}
+		event = Event{
+			Message:       pb.GetMessage(),
+			Type:          pb.GetType(),
+			SchemaVersion: int(pb.GetSchemaVersion()),
+			Payload:       pb.GetPayload(),
+			Metadata:      pb.GetMetadata(),
+		}
+	case mediaMsgpack:
+		if err := msgpack.NewDecoder(r.Body, msgpackHandle).Decode(&event); err != nil {
+			return Event{}, true, errors.New("Invalid msgpack body")
+		}
+	default:
+		return Event{}, false, nil
+	}
+	if len(event.Payload) > 0 && !json.Valid(event.Payload) {
+		return Event{}, true, errors.New("Invalid payload, expected a JSON document")
+	}
+	return event, true, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	msgpack "github.com/hashicorp/go-msgpack/v2/codec"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec/lamportpb"
+)
+
+func TestNegotiate(t *testing.T) {
+	cases := []struct {
+		accept string
+		want   string
+	}{
+		{"", mediaJSON},
+		{"text/html,application/xhtml+xml,*/*;q=0.8", mediaJSON},
+		{"application/x-protobuf", mediaProtobuf},
+		{"application/protobuf", mediaProtobuf},
+		{"application/msgpack, application/json;q=0.5", mediaMsgpack},
+		{"application/json;q=0.9, application/x-msgpack", mediaMsgpack},
+		{"application/x-protobuf;q=0.2, */*;q=0.5", mediaJSON},
+		{"application/x-protobuf;q=0", mediaJSON},
+		{"application/json, application/x-protobuf", mediaJSON},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/time", nil)
+		req.Header.Set("Accept", c.accept)
+		w := httptest.NewRecorder()
+		if got := negotiate(w, req); got != c.want {
+			t.Errorf("Accept %q: expected %s, got %s", c.accept, c.want, got)
+		}
+		if w.Header().Get("Vary") != "Accept" {
+			t.Errorf("Expected the response to vary with Accept")
+		}
+	}
+}
+
+func TestProtobufResponses(t *testing.T) {
+	server := NewServer()
+	server.nodeID = "node-a"
+
+	body, _ := proto.Marshal(&lamportpb.NewEvent{Message: "compact", Metadata: map[string]string{"k": "v"}})
+	req := httptest.NewRequest(http.MethodPost, "/event", bytes.NewReader(body))
+	req.Header.Set("Content-Type", mediaProtobuf)
+	req.Header.Set("Accept", mediaProtobuf)
+	w := httptest.NewRecorder()
+	server.handleCreateEvent(w, req)
+	var event lamportpb.Event
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != mediaProtobuf {
+		t.Fatalf("Expected a protobuf answer, got %d %v: %s", w.Code, w.Header(), w.Body.String())
+	}
+	if err := proto.Unmarshal(w.Body.Bytes(), &event); err != nil {
+		t.Fatalf("Invalid protobuf: %v", err)
+	}
+	if event.GetMessage() != "compact" || event.GetLamportTimestamp() != 1 || event.GetMetadata()["k"] != "v" || event.GetWallTime() == nil {
+		t.Errorf("Unexpected event %v", &event)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/message?timestamp=9&message=hi&sender=b", nil)
+	req.Header.Set("Accept", mediaProtobuf)
+	w = httptest.NewRecorder()
+	server.handleReceiveMessage(w, req)
+	proto.Unmarshal(w.Body.Bytes(), &event)
+	if event.GetLamportTimestamp() != 10 || event.GetSender() != "b" {
+		t.Errorf("Expected the receive event at 10, got %v", &event)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/time", nil)
+	req.Header.Set("Accept", mediaProtobuf)
+	w = httptest.NewRecorder()
+	server.handleGetTime(w, req)
+	var now lamportpb.Time
+	if err := proto.Unmarshal(w.Body.Bytes(), &now); err != nil || now.GetLamportTimestamp() != 10 || now.GetNodeId() != "node-a" {
+		t.Errorf("Expected time 10 of node-a, got %v (%v)", &now, err)
+	}
+	if tag := w.Header().Get("ETag"); !strings.HasSuffix(tag, `.pb"`) {
+		t.Errorf("Expected a tag of the protobuf representation, got %s", tag)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/events?order=total", nil)
+	req.Header.Set("Accept", mediaProtobuf)
+	w = httptest.NewRecorder()
+	server.handleGetEvents(w, req)
+	var list lamportpb.EventList
+	if err := proto.Unmarshal(w.Body.Bytes(), &list); err != nil || list.GetEventCount() != 2 || len(list.GetEvents()) != 2 || list.GetEvents()[1].GetId() != event.GetId() {
+		t.Errorf("Expected both events, got %v (%v)", &list, err)
+	}
+}
+
+func TestMsgpackResponses(t *testing.T) {
+	server := NewServer()
+
+	var body bytes.Buffer
+	msgpack.NewEncoder(&body, msgpackHandle).Encode(map[string]interface{}{
+		"message": "packed",
+		"payload": []byte(`{"n":1}`),
+	})
+	req := httptest.NewRequest(http.MethodPost, "/event", &body)
+	req.Header.Set("Content-Type", mediaMsgpack)
+	req.Header.Set("Accept", mediaMsgpack)
+	w := httptest.NewRecorder()
+	server.handleCreateEvent(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != mediaMsgpack {
+		t.Fatalf("Expected a msgpack answer, got %d: %s", w.Code, w.Body.String())
+	}
+	var event Event
+	if err := msgpack.NewDecoder(w.Body, msgpackHandle).Decode(&event); err != nil {
+		t.Fatalf("Invalid msgpack: %v", err)
+	}
+	if event.Message != "packed" || string(event.Payload) != `{"n":1}` || event.Timestamp != 1 {
+		t.Errorf("Unexpected event %+v", event)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/time", nil)
+	req.Header.Set("Accept", mediaMsgpack)
+	w = httptest.NewRecorder()
+	server.handleGetTime(w, req)
+	var now struct {
+		Timestamp int64     `json:"lamport_timestamp"`
+		WallTime  time.Time `json:"wall_time"`
+	}
+	if err := msgpack.NewDecoder(w.Body, msgpackHandle).Decode(&now); err != nil || now.Timestamp != 1 || now.WallTime.IsZero() {
+		t.Errorf("Expected time 1 with the wall time, got %+v (%v)", now, err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/event", strings.NewReader("\xc1"))
+	req.Header.Set("Content-Type", mediaMsgpack)
+	w = httptest.NewRecorder()
+	server.handleCreateEvent(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid body, got %d", w.Code)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// ObjectStore is a flat namespace of objects by key, such as an S3 bucket
+type ObjectStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	// List returns the keys starting with prefix
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// OpenObjectStore opens the objects at rawURL: s3://bucket/prefix on the
+// S3 compatible service at endpoint, with the credentials of the
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY variables, or a directory,
+// file:///path
+func OpenObjectStore(rawURL, endpoint string) (ObjectStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "file":
+		if u.Path == "" {
+			return nil, errors.New("file URL without a path")
+		}
+		if err := os.MkdirAll(u.Path, 0o755); err != nil {
+			return nil, err
+		}
+		return dirObjects(u.Path), nil
+	case "s3":
+		if u.Host == "" {
+			return nil, errors.New("s3 URL without a bucket")
+		}
+		ep, err := url.Parse(endpoint)
+		if err != nil || ep.Host == "" {
+			return nil, fmt.Errorf("invalid endpoint %q", endpoint)
+		}
+		client, err := minio.New(ep.Host, &minio.Options{
+			Creds:  credentials.NewEnvAWS(),
+			Secure: ep.Scheme != "http",
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &s3Objects{client: client, bucket: u.Host, prefix: strings.Trim(u.Path, "/")}, nil
+	}
+	return nil, fmt.Errorf("unsupported object store %q, expected s3:// or file://", u.Scheme)
+}
+
+// dirObjects keeps the objects as files under a directory
+type dirObjects string
+
+func (d dirObjects) Put(ctx context.Context, key string, data []byte) error {
+	name := filepath.Join(string(d), filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	// Write then rename, so a listed object is always complete
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+func (d dirObjects) Get(ctx context.Context, key string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(d), filepath.FromSlash(key)))
+}
+
+func (d dirObjects) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(string(d), func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || strings.HasSuffix(name, ".tmp") {
+			return err
+		}
+		rel, err := filepath.Rel(string(d), name)
+		if key := filepath.ToSlash(rel); err == nil && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return err
+	})
+	return keys, err
+}
+
+// s3Objects keeps the objects in a bucket, under a key prefix
+type s3Objects struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func (o *s3Objects) Put(ctx context.Context, key string, data []byte) error {
+	_, err := o.client.PutObject(ctx, o.bucket, path.Join(o.prefix, key), bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: "application/octet-stream"})
+	return err
+}
+
+func (o *s3Objects) Get(ctx context.Context, key string) ([]byte, error) {
+	object, err := o.client.GetObject(ctx, o.bucket, path.Join(o.prefix, key), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+	return io.ReadAll(object)
+}
+
+func (o *s3Objects) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	full := prefix
+	if o.prefix != "" {
+		full = o.prefix + "/" + prefix
+	}
+	for info := range o.client.ListObjects(ctx, o.bucket, minio.ListObjectsOptions{Prefix: full, Recursive: true}) {
+		if info.Err != nil {
+			return nil, info.Err
+		}
+		key := info.Key
+		if o.prefix != "" {
+			key = strings.TrimPrefix(key, o.prefix+"/")
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+type openAPIDoc struct {
+	Paths map[string]map[string]json.RawMessage `json:"paths"`
+}
+
+func loadOpenAPI(t *testing.T) openAPIDoc {
+	t.Helper()
+	var doc openAPIDoc
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatalf("Invalid openapi.json: %v", err)
+	}
+	return doc
+}
+
+// registeredRoutes parses main.go and routes.go for the patterns passed to
+// Handle and HandleFunc, leaving out the ones that are not part of the
+// public API
+func registeredRoutes(t *testing.T) []string {
+	t.Helper()
+	var routes []string
+	for _, name := range []string{"main.go", "routes.go"} {
+		file, err := parser.ParseFile(token.NewFileSet(), name, nil, 0)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", name, err)
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) == 0 {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || (sel.Sel.Name != "Handle" && sel.Sel.Name != "HandleFunc") {
+				return true
+			}
+			lit, ok := call.Args[0].(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				return true
+			}
+			route, _ := strconv.Unquote(lit.Value)
+			if route != "/" && route != "/ui/" && !strings.HasPrefix(route, "/peer/") {
+				routes = append(routes, route)
+			}
+			return true
+		})
+	}
+	if len(routes) == 0 {
+		t.Fatalf("Expected routes in main.go")
+	}
+	return routes
+}
+
+// routeServes reports whether a ServeMux pattern serves a spec path
+func routeServes(route, path string) bool {
+	if strings.HasSuffix(route, "/") {
+		return strings.HasPrefix(path, route)
+	}
+	return route == path
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	doc := loadOpenAPI(t)
+	routes := registeredRoutes(t)
+
+	for _, route := range routes {
+		found := false
+		for path := range doc.Paths {
+			found = found || routeServes(route, path)
+		}
+		if !found {
+			t.Errorf("Route %s is not described in openapi.json", route)
+		}
+	}
+	for path, ops := range doc.Paths {
+		found := false
+		for _, route := range routes {
+			found = found || routeServes(route, path)
+		}
+		if !found {
+			t.Errorf("Path %s of openapi.json is not served", path)
+		}
+		for method := range ops {
+			switch method {
+			case "get", "post", "put", "patch", "delete":
+			default:
+				t.Errorf("Unexpected operation %s %s", method, path)
+			}
+		}
+	}
+}
+
+// openAPISchemas compiles the component schemas of the document
+func openAPISchemas(t *testing.T, names ...string) map[string]*jsonschema.Schema {
+	t.Helper()
+	spec, err := jsonschema.UnmarshalJSON(bytes.NewReader(openAPISpec))
+	if err != nil {
+		t.Fatalf("Invalid openapi.json: %v", err)
+	}
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource("openapi.json", spec); err != nil {
+		t.Fatalf("Failed to add openapi.json: %v", err)
+	}
+	schemas := make(map[string]*jsonschema.Schema)
+	for _, name := range names {
+		schema, err := compiler.Compile("openapi.json#/components/schemas/" + name)
+		if err != nil {
+			t.Fatalf("Failed to compile %s: %v", name, err)
+		}
+		schemas[name] = schema
+	}
+	return schemas
+}
+
+func TestOpenAPIResponses(t *testing.T) {
+	server := NewServer()
+	server.logEvent("e1", "First")
+
+	cases := []struct {
+		schema  string
+		method  string
+		target  string
+		body    string
+		handler http.HandlerFunc
+	}{
+		{"Time", http.MethodGet, "/time", "", server.handleGetTime},
+		{"Event", http.MethodPost, "/event?message=hello", "", server.handleCreateEvent},
+		{"Event", http.MethodPost, "/event", `{"message":"typed","metadata":{"k":"v"}}`, server.handleCreateEvent},
+		{"Event", http.MethodPost, "/message?timestamp=9&message=hi&sender=node-b", "", server.handleReceiveMessage},
+		{"EventList", http.MethodGet, "/events", "", server.handleGetEvents},
+		{"EventList", http.MethodGet, "/events?order=total", "", server.handleGetEvents},
+		{"MerkleRoot", http.MethodGet, "/events/root", "", server.handleMerkleRoot},
+		{"Comparison", http.MethodGet, "/compare?a=e1&b=e1", "", server.handleCompare},
+		{"Register", http.MethodPut, "/kv/color", "blue", server.handleKV},
+		{"Register", http.MethodGet, "/kv/color", "", server.handleKV},
+		{"Event", http.MethodPost, "/clocks/a/tick?message=x", "", server.handleClock},
+		{"ClockHistory", http.MethodGet, "/clock/history", "", server.handleClockHistory},
+		{"EventList", http.MethodGet, "/events/at/1", "", server.handleEventsAt},
+		{"EventList", http.MethodGet, "/events/range/0/5", "", server.handleEventsRange},
+		{"Event", http.MethodGet, "/events/e1", "", server.handleEvent},
+		{"EventList", http.MethodGet, "/events/search?contains=Fir", "", server.handleSearchEvents},
+		{"Annotation", http.MethodGet, "/events/e1/annotations", "", server.handleEvent},
+	}
+	names := make([]string, 0, len(cases))
+	for _, c := range cases {
+		names = append(names, c.schema)
+	}
+	schemas := openAPISchemas(t, names...)
+
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.target, strings.NewReader(c.body))
+		if strings.HasPrefix(c.body, "{") {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		w := httptest.NewRecorder()
+		c.handler(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s %s: expected 200, got %d: %s", c.method, c.target, w.Code, w.Body.String())
+			continue
+		}
+		instance, err := jsonschema.UnmarshalJSON(w.Body)
+		if err != nil {
+			t.Errorf("%s %s: invalid JSON: %v", c.method, c.target, err)
+			continue
+		}
+		if err := schemas[c.schema].Validate(instance); err != nil {
+			t.Errorf("%s %s does not match %s: %v", c.method, c.target, c.schema, err)
+		}
+	}
+}
+
+// TestOpenAPIParameters checks that every query parameter a path reads is
+// documented, for the handlers in main.go
+func TestOpenAPIParameters(t *testing.T) {
+	var doc struct {
+		Paths map[string]map[string]struct {
+			Parameters []struct {
+				Name string `json:"name"`
+				In   string `json:"in"`
+			} `json:"parameters"`
+		} `json:"paths"`
+	}
+	json.Unmarshal(openAPISpec, &doc)
+
+	// A handler serves every method of the documented paths its routes
+	// match, and may read the query parameters of any of them
+	src := parsePackage(t)
+	documented := make(map[string]map[string]bool)
+	for path, methods := range doc.Paths {
+		route := servingRoute(src.routes, path)
+		if route == "" {
+			t.Errorf("%s is documented but not routed", path)
+			continue
+		}
+		handler := src.routes[route]
+		if documented[handler] == nil {
+			documented[handler] = make(map[string]bool)
+		}
+		for _, op := range methods {
+			for _, p := range op.Parameters {
+				if p.In == "query" {
+					documented[handler][p.Name] = true
+				}
+			}
+		}
+	}
+
+	checked := 0
+	for handler, names := range documented {
+		if src.funcs[handler] == nil {
+			continue // served by a closure or another package
+		}
+		checked++
+		for _, name := range src.queryParams(handler) {
+			if !names[name] {
+				t.Errorf("%s reads %s, which is not documented", handler, name)
+			}
+		}
+	}
+	if checked < len(documented)/2 {
+		t.Errorf("Only %d of %d routes have a handler to check", checked, len(documented))
+	}
+}
+
+// packageSource is the parsed source of the non-test files of the package
+type packageSource struct {
+	files  map[string][]byte
+	fset   *token.FileSet
+	funcs  map[string][]*ast.FuncDecl // by name, methods of any receiver included
+	routes map[string]string          // handler name by registered pattern
+}
+
+func parsePackage(t *testing.T) *packageSource {
+	t.Helper()
+	names, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := &packageSource{
+		files:  make(map[string][]byte),
+		fset:   token.NewFileSet(),
+		funcs:  make(map[string][]*ast.FuncDecl),
+		routes: make(map[string]string),
+	}
+	for _, name := range names {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file, err := parser.ParseFile(src.fset, name, data, 0)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", name, err)
+		}
+		if file.Name.Name != "main" {
+			continue
+		}
+		src.files[name] = data
+		for _, decl := range file.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok {
+				src.funcs[fn.Name.Name] = append(src.funcs[fn.Name.Name], fn)
+			}
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) != 2 {
+				return true
+			}
+			if sel, ok := call.Fun.(*ast.SelectorExpr); !ok || (sel.Sel.Name != "HandleFunc" && sel.Sel.Name != "Handle") {
+				return true
+			}
+			pattern, ok := call.Args[0].(*ast.BasicLit)
+			if !ok || pattern.Kind != token.STRING {
+				return true
+			}
+			route, _ := strconv.Unquote(pattern.Value)
+			src.routes[route] = innermostHandler(call.Args[1])
+			return true
+		})
+	}
+	return src
+}
+
+// innermostHandler returns the name of the handler wrapped by middleware,
+// such as handleCreateEvent of s.limit(s.admit(s.handleCreateEvent))
+func innermostHandler(expr ast.Expr) string {
+	for {
+		switch e := expr.(type) {
+		case *ast.CallExpr:
+			if len(e.Args) == 0 {
+				return ""
+			}
+			if sel, ok := e.Fun.(*ast.SelectorExpr); ok && strings.HasPrefix(sel.Sel.Name, "handle") {
+				return sel.Sel.Name // a handler built from its arguments
+			}
+			expr = e.Args[len(e.Args)-1]
+		case *ast.SelectorExpr:
+			return e.Sel.Name
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// servingRoute returns the registered pattern that serves a documented
+// path, by the rules of http.ServeMux
+func servingRoute(routes map[string]string, path string) string {
+	path = regexp.MustCompile(`\{[a-z_]+\}`).ReplaceAllString(path, "x")
+	best := ""
+	for route := range routes {
+		if route == path || (strings.HasSuffix(route, "/") && strings.HasPrefix(path, route) && len(route) > len(best)) {
+			if route == path {
+				return route
+			}
+			best = route
+		}
+	}
+	return best
+}
+
+var queryGet = regexp.MustCompile(`(?:\.Get|FormValue)\("([a-z_]+)"\)`)
+
+// queryParams returns the query parameters a function reads, directly or
+// through the functions it calls with the request or its query
+func (src *packageSource) queryParams(name string) []string {
+	seen := make(map[*ast.FuncDecl]bool)
+	var names []string
+	var visit func(string)
+	visit = func(name string) {
+		for _, fn := range src.funcs[name] {
+			if seen[fn] {
+				continue
+			}
+			seen[fn] = true
+			pos := src.fset.Position(fn.Pos())
+			body := src.files[pos.Filename][pos.Offset:src.fset.Position(fn.End()).Offset]
+			for _, m := range queryGet.FindAllSubmatch(body, -1) {
+				names = append(names, string(m[1]))
+			}
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok || !passesRequest(call) {
+					return true
+				}
+				switch f := call.Fun.(type) {
+				case *ast.Ident:
+					visit(f.Name)
+				case *ast.SelectorExpr:
+					visit(f.Sel.Name)
+				}
+				return true
+			})
+		}
+	}
+	visit(name)
+	return names
+}
+
+// passesRequest reports whether a call hands on the request, its URL or
+// its query, by the names the handlers give them
+func passesRequest(call *ast.CallExpr) bool {
+	for _, arg := range call.Args {
+		found := false
+		ast.Inspect(arg, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok && (id.Name == "r" || id.Name == "query" || id.Name == "q") {
+				found = true
+			}
+			return !found
+		})
+		if found {
+			return true
+		}
+	}
+	return false
+}
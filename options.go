@@ -0,0 +1,60 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ServerOption configures a server created by NewServer
+type ServerOption func(*Server)
+
+// WithClock runs the server on clock instead of a new one
+func WithClock(clock *LamportClock) ServerOption {
+	return func(s *Server) { s.clock = clock }
+}
+
+// WithStore keeps the event log in store instead of memory. Events already
+// in store are resumed: the hash chain continues from the newest one and
+// the clock starts past it.
+func WithStore(store EventStore) ServerOption {
+	return func(s *Server) { s.events = store }
+}
+
+// WithLogger logs to logger instead of the default logger
+func WithLogger(logger *slog.Logger) ServerOption {
+	return func(s *Server) { s.logger = logger }
+}
+
+// WithNodeID names the node events of the server are attributed to
+func WithNodeID(id string) ServerOption {
+	return func(s *Server) { s.nodeID = id }
+}
+
+// WithMux registers the routes of the server on mux, such as the mux of an
+// application the server is embedded in, instead of a mux of its own
+func WithMux(mux *http.ServeMux) ServerOption {
+	return func(s *Server) { s.mux = mux }
+}
+
+// WithPrefix serves the routes under prefix, such as /lamport, so several
+// servers can share a mux. Handlers see the paths without it.
+func WithPrefix(prefix string) ServerOption {
+	return func(s *Server) { s.prefix = strings.TrimSuffix(prefix, "/") }
+}
+
+// ClockOption configures a clock created by NewLamportClock
+type ClockOption func(*LamportClock)
+
+// WithRollover starts the next epoch once the timestamp reaches at, instead
+// of just below the largest int64
+func WithRollover(at int64) ClockOption {
+	return func(lc *LamportClock) { lc.rollover = at }
+}
+
+// WithWallClock stamps the clock's history with the times now returns
+// instead of the time of day, so runs can be replayed exactly
+func WithWallClock(now func() time.Time) ClockOption {
+	return func(lc *LamportClock) { lc.wall = now }
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServerEmbedded(t *testing.T) {
+	clock := NewLamportClock()
+	if _, err := clock.Set(41, true); err != nil {
+		t.Fatal(err)
+	}
+	store := NewRingStore(8)
+	server := NewServer(WithClock(clock), WithStore(store), WithNodeID("embedded"))
+
+	// The application serves its own routes next to the server's
+	app := http.NewServeMux()
+	app.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) })
+	app.Handle("/lamport/", http.StripPrefix("/lamport", server))
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/lamport/event?message=hello", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the event created, got %d %s", w.Code, w.Body.String())
+	}
+	var event Event
+	if err := json.Unmarshal(w.Body.Bytes(), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Timestamp != 42 || event.Node != "embedded" || store.Len() != 1 || clock.GetTime() != 42 {
+		t.Errorf("Expected the event on the given clock, store and node, got %+v", event)
+	}
+
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if w.Body.String() != "ok" {
+		t.Errorf("Expected the application's routes served, got %q", w.Body.String())
+	}
+}
+
+func TestServerWithMux(t *testing.T) {
+	mux := http.NewServeMux()
+	NewServer(WithMux(mux))
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/time", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected the routes registered on the given mux, got %d", w.Code)
+	}
+
+	// Servers of their own muxes do not share routes
+	if a, b := NewServer(), NewServer(); a.mux == b.mux || a.mux == http.DefaultServeMux {
+		t.Errorf("Expected a mux per server")
+	}
+}
+
+func TestServerResumesStore(t *testing.T) {
+	store := NewRingStore(8)
+	first := NewServer(WithStore(store))
+	first.appendEvent(Event{ID: "one", Timestamp: first.clock.Tick()})
+	first.appendEvent(Event{ID: "two", Timestamp: first.clock.Tick()})
+
+	second := NewServer(WithStore(store))
+	if second.clock.GetTime() < 2 || second.head != store.Events()[1].Hash {
+		t.Errorf("Expected the clock and chain resumed from the store, got %d %q", second.clock.GetTime(), second.head)
+	}
+}
+
+func TestServersShareMuxUnderPrefixes(t *testing.T) {
+	mux := http.NewServeMux()
+	a := NewServer(WithMux(mux), WithPrefix("/a/"), WithNodeID("a"))
+	b := NewServer(WithMux(mux), WithPrefix("/b"), WithNodeID("b"))
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	if w := serve(http.MethodPost, "/a/event?message=hello"); w.Code != http.StatusOK {
+		t.Fatalf("Expected the event created, got %d", w.Code)
+	}
+	if a.events.Len() != 1 || b.events.Len() != 0 {
+		t.Errorf("Expected the event on a alone, got %d and %d", a.events.Len(), b.events.Len())
+	}
+
+	// Handlers parsing their path see it without the prefix
+	if w := serve(http.MethodGet, "/a/events/at/1"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "hello") {
+		t.Errorf("Expected the event found by timestamp, got %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(http.MethodGet, "/b/events/at/1"); strings.Contains(w.Body.String(), "hello") {
+		t.Errorf("Expected no event on b, got %s", w.Body.String())
+	}
+	if w := serve(http.MethodGet, "/event"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected nothing served outside the prefixes, got %d", w.Code)
+	}
+}
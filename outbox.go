@@ -0,0 +1,411 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultOutboxInterval is how often pending outbox messages are
+// dispatched without -outbox-interval
+const defaultOutboxInterval = time.Second
+
+// outboxHistory is how many delivered messages GET /outbox keeps
+const outboxHistory = 500
+
+// outboxPrepared marks a message saved before its event was committed.
+// Prepared messages whose event is not in the log after a restart are
+// dropped, the others become pending.
+const outboxPrepared = "prepared"
+
+// OutboxMessage is a message to a peer, given by URL or node ID, written
+// along with the event it follows. The dispatcher records a send event
+// for it and delivers it to the peer's /message, stamped with that event.
+type OutboxMessage struct {
+	ID          string     `json:"id"`
+	EventID     string     `json:"event_id"`
+	Peer        string     `json:"peer"`
+	Message     string     `json:"message"`
+	Status      string     `json:"status"`
+	SendEventID string     `json:"send_event_id,omitempty"`
+	SentAt      *ClockTime `json:"sent_at,omitempty"`
+	RequestID   string     `json:"request_id,omitempty"`
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+	Created     time.Time  `json:"created"`
+	Delivered   *time.Time `json:"delivered,omitempty"`
+}
+
+// outboxState is what the outbox keeps across restarts
+type outboxState struct {
+	Next     int64           `json:"next"`
+	Messages []OutboxMessage `json:"messages"` // in the order they were written
+}
+
+// Outbox holds the messages applications write along with their events,
+// until a peer received them. A message is saved before its event is
+// committed, so an event is never logged without the messages it
+// announces. Each message is stamped once, by a send event recorded the
+// first time it is dispatched; attempts after a crash or a failure send
+// the same stamp and event ID, which the peer merges once.
+type Outbox struct {
+	server *Server
+	path   string // where the state is kept, empty to keep it in memory
+	state  outboxState
+	wake   chan struct{}
+	// dispatching serializes dispatches, so messages to a peer keep their
+	// order
+	dispatching sync.Mutex
+	mutex       sync.Mutex
+}
+
+// NewOutbox creates the outbox of a server, resuming from the state saved
+// at path when there is one
+func NewOutbox(server *Server, path string) (*Outbox, error) {
+	server.metrics.Counter("lamport_outbox_deliveries_total", "Attempts to deliver outbox messages to peers by result")
+	o := &Outbox{server: server, path: path, wake: make(chan struct{}, 1)}
+	server.metrics.GaugeFunc("lamport_outbox_pending", "Outbox messages waiting to be delivered", func() float64 {
+		return float64(len(o.Messages(deliveryPending)))
+	})
+	if path == "" {
+		return o, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return o, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading outbox file: %w", err)
+	}
+	if err := json.Unmarshal(data, &o.state); err != nil {
+		return nil, fmt.Errorf("decoding outbox file: %w", err)
+	}
+
+	// The node stopped between saving messages and committing their event
+	messages := o.state.Messages[:0]
+	for _, m := range o.state.Messages {
+		if m.Status == outboxPrepared {
+			if _, ok := server.events.Find(m.EventID); !ok {
+				continue
+			}
+			m.Status = deliveryPending
+		}
+		messages = append(messages, m)
+	}
+	o.state.Messages = messages
+	return o, nil
+}
+
+// saveLocked writes the state to the file, if any
+func (o *Outbox) saveLocked() error {
+	if o.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(o.state)
+	if err != nil {
+		return err
+	}
+	if err := writeFileDurably(o.path, data); err != nil {
+		return fmt.Errorf("writing outbox file: %w", err)
+	}
+	return nil
+}
+
+// Write commits a local event together with messages to send once it is
+// logged. Only the peer and message of each are used. Nothing is kept when
+// the event cannot be committed.
+func (o *Outbox) Write(event Event, messages []OutboxMessage) (Event, []OutboxMessage, error) {
+	now := time.Now()
+	id := localEventID("event-", now)
+	event.ID = id
+
+	o.mutex.Lock()
+	written := make([]OutboxMessage, len(messages))
+	for i, m := range messages {
+		o.state.Next++
+		written[i] = OutboxMessage{
+			ID:        "outbox-" + strconv.FormatInt(o.state.Next, 10),
+			EventID:   id,
+			Peer:      m.Peer,
+			Message:   m.Message,
+			Status:    outboxPrepared,
+			RequestID: event.RequestID,
+			Created:   now,
+		}
+	}
+	o.state.Messages = append(o.state.Messages, written...)
+	err := o.saveLocked()
+	if err != nil {
+		o.dropLocked(id)
+	}
+	o.mutex.Unlock()
+	if err != nil {
+		return Event{}, nil, err
+	}
+
+	event, err = o.server.commitLocal(event)
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if err != nil {
+		o.dropLocked(id)
+		if err := o.saveLocked(); err != nil {
+			o.server.logger.Error("Failed to save outbox", "error", err)
+		}
+		return Event{}, nil, err
+	}
+	for i := range o.state.Messages {
+		if o.state.Messages[i].EventID == id {
+			o.state.Messages[i].Status = deliveryPending
+		}
+	}
+	for i := range written {
+		written[i].Status = deliveryPending
+	}
+	// Prepared messages of a logged event are made pending on load anyway
+	if err := o.saveLocked(); err != nil {
+		o.server.logger.Error("Failed to save outbox", "error", err)
+	}
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return event, written, nil
+}
+
+// dropLocked removes the messages written with an event
+func (o *Outbox) dropLocked(eventID string) {
+	o.state.Messages = slices.DeleteFunc(o.state.Messages, func(m OutboxMessage) bool {
+		return m.EventID == eventID
+	})
+}
+
+// Messages returns the messages with a status, or all of them when status
+// is empty, oldest first
+func (o *Outbox) Messages(status string) []OutboxMessage {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	messages := []OutboxMessage{}
+	for _, m := range o.state.Messages {
+		if status == "" || m.Status == status {
+			messages = append(messages, m)
+		}
+	}
+	return messages
+}
+
+// Run dispatches pending messages as they are written, and again every
+// interval, until ctx is done
+func (o *Outbox) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-o.wake:
+		}
+		o.dispatch(ctx)
+	}
+}
+
+// dispatch attempts every pending message in order. Once a message to a
+// peer fails, the later ones to that peer wait for the next dispatch.
+func (o *Outbox) dispatch(ctx context.Context) {
+	o.dispatching.Lock()
+	defer o.dispatching.Unlock()
+
+	failed := map[string]bool{}
+	for _, m := range o.Messages(deliveryPending) {
+		if failed[m.Peer] {
+			continue
+		}
+		deliverCtx, cancel := context.WithTimeout(ctx, clusterTimeout)
+		err := o.deliver(deliverCtx, m)
+		cancel()
+		if err != nil {
+			failed[m.Peer] = true
+			o.server.logger.Warn("Outbox delivery failed, retrying", "id", m.ID, "peer", m.Peer, "error", err)
+		}
+	}
+}
+
+// deliver stamps a message with a send event, unless it already has one,
+// and sends it to the peer
+func (o *Outbox) deliver(ctx context.Context, m OutboxMessage) (err error) {
+	defer func() {
+		o.finish(m.ID, err)
+	}()
+
+	if m.SentAt == nil {
+		send, err := o.server.commitLocal(Event{
+			ID:        localEventID("send-", time.Now()),
+			Message:   m.Message,
+			RequestID: m.RequestID,
+		})
+		if err != nil {
+			return err
+		}
+		m.SendEventID = send.ID
+		m.SentAt = &ClockTime{Epoch: send.Epoch, Timestamp: send.Timestamp}
+
+		o.mutex.Lock()
+		if i := o.indexLocked(m.ID); i >= 0 {
+			o.state.Messages[i].SendEventID = m.SendEventID
+			o.state.Messages[i].SentAt = m.SentAt
+		}
+		err = o.saveLocked()
+		o.mutex.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	peer, err := o.server.peers.Resolve(ctx, m.Peer)
+	if err != nil {
+		return err
+	}
+	query := url.Values{
+		"timestamp": {strconv.FormatInt(m.SentAt.Timestamp, 10)},
+		"epoch":     {strconv.FormatInt(m.SentAt.Epoch, 10)},
+		"message":   {m.Message},
+		"sender":    {o.server.nodeID},
+		"id":        {m.SendEventID},
+	}
+	var header http.Header
+	if m.RequestID != "" {
+		header = http.Header{headerRequestID: {m.RequestID}}
+	}
+	_, err = o.server.peers.Do(ctx, peer, http.MethodPost, "/message?"+query.Encode(), header, nil)
+	return err
+}
+
+// finish records the outcome of an attempt, keeping outboxHistory
+// delivered messages
+func (o *Outbox) finish(id string, err error) {
+	o.mutex.Lock()
+	if i := o.indexLocked(id); i >= 0 {
+		m := &o.state.Messages[i]
+		m.Attempts++
+		if err != nil {
+			m.LastError = err.Error()
+		} else {
+			now := time.Now()
+			m.Status = deliveryDelivered
+			m.LastError = ""
+			m.Delivered = &now
+			o.pruneLocked()
+		}
+		if err := o.saveLocked(); err != nil {
+			o.server.logger.Error("Failed to save outbox", "error", err)
+		}
+	}
+	o.mutex.Unlock()
+
+	if err != nil {
+		o.server.metrics.Inc("lamport_outbox_deliveries_total", "result", "failed")
+		return
+	}
+	o.server.metrics.Inc("lamport_outbox_deliveries_total", "result", "delivered")
+}
+
+func (o *Outbox) indexLocked(id string) int {
+	return slices.IndexFunc(o.state.Messages, func(m OutboxMessage) bool { return m.ID == id })
+}
+
+// pruneLocked forgets the oldest delivered messages beyond outboxHistory
+func (o *Outbox) pruneLocked() {
+	delivered := 0
+	for _, m := range o.state.Messages {
+		if m.Status == deliveryDelivered {
+			delivered++
+		}
+	}
+	o.state.Messages = slices.DeleteFunc(o.state.Messages, func(m OutboxMessage) bool {
+		if delivered > outboxHistory && m.Status == deliveryDelivered {
+			delivered--
+			return true
+		}
+		return false
+	})
+}
+
+// handleOutbox commits an event with the messages to send after it on
+// POST, and lists the messages with GET ?status=pending|delivered
+func (o *Outbox) handleOutbox(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var body struct {
+			Event
+			Outbox []OutboxMessage `json:"outbox"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if len(body.Outbox) == 0 {
+			http.Error(w, "Missing outbox messages", http.StatusBadRequest)
+			return
+		}
+		for _, m := range body.Outbox {
+			if m.Peer == "" || m.Message == "" {
+				http.Error(w, "Every outbox message needs a peer and a message", http.StatusBadRequest)
+				return
+			}
+		}
+		if body.Message == "" {
+			body.Message = "Local event"
+		}
+		if body.Type != "" && body.SchemaVersion == 0 {
+			body.SchemaVersion = o.server.schemas.Latest(body.Type)
+		}
+		if err := o.server.schemas.Validate(body.Type, body.SchemaVersion, body.Payload); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+
+		event, messages, err := o.Write(Event{
+			Message:       body.Message,
+			Type:          body.Type,
+			SchemaVersion: body.SchemaVersion,
+			Payload:       body.Payload,
+			Metadata:      body.Metadata,
+			RequestID:     requestIDFrom(r.Context()),
+		}, body.Outbox)
+		if err != nil {
+			o.server.writeCommitError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"event":  event,
+			"outbox": messages,
+		})
+
+	case http.MethodGet:
+		status := r.URL.Query().Get("status")
+		if status != "" && status != deliveryPending && status != deliveryDelivered {
+			http.Error(w, "Invalid status, expected pending or delivered", http.StatusBadRequest)
+			return
+		}
+		messages := o.Messages(status)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"messages": messages,
+			"count":    len(messages),
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newOutboxPair creates the outbox of a node a whose peer b answers 503
+// while down is set
+func newOutboxPair(t *testing.T, path string) (o *Outbox, receiver *Server, peer string, down *atomic.Bool) {
+	t.Helper()
+	down = new(atomic.Bool)
+	receiver = NewServer()
+	receiver.nodeID = "b"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		receiver.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+
+	sender := NewServer()
+	sender.nodeID = "a"
+	sender.peers = NewPeers([]string{ts.URL}, http.DefaultClient)
+	o, err := NewOutbox(sender, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o, receiver, ts.URL, down
+}
+
+func TestOutboxDispatch(t *testing.T) {
+	o, receiver, peer, down := newOutboxPair(t, "")
+
+	event, written, err := o.Write(Event{Message: "order placed"}, []OutboxMessage{
+		{Peer: peer, Message: "ship"},
+		{Peer: peer, Message: "bill"},
+	})
+	if err != nil || event.Timestamp != 1 || len(written) != 2 || written[0].EventID != event.ID || written[1].Status != deliveryPending {
+		t.Fatalf("Expected the event at 1 with 2 pending messages, got %+v %+v (err: %v)", event, written, err)
+	}
+
+	// The first message is stamped and fails; the second waits behind it
+	down.Store(true)
+	o.dispatch(t.Context())
+	pending := o.Messages(deliveryPending)
+	if len(pending) != 2 || pending[0].Attempts != 1 || pending[0].SentAt == nil || pending[0].SentAt.Timestamp != 2 || pending[1].SentAt != nil {
+		t.Fatalf("Expected the first message stamped at 2 after one attempt, got %+v", pending)
+	}
+
+	down.Store(false)
+	o.dispatch(t.Context())
+	delivered := o.Messages(deliveryDelivered)
+	if len(delivered) != 2 || delivered[0].SentAt.Timestamp != 2 || delivered[1].SentAt.Timestamp != 3 || delivered[0].Delivered == nil {
+		t.Fatalf("Expected both messages delivered, stamped 2 and 3, got %+v", delivered)
+	}
+	if receiver.events.Len() != 2 || receiver.clock.GetTime() != 4 {
+		t.Errorf("Expected 2 receive events up to 4, got %d at %d", receiver.events.Len(), receiver.clock.GetTime())
+	}
+
+	// A message sent again, after a crash before it was marked, is merged once
+	if err := o.deliver(t.Context(), delivered[0]); err != nil {
+		t.Fatal(err)
+	}
+	if receiver.events.Len() != 2 {
+		t.Errorf("Expected the copy not merged, got %d events", receiver.events.Len())
+	}
+	if got := o.server.metrics.Value("lamport_outbox_deliveries_total", "result", "failed"); got != 1 {
+		t.Errorf("Expected 1 failed attempt counted, got %v", got)
+	}
+}
+
+func TestOutboxPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.json")
+	o, _, peer, down := newOutboxPair(t, path)
+	down.Store(true)
+	event, _, _ := o.Write(Event{Message: "order placed"}, []OutboxMessage{{Peer: peer, Message: "ship"}})
+	o.dispatch(t.Context())
+
+	// A restarted node resumes with the stamp already given
+	resumed, err := NewOutbox(o.server, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := resumed.Messages(deliveryPending)
+	if len(pending) != 1 || pending[0].EventID != event.ID || pending[0].SentAt == nil || pending[0].SentAt.Timestamp != 2 {
+		t.Fatalf("Expected the stamped message kept, got %+v", pending)
+	}
+	if next, _, _ := resumed.Write(Event{Message: "again"}, []OutboxMessage{{Peer: peer, Message: "ship"}}); next.ID == "" {
+		t.Error("Expected the resumed outbox to accept messages")
+	}
+	if messages := resumed.Messages(""); messages[1].ID != "outbox-2" {
+		t.Errorf("Expected the numbering resumed, got %s", messages[1].ID)
+	}
+
+	// Messages of an event that was never committed are dropped
+	state := outboxState{Next: 2, Messages: []OutboxMessage{
+		{ID: "outbox-1", EventID: event.ID, Peer: peer, Message: "ship", Status: outboxPrepared},
+		{ID: "outbox-2", EventID: "event-lost", Peer: peer, Message: "bill", Status: outboxPrepared},
+	}}
+	data, _ := json.Marshal(state)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	resumed, err = NewOutbox(o.server, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if messages := resumed.Messages(""); len(messages) != 1 || messages[0].ID != "outbox-1" || messages[0].Status != deliveryPending {
+		t.Errorf("Expected the message of the logged event alone kept pending, got %+v", messages)
+	}
+}
+
+func TestHandleOutbox(t *testing.T) {
+	o, _, peer, _ := newOutboxPair(t, "")
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		o.handleOutbox(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+	w := do(http.MethodPost, "/outbox", `{"message":"order placed","metadata":{"order":"42"},"outbox":[{"peer":"`+peer+`","message":"ship"}]}`)
+	var response struct {
+		Event  Event           `json:"event"`
+		Outbox []OutboxMessage `json:"outbox"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	if w.Code != http.StatusOK || response.Event.Metadata["order"] != "42" || len(response.Outbox) != 1 || response.Outbox[0].EventID != response.Event.ID {
+		t.Errorf("Expected the event written with its message, got %d %+v", w.Code, response)
+	}
+
+	for _, body := range []string{`{`, `{"message":"x"}`, `{"outbox":[{"peer":"b"}]}`} {
+		if w := do(http.MethodPost, "/outbox", body); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, w.Code)
+		}
+	}
+
+	w = do(http.MethodGet, "/outbox?status=pending", "")
+	var listed struct {
+		Count    int             `json:"count"`
+		Messages []OutboxMessage `json:"messages"`
+	}
+	json.NewDecoder(w.Body).Decode(&listed)
+	if listed.Count != 1 || listed.Messages[0].Message != "ship" {
+		t.Errorf("Expected the pending message listed, got %+v", listed)
+	}
+	if w := do(http.MethodGet, "/outbox?status=lost", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown status, got %d", w.Code)
+	}
+	if w := do(http.MethodDelete, "/outbox", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", w.Code)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrPartitioned is returned for requests to a peer cut off by a simulated
+// partition
+var ErrPartitioned = errors.New("partitioned")
+
+// Partition simulates a network split. Names are node IDs, peer URLs or
+// virtual clock names, each on one side; two names are cut off from each
+// other when they are on different sides. Names on no side reach everyone.
+type Partition struct {
+	groups [][]string
+	side   map[string]int
+	since  time.Time
+	mutex  sync.RWMutex
+}
+
+// NewPartition creates a healed partition
+func NewPartition() *Partition {
+	return &Partition{side: make(map[string]int)}
+}
+
+// Set splits the names into the given sides, replacing any earlier split
+func (p *Partition) Set(groups [][]string) error {
+	if len(groups) < 2 {
+		return errors.New("a partition needs at least two groups")
+	}
+	side := make(map[string]int)
+	clean := make([][]string, 0, len(groups))
+	for i, group := range groups {
+		var names []string
+		for _, name := range group {
+			if name = cleanPeerURL(name); name == "" {
+				continue
+			}
+			if _, dup := side[name]; dup {
+				return fmt.Errorf("%s is in more than one group", name)
+			}
+			side[name] = i
+			names = append(names, name)
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("group %d is empty", i)
+		}
+		clean = append(clean, names)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.groups, p.side, p.since = clean, side, time.Now()
+	return nil
+}
+
+// Heal removes the split
+func (p *Partition) Heal() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.groups, p.side, p.since = nil, make(map[string]int), time.Time{}
+}
+
+// Cut reports whether any name in a is cut off from any name in b
+func (p *Partition) Cut(a, b []string) bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	for _, x := range a {
+		sx, ok := p.side[x]
+		if !ok {
+			continue
+		}
+		for _, y := range b {
+			if sy, ok := p.side[y]; ok && sx != sy {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Groups returns the sides of the split and when it started, nil when the
+// network is whole
+func (p *Partition) Groups() ([][]string, time.Time) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.groups, p.since
+}
+
+// partitioned reports whether a peer, given by URL, is cut off from this
+// node. Peers are also matched by node ID once the failure detector has
+// learned it.
+func (s *Server) partitioned(peer string) bool {
+	names := []string{peer}
+	if s.monitor != nil {
+		for _, p := range s.monitor.Peers() {
+			if p.URL == peer && p.Node != "" {
+				names = append(names, p.Node)
+			}
+		}
+	}
+	return s.split.Cut([]string{s.nodeID}, names)
+}
+
+// withPartition drops requests from nodes on the other side of a
+// simulated partition. Peers name themselves in the Lamport-Sender header,
+// and /message names its sender in the query.
+func (s *Server) withPartition(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sender := r.Header.Get(headerSender)
+		if sender == "" && r.URL.Path == "/message" {
+			sender = r.URL.Query().Get("sender")
+		}
+		if sender != "" && s.split.Cut([]string{s.nodeID}, []string{sender}) {
+			s.metrics.Inc("lamport_partition_dropped_total", "direction", "inbound")
+			http.Error(w, fmt.Sprintf("Partitioned from %s", sender), http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// parseGroups reads groups from a JSON body {"groups":[["a","b"],["c"]]}
+// or a groups parameter such as a,b|c
+func parseGroups(r *http.Request) ([][]string, error) {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var body struct {
+			Groups [][]string `json:"groups"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return nil, errors.New("Invalid JSON body")
+		}
+		return body.Groups, nil
+	}
+	raw := r.URL.Query().Get("groups")
+	if raw == "" {
+		return nil, errors.New("Missing groups parameter")
+	}
+	var groups [][]string
+	for _, group := range strings.Split(raw, "|") {
+		groups = append(groups, strings.Split(group, ","))
+	}
+	return groups, nil
+}
+
+// handlePartition shows the simulated partition on GET and replaces it on
+// POST
+func (s *Server) handlePartition(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		groups, err := parseGroups(r)
+		if err == nil {
+			err = s.split.Set(groups)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		groups, _ = s.split.Groups()
+		s.logger.Warn("Simulated partition", "groups", groups)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.writePartition(w)
+}
+
+func (s *Server) handleHeal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.split.Heal()
+	s.logger.Info("Simulated partition healed")
+	s.writePartition(w)
+}
+
+func (s *Server) writePartition(w http.ResponseWriter) {
+	groups, since := s.split.Groups()
+	response := map[string]interface{}{
+		"node_id":     s.nodeID,
+		"partitioned": groups != nil,
+		"groups":      groups,
+	}
+	if groups != nil {
+		response["since"] = since
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
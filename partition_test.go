@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPartitionCut(t *testing.T) {
+	p := NewPartition()
+	if p.Cut([]string{"a"}, []string{"b"}) {
+		t.Error("Expected a whole network before any split")
+	}
+
+	if err := p.Set([][]string{{"a", "b"}, {"c"}}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if !p.Cut([]string{"a"}, []string{"c"}) || !p.Cut([]string{"c"}, []string{"b"}) {
+		t.Error("Expected a and b cut off from c")
+	}
+	if p.Cut([]string{"a"}, []string{"b"}) || p.Cut([]string{"a"}, []string{"d"}) {
+		t.Error("Expected a to reach its own group and names in no group")
+	}
+
+	for _, groups := range [][][]string{{{"a"}}, {{"a"}, {"a", "b"}}, {{"a"}, {""}}} {
+		if err := p.Set(groups); err == nil {
+			t.Errorf("Expected %v to be refused", groups)
+		}
+	}
+
+	p.Heal()
+	if groups, _ := p.Groups(); groups != nil || p.Cut([]string{"a"}, []string{"c"}) {
+		t.Error("Expected the split removed after healing")
+	}
+}
+
+func TestPartitionedPeers(t *testing.T) {
+	var calls int
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get(headerSender) != "a" {
+			t.Errorf("Expected a as the sender, got %q", r.Header.Get(headerSender))
+		}
+	}))
+	defer peer.Close()
+
+	server := NewServer()
+	server.nodeID = "a"
+	server.peers = NewPeers([]string{peer.URL}, http.DefaultClient)
+	server.peers.node = "a"
+	server.peers.partitioned = server.partitioned
+
+	server.split.Set([][]string{{"a"}, {peer.URL}})
+	if _, err := server.peers.Do(t.Context(), peer.URL, http.MethodGet, "/time", nil, nil); !errors.Is(err, ErrPartitioned) {
+		t.Errorf("Expected ErrPartitioned, got %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("Expected no request across the partition, got %d", calls)
+	}
+
+	server.split.Heal()
+	if _, err := server.peers.Do(t.Context(), peer.URL, http.MethodGet, "/time", nil, nil); err != nil || calls != 1 {
+		t.Errorf("Expected the peer reached after healing, got %v with %d calls", err, calls)
+	}
+}
+
+func TestWithPartitionDropsInbound(t *testing.T) {
+	server := NewServer()
+	server.nodeID = "a"
+	server.split.Set([][]string{{"a"}, {"b"}})
+	handler := server.withPartition(http.HandlerFunc(server.handleReceiveMessage))
+
+	req := httptest.NewRequest(http.MethodPost, "/message?timestamp=5&message=Hi&sender=b", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 from across the partition, got %d", w.Code)
+	}
+	if server.clock.GetTime() != 0 {
+		t.Errorf("Expected the clock untouched, got %d", server.clock.GetTime())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/message?timestamp=5&message=Hi&sender=c", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || server.clock.GetTime() != 6 {
+		t.Errorf("Expected c's message merged, got %d with clock %d", w.Code, server.clock.GetTime())
+	}
+	if got := server.metrics.Value("lamport_partition_dropped_total", "direction", "inbound"); got != 1 {
+		t.Errorf("Expected 1 dropped request, got %v", got)
+	}
+}
+
+func TestPartitionVirtualClocks(t *testing.T) {
+	server := NewServer()
+	server.split.Set([][]string{{"alice"}, {"bob"}})
+
+	req := httptest.NewRequest(http.MethodPost, "/clocks/bob/message?timestamp=3&message=Hi&sender=alice", nil)
+	w := httptest.NewRecorder()
+	server.handleClock(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 between split clocks, got %d", w.Code)
+	}
+
+	server.split.Heal()
+	w = httptest.NewRecorder()
+	server.handleClock(w, httptest.NewRequest(http.MethodPost, "/clocks/bob/message?timestamp=3&message=Hi&sender=alice", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected the message delivered after healing, got %d", w.Code)
+	}
+}
+
+func TestHandlePartition(t *testing.T) {
+	server := NewServer()
+	server.nodeID = "a"
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/partition", strings.NewReader(`{"groups":[["a"],["b","c"]]}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.handlePartition(w, req)
+	var response struct {
+		Partitioned bool       `json:"partitioned"`
+		Groups      [][]string `json:"groups"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	if !response.Partitioned || len(response.Groups) != 2 || len(response.Groups[1]) != 2 {
+		t.Errorf("Expected two groups, got %+v", response)
+	}
+
+	w = httptest.NewRecorder()
+	server.handlePartition(w, httptest.NewRequest(http.MethodPost, "/admin/partition?groups=a", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a single group, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	server.handlePartition(w, httptest.NewRequest(http.MethodPost, "/admin/partition?groups=a,b|c", nil))
+	if !server.split.Cut([]string{"b"}, []string{"c"}) {
+		t.Error("Expected the groups parameter to replace the split")
+	}
+
+	w = httptest.NewRecorder()
+	server.handleHeal(w, httptest.NewRequest(http.MethodPost, "/admin/heal", nil))
+	response.Partitioned = true
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.Partitioned {
+		t.Error("Expected the partition healed")
+	}
+}
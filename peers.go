@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/clockctx"
+)
+
+// Peers is the set of other nodes this server exchanges timestamps with.
+// Nodes may join and leave at runtime.
+type Peers struct {
+	urls      []string
+	transport Transport
+	node      string // sent as Lamport-Sender so peers know who is calling
+	token     string // sent as bearer token when peers check roles
+
+	// partitioned reports peers cut off by a simulated partition
+	partitioned func(peer string) bool
+	chaos       *Chaos
+	// clock stamps requests with the time they are sent at
+	clock func() ClockTime
+
+	mutex sync.RWMutex
+}
+
+// cleanPeerURL normalizes a base URL so the same peer is listed once
+func cleanPeerURL(u string) string {
+	return strings.TrimRight(strings.TrimSpace(u), "/")
+}
+
+// NewPeers creates a peer set from base URLs such as https://node-b:8080,
+// reached over HTTP with client
+func NewPeers(urls []string, client *http.Client) *Peers {
+	return NewPeersOver(urls, NewHTTPTransport(client))
+}
+
+// NewPeersOver creates a peer set reached over a transport, with peers
+// listed as the transport addresses them
+func NewPeersOver(urls []string, transport Transport) *Peers {
+	clean := make([]string, 0, len(urls))
+	for _, u := range urls {
+		if u = cleanPeerURL(u); u != "" {
+			clean = append(clean, u)
+		}
+	}
+	return &Peers{urls: clean, transport: transport}
+}
+
+// URLs returns the base URLs of all peers
+func (p *Peers) URLs() []string {
+	if p == nil {
+		return nil
+	}
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return append([]string(nil), p.urls...)
+}
+
+// Add adds a peer and reports whether it was new
+func (p *Peers) Add(u string) bool {
+	u = cleanPeerURL(u)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if slices.Contains(p.urls, u) {
+		return false
+	}
+	p.urls = append(p.urls, u)
+	return true
+}
+
+// Remove removes a peer and reports whether it was listed
+func (p *Peers) Remove(u string) bool {
+	u = cleanPeerURL(u)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	i := slices.Index(p.urls, u)
+	if i < 0 {
+		return false
+	}
+	p.urls = slices.Delete(p.urls, i, i+1)
+	return true
+}
+
+// Resolve finds the URL of a peer given by URL or node ID. Node IDs are
+// looked up by asking every peer.
+func (p *Peers) Resolve(ctx context.Context, peer string) (string, error) {
+	for _, u := range p.URLs() {
+		if u == cleanPeerURL(peer) {
+			return u, nil
+		}
+	}
+	for u, resp := range p.Gather(ctx, http.MethodGet, "/time", nil, nil) {
+		var reply struct {
+			Node string `json:"node_id"`
+		}
+		if resp.Err == nil && json.Unmarshal(resp.Body, &reply) == nil && reply.Node == peer {
+			return u, nil
+		}
+	}
+	return "", errors.New("Unknown peer")
+}
+
+// Do sends a request to a single peer and returns the response body.
+// Non-2xx responses are reported as errors.
+func (p *Peers) Do(ctx context.Context, peer, method, path string, header http.Header, body []byte) ([]byte, error) {
+	if p.partitioned != nil && p.partitioned(peer) {
+		return nil, fmt.Errorf("%w from %s", ErrPartitioned, peer)
+	}
+	duplicate, err := p.chaos.Inject(ctx, peer)
+	if err != nil {
+		return nil, err
+	}
+	if duplicate {
+		p.send(ctx, peer, method, path, header, body)
+	}
+	return p.send(ctx, peer, method, path, header, body)
+}
+
+func (p *Peers) send(ctx context.Context, peer, method, path string, header http.Header, body []byte) ([]byte, error) {
+	header = header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	if p.node != "" {
+		header.Set(headerSender, p.node)
+	}
+	if p.token != "" && header.Get("Authorization") == "" {
+		header.Set("Authorization", "Bearer "+p.token)
+	}
+	if header.Get(headerTimestamp) == "" {
+		clockctx.SetHeader(ctx, header)
+	}
+	if p.clock != nil {
+		header.Set(headerSentAt, time.Now().Format(time.RFC3339Nano))
+		header.Set(headerSentTime, p.clock().String())
+	}
+
+	reply, err := p.transport.Send(ctx, peer, TransportRequest{Method: method, Path: path, Header: header, Body: body})
+	if err != nil {
+		return nil, err
+	}
+	if reply.Status < 200 || reply.Status > 299 {
+		return reply.Body, fmt.Errorf("peer %s answered %d %s", peer, reply.Status, http.StatusText(reply.Status))
+	}
+	return reply.Body, nil
+}
+
+// PeerResponse is the outcome of a request to one peer
+type PeerResponse struct {
+	Body []byte
+	Err  error
+}
+
+// Gather sends the same request to every peer concurrently and returns
+// each peer's response
+func (p *Peers) Gather(ctx context.Context, method, path string, header http.Header, body []byte) map[string]PeerResponse {
+	urls := p.URLs()
+	responses := make(map[string]PeerResponse, len(urls))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, peer := range urls {
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+			data, err := p.Do(ctx, peer, method, path, header, body)
+			mu.Lock()
+			responses[peer] = PeerResponse{Body: data, Err: err}
+			mu.Unlock()
+		}(peer)
+	}
+	wg.Wait()
+
+	return responses
+}
+
+// Broadcast sends the same request to every peer concurrently and returns
+// the error of each peer, nil on success
+func (p *Peers) Broadcast(ctx context.Context, method, path string, header http.Header, body []byte) map[string]error {
+	results := make(map[string]error, len(p.URLs()))
+	for peer, resp := range p.Gather(ctx, method, path, header, body) {
+		results[peer] = resp.Err
+	}
+	return results
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPeersBroadcast(t *testing.T) {
+	var received int
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ping" && r.Header.Get("X-Test") == "yes" {
+			received++
+		}
+	}))
+	defer ok.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	peers := NewPeers([]string{ok.URL + "/", " " + failing.URL, ""}, http.DefaultClient)
+	if len(peers.URLs()) != 2 {
+		t.Fatalf("Expected 2 peers after cleanup, got %v", peers.URLs())
+	}
+
+	results := peers.Broadcast(context.Background(), "POST", "/ping", http.Header{"X-Test": {"yes"}}, nil)
+
+	if results[ok.URL] != nil {
+		t.Errorf("Expected success for healthy peer, got %v", results[ok.URL])
+	}
+	if results[failing.URL] == nil {
+		t.Error("Expected error for failing peer")
+	}
+	if received != 1 {
+		t.Errorf("Expected healthy peer to receive 1 request, got %d", received)
+	}
+}
+
+func TestNilPeersBroadcast(t *testing.T) {
+	var peers *Peers
+	if results := peers.Broadcast(context.Background(), "POST", "/ping", nil, nil); len(results) != 0 {
+		t.Errorf("Expected no results without peers, got %v", results)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// persistedClock is the on-disk representation of the clock
+type persistedClock struct {
+	ClockTime
+	SavedAt time.Time `json:"saved_at"`
+}
+
+// ClockStorage is where a ClockPersister keeps the clock
+type ClockStorage interface {
+	// Load returns the saved time, false when none was saved yet
+	Load() (ClockTime, bool, error)
+	// Save stores now and returns the stored time, which storage shared
+	// between servers may hold further ahead
+	Save(now ClockTime) (ClockTime, error)
+}
+
+// ClockPersister periodically writes the clock to disk so a restarted node
+// never issues timestamps below ones it already handed out
+type ClockPersister struct {
+	storage  ClockStorage
+	clock    *LamportClock
+	interval time.Duration
+	logger   *slog.Logger
+	last     ClockTime
+	mutex    sync.Mutex
+}
+
+// NewClockPersister creates a persister writing to path every interval
+func NewClockPersister(path string, clock *LamportClock, interval time.Duration, logger *slog.Logger) *ClockPersister {
+	return NewClockPersisterTo(clockFile(path), clock, interval, logger)
+}
+
+// NewClockPersisterTo creates a persister saving to storage every interval
+func NewClockPersisterTo(storage ClockStorage, clock *LamportClock, interval time.Duration, logger *slog.Logger) *ClockPersister {
+	return &ClockPersister{storage: storage, clock: clock, interval: interval, logger: logger}
+}
+
+// Restore resumes the clock from the persisted value plus safetyMargin,
+// covering ticks issued after the last save. Nothing saved yet leaves the
+// clock untouched.
+func (p *ClockPersister) Restore(safetyMargin int64) (ClockTime, error) {
+	saved, ok, err := p.storage.Load()
+	if err != nil {
+		return ClockTime{}, err
+	}
+	if !ok {
+		return p.clock.Now(), nil
+	}
+	if saved.Epoch < 0 || saved.Timestamp < 0 {
+		return ClockTime{}, errors.New("persisted clock holds a negative time")
+	}
+
+	resumed := p.clock.restore(saved, safetyMargin)
+
+	// Persist right away so a crash loop keeps moving forward
+	if err := p.Save(); err != nil {
+		return resumed, err
+	}
+	return p.clock.Now(), nil
+}
+
+// Save persists the current clock value. When the storage holds a later
+// time, saved by another server sharing it, the clock moves up to it.
+func (p *ClockPersister) Save() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := p.clock.Now()
+	if now == p.last {
+		return nil
+	}
+	stored, err := p.storage.Save(now)
+	if err != nil {
+		return err
+	}
+	if now.Before(stored) {
+		p.clock.restore(stored, 0)
+	}
+	p.last = now
+	return nil
+}
+
+// clockFile keeps the clock in a file of its own
+type clockFile string
+
+func (path clockFile) Load() (ClockTime, bool, error) {
+	data, err := os.ReadFile(string(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return ClockTime{}, false, nil
+	}
+	if err != nil {
+		return ClockTime{}, false, fmt.Errorf("reading clock file: %w", err)
+	}
+
+	var saved persistedClock
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return ClockTime{}, false, fmt.Errorf("decoding clock file: %w", err)
+	}
+	return saved.ClockTime, true, nil
+}
+
+// Save writes the clock value durably
+func (path clockFile) Save(now ClockTime) (ClockTime, error) {
+	data, err := json.Marshal(persistedClock{ClockTime: now, SavedAt: time.Now()})
+	if err != nil {
+		return ClockTime{}, err
+	}
+	if err := writeFileDurably(string(path), data); err != nil {
+		return ClockTime{}, fmt.Errorf("writing clock file: %w", err)
+	}
+	return now, nil
+}
+
+// writeFileDurably replaces a file with data: the data is written to a
+// temporary file, fsynced and atomically renamed over the previous file
+func writeFileDurably(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("creating temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("syncing: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replacing: %w", err)
+	}
+
+	// Make the rename itself durable
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// Run saves the clock every interval until ctx is cancelled, then saves a
+// final time
+func (p *ClockPersister) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := p.Save(); err != nil {
+				p.logger.Error("Failed to persist clock on shutdown", "error", err)
+			}
+			return
+		case <-ticker.C:
+			if err := p.Save(); err != nil {
+				p.logger.Error("Failed to persist clock", "error", err)
+			}
+		}
+	}
+}
+
+// restore moves the clock to saved advanced by margin, unless it is
+// already further ahead
+func (lc *LamportClock) restore(saved ClockTime, margin int64) ClockTime {
+	lc.mutex.Lock()
+	defer lc.mutex.Unlock()
+
+	resumed := saved.advance(margin, lc.rollover)
+	if from := lc.nowLocked(); from.Before(resumed) {
+		lc.epoch = resumed.Epoch
+		lc.timestamp = resumed.Timestamp
+		lc.changes.Notify()
+		lc.recordLocked(from, causeRestore, saved, false, ClockSource{})
+	}
+	return lc.nowLocked()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestClockPersistenceAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clock.json")
+
+	// First run: tick a few times and persist
+	clock := NewLamportClock()
+	persister := NewClockPersister(path, clock, time.Hour, slog.Default())
+	if _, err := persister.Restore(100); err != nil {
+		t.Fatalf("Restore without a file should succeed, got %v", err)
+	}
+	if clock.GetTime() != 0 {
+		t.Errorf("Expected fresh clock to start at 0, got %d", clock.GetTime())
+	}
+	clock.Update(41) // 42
+	if err := persister.Save(); err != nil {
+		t.Fatalf("Failed to save clock: %v", err)
+	}
+
+	// Ticks after the last save are lost on a crash...
+	clock.Tick()
+	clock.Tick()
+
+	// ...but the restarted node resumes beyond them
+	restarted := NewLamportClock()
+	resumed, err := NewClockPersister(path, restarted, time.Hour, slog.Default()).Restore(100)
+	if err != nil {
+		t.Fatalf("Failed to restore clock: %v", err)
+	}
+	if resumed.Timestamp != 142 || restarted.GetTime() != 142 {
+		t.Errorf("Expected clock to resume at 142, got %s", resumed)
+	}
+
+	// Restoring persists the resumed value straight away
+	data, _ := os.ReadFile(path)
+	var saved persistedClock
+	json.Unmarshal(data, &saved)
+	if saved.Timestamp != 142 {
+		t.Errorf("Expected resumed value to be persisted, file holds %d", saved.Timestamp)
+	}
+}
+
+func TestClockRestoreCarriesIntoNextEpoch(t *testing.T) {
+	clock := NewLamportClock()
+	clock.rollover = 100
+
+	resumed := clock.restore(ClockTime{Epoch: 0, Timestamp: 90}, 20)
+	if resumed != (ClockTime{Epoch: 1, Timestamp: 10}) {
+		t.Errorf("Expected restore to carry into epoch 1, got %s", resumed)
+	}
+
+	// A clock that is already ahead is never moved back
+	if got := clock.restore(ClockTime{Epoch: 0, Timestamp: 5}, 1); got != resumed {
+		t.Errorf("Expected restore not to move clock backwards, got %s", got)
+	}
+}
+
+func TestClockRestoreRejectsCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clock.json")
+	os.WriteFile(path, []byte("{garbage"), 0o600)
+
+	if _, err := NewClockPersister(path, NewLamportClock(), time.Hour, slog.Default()).Restore(10); err == nil {
+		t.Error("Expected corrupt clock file to be reported")
+	}
+}
+
+func TestClockPersisterRunSavesOnShutdown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clock.json")
+	clock := NewLamportClock()
+	persister := NewClockPersister(path, clock, time.Hour, slog.Default())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		persister.Run(ctx)
+		close(done)
+	}()
+
+	clock.Update(7)
+	cancel()
+	<-done
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected clock file after shutdown: %v", err)
+	}
+	var saved persistedClock
+	json.Unmarshal(data, &saved)
+	if saved.Timestamp != 8 {
+		t.Errorf("Expected final save of 8, got %d", saved.Timestamp)
+	}
+}
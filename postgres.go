@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+// postgresTimeout bounds every statement of the store
+const postgresTimeout = 5 * time.Second
+
+// Keys of the advisory locks the servers sharing a database take
+const (
+	pgMigrationLock int64 = 0x6c616d706f7274 // "lamport"
+	pgAppendLock    int64 = 0x6c616d706f7275
+)
+
+// PostgresStore keeps the event log in PostgreSQL, where several servers
+// share it. Appends are chained to the newest event of the shared log
+// under an advisory lock held across the servers, and the clock is saved
+// in the same database, only ever forward. The EventStore methods do not
+// return errors; failed statements are logged, and reads then return what
+// they have.
+type PostgresStore struct {
+	pool   *pgxpool.Pool
+	logger *slog.Logger
+}
+
+// OpenPostgresStore connects to the database at url, pooling connections
+// as its pool_max_conns and related parameters say, and applies the
+// migrations it lacks
+func OpenPostgresStore(ctx context.Context, url string, logger *slog.Logger) (*PostgresStore, error) {
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if err := migratePostgres(ctx, pool, logger); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return &PostgresStore{pool: pool, logger: logger}, nil
+}
+
+// Close releases the connections
+func (st *PostgresStore) Close() {
+	st.pool.Close()
+}
+
+// migratePostgres applies the embedded migrations in the order of their
+// names, each once, recording them in schema_migrations. Servers starting
+// together take turns through an advisory lock.
+func migratePostgres(ctx context.Context, pool *pgxpool.Pool, logger *slog.Logger) error {
+	names, err := fs.Glob(postgresMigrations, "migrations/postgres/*.sql")
+	if err != nil {
+		return err
+	}
+	slices.Sort(names)
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, pgMigrationLock); err != nil {
+		return err
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, pgMigrationLock)
+
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    TEXT        PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		version := path.Base(name)
+		var applied bool
+		err := conn.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, version).Scan(&applied)
+		if err != nil || applied {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		script, err := postgresMigrations.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, string(script)); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s: %w", version, err)
+		}
+		logger.Info("Database migrated", "version", version)
+	}
+	return nil
+}
+
+func (st *PostgresStore) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), postgresTimeout)
+}
+
+// insertPostgresEvent stores an event after the last one
+func insertPostgresEvent(ctx context.Context, db pgx.Tx, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(ctx, `INSERT INTO events (id, epoch, lamport_timestamp, wall_time, node, type, message, sender, hash, data)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		e.ID, e.Epoch, e.Timestamp, e.WallTime, e.Node, e.Type, e.Message, e.Sender, e.Hash, data)
+	return err
+}
+
+func (st *PostgresStore) Append(event Event) {
+	ctx, cancel := st.context()
+	defer cancel()
+	err := pgx.BeginFunc(ctx, st.pool, func(tx pgx.Tx) error {
+		return insertPostgresEvent(ctx, tx, event)
+	})
+	if err != nil {
+		st.logger.Error("Failed to store event", "event_id", event.ID, "error", err)
+	}
+}
+
+// events decodes the events a query selects by their data column
+func (st *PostgresStore) events(query string, args ...any) []Event {
+	ctx, cancel := st.context()
+	defer cancel()
+	rows, err := st.pool.Query(ctx, query, args...)
+	if err != nil {
+		st.logger.Error("Failed to read events", "error", err)
+		return nil
+	}
+	events, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Event, error) {
+		var data []byte
+		var e Event
+		if err := row.Scan(&data); err != nil {
+			return e, err
+		}
+		return e, json.Unmarshal(data, &e)
+	})
+	if err != nil {
+		st.logger.Error("Failed to read events", "error", err)
+	}
+	return events
+}
+
+func (st *PostgresStore) Events() []Event {
+	events := st.events(`SELECT data FROM events ORDER BY seq`)
+	if events == nil {
+		events = []Event{}
+	}
+	return events
+}
+
+func (st *PostgresStore) Len() int {
+	ctx, cancel := st.context()
+	defer cancel()
+	var n int
+	if err := st.pool.QueryRow(ctx, `SELECT COUNT(*) FROM events`).Scan(&n); err != nil {
+		st.logger.Error("Failed to count events", "error", err)
+	}
+	return n
+}
+
+// Replace swaps the table's rows in one transaction, holding off the
+// appends of the other servers
+func (st *PostgresStore) Replace(events []Event) {
+	ctx, cancel := st.context()
+	defer cancel()
+	err := pgx.BeginFunc(ctx, st.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, pgAppendLock); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM events`); err != nil {
+			return err
+		}
+		for _, e := range events {
+			if err := insertPostgresEvent(ctx, tx, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		st.logger.Error("Failed to replace events", "error", err)
+	}
+}
+
+func (st *PostgresStore) Dropped() int64 {
+	ctx, cancel := st.context()
+	defer cancel()
+	var n int64
+	err := st.pool.QueryRow(ctx, `SELECT value FROM store_state WHERE key = 'dropped'`).Scan(&n)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		st.logger.Error("Failed to read dropped count", "error", err)
+	}
+	return n
+}
+
+func (st *PostgresStore) Trim(n int) []Event {
+	ctx, cancel := st.context()
+	defer cancel()
+	var trimmed []Event
+	err := pgx.BeginFunc(ctx, st.pool, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `DELETE FROM events WHERE seq IN (SELECT seq FROM events ORDER BY seq LIMIT $1) RETURNING seq, data`, max(n, 0))
+		if err != nil {
+			return err
+		}
+		type trimmedRow struct {
+			seq   int64
+			event Event
+		}
+		deleted, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (trimmedRow, error) {
+			var r trimmedRow
+			var data []byte
+			if err := row.Scan(&r.seq, &data); err != nil {
+				return r, err
+			}
+			return r, json.Unmarshal(data, &r.event)
+		})
+		if err != nil {
+			return err
+		}
+		slices.SortFunc(deleted, func(a, b trimmedRow) int { return int(a.seq - b.seq) })
+		for _, r := range deleted {
+			trimmed = append(trimmed, r.event)
+		}
+		_, err = tx.Exec(ctx, `INSERT INTO store_state (key, value) VALUES ('dropped', $1)
+			ON CONFLICT (key) DO UPDATE SET value = store_state.value + excluded.value`, len(trimmed))
+		return err
+	})
+	if err != nil {
+		st.logger.Error("Failed to trim events", "error", err)
+		return nil
+	}
+	return trimmed
+}
+
+// Between uses the index on epoch, timestamp and position
+func (st *PostgresStore) Between(from, to ClockTime) []Event {
+	return st.events(`SELECT data FROM events
+		WHERE (epoch, lamport_timestamp) >= ($1, $2) AND (epoch, lamport_timestamp) <= ($3, $4)
+		ORDER BY epoch, lamport_timestamp, seq`,
+		from.Epoch, from.Timestamp, to.Epoch, to.Timestamp)
+}
+
+func (st *PostgresStore) Find(id string) (Event, bool) {
+	events := st.events(`SELECT data FROM events WHERE id = $1 ORDER BY seq LIMIT 1`, id)
+	if len(events) == 0 {
+		return Event{}, false
+	}
+	return events[0], true
+}
+
+// Search scans the messages; strpos, unlike LIKE, needs no escaping
+func (st *PostgresStore) Search(text string) []Event {
+	return st.events(`SELECT data FROM events WHERE strpos(message, $1) > 0 ORDER BY seq`, text)
+}
+
+// lockHead takes the append lock of the shared log and returns the hash
+// of its newest event, which the next event links to. unlock releases the
+// lock once the event is appended.
+func (st *PostgresStore) lockHead() (head string, unlock func(), err error) {
+	ctx, cancel := st.context()
+	defer cancel()
+	conn, err := st.pool.Acquire(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, pgAppendLock); err != nil {
+		conn.Release()
+		return "", nil, err
+	}
+	unlock = func() {
+		ctx, cancel := st.context()
+		defer cancel()
+		if _, err := conn.Exec(ctx, `SELECT pg_advisory_unlock($1)`, pgAppendLock); err != nil {
+			// A session lock that could not be released dies with its connection
+			conn.Conn().Close(ctx)
+		}
+		conn.Release()
+	}
+	err = conn.QueryRow(ctx, `SELECT hash FROM events ORDER BY seq DESC LIMIT 1`).Scan(&head)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		unlock()
+		return "", nil, err
+	}
+	return head, unlock, nil
+}
+
+// Load and Save keep the clock in the database for a ClockPersister. Save
+// only moves the stored clock forward, so servers sharing it never lower
+// it, and returns the latest time saved by any of them.
+func (st *PostgresStore) Load() (ClockTime, bool, error) {
+	ctx, cancel := st.context()
+	defer cancel()
+	var t ClockTime
+	err := st.pool.QueryRow(ctx, `SELECT epoch, lamport_timestamp FROM clock`).Scan(&t.Epoch, &t.Timestamp)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ClockTime{}, false, nil
+	}
+	return t, err == nil, err
+}
+
+func (st *PostgresStore) Save(now ClockTime) (ClockTime, error) {
+	ctx, cancel := st.context()
+	defer cancel()
+	var stored ClockTime
+	err := st.pool.QueryRow(ctx, `INSERT INTO clock (epoch, lamport_timestamp, saved_at) VALUES ($1, $2, now())
+		ON CONFLICT (id) DO UPDATE SET epoch = excluded.epoch, lamport_timestamp = excluded.lamport_timestamp, saved_at = excluded.saved_at
+			WHERE (clock.epoch, clock.lamport_timestamp) < (excluded.epoch, excluded.lamport_timestamp)
+		RETURNING epoch, lamport_timestamp`, now.Epoch, now.Timestamp).Scan(&stored.Epoch, &stored.Timestamp)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// The stored clock is ahead, so the row was left alone
+		err = st.pool.QueryRow(ctx, `SELECT epoch, lamport_timestamp FROM clock`).Scan(&stored.Epoch, &stored.Timestamp)
+	}
+	return stored, err
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"testing"
+)
+
+// openTestPostgresStore connects to the database named by
+// LAMPORT_TEST_POSTGRES, emptied for the test, and skips without one
+func openTestPostgresStore(t *testing.T) *PostgresStore {
+	t.Helper()
+	url := os.Getenv("LAMPORT_TEST_POSTGRES")
+	if url == "" {
+		t.Skip("LAMPORT_TEST_POSTGRES is not set")
+	}
+	st, err := OpenPostgresStore(t.Context(), url, slog.Default())
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	t.Cleanup(st.Close)
+	if _, err := st.pool.Exec(t.Context(), `TRUNCATE events, store_state, clock`); err != nil {
+		t.Fatalf("Failed to empty the database: %v", err)
+	}
+	return st
+}
+
+func TestPostgresMigrations(t *testing.T) {
+	names, err := fs.Glob(postgresMigrations, "migrations/postgres/*.sql")
+	if err != nil || len(names) < 2 {
+		t.Fatalf("Expected the migrations embedded, got %v %v", names, err)
+	}
+	for i, name := range names {
+		if want := fmt.Sprintf("migrations/postgres/%04d_", i+1); name[:len(want)] != want {
+			t.Errorf("Expected %s to be numbered %04d", name, i+1)
+		}
+	}
+}
+
+func TestPostgresStore(t *testing.T) {
+	st := openTestPostgresStore(t)
+	for i := 1; i <= 5; i++ {
+		st.Append(Event{ID: fmt.Sprintf("e%d", i), Timestamp: int64(6 - i), Message: fmt.Sprintf("Event %d", i)})
+	}
+	st.Append(Event{ID: "e6", Epoch: 1, Timestamp: 1, Message: "event"})
+
+	if events := st.Events(); len(events) != 6 || events[0].ID != "e1" || events[5].ID != "e6" || st.Len() != 6 {
+		t.Errorf("Expected e1 to e6 in log order, got %v", eventIDs(events))
+	}
+	between := st.Between(ClockTime{Timestamp: 2}, ClockTime{Epoch: 1, Timestamp: 0})
+	if got := fmt.Sprint(eventIDs(between)); got != "[e4 e3 e2 e1]" {
+		t.Errorf("Expected e4 to e1 by time, got %s", got)
+	}
+	if e, ok := st.Find("e3"); !ok || e.Timestamp != 3 {
+		t.Errorf("Expected to find e3, got %+v", e)
+	}
+	if found := st.Search("Event"); len(found) != 5 {
+		t.Errorf("Expected a case sensitive search, got %v", eventIDs(found))
+	}
+	if trimmed := st.Trim(2); len(trimmed) != 2 || trimmed[1].ID != "e2" || st.Dropped() != 2 || st.Len() != 4 {
+		t.Errorf("Expected e1 and e2 trimmed, got %v with %d dropped", eventIDs(trimmed), st.Dropped())
+	}
+	st.Replace([]Event{{ID: "a"}, {ID: "b"}})
+	if got := fmt.Sprint(eventIDs(st.Events())); got != "[a b]" {
+		t.Errorf("Expected the log replaced, got %s", got)
+	}
+}
+
+func TestPostgresStoreSharedLog(t *testing.T) {
+	st := openTestPostgresStore(t)
+	a, b := NewServer(), NewServer()
+	a.events, b.events = st, st
+	a.logEvent("e1", "One")
+	b.logEvent("e2", "Two")
+	a.logEvent("e3", "Three")
+	if verified := verifyLog(t, b); verified["valid"] != true || verified["event_count"] != float64(3) {
+		t.Errorf("Expected one chain across both servers, got %v", verified)
+	}
+}
+
+func TestPostgresStoreClock(t *testing.T) {
+	st := openTestPostgresStore(t)
+	if _, ok, err := st.Load(); ok || err != nil {
+		t.Fatalf("Expected no clock saved yet, got %v %v", ok, err)
+	}
+	if stored, err := st.Save(ClockTime{Timestamp: 10}); err != nil || stored.Timestamp != 10 {
+		t.Errorf("Expected 10 stored, got %v %v", stored, err)
+	}
+	if stored, err := st.Save(ClockTime{Timestamp: 4}); err != nil || stored.Timestamp != 10 {
+		t.Errorf("Expected the clock kept at 10, got %v %v", stored, err)
+	}
+
+	clock := NewLamportClock()
+	persister := NewClockPersisterTo(st, clock, 0, slog.Default())
+	if err := persister.Save(); err != nil || clock.GetTime() != 10 {
+		t.Errorf("Expected the clock moved up to 10, got %d %v", clock.GetTime(), err)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProfiling(t *testing.T) {
+	server := NewServer()
+	server.adminToken = "admin-token"
+	server.registerProfiling()
+
+	get := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := get("/debug/pprof/", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected profiles refused without the admin token, got %d", rec.Code)
+	}
+	if rec := get("/debug/pprof/", "admin-token"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "goroutine") {
+		t.Errorf("Expected the profile index, got %d", rec.Code)
+	}
+	if rec := get("/debug/pprof/heap?debug=1", "admin-token"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "heap profile") {
+		t.Errorf("Expected the heap profile, got %d", rec.Code)
+	}
+	if rec := get("/debug/pprof/trace?seconds=0.05", "admin-token"); rec.Code != http.StatusOK || rec.Body.Len() == 0 {
+		t.Errorf("Expected an execution trace, got %d", rec.Code)
+	}
+}
+
+func TestProfilingRequiresAdminAuth(t *testing.T) {
+	if _, err := parseConfig([]string{"-pprof"}); err == nil {
+		t.Error("Expected -pprof refused without admin authentication")
+	}
+	if _, err := parseConfig([]string{"-pprof", "-admin-token", "secret"}); err != nil {
+		t.Errorf("Expected -pprof accepted with an admin token, got %v", err)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxPropagationPeers bounds the peers delays are kept for, since the
+// sender of a request names itself
+const maxPropagationPeers = 1024
+
+// Upper bounds of the propagation histogram buckets, in milliseconds and in
+// ticks. The last bucket is unbounded.
+var (
+	propagationWallBounds = []float64{1, 5, 10, 50, 100, 500, 1000, 5000}
+	propagationTickBounds = []float64{1, 10, 100, 1000, 10000}
+)
+
+// peerPropagation sums up the delays of the messages from one peer
+type peerPropagation struct {
+	messages     int
+	last         time.Time
+	msSum        float64
+	msMin, msMax float64
+	ms           []int
+	ticksSum     float64
+	ticksMin     int64
+	ticksMax     int64
+	ticks        []int
+}
+
+// PropagationTracker records per peer how long messages took to arrive,
+// in wall time, and how far the clock of the receiver stood ahead of the
+// sender's when they did. A nil tracker records nothing.
+type PropagationTracker struct {
+	peers map[string]*peerPropagation
+	mutex sync.Mutex
+}
+
+// NewPropagationTracker creates an empty tracker
+func NewPropagationTracker() *PropagationTracker {
+	return &PropagationTracker{peers: make(map[string]*peerPropagation)}
+}
+
+func (pt *PropagationTracker) record(peer string, wall time.Duration, ticks int64, at time.Time) {
+	if pt == nil {
+		return
+	}
+	ms := float64(wall) / float64(time.Millisecond)
+	pt.mutex.Lock()
+	defer pt.mutex.Unlock()
+	p, ok := pt.peers[peer]
+	if !ok {
+		if len(pt.peers) >= maxPropagationPeers {
+			return
+		}
+		p = &peerPropagation{
+			msMin: ms, msMax: ms, ms: make([]int, len(propagationWallBounds)+1),
+			ticksMin: ticks, ticksMax: ticks, ticks: make([]int, len(propagationTickBounds)+1),
+		}
+		pt.peers[peer] = p
+	}
+	p.messages++
+	p.last = at
+	p.msSum += ms
+	p.msMin, p.msMax = min(p.msMin, ms), max(p.msMax, ms)
+	p.ms[propagationBucket(ms, propagationWallBounds)]++
+	p.ticksSum += float64(ticks)
+	p.ticksMin, p.ticksMax = min(p.ticksMin, ticks), max(p.ticksMax, ticks)
+	p.ticks[propagationBucket(float64(ticks), propagationTickBounds)]++
+}
+
+// propagationBucket returns the bucket of v: the first whose bound is above
+// it, so negative delays fall in the first
+func propagationBucket(v float64, bounds []float64) int {
+	bucket := 0
+	for bucket < len(bounds) && v >= bounds[bucket] {
+		bucket++
+	}
+	return bucket
+}
+
+// PropagationBucket counts the messages whose delay was at least Min and
+// below Max, unbounded when Max is zero. The first bucket holds negative
+// delays too.
+type PropagationBucket struct {
+	Min      float64 `json:"min"`
+	Max      float64 `json:"max,omitempty"`
+	Messages int     `json:"messages"`
+}
+
+// PeerPropagation sums up the messages received from a peer. The wall
+// delay, in milliseconds, includes the offset between the wall clocks of
+// both nodes, so it can be negative. The logical delay, in ticks, is how
+// far the clock of this node stood ahead of the sender's when a message
+// arrived: a peer lagging behind the cluster sends timestamps long passed.
+// It is negative for peers ahead of this node.
+type PeerPropagation struct {
+	Peer          string              `json:"peer"`
+	Messages      int                 `json:"messages"`
+	Last          time.Time           `json:"last"`
+	AvgMillisec   float64             `json:"avg_ms"`
+	MinMillisec   float64             `json:"min_ms"`
+	MaxMillisec   float64             `json:"max_ms"`
+	WallHistogram []PropagationBucket `json:"wall_histogram"`
+	AvgTicks      float64             `json:"avg_ticks"`
+	MinTicks      int64               `json:"min_ticks"`
+	MaxTicks      int64               `json:"max_ticks"`
+	TickHistogram []PropagationBucket `json:"tick_histogram"`
+}
+
+// Report sums up the delays of every peer, by name
+func (pt *PropagationTracker) Report() []PeerPropagation {
+	if pt == nil {
+		return []PeerPropagation{}
+	}
+	pt.mutex.Lock()
+	defer pt.mutex.Unlock()
+	reports := make([]PeerPropagation, 0, len(pt.peers))
+	for peer, p := range pt.peers {
+		reports = append(reports, PeerPropagation{
+			Peer:          peer,
+			Messages:      p.messages,
+			Last:          p.last,
+			AvgMillisec:   p.msSum / float64(p.messages),
+			MinMillisec:   p.msMin,
+			MaxMillisec:   p.msMax,
+			WallHistogram: propagationHistogram(p.ms, propagationWallBounds),
+			AvgTicks:      p.ticksSum / float64(p.messages),
+			MinTicks:      p.ticksMin,
+			MaxTicks:      p.ticksMax,
+			TickHistogram: propagationHistogram(p.ticks, propagationTickBounds),
+		})
+	}
+	slices.SortFunc(reports, func(a, b PeerPropagation) int { return strings.Compare(a.Peer, b.Peer) })
+	return reports
+}
+
+func propagationHistogram(counts []int, bounds []float64) []PropagationBucket {
+	buckets := make([]PropagationBucket, len(counts))
+	for i, n := range counts {
+		buckets[i].Messages = n
+		if i > 0 {
+			buckets[i].Min = bounds[i-1]
+		}
+		if i < len(bounds) {
+			buckets[i].Max = bounds[i]
+		}
+	}
+	return buckets
+}
+
+// logicalLag is how many ticks local is ahead of sent, negative when it is
+// behind. Times more than an epoch apart count as the largest lag.
+func logicalLag(sent, local ClockTime, rollover int64) int64 {
+	if local.Compare(sent) >= 0 {
+		if d, ok := sent.distance(local, rollover); ok || local == sent {
+			return d
+		}
+		return math.MaxInt64
+	}
+	if d, ok := local.distance(sent, rollover); ok {
+		return -d
+	}
+	return math.MinInt64
+}
+
+// parseClockTime reads a time written as ClockTime.String does
+func parseClockTime(v string) (ClockTime, error) {
+	var t ClockTime
+	var err error
+	epoch, timestamp, ok := strings.Cut(v, ":")
+	if !ok {
+		timestamp = epoch
+	} else if t.Epoch, err = strconv.ParseInt(epoch, 10, 64); err != nil || t.Epoch < 0 {
+		return ClockTime{}, fmt.Errorf("invalid epoch in %q", v)
+	}
+	if t.Timestamp, err = strconv.ParseInt(timestamp, 10, 64); err != nil || t.Timestamp < 0 {
+		return ClockTime{}, fmt.Errorf("invalid timestamp in %q", v)
+	}
+	return t, nil
+}
+
+// withPropagation records the delay of requests from peers stamped with
+// the wall and Lamport time they were sent at, before their timestamps
+// move the clock. Malformed stamps are ignored: they only feed analytics.
+func (s *Server) withPropagation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer, sentAt, sentTime := r.Header.Get(headerSender), r.Header.Get(headerSentAt), r.Header.Get(headerSentTime)
+		if peer != "" && sentAt != "" && sentTime != "" {
+			arrived := time.Now()
+			wall, err := time.Parse(time.RFC3339Nano, sentAt)
+			sent, errTime := parseClockTime(sentTime)
+			if err == nil && errTime == nil {
+				s.propagation.record(peer, arrived.Sub(wall), logicalLag(sent, s.clock.Now(), s.clock.rollover), arrived)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handlePropagation reports the delays of the messages received from each
+// peer, or only from the peer given by the peer parameter
+func (s *Server) handlePropagation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	peers := s.propagation.Report()
+	if peer := r.URL.Query().Get("peer"); peer != "" {
+		peers = slices.DeleteFunc(peers, func(p PeerPropagation) bool { return p.Peer != peer })
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"peers": peers,
+		"count": len(peers),
+	})
+}
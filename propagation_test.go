@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPropagationTracker(t *testing.T) {
+	pt := NewPropagationTracker()
+	now := time.Now()
+	pt.record("b", 2*time.Millisecond, 3, now)
+	pt.record("b", 8*time.Millisecond, -1, now)
+	pt.record("b", 2*time.Second, 150, now.Add(time.Second))
+	pt.record("a", -time.Millisecond, 0, now)
+
+	report := pt.Report()
+	if len(report) != 2 || report[0].Peer != "a" || report[1].Peer != "b" {
+		t.Fatalf("Expected peers a and b, got %+v", report)
+	}
+	b := report[1]
+	if b.Messages != 3 || !b.Last.Equal(now.Add(time.Second)) || b.AvgMillisec != 670 || b.MinMillisec != 2 || b.MaxMillisec != 2000 {
+		t.Errorf("Unexpected wall delay of b: %+v", b)
+	}
+	if b.AvgTicks != 152.0/3 || b.MinTicks != -1 || b.MaxTicks != 150 {
+		t.Errorf("Unexpected logical delay of b: %+v", b)
+	}
+
+	wall := []int{0, 1, 1, 0, 0, 0, 0, 1, 0}
+	if len(b.WallHistogram) != len(wall) || b.WallHistogram[0].Max != 1 || b.WallHistogram[8].Min != 5000 || b.WallHistogram[8].Max != 0 {
+		t.Fatalf("Unexpected wall buckets: %+v", b.WallHistogram)
+	}
+	for i, n := range wall {
+		if b.WallHistogram[i].Messages != n {
+			t.Errorf("Expected %d messages in wall bucket %d, got %+v", n, i, b.WallHistogram[i])
+		}
+	}
+	ticks := []int{1, 1, 0, 1, 0, 0}
+	for i, n := range ticks {
+		if b.TickHistogram[i].Messages != n {
+			t.Errorf("Expected %d messages in tick bucket %d, got %+v", n, i, b.TickHistogram[i])
+		}
+	}
+	if a := report[0]; a.WallHistogram[0].Messages != 1 || a.MinMillisec != -1 {
+		t.Errorf("Expected a negative delay in the first bucket, got %+v", a)
+	}
+
+	for i := range maxPropagationPeers {
+		pt.record(fmt.Sprintf("peer-%d", i), time.Millisecond, 1, now)
+	}
+	if n := len(pt.Report()); n != maxPropagationPeers {
+		t.Errorf("Expected %d peers tracked at most, got %d", maxPropagationPeers, n)
+	}
+	var none *PropagationTracker
+	none.record("a", time.Millisecond, 1, now)
+	if len(none.Report()) != 0 {
+		t.Error("Expected a nil tracker to report nothing")
+	}
+}
+
+func TestLogicalLag(t *testing.T) {
+	for _, tc := range []struct {
+		sent, local ClockTime
+		want        int64
+	}{
+		{ClockTime{Timestamp: 5}, ClockTime{Timestamp: 20}, 15},
+		{ClockTime{Timestamp: 20}, ClockTime{Timestamp: 5}, -15},
+		{ClockTime{Timestamp: 7}, ClockTime{Timestamp: 7}, 0},
+		{ClockTime{Timestamp: 90}, ClockTime{Epoch: 1, Timestamp: 5}, 15},
+		{ClockTime{Epoch: 1, Timestamp: 5}, ClockTime{Timestamp: 90}, -15},
+		{ClockTime{Timestamp: 5}, ClockTime{Epoch: 3, Timestamp: 5}, math.MaxInt64},
+		{ClockTime{Epoch: 3, Timestamp: 5}, ClockTime{Timestamp: 5}, math.MinInt64},
+	} {
+		if got := logicalLag(tc.sent, tc.local, 100); got != tc.want {
+			t.Errorf("Expected %s received at %s to lag %d, got %d", tc.sent, tc.local, tc.want, got)
+		}
+	}
+}
+
+func TestParseClockTime(t *testing.T) {
+	for _, v := range []ClockTime{{Timestamp: 12}, {Epoch: 3, Timestamp: 4}} {
+		if got, err := parseClockTime(v.String()); err != nil || got != v {
+			t.Errorf("Expected %s parsed back, got %s (err: %v)", v, got, err)
+		}
+	}
+	for _, v := range []string{"", "x", "-1", "1:", ":1", "-1:2"} {
+		if _, err := parseClockTime(v); err == nil {
+			t.Errorf("Expected %q to be refused", v)
+		}
+	}
+}
+
+func TestPropagationBetweenPeers(t *testing.T) {
+	receiver := NewServer()
+	receiver.clock.Update(19) // 20
+	peer := httptest.NewServer(receiver)
+	defer peer.Close()
+
+	sender := NewServer()
+	sender.clock.Update(4) // 5
+	sender.peers = NewPeers([]string{peer.URL}, http.DefaultClient)
+	sender.peers.node = "a"
+	sender.peers.clock = sender.clock.Now
+	if _, err := sender.peers.Do(t.Context(), peer.URL, http.MethodGet, "/time", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Requests missing a stamp or with a malformed one are not recorded
+	for _, header := range []http.Header{
+		{headerSender: {"c"}, headerSentTime: {"5"}},
+		{headerSender: {"c"}, headerSentAt: {"yesterday"}, headerSentTime: {"5"}},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/time", nil)
+		req.Header = header
+		receiver.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	w := httptest.NewRecorder()
+	receiver.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/analytics/propagation", nil))
+	var response struct {
+		Count int               `json:"count"`
+		Peers []PeerPropagation `json:"peers"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	if w.Code != http.StatusOK || response.Count != 1 {
+		t.Fatalf("Expected the sender a alone, got %d %+v", w.Code, response)
+	}
+	if a := response.Peers[0]; a.Peer != "a" || a.Messages != 1 || a.AvgTicks != 15 || a.MinMillisec < 0 {
+		t.Errorf("Expected a message from a lagging 15 ticks, got %+v", a)
+	}
+
+	w = httptest.NewRecorder()
+	receiver.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/analytics/propagation?peer=b", nil))
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.Count != 0 || len(response.Peers) != 0 {
+		t.Errorf("Expected no messages from b, got %+v", response)
+	}
+
+	w = httptest.NewRecorder()
+	receiver.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/analytics/propagation", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", w.Code)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxPendingMessages bounds the hold-back buffer of the causal queue
+const maxPendingMessages = 10000
+
+var (
+	// ErrStaleMessage is returned for messages older than what was already
+	// delivered from the same sender
+	ErrStaleMessage = errors.New("message is older than already delivered ones")
+	// ErrQueueFull is returned when the hold-back buffer is full
+	ErrQueueFull = errors.New("causal queue is full")
+)
+
+// QueuedMessage is a message waiting for causal delivery. Prev is the
+// timestamp of the sender's previous message (0 for its first one): the
+// message only becomes deliverable once that predecessor was delivered.
+type QueuedMessage struct {
+	Sender     string    `json:"sender"`
+	Timestamp  int64     `json:"timestamp"`
+	Prev       int64     `json:"prev"`
+	Message    string    `json:"message"`
+	ReceivedAt time.Time `json:"received_at"`
+	RequestID  string    `json:"request_id,omitempty"`
+}
+
+// CausalQueue buffers messages that arrive before their causal predecessors
+// and releases them in order, per sender
+type CausalQueue struct {
+	delivered map[string]int64                   // last delivered timestamp per sender
+	pending   map[string]map[int64]QueuedMessage // per sender, keyed by Prev
+	size      int
+	mutex     sync.Mutex
+}
+
+// NewCausalQueue creates an empty queue
+func NewCausalQueue() *CausalQueue {
+	return &CausalQueue{
+		delivered: make(map[string]int64),
+		pending:   make(map[string]map[int64]QueuedMessage),
+	}
+}
+
+// Offer hands a message to the queue. Every message that became deliverable
+// is passed to deliver, in causal order, before Offer returns; deliver runs
+// with the queue locked so concurrent offers cannot reorder deliveries.
+// It reports how many messages were delivered.
+func (q *CausalQueue) Offer(m QueuedMessage, deliver func(QueuedMessage) error) (int, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	last := q.delivered[m.Sender]
+	if m.Timestamp <= last {
+		return 0, ErrStaleMessage
+	}
+
+	if m.Prev != last {
+		byPrev := q.pending[m.Sender]
+		if byPrev == nil {
+			byPrev = make(map[int64]QueuedMessage)
+			q.pending[m.Sender] = byPrev
+		}
+		if _, exists := byPrev[m.Prev]; !exists {
+			if q.size >= maxPendingMessages {
+				return 0, ErrQueueFull
+			}
+			q.size++
+		}
+		byPrev[m.Prev] = m
+		return 0, nil
+	}
+
+	delivered := 0
+	for {
+		if err := deliver(m); err != nil {
+			return delivered, err
+		}
+		delivered++
+		q.delivered[m.Sender] = m.Timestamp
+
+		next, ok := q.pending[m.Sender][m.Timestamp]
+		if !ok {
+			break
+		}
+		delete(q.pending[m.Sender], m.Timestamp)
+		q.size--
+		m = next
+	}
+	if len(q.pending[m.Sender]) == 0 {
+		delete(q.pending, m.Sender)
+	}
+	return delivered, nil
+}
+
+// Pending returns the buffered messages ordered by sender and timestamp
+func (q *CausalQueue) Pending() []QueuedMessage {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	pending := make([]QueuedMessage, 0, q.size)
+	for _, byPrev := range q.pending {
+		for _, m := range byPrev {
+			pending = append(pending, m)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		if pending[i].Sender != pending[j].Sender {
+			return pending[i].Sender < pending[j].Sender
+		}
+		return pending[i].Timestamp < pending[j].Timestamp
+	})
+	return pending
+}
+
+// Delivered returns the last delivered timestamp of a sender
+func (q *CausalQueue) Delivered(sender string) int64 {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.delivered[sender]
+}
+
+func (s *Server) handleQueueMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	sender := query.Get("sender")
+	message := query.Get("message")
+	if sender == "" || message == "" || query.Get("timestamp") == "" {
+		http.Error(w, "Missing sender, timestamp or message parameter", http.StatusBadRequest)
+		return
+	}
+
+	timestamp, err := strconv.ParseInt(query.Get("timestamp"), 10, 64)
+	if err != nil || timestamp <= 0 {
+		http.Error(w, "Invalid timestamp", http.StatusBadRequest)
+		return
+	}
+	var prev int64
+	if prevStr := query.Get("prev"); prevStr != "" {
+		if prev, err = strconv.ParseInt(prevStr, 10, 64); err != nil || prev < 0 || prev >= timestamp {
+			http.Error(w, "Invalid prev", http.StatusBadRequest)
+			return
+		}
+	}
+
+	queued := QueuedMessage{
+		Sender:     sender,
+		Timestamp:  timestamp,
+		Prev:       prev,
+		Message:    message,
+		ReceivedAt: time.Now(),
+		RequestID:  requestIDFrom(r.Context()),
+	}
+
+	var events []Event
+	_, err = s.queue.Offer(queued, func(m QueuedMessage) error {
+		received := ClockTime{Epoch: s.clock.Now().Epoch, Timestamp: m.Timestamp}
+		// Buffered messages keep the ID of the request that sent them
+		ctx := contextWithRequestID(r.Context(), m.RequestID)
+		event, err := s.receiveMessage(ctx, m.Sender, "", received, m.Message)
+		if err != nil {
+			return err
+		}
+		events = append(events, event)
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, ErrStaleMessage):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, ErrQueueFull):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	case errors.Is(err, ErrJumpTooLarge) && len(events) == 0:
+		http.Error(w, "Timestamp jump exceeds max_jump", http.StatusUnprocessableEntity)
+		return
+	case err != nil && len(events) == 0:
+		s.writeCommitError(w, err)
+		return
+	}
+
+	status := "delivered"
+	code := http.StatusOK
+	if len(events) == 0 {
+		status = "buffered"
+		code = http.StatusAccepted
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    status,
+		"delivered": events,
+	})
+}
+
+func (s *Server) handleQueuePending(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pending := s.queue.Pending()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"pending":       pending,
+		"pending_count": len(pending),
+	})
+}
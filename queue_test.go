@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCausalQueueReordersPerSender(t *testing.T) {
+	q := NewCausalQueue()
+	var order []int64
+	deliver := func(m QueuedMessage) error {
+		order = append(order, m.Timestamp)
+		return nil
+	}
+
+	// Third and second message arrive before the first
+	if n, _ := q.Offer(QueuedMessage{Sender: "a", Timestamp: 9, Prev: 4}, deliver); n != 0 {
+		t.Errorf("Expected message with missing predecessor to be buffered, delivered %d", n)
+	}
+	q.Offer(QueuedMessage{Sender: "a", Timestamp: 4, Prev: 2}, deliver)
+
+	// Other senders are independent
+	if n, _ := q.Offer(QueuedMessage{Sender: "b", Timestamp: 1}, deliver); n != 1 {
+		t.Errorf("Expected first message of b to be delivered, delivered %d", n)
+	}
+
+	if len(q.Pending()) != 2 {
+		t.Errorf("Expected 2 pending messages, got %d", len(q.Pending()))
+	}
+
+	n, err := q.Offer(QueuedMessage{Sender: "a", Timestamp: 2}, deliver)
+	if err != nil || n != 3 {
+		t.Errorf("Expected first message to release the whole chain, delivered %d (err: %v)", n, err)
+	}
+
+	expected := []int64{1, 2, 4, 9}
+	for i, ts := range expected {
+		if i >= len(order) || order[i] != ts {
+			t.Fatalf("Expected delivery order %v, got %v", expected, order)
+		}
+	}
+	if len(q.Pending()) != 0 {
+		t.Errorf("Expected no pending messages, got %d", len(q.Pending()))
+	}
+
+	// Anything at or below the delivered point is stale
+	if _, err := q.Offer(QueuedMessage{Sender: "a", Timestamp: 4, Prev: 2}, deliver); err != ErrStaleMessage {
+		t.Errorf("Expected ErrStaleMessage, got %v", err)
+	}
+}
+
+func TestQueueHandlers(t *testing.T) {
+	server := NewServer()
+
+	post := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/queue?"+query, nil)
+		w := httptest.NewRecorder()
+		server.handleQueueMessage(w, req)
+		return w
+	}
+
+	w := post("sender=p1&timestamp=8&prev=5&message=second")
+	if w.Code != http.StatusAccepted {
+		t.Errorf("Expected status Accepted for buffered message, got %d", w.Code)
+	}
+	if server.events.Len() != 0 {
+		t.Errorf("Expected buffered message not to be logged yet, got %d events", server.events.Len())
+	}
+
+	req := httptest.NewRequest("GET", "/queue/pending", nil)
+	pw := httptest.NewRecorder()
+	server.handleQueuePending(pw, req)
+	var pending struct {
+		Pending []QueuedMessage `json:"pending"`
+		Count   int             `json:"pending_count"`
+	}
+	json.NewDecoder(pw.Body).Decode(&pending)
+	if pending.Count != 1 || pending.Pending[0].Timestamp != 8 {
+		t.Errorf("Expected the buffered message to be listed, got %+v", pending)
+	}
+
+	w = post("sender=p1&timestamp=5&message=first")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d", w.Code)
+	}
+	var result struct {
+		Status    string  `json:"status"`
+		Delivered []Event `json:"delivered"`
+	}
+	json.NewDecoder(w.Body).Decode(&result)
+	if result.Status != "delivered" || len(result.Delivered) != 2 {
+		t.Fatalf("Expected 2 delivered events, got %+v", result)
+	}
+	if result.Delivered[0].Timestamp != 6 || result.Delivered[1].Timestamp != 9 {
+		t.Errorf("Expected timestamps 6 and 9, got %d and %d",
+			result.Delivered[0].Timestamp, result.Delivered[1].Timestamp)
+	}
+
+	if w := post("sender=p1&timestamp=5&message=again"); w.Code != http.StatusConflict {
+		t.Errorf("Expected status Conflict for stale message, got %d", w.Code)
+	}
+	if w := post("sender=p1&timestamp=5&prev=7&message=bad"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status BadRequest for prev after timestamp, got %d", w.Code)
+	}
+	if w := post("timestamp=5&message=anonymous"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status BadRequest without sender, got %d", w.Code)
+	}
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+)
+
+// raftApplyTimeout bounds how long a proposal may wait to be committed
+const raftApplyTimeout = 5 * time.Second
+
+// RaftLog replicates the event log through Raft. Only the leader stamps
+// events: it ticks its Lamport clock and proposes the stamped event, which
+// every node appends once the entry is committed. Followers raise their
+// clocks to each committed timestamp, so whichever node is elected next
+// keeps stamping above everything already in the log.
+type RaftLog struct {
+	raft      *raft.Raft
+	server    *Server
+	transport raft.Transport
+	store     *BoltStore // nil when the stores are supplied by the caller
+
+	// proposing keeps stamping and submission atomic, so log order is
+	// timestamp order
+	proposing sync.Mutex
+}
+
+// newRaftLog starts a Raft node applying entries to server.
+func newRaftLog(server *Server, conf *raft.Config, logs raft.LogStore, stable raft.StableStore, snaps raft.SnapshotStore, transport raft.Transport) (*RaftLog, error) {
+	r, err := raft.NewRaft(conf, &raftFSM{server: server}, logs, stable, snaps, transport)
+	if err != nil {
+		return nil, err
+	}
+	rl := &RaftLog{raft: r, server: server, transport: transport}
+	server.replica = rl
+	return rl, nil
+}
+
+// OpenRaftLog starts the consensus mode described by cfg. The log and
+// stable state are kept in a bbolt file under cfg.RaftDir, next to the
+// snapshots. The cluster is bootstrapped from cfg.RaftPeers on first start
+// when cfg.RaftBootstrap is set; later starts resume from disk.
+func OpenRaftLog(cfg *Config, server *Server) (*RaftLog, error) {
+	if err := os.MkdirAll(cfg.RaftDir, 0o700); err != nil {
+		return nil, err
+	}
+	logger := hclog.FromStandardLogger(slog.NewLogLogger(server.logger.Handler(), slog.LevelInfo), &hclog.LoggerOptions{
+		Name:  "raft",
+		Level: hclog.LevelFromString(cfg.LogLevel),
+	})
+
+	store, err := OpenBoltStore(filepath.Join(cfg.RaftDir, "raft.db"))
+	if err != nil {
+		return nil, fmt.Errorf("opening raft store: %w", err)
+	}
+	snaps, err := raft.NewFileSnapshotStoreWithLogger(cfg.RaftDir, 2, logger)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	transport, err := newRaftTransport(cfg, logger)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	conf := raft.DefaultConfig()
+	conf.LocalID = raft.ServerID(cfg.NodeID)
+	conf.Logger = logger
+
+	if cfg.RaftBootstrap {
+		existing, err := raft.HasExistingState(store, store, snaps)
+		if err != nil {
+			store.Close()
+			transport.Close()
+			return nil, err
+		}
+		if !existing {
+			servers := append([]raft.Server{{ID: conf.LocalID, Address: transport.LocalAddr()}}, cfg.RaftPeers...)
+			err := raft.BootstrapCluster(conf, store, store, snaps, transport, raft.Configuration{Servers: servers})
+			if err != nil {
+				store.Close()
+				transport.Close()
+				return nil, fmt.Errorf("bootstrapping raft cluster: %w", err)
+			}
+		}
+	}
+
+	rl, err := newRaftLog(server, conf, store, store, snaps, transport)
+	if err != nil {
+		store.Close()
+		transport.Close()
+		return nil, err
+	}
+	rl.store = store
+	return rl, nil
+}
+
+// newRaftTransport listens on cfg.RaftAddr. With TLS configured, Raft
+// traffic uses the node certificate, and peers must present one signed by
+// the cluster CA when it is set.
+func newRaftTransport(cfg *Config, logger hclog.Logger) (*raft.NetworkTransport, error) {
+	advertise, err := net.ResolveTCPAddr("tcp", cfg.RaftAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid raft address: %w", err)
+	}
+	if !cfg.TLSEnabled() {
+		return raft.NewTCPTransportWithLogger(cfg.RaftAddr, advertise, 3, 10*time.Second, logger)
+	}
+
+	serverConfig, err := serverTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.TLSCAFile != "" {
+		serverConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	clientConfig, err := peerTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := tls.Listen("tcp", cfg.RaftAddr, serverConfig)
+	if err != nil {
+		return nil, err
+	}
+	layer := &tlsStreamLayer{Listener: listener, advertise: advertise, config: clientConfig}
+	return raft.NewNetworkTransportWithLogger(layer, 3, 10*time.Second, logger), nil
+}
+
+// tlsStreamLayer carries Raft RPCs over TLS
+type tlsStreamLayer struct {
+	net.Listener
+	advertise net.Addr
+	config    *tls.Config
+}
+
+func (l *tlsStreamLayer) Addr() net.Addr {
+	return l.advertise
+}
+
+func (l *tlsStreamLayer) Dial(address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	return tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", string(address), l.config)
+}
+
+// parseRaftPeers reads a comma separated list of id@host:port voters
+func parseRaftPeers(list string) ([]raft.Server, error) {
+	var servers []raft.Server
+	for _, p := range strings.Split(list, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		id, addr, ok := strings.Cut(p, "@")
+		if !ok || id == "" || addr == "" {
+			return nil, fmt.Errorf("invalid raft peer %q, expected id@host:port", p)
+		}
+		servers = append(servers, raft.Server{ID: raft.ServerID(id), Address: raft.ServerAddress(addr)})
+	}
+	return servers, nil
+}
+
+// Close stops the node and releases its stores
+func (rl *RaftLog) Close() error {
+	err := rl.raft.Shutdown().Error()
+	if closer, ok := rl.transport.(io.Closer); ok {
+		closer.Close()
+	}
+	if rl.store != nil {
+		rl.store.Close()
+	}
+	return err
+}
+
+// Leader returns the ID and Raft address of the current leader, empty
+// while an election is in progress
+func (rl *RaftLog) Leader() (string, string) {
+	addr, id := rl.raft.LeaderWithID()
+	return string(id), string(addr)
+}
+
+// ProposeLocal stamps a local event and waits until it is committed
+func (rl *RaftLog) ProposeLocal(event Event) (Event, error) {
+	s := rl.server
+
+	rl.proposing.Lock()
+	if rl.raft.State() != raft.Leader {
+		rl.proposing.Unlock()
+		return Event{}, raft.ErrNotLeader
+	}
+	now := s.clock.TickTime()
+	event.Timestamp = now.Timestamp
+	event.Epoch = now.Epoch
+	event.WallTime = time.Now()
+	future, err := rl.apply(event)
+	rl.proposing.Unlock()
+	if err != nil {
+		return Event{}, err
+	}
+
+	event, err = rl.wait(future)
+	if err == nil {
+		s.logger.Info("Event committed", append(eventAttrs(event), "message", event.Message)...)
+	}
+	return event, err
+}
+
+// ProposeMessage merges a received time through the jump guard, then
+// proposes the receive event and waits until it is committed
+func (rl *RaftLog) ProposeMessage(ctx context.Context, sender string, received ClockTime, message string) (Event, error) {
+	s := rl.server
+
+	rl.proposing.Lock()
+	if rl.raft.State() != raft.Leader {
+		rl.proposing.Unlock()
+		return Event{}, raft.ErrNotLeader
+	}
+	now, err := s.clock.UpdateChecked(received)
+	if err != nil {
+		rl.proposing.Unlock()
+		return Event{}, err
+	}
+	future, err := rl.apply(s.messageEvent(ctx, sender, received, now, message))
+	rl.proposing.Unlock()
+	if err != nil {
+		return Event{}, err
+	}
+
+	event, err := rl.wait(future)
+	if err == nil {
+		s.logger.Info("Message committed", append(eventAttrs(event),
+			"message", message,
+			"received_timestamp", received.Timestamp)...)
+	}
+	return event, err
+}
+
+func (rl *RaftLog) apply(event Event) (raft.ApplyFuture, error) {
+	event.Node = rl.server.nodeID
+	event = rl.server.sign(rl.server.pii.Redact(event))
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	return rl.raft.Apply(data, raftApplyTimeout), nil
+}
+
+func (rl *RaftLog) wait(future raft.ApplyFuture) (Event, error) {
+	if err := future.Error(); err != nil {
+		return Event{}, err
+	}
+	switch resp := future.Response().(type) {
+	case Event:
+		return resp, nil
+	case error:
+		return Event{}, resp
+	default:
+		return Event{}, fmt.Errorf("unexpected raft response %T", resp)
+	}
+}
+
+// commitLocal records a local event, through the replicated log when
+// running in Raft mode
+func (s *Server) commitLocal(event Event) (Event, error) {
+	if s.replica != nil {
+		return s.replica.ProposeLocal(event)
+	}
+	return s.recordLocal(event)
+}
+
+// writeCommitError reports an event that could not be committed. Followers
+// name the leader in the X-Raft-Leader header so clients can retry there.
+func (s *Server) writeCommitError(w http.ResponseWriter, err error) {
+	if s.replica != nil && errors.Is(err, raft.ErrNotLeader) {
+		if id, _ := s.replica.Leader(); id != "" {
+			w.Header().Set("X-Raft-Leader", id)
+		}
+	}
+	http.Error(w, fmt.Sprintf("Event not committed: %v", err), http.StatusServiceUnavailable)
+}
+
+func (rl *RaftLog) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	servers := []map[string]interface{}{}
+	if future := rl.raft.GetConfiguration(); future.Error() == nil {
+		for _, srv := range future.Configuration().Servers {
+			servers = append(servers, map[string]interface{}{
+				"id":       srv.ID,
+				"address":  srv.Address,
+				"suffrage": srv.Suffrage.String(),
+			})
+		}
+	}
+	leaderID, leaderAddr := rl.Leader()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"node_id":       rl.server.nodeID,
+		"state":         rl.raft.State().String(),
+		"leader_id":     leaderID,
+		"leader_addr":   leaderAddr,
+		"term":          rl.raft.CurrentTerm(),
+		"last_index":    rl.raft.LastIndex(),
+		"commit_index":  rl.raft.CommitIndex(),
+		"applied_index": rl.raft.AppliedIndex(),
+		"servers":       servers,
+	})
+}
+
+// raftFSM appends committed events to the server's log
+type raftFSM struct {
+	server *Server
+}
+
+func (f *raftFSM) Apply(log *raft.Log) interface{} {
+	var event Event
+	if err := json.Unmarshal(log.Data, &event); err != nil {
+		return fmt.Errorf("decoding raft entry %d: %w", log.Index, err)
+	}
+	s := f.server
+	s.clock.observe(ClockTime{Epoch: event.Epoch, Timestamp: event.Timestamp})
+
+	// The entry is committed already, so an invalid signature of the
+	// proposing node is flagged whatever the policy
+	if s.signer != nil && event.Node != s.nodeID && event.Signature != "" {
+		if err := s.signer.VerifyEvent(event); err != nil {
+			event.InvalidSignature = true
+			s.metrics.Inc("lamport_signature_failures_total", "source", "raft", "policy", string(SignatureFlag))
+			s.logger.Warn("Signature verification failed", "source", "raft", "id", event.ID, "key_id", event.KeyID, "error", err)
+		}
+	}
+	event, err := s.appendEvent(event)
+	if err != nil {
+		return err
+	}
+	return event
+}
+
+func (f *raftFSM) Snapshot() (raft.FSMSnapshot, error) {
+	s := f.server
+	s.mutex.RLock()
+	snap := raftSnapshot{Events: s.events.Events(), Head: s.head, Dropped: s.events.Dropped()}
+	s.mutex.RUnlock()
+	return snap, nil
+}
+
+// Restore replaces the log with a snapshot, after checking that its events
+// chain up to the recorded head. Subscribers are not notified, as a
+// restored log replaces rather than extends what they have seen.
+func (f *raftFSM) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+	var snap raftSnapshot
+	if err := json.NewDecoder(rc).Decode(&snap); err != nil {
+		return err
+	}
+	if snap.Events == nil {
+		snap.Events = make([]Event, 0)
+	}
+	first := ""
+	if snap.Dropped > 0 && len(snap.Events) > 0 {
+		first = snap.Events[0].PrevHash
+	}
+	if broken := verifyChainFrom(first, snap.Events); broken != nil {
+		return fmt.Errorf("snapshot chain broken at event %d (%s): %s", broken.Index, broken.ID, broken.Reason)
+	}
+	last := ""
+	if n := len(snap.Events); n > 0 {
+		last = snap.Events[n-1].Hash
+	}
+	if last != snap.Head {
+		return errors.New("snapshot chain does not end at its head")
+	}
+
+	s := f.server
+	for _, e := range snap.Events {
+		s.clock.observe(ClockTime{Epoch: e.Epoch, Timestamp: e.Timestamp})
+	}
+	s.mutex.Lock()
+	if err := replaceChecked(s.events, snap.Events); err != nil {
+		s.mutex.Unlock()
+		return err
+	}
+	s.head = snap.Head
+	s.latest = ClockTime{}
+	for _, e := range snap.Events {
+		s.observeLocked(e)
+	}
+	s.mutex.Unlock()
+	s.logged.Notify()
+	return nil
+}
+
+// raftSnapshot is the event log at the time of a snapshot with the hash of
+// its newest event
+type raftSnapshot struct {
+	Events []Event `json:"events"`
+	Head   string  `json:"chain_head"`
+
+	// Dropped is set when the log is a ring buffer that lost older events,
+	// so its first event does not start the chain
+	Dropped int64 `json:"dropped,omitempty"`
+}
+
+func (snap raftSnapshot) Persist(sink raft.SnapshotSink) error {
+	if err := json.NewEncoder(sink).Encode(snap); err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (snap raftSnapshot) Release() {}
+
+// observe raises the clock to a committed timestamp without counting an
+// event. Committed entries were already checked by the leader, so the jump
+// guard does not apply.
+func (lc *LamportClock) observe(t ClockTime) {
+	lc.mutex.Lock()
+	from := lc.nowLocked()
+	lc.maxLocked(t)
+	lc.recordLocked(from, causeCommit, t, false, ClockSource{})
+	lc.mutex.Unlock()
+}
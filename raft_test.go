@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+)
+
+// newRaftCluster starts nodes connected by in-memory transports, with the
+// first node bootstrapping the cluster
+func newRaftCluster(t *testing.T, ids ...string) []*RaftLog {
+	transports := make([]*raft.InmemTransport, len(ids))
+	var servers []raft.Server
+	for i, id := range ids {
+		_, transports[i] = raft.NewInmemTransport(raft.ServerAddress(id))
+		servers = append(servers, raft.Server{ID: raft.ServerID(id), Address: raft.ServerAddress(id)})
+	}
+	for i, a := range transports {
+		for j, b := range transports {
+			if i != j {
+				a.Connect(b.LocalAddr(), b)
+			}
+		}
+	}
+
+	nodes := make([]*RaftLog, len(ids))
+	for i, id := range ids {
+		conf := raft.DefaultConfig()
+		conf.LocalID = raft.ServerID(id)
+		conf.HeartbeatTimeout = 50 * time.Millisecond
+		conf.ElectionTimeout = 50 * time.Millisecond
+		conf.LeaderLeaseTimeout = 50 * time.Millisecond
+		conf.CommitTimeout = 5 * time.Millisecond
+		conf.Logger = hclog.NewNullLogger()
+
+		store := raft.NewInmemStore()
+		snaps := raft.NewInmemSnapshotStore()
+		if i == 0 {
+			if err := raft.BootstrapCluster(conf, store, store, snaps, transports[i], raft.Configuration{Servers: servers}); err != nil {
+				t.Fatalf("Bootstrap failed: %v", err)
+			}
+		}
+
+		server := NewServer()
+		server.nodeID = id
+		node, err := newRaftLog(server, conf, store, store, snaps, transports[i])
+		if err != nil {
+			t.Fatalf("Failed to start node %s: %v", id, err)
+		}
+		t.Cleanup(func() { node.Close() })
+		nodes[i] = node
+	}
+	return nodes
+}
+
+// raftLeader waits for the cluster to elect a leader
+func raftLeader(t *testing.T, nodes []*RaftLog) *RaftLog {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, n := range nodes {
+			if n.raft.State() == raft.Leader {
+				return n
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("No leader elected")
+	return nil
+}
+
+// waitForEvents waits until every node has applied n events
+func waitForEvents(t *testing.T, nodes []*RaftLog, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for _, node := range nodes {
+		for {
+			node.server.mutex.RLock()
+			got := node.server.events.Len()
+			node.server.mutex.RUnlock()
+			if got >= n {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %d events on %s, got %d", n, node.server.nodeID, got)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestRaftReplicatesLog(t *testing.T) {
+	nodes := newRaftCluster(t, "a", "b", "c")
+	leader := raftLeader(t, nodes)
+
+	for i := 0; i < 5; i++ {
+		if _, err := leader.ProposeLocal(Event{ID: fmt.Sprintf("e%d", i), Message: "Replicated"}); err != nil {
+			t.Fatalf("Proposal failed: %v", err)
+		}
+	}
+	if _, err := leader.ProposeMessage(t.Context(), "x", ClockTime{Timestamp: 100}, "Remote"); err != nil {
+		t.Fatalf("Message proposal failed: %v", err)
+	}
+	waitForEvents(t, nodes, 6)
+
+	leader.server.mutex.RLock()
+	want := leader.server.events.Events()
+	leader.server.mutex.RUnlock()
+	for _, n := range nodes {
+		n.server.mutex.RLock()
+		events := n.server.events.Events()
+		n.server.mutex.RUnlock()
+		for i := range want {
+			if events[i].ID != want[i].ID || events[i].Timestamp != want[i].Timestamp {
+				t.Errorf("Node %s diverges at %d: expected %s@%d, got %s@%d", n.server.nodeID, i,
+					want[i].ID, want[i].Timestamp, events[i].ID, events[i].Timestamp)
+			}
+			if events[i].Node != leader.server.nodeID {
+				t.Errorf("Expected events attributed to %s, got %s", leader.server.nodeID, events[i].Node)
+			}
+			if i > 0 && !(events[i-1].Timestamp < events[i].Timestamp) {
+				t.Errorf("Expected increasing timestamps, got %d then %d", events[i-1].Timestamp, events[i].Timestamp)
+			}
+		}
+		// Followers observe committed timestamps without ticking
+		if got := n.server.clock.GetTime(); got != 101 {
+			t.Errorf("Expected clock 101 on %s, got %d", n.server.nodeID, got)
+		}
+	}
+}
+
+func TestRaftFollowerRejectsProposals(t *testing.T) {
+	nodes := newRaftCluster(t, "a", "b", "c")
+	leader := raftLeader(t, nodes)
+	var follower *RaftLog
+	for _, n := range nodes {
+		if n != leader {
+			follower = n
+			break
+		}
+	}
+
+	if _, err := follower.ProposeLocal(Event{ID: "e"}); !errors.Is(err, raft.ErrNotLeader) {
+		t.Errorf("Expected ErrNotLeader, got %v", err)
+	}
+	if follower.server.clock.GetTime() != 0 {
+		t.Errorf("Expected follower clock untouched, got %d", follower.server.clock.GetTime())
+	}
+
+	// Wait until the follower has heard from the leader
+	deadline := time.Now().Add(5 * time.Second)
+	for id, _ := follower.Leader(); id == ""; id, _ = follower.Leader() {
+		if time.Now().After(deadline) {
+			t.Fatal("Follower did not learn the leader")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/event?message=hello", nil)
+	w := httptest.NewRecorder()
+	follower.server.handleCreateEvent(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503, got %d", w.Code)
+	}
+	if got := w.Header().Get("X-Raft-Leader"); got != leader.server.nodeID {
+		t.Errorf("Expected leader hint %s, got %q", leader.server.nodeID, got)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/message?timestamp=5&message=hi", nil)
+	w = httptest.NewRecorder()
+	follower.server.handleReceiveMessage(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503, got %d", w.Code)
+	}
+}
+
+func TestRaftCreateEventOnLeader(t *testing.T) {
+	nodes := newRaftCluster(t, "a", "b", "c")
+	leader := raftLeader(t, nodes)
+
+	req := httptest.NewRequest(http.MethodPost, "/event?message=hello", nil)
+	w := httptest.NewRecorder()
+	leader.server.handleCreateEvent(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var event Event
+	json.NewDecoder(w.Body).Decode(&event)
+	if event.Timestamp != 1 || event.Message != "hello" {
+		t.Errorf("Expected hello at 1, got %s at %d", event.Message, event.Timestamp)
+	}
+	waitForEvents(t, nodes, 1)
+}
+
+func TestRaftSnapshotRestore(t *testing.T) {
+	source := NewServer()
+	source.nodeID = "a"
+	source.logEvent("e1", "First")
+	source.logEvent("e2", "Second")
+
+	snap, err := (&raftFSM{server: source}).Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	store := raft.NewInmemSnapshotStore()
+	sink, err := store.Create(raft.SnapshotVersionMax, 2, 1, raft.Configuration{}, 0, nil)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatalf("Persist failed: %v", err)
+	}
+
+	_, rc, err := store.Open(sink.ID())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	target := NewServer()
+	target.logEvent("stale", "Replaced")
+	if err := (&raftFSM{server: target}).Restore(rc); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if target.events.Len() != 2 || target.events.Events()[1].ID != "e2" {
+		t.Errorf("Expected the snapshot log, got %v", target.events.Events())
+	}
+	if target.clock.GetTime() != 2 {
+		t.Errorf("Expected clock 2, got %d", target.clock.GetTime())
+	}
+	if target.head != source.head {
+		t.Errorf("Expected chain head %s, got %s", source.head, target.head)
+	}
+
+	// A snapshot whose events do not chain up is refused
+	tampered := `{"events":[{"id":"e1","message":"Forged","lamport_timestamp":1,"hash":"00"}],"chain_head":"00"}`
+	if err := (&raftFSM{server: NewServer()}).Restore(io.NopCloser(strings.NewReader(tampered))); err == nil {
+		t.Error("Expected a tampered snapshot to be refused")
+	}
+}
+
+func TestRaftStatus(t *testing.T) {
+	nodes := newRaftCluster(t, "a", "b", "c")
+	leader := raftLeader(t, nodes)
+
+	req := httptest.NewRequest(http.MethodGet, "/raft/status", nil)
+	w := httptest.NewRecorder()
+	leader.handleStatus(w, req)
+
+	var response map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&response)
+	if response["state"] != "Leader" {
+		t.Errorf("Expected Leader, got %v", response["state"])
+	}
+	if response["leader_id"] != leader.server.nodeID {
+		t.Errorf("Expected leader %s, got %v", leader.server.nodeID, response["leader_id"])
+	}
+	if servers := response["servers"].([]interface{}); len(servers) != 3 {
+		t.Errorf("Expected 3 servers, got %d", len(servers))
+	}
+}
+
+func TestParseRaftPeers(t *testing.T) {
+	servers, err := parseRaftPeers("b@10.0.0.2:7000, c@10.0.0.3:7000")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(servers) != 2 || servers[1].ID != "c" || servers[1].Address != "10.0.0.3:7000" {
+		t.Errorf("Unexpected servers %v", servers)
+	}
+	for _, bad := range []string{"b", "@10.0.0.2:7000", "b@"} {
+		if _, err := parseRaftPeers(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/raft"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	raftLogsBucket   = []byte("logs")
+	raftStableBucket = []byte("stable")
+)
+
+// errKeyNotFound is returned for missing stable keys. Raft compares the
+// message rather than the error value, so the text must stay "not found".
+var errKeyNotFound = errors.New("not found")
+
+// BoltStore is a Raft log and stable store kept in a single bbolt file.
+// Log entries are keyed by their big endian index so that cursor order is
+// log order.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+var (
+	_ raft.LogStore    = (*BoltStore)(nil)
+	_ raft.StableStore = (*BoltStore)(nil)
+)
+
+// OpenBoltStore opens or creates the store at path
+func OpenBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(raftLogsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(raftStableBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// Close releases the database file
+func (b *BoltStore) Close() error {
+	return b.db.Close()
+}
+
+func indexKey(index uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, index)
+}
+
+// FirstIndex returns the first stored index, or 0 when the log is empty
+func (b *BoltStore) FirstIndex() (uint64, error) {
+	var index uint64
+	err := b.db.View(func(tx *bolt.Tx) error {
+		if k, _ := tx.Bucket(raftLogsBucket).Cursor().First(); k != nil {
+			index = binary.BigEndian.Uint64(k)
+		}
+		return nil
+	})
+	return index, err
+}
+
+// LastIndex returns the last stored index, or 0 when the log is empty
+func (b *BoltStore) LastIndex() (uint64, error) {
+	var index uint64
+	err := b.db.View(func(tx *bolt.Tx) error {
+		if k, _ := tx.Bucket(raftLogsBucket).Cursor().Last(); k != nil {
+			index = binary.BigEndian.Uint64(k)
+		}
+		return nil
+	})
+	return index, err
+}
+
+// GetLog reads the entry at index
+func (b *BoltStore) GetLog(index uint64, log *raft.Log) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(raftLogsBucket).Get(indexKey(index))
+		if v == nil {
+			return raft.ErrLogNotFound
+		}
+		return decodeRaftLog(v, log)
+	})
+}
+
+// StoreLog writes a single entry
+func (b *BoltStore) StoreLog(log *raft.Log) error {
+	return b.StoreLogs([]*raft.Log{log})
+}
+
+// StoreLogs writes entries in one transaction
+func (b *BoltStore) StoreLogs(logs []*raft.Log) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(raftLogsBucket)
+		for _, log := range logs {
+			if err := bucket.Put(indexKey(log.Index), encodeRaftLog(log)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteRange removes the entries from min to max inclusive
+func (b *BoltStore) DeleteRange(min, max uint64) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(raftLogsBucket).Cursor()
+		for k, _ := c.Seek(indexKey(min)); k != nil && binary.BigEndian.Uint64(k) <= max; k, _ = c.Next() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Set stores a stable value
+func (b *BoltStore) Set(key, val []byte) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(raftStableBucket).Put(key, val)
+	})
+}
+
+// Get reads a stable value
+func (b *BoltStore) Get(key []byte) ([]byte, error) {
+	var val []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(raftStableBucket).Get(key)
+		if v == nil {
+			return errKeyNotFound
+		}
+		val = append([]byte(nil), v...)
+		return nil
+	})
+	return val, err
+}
+
+// SetUint64 stores a stable integer
+func (b *BoltStore) SetUint64(key []byte, val uint64) error {
+	return b.Set(key, indexKey(val))
+}
+
+// GetUint64 reads a stable integer, 0 when it is not set
+func (b *BoltStore) GetUint64(key []byte) (uint64, error) {
+	val, err := b.Get(key)
+	if errors.Is(err, errKeyNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(val) != 8 {
+		return 0, fmt.Errorf("stable key %q: bad length %d", key, len(val))
+	}
+	return binary.BigEndian.Uint64(val), nil
+}
+
+// encodeRaftLog writes an entry as uvarints for index, term and type, the
+// appended time in Unix nanoseconds as a varint, then the length prefixed
+// data and extensions
+func encodeRaftLog(log *raft.Log) []byte {
+	b := make([]byte, 0, 4*binary.MaxVarintLen64+len(log.Data)+len(log.Extensions))
+	b = binary.AppendUvarint(b, log.Index)
+	b = binary.AppendUvarint(b, log.Term)
+	b = binary.AppendUvarint(b, uint64(log.Type))
+	var appended int64
+	if !log.AppendedAt.IsZero() {
+		appended = log.AppendedAt.UnixNano()
+	}
+	b = binary.AppendVarint(b, appended)
+	b = binary.AppendUvarint(b, uint64(len(log.Data)))
+	b = append(b, log.Data...)
+	b = binary.AppendUvarint(b, uint64(len(log.Extensions)))
+	return append(b, log.Extensions...)
+}
+
+func decodeRaftLog(b []byte, log *raft.Log) error {
+	var fields [3]uint64
+	for i := range fields {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errors.New("corrupt raft log entry")
+		}
+		fields[i], b = v, b[n:]
+	}
+	appended, n := binary.Varint(b)
+	if n <= 0 {
+		return errors.New("corrupt raft log entry")
+	}
+	b = b[n:]
+
+	var chunks [2][]byte
+	for i := range chunks {
+		size, n := binary.Uvarint(b)
+		if n <= 0 || size > uint64(len(b)-n) {
+			return errors.New("corrupt raft log entry")
+		}
+		b = b[n:]
+		if size > 0 {
+			chunks[i] = append([]byte(nil), b[:size]...)
+		}
+		b = b[size:]
+	}
+
+	*log = raft.Log{
+		Index:      fields[0],
+		Term:       fields[1],
+		Type:       raft.LogType(fields[2]),
+		Data:       chunks[0],
+		Extensions: chunks[1],
+	}
+	if appended != 0 {
+		log.AppendedAt = time.Unix(0, appended)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+func openTestBoltStore(t *testing.T, path string) *BoltStore {
+	store, err := OpenBoltStore(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	return store
+}
+
+func TestBoltStoreLogs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "raft.db")
+	store := openTestBoltStore(t, path)
+
+	if first, _ := store.FirstIndex(); first != 0 {
+		t.Errorf("Expected empty log, got first index %d", first)
+	}
+
+	appended := time.Unix(1700000000, 42)
+	var logs []*raft.Log
+	for i := uint64(1); i <= 5; i++ {
+		logs = append(logs, &raft.Log{Index: i, Term: 2, Type: raft.LogCommand, Data: []byte{byte(i)}, AppendedAt: appended})
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("StoreLogs failed: %v", err)
+	}
+	if err := store.DeleteRange(1, 2); err != nil {
+		t.Fatalf("DeleteRange failed: %v", err)
+	}
+	store.Close()
+
+	// Entries survive reopening
+	store = openTestBoltStore(t, path)
+	defer store.Close()
+
+	first, _ := store.FirstIndex()
+	last, _ := store.LastIndex()
+	if first != 3 || last != 5 {
+		t.Errorf("Expected indexes 3..5, got %d..%d", first, last)
+	}
+
+	var log raft.Log
+	if err := store.GetLog(4, &log); err != nil {
+		t.Fatalf("GetLog failed: %v", err)
+	}
+	if log.Index != 4 || log.Term != 2 || log.Type != raft.LogCommand || !bytes.Equal(log.Data, []byte{4}) {
+		t.Errorf("Unexpected entry %+v", log)
+	}
+	if !log.AppendedAt.Equal(appended) {
+		t.Errorf("Expected appended at %v, got %v", appended, log.AppendedAt)
+	}
+	if err := store.GetLog(1, &log); !errors.Is(err, raft.ErrLogNotFound) {
+		t.Errorf("Expected ErrLogNotFound, got %v", err)
+	}
+}
+
+func TestBoltStoreStable(t *testing.T) {
+	store := openTestBoltStore(t, filepath.Join(t.TempDir(), "raft.db"))
+	defer store.Close()
+
+	if _, err := store.Get([]byte("missing")); err == nil || err.Error() != "not found" {
+		t.Errorf("Expected not found, got %v", err)
+	}
+	if v, err := store.GetUint64([]byte("term")); err != nil || v != 0 {
+		t.Errorf("Expected 0 for unset key, got %d, %v", v, err)
+	}
+
+	store.Set([]byte("vote"), []byte("a"))
+	store.SetUint64([]byte("term"), 7)
+	if v, _ := store.Get([]byte("vote")); string(v) != "a" {
+		t.Errorf("Expected a, got %q", v)
+	}
+	if v, _ := store.GetUint64([]byte("term")); v != 7 {
+		t.Errorf("Expected 7, got %d", v)
+	}
+}
+
+func TestDecodeRaftLogRejectsTruncated(t *testing.T) {
+	b := encodeRaftLog(&raft.Log{Index: 1, Term: 1, Data: []byte("payload")})
+	var log raft.Log
+	if err := decodeRaftLog(b[:len(b)-3], &log); err == nil {
+		t.Error("Expected error for truncated entry")
+	}
+}
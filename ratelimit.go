@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// bucketIdleTimeout is how long an untouched bucket is kept; a full bucket
+// carries no state worth keeping
+const bucketIdleTimeout = 10 * time.Minute
+
+// tokenBucket holds the state of one client
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// RateLimiter is a token bucket rate limiter keyed by client
+type RateLimiter struct {
+	rate      float64 // tokens added per second
+	burst     float64 // bucket capacity
+	keyByAPI  bool    // key by X-API-Key when known instead of client IP
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+	mutex     sync.Mutex
+
+	// known reports whether an API key is configured
+	known func(key string) bool
+}
+
+// NewRateLimiter creates a limiter allowing rate requests per second with
+// the given burst. A rate of zero disables limiting.
+func NewRateLimiter(rate float64, burst int, keyByAPI bool) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:     rate,
+		burst:    float64(burst),
+		keyByAPI: keyByAPI,
+		buckets:  make(map[string]*tokenBucket),
+		now:      time.Now,
+	}
+}
+
+// SetLimit changes rate and burst at runtime; existing buckets keep their tokens
+func (rl *RateLimiter) SetLimit(rate float64, burst int) {
+	if burst < 1 {
+		burst = 1
+	}
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	rl.rate = rate
+	rl.burst = float64(burst)
+}
+
+// Allow takes a token for key. When the bucket is empty it returns false and
+// how long the client should wait for the next token.
+func (rl *RateLimiter) Allow(key string) (bool, time.Duration) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	if rl.rate <= 0 {
+		return true, 0
+	}
+
+	now := rl.now()
+	rl.sweepLocked(now)
+
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: rl.burst, lastSeen: now}
+		rl.buckets[key] = b
+	}
+
+	b.tokens = math.Min(rl.burst, b.tokens+now.Sub(b.lastSeen).Seconds()*rl.rate)
+	b.lastSeen = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / rl.rate * float64(time.Second))
+	return false, wait
+}
+
+// sweepLocked drops idle buckets so the map does not grow without bound
+func (rl *RateLimiter) sweepLocked(now time.Time) {
+	if now.Sub(rl.lastSweep) < bucketIdleTimeout {
+		return
+	}
+	for key, b := range rl.buckets {
+		if now.Sub(b.lastSeen) > bucketIdleTimeout {
+			delete(rl.buckets, key)
+		}
+	}
+	rl.lastSweep = now
+}
+
+// clientKey identifies the caller of a request. Only the API keys known
+// accepts get buckets of their own: any other value is up to the client,
+// who could send a new one with every request to escape the limit and
+// fill the map with buckets, so it is keyed by address.
+func (rl *RateLimiter) clientKey(r *http.Request) string {
+	if rl.keyByAPI && rl.known != nil {
+		if key := r.Header.Get("X-API-Key"); key != "" && rl.known(key) {
+			return "key:" + key
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// Limit rate limits the state-changing requests of a handler. Reads are
+// never limited.
+func (rl *RateLimiter) Limit(metrics *Metrics, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next(w, r)
+			return
+		}
+
+		if ok, wait := rl.Allow(rl.clientKey(r)); !ok {
+			metrics.Inc("lamport_rate_limited_total")
+			seconds := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			http.Error(w, fmt.Sprintf("Rate limit exceeded, retry in %ds", seconds), http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterTokenBucket(t *testing.T) {
+	rl := NewRateLimiter(2, 3, false) // 2 tokens per second, burst of 3
+	now := time.Unix(1000, 0)
+	rl.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := rl.Allow("client"); !ok {
+			t.Fatalf("Expected request %d within burst to be allowed", i+1)
+		}
+	}
+
+	ok, wait := rl.Allow("client")
+	if ok {
+		t.Fatal("Expected request beyond burst to be rejected")
+	}
+	if wait != 500*time.Millisecond {
+		t.Errorf("Expected to wait 500ms for the next token, got %v", wait)
+	}
+
+	// Other clients have their own bucket
+	if ok, _ := rl.Allow("other"); !ok {
+		t.Error("Expected a different client to be allowed")
+	}
+
+	// Tokens refill over time
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := rl.Allow("client"); !ok {
+		t.Error("Expected a refilled token to be available")
+	}
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	rl := NewRateLimiter(0, 1, false)
+	for i := 0; i < 100; i++ {
+		if ok, _ := rl.Allow("client"); !ok {
+			t.Fatal("Expected disabled limiter to allow everything")
+		}
+	}
+}
+
+func TestRateLimiterSweepsIdleBuckets(t *testing.T) {
+	rl := NewRateLimiter(1, 1, false)
+	now := time.Unix(1000, 0)
+	rl.now = func() time.Time { return now }
+
+	rl.Allow("a")
+	rl.Allow("b")
+	now = now.Add(2 * bucketIdleTimeout)
+	rl.Allow("c")
+
+	if len(rl.buckets) != 1 {
+		t.Errorf("Expected idle buckets to be swept, %d left", len(rl.buckets))
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	server := NewServer()
+	rl := NewRateLimiter(1, 1, true)
+	rl.known = func(key string) bool { return key == "team-a" || key == "team-b" }
+	handler := rl.Limit(server.metrics, server.handleCreateEvent)
+
+	send := func(method, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/event", nil)
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	if w := send("POST", "team-a"); w.Code != http.StatusOK {
+		t.Fatalf("Expected first request to pass, got %d", w.Code)
+	}
+
+	w := send("POST", "team-a")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status TooManyRequests, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected Retry-After of 1 second, got %q", w.Header().Get("Retry-After"))
+	}
+
+	// Requests keyed by another API key are unaffected, reads are never limited
+	if w := send("POST", "team-b"); w.Code != http.StatusOK {
+		t.Errorf("Expected a different API key to pass, got %d", w.Code)
+	}
+	if w := send("GET", "team-a"); w.Code == http.StatusTooManyRequests {
+		t.Error("Expected GET requests not to be rate limited")
+	}
+
+	// Unknown keys share the bucket of the address, however many there are
+	if w := send("POST", "made-up-1"); w.Code != http.StatusOK {
+		t.Errorf("Expected the address to have a token left, got %d", w.Code)
+	}
+	if w := send("POST", "made-up-2"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected another unknown key limited with the address, got %d", w.Code)
+	}
+	if len(rl.buckets) != 3 {
+		t.Errorf("Expected buckets for team-a, team-b and the address, got %d", len(rl.buckets))
+	}
+
+	if got := server.metrics.Value("lamport_rate_limited_total"); got != 2 {
+		t.Errorf("Expected 2 rate limited requests, got %v", got)
+	}
+	if server.clock.GetTime() != 3 {
+		t.Errorf("Expected only allowed requests to tick the clock, got %d", server.clock.GetTime())
+	}
+}
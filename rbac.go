@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec/lamportpb/lamportpbconnect"
+)
+
+// Role is a set of the roles a caller holds
+type Role uint8
+
+// Each role grants one group of endpoints. The roles granting more imply
+// those below them: writers read, admins write, and peers read as well.
+const (
+	RoleReader Role = 1 << iota // GET and other safe requests to the API
+	RoleWriter                  // requests creating events or changing state
+	RoleAdmin                   // endpoints guarded by the admin token
+	RolePeer                    // inter-node endpoints
+)
+
+var roleByName = map[string]Role{
+	"reader": RoleReader,
+	"writer": RoleWriter | RoleReader,
+	"admin":  RoleAdmin | RoleWriter | RoleReader,
+	"peer":   RolePeer | RoleReader,
+}
+
+// parseRoles reads role names, adding the roles they imply
+func parseRoles(names []string) (Role, error) {
+	var roles Role
+	for _, name := range names {
+		role, ok := roleByName[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return 0, fmt.Errorf("unknown role %q", name)
+		}
+		roles |= role
+	}
+	return roles, nil
+}
+
+func (r Role) String() string {
+	var names []string
+	for i, name := range []string{"reader", "writer", "admin", "peer"} {
+		if r&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// RoleConfig describes a holder of API keys in the roles file
+type RoleConfig struct {
+	Name    string   `json:"name"`
+	APIKeys []string `json:"api_keys"`
+	Roles   []string `json:"roles"`
+}
+
+// ErrUnknownCredentials is returned for an API key or token that grants
+// nothing
+var ErrUnknownCredentials = errors.New("unknown API key or invalid token")
+
+// AccessControl maps API keys, and the roles claim of JWTs signed with a
+// shared secret, to roles. Keys are stored as SHA-256 sums, as tenant keys.
+type AccessControl struct {
+	byKey     map[[sha256.Size]byte]keyHolder
+	jwtSecret []byte
+	anonymous Role // of requests without credentials
+}
+
+// keyHolder is an entry of the roles file an API key belongs to
+type keyHolder struct {
+	name  string
+	roles Role
+}
+
+// LoadRoles reads a JSON array of RoleConfig
+func LoadRoles(path string) ([]RoleConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []RoleConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("invalid roles file: %w", err)
+	}
+	return configs, nil
+}
+
+// NewAccessControl validates the role configs. Tokens are accepted when
+// jwtSecret is set; requests without credentials get the anonymous roles.
+func NewAccessControl(configs []RoleConfig, jwtSecret []byte, anonymous []string) (*AccessControl, error) {
+	a := &AccessControl{byKey: make(map[[sha256.Size]byte]keyHolder), jwtSecret: jwtSecret}
+	var err error
+	if a.anonymous, err = parseRoles(anonymous); err != nil {
+		return nil, err
+	}
+	for _, c := range configs {
+		roles, err := parseRoles(c.Roles)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.Name, err)
+		}
+		if roles == 0 || len(c.APIKeys) == 0 {
+			return nil, fmt.Errorf("%s needs roles and API keys", c.Name)
+		}
+		for _, key := range c.APIKeys {
+			sum := sha256.Sum256([]byte(key))
+			if _, dup := a.byKey[sum]; key == "" || dup {
+				return nil, fmt.Errorf("%s: empty or duplicate API key", c.Name)
+			}
+			a.byKey[sum] = keyHolder{name: c.Name, roles: roles}
+		}
+	}
+	return a, nil
+}
+
+// Authenticate returns the roles granted by an API key or a token
+func (a *AccessControl) Authenticate(credential string) (Role, error) {
+	if holder, ok := a.byKey[sha256.Sum256([]byte(credential))]; ok {
+		return holder.roles, nil
+	}
+	if len(a.jwtSecret) == 0 || !looksLikeJWT(credential) {
+		return 0, ErrUnknownCredentials
+	}
+	claims, err := parseJWT(credential, a.jwtSecret, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return parseRoles(claims.Roles)
+}
+
+// Holder names the holder of an API key, or the subject of a token, and
+// is empty for credentials that grant nothing
+func (a *AccessControl) Holder(credential string) string {
+	if holder, ok := a.byKey[sha256.Sum256([]byte(credential))]; ok {
+		return holder.name
+	}
+	if len(a.jwtSecret) == 0 || !looksLikeJWT(credential) {
+		return ""
+	}
+	claims, err := parseJWT(credential, a.jwtSecret, time.Now())
+	if err != nil {
+		return ""
+	}
+	return "jwt:" + claims.Subject
+}
+
+// requestCredential returns the API key of a request, sent as X-API-Key or as a
+// bearer token
+func requestCredential(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token
+}
+
+type rolesKey struct{}
+
+// rolesFrom returns the roles withAccess found for the request
+func rolesFrom(ctx context.Context) (Role, bool) {
+	roles, ok := ctx.Value(rolesKey{}).(Role)
+	return roles, ok
+}
+
+// roles returns what the caller of r may do: the roles of its API key or
+// token, admin for the admin token, writer for a tenant key and peer for
+// a verified client certificate when peers present them
+func (s *Server) roles(r *http.Request) (Role, error) {
+	if roles, ok := rolesFrom(r.Context()); ok {
+		return roles, nil
+	}
+	var roles Role
+	if s.peerCerts && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		roles |= roleByName["peer"]
+	}
+	granted, err := s.credentialRoles(requestCredential(r))
+	return roles | granted, err
+}
+
+// credentialRoles returns the roles of an API key or token: admin for the
+// admin token, writer for a tenant key, and the anonymous roles without one
+func (s *Server) credentialRoles(credential string) (Role, error) {
+	switch {
+	case credential == "":
+		return s.access.anonymous, nil
+	case s.adminToken != "" && subtle.ConstantTimeCompare([]byte(credential), []byte(s.adminToken)) == 1:
+		return roleByName["admin"], nil
+	case s.tenants != nil && s.tenants.byKey[sha256.Sum256([]byte(credential))] != nil:
+		return roleByName["writer"], nil
+	}
+	return s.access.Authenticate(credential)
+}
+
+// knownAPIKey reports whether key is the API key of a role holder or of a
+// tenant
+func (s *Server) knownAPIKey(key string) bool {
+	sum := sha256.Sum256([]byte(key))
+	if s.tenants != nil && s.tenants.byKey[sum] != nil {
+		return true
+	}
+	if s.access == nil {
+		return false
+	}
+	_, ok := s.access.byKey[sum]
+	return ok
+}
+
+// publicRoutes stay open to probes and browsers whatever the roles
+var publicRoutes = []string{"/", "/healthz", "/readyz", "/openapi.json", "/ui/"}
+
+// readRoutes only read, whatever the method, so POST needs the reader role
+var readRoutes = []string{"/graphql", lamportpbconnect.ClockStreamEventsProcedure}
+
+// peerRoutes are the inter-node endpoints not under /peer/. Their role is
+// checked by fromPeer.
+var peerRoutes = []string{"/message", "/queue", "/cluster/join", "/cluster/leave", lamportpbconnect.ClockUpdateProcedure}
+
+// withAccess refuses requests whose caller lacks the role of the endpoint
+// group of pattern, when access is role based: reader for safe methods
+// and writer for the others. Admin and inter-node endpoints are further
+// checked by admin and fromPeer.
+func (s *Server) withAccess(pattern string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.access == nil || slices.Contains(publicRoutes, pattern) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		roles, err := s.roles(r)
+		if err != nil {
+			unauthorized(w, "Unauthorized: "+err.Error())
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), rolesKey{}, roles))
+
+		if strings.HasPrefix(pattern, "/peer/") || slices.Contains(peerRoutes, pattern) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		required := RoleWriter
+		switch {
+		case r.Method == http.MethodGet, r.Method == http.MethodHead, r.Method == http.MethodOptions:
+			required = RoleReader
+		case slices.Contains(readRoutes, pattern):
+			required = RoleReader
+		}
+		if !s.permit(w, r, roles, required) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// permit reports whether roles include required, answering 401 to
+// anonymous callers and 403 to the others when they do not
+func (s *Server) permit(w http.ResponseWriter, r *http.Request, roles, required Role) bool {
+	if roles&required != 0 {
+		return true
+	}
+	if requestCredential(r) == "" && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+		unauthorized(w, "Unauthorized")
+		return false
+	}
+	http.Error(w, "Forbidden: requires the "+required.String()+" role", http.StatusForbidden)
+	return false
+}
+
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="lamport"`)
+	http.Error(w, message, http.StatusUnauthorized)
+}
+
+// requireRole guards a handler with a role when access is role based
+func (s *Server) requireRole(role Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roles, err := s.roles(r)
+		if err != nil {
+			unauthorized(w, "Unauthorized: "+err.Error())
+			return
+		}
+		if s.permit(w, r, roles, role) {
+			next(w, r)
+		}
+	}
+}
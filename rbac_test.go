@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRoleBasedAccess(t *testing.T) {
+	secret := []byte("jwt-secret")
+	access, err := NewAccessControl([]RoleConfig{
+		{Name: "dashboard", APIKeys: []string{"r-key"}, Roles: []string{"reader"}},
+		{Name: "app", APIKeys: []string{"w-key"}, Roles: []string{"writer"}},
+		{Name: "cluster", APIKeys: []string{"p-key"}, Roles: []string{"peer"}},
+	}, secret, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer()
+	server.access = access
+	server.adminToken = "admin-token"
+
+	adminJWT, _ := signJWT(JWTClaims{Roles: roleNames{"admin"}, Expires: time.Now().Add(time.Minute).Unix()}, secret)
+	expired, _ := signJWT(JWTClaims{Roles: roleNames{"admin"}, Expires: time.Now().Add(-time.Minute).Unix()}, secret)
+	forged, _ := signJWT(JWTClaims{Roles: roleNames{"admin"}}, []byte("other"))
+
+	for _, tc := range []struct {
+		method, path, key string
+		want              int
+	}{
+		{http.MethodGet, "/healthz", "", http.StatusOK},
+		{http.MethodGet, "/time", "", http.StatusUnauthorized},
+		{http.MethodGet, "/time", "r-key", http.StatusOK},
+		{http.MethodGet, "/time", "unknown", http.StatusUnauthorized},
+		{http.MethodPost, "/event?message=x", "r-key", http.StatusForbidden},
+		{http.MethodPost, "/event?message=x", "w-key", http.StatusOK},
+		{http.MethodPost, "/message?timestamp=1&message=x", "w-key", http.StatusForbidden},
+		{http.MethodPost, "/message?timestamp=1&message=x", "p-key", http.StatusOK},
+		{http.MethodPost, "/event?message=x", "p-key", http.StatusForbidden},
+		{http.MethodGet, "/admin/tenants", "w-key", http.StatusForbidden},
+		{http.MethodGet, "/admin/tenants", "admin-token", http.StatusOK},
+		{http.MethodGet, "/admin/tenants", adminJWT, http.StatusOK},
+		{http.MethodPost, "/event?message=x", adminJWT, http.StatusOK},
+		{http.MethodGet, "/time", expired, http.StatusUnauthorized},
+		{http.MethodGet, "/time", forged, http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		if tc.key != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.key)
+		}
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s %s with %q: expected %d, got %d %s", tc.method, tc.path, tc.key, tc.want, rec.Code, rec.Body)
+		}
+	}
+
+	// Peers present their token
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	peers := NewPeers([]string{ts.URL}, http.DefaultClient)
+	peers.token = "p-key"
+	if _, err := peers.Do(t.Context(), ts.URL, http.MethodPost, "/message?timestamp=5&message=y", nil, nil); err != nil {
+		t.Errorf("Expected the peer token accepted, got %v", err)
+	}
+
+	// Anonymous callers get the configured roles
+	server.access.anonymous = RoleReader
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/time", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected anonymous reads allowed, got %d", rec.Code)
+	}
+}
+
+func TestAdminDenyDefault(t *testing.T) {
+	server := NewServer()
+	server.denyAdmin = true
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/tenants", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected admin endpoints refused without a token, got %d", rec.Code)
+	}
+	server.adminToken = "secret"
+	req := httptest.NewRequest(http.MethodGet, "/admin/tenants", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected the admin token accepted, got %d", rec.Code)
+	}
+}
+
+func TestJWT(t *testing.T) {
+	secret := []byte("s")
+	token, _ := signJWT(map[string]any{"sub": "ada", "roles": "reader peer", "nbf": time.Now().Add(time.Hour).Unix()}, secret)
+	if _, err := parseJWT(token, secret, time.Now()); err == nil {
+		t.Error("Expected a token not yet valid refused")
+	}
+	claims, err := parseJWT(token, secret, time.Now().Add(2*time.Hour))
+	if err != nil || claims.Subject != "ada" || len(claims.Roles) != 2 {
+		t.Errorf("Expected the claims decoded, got %+v (err: %v)", claims, err)
+	}
+	if roles, _ := parseRoles(claims.Roles); roles.String() != "reader,peer" {
+		t.Errorf("Expected reader and peer, got %s", roles)
+	}
+}
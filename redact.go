@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+)
+
+// defaultRedaction replaces redacted values unless a rule names another
+const defaultRedaction = "[REDACTED]"
+
+// RedactionRule describes a rule of the redaction file. A rule with a
+// pattern replaces what the regular expression matches in the message,
+// in metadata values and in the strings of the payload; a rule with fields
+// replaces the whole value of payload fields and metadata labels of those
+// names, at any depth.
+type RedactionRule struct {
+	Name        string   `json:"name"`
+	Pattern     string   `json:"pattern,omitempty"`
+	Fields      []string `json:"fields,omitempty"`
+	Replacement string   `json:"replacement,omitempty"`
+}
+
+type redactionRule struct {
+	name        string
+	pattern     *regexp.Regexp
+	fields      []string
+	replacement string
+}
+
+// Redactor removes personal data from events before they are stored, so
+// the log and everything exported from it, such as /events, archived
+// segments, webhooks and broker messages, can be shared without it. Each
+// redaction is counted per rule.
+type Redactor struct {
+	rules   []redactionRule
+	metrics *Metrics
+}
+
+// LoadRedactor reads a JSON array of RedactionRule
+func LoadRedactor(path string, metrics *Metrics) (*Redactor, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []RedactionRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid redaction file: %w", err)
+	}
+	return NewRedactor(rules, metrics)
+}
+
+// NewRedactor validates the rules and compiles their patterns
+func NewRedactor(rules []RedactionRule, metrics *Metrics) (*Redactor, error) {
+	metrics.Counter("lamport_redactions_total", "Values redacted from events before they were stored")
+
+	r := &Redactor{metrics: metrics}
+	names := make(map[string]bool)
+	for _, rule := range rules {
+		if rule.Name == "" || names[rule.Name] {
+			return nil, fmt.Errorf("missing or duplicate redaction rule name %q", rule.Name)
+		}
+		names[rule.Name] = true
+		if (rule.Pattern == "") == (len(rule.Fields) == 0) {
+			return nil, fmt.Errorf("redaction rule %s needs either a pattern or fields", rule.Name)
+		}
+		compiled := redactionRule{name: rule.Name, fields: rule.Fields, replacement: rule.Replacement}
+		if compiled.replacement == "" {
+			compiled.replacement = defaultRedaction
+		}
+		if rule.Pattern != "" {
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("redaction rule %s: %w", rule.Name, err)
+			}
+			compiled.pattern = pattern
+		}
+		r.rules = append(r.rules, compiled)
+	}
+	return r, nil
+}
+
+// Redact returns the event with the rules applied. Values already redacted
+// are not counted again. A nil Redactor leaves events alone.
+func (r *Redactor) Redact(e Event) Event {
+	if r == nil {
+		return e
+	}
+	for _, rule := range r.rules {
+		count := 0
+		if rule.pattern != nil {
+			e.Message = rule.replace(e.Message, &count)
+		}
+		if len(e.Metadata) > 0 {
+			metadata := make(map[string]string, len(e.Metadata))
+			for k, v := range e.Metadata {
+				if slices.Contains(rule.fields, k) {
+					if v != rule.replacement {
+						v = rule.replacement
+						count++
+					}
+				} else if rule.pattern != nil {
+					v = rule.replace(v, &count)
+				}
+				metadata[k] = v
+			}
+			e.Metadata = metadata
+		}
+		if len(e.Payload) > 0 {
+			// Numbers are kept as written rather than turned into floats
+			var payload any
+			decoder := json.NewDecoder(bytes.NewReader(e.Payload))
+			decoder.UseNumber()
+			if decoder.Decode(&payload) == nil {
+				before := count
+				payload = rule.redactJSON(payload, &count)
+				if count > before {
+					var buf bytes.Buffer
+					encoder := json.NewEncoder(&buf)
+					encoder.SetEscapeHTML(false)
+					encoder.Encode(payload)
+					e.Payload = bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+				}
+			}
+		}
+		if count > 0 {
+			r.metrics.Add("lamport_redactions_total", float64(count), "rule", rule.name)
+		}
+	}
+	return e
+}
+
+// replace applies the pattern to s, adding the matches to count
+func (rule redactionRule) replace(s string, count *int) string {
+	matches := rule.pattern.FindAllStringIndex(s, -1)
+	if len(matches) == 0 {
+		return s
+	}
+	*count += len(matches)
+	return rule.pattern.ReplaceAllLiteralString(s, rule.replacement)
+}
+
+// redactJSON applies the rule to a decoded JSON value
+func (rule redactionRule) redactJSON(v any, count *int) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, field := range v {
+			if slices.Contains(rule.fields, k) {
+				if field != rule.replacement {
+					v[k] = rule.replacement
+					*count++
+				}
+			} else {
+				v[k] = rule.redactJSON(field, count)
+			}
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = rule.redactJSON(item, count)
+		}
+	case string:
+		if rule.pattern != nil {
+			return rule.replace(v, count)
+		}
+	}
+	return v
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRedactor(t *testing.T) {
+	metrics := NewMetrics()
+	r, err := NewRedactor([]RedactionRule{
+		{Name: "email", Pattern: `[\w.+-]+@[\w-]+\.[\w.]+`, Replacement: "<email>"},
+		{Name: "card", Fields: []string{"card_number", "ssn"}},
+	}, metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := r.Redact(Event{
+		ID:       "e1",
+		Message:  "signup from ada@example.com and bob@example.org",
+		Payload:  json.RawMessage(`{"user":{"contact":"ada@example.com","card_number":"4111"},"items":[{"ssn":"123"}],"count":12345678901234567}`),
+		Metadata: map[string]string{"ssn": "123", "by": "carol@example.net"},
+	})
+	if e.Message != "signup from <email> and <email>" {
+		t.Errorf("Expected the addresses redacted, got %q", e.Message)
+	}
+	want := `{"count":12345678901234567,"items":[{"ssn":"[REDACTED]"}],"user":{"card_number":"[REDACTED]","contact":"<email>"}}`
+	if string(e.Payload) != want {
+		t.Errorf("Expected payload %s, got %s", want, e.Payload)
+	}
+	if e.Metadata["ssn"] != "[REDACTED]" || e.Metadata["by"] != "<email>" {
+		t.Errorf("Expected the metadata redacted, got %v", e.Metadata)
+	}
+	if n := metrics.Value("lamport_redactions_total", "rule", "email"); n != 4 {
+		t.Errorf("Expected 4 email redactions counted, got %v", n)
+	}
+	if n := metrics.Value("lamport_redactions_total", "rule", "card"); n != 3 {
+		t.Errorf("Expected 3 field redactions counted, got %v", n)
+	}
+
+	// Redacting again changes and counts nothing
+	if again := r.Redact(e); string(again.Payload) != want || metrics.Value("lamport_redactions_total", "rule", "card") != 3 {
+		t.Errorf("Expected a redacted event left alone, got %s", again.Payload)
+	}
+
+	// Payloads without matches are kept byte for byte
+	if e := r.Redact(Event{Payload: json.RawMessage(`{"b": 1, "a": 2}`)}); string(e.Payload) != `{"b": 1, "a": 2}` {
+		t.Errorf("Expected the payload untouched, got %s", e.Payload)
+	}
+
+	for _, rules := range [][]RedactionRule{
+		{{Name: "x"}},
+		{{Name: "x", Pattern: "a", Fields: []string{"b"}}},
+		{{Name: "x", Pattern: "("}},
+		{{Name: "x", Pattern: "a"}, {Name: "x", Pattern: "b"}},
+	} {
+		if _, err := NewRedactor(rules, NewMetrics()); err == nil {
+			t.Errorf("Expected %+v refused", rules)
+		}
+	}
+}
+
+func TestRedactedLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redaction.json")
+	os.WriteFile(path, []byte(`[{"name":"phone","pattern":"\\+?[0-9][0-9 -]{7,}[0-9]"}]`), 0o600)
+	server := NewServer()
+	var err error
+	if server.pii, err = LoadRedactor(path, server.metrics); err != nil {
+		t.Fatal(err)
+	}
+
+	event := server.logEvent("e1", "call +44 20 7946 0958 back")
+	stored, _ := server.events.Find("e1")
+	if event.Message != "call [REDACTED] back" || stored.Message != event.Message {
+		t.Errorf("Expected the phone number redacted before storing, got %q and %q", event.Message, stored.Message)
+	}
+	if brk := verifyChain(server.events.Events()); brk != nil {
+		t.Errorf("Expected the chain over the redacted event to verify, got %+v", brk)
+	}
+}
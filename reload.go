@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+// Reloader re-reads the configuration, from the command line and the
+// config file, and applies the flags that can change while the server
+// runs: the peer list, the rate limit, the age of rolled up or archived
+// events and the log level. Other changes wait for a restart, which would
+// lose the in-memory clock.
+type Reloader struct {
+	server   *Server
+	args     []string
+	flags    map[string]string // values in effect
+	level    *slog.LevelVar
+	rollups  *Rollups  // nil when events are not rolled up
+	archiver *Archiver // nil when events are not archived
+	mutex    sync.Mutex
+}
+
+// NewReloader reloads the configuration cfg was parsed from args into
+func NewReloader(server *Server, args []string, cfg *Config, level *slog.LevelVar) *Reloader {
+	return &Reloader{server: server, args: args, flags: maps.Clone(cfg.flags), level: level}
+}
+
+// Reload parses the configuration again and applies the flags that
+// changed, listing those applied and those that need a restart. An
+// invalid configuration changes nothing.
+func (rl *Reloader) Reload() (applied, restart []string, err error) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	cfg, err := parseConfig(rl.args)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := parseLogLevel(cfg.LogLevel); err != nil {
+		return nil, nil, err
+	}
+	applied, restart = []string{}, []string{}
+	for _, name := range slices.Sorted(maps.Keys(cfg.flags)) {
+		previous, value := rl.flags[name], cfg.flags[name]
+		if previous == value {
+			continue
+		}
+		if !rl.apply(name, previous, cfg) {
+			restart = append(restart, name)
+			continue
+		}
+		rl.flags[name] = value
+		applied = append(applied, name)
+		rl.server.logger.Info("Configuration reloaded", "flag", name, "previous", previous, "value", value)
+	}
+	if len(restart) > 0 {
+		rl.server.logger.Warn("Configuration changes need a restart", "flags", restart)
+	}
+	return applied, restart, nil
+}
+
+// apply applies the new value of a flag and reports whether it could
+func (rl *Reloader) apply(name, previous string, cfg *Config) bool {
+	s := rl.server
+	switch name {
+	case "peers":
+		// Peers that joined at runtime are left alone
+		if s.peers == nil {
+			return false
+		}
+		listed := splitList(cfg.flags[name])
+		for _, u := range splitList(previous) {
+			if !slices.Contains(listed, u) {
+				s.peers.Remove(u)
+			}
+		}
+		for _, u := range listed {
+			s.peers.Add(u)
+		}
+	case "rate-limit", "rate-burst":
+		if s.limiter == nil {
+			return false
+		}
+		s.limiter.SetLimit(cfg.RateLimit, cfg.RateBurst)
+	case "rollup-age":
+		// Turning rollups on or off starts or stops a worker
+		if rl.rollups == nil || cfg.RollupAge == 0 {
+			return false
+		}
+		rl.rollups.SetAge(cfg.RollupAge)
+	case "archive-age":
+		if rl.archiver == nil {
+			return false
+		}
+		rl.archiver.SetAge(cfg.ArchiveAge)
+	case "features":
+		listed := cfg.Features
+		for _, f := range knownFeatures {
+			if !f.Runtime && slices.Contains(listed, f.Name) != s.features.Enabled(f.Name) {
+				return false
+			}
+		}
+		for _, f := range knownFeatures {
+			if f.Runtime {
+				s.features.Set(f.Name, slices.Contains(listed, f.Name))
+			}
+		}
+	case "log-level":
+		level, _ := parseLogLevel(cfg.LogLevel)
+		rl.level.Set(level)
+	default:
+		return false
+	}
+	return true
+}
+
+// handleReload reloads the configuration, POST /admin/reload
+func (rl *Reloader) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	applied, restart, err := rl.Reload()
+	if err != nil {
+		http.Error(w, "Invalid configuration: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"applied":          applied,
+		"restart_required": restart,
+	})
+}
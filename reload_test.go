@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lamport.json")
+	os.WriteFile(path, []byte(`{"peers":["http://b:8080","http://c:8080"],"rate-limit":5,"log-level":"debug","node-id":"from-file"}`), 0o600)
+	cfg, err := parseConfig([]string{"-config", path, "-node-id", "from-flag"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Peers) != 2 || cfg.RateLimit != 5 || cfg.LogLevel != "debug" {
+		t.Errorf("Expected the file applied, got %+v", cfg)
+	}
+	if cfg.NodeID != "from-flag" {
+		t.Errorf("Expected the command line to take precedence, got %s", cfg.NodeID)
+	}
+
+	os.WriteFile(path, []byte(`{"no-such-flag":1}`), 0o600)
+	if _, err := parseConfig([]string{"-config", path}); err == nil {
+		t.Error("Expected an unknown flag refused")
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lamport.json")
+	os.WriteFile(path, []byte(`{"peers":"http://b:8080","rate-limit":1,"rate-burst":1,"log-level":"info"}`), 0o600)
+	args := []string{"-config", path}
+	cfg, err := parseConfig(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer()
+	server.peers = NewPeers(cfg.Peers, http.DefaultClient)
+	server.peers.Add("http://joined:8080")
+	server.limiter = NewRateLimiter(cfg.RateLimit, cfg.RateBurst, false)
+	level := new(slog.LevelVar)
+	reloader := NewReloader(server, args, cfg, level)
+	server.HandleFunc("/admin/reload", server.admin(reloader.handleReload))
+
+	os.WriteFile(path, []byte(`{"peers":"http://c:8080","rate-limit":100,"rate-burst":50,"log-level":"debug","addr":":9090"}`), 0o600)
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/reload", nil))
+	var result struct {
+		Applied []string `json:"applied"`
+		Restart []string `json:"restart_required"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	if !slices.Equal(result.Applied, []string{"log-level", "peers", "rate-burst", "rate-limit"}) || !slices.Equal(result.Restart, []string{"addr"}) {
+		t.Fatalf("Unexpected reload result: %s", rec.Body)
+	}
+	if urls := server.peers.URLs(); !slices.Equal(urls, []string{"http://joined:8080", "http://c:8080"}) {
+		t.Errorf("Expected the listed peer replaced and the joined one kept, got %v", urls)
+	}
+	if level.Level() != slog.LevelDebug {
+		t.Errorf("Expected the debug level, got %s", level.Level())
+	}
+	server.limiter.Allow("client")
+	if ok, _ := server.limiter.Allow("client"); !ok {
+		t.Error("Expected the new burst applied")
+	}
+
+	// Nothing changed since, and a broken file changes nothing
+	if applied, restart, err := reloader.Reload(); err != nil || len(applied) != 0 || len(restart) != 1 {
+		t.Errorf("Expected only the pending restart, got %v %v (err: %v)", applied, restart, err)
+	}
+	os.WriteFile(path, []byte(`{"log-level":"loud"}`), 0o600)
+	if _, _, err := reloader.Reload(); err == nil || level.Level() != slog.LevelDebug {
+		t.Error("Expected an invalid log level refused")
+	}
+}
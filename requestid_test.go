@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	server := NewServer()
+	handler := withRequestID(http.HandlerFunc(server.handleCreateEvent))
+
+	// A client supplied ID is echoed and recorded on the event
+	req := httptest.NewRequest("POST", "/event?message=traced", nil)
+	req.Header.Set("X-Request-ID", "client-42")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if got := w.Header().Get("X-Request-ID"); got != "client-42" {
+		t.Errorf("Expected request ID to be echoed, got %q", got)
+	}
+	var event Event
+	json.NewDecoder(w.Body).Decode(&event)
+	if event.RequestID != "client-42" {
+		t.Errorf("Expected event to carry request ID, got %q", event.RequestID)
+	}
+
+	// Without a header an ID is generated
+	req2 := httptest.NewRequest("POST", "/event", nil)
+	w2 := httptest.NewRecorder()
+	handler.ServeHTTP(w2, req2)
+	generated := w2.Header().Get("X-Request-ID")
+	if len(generated) != 32 {
+		t.Errorf("Expected a generated 32 character ID, got %q", generated)
+	}
+
+	// Malformed IDs are replaced
+	req3 := httptest.NewRequest("POST", "/event", nil)
+	req3.Header.Set("X-Request-ID", "bad id\twith spaces")
+	w3 := httptest.NewRecorder()
+	handler.ServeHTTP(w3, req3)
+	if got := w3.Header().Get("X-Request-ID"); strings.ContainsAny(got, " \t") {
+		t.Errorf("Expected malformed ID to be replaced, got %q", got)
+	}
+}
+
+func TestRequestIDOnReceivedMessages(t *testing.T) {
+	server := NewServer()
+	handler := withRequestID(http.HandlerFunc(server.handleQueueMessage))
+
+	send := func(id, query string) {
+		req := httptest.NewRequest("POST", "/queue?"+query, nil)
+		req.Header.Set("X-Request-ID", id)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// The buffered message keeps the ID of the request that carried it
+	send("second", "sender=p&timestamp=4&prev=2&message=b")
+	send("first", "sender=p&timestamp=2&message=a")
+
+	if server.events.Len() != 2 {
+		t.Fatalf("Expected 2 delivered events, got %d", server.events.Len())
+	}
+	if server.events.Events()[0].RequestID != "first" || server.events.Events()[1].RequestID != "second" {
+		t.Errorf("Expected request IDs first and second, got %q and %q",
+			server.events.Events()[0].RequestID, server.events.Events()[1].RequestID)
+	}
+}
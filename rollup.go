@@ -0,0 +1,200 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rollup sums up the events trimmed off the log whose timestamps fall in
+// [Start, End) of an epoch
+type Rollup struct {
+	Epoch        int64     `json:"epoch"`
+	Start        int64     `json:"start"`
+	End          int64     `json:"end"`
+	Count        int       `json:"count"`
+	MinTimestamp int64     `json:"min_timestamp"`
+	MaxTimestamp int64     `json:"max_timestamp"`
+	FirstWall    time.Time `json:"first_wall_time"`
+	LastWall     time.Time `json:"last_wall_time"`
+}
+
+// add counts an event into the rollup
+func (r *Rollup) add(e Event) {
+	if r.Count == 0 || e.Timestamp < r.MinTimestamp {
+		r.MinTimestamp = e.Timestamp
+	}
+	if r.Count == 0 || e.Timestamp > r.MaxTimestamp {
+		r.MaxTimestamp = e.Timestamp
+	}
+	if r.Count == 0 || e.WallTime.Before(r.FirstWall) {
+		r.FirstWall = e.WallTime
+	}
+	if r.Count == 0 || e.WallTime.After(r.LastWall) {
+		r.LastWall = e.WallTime
+	}
+	r.Count++
+}
+
+// Rollups keeps long running logs small: events older than age are
+// trimmed off the log in the background and only counted, per bucket of
+// width timestamps. Recent events stay in full.
+type Rollups struct {
+	server  *Server
+	age     time.Duration
+	width   int64
+	buckets map[bucketKey]*Rollup
+	mutex   sync.RWMutex
+}
+
+// NewRollups rolls up the events of a server older than age into buckets
+// of width timestamps
+func NewRollups(server *Server, age time.Duration, width int64) *Rollups {
+	server.metrics.Counter("lamport_events_rolled_up_total", "Events trimmed off the log into rollups")
+	return &Rollups{
+		server:  server,
+		age:     age,
+		width:   width,
+		buckets: make(map[bucketKey]*Rollup),
+	}
+}
+
+// Roll trims the events logged before now minus the age off the log and
+// adds them to the rollups. The log is trimmed from its oldest event up to
+// the first recent one, so an event with a wall time out of order stops
+// the trim rather than leaving a hole.
+func (ru *Rollups) Roll(now time.Time) int {
+	s := ru.server
+	cutoff := now.Add(-ru.Age())
+	s.mutex.Lock()
+	events := s.events.Events()
+	n := 0
+	for n < len(events) && events[n].WallTime.Before(cutoff) {
+		n++
+	}
+	trimmed, err := trimChecked(s.events, n)
+	s.mutex.Unlock()
+	if err != nil {
+		s.logger.Error("Failed to roll events up", "error", err)
+		return 0
+	}
+	if len(trimmed) == 0 {
+		return 0
+	}
+
+	ru.mutex.Lock()
+	for _, e := range trimmed {
+		key := bucketKey{Epoch: e.Epoch, Start: e.Timestamp - e.Timestamp%ru.width}
+		r, ok := ru.buckets[key]
+		if !ok {
+			r = &Rollup{Epoch: key.Epoch, Start: key.Start, End: key.Start + ru.width}
+			ru.buckets[key] = r
+		}
+		r.add(e)
+	}
+	ru.mutex.Unlock()
+
+	s.metrics.Add("lamport_events_rolled_up_total", float64(len(trimmed)))
+	s.logger.Info("Events rolled up", "count", len(trimmed), "before", cutoff)
+	return len(trimmed)
+}
+
+// Between returns the rollups of buckets overlapping the times from to to,
+// inclusive, in order
+func (ru *Rollups) Between(from, to ClockTime) []Rollup {
+	ru.mutex.RLock()
+	rollups := []Rollup{}
+	for _, r := range ru.buckets {
+		if !(ClockTime{Epoch: r.Epoch, Timestamp: r.MaxTimestamp}).Before(from) &&
+			!to.Before(ClockTime{Epoch: r.Epoch, Timestamp: r.MinTimestamp}) {
+			rollups = append(rollups, *r)
+		}
+	}
+	ru.mutex.RUnlock()
+	slices.SortFunc(rollups, func(a, b Rollup) int {
+		return cmp.Or(cmp.Compare(a.Epoch, b.Epoch), cmp.Compare(a.Start, b.Start))
+	})
+	return rollups
+}
+
+// Age returns how old events are when they are rolled up
+func (ru *Rollups) Age() time.Duration {
+	ru.mutex.RLock()
+	defer ru.mutex.RUnlock()
+	return ru.age
+}
+
+// SetAge changes the age of the events rolled up from the next run on
+func (ru *Rollups) SetAge(age time.Duration) {
+	ru.mutex.Lock()
+	defer ru.mutex.Unlock()
+	ru.age = age
+}
+
+// Run rolls up every interval until ctx is done
+func (ru *Rollups) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			ru.Roll(now)
+		}
+	}
+}
+
+// handleRollups lists the rollups, GET /events/rollups, or those
+// overlapping a range of timestamps, GET /events/rollups/<from>/<to>
+// [?epoch=<e>], with the oldest time still kept in full
+func (ru *Rollups) handleRollups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s := ru.server
+	from, to := ClockTime{}, ClockTime{Epoch: math.MaxInt64, Timestamp: math.MaxInt64}
+	if rest := strings.TrimPrefix(r.URL.Path, "/events/rollups"); rest != "" {
+		fromPath, toPath, found := strings.Cut(strings.TrimPrefix(rest, "/"), "/")
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+		var ok bool
+		if from, ok = s.parseEventTime(w, r, fromPath); !ok {
+			return
+		}
+		if to, ok = s.parseEventTime(w, r, toPath); !ok {
+			return
+		}
+		if to.Before(from) {
+			http.Error(w, "Invalid range, to is before from", http.StatusBadRequest)
+			return
+		}
+	}
+
+	rollups := ru.Between(from, to)
+	total := 0
+	for _, rollup := range rollups {
+		total += rollup.Count
+	}
+	response := map[string]interface{}{
+		"bucket_width": ru.width,
+		"age":          ru.Age().String(),
+		"rolled_up":    total,
+		"rollups":      rollups,
+		"events_kept":  s.events.Len(),
+	}
+	if events := s.events.Events(); len(events) > 0 {
+		response["oldest_kept"] = events[0].clockTime()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRollupsTrimOldEvents(t *testing.T) {
+	server := NewServer()
+	ru := NewRollups(server, time.Hour, 10)
+	now := time.Now()
+	for i, age := range []time.Duration{3 * time.Hour, 2 * time.Hour, 2 * time.Hour, time.Minute, 3 * time.Hour, 0} {
+		ts := []int64{3, 8, 12, 15, 16, 17}[i]
+		server.appendEvent(Event{ID: "e" + strconv.FormatInt(ts, 10), Timestamp: ts, WallTime: now.Add(-age)})
+	}
+
+	// The event of a minute ago stops the trim, old as the next one is
+	if n := ru.Roll(now); n != 3 {
+		t.Fatalf("Expected 3 events rolled up, got %d", n)
+	}
+	rollups := ru.Between(ClockTime{}, ClockTime{Timestamp: 100})
+	if len(rollups) != 2 || rollups[0].Count != 2 || rollups[0].MinTimestamp != 3 || rollups[0].MaxTimestamp != 8 ||
+		rollups[1].Start != 10 || rollups[1].End != 20 || rollups[1].Count != 1 {
+		t.Errorf("Expected 2 events in [0, 10) and 1 in [10, 20), got %+v", rollups)
+	}
+	if len(ru.Between(ClockTime{Timestamp: 9}, ClockTime{Timestamp: 11})) != 0 {
+		t.Error("Expected no rollup between 9 and 11")
+	}
+	if verified := verifyLog(t, server); verified["valid"] != true || verified["dropped_count"] != float64(3) {
+		t.Errorf("Expected the kept events to verify, got %v", verified)
+	}
+
+	// Later events of a bucket are added to it
+	ru.Roll(now.Add(2 * time.Hour))
+	rollups = ru.Between(ClockTime{}, ClockTime{Timestamp: 100})
+	if len(rollups) != 2 || rollups[1].Count != 4 || rollups[1].MaxTimestamp != 17 || server.events.Len() != 0 {
+		t.Errorf("Expected every event rolled up, got %+v", rollups)
+	}
+}
+
+func TestHandleRollups(t *testing.T) {
+	server := NewServer()
+	ru := NewRollups(server, time.Hour, 100)
+	server.logEvent("e1", "One")
+	ru.Roll(time.Now().Add(2 * time.Hour))
+	server.logEvent("e2", "Two")
+
+	get := func(path string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		ru.handleRollups(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var response map[string]interface{}
+		json.NewDecoder(w.Body).Decode(&response)
+		return w, response
+	}
+	if w, response := get("/events/rollups"); w.Code != http.StatusOK || response["rolled_up"] != float64(1) || response["events_kept"] != float64(1) {
+		t.Errorf("Expected e1 rolled up and e2 kept, got %d %v", w.Code, response)
+	}
+	if _, response := get("/events/rollups/2/50"); response["rolled_up"] != float64(0) {
+		t.Errorf("Expected no rollup from 2, got %v", response)
+	}
+	for _, path := range []string{"/events/rollups/5/1", "/events/rollups/x/2", "/events/rollups/1/2?epoch=-1"} {
+		if w, _ := get(path); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", path, w.Code)
+		}
+	}
+}
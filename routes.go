@@ -0,0 +1,162 @@
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+// ServeHTTP serves the API of the server, so it can be mounted in another
+// application, under a prefix with http.StripPrefix
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Handle registers a handler on the server's mux, under the server's
+// prefix. Callers lacking the role of the endpoint are refused before
+// anything else. Requests carrying clock headers or session tokens advance
+// the clock first, and requests from partitioned peers are dropped. The
+// propagation delay of requests from peers is recorded before their
+// timestamps move the clock.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	handler = s.withAccess(pattern, s.withPartition(s.withSessionToken(s.withPropagation(s.withClockContext(pattern, handler)))))
+	if s.prefix != "" {
+		handler = http.StripPrefix(s.prefix, handler)
+	}
+	s.mux.Handle(s.prefix+pattern, handler)
+}
+
+// HandleFunc registers a handler function on the server's mux, as Handle
+func (s *Server) HandleFunc(pattern string, handler http.HandlerFunc) {
+	s.Handle(pattern, handler)
+}
+
+// registerRoutes serves the endpoints backed by the server alone. The rate
+// limit, ingestion queue, admin token and peer certificates are looked up
+// per request, so they can be set up after the server is created.
+func (s *Server) registerRoutes() {
+	s.HandleFunc("/event", s.limit(s.admit(s.handleCreateEvent)))
+	s.HandleFunc("/message", s.limit(s.admit(s.fromPeer(s.handleReceiveMessage))))
+	s.HandleFunc("/events", s.handleGetEvents)
+	s.HandleFunc("/events/stream", s.handleStreamEvents)
+	s.HandleFunc("/events/graph", s.handleEventGraph)
+	s.HandleFunc("/events/verify", s.handleVerifyEvents)
+	s.HandleFunc("/events/root", s.handleMerkleRoot)
+	s.HandleFunc("/events/at/", s.handleEventsAt)
+	s.HandleFunc("/events/range/", s.handleEventsRange)
+	s.HandleFunc("/events/search", s.handleSearchEvents)
+	s.HandleFunc("/events/", s.handleEvent)
+	s.HandleFunc("/compare", s.handleCompare)
+	s.HandleFunc("/cluster/events", s.handleClusterEvents)
+	s.HandleFunc("/broadcast", s.limit(s.handleBroadcast))
+	s.HandleFunc("/time", s.handleGetTime)
+	s.HandleFunc("/clock/history", s.handleClockHistory)
+	s.HandleFunc("/analytics/skew", s.handleSkew)
+	s.HandleFunc("/analytics/propagation", s.handlePropagation)
+	s.HandleFunc("/analytics/summary", s.handleSummary)
+	s.HandleFunc("/analytics/memory", s.handleMemory)
+	s.graphql = newGraphQLSchema(s)
+	s.HandleFunc("/graphql", s.handleGraphQL)
+	s.HandleFunc("/metrics", s.handleMetrics)
+	s.HandleFunc("/healthz", s.handleHealthz)
+	s.HandleFunc("/openapi.json", handleOpenAPI)
+	s.HandleFunc("/readyz", s.handleReadyz)
+	s.HandleFunc("/schemas", s.limit(s.handleSchemas))
+	s.HandleFunc("/kv/", s.limit(s.handleKV))
+	s.HandleFunc("/peer/kv", s.limit(s.fromPeer(s.handlePeerKV)))
+	s.HandleFunc("/clocks", s.handleListClocks)
+	s.HandleFunc("/clocks/", s.limit(s.handleClock))
+	s.HandleFunc("/queue", s.limit(s.fromPeer(s.handleQueueMessage)))
+	s.HandleFunc("/queue/pending", s.handleQueuePending)
+	s.Handle("/ui/", uiHandler())
+	s.HandleFunc("/admin/import", s.admin(s.handleImport))
+	s.HandleFunc("/admin/clock/reset", s.admin(s.handleClockReset))
+	s.HandleFunc("/admin/clock/set", s.admin(s.handleClockSet))
+	s.HandleFunc("/admin/clock/advance", s.admin(s.handleClockAdvance))
+	s.HandleFunc("/admin/clock/freeze", s.admin(s.handleClockFreeze))
+	s.HandleFunc("/admin/clock/resume", s.admin(s.handleClockResume))
+	s.HandleFunc("/admin/tenants", s.admin(s.handleTenants))
+	s.HandleFunc("/admin/partition", s.admin(s.handlePartition))
+	s.HandleFunc("/admin/heal", s.admin(s.handleHeal))
+	s.HandleFunc("/admin/chaos", s.admin(s.handleChaos))
+	s.HandleFunc("/admin/replay", s.admin(s.handleReplay))
+	s.HandleFunc("/admin/audit", s.admin(s.handleAudit))
+	s.HandleFunc("/admin/features", s.admin(s.handleFeatures))
+	s.registerClockService()
+}
+
+// registerProfiling serves the runtime profiles of net/http/pprof to the
+// admin: the index of profiles under /debug/pprof/, a CPU profile and an
+// execution trace of the next seconds, the command line and symbols. The
+// package's own handlers on http.DefaultServeMux are never served.
+func (s *Server) registerProfiling() {
+	s.HandleFunc("/debug/pprof/", s.admin(pprof.Index))
+	s.HandleFunc("/debug/pprof/cmdline", s.admin(pprof.Cmdline))
+	s.HandleFunc("/debug/pprof/profile", s.admin(pprof.Profile))
+	s.HandleFunc("/debug/pprof/symbol", s.admin(pprof.Symbol))
+	s.HandleFunc("/debug/pprof/trace", s.admin(pprof.Trace))
+}
+
+// limit applies the per client rate limit, when one is set
+func (s *Server) limit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.limiter == nil {
+			next(w, r)
+			return
+		}
+		s.limiter.Limit(s.metrics, next)(w, r)
+	}
+}
+
+// admit queues appends in the ingestion queue, when one is set
+func (s *Server) admit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.ingest == nil {
+			next(w, r)
+			return
+		}
+		s.ingest.Admit(next)(w, r)
+	}
+}
+
+// admin requires the admin role when access is role based, and otherwise
+// the admin token when one is set. Without either, admin endpoints are
+// open unless they deny by default. Requests that may change state are
+// recorded in the audit log, refused ones included.
+func (s *Server) admin(next http.HandlerFunc) http.HandlerFunc {
+	return s.audited(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case s.access != nil:
+			s.requireRole(RoleAdmin, next)(w, r)
+		case s.adminToken == "" && s.denyAdmin:
+			http.Error(w, "Forbidden: admin endpoints are disabled", http.StatusForbidden)
+		default:
+			requireAdmin(s.adminToken, next)(w, r)
+		}
+	})
+}
+
+// fromPeer requires the peer role on inter-node endpoints when access is
+// role based, and otherwise a verified client certificate when mTLS is
+// configured
+func (s *Server) fromPeer(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.access != nil {
+			s.requireRole(RolePeer, next)(w, r)
+			return
+		}
+		if !s.peerCerts {
+			next(w, r)
+			return
+		}
+		requireClientCert(next)(w, r)
+	}
+}
+
+// isPeer reports whether fromPeer would let r through
+func (s *Server) isPeer(r *http.Request) bool {
+	if s.access != nil {
+		roles, err := s.roles(r)
+		return err == nil && roles&RolePeer != 0
+	}
+	return !s.peerCerts || (r.TLS != nil && len(r.TLS.VerifiedChains) > 0)
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxScheduledEvents bounds the events waiting for their time
+const maxScheduledEvents = 10000
+
+var (
+	// ErrNotInFuture is returned for events scheduled at a time the clock
+	// already reached
+	ErrNotInFuture = errors.New("deliver_at_ts must be after the current time")
+	// ErrScheduleFull is returned when too many events are scheduled
+	ErrScheduleFull = errors.New("too many scheduled events")
+)
+
+// ScheduledEvent is an event to be logged once the clock reaches
+// DeliverAt in Epoch. It is then stamped like any local event, so its
+// timestamp is after DeliverAt.
+type ScheduledEvent struct {
+	ID            string            `json:"id"`
+	DeliverAt     int64             `json:"deliver_at_ts"`
+	Epoch         int64             `json:"epoch"`
+	Message       string            `json:"message"`
+	Type          string            `json:"type,omitempty"`
+	SchemaVersion int               `json:"schema_version,omitempty"`
+	Payload       json.RawMessage   `json:"payload,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+	ScheduledAt   ClockTime         `json:"scheduled_at"` // time of the clock when it was scheduled
+	RequestID     string            `json:"request_id,omitempty"`
+
+	seq   int64 // orders events scheduled at the same time
+	index int   // position in the heap
+}
+
+func (e *ScheduledEvent) at() ClockTime {
+	return ClockTime{Epoch: e.Epoch, Timestamp: e.DeliverAt}
+}
+
+// before orders scheduled events by time, then by when they were scheduled
+func (e *ScheduledEvent) before(other *ScheduledEvent) bool {
+	if c := e.at().Compare(other.at()); c != 0 {
+		return c < 0
+	}
+	return e.seq < other.seq
+}
+
+// scheduleHeap is a priority queue of scheduled events, the next one first
+type scheduleHeap []*ScheduledEvent
+
+func (h scheduleHeap) Len() int           { return len(h) }
+func (h scheduleHeap) Less(i, j int) bool { return h[i].before(h[j]) }
+
+func (h scheduleHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *scheduleHeap) Push(x any) {
+	e := x.(*ScheduledEvent)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *scheduleHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
+
+// Scheduler holds events scheduled for a future Lamport time in a priority
+// queue and logs them once the clock of the server reaches their time.
+// Scheduling a timeout and cancelling it when the awaited event arrives
+// gives logical timeouts, independent of wall clock speed.
+type Scheduler struct {
+	queue  scheduleHeap
+	byID   map[string]*ScheduledEvent
+	next   int64
+	added  notifier // wakes Run when an event is scheduled
+	server *Server
+	mutex  sync.Mutex
+}
+
+// NewScheduler creates the scheduler of a server, with nothing scheduled
+func NewScheduler(server *Server) *Scheduler {
+	sc := &Scheduler{byID: make(map[string]*ScheduledEvent), server: server}
+	server.metrics.GaugeFunc("lamport_scheduled_pending", "Events waiting for their scheduled time", func() float64 {
+		sc.mutex.Lock()
+		defer sc.mutex.Unlock()
+		return float64(len(sc.queue))
+	})
+	server.metrics.Counter("lamport_scheduled_delivered_total", "Scheduled events logged once the clock reached their time")
+	return sc
+}
+
+// Schedule queues an event for its time, which must still be ahead of
+// the clock
+func (sc *Scheduler) Schedule(e ScheduledEvent) (ScheduledEvent, error) {
+	now := sc.server.clock.Now()
+	if !now.Before(e.at()) {
+		return ScheduledEvent{}, ErrNotInFuture
+	}
+
+	sc.mutex.Lock()
+	if len(sc.queue) >= maxScheduledEvents {
+		sc.mutex.Unlock()
+		return ScheduledEvent{}, ErrScheduleFull
+	}
+	sc.next++
+	e.seq = sc.next
+	e.ID = "scheduled-" + strconv.FormatInt(sc.next, 10)
+	e.ScheduledAt = now
+	heap.Push(&sc.queue, &e)
+	sc.byID[e.ID] = &e
+	sc.mutex.Unlock()
+
+	sc.added.Notify()
+	return e, nil
+}
+
+// Cancel removes a scheduled event and reports whether it was still
+// waiting
+func (sc *Scheduler) Cancel(id string) bool {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	e, ok := sc.byID[id]
+	if !ok {
+		return false
+	}
+	heap.Remove(&sc.queue, e.index)
+	delete(sc.byID, id)
+	return true
+}
+
+// Pending lists the scheduled events in the order they will be logged
+func (sc *Scheduler) Pending() []ScheduledEvent {
+	sc.mutex.Lock()
+	pending := make([]ScheduledEvent, len(sc.queue))
+	for i, e := range sc.queue {
+		pending[i] = *e
+	}
+	sc.mutex.Unlock()
+	sort.Slice(pending, func(i, j int) bool { return pending[i].before(&pending[j]) })
+	return pending
+}
+
+// due removes and returns the events whose time the clock reached, in
+// order
+func (sc *Scheduler) due(now ClockTime) []ScheduledEvent {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	var due []ScheduledEvent
+	for len(sc.queue) > 0 && !now.Before(sc.queue[0].at()) {
+		e := heap.Pop(&sc.queue).(*ScheduledEvent)
+		delete(sc.byID, e.ID)
+		due = append(due, *e)
+	}
+	return due
+}
+
+// deliverDue logs the events whose time the clock reached
+func (sc *Scheduler) deliverDue() {
+	s := sc.server
+	for _, e := range sc.due(s.clock.Now()) {
+		event, err := s.commitLocal(Event{
+			ID:            e.ID,
+			Message:       e.Message,
+			Type:          e.Type,
+			SchemaVersion: e.SchemaVersion,
+			Payload:       e.Payload,
+			Metadata:      e.Metadata,
+			RequestID:     e.RequestID,
+		})
+		if err != nil {
+			s.logger.Warn("Failed to log scheduled event", "id", e.ID, "error", err)
+			continue
+		}
+		s.metrics.Inc("lamport_scheduled_delivered_total")
+		s.logger.Debug("Scheduled event delivered", "id", e.ID, "deliver_at_ts", e.DeliverAt, "lamport_timestamp", event.Timestamp)
+	}
+}
+
+// Run delivers scheduled events as the clock moves until ctx ends. It
+// only follows the clock while something is scheduled, so an empty
+// scheduler costs the event path nothing.
+func (sc *Scheduler) Run(ctx context.Context) {
+	for {
+		added := sc.added.C()
+		var changed <-chan struct{}
+		sc.mutex.Lock()
+		waiting := len(sc.queue) > 0
+		sc.mutex.Unlock()
+		if waiting {
+			changed = sc.server.clock.changes.C()
+		}
+		sc.deliverDue()
+
+		select {
+		case <-added:
+		case <-changed:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handleSchedule schedules an event, POST /schedule with a JSON body
+// naming deliver_at_ts and optionally epoch, the current one by default,
+// and lists the scheduled events on GET
+func (sc *Scheduler) handleSchedule(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		pending := sc.Pending()
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"current_timestamp": sc.server.clock.GetTime(),
+			"pending_count":     len(pending),
+			"pending":           pending,
+		})
+
+	case http.MethodPost:
+		var body struct {
+			ScheduledEvent
+			Epoch *int64 `json:"epoch"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.DeliverAt <= 0 {
+			http.Error(w, "Invalid body, expected deliver_at_ts and a message", http.StatusBadRequest)
+			return
+		}
+		e := body.ScheduledEvent
+		e.Epoch = sc.server.clock.Now().Epoch
+		if body.Epoch != nil {
+			e.Epoch = *body.Epoch
+		}
+		if e.Epoch < 0 {
+			http.Error(w, "Invalid epoch", http.StatusBadRequest)
+			return
+		}
+		if len(e.Payload) > 0 && !json.Valid(e.Payload) {
+			http.Error(w, "Invalid payload, expected a JSON document", http.StatusBadRequest)
+			return
+		}
+		if e.Message == "" {
+			e.Message = "Scheduled event"
+		}
+		if e.Type != "" && e.SchemaVersion == 0 {
+			e.SchemaVersion = sc.server.schemas.Latest(e.Type)
+		}
+		if err := sc.server.schemas.Validate(e.Type, e.SchemaVersion, e.Payload); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		e.RequestID = requestIDFrom(r.Context())
+
+		e, err := sc.Schedule(e)
+		switch {
+		case errors.Is(err, ErrNotInFuture):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case errors.Is(err, ErrScheduleFull):
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(e)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleCancelScheduled cancels a scheduled event, DELETE /schedule/<id>
+func (sc *Scheduler) handleCancelScheduled(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/schedule/")
+	if !sc.Cancel(id) {
+		http.Error(w, "Scheduled event not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSchedulerDeliversInOrder(t *testing.T) {
+	server := NewServer()
+	sc := NewScheduler(server)
+	for _, c := range []struct {
+		at      int64
+		message string
+	}{{5, "third"}, {3, "first"}, {3, "second"}} {
+		if _, err := sc.Schedule(ScheduledEvent{DeliverAt: c.at, Message: c.message}); err != nil {
+			t.Fatalf("Failed to schedule %s: %v", c.message, err)
+		}
+	}
+	if pending := sc.Pending(); pending[0].Message != "first" || pending[2].Message != "third" {
+		t.Errorf("Expected the pending events in delivery order, got %+v", pending)
+	}
+
+	server.logEvent("e1", "One")
+	server.logEvent("e2", "Two")
+	sc.deliverDue()
+	if n := len(server.events.Events()); n != 2 {
+		t.Fatalf("Expected nothing delivered before 3, got %d events", n)
+	}
+
+	server.logEvent("e3", "Three")
+	sc.deliverDue()
+	events := server.events.Events()
+	if got := fmt.Sprint(eventIDs(events)); got != "[e1 e2 e3 scheduled-2 scheduled-3]" {
+		t.Fatalf("Expected both events due at 3, in order, got %s", got)
+	}
+	if events[3].Timestamp != 4 || events[4].Timestamp != 5 {
+		t.Errorf("Expected the delivered events stamped after 3, got %d and %d", events[3].Timestamp, events[4].Timestamp)
+	}
+	// Delivering at 5 made the third one due as well
+	sc.deliverDue()
+	if pending := sc.Pending(); len(pending) != 0 {
+		t.Errorf("Expected nothing pending, got %+v", pending)
+	}
+}
+
+func TestSchedulerRejectsPastAndCancels(t *testing.T) {
+	server := NewServer()
+	sc := NewScheduler(server)
+	server.logEvent("e1", "One")
+
+	if _, err := sc.Schedule(ScheduledEvent{DeliverAt: 1}); err != ErrNotInFuture {
+		t.Errorf("Expected ErrNotInFuture at the current time, got %v", err)
+	}
+	// An epoch ahead of the clock is in the future whatever the timestamp
+	if _, err := sc.Schedule(ScheduledEvent{DeliverAt: 1, Epoch: 1}); err != nil {
+		t.Errorf("Expected a later epoch to be accepted, got %v", err)
+	}
+
+	timeout, _ := sc.Schedule(ScheduledEvent{DeliverAt: 2, Message: "timed out"})
+	if !sc.Cancel(timeout.ID) || sc.Cancel(timeout.ID) {
+		t.Error("Expected the timeout to be cancelled exactly once")
+	}
+	server.logEvent("e2", "Two")
+	sc.deliverDue()
+	if n := len(server.events.Events()); n != 2 {
+		t.Errorf("Expected the cancelled timeout not to be logged, got %d events", n)
+	}
+}
+
+func TestSchedulerRunFollowsClock(t *testing.T) {
+	server := NewServer()
+	sc := NewScheduler(server)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		sc.Run(ctx)
+		close(done)
+	}()
+
+	sc.Schedule(ScheduledEvent{DeliverAt: 2, Message: "due"})
+	server.clock.Update(5)
+
+	wait, stop := context.WithTimeout(context.Background(), 5*time.Second)
+	defer stop()
+	if !server.waitForEvents(wait, ClockTime{}) {
+		t.Fatal("Expected the scheduled event to be logged")
+	}
+	if events := server.events.Events(); events[0].ID != "scheduled-1" || events[0].Timestamp != 7 {
+		t.Errorf("Expected scheduled-1 right after the update to 6, got %+v", events[0])
+	}
+
+	cancel()
+	<-done
+}
+
+func TestHandleSchedule(t *testing.T) {
+	server := NewServer()
+	sc := NewScheduler(server)
+	server.logEvent("e1", "One")
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		sc.handleSchedule(w, httptest.NewRequest(http.MethodPost, "/schedule", strings.NewReader(body)))
+		return w
+	}
+
+	w := post(`{"deliver_at_ts":10,"message":"later","metadata":{"k":"v"}}`)
+	var e ScheduledEvent
+	json.NewDecoder(w.Body).Decode(&e)
+	if w.Code != http.StatusAccepted || e.ID == "" || e.DeliverAt != 10 || e.Metadata["k"] != "v" {
+		t.Fatalf("Expected the event scheduled, got %d %+v", w.Code, e)
+	}
+
+	w = httptest.NewRecorder()
+	sc.handleSchedule(w, httptest.NewRequest(http.MethodGet, "/schedule", nil))
+	var list struct {
+		Count int `json:"pending_count"`
+	}
+	json.NewDecoder(w.Body).Decode(&list)
+	if list.Count != 1 {
+		t.Errorf("Expected 1 pending event, got %d", list.Count)
+	}
+
+	for _, c := range []struct {
+		body string
+		want int
+	}{
+		{`{"message":"no time"}`, http.StatusBadRequest},
+		{`{"deliver_at_ts":`, http.StatusBadRequest},
+		{`{"deliver_at_ts":5,"epoch":-1}`, http.StatusBadRequest},
+		{`{"deliver_at_ts":1}`, http.StatusConflict},
+	} {
+		if w := post(c.body); w.Code != c.want {
+			t.Errorf("%s: expected %d, got %d", c.body, c.want, w.Code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	sc.handleCancelScheduled(w, httptest.NewRequest(http.MethodDelete, "/schedule/"+e.ID, nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	sc.handleCancelScheduled(w, httptest.NewRequest(http.MethodDelete, "/schedule/"+e.ID, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a cancelled event, got %d", w.Code)
+	}
+}
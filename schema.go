@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// ErrInvalidPayload wraps schema validation failures
+var ErrInvalidPayload = errors.New("payload does not match schema")
+
+// SchemaDefinition is a JSON Schema registered for one version of an event type
+type SchemaDefinition struct {
+	Type    string          `json:"type"`
+	Version int             `json:"version"`
+	Schema  json.RawMessage `json:"schema"`
+}
+
+type compiledSchema struct {
+	definition SchemaDefinition
+	schema     *jsonschema.Schema
+}
+
+// SchemaRegistry holds JSON Schemas per event type and version
+type SchemaRegistry struct {
+	schemas map[string]map[int]compiledSchema
+	mutex   sync.RWMutex
+}
+
+// NewSchemaRegistry creates an empty registry
+func NewSchemaRegistry() *SchemaRegistry {
+	return &SchemaRegistry{schemas: make(map[string]map[int]compiledSchema)}
+}
+
+// Register compiles and stores a schema, replacing any previous definition
+// of the same type and version
+func (sr *SchemaRegistry) Register(def SchemaDefinition) error {
+	if def.Type == "" || def.Version <= 0 {
+		return errors.New("schema needs a type and a positive version")
+	}
+
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(def.Schema))
+	if err != nil {
+		return fmt.Errorf("parsing schema: %w", err)
+	}
+
+	url := fmt.Sprintf("urn:lamport:schema:%s:%d", def.Type, def.Version)
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(url, doc); err != nil {
+		return fmt.Errorf("loading schema: %w", err)
+	}
+	compiled, err := compiler.Compile(url)
+	if err != nil {
+		return fmt.Errorf("compiling schema: %w", err)
+	}
+
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	if sr.schemas[def.Type] == nil {
+		sr.schemas[def.Type] = make(map[int]compiledSchema)
+	}
+	sr.schemas[def.Type][def.Version] = compiledSchema{definition: def, schema: compiled}
+	return nil
+}
+
+// Latest returns the highest registered version for an event type, or 0
+func (sr *SchemaRegistry) Latest(eventType string) int {
+	sr.mutex.RLock()
+	defer sr.mutex.RUnlock()
+
+	latest := 0
+	for version := range sr.schemas[eventType] {
+		if version > latest {
+			latest = version
+		}
+	}
+	return latest
+}
+
+// Validate checks a payload against the schema of its type and version.
+// Types or versions without a registered schema accept any payload.
+func (sr *SchemaRegistry) Validate(eventType string, version int, payload json.RawMessage) error {
+	sr.mutex.RLock()
+	entry, ok := sr.schemas[eventType][version]
+	sr.mutex.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	if len(payload) == 0 {
+		payload = json.RawMessage("null")
+	}
+	instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	if err := entry.schema.Validate(instance); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	return nil
+}
+
+// List returns all registered definitions ordered by type and version
+func (sr *SchemaRegistry) List() []SchemaDefinition {
+	sr.mutex.RLock()
+	defer sr.mutex.RUnlock()
+
+	defs := make([]SchemaDefinition, 0)
+	for _, versions := range sr.schemas {
+		for _, entry := range versions {
+			defs = append(defs, entry.definition)
+		}
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		if defs[i].Type != defs[j].Type {
+			return defs[i].Type < defs[j].Type
+		}
+		return defs[i].Version < defs[j].Version
+	})
+	return defs
+}
+
+func (s *Server) handleSchemas(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"schemas": s.schemas.List(),
+		})
+
+	case http.MethodPost:
+		var def SchemaDefinition
+		if err := json.NewDecoder(r.Body).Decode(&def); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if err := s.schemas.Register(def); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(def)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
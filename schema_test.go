@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const loginSchema = `{
+	"type": "object",
+	"properties": {"user": {"type": "string"}},
+	"required": ["user"]
+}`
+
+func TestSchemaRegistryValidate(t *testing.T) {
+	registry := NewSchemaRegistry()
+	if err := registry.Register(SchemaDefinition{Type: "login", Version: 1, Schema: json.RawMessage(loginSchema)}); err != nil {
+		t.Fatalf("Failed to register schema: %v", err)
+	}
+
+	if err := registry.Validate("login", 1, json.RawMessage(`{"user":"ada"}`)); err != nil {
+		t.Errorf("Expected valid payload to pass, got %v", err)
+	}
+	if err := registry.Validate("login", 1, json.RawMessage(`{"user":42}`)); !errors.Is(err, ErrInvalidPayload) {
+		t.Errorf("Expected ErrInvalidPayload for wrong type, got %v", err)
+	}
+	if err := registry.Validate("login", 1, nil); !errors.Is(err, ErrInvalidPayload) {
+		t.Errorf("Expected missing payload to fail an object schema, got %v", err)
+	}
+
+	// Unregistered types and versions accept anything
+	if err := registry.Validate("logout", 1, json.RawMessage(`[1,2]`)); err != nil {
+		t.Errorf("Expected unregistered type to pass, got %v", err)
+	}
+	if err := registry.Validate("login", 2, json.RawMessage(`"anything"`)); err != nil {
+		t.Errorf("Expected unregistered version to pass, got %v", err)
+	}
+}
+
+func TestSchemaRegistryRejectsInvalidDefinitions(t *testing.T) {
+	registry := NewSchemaRegistry()
+
+	cases := []SchemaDefinition{
+		{Type: "", Version: 1, Schema: json.RawMessage(`{}`)},
+		{Type: "login", Version: 0, Schema: json.RawMessage(`{}`)},
+		{Type: "login", Version: 1, Schema: json.RawMessage(`{"type": 12}`)},
+		{Type: "login", Version: 1, Schema: json.RawMessage(`not json`)},
+	}
+	for _, def := range cases {
+		if err := registry.Register(def); err == nil {
+			t.Errorf("Expected definition %+v to be rejected", def)
+		}
+	}
+}
+
+func TestCreateEventWithPayload(t *testing.T) {
+	server := NewServer()
+
+	body := `{"type":"login","version":1,"schema":` + loginSchema + `}`
+	req := httptest.NewRequest("POST", "/schemas", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	server.handleSchemas(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status Created, got %d: %s", w.Code, w.Body.String())
+	}
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/event", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.handleCreateEvent(w, req)
+		return w
+	}
+
+	w = post(`{"type":"login","message":"User login","payload":{"user":"ada"}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d: %s", w.Code, w.Body.String())
+	}
+	var event Event
+	json.NewDecoder(w.Body).Decode(&event)
+	if event.SchemaVersion != 1 {
+		t.Errorf("Expected latest schema version 1 to be assigned, got %d", event.SchemaVersion)
+	}
+	if string(event.Payload) != `{"user":"ada"}` {
+		t.Errorf("Expected payload to round-trip, got %s", event.Payload)
+	}
+	if event.Timestamp != 1 {
+		t.Errorf("Expected timestamp 1, got %d", event.Timestamp)
+	}
+
+	// Invalid payloads never reach the log or the clock
+	if w := post(`{"type":"login","payload":{"name":"ada"}}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status UnprocessableEntity, got %d", w.Code)
+	}
+	if server.clock.GetTime() != 1 {
+		t.Errorf("Expected clock to stay at 1, got %d", server.clock.GetTime())
+	}
+
+	// Clients cannot choose their own timestamp
+	w = post(`{"message":"sneaky","lamport_timestamp":999}`)
+	json.NewDecoder(w.Body).Decode(&event)
+	if event.Timestamp != 2 {
+		t.Errorf("Expected server-assigned timestamp 2, got %d", event.Timestamp)
+	}
+
+	if w := post(`{not json`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status BadRequest, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/schemas", nil)
+	w = httptest.NewRecorder()
+	server.handleSchemas(w, req)
+	var listed struct {
+		Schemas []SchemaDefinition `json:"schemas"`
+	}
+	json.NewDecoder(w.Body).Decode(&listed)
+	if len(listed.Schemas) != 1 || listed.Schemas[0].Type != "login" {
+		t.Errorf("Expected login schema to be listed, got %+v", listed.Schemas)
+	}
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// defaultSendRetry is how often unacknowledged messages are sent again
+// without -send-retry
+const defaultSendRetry = time.Second
+
+// SentMessage is a message sent to a peer on POST /send. It is kept, and
+// sent again, until the peer acknowledged it.
+type SentMessage struct {
+	Peer      string    `json:"peer"`
+	Seq       int64     `json:"seq"`
+	EventID   string    `json:"event_id"`
+	Timestamp int64     `json:"lamport_timestamp"`
+	Epoch     int64     `json:"epoch"`
+	Message   string    `json:"message"`
+	RequestID string    `json:"request_id,omitempty"`
+	Created   time.Time `json:"created"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// channelMessage is what nodes exchange on /peer/send
+type channelMessage struct {
+	Sender    string `json:"sender"`
+	Seq       int64  `json:"seq"`
+	EventID   string `json:"event_id"`
+	Timestamp int64  `json:"lamport_timestamp"`
+	Epoch     int64  `json:"epoch"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// channelAck is the answer to a channelMessage
+type channelAck struct {
+	Seq       int64  `json:"seq"`
+	Duplicate bool   `json:"duplicate,omitempty"`
+	Event     *Event `json:"event,omitempty"`
+}
+
+// channelState is what the channels keep across restarts
+type channelState struct {
+	Sent     map[string]int64 `json:"sent"`     // last sequence number given, by peer URL
+	Unacked  []SentMessage    `json:"unacked"`  // in sequence order for each peer
+	Received map[string]int64 `json:"received"` // last sequence number merged, by sender node
+}
+
+// Channels deliver messages to peers exactly once. Messages to each peer
+// are numbered from 1; the peer merges a message only when its number is
+// above the last one it merged from the sender, and acknowledges copies
+// without merging them again. Unacknowledged messages are sent again, in
+// order, until the peer accepts them. With a file, numbers and unacked
+// messages survive restarts on both ends.
+type Channels struct {
+	server  *Server
+	path    string // where the state is kept, empty to keep it in memory
+	state   channelState
+	sending map[string]*sync.Mutex // serializes the sends to each peer
+	// receiving serializes merges, so copies arriving together are told
+	// apart
+	receiving sync.Mutex
+	mutex     sync.Mutex
+}
+
+// NewChannels creates the channels of a server to its peers, resuming
+// from the state saved at path when there is one
+func NewChannels(server *Server, path string) (*Channels, error) {
+	server.metrics.Counter("lamport_channel_sends_total", "Attempts to send channel messages to peers by result")
+	server.metrics.Counter("lamport_channel_duplicates_total", "Channel messages received again and acknowledged without merging")
+	c := &Channels{
+		server:  server,
+		path:    path,
+		state:   channelState{Sent: make(map[string]int64), Received: make(map[string]int64)},
+		sending: make(map[string]*sync.Mutex),
+	}
+	server.metrics.GaugeFunc("lamport_channel_unacked", "Channel messages waiting for acknowledgment", func() float64 {
+		return float64(len(c.Unacked("")))
+	})
+	if path == "" {
+		return c, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading send file: %w", err)
+	}
+	if err := json.Unmarshal(data, &c.state); err != nil {
+		return nil, fmt.Errorf("decoding send file: %w", err)
+	}
+	if c.state.Sent == nil {
+		c.state.Sent = make(map[string]int64)
+	}
+	if c.state.Received == nil {
+		c.state.Received = make(map[string]int64)
+	}
+	return c, nil
+}
+
+// saveLocked writes the state to the file, if any
+func (c *Channels) saveLocked() error {
+	if c.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(c.state)
+	if err != nil {
+		return err
+	}
+	if err := writeFileDurably(c.path, data); err != nil {
+		return fmt.Errorf("writing send file: %w", err)
+	}
+	return nil
+}
+
+// Send records a send event and queues the message for a peer, given by
+// URL. It is saved before Send returns; Flush or Run deliver it.
+func (c *Channels) Send(peer, message, requestID string) (SentMessage, error) {
+	// The event is logged under the lock, so sequence numbers follow
+	// timestamps
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	event, err := c.server.commitLocal(Event{
+		ID:        localEventID("send-", time.Now()),
+		Message:   message,
+		RequestID: requestID,
+	})
+	if err != nil {
+		return SentMessage{}, err
+	}
+	msg := SentMessage{
+		Peer:      peer,
+		Seq:       c.state.Sent[peer] + 1,
+		EventID:   event.ID,
+		Timestamp: event.Timestamp,
+		Epoch:     event.Epoch,
+		Message:   message,
+		RequestID: requestID,
+		Created:   time.Now(),
+	}
+	c.state.Sent[peer] = msg.Seq
+	c.state.Unacked = append(c.state.Unacked, msg)
+	if err := c.saveLocked(); err != nil {
+		c.state.Sent[peer]--
+		c.state.Unacked = c.state.Unacked[:len(c.state.Unacked)-1]
+		return SentMessage{}, err
+	}
+	return msg, nil
+}
+
+// Unacked returns the messages to a peer that were not acknowledged yet,
+// or to all peers when peer is empty
+func (c *Channels) Unacked(peer string) []SentMessage {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	unacked := []SentMessage{}
+	for _, msg := range c.state.Unacked {
+		if peer == "" || msg.Peer == peer {
+			unacked = append(unacked, msg)
+		}
+	}
+	return unacked
+}
+
+// Flush sends the unacknowledged messages to a peer in order, stopping at
+// the first that fails
+func (c *Channels) Flush(ctx context.Context, peer string) error {
+	c.mutex.Lock()
+	sending, ok := c.sending[peer]
+	if !ok {
+		sending = &sync.Mutex{}
+		c.sending[peer] = sending
+	}
+	c.mutex.Unlock()
+
+	// One message at a time, so the peer sees them in order
+	sending.Lock()
+	defer sending.Unlock()
+	for {
+		c.mutex.Lock()
+		i := slices.IndexFunc(c.state.Unacked, func(m SentMessage) bool { return m.Peer == peer })
+		if i < 0 {
+			c.mutex.Unlock()
+			return nil
+		}
+		msg := c.state.Unacked[i]
+		c.mutex.Unlock()
+
+		err := c.deliver(ctx, msg)
+		c.mutex.Lock()
+		// The message is still first for the peer: only Flush removes it
+		i = slices.IndexFunc(c.state.Unacked, func(m SentMessage) bool { return m.Peer == peer && m.Seq == msg.Seq })
+		if err != nil {
+			c.state.Unacked[i].Attempts++
+			c.state.Unacked[i].LastError = err.Error()
+			c.mutex.Unlock()
+			c.server.metrics.Inc("lamport_channel_sends_total", "result", "failed")
+			return err
+		}
+		c.state.Unacked = slices.Delete(c.state.Unacked, i, i+1)
+		if err := c.saveLocked(); err != nil {
+			c.server.logger.Error("Failed to save channel state", "error", err)
+		}
+		c.mutex.Unlock()
+		c.server.metrics.Inc("lamport_channel_sends_total", "result", "delivered")
+	}
+}
+
+func (c *Channels) deliver(ctx context.Context, msg SentMessage) error {
+	body, err := json.Marshal(channelMessage{
+		Sender:    c.server.nodeID,
+		Seq:       msg.Seq,
+		EventID:   msg.EventID,
+		Timestamp: msg.Timestamp,
+		Epoch:     msg.Epoch,
+		Message:   msg.Message,
+		RequestID: msg.RequestID,
+	})
+	if err != nil {
+		return err
+	}
+	header := http.Header{"Content-Type": []string{"application/json"}}
+	data, err := c.server.peers.Do(ctx, msg.Peer, http.MethodPost, "/peer/send", header, body)
+	if err != nil {
+		return err
+	}
+	var ack channelAck
+	if err := json.Unmarshal(data, &ack); err != nil || ack.Seq < msg.Seq {
+		return fmt.Errorf("peer %s did not acknowledge message %d", msg.Peer, msg.Seq)
+	}
+	return nil
+}
+
+// Receive merges a message from a peer unless a message with the same or a
+// higher number from the same sender was merged already. Numbers skipped
+// ahead, after the receiver lost its state, are accepted: the sender never
+// moves on before a message is acknowledged.
+func (c *Channels) Receive(ctx context.Context, msg channelMessage) (channelAck, error) {
+	c.receiving.Lock()
+	defer c.receiving.Unlock()
+
+	c.mutex.Lock()
+	last := c.state.Received[msg.Sender]
+	c.mutex.Unlock()
+	if msg.Seq <= last {
+		c.server.metrics.Inc("lamport_channel_duplicates_total")
+		return channelAck{Seq: last, Duplicate: true}, nil
+	}
+
+	received := ClockTime{Epoch: msg.Epoch, Timestamp: msg.Timestamp}
+	if msg.RequestID != "" {
+		ctx = contextWithRequestID(ctx, msg.RequestID)
+	}
+	event, err := c.server.receiveMessage(ctx, msg.Sender, msg.EventID, received, msg.Message)
+	if err != nil && !errors.Is(err, ErrDuplicateMessage) {
+		return channelAck{}, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.state.Received[msg.Sender] = msg.Seq
+	if err := c.saveLocked(); err != nil {
+		c.server.logger.Error("Failed to save channel state", "error", err)
+	}
+	ack := channelAck{Seq: msg.Seq}
+	if event.ID != "" {
+		ack.Event = &event
+	}
+	return ack, nil
+}
+
+// Run sends unacknowledged messages again every interval until ctx is done
+func (c *Channels) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.retry(ctx)
+		}
+	}
+}
+
+func (c *Channels) retry(ctx context.Context) {
+	peers := map[string]bool{}
+	for _, msg := range c.Unacked("") {
+		peers[msg.Peer] = true
+	}
+	for peer := range peers {
+		flushCtx, cancel := context.WithTimeout(ctx, clusterTimeout)
+		if err := c.Flush(flushCtx, peer); err != nil {
+			c.server.logger.Warn("Channel send failed, retrying", "peer", peer, "error", err)
+		}
+		cancel()
+	}
+}
+
+// handleSend sends a message to a peer with POST, answering 200 once the
+// peer acknowledged it and 202 when it will be retried, and lists the
+// unacknowledged messages with GET
+func (c *Channels) handleSend(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		query := r.URL.Query()
+		message := query.Get("message")
+		if message == "" || query.Get("peer") == "" {
+			http.Error(w, "Missing peer or message parameter", http.StatusBadRequest)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), clusterTimeout)
+		defer cancel()
+		peer, err := c.server.peers.Resolve(ctx, query.Get("peer"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		msg, err := c.Send(peer, message, requestIDFrom(r.Context()))
+		if err != nil {
+			c.server.writeCommitError(w, err)
+			return
+		}
+		status := http.StatusOK
+		response := map[string]interface{}{"message": msg, "delivered": true}
+		if err := c.Flush(ctx, peer); err != nil {
+			c.server.logger.Warn("Channel send failed, retrying", "peer", peer, "seq", msg.Seq, "error", err)
+			status = http.StatusAccepted
+			response["delivered"] = false
+			response["error"] = err.Error()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(response)
+
+	case http.MethodGet:
+		unacked := c.Unacked(r.URL.Query().Get("peer"))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"unacked": unacked,
+			"count":   len(unacked),
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (c *Channels) handlePeerSend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var msg channelMessage
+	err := json.NewDecoder(r.Body).Decode(&msg)
+	if err != nil || msg.Sender == "" || msg.Sender == c.server.nodeID || msg.Seq <= 0 ||
+		msg.EventID == "" || msg.Timestamp < 0 || msg.Epoch < 0 {
+		http.Error(w, "Invalid channel message", http.StatusBadRequest)
+		return
+	}
+
+	ack, err := c.Receive(r.Context(), msg)
+	switch {
+	case errors.Is(err, ErrJumpTooLarge):
+		http.Error(w, "Timestamp jump exceeds max_jump", http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		c.server.writeCommitError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ack)
+}
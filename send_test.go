@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newChannelPair creates a sender a and a receiver b serving /peer/send,
+// which answers 503 while down is set
+func newChannelPair(t *testing.T, path string) (a, b *Channels, peer string, down *atomic.Bool) {
+	t.Helper()
+	down = new(atomic.Bool)
+	receiver := NewServer()
+	receiver.nodeID = "b"
+	b, err := NewChannels(receiver, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		b.handlePeerSend(w, r)
+	}))
+	t.Cleanup(ts.Close)
+
+	sender := NewServer()
+	sender.nodeID = "a"
+	sender.peers = NewPeers([]string{ts.URL}, http.DefaultClient)
+	if a, err = NewChannels(sender, path); err != nil {
+		t.Fatal(err)
+	}
+	return a, b, ts.URL, down
+}
+
+func TestChannelsDeliverOnce(t *testing.T) {
+	a, b, peer, down := newChannelPair(t, "")
+
+	first, err := a.Send(peer, "hello", "")
+	if err != nil || first.Seq != 1 || first.Timestamp != 1 {
+		t.Fatalf("Expected message 1 sent at 1, got %+v (err: %v)", first, err)
+	}
+	if err := a.Flush(t.Context(), peer); err != nil {
+		t.Fatal(err)
+	}
+
+	down.Store(true)
+	second, _ := a.Send(peer, "again", "")
+	if err := a.Flush(t.Context(), peer); err == nil {
+		t.Fatal("Expected the send to fail while the peer is down")
+	}
+	if unacked := a.Unacked(peer); len(unacked) != 1 || unacked[0].Seq != 2 || unacked[0].Attempts != 1 {
+		t.Errorf("Expected message 2 kept after one attempt, got %+v", unacked)
+	}
+
+	down.Store(false)
+	a.retry(t.Context())
+	if unacked := a.Unacked(""); len(unacked) != 0 {
+		t.Errorf("Expected every message acknowledged, got %+v", unacked)
+	}
+	if b.server.events.Len() != 2 || b.server.clock.GetTime() != 3 {
+		t.Errorf("Expected 2 receive events up to 3, got %d at %d", b.server.events.Len(), b.server.clock.GetTime())
+	}
+
+	// An acknowledgment lost on the way back makes the sender try again
+	copied := channelMessage{Sender: "a", Seq: second.Seq, EventID: second.EventID, Timestamp: second.Timestamp, Message: "again"}
+	ack, err := b.Receive(t.Context(), copied)
+	if err != nil || !ack.Duplicate || ack.Seq != 2 || b.server.events.Len() != 2 {
+		t.Errorf("Expected the copy acknowledged without merging, got %+v (err: %v)", ack, err)
+	}
+	if got := b.server.metrics.Value("lamport_channel_duplicates_total"); got != 1 {
+		t.Errorf("Expected 1 duplicate counted, got %v", got)
+	}
+}
+
+func TestChannelsPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "send.json")
+	a, _, peer, down := newChannelPair(t, path)
+	down.Store(true)
+	a.Send(peer, "one", "")
+	a.Send(peer, "two", "")
+	a.Flush(t.Context(), peer)
+
+	// A restarted sender resumes the numbering and the unacked messages
+	resumed, err := NewChannels(a.server, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unacked := resumed.Unacked(peer); len(unacked) != 2 || unacked[1].Message != "two" {
+		t.Fatalf("Expected both messages kept, got %+v", unacked)
+	}
+	if next, _ := resumed.Send(peer, "three", ""); next.Seq != 3 {
+		t.Errorf("Expected the next message numbered 3, got %d", next.Seq)
+	}
+
+	// So does a restarted receiver with what it merged
+	receiverPath := filepath.Join(t.TempDir(), "receive.json")
+	receiver := NewServer()
+	b, _ := NewChannels(receiver, receiverPath)
+	msg := channelMessage{Sender: "a", Seq: 1, EventID: "send-1", Timestamp: 5, Message: "one"}
+	b.Receive(t.Context(), msg)
+	b, _ = NewChannels(receiver, receiverPath)
+	if ack, _ := b.Receive(t.Context(), msg); !ack.Duplicate {
+		t.Error("Expected the restarted receiver to know message 1")
+	}
+}
+
+func TestHandleSend(t *testing.T) {
+	a, b, peer, down := newChannelPair(t, "")
+
+	post := func(target string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		a.handleSend(w, httptest.NewRequest(http.MethodPost, target, nil))
+		var response map[string]interface{}
+		json.NewDecoder(w.Body).Decode(&response)
+		return w, response
+	}
+	if w, response := post("/send?peer=" + peer + "&message=hello"); w.Code != http.StatusOK || response["delivered"] != true {
+		t.Errorf("Expected the message delivered, got %d %v", w.Code, response)
+	}
+	down.Store(true)
+	if w, response := post("/send?peer=" + peer + "&message=later"); w.Code != http.StatusAccepted || response["delivered"] != false {
+		t.Errorf("Expected the message accepted for a retry, got %d %v", w.Code, response)
+	}
+	for _, target := range []string{"/send?peer=" + peer, "/send?message=hello"} {
+		if w, _ := post(target); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", target, w.Code)
+		}
+	}
+	if w, _ := post("/send?peer=http://elsewhere&message=hello"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown peer, got %d", w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	a.handleSend(w, httptest.NewRequest(http.MethodGet, "/send", nil))
+	var listed struct {
+		Count   int           `json:"count"`
+		Unacked []SentMessage `json:"unacked"`
+	}
+	json.NewDecoder(w.Body).Decode(&listed)
+	if listed.Count != 1 || listed.Unacked[0].Message != "later" {
+		t.Errorf("Expected the unacked message listed, got %+v", listed)
+	}
+
+	for _, body := range []string{`{`, `{"sender":"a","seq":0,"event_id":"e"}`, `{"sender":"b","seq":1,"event_id":"e"}`, `{"sender":"a","seq":1}`} {
+		w := httptest.NewRecorder()
+		b.handlePeerSend(w, httptest.NewRequest(http.MethodPost, "/peer/send", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, w.Code)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/clockctx"
+)
+
+// headerSessionToken carries the restamped token of a request made with a
+// JWT, for the caller to present on its next request
+const headerSessionToken = "Lamport-Token"
+
+// withSessionToken keeps the logical time of sessions in their tokens, so
+// stateless services passing a token along stay causally ordered. A valid
+// JWT's lamport_ts claim moves the clock up to it, as the Lamport-Timestamp
+// header does, and the response carries the token again in Lamport-Token
+// with lamport_ts and lamport_epoch set to the time of the response.
+// Requests without a token, or with one the server cannot verify, pass
+// through.
+func (s *Server) withSessionToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := requestCredential(r)
+		if s.access == nil || len(s.access.jwtSecret) == 0 || !looksLikeJWT(token) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		claims, err := parseJWT(token, s.access.jwtSecret, time.Now())
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if claims.LamportTS != nil {
+			received := ClockTime{Epoch: s.clock.Now().Epoch, Timestamp: *claims.LamportTS}
+			if claims.LamportEpoch != nil {
+				received.Epoch = *claims.LamportEpoch
+			}
+			if received.Timestamp < 0 || received.Epoch < 0 {
+				http.Error(w, "Invalid lamport_ts claim", http.StatusBadRequest)
+				return
+			}
+			now, err := s.clock.observeFrom(received, ClockSource{Peer: claims.Subject, RequestID: requestIDFrom(r.Context())})
+			if errors.Is(err, ErrJumpTooLarge) {
+				http.Error(w, "Timestamp jump exceeds max_jump", http.StatusUnprocessableEntity)
+				return
+			}
+			r = r.WithContext(clockctx.WithTimestamp(r.Context(), now.Timestamp))
+		}
+
+		sw := &sessionWriter{ResponseWriter: w, stamp: func() {
+			if restamped, err := restampJWT(token, s.clock.Now(), s.access.jwtSecret); err == nil {
+				w.Header().Set(headerSessionToken, restamped)
+			}
+		}}
+		next.ServeHTTP(sw, r)
+		// Handlers that write nothing leave the headers to be sent now
+		sw.stampOnce()
+	})
+}
+
+// sessionWriter stamps the session token when the response headers are
+// written, so the token covers the events the request recorded
+type sessionWriter struct {
+	http.ResponseWriter
+	stamp   func()
+	stamped bool
+}
+
+func (w *sessionWriter) stampOnce() {
+	if !w.stamped {
+		w.stamped = true
+		w.stamp()
+	}
+}
+
+func (w *sessionWriter) WriteHeader(code int) {
+	w.stampOnce()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *sessionWriter) Write(b []byte) (int, error) {
+	w.stampOnce()
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush lets streaming handlers flush through the writer
+func (w *sessionWriter) Flush() {
+	w.stampOnce()
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *sessionWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
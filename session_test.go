@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionToken(t *testing.T) {
+	secret := []byte("shared")
+	newServer := func() *Server {
+		s := NewServer()
+		s.access, _ = NewAccessControl(nil, secret, nil)
+		return s
+	}
+	a, b := newServer(), newServer()
+	ts := int64(100)
+	token, _ := signJWT(map[string]any{"sub": "cart-42", "roles": []string{"writer"}, "lamport_ts": ts, "tenant": "acme"}, secret)
+
+	send := func(s *Server, method, path, token string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send(a, http.MethodPost, "/event?message=added", token)
+	var event Event
+	json.Unmarshal(rec.Body.Bytes(), &event)
+	if event.Timestamp != 101 {
+		t.Fatalf("Expected the event stamped after the token's time, got %d", event.Timestamp)
+	}
+	restamped := rec.Header().Get(headerSessionToken)
+	claims, err := parseJWT(restamped, secret, time.Now())
+	if err != nil || claims.LamportTS == nil || *claims.LamportTS != 101 || claims.Subject != "cart-42" || len(claims.Roles) != 1 {
+		t.Fatalf("Expected the token restamped at 101, got %+v (err: %v)", claims, err)
+	}
+	if !jwtHasClaim(restamped, "tenant", "acme") {
+		t.Error("Expected the other claims kept")
+	}
+
+	// Another service continues the session after it
+	rec = send(b, http.MethodGet, "/time", restamped)
+	if rec.Code != http.StatusOK || b.clock.GetTime() != 101 {
+		t.Errorf("Expected the second server moved up to 101, got %d (status %d)", b.clock.GetTime(), rec.Code)
+	}
+	if rec.Header().Get(headerSessionToken) == "" {
+		t.Error("Expected reads to restamp the token too")
+	}
+
+	negative, _ := signJWT(map[string]any{"roles": "reader", "lamport_ts": -1}, secret)
+	if rec := send(b, http.MethodGet, "/time", negative); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected a negative lamport_ts refused, got %d", rec.Code)
+	}
+}
+
+func TestRestampJWTKeepsClaims(t *testing.T) {
+	secret := []byte("shared")
+	token, _ := signJWT(map[string]any{"sub": "s", "tenant": "acme"}, secret)
+	restamped, err := restampJWT(token, ClockTime{Epoch: 2, Timestamp: 7}, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := parseJWT(restamped, secret, time.Now())
+	if err != nil || *claims.LamportTS != 7 || *claims.LamportEpoch != 2 {
+		t.Fatalf("Expected the time set, got %+v (err: %v)", claims, err)
+	}
+	if !jwtHasClaim(restamped, "tenant", "acme") {
+		t.Error("Expected the other claims kept")
+	}
+}
+
+// jwtHasClaim reports whether the payload of token holds a string claim
+func jwtHasClaim(token, name, value string) bool {
+	var claims map[string]any
+	payload, _ := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[1])
+	json.Unmarshal(payload, &claims)
+	return claims[name] == value
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+)
+
+// SignaturePolicy decides what happens to a message whose signature does
+// not verify
+type SignaturePolicy string
+
+const (
+	// SignatureReject refuses the message
+	SignatureReject SignaturePolicy = "reject"
+	// SignatureFlag accepts the message and marks the resulting event
+	SignatureFlag SignaturePolicy = "flag"
+)
+
+// Signature verification failures
+var (
+	ErrUnknownKey       = errors.New("signed with an untrusted key")
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+// parseSignaturePolicy validates a policy name from configuration
+func parseSignaturePolicy(name string) (SignaturePolicy, error) {
+	switch p := SignaturePolicy(name); p {
+	case SignatureReject, SignatureFlag:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown signature policy %q", name)
+	}
+}
+
+// Signer signs the events this node records with Ed25519 and verifies the
+// signatures of events received from other nodes. Without a private key
+// it only verifies.
+type Signer struct {
+	key     ed25519.PrivateKey
+	keyID   string
+	trusted map[string]ed25519.PublicKey // key ID to key, including our own
+	policy  SignaturePolicy
+}
+
+// NewSigner signs with key, which may be nil, and trusts its public key
+// and the given ones
+func NewSigner(key ed25519.PrivateKey, trusted []ed25519.PublicKey, policy SignaturePolicy) *Signer {
+	s := &Signer{key: key, trusted: make(map[string]ed25519.PublicKey), policy: policy}
+	if key != nil {
+		public := key.Public().(ed25519.PublicKey)
+		s.keyID = keyFingerprint(public)
+		s.trusted[s.keyID] = public
+	}
+	for _, k := range trusted {
+		s.trusted[keyFingerprint(k)] = k
+	}
+	return s
+}
+
+// LoadSigner reads the signing key and trusted keys named in cfg. A
+// missing signing key file is created with a new key.
+func LoadSigner(cfg *Config) (*Signer, error) {
+	var key ed25519.PrivateKey
+	if cfg.SigningKey != "" {
+		var err error
+		if key, err = loadSigningKey(cfg.SigningKey); err != nil {
+			return nil, err
+		}
+	}
+	var trusted []ed25519.PublicKey
+	if cfg.TrustedKeys != "" {
+		data, err := os.ReadFile(cfg.TrustedKeys)
+		if err != nil {
+			return nil, err
+		}
+		if trusted, err = parsePublicKeys(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", cfg.TrustedKeys, err)
+		}
+	}
+	return NewSigner(key, trusted, cfg.SignaturePolicy), nil
+}
+
+// loadSigningKey reads a PEM encoded PKCS #8 Ed25519 private key, creating
+// the file when it does not exist
+func loadSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		block := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		return key, os.WriteFile(path, block, 0o600)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s: expected a PEM encoded PRIVATE KEY", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 key", path)
+	}
+	return key, nil
+}
+
+// parsePublicKeys reads every PEM encoded PUBLIC KEY block in data
+func parsePublicKeys(data []byte) ([]ed25519.PublicKey, error) {
+	var keys []ed25519.PublicKey
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			return keys, nil
+		}
+		if block.Type != "PUBLIC KEY" {
+			continue
+		}
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := parsed.(ed25519.PublicKey)
+		if !ok {
+			return nil, errors.New("not an Ed25519 key")
+		}
+		keys = append(keys, key)
+	}
+}
+
+// keyFingerprint identifies a public key by the start of its SHA-256 hash
+func keyFingerprint(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// signedContent is what gets signed for an event: its ID, time and message
+func signedContent(id string, at ClockTime, message string) []byte {
+	data, _ := json.Marshal([]interface{}{id, at.Epoch, at.Timestamp, message})
+	return data
+}
+
+// KeyID returns the fingerprint of the signing key, empty when verifying only
+func (s *Signer) KeyID() string {
+	return s.keyID
+}
+
+// Sign returns the event with this node's signature
+func (s *Signer) Sign(event Event) Event {
+	if s.key == nil {
+		return event
+	}
+	at := ClockTime{Epoch: event.Epoch, Timestamp: event.Timestamp}
+	sig := ed25519.Sign(s.key, signedContent(event.ID, at, event.Message))
+	event.Signature = base64.StdEncoding.EncodeToString(sig)
+	event.KeyID = s.keyID
+	return event
+}
+
+// Verify checks a signature made with the key named keyID over an event's
+// ID, time and message
+func (s *Signer) Verify(keyID, signature, id string, at ClockTime, message string) error {
+	key, ok := s.trusted[keyID]
+	if !ok {
+		return ErrUnknownKey
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || !ed25519.Verify(key, signedContent(id, at, message), sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// VerifyEvent checks the signature an event carries
+func (s *Signer) VerifyEvent(event Event) error {
+	return s.Verify(event.KeyID, event.Signature, event.ID, ClockTime{Epoch: event.Epoch, Timestamp: event.Timestamp}, event.Message)
+}
+
+// sign signs an event recorded by this node, when signing is enabled
+func (s *Server) sign(event Event) Event {
+	if s.signer == nil || event.Signature != "" {
+		return event
+	}
+	return s.signer.Sign(event)
+}
+
+// checkSignature verifies the signature of a message received from source.
+// Unsigned messages and servers without a signer pass. Under the flag
+// policy an invalid signature is reported through the returned context,
+// which marks the event the message produces; under the reject policy it
+// is returned as an error.
+func (s *Server) checkSignature(ctx context.Context, source, keyID, signature, id string, at ClockTime, message string) (context.Context, error) {
+	if s.signer == nil || (signature == "" && keyID == "") {
+		return ctx, nil
+	}
+	err := s.signer.Verify(keyID, signature, id, at, message)
+	if err == nil {
+		return ctx, nil
+	}
+	s.metrics.Inc("lamport_signature_failures_total", "source", source, "policy", string(s.signer.policy))
+	s.logger.Warn("Signature verification failed", "source", source, "id", id, "key_id", keyID, "error", err)
+	if s.signer.policy == SignatureFlag {
+		return context.WithValue(ctx, invalidSignatureKey{}, true), nil
+	}
+	return ctx, err
+}
+
+type invalidSignatureKey struct{}
+
+// invalidSignatureFrom reports whether ctx carries a flagged signature
+func invalidSignatureFrom(ctx context.Context) bool {
+	invalid, _ := ctx.Value(invalidSignatureKey{}).(bool)
+	return invalid
+}
+
+// handleKeys shows this node's public key and the trusted key IDs
+func (s *Server) handleKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	trusted := make([]string, 0, len(s.signer.trusted))
+	for id := range s.signer.trusted {
+		trusted = append(trusted, id)
+	}
+	sort.Strings(trusted)
+	response := map[string]interface{}{
+		"node_id":   s.nodeID,
+		"algorithm": "ed25519",
+		"key_id":    s.signer.keyID,
+		"trusted":   trusted,
+		"policy":    s.signer.policy,
+	}
+	if s.signer.key != nil {
+		der, _ := x509.MarshalPKIXPublicKey(s.signer.key.Public())
+		response["public_key"] = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSigner(t *testing.T, policy SignaturePolicy, trusted ...ed25519.PublicKey) *Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return NewSigner(key, trusted, policy)
+}
+
+func TestSignerSignAndVerify(t *testing.T) {
+	signer := newTestSigner(t, SignatureReject)
+	event := signer.Sign(Event{ID: "event-1", Message: "Hello", Timestamp: 3, Epoch: 1})
+	if event.Signature == "" || event.KeyID != signer.KeyID() || len(event.KeyID) != 16 {
+		t.Fatalf("Expected a signature with a 16 character key ID, got %+v", event)
+	}
+	if err := signer.VerifyEvent(event); err != nil {
+		t.Errorf("Expected a valid signature, got %v", err)
+	}
+
+	for name, tampered := range map[string]Event{
+		"id":        {ID: "event-2", Message: "Hello", Timestamp: 3, Epoch: 1},
+		"message":   {ID: "event-1", Message: "Hullo", Timestamp: 3, Epoch: 1},
+		"timestamp": {ID: "event-1", Message: "Hello", Timestamp: 4, Epoch: 1},
+		"epoch":     {ID: "event-1", Message: "Hello", Timestamp: 3},
+	} {
+		tampered.Signature, tampered.KeyID = event.Signature, event.KeyID
+		if err := signer.VerifyEvent(tampered); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: expected ErrInvalidSignature, got %v", name, err)
+		}
+	}
+
+	other := newTestSigner(t, SignatureReject)
+	if err := other.VerifyEvent(event); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Expected ErrUnknownKey, got %v", err)
+	}
+	trusting := NewSigner(nil, []ed25519.PublicKey{signer.key.Public().(ed25519.PublicKey)}, SignatureReject)
+	if err := trusting.VerifyEvent(event); err != nil {
+		t.Errorf("Expected a trusted key to verify, got %v", err)
+	}
+}
+
+func TestLoadSigner(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &Config{SigningKey: filepath.Join(dir, "node.key"), SignaturePolicy: SignatureReject}
+
+	created, err := LoadSigner(cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if info, err := os.Stat(cfg.SigningKey); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("Expected the key file created with mode 0600, got %v %v", info, err)
+	}
+	loaded, err := LoadSigner(cfg)
+	if err != nil || loaded.KeyID() != created.KeyID() {
+		t.Errorf("Expected the same key reloaded, got %q %v", loaded.KeyID(), err)
+	}
+
+	// Trusted keys are read from PEM blocks
+	peer := newTestSigner(t, SignatureReject)
+	der, _ := x509.MarshalPKIXPublicKey(peer.key.Public())
+	cfg.TrustedKeys = filepath.Join(dir, "trusted.pem")
+	os.WriteFile(cfg.TrustedKeys, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o644)
+	withTrusted, err := LoadSigner(cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := withTrusted.trusted[peer.KeyID()]; !ok || len(withTrusted.trusted) != 2 {
+		t.Errorf("Expected own and peer key trusted, got %v", withTrusted.trusted)
+	}
+
+	os.WriteFile(cfg.SigningKey, []byte("not a key"), 0o600)
+	if _, err := LoadSigner(cfg); err == nil {
+		t.Error("Expected an error for an invalid key file")
+	}
+}
+
+func TestLocalEventsAreSigned(t *testing.T) {
+	server := NewServer()
+	server.nodeID = "a"
+	server.signer = newTestSigner(t, SignatureReject)
+
+	event := server.logEvent("event-1", "Hello")
+	if err := server.signer.VerifyEvent(event); err != nil {
+		t.Errorf("Expected a signed event, got %v", err)
+	}
+
+	// Events proposed by other nodes keep their own signature
+	remote, _ := server.appendEvent(Event{ID: "event-2", Message: "Hi", Timestamp: 9, Node: "b"})
+	if remote.Signature != "" {
+		t.Errorf("Expected a remote event left unsigned, got %q", remote.Signature)
+	}
+}
+
+func TestReceiveVerifiesSignature(t *testing.T) {
+	sender := newTestSigner(t, SignatureReject)
+	sent := sender.Sign(Event{ID: "event-1", Message: "Hello", Timestamp: 5})
+	receive := func(server *Server, signature string) *httptest.ResponseRecorder {
+		query := url.Values{
+			"timestamp": {"5"}, "message": {"Hello"}, "sender": {"b"},
+			"id": {sent.ID}, "signature": {signature}, "key_id": {sent.KeyID},
+		}
+		req := httptest.NewRequest(http.MethodPost, "/message?"+query.Encode(), nil)
+		w := httptest.NewRecorder()
+		server.handleReceiveMessage(w, req)
+		return w
+	}
+	public := sender.key.Public().(ed25519.PublicKey)
+
+	server := NewServer()
+	server.signer = newTestSigner(t, SignatureReject, public)
+	if w := receive(server, sent.Signature); w.Code != http.StatusOK {
+		t.Errorf("Expected a valid signature accepted, got %d", w.Code)
+	}
+	forged := sender.Sign(Event{ID: "event-1", Message: "Goodbye", Timestamp: 5}).Signature
+	if w := receive(server, forged); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for a forged signature, got %d", w.Code)
+	}
+
+	flagging := NewServer()
+	flagging.signer = newTestSigner(t, SignatureFlag, public)
+	w := receive(flagging, forged)
+	var event Event
+	json.NewDecoder(w.Body).Decode(&event)
+	if w.Code != http.StatusOK || !event.InvalidSignature {
+		t.Errorf("Expected the event accepted and flagged, got %d %+v", w.Code, event)
+	}
+	if got := flagging.metrics.Value("lamport_signature_failures_total", "source", "receive", "policy", "flag"); got != 1 {
+		t.Errorf("Expected 1 failure counted, got %v", got)
+	}
+}
+
+func TestBridgedSignatures(t *testing.T) {
+	sender := newTestSigner(t, SignatureReject)
+	sent := sender.Sign(Event{ID: "event-1", Message: "Hello", Timestamp: 5})
+	headers := clockHeaders(sent, "b")
+	if headers[headerSignature] != sent.Signature || headers[headerKeyID] != sent.KeyID {
+		t.Fatalf("Expected signature headers, got %v", headers)
+	}
+
+	server := NewServer()
+	server.signer = newTestSigner(t, SignatureReject, sender.key.Public().(ed25519.PublicKey))
+	get := func(k string) string { return headers[k] }
+	if _, ok, err := server.receiveBridged("nats", get, "Hello"); !ok || err != nil {
+		t.Errorf("Expected the signed message merged, got %v %v", ok, err)
+	}
+	if _, _, err := server.receiveBridged("nats", get, "Tampered"); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+func TestImportVerifiesSignature(t *testing.T) {
+	origin := newTestSigner(t, SignatureReject)
+	signed := origin.Sign(Event{ID: "old-1", Message: "Hello", Timestamp: 4})
+
+	server := NewServer()
+	server.signer = newTestSigner(t, SignatureReject, origin.key.Public().(ed25519.PublicKey))
+	record := LegacyRecord{ID: signed.ID, Message: "Goodbye", WallTime: time.Now(),
+		Timestamp: 4, Signature: signed.Signature, KeyID: signed.KeyID}
+	body, _ := json.Marshal([]LegacyRecord{record})
+	req := httptest.NewRequest(http.MethodPost, "/admin/import", strings.NewReader(string(body)))
+	w := httptest.NewRecorder()
+	server.handleImport(w, req)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for a tampered record, got %d", w.Code)
+	}
+
+	record.Message = "Hello"
+	body, _ = json.Marshal([]LegacyRecord{record})
+	req = httptest.NewRequest(http.MethodPost, "/admin/import", strings.NewReader(string(body)))
+	w = httptest.NewRecorder()
+	server.handleImport(w, req)
+	var response struct {
+		Events []Event `json:"events"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	if w.Code != http.StatusOK || len(response.Events) != 1 {
+		t.Fatalf("Expected the record imported, got %d", w.Code)
+	}
+	if err := server.signer.VerifyEvent(response.Events[0]); err != nil {
+		t.Errorf("Expected the imported event signed by this node, got %v", err)
+	}
+}
+
+func TestHandleKeys(t *testing.T) {
+	server := NewServer()
+	server.signer = newTestSigner(t, SignatureFlag)
+
+	req := httptest.NewRequest(http.MethodGet, "/keys", nil)
+	w := httptest.NewRecorder()
+	server.handleKeys(w, req)
+
+	var response map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&response)
+	if response["key_id"] != server.signer.KeyID() || response["policy"] != "flag" {
+		t.Errorf("Expected the key ID and policy, got %v", response)
+	}
+	keys, err := parsePublicKeys([]byte(response["public_key"].(string)))
+	if err != nil || len(keys) != 1 || keyFingerprint(keys[0]) != server.signer.KeyID() {
+		t.Errorf("Expected the PEM public key, got %v %v", keys, err)
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultSkewSamples is how many events are sampled without -skew-samples
+const defaultSkewSamples = 10000
+
+// Defaults of GET /analytics/skew
+const (
+	defaultSkewInterval = time.Second
+	defaultSkewBurst    = 1000 // ticks per second
+	defaultSkewIdle     = 10 * time.Second
+)
+
+// skewBounds are the upper bounds, in ticks per second, of the rate
+// histogram buckets. The last bucket is unbounded.
+var skewBounds = []float64{1, 10, 100, 1000, 10000}
+
+// skewSample is the wall time at which the clock stood at a logged event
+type skewSample struct {
+	wall time.Time
+	at   ClockTime
+}
+
+// SkewTracker samples wall and Lamport time at each event appended to the
+// log, in a ring, so the rate of the clock can be told apart from the rate
+// of wall time. A nil tracker records nothing.
+type SkewTracker struct {
+	samples []skewSample
+	next    uint64 // number of samples recorded
+	mutex   sync.RWMutex
+}
+
+// NewSkewTracker keeps up to capacity samples
+func NewSkewTracker(capacity int) *SkewTracker {
+	return &SkewTracker{samples: make([]skewSample, capacity)}
+}
+
+func (st *SkewTracker) record(at ClockTime, wall time.Time) {
+	if st == nil || len(st.samples) == 0 {
+		return
+	}
+	st.mutex.Lock()
+	st.samples[st.next%uint64(len(st.samples))] = skewSample{wall: wall, at: at}
+	st.next++
+	st.mutex.Unlock()
+}
+
+// since returns the kept samples taken at or after from, oldest first
+func (st *SkewTracker) since(from time.Time) []skewSample {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	n := min(st.next, uint64(len(st.samples)))
+	out := make([]skewSample, 0, n)
+	for seq := st.next - n; seq < st.next; seq++ {
+		if s := st.samples[seq%uint64(len(st.samples))]; !s.wall.Before(from) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Total is the number of samples recorded since the start
+func (st *SkewTracker) Total() uint64 {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	return st.next
+}
+
+// SkewBucket counts the intervals whose tick rate was at least Min and
+// below Max, unbounded when Max is zero
+type SkewBucket struct {
+	Min       float64 `json:"min"`
+	Max       float64 `json:"max,omitempty"`
+	Intervals int     `json:"intervals"`
+}
+
+// SkewBurst is a run of intervals in which the clock ticked at the burst
+// rate or faster
+type SkewBurst struct {
+	Start          time.Time `json:"start"`
+	End            time.Time `json:"end"`
+	From           ClockTime `json:"from"`
+	To             ClockTime `json:"to"`
+	Ticks          int64     `json:"ticks"`
+	Events         int       `json:"events"`
+	TicksPerSecond float64   `json:"ticks_per_second"`
+}
+
+// SkewIdle is a period without events. An ongoing one ends now.
+type SkewIdle struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Duration string    `json:"duration"`
+	At       ClockTime `json:"at"`
+	Ongoing  bool      `json:"ongoing,omitempty"`
+}
+
+// SkewReport relates the advance of the Lamport clock to wall time over the
+// sampled events
+type SkewReport struct {
+	Samples            int          `json:"samples"`
+	Start              time.Time    `json:"start,omitzero"`
+	End                time.Time    `json:"end,omitzero"`
+	Ticks              int64        `json:"ticks"`
+	TicksPerSecond     float64      `json:"ticks_per_second"`
+	EventsPerSecond    float64      `json:"events_per_second"`
+	PeakTicksPerSecond float64      `json:"peak_ticks_per_second"`
+	Interval           string       `json:"interval"`
+	Histogram          []SkewBucket `json:"histogram"`
+	Bursts             []SkewBurst  `json:"bursts"`
+	Idle               []SkewIdle   `json:"idle"`
+}
+
+// skewInterval is what happened to the clock in one interval of wall time
+type skewInterval struct {
+	index    int64 // intervals since the zero time
+	ticks    int64
+	events   int
+	from, to ClockTime
+}
+
+// ticksBetween is how far the clock advanced from a to b. Across epochs
+// only the ticks of the new epoch are known.
+func ticksBetween(a, b ClockTime) int64 {
+	switch {
+	case a.Epoch == b.Epoch:
+		return max(b.Timestamp-a.Timestamp, 0)
+	case a.Epoch < b.Epoch:
+		return b.Timestamp
+	default:
+		return 0
+	}
+}
+
+// analyzeSkew cuts the samples, oldest first, into intervals of wall time
+// and reports their tick rates. Intervals at burst ticks per second or more
+// make bursts; gaps between events of idle or more, including the one up to
+// now, are idle periods.
+func analyzeSkew(samples []skewSample, now time.Time, interval time.Duration, burst float64, idle time.Duration) SkewReport {
+	report := SkewReport{
+		Samples:   len(samples),
+		Interval:  interval.String(),
+		Histogram: make([]SkewBucket, len(skewBounds)+1),
+		Bursts:    []SkewBurst{},
+		Idle:      []SkewIdle{},
+	}
+	for i := range report.Histogram {
+		if i > 0 {
+			report.Histogram[i].Min = skewBounds[i-1]
+		}
+		if i < len(skewBounds) {
+			report.Histogram[i].Max = skewBounds[i]
+		}
+	}
+	if len(samples) == 0 {
+		return report
+	}
+
+	// Wall clocks may step back; the samples are kept in order regardless
+	var intervals []skewInterval
+	wall := samples[0].wall
+	for i, s := range samples {
+		if s.wall.After(wall) {
+			wall = s.wall
+		}
+		var ticks int64
+		if i > 0 {
+			prev := samples[i-1]
+			ticks = ticksBetween(prev.at, s.at)
+			report.Ticks += ticks
+			if gap := wall.Sub(prev.wall); gap >= idle {
+				report.Idle = append(report.Idle, SkewIdle{Start: prev.wall, End: wall, Duration: gap.String(), At: prev.at})
+			}
+		}
+		index := wall.UnixNano() / int64(interval)
+		if n := len(intervals); n == 0 || intervals[n-1].index != index {
+			intervals = append(intervals, skewInterval{index: index, from: s.at})
+		}
+		current := &intervals[len(intervals)-1]
+		current.ticks += ticks
+		current.events++
+		current.to = s.at
+		samples[i].wall = wall
+	}
+	last := samples[len(samples)-1]
+	report.Start, report.End = samples[0].wall, last.wall
+	if gap := now.Sub(last.wall); gap >= idle {
+		report.Idle = append(report.Idle, SkewIdle{Start: last.wall, End: now, Duration: gap.String(), At: last.at, Ongoing: true})
+	}
+	if span := report.End.Sub(report.Start).Seconds(); span > 0 {
+		report.TicksPerSecond = float64(report.Ticks) / span
+		report.EventsPerSecond = float64(len(samples)-1) / span
+	}
+
+	// Intervals without events fall in the first bucket
+	seconds := interval.Seconds()
+	report.Histogram[0].Intervals = int(intervals[len(intervals)-1].index-intervals[0].index+1) - len(intervals)
+	var open *SkewBurst
+	for i, in := range intervals {
+		rate := float64(in.ticks) / seconds
+		report.PeakTicksPerSecond = max(report.PeakTicksPerSecond, rate)
+		bucket := 0
+		for bucket < len(skewBounds) && rate >= skewBounds[bucket] {
+			bucket++
+		}
+		report.Histogram[bucket].Intervals++
+
+		if rate < burst {
+			open = nil
+			continue
+		}
+		start := time.Unix(0, in.index*int64(interval))
+		if open == nil || intervals[i-1].index != in.index-1 {
+			report.Bursts = append(report.Bursts, SkewBurst{Start: start, From: in.from})
+			open = &report.Bursts[len(report.Bursts)-1]
+		}
+		open.End = start.Add(interval)
+		open.To = in.to
+		open.Ticks += in.ticks
+		open.Events += in.events
+		open.TicksPerSecond = float64(open.Ticks) / open.End.Sub(open.Start).Seconds()
+	}
+	return report
+}
+
+// handleSkew reports how fast the clock advanced against wall time over
+// the sampled events. Parameters: window, how far back to look (all kept
+// samples by default), interval, the width of the histogram intervals,
+// burst, the tick rate of a burst, and idle, the shortest idle period.
+func (s *Server) handleSkew(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.skew == nil {
+		http.Error(w, "Skew analytics disabled (-skew-samples 0)", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	duration := func(name string, value time.Duration) (time.Duration, bool) {
+		v := query.Get(name)
+		if v == "" {
+			return value, true
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid "+name+" parameter", http.StatusBadRequest)
+			return 0, false
+		}
+		return d, true
+	}
+	window, ok := duration("window", 0)
+	if !ok {
+		return
+	}
+	interval, ok := duration("interval", defaultSkewInterval)
+	if !ok {
+		return
+	}
+	idle, ok := duration("idle", defaultSkewIdle)
+	if !ok {
+		return
+	}
+	burst := float64(defaultSkewBurst)
+	if v := query.Get("burst"); v != "" {
+		var err error
+		if burst, err = strconv.ParseFloat(v, 64); err != nil || !(burst > 0) {
+			http.Error(w, "Invalid burst parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	now := time.Now()
+	var from time.Time
+	if window > 0 {
+		from = now.Add(-window)
+	}
+	report := analyzeSkew(s.skew.since(from), now, interval, burst, idle)
+
+	current := s.clock.Now()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Current  int64  `json:"current_timestamp"`
+		Epoch    int64  `json:"epoch"`
+		Recorded uint64 `json:"recorded"`
+		Capacity int    `json:"capacity"`
+		SkewReport
+	}{current.Timestamp, current.Epoch, s.skew.Total(), len(s.skew.samples), report})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAnalyzeSkew(t *testing.T) {
+	base := time.Unix(1000, 0)
+	var samples []skewSample
+	// One event a second for 5s, a tight loop of about 5000 ticks in the next
+	// second, then nothing for a minute
+	for i := range 5 {
+		samples = append(samples, skewSample{wall: base.Add(time.Duration(i) * time.Second), at: ClockTime{Timestamp: int64(i + 1)}})
+	}
+	for i := range 50 {
+		samples = append(samples, skewSample{wall: base.Add(5*time.Second + time.Duration(i)*time.Millisecond), at: ClockTime{Timestamp: int64(100 * (i + 1))}})
+	}
+	samples = append(samples, skewSample{wall: base.Add(65 * time.Second), at: ClockTime{Timestamp: 5001}})
+
+	report := analyzeSkew(samples, base.Add(80*time.Second), time.Second, 1000, 10*time.Second)
+	if report.Samples != 56 || report.Ticks != 5000 || report.TicksPerSecond != 5000.0/65 {
+		t.Errorf("Expected 5000 ticks over 65s, got %+v", report)
+	}
+	if report.PeakTicksPerSecond != 4995 {
+		t.Errorf("Expected a peak of 4995 ticks/s, got %v", report.PeakTicksPerSecond)
+	}
+	if len(report.Bursts) != 1 || !report.Bursts[0].Start.Equal(base.Add(5*time.Second)) || report.Bursts[0].Events != 50 {
+		t.Errorf("Expected one burst of 50 events at 5s, got %+v", report.Bursts)
+	}
+	if len(report.Idle) != 2 || report.Idle[0].Duration != "59.951s" || report.Idle[0].At.Timestamp != 5000 || !report.Idle[1].Ongoing {
+		t.Errorf("Expected the pause after the burst and the ongoing gap, got %+v", report.Idle)
+	}
+	// 66 intervals: 59 empty and the first event without ticks, 4 at one
+	// tick per second and the event after the pause, and the burst
+	counts := []int{59 + 1, 4 + 1, 0, 0, 1, 0}
+	for i, b := range report.Histogram {
+		if b.Intervals != counts[i] {
+			t.Errorf("Bucket [%v, %v): expected %d intervals, got %d", b.Min, b.Max, counts[i], b.Intervals)
+		}
+	}
+}
+
+func TestAnalyzeSkewEpochsAndWallSteps(t *testing.T) {
+	base := time.Unix(1000, 0)
+	samples := []skewSample{
+		{wall: base, at: ClockTime{Timestamp: 10}},
+		{wall: base.Add(-time.Hour), at: ClockTime{Timestamp: 11}}, // wall clock stepped back
+		{wall: base.Add(time.Second), at: ClockTime{Epoch: 1, Timestamp: 2}},
+	}
+	report := analyzeSkew(samples, base.Add(time.Second), time.Second, 1000, time.Minute)
+	if report.Ticks != 3 || !report.Start.Equal(base) || len(report.Idle) != 0 {
+		t.Errorf("Expected 3 ticks from the start, without idle periods, got %+v", report)
+	}
+}
+
+func TestHandleSkew(t *testing.T) {
+	server := NewServer()
+	server.logEvent("e1", "One")
+	server.clock.Update(50)
+	server.logEvent("e2", "Two")
+
+	w := httptest.NewRecorder()
+	server.handleSkew(w, httptest.NewRequest(http.MethodGet, "/analytics/skew?window=1m&burst=1", nil))
+	var report struct {
+		Recorded uint64 `json:"recorded"`
+		SkewReport
+	}
+	json.NewDecoder(w.Body).Decode(&report)
+	if w.Code != http.StatusOK || report.Recorded != 2 || report.Ticks != 51 || len(report.Histogram) != 6 {
+		t.Errorf("Expected the two events 51 ticks apart, got %d %+v", w.Code, report)
+	}
+
+	for _, query := range []string{"window=-1m", "interval=soon", "burst=0", "idle=0s"} {
+		w := httptest.NewRecorder()
+		server.handleSkew(w, httptest.NewRequest(http.MethodGet, "/analytics/skew?"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, w.Code)
+		}
+	}
+
+	server.skew = nil
+	w = httptest.NewRecorder()
+	server.handleSkew(w, httptest.NewRequest(http.MethodGet, "/analytics/skew", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 when disabled, got %d", w.Code)
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite" // pure Go driver, registered as "sqlite"
+)
+
+// Limits of POST /query
+const (
+	maxQueryRows    = 10000
+	maxQueryTimeout = 10 * time.Second
+)
+
+// sqliteSchema is the events table and its indexes. Each row holds the
+// event's JSON encoding, from which it is read back, next to columns of
+// the fields worth querying by. seq is the position in the log.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS events (
+	seq               INTEGER PRIMARY KEY,
+	id                TEXT    NOT NULL,
+	epoch             INTEGER NOT NULL,
+	lamport_timestamp INTEGER NOT NULL,
+	wall_time         TEXT    NOT NULL,
+	node              TEXT    NOT NULL,
+	type              TEXT    NOT NULL,
+	message           TEXT    NOT NULL,
+	sender            TEXT    NOT NULL,
+	hash              TEXT    NOT NULL,
+	data              TEXT    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS events_time ON events (epoch, lamport_timestamp, seq);
+CREATE INDEX IF NOT EXISTS events_id ON events (id, seq);
+CREATE TABLE IF NOT EXISTS store_state (
+	key   TEXT PRIMARY KEY,
+	value INTEGER NOT NULL
+);
+`
+
+// SQLiteStore keeps the event log in an SQLite database, so it survives
+// restarts and can be queried with SQL. The EventStore methods do not
+// return errors; failed statements are logged, and reads then return what
+// they have.
+type SQLiteStore struct {
+	db       *sql.DB
+	readOnly *sql.DB // connections of POST /query, which cannot write
+	logger   *slog.Logger
+	mutex    sync.Mutex // orders appends so seq follows the log
+}
+
+// OpenSQLiteStore opens or creates the database at path
+func OpenSQLiteStore(path string, logger *slog.Logger) (*SQLiteStore, error) {
+	dsn := func(params string) string {
+		return "file:" + (&url.URL{Path: path}).EscapedPath() + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)" + params
+	}
+	db, err := sql.Open("sqlite", dsn("&_pragma=synchronous(NORMAL)"))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating schema: %w", err)
+	}
+	readOnly, err := sql.Open("sqlite", dsn("&mode=ro&_pragma=query_only(1)"))
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteStore{db: db, readOnly: readOnly, logger: logger}, nil
+}
+
+// Close releases the database
+func (st *SQLiteStore) Close() error {
+	return errors.Join(st.readOnly.Close(), st.db.Close())
+}
+
+// execer is a database or a transaction
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// insertEvent stores an event at position seq, or after the last one when
+// seq is nil
+func insertEvent(db execer, seq any, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO events (seq, id, epoch, lamport_timestamp, wall_time, node, type, message, sender, hash, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		seq, e.ID, e.Epoch, e.Timestamp, e.WallTime.UTC().Format(time.RFC3339Nano),
+		e.Node, e.Type, e.Message, e.Sender, e.Hash, string(data))
+	return err
+}
+
+func (st *SQLiteStore) Append(event Event) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	if err := insertEvent(st.db, nil, event); err != nil {
+		st.logger.Error("Failed to store event", "event_id", event.ID, "error", err)
+	}
+}
+
+// events decodes the events a query selects by their data column
+func (st *SQLiteStore) events(query string, args ...any) []Event {
+	rows, err := st.db.Query(query, args...)
+	if err != nil {
+		st.logger.Error("Failed to read events", "error", err)
+		return nil
+	}
+	defer rows.Close()
+	var events []Event
+	for rows.Next() {
+		var data []byte
+		var e Event
+		if err := rows.Scan(&data); err == nil {
+			err = json.Unmarshal(data, &e)
+		}
+		if err != nil {
+			st.logger.Error("Failed to decode stored event", "error", err)
+			continue
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		st.logger.Error("Failed to read events", "error", err)
+	}
+	return events
+}
+
+func (st *SQLiteStore) Events() []Event {
+	events := st.events(`SELECT data FROM events ORDER BY seq`)
+	if events == nil {
+		events = []Event{}
+	}
+	return events
+}
+
+func (st *SQLiteStore) Len() int {
+	var n int
+	if err := st.db.QueryRow(`SELECT COUNT(*) FROM events`).Scan(&n); err != nil {
+		st.logger.Error("Failed to count events", "error", err)
+	}
+	return n
+}
+
+// Replace swaps the table's rows in one transaction
+func (st *SQLiteStore) Replace(events []Event) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	err := st.inTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM events`); err != nil {
+			return err
+		}
+		for i, e := range events {
+			if err := insertEvent(tx, int64(i), e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		st.logger.Error("Failed to replace events", "error", err)
+	}
+}
+
+func (st *SQLiteStore) Dropped() int64 {
+	var n int64
+	err := st.db.QueryRow(`SELECT value FROM store_state WHERE key = 'dropped'`).Scan(&n)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		st.logger.Error("Failed to read dropped count", "error", err)
+	}
+	return n
+}
+
+func (st *SQLiteStore) Trim(n int) []Event {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	trimmed := st.events(`SELECT data FROM events ORDER BY seq LIMIT ?`, max(n, 0))
+	if len(trimmed) == 0 {
+		return trimmed
+	}
+	err := st.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM events WHERE seq IN (SELECT seq FROM events ORDER BY seq LIMIT ?)`, len(trimmed))
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO store_state (key, value) VALUES ('dropped', ?)
+			ON CONFLICT (key) DO UPDATE SET value = value + excluded.value`, len(trimmed))
+		return err
+	})
+	if err != nil {
+		st.logger.Error("Failed to trim events", "error", err)
+		return nil
+	}
+	return trimmed
+}
+
+// Between uses the index on epoch, timestamp and position
+func (st *SQLiteStore) Between(from, to ClockTime) []Event {
+	return st.events(`SELECT data FROM events
+		WHERE (epoch, lamport_timestamp) >= (?, ?) AND (epoch, lamport_timestamp) <= (?, ?)
+		ORDER BY epoch, lamport_timestamp, seq`,
+		from.Epoch, from.Timestamp, to.Epoch, to.Timestamp)
+}
+
+func (st *SQLiteStore) Find(id string) (Event, bool) {
+	events := st.events(`SELECT data FROM events WHERE id = ? ORDER BY seq LIMIT 1`, id)
+	if len(events) == 0 {
+		return Event{}, false
+	}
+	return events[0], true
+}
+
+// Search scans the messages; instr, unlike LIKE, is case sensitive
+func (st *SQLiteStore) Search(text string) []Event {
+	return st.events(`SELECT data FROM events WHERE instr(message, ?) > 0 ORDER BY seq`, text)
+}
+
+func (st *SQLiteStore) inTx(f func(tx *sql.Tx) error) error {
+	tx, err := st.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// resumeLog continues the hash chain and the clock from the events a
+// durable store kept across restarts
+func (s *Server) resumeLog() {
+	events := s.events.Events()
+	if len(events) == 0 {
+		return
+	}
+	s.mutex.Lock()
+	s.head = events[len(events)-1].Hash
+	for _, e := range events {
+		s.observeLocked(e)
+	}
+	latest := s.latest
+	s.mutex.Unlock()
+	s.clock.restore(latest, 0)
+	s.logger.Info("Event log resumed", "count", len(events), "lamport_timestamp", latest.Timestamp)
+}
+
+// QueryResult is the outcome of a read-only SQL query
+type QueryResult struct {
+	Columns   []string        `json:"columns"`
+	Rows      [][]interface{} `json:"rows"`
+	Truncated bool            `json:"truncated,omitempty"`
+}
+
+// Query runs a read-only SQL query on connections that refuse writes,
+// returning up to maxQueryRows rows
+func (st *SQLiteStore) Query(ctx context.Context, query string, args ...any) (*QueryResult, error) {
+	rows, err := st.readOnly.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := &QueryResult{Columns: columns, Rows: [][]interface{}{}}
+	for rows.Next() {
+		if len(result.Rows) == maxQueryRows {
+			result.Truncated = true
+			break
+		}
+		row := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range row {
+			ptrs[i] = &row[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		for i, v := range row {
+			if b, ok := v.([]byte); ok {
+				row[i] = string(b)
+			}
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, rows.Err()
+}
+
+// handleQuery runs read-only SQL against the events table, POST /query
+// with a JSON body holding sql and optionally args for its placeholders
+func (st *SQLiteStore) handleQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		SQL  string        `json:"sql"`
+		Args []interface{} `json:"args"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(body.SQL) == "" {
+		http.Error(w, "Missing sql", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), maxQueryTimeout)
+	defer cancel()
+	result, err := st.Query(ctx, body.SQL, body.Args...)
+	if err != nil {
+		http.Error(w, "Query failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
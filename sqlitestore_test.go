@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func openTestSQLiteStore(t *testing.T, path string) *SQLiteStore {
+	t.Helper()
+	st, err := OpenSQLiteStore(path, slog.Default())
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+func TestSQLiteStore(t *testing.T) {
+	st := openTestSQLiteStore(t, filepath.Join(t.TempDir(), "events.db"))
+	for i := 1; i <= 5; i++ {
+		st.Append(Event{ID: fmt.Sprintf("e%d", i), Timestamp: int64(6 - i), Message: fmt.Sprintf("Event %d", i)})
+	}
+	st.Append(Event{ID: "e6", Epoch: 1, Timestamp: 1, Message: "event"})
+
+	if events := st.Events(); len(events) != 6 || events[0].ID != "e1" || events[5].ID != "e6" || st.Len() != 6 {
+		t.Errorf("Expected e1 to e6 in log order, got %v", events)
+	}
+	between := st.Between(ClockTime{Timestamp: 2}, ClockTime{Epoch: 1, Timestamp: 0})
+	if got := fmt.Sprint(eventIDs(between)); got != "[e4 e3 e2 e1]" {
+		t.Errorf("Expected e4 to e1 by time, got %s", got)
+	}
+	if e, ok := st.Find("e3"); !ok || e.Timestamp != 3 {
+		t.Errorf("Expected to find e3, got %+v", e)
+	}
+	if found := st.Search("Event"); len(found) != 5 {
+		t.Errorf("Expected a case sensitive search, got %v", eventIDs(found))
+	}
+
+	if trimmed := st.Trim(2); len(trimmed) != 2 || trimmed[1].ID != "e2" || st.Dropped() != 2 || st.Len() != 4 {
+		t.Errorf("Expected e1 and e2 trimmed, got %v with %d dropped", eventIDs(trimmed), st.Dropped())
+	}
+	st.Append(Event{ID: "e7"})
+	if events := st.Events(); events[0].ID != "e3" || events[len(events)-1].ID != "e7" {
+		t.Errorf("Expected appends after a trim at the end, got %v", eventIDs(events))
+	}
+	st.Replace([]Event{{ID: "a"}, {ID: "b"}})
+	if got := fmt.Sprint(eventIDs(st.Events())); got != "[a b]" {
+		t.Errorf("Expected the log replaced, got %s", got)
+	}
+}
+
+func TestSQLiteStoreResumesLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.db")
+	server := NewServer()
+	server.events = openTestSQLiteStore(t, path)
+	server.logEvent("e1", "One")
+	server.clock.Update(10)
+	server.logEvent("e2", "Two")
+
+	restarted := NewServer()
+	restarted.events = openTestSQLiteStore(t, path)
+	restarted.resumeLog()
+	if now := restarted.clock.GetTime(); now != 12 {
+		t.Errorf("Expected the clock resumed at 12, got %d", now)
+	}
+	restarted.logEvent("e3", "Three")
+	if verified := verifyLog(t, restarted); verified["valid"] != true || verified["event_count"] != float64(3) {
+		t.Errorf("Expected the chain continued across the restart, got %v", verified)
+	}
+}
+
+func TestHandleQuery(t *testing.T) {
+	st := openTestSQLiteStore(t, filepath.Join(t.TempDir(), "events.db"))
+	for i := 1; i <= 3; i++ {
+		st.Append(Event{ID: fmt.Sprintf("e%d", i), Node: "node-a", Timestamp: int64(i)})
+	}
+
+	query := func(body string) (*httptest.ResponseRecorder, QueryResult) {
+		w := httptest.NewRecorder()
+		st.handleQuery(w, httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(body)))
+		var result QueryResult
+		json.NewDecoder(w.Body).Decode(&result)
+		return w, result
+	}
+
+	w, result := query(`{"sql":"SELECT node, COUNT(*) AS n, MAX(lamport_timestamp) FROM events WHERE lamport_timestamp >= ? GROUP BY node","args":[2]}`)
+	if w.Code != http.StatusOK || fmt.Sprint(result.Columns) != "[node n MAX(lamport_timestamp)]" || fmt.Sprint(result.Rows) != "[[node-a 2 3]]" {
+		t.Errorf("Expected 2 events of node-a up to 3, got %d %+v", w.Code, result)
+	}
+
+	for _, body := range []string{
+		`{"sql":"DELETE FROM events"}`,
+		`{"sql":"INSERT INTO store_state VALUES ('x', 1)"}`,
+		`{"sql":"SELECT * FROM nowhere"}`,
+		`{"sql":" "}`,
+		`{"sql":`,
+	} {
+		if w, _ := query(body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, w.Code)
+		}
+	}
+	if st.Len() != 3 {
+		t.Errorf("Expected the events untouched, got %d", st.Len())
+	}
+}
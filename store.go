@@ -0,0 +1,436 @@
+package main
+
+import (
+	"hash/fnv"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// EventStore holds the event log in the order events were appended
+type EventStore interface {
+	// Append adds an event at the end of the log
+	Append(event Event)
+	// Events returns a copy of the log in order
+	Events() []Event
+	// Len is the number of events in the log
+	Len() int
+	// Replace swaps the whole log, as imports and snapshot restores do
+	Replace(events []Event)
+	// Dropped is the number of events discarded to stay within capacity or
+	// trimmed off
+	Dropped() int64
+	// Trim drops the n oldest events, counting them as dropped, and returns
+	// them in order
+	Trim(n int) []Event
+	// Between returns the events stamped from from to to, inclusive, ordered
+	// by time and then by position, looked up in an index on their time
+	Between(from, to ClockTime) []Event
+	// Find returns the first event with the ID, looked up in an index
+	Find(id string) (Event, bool)
+	// Search returns the events whose message contains text, in order,
+	// narrowed down by an index on the trigrams of the messages
+	Search(text string) []Event
+}
+
+// checkedStore is an event store whose writes can fail, such as WALStore.
+// A failed write leaves the log as it was and is returned by the checked
+// variants of the writes, while Append, Trim and Replace only report it.
+type checkedStore interface {
+	appendChecked(event Event) error
+	// appendAllChecked appends all of the events or none of them
+	appendAllChecked(events []Event) error
+	trimChecked(n int) ([]Event, error)
+	replaceChecked(events []Event) error
+	// writeErr returns the failure that keeps the store from taking writes
+	writeErr() error
+}
+
+// appendChecked appends to st, returning why the event was not stored
+func appendChecked(st EventStore, event Event) error {
+	if checked, ok := st.(checkedStore); ok {
+		return checked.appendChecked(event)
+	}
+	st.Append(event)
+	return nil
+}
+
+// appendAllChecked appends the events to st at once, returning why none of
+// them were stored
+func appendAllChecked(st EventStore, events []Event) error {
+	if checked, ok := st.(checkedStore); ok {
+		return checked.appendAllChecked(events)
+	}
+	for _, event := range events {
+		st.Append(event)
+	}
+	return nil
+}
+
+// trimChecked trims st, returning why the events were not trimmed
+func trimChecked(st EventStore, n int) ([]Event, error) {
+	if checked, ok := st.(checkedStore); ok {
+		return checked.trimChecked(n)
+	}
+	return st.Trim(n), nil
+}
+
+// replaceChecked replaces the log of st, returning why it was kept
+func replaceChecked(st EventStore, events []Event) error {
+	if checked, ok := st.(checkedStore); ok {
+		return checked.replaceChecked(events)
+	}
+	st.Replace(events)
+	return nil
+}
+
+// storeWriteErr returns the failure that keeps st from taking writes
+func storeWriteErr(st EventStore) error {
+	if checked, ok := st.(checkedStore); ok {
+		return checked.writeErr()
+	}
+	return nil
+}
+
+const defaultEventShards = 16
+
+// ShardedStore spreads the event log over shards by hash of the event ID,
+// each with its own lock, so appends only contend with reads and appends of
+// the same shard. Every event carries its position in the log and reads
+// merge the shards back into order.
+type ShardedStore struct {
+	shards  []eventShard
+	next    atomic.Int64 // position of the next appended event
+	first   atomic.Int64 // position of the oldest event kept
+	dropped atomic.Int64
+}
+
+type eventShard struct {
+	events []storedEvent
+	index  logIndex
+	mutex  sync.RWMutex
+}
+
+type storedEvent struct {
+	seq   int64
+	event Event
+}
+
+// NewShardedStore creates an empty store with n shards
+func NewShardedStore(n int) *ShardedStore {
+	return &ShardedStore{shards: make([]eventShard, max(n, 1))}
+}
+
+func (st *ShardedStore) shardOf(id string) *eventShard {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return &st.shards[h.Sum32()%uint32(len(st.shards))]
+}
+
+func (st *ShardedStore) Append(event Event) {
+	shard := st.shardOf(event.ID)
+	shard.mutex.Lock()
+	// Taken under the shard lock, so each shard is ordered by position
+	seq := st.next.Add(1) - 1
+	shard.events = append(shard.events, storedEvent{seq, event})
+	shard.index.add(seq, event)
+	shard.mutex.Unlock()
+}
+
+// find returns the event at position seq, as shards are ordered by position
+func (shard *eventShard) find(seq int64) (Event, bool) {
+	i := sort.Search(len(shard.events), func(i int) bool { return shard.events[i].seq >= seq })
+	if i == len(shard.events) || shard.events[i].seq != seq {
+		return Event{}, false
+	}
+	return shard.events[i].event, true
+}
+
+// Events merges the shards by position. An append that has taken its
+// position but not yet reached its shard leaves a gap; the log is cut
+// there, so readers always see a prefix of it.
+func (st *ShardedStore) Events() []Event {
+	parts := make([][]storedEvent, len(st.shards))
+	total := 0
+	for i := range st.shards {
+		shard := &st.shards[i]
+		shard.mutex.RLock()
+		parts[i] = shard.events[:len(shard.events):len(shard.events)]
+		shard.mutex.RUnlock()
+		total += len(parts[i])
+	}
+
+	// Shards were read one by one; trimmed positions are skipped
+	first := st.first.Load()
+	events := make([]Event, total)
+	filled := make([]bool, total)
+	for _, part := range parts {
+		for _, stored := range part {
+			if i := stored.seq - first; i >= 0 && i < int64(total) {
+				events[i] = stored.event
+				filled[i] = true
+			}
+		}
+	}
+	for i, ok := range filled {
+		if !ok {
+			return events[:i]
+		}
+	}
+	return events
+}
+
+func (st *ShardedStore) Len() int {
+	n := 0
+	for i := range st.shards {
+		shard := &st.shards[i]
+		shard.mutex.RLock()
+		n += len(shard.events)
+		shard.mutex.RUnlock()
+	}
+	return n
+}
+
+// Dropped counts the trimmed events, as the sharded store otherwise grows
+// without bound
+func (st *ShardedStore) Dropped() int64 { return st.dropped.Load() }
+
+func (st *ShardedStore) Trim(n int) []Event {
+	for i := range st.shards {
+		st.shards[i].mutex.Lock()
+		defer st.shards[i].mutex.Unlock()
+	}
+	first := st.first.Load()
+	cutoff := min(first+int64(max(n, 0)), st.next.Load())
+	var trimmed []storedEvent
+	for i := range st.shards {
+		shard := &st.shards[i]
+		k := sort.Search(len(shard.events), func(i int) bool { return shard.events[i].seq >= cutoff })
+		for _, stored := range shard.events[:k] {
+			shard.index.remove(stored.seq, stored.event)
+		}
+		trimmed = append(trimmed, shard.events[:k]...)
+		shard.events = slices.Delete(shard.events, 0, k)
+	}
+	st.first.Store(cutoff)
+	st.dropped.Add(int64(len(trimmed)))
+	sort.Slice(trimmed, func(i, j int) bool { return trimmed[i].seq < trimmed[j].seq })
+	return unstored(trimmed)
+}
+
+func (st *ShardedStore) Replace(events []Event) {
+	for i := range st.shards {
+		st.shards[i].mutex.Lock()
+		defer st.shards[i].mutex.Unlock()
+	}
+	for i := range st.shards {
+		st.shards[i].events = nil
+		st.shards[i].index.reset()
+	}
+	for seq, e := range events {
+		shard := st.shardOf(e.ID)
+		shard.events = append(shard.events, storedEvent{int64(seq), e})
+		shard.index.add(int64(seq), e)
+	}
+	st.next.Store(int64(len(events)))
+	st.first.Store(0)
+}
+
+// Between looks the times up in the index of every shard and merges the
+// hits by time and position
+func (st *ShardedStore) Between(from, to ClockTime) []Event {
+	var hits []storedEvent
+	for i := range st.shards {
+		shard := &st.shards[i]
+		shard.mutex.RLock()
+		for _, entry := range shard.index.times.between(from, to) {
+			if event, ok := shard.find(entry.seq); ok {
+				hits = append(hits, storedEvent{entry.seq, event})
+			}
+		}
+		shard.mutex.RUnlock()
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		a, b := hits[i], hits[j]
+		return timeEntry{a.event.clockTime(), a.seq}.less(timeEntry{b.event.clockTime(), b.seq})
+	})
+	return unstored(hits)
+}
+
+// Find only looks in the shard of the ID
+func (st *ShardedStore) Find(id string) (Event, bool) {
+	shard := st.shardOf(id)
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
+	if seq, ok := shard.index.first(id); ok {
+		return shard.find(seq)
+	}
+	return Event{}, false
+}
+
+func (st *ShardedStore) Search(text string) []Event {
+	var hits []storedEvent
+	for i := range st.shards {
+		shard := &st.shards[i]
+		shard.mutex.RLock()
+		if seqs, indexed := shard.index.search(text); indexed {
+			for _, seq := range seqs {
+				if event, ok := shard.find(seq); ok && strings.Contains(event.Message, text) {
+					hits = append(hits, storedEvent{seq, event})
+				}
+			}
+		} else {
+			for _, stored := range shard.events {
+				if strings.Contains(stored.event.Message, text) {
+					hits = append(hits, stored)
+				}
+			}
+		}
+		shard.mutex.RUnlock()
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].seq < hits[j].seq })
+	return unstored(hits)
+}
+
+func unstored(hits []storedEvent) []Event {
+	events := make([]Event, len(hits))
+	for i, hit := range hits {
+		events[i] = hit.event
+	}
+	return events
+}
+
+// RingStore keeps the newest events up to a fixed capacity, overwriting
+// the oldest ones, so memory stays bounded on small devices
+type RingStore struct {
+	events  []Event
+	start   int   // index of the oldest event
+	first   int64 // position in the log of the oldest event
+	n       int
+	dropped int64
+	index   logIndex
+	mutex   sync.RWMutex
+}
+
+// NewRingStore creates an empty store holding at most capacity events
+func NewRingStore(capacity int) *RingStore {
+	return &RingStore{events: make([]Event, max(capacity, 1))}
+}
+
+func (st *RingStore) Append(event Event) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	st.appendLocked(event)
+}
+
+func (st *RingStore) appendLocked(event Event) {
+	st.index.add(st.first+int64(st.n), event)
+	if st.n < len(st.events) {
+		st.events[(st.start+st.n)%len(st.events)] = event
+		st.n++
+		return
+	}
+	st.index.remove(st.first, st.events[st.start])
+	st.events[st.start] = event
+	st.start = (st.start + 1) % len(st.events)
+	st.first++
+	st.dropped++
+}
+
+func (st *RingStore) Events() []Event {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	events := make([]Event, st.n)
+	for i := range events {
+		events[i] = st.events[(st.start+i)%len(st.events)]
+	}
+	return events
+}
+
+func (st *RingStore) Len() int {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	return st.n
+}
+
+// Replace keeps the newest events that fit and counts the rest as dropped
+func (st *RingStore) Replace(events []Event) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	st.start, st.first, st.n = 0, 0, 0
+	st.index.reset()
+	clear(st.events)
+	for _, e := range events {
+		st.appendLocked(e)
+	}
+}
+
+func (st *RingStore) Trim(n int) []Event {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	trimmed := make([]Event, min(max(n, 0), st.n))
+	for i := range trimmed {
+		trimmed[i] = st.events[st.start]
+		st.index.remove(st.first, trimmed[i])
+		st.events[st.start] = Event{}
+		st.start = (st.start + 1) % len(st.events)
+		st.first++
+		st.n--
+		st.dropped++
+	}
+	return trimmed
+}
+
+func (st *RingStore) Dropped() int64 {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	return st.dropped
+}
+
+// Between only finds the events still kept
+func (st *RingStore) Between(from, to ClockTime) []Event {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	entries := st.index.times.between(from, to)
+	events := make([]Event, len(entries))
+	for i, entry := range entries {
+		events[i] = st.at(entry.seq)
+	}
+	return events
+}
+
+func (st *RingStore) Find(id string) (Event, bool) {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	if seq, ok := st.index.first(id); ok {
+		return st.at(seq), true
+	}
+	return Event{}, false
+}
+
+func (st *RingStore) Search(text string) []Event {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	var events []Event
+	if seqs, indexed := st.index.search(text); indexed {
+		for _, seq := range seqs {
+			if event := st.at(seq); strings.Contains(event.Message, text) {
+				events = append(events, event)
+			}
+		}
+		return events
+	}
+	for i := range st.n {
+		if event := st.events[(st.start+i)%len(st.events)]; strings.Contains(event.Message, text) {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// at returns the kept event at position seq in the log
+func (st *RingStore) at(seq int64) Event {
+	return st.events[(st.start+int(seq-st.first))%len(st.events)]
+}
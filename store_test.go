@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// lockedStore is the single lock slice the sharded store replaced, kept as
+// the baseline of the benchmarks
+type lockedStore struct {
+	events []Event
+	mutex  sync.RWMutex
+}
+
+func (st *lockedStore) Append(event Event) {
+	st.mutex.Lock()
+	st.events = append(st.events, event)
+	st.mutex.Unlock()
+}
+
+func (st *lockedStore) Events() []Event {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	return append([]Event(nil), st.events...)
+}
+
+func (st *lockedStore) Len() int {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	return len(st.events)
+}
+
+func (st *lockedStore) Dropped() int64 { return 0 }
+
+func (st *lockedStore) Trim(n int) []Event {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	trimmed := append([]Event(nil), st.events[:min(n, len(st.events))]...)
+	st.events = st.events[len(trimmed):]
+	return trimmed
+}
+
+func (st *lockedStore) Between(from, to ClockTime) []Event {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	var events []Event
+	for _, e := range st.events {
+		if at := e.clockTime(); !at.Before(from) && !to.Before(at) {
+			events = append(events, e)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].clockTime().Before(events[j].clockTime()) })
+	return events
+}
+
+func (st *lockedStore) Find(id string) (Event, bool) {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	for _, e := range st.events {
+		if e.ID == id {
+			return e, true
+		}
+	}
+	return Event{}, false
+}
+
+func (st *lockedStore) Search(text string) []Event {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	var events []Event
+	for _, e := range st.events {
+		if strings.Contains(e.Message, text) {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+func (st *lockedStore) Replace(events []Event) {
+	st.mutex.Lock()
+	st.events = events
+	st.mutex.Unlock()
+}
+
+func TestShardedStoreKeepsOrder(t *testing.T) {
+	st := NewShardedStore(4)
+	for i := 0; i < 50; i++ {
+		st.Append(Event{ID: fmt.Sprintf("e%d", i), Timestamp: int64(i)})
+	}
+	events := st.Events()
+	if len(events) != 50 || st.Len() != 50 {
+		t.Fatalf("Expected 50 events, got %d (len %d)", len(events), st.Len())
+	}
+	for i, e := range events {
+		if e.Timestamp != int64(i) {
+			t.Fatalf("Expected event %d in append order, got %s", i, e.ID)
+		}
+	}
+
+	st.Replace([]Event{{ID: "x"}, {ID: "y"}})
+	st.Append(Event{ID: "z"})
+	if events := st.Events(); len(events) != 3 || events[0].ID != "x" || events[2].ID != "z" {
+		t.Errorf("Expected x, y, z after replacing, got %v", events)
+	}
+}
+
+func TestShardedStoreConcurrentAppends(t *testing.T) {
+	st := NewShardedStore(8)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				st.Append(Event{ID: fmt.Sprintf("w%d-%d", w, i)})
+				// Reads during appends see a prefix without gaps
+				if events := st.Events(); len(events) > st.Len() {
+					t.Errorf("Read %d events, more than stored", len(events))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for _, e := range st.Events() {
+		seen[e.ID] = true
+	}
+	if len(seen) != 1600 {
+		t.Errorf("Expected 1600 distinct events, got %d", len(seen))
+	}
+}
+
+func TestServerChainsShardedLog(t *testing.T) {
+	server := NewServer()
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				server.logEvent(fmt.Sprintf("w%d-%d", w, i), "Concurrent")
+			}
+		}()
+	}
+	wg.Wait()
+
+	events := server.events.Events()
+	if len(events) != 200 {
+		t.Fatalf("Expected 200 events, got %d", len(events))
+	}
+	if broken := verifyChain(events); broken != nil || server.head != events[199].Hash {
+		t.Errorf("Expected the merged log to chain up to the head, got %+v", broken)
+	}
+}
+
+func TestRingStoreOverwritesOldest(t *testing.T) {
+	st := NewRingStore(3)
+	for i := 1; i <= 5; i++ {
+		st.Append(Event{ID: fmt.Sprintf("e%d", i)})
+	}
+	events := st.Events()
+	if len(events) != 3 || events[0].ID != "e3" || events[2].ID != "e5" {
+		t.Errorf("Expected e3 to e5, got %v", events)
+	}
+	if st.Len() != 3 || st.Dropped() != 2 {
+		t.Errorf("Expected 3 kept and 2 dropped, got %d and %d", st.Len(), st.Dropped())
+	}
+
+	// Replacing counts what no longer fits on top of the earlier drops
+	st.Replace([]Event{{ID: "a"}, {ID: "b"}, {ID: "c"}, {ID: "d"}})
+	if events := st.Events(); events[0].ID != "b" || st.Dropped() != 3 {
+		t.Errorf("Expected b to d with 3 dropped, got %v with %d", events, st.Dropped())
+	}
+}
+
+func TestRingStoreEventsAndChain(t *testing.T) {
+	server := NewServer()
+	server.events = NewRingStore(2)
+	for _, id := range []string{"e1", "e2", "e3"} {
+		server.logEvent(id, id)
+	}
+
+	w := httptest.NewRecorder()
+	server.handleGetEvents(w, httptest.NewRequest(http.MethodGet, "/events", nil))
+	var response struct {
+		Events       []Event `json:"events"`
+		EventCount   int     `json:"event_count"`
+		DroppedCount int64   `json:"dropped_count"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.EventCount != 2 || response.DroppedCount != 1 || response.Events[0].ID != "e2" {
+		t.Errorf("Expected e2 and e3 with 1 dropped, got %+v", response)
+	}
+
+	// The chain is checked from the oldest event still held
+	if verified := verifyLog(t, server); verified["valid"] != true || verified["dropped_count"] != float64(1) {
+		t.Errorf("Expected a valid chain after dropping, got %v", verified)
+	}
+}
+
+func TestStoresTrimOldest(t *testing.T) {
+	for name, st := range map[string]EventStore{"sharded": NewShardedStore(4), "ring": NewRingStore(10), "compressed": NewCompressedStore(3)} {
+		for i := 1; i <= 5; i++ {
+			st.Append(Event{ID: fmt.Sprintf("e%d", i), Timestamp: int64(i), Message: "event"})
+		}
+		trimmed := st.Trim(2)
+		if len(trimmed) != 2 || trimmed[0].ID != "e1" || trimmed[1].ID != "e2" {
+			t.Errorf("%s: expected e1 and e2 trimmed, got %v", name, trimmed)
+		}
+		events := st.Events()
+		if len(events) != 3 || events[0].ID != "e3" || st.Len() != 3 || st.Dropped() != 2 {
+			t.Errorf("%s: expected e3 to e5 with 2 dropped, got %v with %d", name, events, st.Dropped())
+		}
+		if _, ok := st.Find("e1"); ok || len(st.Between(ClockTime{}, ClockTime{Timestamp: 2})) != 0 || len(st.Search("event")) != 3 {
+			t.Errorf("%s: expected the trimmed events gone from the indexes", name)
+		}
+		st.Append(Event{ID: "e6", Timestamp: 6})
+		if events := st.Events(); len(events) != 4 || events[3].ID != "e6" {
+			t.Errorf("%s: expected appends after a trim at the end, got %v", name, events)
+		}
+		if trimmed := st.Trim(10); len(trimmed) != 4 || st.Len() != 0 {
+			t.Errorf("%s: expected trimming more than held to empty the store, got %v", name, trimmed)
+		}
+	}
+}
+
+// benchmarkStore appends from every goroutine, reading the log once every
+// readEvery operations, as GET /events does
+func benchmarkStore(b *testing.B, st EventStore, readEvery int) {
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if readEvery > 0 && i%readEvery == readEvery-1 {
+				st.Events()
+			} else {
+				st.Append(Event{ID: strconv.Itoa(i)})
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkEventStore(b *testing.B) {
+	for _, readEvery := range []int{0, 1000} {
+		b.Run(fmt.Sprintf("locked/read-every-%d", readEvery), func(b *testing.B) {
+			benchmarkStore(b, &lockedStore{}, readEvery)
+		})
+		b.Run(fmt.Sprintf("sharded/read-every-%d", readEvery), func(b *testing.B) {
+			benchmarkStore(b, NewShardedStore(defaultEventShards), readEvery)
+		})
+	}
+}
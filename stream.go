@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// subscriberBuffer is how many events a slow subscriber may lag behind
+	// before events are dropped for it
+	subscriberBuffer = 64
+
+	// streamHeartbeat keeps idle connections alive through proxies
+	streamHeartbeat = 15 * time.Second
+)
+
+// EventFilter selects the events a subscriber receives. Empty fields match
+// everything; all set fields must match.
+type EventFilter struct {
+	MessageContains string            `json:"message_contains,omitempty"`
+	IDPrefix        string            `json:"id_prefix,omitempty"`
+	MinTimestamp    int64             `json:"min_timestamp,omitempty"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+}
+
+// Match reports whether an event passes the filter
+func (f EventFilter) Match(e Event) bool {
+	if f.MessageContains != "" && !strings.Contains(e.Message, f.MessageContains) {
+		return false
+	}
+	if f.IDPrefix != "" && !strings.HasPrefix(e.ID, f.IDPrefix) {
+		return false
+	}
+	if e.Timestamp < f.MinTimestamp {
+		return false
+	}
+	for key, value := range f.Metadata {
+		if e.Metadata[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// parseEventFilter reads a filter from query parameters:
+// contains, id_prefix, min_timestamp and meta.<key>=<value>
+func parseEventFilter(query url.Values) (EventFilter, error) {
+	f := EventFilter{
+		MessageContains: query.Get("contains"),
+		IDPrefix:        query.Get("id_prefix"),
+	}
+	if v := query.Get("min_timestamp"); v != "" {
+		ts, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return f, fmt.Errorf("invalid min_timestamp %q", v)
+		}
+		f.MinTimestamp = ts
+	}
+	for key, values := range query {
+		if name, ok := strings.CutPrefix(key, "meta."); ok && name != "" {
+			if f.Metadata == nil {
+				f.Metadata = make(map[string]string)
+			}
+			f.Metadata[name] = values[0]
+		}
+	}
+	return f, nil
+}
+
+// Subscription is a live feed of the events matching a filter
+type Subscription struct {
+	Events <-chan Event
+	events chan Event
+	filter EventFilter
+}
+
+// EventBroker fans newly recorded events out to subscribers. Filters are
+// evaluated here so clients only receive what they asked for.
+type EventBroker struct {
+	subscribers map[*Subscription]struct{}
+	metrics     *Metrics
+	done        chan struct{}
+	closeOnce   sync.Once
+	mutex       sync.RWMutex
+}
+
+// NewEventBroker creates a broker reporting drops to metrics
+func NewEventBroker(metrics *Metrics) *EventBroker {
+	metrics.Counter("lamport_stream_dropped_total", "Events dropped for slow stream subscribers")
+	b := &EventBroker{
+		subscribers: make(map[*Subscription]struct{}),
+		metrics:     metrics,
+		done:        make(chan struct{}),
+	}
+	metrics.GaugeFunc("lamport_stream_subscribers", "Connected stream subscribers", func() float64 {
+		return float64(b.Count())
+	})
+	return b
+}
+
+// Subscribe registers a subscriber; call Unsubscribe when done
+func (b *EventBroker) Subscribe(filter EventFilter) *Subscription {
+	ch := make(chan Event, subscriberBuffer)
+	sub := &Subscription{Events: ch, events: ch, filter: filter}
+
+	b.mutex.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mutex.Unlock()
+	return sub
+}
+
+// Unsubscribe removes a subscriber and closes its channel
+func (b *EventBroker) Unsubscribe(sub *Subscription) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// Publish delivers an event to every matching subscriber without blocking;
+// subscribers whose buffer is full miss the event
+func (b *EventBroker) Publish(e Event) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	for sub := range b.subscribers {
+		if !sub.filter.Match(e) {
+			continue
+		}
+		select {
+		case sub.events <- e:
+		default:
+			b.metrics.Inc("lamport_stream_dropped_total")
+		}
+	}
+}
+
+// Shutdown ends open event streams so the HTTP server can drain. Other
+// subscribers keep receiving events.
+func (b *EventBroker) Shutdown() {
+	b.closeOnce.Do(func() { close(b.done) })
+}
+
+// Done is closed once the broker is shut down
+func (b *EventBroker) Done() <-chan struct{} {
+	return b.done
+}
+
+// Count returns the number of subscribers
+func (b *EventBroker) Count() int {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return len(b.subscribers)
+}
+
+// handleStreamEvents streams new events as Server-Sent Events
+func (s *Server) handleStreamEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filter, err := parseEventFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	sub := s.broker.Subscribe(filter)
+	defer s.broker.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, ": lamport_timestamp %d\n\n", s.clock.GetTime())
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.broker.Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case event, ok := <-sub.Events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "id: %s\nevent: event\ndata: %s\n\n", event.ID, data)
+			flusher.Flush()
+		}
+	}
+}
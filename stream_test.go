@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventFilterMatch(t *testing.T) {
+	event := Event{
+		ID:        "order-17",
+		Message:   "Order created",
+		Timestamp: 10,
+		Metadata:  map[string]string{"service": "orders", "region": "eu"},
+	}
+
+	cases := []struct {
+		filter   EventFilter
+		expected bool
+	}{
+		{EventFilter{}, true},
+		{EventFilter{MessageContains: "created"}, true},
+		{EventFilter{MessageContains: "shipped"}, false},
+		{EventFilter{IDPrefix: "order-"}, true},
+		{EventFilter{IDPrefix: "msg-"}, false},
+		{EventFilter{MinTimestamp: 10}, true},
+		{EventFilter{MinTimestamp: 11}, false},
+		{EventFilter{Metadata: map[string]string{"service": "orders"}}, true},
+		{EventFilter{Metadata: map[string]string{"service": "orders", "region": "us"}}, false},
+		{EventFilter{IDPrefix: "order-", Metadata: map[string]string{"missing": ""}}, true},
+	}
+
+	for _, c := range cases {
+		if got := c.filter.Match(event); got != c.expected {
+			t.Errorf("Filter %+v: expected %v, got %v", c.filter, c.expected, got)
+		}
+	}
+}
+
+func TestParseEventFilter(t *testing.T) {
+	query, _ := url.ParseQuery("contains=login&id_prefix=event-&min_timestamp=5&meta.service=auth")
+	f, err := parseEventFilter(query)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if f.MessageContains != "login" || f.IDPrefix != "event-" || f.MinTimestamp != 5 || f.Metadata["service"] != "auth" {
+		t.Errorf("Unexpected filter: %+v", f)
+	}
+
+	if _, err := parseEventFilter(url.Values{"min_timestamp": {"soon"}}); err == nil {
+		t.Error("Expected invalid min_timestamp to be rejected")
+	}
+}
+
+func TestBrokerDropsForSlowSubscribers(t *testing.T) {
+	broker := NewEventBroker(NewMetrics())
+	sub := broker.Subscribe(EventFilter{})
+	defer broker.Unsubscribe(sub)
+
+	for i := 0; i < subscriberBuffer+5; i++ {
+		broker.Publish(Event{ID: "e"})
+	}
+
+	if got := broker.metrics.Value("lamport_stream_dropped_total"); got != 5 {
+		t.Errorf("Expected 5 dropped events, got %v", got)
+	}
+}
+
+func TestStreamEventsHandler(t *testing.T) {
+	server := NewServer()
+	ts := httptest.NewServer(http.HandlerFunc(server.handleStreamEvents))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "?contains=login&meta.service=auth")
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected event stream, got %q", ct)
+	}
+
+	// Wait until the subscription is registered before publishing
+	deadline := time.Now().Add(time.Second)
+	for server.broker.Count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	server.recordLocal(Event{ID: "skip-1", Message: "User login", Metadata: map[string]string{"service": "billing"}})
+	server.recordLocal(Event{ID: "skip-2", Message: "User logout", Metadata: map[string]string{"service": "auth"}})
+	server.recordLocal(Event{ID: "want", Message: "User login", Metadata: map[string]string{"service": "auth"}})
+
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Stream ended before matching event: %v", err)
+		}
+		data, ok := strings.CutPrefix(strings.TrimSpace(line), "data: ")
+		if !ok {
+			continue
+		}
+
+		var event Event
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			t.Fatalf("Invalid event data %q: %v", data, err)
+		}
+		if event.ID != "want" || event.Timestamp != 3 {
+			t.Errorf("Expected only the matching event (want at 3), got %s at %d", event.ID, event.Timestamp)
+		}
+		break
+	}
+
+	// Closing the broker ends the stream
+	server.broker.Shutdown()
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		t.Errorf("Expected stream to end cleanly, got %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Defaults of GET /analytics/summary
+const (
+	defaultSummaryTicks = 1000
+	defaultSummaryWall  = time.Minute
+	defaultSummaryTop   = 10
+)
+
+// LogicalBucket counts the events of an epoch with timestamps in
+// [Start, End)
+type LogicalBucket struct {
+	Epoch  int64 `json:"epoch"`
+	Start  int64 `json:"start"`
+	End    int64 `json:"end"`
+	Events int   `json:"events"`
+}
+
+// WallBucket counts the events with wall times in [Start, Start+width)
+type WallBucket struct {
+	Start  time.Time `json:"start"`
+	Events int       `json:"events"`
+}
+
+// Talker is a pair of nodes and the messages received from one by the other
+type Talker struct {
+	Sender   string `json:"sender"`
+	Receiver string `json:"receiver"`
+	Messages int    `json:"messages"`
+}
+
+// Propagation is the average delay between sending a message and logging
+// its receive event. Ticks covers every receive event with the time it
+// was sent at; milliseconds only those whose send event is in the log too.
+type Propagation struct {
+	Messages    int     `json:"messages"`
+	AvgTicks    float64 `json:"avg_ticks"`
+	Matched     int     `json:"matched"`
+	AvgMillisec float64 `json:"avg_ms"`
+}
+
+// EventSummary aggregates the events of the log
+type EventSummary struct {
+	Events      int             `json:"events"`
+	ByNode      map[string]int  `json:"by_node"`
+	ByType      map[string]int  `json:"by_type"`
+	Untyped     int             `json:"untyped"`
+	Logical     []LogicalBucket `json:"logical_buckets"`
+	Wall        []WallBucket    `json:"wall_buckets"`
+	TopTalkers  []Talker        `json:"top_talkers"`
+	Propagation Propagation     `json:"propagation"`
+}
+
+// summarize aggregates events into logical buckets of ticks timestamps and
+// wall buckets of width, keeping the top busiest sender and receiver pairs
+func summarize(events []Event, ticks int64, width time.Duration, top int) EventSummary {
+	summary := EventSummary{
+		Events:     len(events),
+		ByNode:     make(map[string]int),
+		ByType:     make(map[string]int),
+		Logical:    []LogicalBucket{},
+		Wall:       []WallBucket{},
+		TopTalkers: []Talker{},
+	}
+	type nodeTime struct {
+		node string
+		at   ClockTime
+	}
+	sent := make(map[nodeTime]time.Time, len(events))
+	for _, e := range events {
+		sent[nodeTime{e.Node, ClockTime{Epoch: e.Epoch, Timestamp: e.Timestamp}}] = e.WallTime
+	}
+
+	logical := make(map[LogicalBucket]int)
+	wall := make(map[int64]int)
+	talkers := make(map[Talker]int)
+	var ticksSum, msSum float64
+	for _, e := range events {
+		summary.ByNode[e.Node]++
+		if e.Type == "" {
+			summary.Untyped++
+		} else {
+			summary.ByType[e.Type]++
+		}
+		start := e.Timestamp - e.Timestamp%ticks
+		logical[LogicalBucket{Epoch: e.Epoch, Start: start, End: start + ticks}]++
+		if !e.WallTime.IsZero() {
+			wall[e.WallTime.UnixNano()/int64(width)]++
+		}
+
+		if e.SentAt == nil {
+			continue
+		}
+		talkers[Talker{Sender: e.Sender, Receiver: e.Node}]++
+		p := &summary.Propagation
+		p.Messages++
+		ticksSum += float64(ticksBetween(*e.SentAt, ClockTime{Epoch: e.Epoch, Timestamp: e.Timestamp}))
+		if at, ok := sent[nodeTime{e.Sender, *e.SentAt}]; ok {
+			p.Matched++
+			msSum += float64(e.WallTime.Sub(at)) / float64(time.Millisecond)
+		}
+	}
+	if p := &summary.Propagation; p.Messages > 0 {
+		p.AvgTicks = ticksSum / float64(p.Messages)
+		if p.Matched > 0 {
+			p.AvgMillisec = msSum / float64(p.Matched)
+		}
+	}
+
+	for b, n := range logical {
+		b.Events = n
+		summary.Logical = append(summary.Logical, b)
+	}
+	slices.SortFunc(summary.Logical, func(a, b LogicalBucket) int {
+		return cmp.Or(cmp.Compare(a.Epoch, b.Epoch), cmp.Compare(a.Start, b.Start))
+	})
+	for i, n := range wall {
+		summary.Wall = append(summary.Wall, WallBucket{Start: time.Unix(0, i*int64(width)).UTC(), Events: n})
+	}
+	slices.SortFunc(summary.Wall, func(a, b WallBucket) int { return a.Start.Compare(b.Start) })
+	for t, n := range talkers {
+		t.Messages = n
+		summary.TopTalkers = append(summary.TopTalkers, t)
+	}
+	slices.SortFunc(summary.TopTalkers, func(a, b Talker) int {
+		return cmp.Or(cmp.Compare(b.Messages, a.Messages), cmp.Compare(a.Sender, b.Sender), cmp.Compare(a.Receiver, b.Receiver))
+	})
+	summary.TopTalkers = summary.TopTalkers[:min(top, len(summary.TopTalkers))]
+	return summary
+}
+
+// handleSummary aggregates the event log. Parameters: ticks, the width of
+// the logical buckets, wall, the width of the wall time buckets, and top,
+// how many sender and receiver pairs to list.
+func (s *Server) handleSummary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	ticks := int64(defaultSummaryTicks)
+	if v := query.Get("ticks"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid ticks parameter", http.StatusBadRequest)
+			return
+		}
+		ticks = n
+	}
+	width := defaultSummaryWall
+	if v := query.Get("wall"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid wall parameter", http.StatusBadRequest)
+			return
+		}
+		width = d
+	}
+	top := defaultSummaryTop
+	if v := query.Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid top parameter", http.StatusBadRequest)
+			return
+		}
+		top = n
+	}
+
+	summary := summarize(s.events.Events(), ticks, width, top)
+	now := s.clock.Now()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Current int64 `json:"current_timestamp"`
+		Epoch   int64 `json:"epoch"`
+		EventSummary
+	}{now.Timestamp, now.Epoch, summary})
+}
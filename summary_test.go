@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSummarize(t *testing.T) {
+	base := time.Unix(600, 0)
+	events := []Event{
+		{ID: "a1", Node: "a", Timestamp: 1, WallTime: base},
+		{ID: "a2", Node: "a", Timestamp: 5, WallTime: base.Add(10 * time.Millisecond), Type: "order.created"},
+		{ID: "b1", Node: "b", Timestamp: 8, WallTime: base.Add(30 * time.Millisecond), Sender: "a", SentAt: &ClockTime{Timestamp: 5}},
+		{ID: "b2", Node: "b", Timestamp: 12, WallTime: base.Add(2 * time.Minute), Sender: "c", SentAt: &ClockTime{Timestamp: 11}},
+		{ID: "b3", Node: "b", Timestamp: 15, WallTime: base.Add(2 * time.Minute), Sender: "a", SentAt: &ClockTime{Timestamp: 9}},
+	}
+	summary := summarize(events, 10, time.Minute, 1)
+
+	if summary.ByNode["a"] != 2 || summary.ByNode["b"] != 3 || summary.ByType["order.created"] != 1 || summary.Untyped != 4 {
+		t.Errorf("Unexpected counts: %+v %+v %d", summary.ByNode, summary.ByType, summary.Untyped)
+	}
+	if len(summary.Logical) != 2 || summary.Logical[0] != (LogicalBucket{Start: 0, End: 10, Events: 3}) || summary.Logical[1].Events != 2 {
+		t.Errorf("Expected 3 events below 10 and 2 above, got %+v", summary.Logical)
+	}
+	if len(summary.Wall) != 2 || !summary.Wall[0].Start.Equal(base) || summary.Wall[0].Events != 3 || summary.Wall[1].Events != 2 {
+		t.Errorf("Expected 3 events in the first minute and 2 two minutes later, got %+v", summary.Wall)
+	}
+	if len(summary.TopTalkers) != 1 || summary.TopTalkers[0] != (Talker{Sender: "a", Receiver: "b", Messages: 2}) {
+		t.Errorf("Expected a to b as the top talker, got %+v", summary.TopTalkers)
+	}
+	// (3 + 1 + 6) / 3 ticks; only b1 has its send event, a2, in the log
+	if p := summary.Propagation; p.Messages != 3 || p.AvgTicks != 10.0/3 || p.Matched != 1 || p.AvgMillisec != 20 {
+		t.Errorf("Unexpected propagation: %+v", p)
+	}
+}
+
+func TestHandleSummary(t *testing.T) {
+	server := NewServer()
+	server.logEvent("e1", "One")
+	server.receiveMessage(t.Context(), "node-b", "", ClockTime{Timestamp: 4}, "hello")
+
+	w := httptest.NewRecorder()
+	server.handleSummary(w, httptest.NewRequest(http.MethodGet, "/analytics/summary?ticks=100&wall=1h", nil))
+	var summary EventSummary
+	json.NewDecoder(w.Body).Decode(&summary)
+	if w.Code != http.StatusOK || summary.Events != 2 || len(summary.Logical) != 1 || summary.Propagation.AvgTicks != 1 {
+		t.Errorf("Expected both events in one bucket and the message 1 tick late, got %d %+v", w.Code, summary)
+	}
+
+	for _, query := range []string{"ticks=0", "wall=1", "top=-1"} {
+		w := httptest.NewRecorder()
+		server.handleSummary(w, httptest.NewRequest(http.MethodGet, "/analytics/summary?"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, w.Code)
+		}
+	}
+}
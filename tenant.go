@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// tenantPruneInterval is how often retention is applied to idle clocks
+const tenantPruneInterval = time.Minute
+
+// TenantConfig describes a tenant in the tenants file
+type TenantConfig struct {
+	Name      string   `json:"name"`
+	APIKeys   []string `json:"api_keys"`
+	MaxClocks int      `json:"max_clocks,omitempty"`
+	MaxEvents int      `json:"max_events,omitempty"`
+	Retention string   `json:"retention,omitempty"` // Go duration, e.g. "24h"
+}
+
+// Tenant is a team with its own virtual clocks, quotas and metrics
+type Tenant struct {
+	Name   string
+	clocks *ClockRegistry
+}
+
+// Tenants maps API keys to tenants. Keys are stored as SHA-256 sums, so
+// lookups do not compare secrets directly.
+type Tenants struct {
+	byKey map[[sha256.Size]byte]*Tenant
+	list  []*Tenant
+}
+
+// LoadTenants reads a JSON array of TenantConfig
+func LoadTenants(path string, metrics *Metrics, guard func() JumpGuard) (*Tenants, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []TenantConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("invalid tenants file: %w", err)
+	}
+	return NewTenants(configs, metrics, guard)
+}
+
+// NewTenants validates the tenant configs and creates their registries
+func NewTenants(configs []TenantConfig, metrics *Metrics, guard func() JumpGuard) (*Tenants, error) {
+	metrics.Counter("lamport_tenant_events_total", "Events recorded per tenant")
+	metrics.Counter("lamport_tenant_quota_rejected_total", "Events rejected by tenant quotas")
+
+	t := &Tenants{byKey: make(map[[sha256.Size]byte]*Tenant)}
+	names := make(map[string]bool)
+	for _, c := range configs {
+		if !clockNamePattern.MatchString(c.Name) || names[c.Name] {
+			return nil, fmt.Errorf("invalid or duplicate tenant name %q", c.Name)
+		}
+		names[c.Name] = true
+
+		limits := ClockLimits{MaxClocks: c.MaxClocks, MaxEvents: c.MaxEvents}
+		if c.Retention != "" {
+			d, err := time.ParseDuration(c.Retention)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("tenant %s: invalid retention %q", c.Name, c.Retention)
+			}
+			limits.Retention = d
+		}
+
+		tenant := &Tenant{Name: c.Name, clocks: NewClockRegistry(guard, limits)}
+		tenant.clocks.tenant = c.Name
+		tenant.clocks.metrics = metrics
+		tenant.clocks.report()
+
+		if len(c.APIKeys) == 0 {
+			return nil, fmt.Errorf("tenant %s has no API keys", c.Name)
+		}
+		for _, key := range c.APIKeys {
+			sum := sha256.Sum256([]byte(key))
+			if key == "" || t.byKey[sum] != nil {
+				return nil, fmt.Errorf("tenant %s: empty or duplicate API key", c.Name)
+			}
+			t.byKey[sum] = tenant
+		}
+		t.list = append(t.list, tenant)
+	}
+	return t, nil
+}
+
+// Authenticate returns the tenant owning the request's API key, sent as
+// X-API-Key or as a bearer token
+func (t *Tenants) Authenticate(r *http.Request) *Tenant {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		key, _ = strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	if key == "" {
+		return nil
+	}
+	return t.byKey[sha256.Sum256([]byte(key))]
+}
+
+// Run applies retention periodically until ctx is done
+func (t *Tenants) Run(ctx context.Context) {
+	ticker := time.NewTicker(tenantPruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, tenant := range t.list {
+				tenant.clocks.Prune(now)
+			}
+		}
+	}
+}
+
+var errNoTenant = errors.New("missing or unknown tenant API key")
+
+// clockRegistry returns the virtual clocks a request may use: those of its
+// tenant when tenants are configured, the server's own otherwise
+func (s *Server) clockRegistry(w http.ResponseWriter, r *http.Request) (*ClockRegistry, bool) {
+	if s.tenants == nil {
+		return s.clocks, true
+	}
+	tenant := s.tenants.Authenticate(r)
+	if tenant == nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="lamport"`)
+		http.Error(w, errNoTenant.Error(), http.StatusUnauthorized)
+		return nil, false
+	}
+	return tenant.clocks, true
+}
+
+func (s *Server) handleTenants(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tenants := []map[string]interface{}{}
+	if s.tenants != nil {
+		for _, t := range s.tenants.list {
+			limits := t.clocks.limits
+			tenants = append(tenants, map[string]interface{}{
+				"name":       t.Name,
+				"clocks":     len(t.clocks.List()),
+				"events":     t.clocks.Stored(),
+				"max_clocks": limits.MaxClocks,
+				"max_events": limits.MaxEvents,
+				"retention":  limits.Retention.String(),
+			})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"tenants": tenants})
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTenantServer(t *testing.T, configs ...TenantConfig) *Server {
+	t.Helper()
+	server := NewServer()
+	tenants, err := NewTenants(configs, server.metrics, server.clock.JumpGuard)
+	if err != nil {
+		t.Fatalf("Failed to create tenants: %v", err)
+	}
+	server.tenants = tenants
+	return server
+}
+
+func tenantRequest(server *Server, key, method, target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	w := httptest.NewRecorder()
+	if target == "/clocks" {
+		server.handleListClocks(w, req)
+	} else {
+		server.handleClock(w, req)
+	}
+	return w
+}
+
+func TestTenantsAreIsolated(t *testing.T) {
+	server := newTenantServer(t,
+		TenantConfig{Name: "team-a", APIKeys: []string{"key-a"}},
+		TenantConfig{Name: "team-b", APIKeys: []string{"key-b"}},
+	)
+
+	tenantRequest(server, "key-a", http.MethodPost, "/clocks/orders/tick")
+	tenantRequest(server, "key-a", http.MethodPost, "/clocks/orders/tick")
+	w := tenantRequest(server, "key-b", http.MethodPost, "/clocks/orders/tick")
+
+	var event Event
+	json.NewDecoder(w.Body).Decode(&event)
+	if event.Timestamp != 1 {
+		t.Errorf("Expected team-b's clock to start at 1, got %d", event.Timestamp)
+	}
+
+	if w := tenantRequest(server, "", http.MethodGet, "/clocks/orders/time"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without key, got %d", w.Code)
+	}
+	if w := tenantRequest(server, "wrong", http.MethodGet, "/clocks"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for unknown key, got %d", w.Code)
+	}
+
+	// Bearer tokens work as well
+	req := httptest.NewRequest(http.MethodGet, "/clocks/orders/time", nil)
+	req.Header.Set("Authorization", "Bearer key-a")
+	w = httptest.NewRecorder()
+	server.handleClock(w, req)
+	var now map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&now)
+	if now["lamport_timestamp"] != float64(2) {
+		t.Errorf("Expected team-a's clock at 2, got %v", now["lamport_timestamp"])
+	}
+
+	if got := server.metrics.Value("lamport_tenant_events_total", "tenant", "team-a"); got != 2 {
+		t.Errorf("Expected 2 events for team-a, got %v", got)
+	}
+}
+
+func TestTenantQuotas(t *testing.T) {
+	server := newTenantServer(t, TenantConfig{Name: "small", APIKeys: []string{"k"}, MaxEvents: 2, MaxClocks: 1})
+
+	tenantRequest(server, "k", http.MethodPost, "/clocks/p1/tick")
+	tenantRequest(server, "k", http.MethodPost, "/clocks/p1/message?timestamp=5&message=x")
+	w := tenantRequest(server, "k", http.MethodPost, "/clocks/p1/tick")
+	if w.Code != http.StatusInsufficientStorage {
+		t.Fatalf("Expected 507 over the event quota, got %d", w.Code)
+	}
+
+	// A rejected event does not tick the clock
+	tenant := server.tenants.list[0]
+	vc, _ := tenant.clocks.Get("p1", false)
+	if vc.clock.GetTime() != 6 {
+		t.Errorf("Expected clock to stay at 6, got %d", vc.clock.GetTime())
+	}
+	if got := server.metrics.Value("lamport_tenant_quota_rejected_total", "tenant", "small"); got != 1 {
+		t.Errorf("Expected 1 quota rejection, got %v", got)
+	}
+
+	if w := tenantRequest(server, "k", http.MethodPost, "/clocks/p2/tick"); w.Code != http.StatusInsufficientStorage {
+		t.Errorf("Expected 507 over the clock quota, got %d", w.Code)
+	}
+
+	// Deleting a clock frees its events
+	tenantRequest(server, "k", http.MethodDelete, "/clocks/p1")
+	if w := tenantRequest(server, "k", http.MethodPost, "/clocks/p2/tick"); w.Code != http.StatusOK {
+		t.Errorf("Expected room after delete, got %d", w.Code)
+	}
+	if got := server.metrics.Value("lamport_tenant_events_stored", "tenant", "small"); got != 1 {
+		t.Errorf("Expected 1 stored event, got %v", got)
+	}
+}
+
+func TestTenantRetention(t *testing.T) {
+	server := newTenantServer(t, TenantConfig{Name: "short", APIKeys: []string{"k"}, MaxEvents: 2, Retention: "1h"})
+	tenantRequest(server, "k", http.MethodPost, "/clocks/p1/tick")
+	tenantRequest(server, "k", http.MethodPost, "/clocks/p1/tick")
+
+	tenant := server.tenants.list[0]
+	tenant.clocks.Prune(time.Now().Add(2 * time.Hour))
+
+	vc, _ := tenant.clocks.Get("p1", false)
+	vc.mutex.RLock()
+	remaining := len(vc.events)
+	vc.mutex.RUnlock()
+	if remaining != 0 || tenant.clocks.Stored() != 0 {
+		t.Errorf("Expected expired events to be dropped, %d left (%d stored)", remaining, tenant.clocks.Stored())
+	}
+	// The clock keeps its time and quota is available again
+	if w := tenantRequest(server, "k", http.MethodPost, "/clocks/p1/tick"); w.Code != http.StatusOK {
+		t.Errorf("Expected room after retention, got %d", w.Code)
+	}
+	if vc.clock.GetTime() != 3 {
+		t.Errorf("Expected clock at 3, got %d", vc.clock.GetTime())
+	}
+}
+
+func TestLoadTenants(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	os.WriteFile(path, []byte(`[{"name":"team-a","api_keys":["a1","a2"],"max_events":100,"retention":"24h"}]`), 0o600)
+
+	tenants, err := LoadTenants(path, NewMetrics(), func() JumpGuard { return JumpGuard{} })
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tenants.list) != 1 || tenants.list[0].clocks.limits.Retention != 24*time.Hour {
+		t.Errorf("Unexpected tenants: %+v", tenants.list)
+	}
+
+	invalid := [][]TenantConfig{
+		{{Name: "", APIKeys: []string{"k"}}},
+		{{Name: "a", APIKeys: []string{"k"}}, {Name: "a", APIKeys: []string{"j"}}},
+		{{Name: "a", APIKeys: []string{"k"}}, {Name: "b", APIKeys: []string{"k"}}},
+		{{Name: "a"}},
+		{{Name: "a", APIKeys: []string{"k"}, Retention: "forever"}},
+	}
+	for _, configs := range invalid {
+		if _, err := NewTenants(configs, NewMetrics(), func() JumpGuard { return JumpGuard{} }); err == nil {
+			t.Errorf("Expected %+v to be rejected", configs)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The text protocol takes one command per line and answers each with a
+// line starting with OK or ERR. EVENTS follows its OK line, which gives
+// the number of events, with one line per event:
+//
+//	TICK [message]          OK <timestamp> <id>
+//	UPDATE <ts> [message]   OK <timestamp> <id>
+//	TIME                    OK <timestamp>
+//	EVENTS <n>              OK <count>, then <timestamp> <id> "<message>"
+//	AUTH <api key>          OK <roles>
+//	HELP, QUIT
+const (
+	maxTextLine   = 4096
+	maxTextEvents = 1000
+	maxTextConns  = 256
+
+	// textIdleTimeout closes connections no command arrived on for that long
+	textIdleTimeout = 5 * time.Minute
+)
+
+const textHelp = "OK commands: TICK [message], UPDATE <timestamp> [message], TIME, EVENTS <n>, AUTH <api key>, HELP, QUIT"
+
+// TextServer serves the line based text protocol over TCP, for people
+// typing commands through telnet or netcat and for clients too small for
+// HTTP
+type TextServer struct {
+	listener net.Listener
+	server   *Server
+	timeout  time.Duration // of each command, none when 0
+	logger   *slog.Logger
+	conns    map[net.Conn]struct{}
+	closed   bool
+	mutex    sync.Mutex
+	wg       sync.WaitGroup
+}
+
+// textSession is the state of one connection
+type textSession struct {
+	roles      Role   // granted by AUTH, or the anonymous roles
+	credential string // given to AUTH
+	sender     string // node the connection speaks for, if known
+	remoteAddr string
+	tls        *tls.ConnectionState
+}
+
+// ListenText opens the text protocol listener. Each command runs for at
+// most timeout. With tlsConfig, as the HTTP server has when TLS is
+// configured, connections are served over TLS, so AUTH does not send keys
+// in the clear.
+func ListenText(addr string, timeout time.Duration, tlsConfig *tls.Config, server *Server) (*TextServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	server.metrics.Counter("lamport_text_commands_total", "Text protocol commands by command and result")
+	return &TextServer{
+		listener: listener,
+		server:   server,
+		timeout:  timeout,
+		logger:   server.logger.With("transport", "text"),
+		conns:    make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// Addr returns the address the listener is bound to
+func (t *TextServer) Addr() net.Addr {
+	return t.listener.Addr()
+}
+
+// Run serves connections until ctx is done, then closes the listener and
+// every connection
+func (t *TextServer) Run(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		t.listener.Close()
+		t.mutex.Lock()
+		t.closed = true
+		for conn := range t.conns {
+			conn.Close()
+		}
+		t.mutex.Unlock()
+	}()
+
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				break
+			}
+			t.logger.Warn("Text protocol accept failed", "error", err)
+			continue
+		}
+		if ok, full := t.track(conn); !ok {
+			if full {
+				conn.Write([]byte("ERR too many connections\r\n"))
+			}
+			conn.Close()
+			continue
+		}
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			defer t.untrack(conn)
+			t.serve(ctx, conn)
+		}()
+	}
+	t.wg.Wait()
+}
+
+// track adds a connection to those closed on shutdown, unless the server
+// is full or shutting down
+func (t *TextServer) track(conn net.Conn) (ok, full bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closed {
+		return false, false
+	}
+	if len(t.conns) >= maxTextConns {
+		return false, true
+	}
+	t.conns[conn] = struct{}{}
+	return true, false
+}
+
+func (t *TextServer) untrack(conn net.Conn) {
+	t.mutex.Lock()
+	delete(t.conns, conn)
+	t.mutex.Unlock()
+	conn.Close()
+}
+
+// serve answers the commands of a connection until the client quits or
+// leaves
+func (t *TextServer) serve(ctx context.Context, conn net.Conn) {
+	session := textSession{remoteAddr: conn.RemoteAddr().String()}
+	if t.server.access != nil {
+		session.roles = t.server.access.anonymous
+	}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn.SetDeadline(time.Now().Add(textIdleTimeout))
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return
+		}
+		state := tlsConn.ConnectionState()
+		session.tls = &state
+		if t.server.peerCerts && len(state.VerifiedChains) > 0 {
+			session.sender = state.VerifiedChains[0][0].Subject.CommonName
+		}
+	}
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 256), maxTextLine)
+	w := bufio.NewWriter(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(textIdleTimeout))
+		if !scanner.Scan() {
+			if errors.Is(scanner.Err(), bufio.ErrTooLong) {
+				w.WriteString("ERR line too long\r\n")
+				w.Flush()
+			}
+			return
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		reply, quit := t.exec(ctx, &session, line)
+		w.WriteString(reply)
+		w.WriteString("\r\n")
+		if err := w.Flush(); err != nil || quit {
+			return
+		}
+	}
+}
+
+// exec runs a command line and returns its reply, without the final line
+// break
+func (t *TextServer) exec(ctx context.Context, session *textSession, line string) (reply string, quit bool) {
+	verb, args, _ := strings.Cut(line, " ")
+	verb, args = strings.ToUpper(verb), strings.TrimSpace(args)
+	switch verb {
+	case "TICK", "UPDATE", "TIME", "EVENTS":
+	case "AUTH":
+		return t.auth(session, args), false
+	case "HELP":
+		return textHelp, false
+	case "QUIT":
+		return "OK bye", true
+	default:
+		return fmt.Sprintf("ERR unknown command %q, HELP lists them", verb), false
+	}
+
+	required := RoleReader
+	switch verb {
+	case "TICK":
+		required = RoleWriter
+	case "UPDATE":
+		required = RolePeer
+	}
+	if t.server.access != nil && session.roles&required == 0 {
+		t.server.metrics.Inc("lamport_text_commands_total", "command", verb, "result", "denied")
+		return "ERR requires the " + required.String() + " role, AUTH first", false
+	}
+
+	ctx = contextWithRequestID(ctx, newRequestID())
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+	var err error
+	if verb == "TICK" || verb == "UPDATE" {
+		reply, err = t.runChecked(ctx, session, verb, args)
+	} else {
+		reply, err = t.run(ctx, "", verb, args)
+	}
+	if err != nil {
+		t.server.metrics.Inc("lamport_text_commands_total", "command", verb, "result", "error")
+		return "ERR " + err.Error(), false
+	}
+	t.server.metrics.Inc("lamport_text_commands_total", "command", verb, "result", "ok")
+	return reply, false
+}
+
+// runChecked runs a command changing the clock behind the checks of the
+// endpoint it mirrors, POST /event or POST /message: the rate limiter,
+// keyed by address or API key as for HTTP, the ingestion queue, and for
+// UPDATE the peer check and the simulated partitions. The command goes
+// through them as a request, so both transports share one path.
+func (t *TextServer) runChecked(ctx context.Context, session *textSession, verb, args string) (string, error) {
+	s := t.server
+	path := "/event"
+	if verb == "UPDATE" {
+		path = "/message"
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, path, nil)
+	if err != nil {
+		return "", err
+	}
+	r.RemoteAddr = session.remoteAddr
+	r.TLS = session.tls
+	if session.credential != "" {
+		r.Header.Set("X-API-Key", session.credential)
+	}
+	if session.sender != "" {
+		r.Header.Set(headerSender, session.sender)
+	}
+
+	var reply string
+	var runErr error
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		reply, runErr = t.run(r.Context(), session.sender, verb, args)
+	}
+	if verb == "UPDATE" {
+		handler = s.fromPeer(handler)
+	}
+	w := &textResponse{header: make(http.Header)}
+	s.withPartition(s.limit(s.admit(handler))).ServeHTTP(w, r)
+	if w.status != 0 && w.status != http.StatusOK {
+		return "", errors.New(strings.TrimSpace(w.body.String()))
+	}
+	return reply, runErr
+}
+
+// textResponse collects what the checks of runChecked answer
+type textResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *textResponse) Header() http.Header { return w.header }
+
+func (w *textResponse) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+func (w *textResponse) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// run runs a clock command. Messages of UPDATE are from sender, if known.
+func (t *TextServer) run(ctx context.Context, sender, verb, args string) (string, error) {
+	s := t.server
+	switch verb {
+	case "TICK":
+		event, err := s.createEvent(ctx, Event{Message: args})
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("OK %d %s", event.Timestamp, event.ID), nil
+
+	case "UPDATE":
+		raw, message, _ := strings.Cut(args, " ")
+		ts, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || ts < 0 {
+			return "", errors.New("expected UPDATE <timestamp> [message]")
+		}
+		if message = strings.TrimSpace(message); message == "" {
+			message = "Text message"
+		}
+		event, err := s.receiveMessage(ctx, sender, "", ClockTime{Epoch: s.clock.Now().Epoch, Timestamp: ts}, message)
+		if errors.Is(err, ErrJumpTooLarge) {
+			return "", errors.New("timestamp jump exceeds max_jump")
+		} else if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("OK %d %s", event.Timestamp, event.ID), nil
+
+	case "TIME":
+		return fmt.Sprintf("OK %d", s.clock.Now().Timestamp), nil
+
+	default: // EVENTS
+		n, err := strconv.Atoi(args)
+		if err != nil || n < 1 || n > maxTextEvents {
+			return "", fmt.Errorf("expected EVENTS <n>, with n from 1 to %d", maxTextEvents)
+		}
+		events := s.events.Events()
+		events = events[max(0, len(events)-n):]
+		var b strings.Builder
+		fmt.Fprintf(&b, "OK %d", len(events))
+		for _, e := range events {
+			fmt.Fprintf(&b, "\r\n%d %s %s", e.Timestamp, e.ID, strconv.Quote(e.Message))
+		}
+		return b.String(), nil
+	}
+}
+
+// auth takes the roles of an API key or token for the rest of the
+// connection
+func (t *TextServer) auth(session *textSession, credential string) string {
+	if t.server.access == nil {
+		return "ERR access is not role based, no AUTH needed"
+	}
+	if credential == "" {
+		return "ERR expected AUTH <api key>"
+	}
+	roles, err := t.server.credentialRoles(credential)
+	if err != nil || roles == 0 {
+		t.server.metrics.Inc("lamport_text_commands_total", "command", "AUTH", "result", "denied")
+		return "ERR unknown API key or invalid token"
+	}
+	session.roles, session.credential = roles, credential
+	if holder := t.server.access.Holder(credential); holder != "" && roles&RolePeer != 0 {
+		session.sender = holder
+	}
+	t.server.metrics.Inc("lamport_text_commands_total", "command", "AUTH", "result", "ok")
+	return "OK " + roles.String()
+}
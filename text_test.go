@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveText starts the text protocol of server, over TLS with tlsConfig
+func serveText(t *testing.T, server *Server, tlsConfig *tls.Config) net.Addr {
+	t.Helper()
+	text, err := ListenText("127.0.0.1:0", time.Second, tlsConfig, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		text.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return text.Addr()
+}
+
+// textClient sends commands over conn
+func textClient(t *testing.T, conn net.Conn) (send func(line string) string, read func() string) {
+	t.Helper()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+	read = func() string {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Expected a reply, got %v", err)
+		}
+		return strings.TrimSuffix(line, "\r\n")
+	}
+	send = func(line string) string {
+		conn.Write([]byte(line + "\r\n"))
+		return read()
+	}
+	return send, read
+}
+
+// dialText starts the text protocol of server and connects to it
+func dialText(t *testing.T, server *Server) (send func(line string) string, read func() string) {
+	t.Helper()
+	conn, err := net.Dial("tcp", serveText(t, server, nil).String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return textClient(t, conn)
+}
+
+func TestTextProtocol(t *testing.T) {
+	server := NewServer(WithNodeID("node-a"))
+	send, read := dialText(t, server)
+
+	if reply := send("TICK user login"); !strings.HasPrefix(reply, "OK 1 event-") {
+		t.Errorf("Expected the event at 1, got %q", reply)
+	}
+	// Commands are case insensitive and the message is optional
+	if reply := send("update 41"); reply != "OK 42 msg-42" {
+		t.Errorf("Expected the message merged at 42, got %q", reply)
+	}
+	if reply := send("TIME"); reply != "OK 42" {
+		t.Errorf("Expected the time 42, got %q", reply)
+	}
+
+	if reply := send("EVENTS 5"); reply != "OK 2" {
+		t.Fatalf("Expected 2 events, got %q", reply)
+	}
+	if line := read(); !strings.HasPrefix(line, "1 event-") || !strings.HasSuffix(line, ` "user login"`) {
+		t.Errorf("Expected the local event first, got %q", line)
+	}
+	if line := read(); line != `42 msg-42 "Processed: Text message"` {
+		t.Errorf("Expected the message second, got %q", line)
+	}
+	if events := server.events.Events(); len(events) != 2 || events[0].Message != "user login" {
+		t.Errorf("Expected the events logged, got %+v", events)
+	}
+
+	for line, want := range map[string]string{
+		"UPDATE x":   "ERR expected UPDATE <timestamp> [message]",
+		"UPDATE -1":  "ERR expected UPDATE <timestamp> [message]",
+		"EVENTS 0":   "ERR expected EVENTS <n>, with n from 1 to 1000",
+		"EVENTS":     "ERR expected EVENTS <n>, with n from 1 to 1000",
+		"FOO bar":    `ERR unknown command "FOO", HELP lists them`,
+		"AUTH key-1": "ERR access is not role based, no AUTH needed",
+	} {
+		if reply := send(line); reply != want {
+			t.Errorf("%s: expected %q, got %q", line, want, reply)
+		}
+	}
+	if reply := send("HELP"); !strings.HasPrefix(reply, "OK commands: TICK") {
+		t.Errorf("Expected the commands, got %q", reply)
+	}
+	if reply := send("QUIT"); reply != "OK bye" {
+		t.Errorf("Expected bye, got %q", reply)
+	}
+	if v := server.metrics.Value("lamport_text_commands_total", "command", "UPDATE", "result", "error"); v != 2 {
+		t.Errorf("Expected 2 failed updates counted, got %v", v)
+	}
+}
+
+func TestTextProtocolJumpAndLongLines(t *testing.T) {
+	server := NewServer()
+	server.clock.SetJumpGuard(JumpGuard{MaxJump: 100, Policy: JumpReject})
+	send, _ := dialText(t, server)
+
+	if reply := send("UPDATE 1000"); reply != "ERR timestamp jump exceeds max_jump" {
+		t.Errorf("Expected the jump refused, got %q", reply)
+	}
+	if reply := send("TICK " + strings.Repeat("x", maxTextLine)); reply != "ERR line too long" {
+		t.Errorf("Expected the line refused, got %q", reply)
+	}
+}
+
+func TestTextProtocolRoles(t *testing.T) {
+	server := NewServer(WithNodeID("node-a"))
+	server.access, _ = NewAccessControl([]RoleConfig{
+		{Name: "dashboard", APIKeys: []string{"read-key"}, Roles: []string{"reader"}},
+		{Name: "sensor", APIKeys: []string{"write-key"}, Roles: []string{"writer"}},
+		{Name: "node-b", APIKeys: []string{"peer-key"}, Roles: []string{"peer"}},
+	}, nil, nil)
+	send, _ := dialText(t, server)
+
+	if reply := send("TIME"); reply != "ERR requires the reader role, AUTH first" {
+		t.Errorf("Expected anonymous reads refused, got %q", reply)
+	}
+	if reply := send("AUTH wrong"); reply != "ERR unknown API key or invalid token" {
+		t.Errorf("Expected the key refused, got %q", reply)
+	}
+	if reply := send("AUTH read-key"); reply != "OK reader" {
+		t.Errorf("Expected the reader role, got %q", reply)
+	}
+	if reply := send("TIME"); reply != "OK 0" {
+		t.Errorf("Expected readers to read, got %q", reply)
+	}
+	if reply := send("TICK"); reply != "ERR requires the writer role, AUTH first" {
+		t.Errorf("Expected readers refused to tick, got %q", reply)
+	}
+	if reply := send("AUTH write-key"); reply != "OK reader,writer" {
+		t.Errorf("Expected the writer role, got %q", reply)
+	}
+	if reply := send("TICK"); !strings.HasPrefix(reply, "OK 1 ") {
+		t.Errorf("Expected writers to tick, got %q", reply)
+	}
+
+	// Only peers send messages, as on POST /message
+	if reply := send("UPDATE 40"); reply != "ERR requires the peer role, AUTH first" {
+		t.Errorf("Expected writers refused updates, got %q", reply)
+	}
+	if reply := send("AUTH peer-key"); reply != "OK reader,peer" {
+		t.Errorf("Expected the peer role, got %q", reply)
+	}
+	if reply := send("UPDATE 40"); reply != "OK 41 msg-41" {
+		t.Errorf("Expected peers to send messages, got %q", reply)
+	}
+	if events := server.events.Events(); events[len(events)-1].Sender != "node-b" {
+		t.Errorf("Expected the message from the key holder, got %+v", events[len(events)-1])
+	}
+
+	// The holder is cut off like a peer naming itself in Lamport-Sender
+	server.split.Set([][]string{{server.nodeID}, {"node-b"}})
+	if reply := send("UPDATE 50"); reply != "ERR Partitioned from node-b" {
+		t.Errorf("Expected the message dropped by the partition, got %q", reply)
+	}
+}
+
+func TestTextProtocolRateLimit(t *testing.T) {
+	server := NewServer()
+	server.limiter = NewRateLimiter(0.001, 2, false)
+	send, _ := dialText(t, server)
+
+	for range 2 {
+		if reply := send("TICK"); !strings.HasPrefix(reply, "OK ") {
+			t.Errorf("Expected the burst to tick, got %q", reply)
+		}
+	}
+	if reply := send("TICK"); !strings.HasPrefix(reply, "ERR Rate limit exceeded") {
+		t.Errorf("Expected the limiter of HTTP to apply, got %q", reply)
+	}
+	if reply := send("TIME"); reply != "OK 2" {
+		t.Errorf("Expected reads not limited, got %q", reply)
+	}
+	if v := server.metrics.Value("lamport_rate_limited_total"); v != 1 {
+		t.Errorf("Expected the refusal counted, got %v", v)
+	}
+}
+
+func TestTextProtocolTLS(t *testing.T) {
+	cfg := writeTestPKI(t)
+	server := NewServer()
+	server.peerCerts = true
+	serverTLS, err := serverTLSConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serveText(t, server, serverTLS).String()
+
+	// Plain TCP gets no reply
+	plain, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+	plain.SetDeadline(time.Now().Add(2 * time.Second))
+	plain.Write([]byte("TIME\r\n"))
+	if line, _ := bufio.NewReader(plain).ReadString('\n'); strings.HasPrefix(line, "OK") {
+		t.Errorf("Expected no reply over plain TCP, got %q", line)
+	}
+
+	// Without a client certificate clients tick but send no messages
+	anonymous, err := peerTLSConfig(&Config{TLSCAFile: cfg.TLSCAFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := tls.Dial("tcp", addr, anonymous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	send, _ := textClient(t, conn)
+	if reply := send("TICK"); !strings.HasPrefix(reply, "OK 1 ") {
+		t.Errorf("Expected clients to tick, got %q", reply)
+	}
+	if reply := send("UPDATE 1000"); reply != "ERR Client certificate required" {
+		t.Errorf("Expected the message refused without a certificate, got %q", reply)
+	}
+
+	peer, err := peerTLSConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err = tls.Dial("tcp", addr, peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	send, _ = textClient(t, conn)
+	if reply := send("UPDATE 10"); reply != "OK 11 msg-11" {
+		t.Errorf("Expected peers to send messages, got %q", reply)
+	}
+	if got := server.clock.GetTime(); got != 11 {
+		t.Errorf("Expected the clock at 11, got %d", got)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+)
+
+// TieBreaker orders events that have the same Lamport time, turning the
+// partial order of timestamps into a total one. Less is only called for
+// such events.
+type TieBreaker interface {
+	Less(a, b Event) bool
+}
+
+// TieBreakerFunc adapts a function to TieBreaker
+type TieBreakerFunc func(a, b Event) bool
+
+// Less calls f
+func (f TieBreakerFunc) Less(a, b Event) bool { return f(a, b) }
+
+// Every strategy falls back to the event ID
+var (
+	// NodeTieBreaker orders by the node that recorded the event, the
+	// classic choice
+	NodeTieBreaker TieBreaker = TieBreakerFunc(func(a, b Event) bool {
+		if a.Node != b.Node {
+			return a.Node < b.Node
+		}
+		return a.ID < b.ID
+	})
+
+	// HashTieBreaker orders by a hash of the event ID, so no node wins
+	// every tie
+	HashTieBreaker TieBreaker = TieBreakerFunc(func(a, b Event) bool {
+		if ha, hb := eventIDHash(a.ID), eventIDHash(b.ID); ha != hb {
+			return ha < hb
+		}
+		return a.ID < b.ID
+	})
+)
+
+// arrivalTieBreaker orders by the wall time events were recorded at. It
+// depends on where events were observed, so it is not used for multicast
+// delivery, which every node must order the same way.
+type arrivalTieBreaker struct{}
+
+func (arrivalTieBreaker) Less(a, b Event) bool {
+	if !a.WallTime.Equal(b.WallTime) {
+		return a.WallTime.Before(b.WallTime)
+	}
+	return a.ID < b.ID
+}
+
+// ArrivalTieBreaker orders ties by arrival
+var ArrivalTieBreaker TieBreaker = arrivalTieBreaker{}
+
+// MetadataTieBreaker orders by the value of a metadata key; events without
+// it come first
+func MetadataTieBreaker(key string) TieBreaker {
+	return TieBreakerFunc(func(a, b Event) bool {
+		if va, vb := a.Metadata[key], b.Metadata[key]; va != vb {
+			return va < vb
+		}
+		return a.ID < b.ID
+	})
+}
+
+func eventIDHash(id string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	return h.Sum64()
+}
+
+// parseTieBreaker maps a configuration value to a strategy: node, hash,
+// arrival or meta:<key>
+func parseTieBreaker(name string) (TieBreaker, error) {
+	switch name {
+	case "", "node":
+		return NodeTieBreaker, nil
+	case "hash":
+		return HashTieBreaker, nil
+	case "arrival":
+		return ArrivalTieBreaker, nil
+	}
+	if key, ok := strings.CutPrefix(name, "meta:"); ok && key != "" {
+		return MetadataTieBreaker(key), nil
+	}
+	return nil, fmt.Errorf("unknown tie breaker %q", name)
+}
+
+// SortEvents orders events by Lamport time, then by tie
+func SortEvents(events []Event, tie TieBreaker) {
+	sort.SliceStable(events, func(i, j int) bool {
+		a, b := events[i], events[j]
+		if c := (ClockTime{Epoch: a.Epoch, Timestamp: a.Timestamp}).Compare(ClockTime{Epoch: b.Epoch, Timestamp: b.Timestamp}); c != 0 {
+			return c < 0
+		}
+		return tie.Less(a, b)
+	})
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSortEventsTieBreakers(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := []Event{
+		{ID: "x", Timestamp: 5, Node: "c", WallTime: base, Metadata: map[string]string{"rank": "2"}},
+		{ID: "y", Timestamp: 5, Node: "a", WallTime: base.Add(time.Second), Metadata: map[string]string{"rank": "1"}},
+		{ID: "z", Timestamp: 3, Node: "b", WallTime: base.Add(2 * time.Second)},
+		{ID: "w", Timestamp: 1, Epoch: 1, Node: "a", WallTime: base},
+	}
+	ids := func(tie TieBreaker) string {
+		sorted := append([]Event(nil), events...)
+		SortEvents(sorted, tie)
+		var s string
+		for _, e := range sorted {
+			s += e.ID
+		}
+		return s
+	}
+
+	if got := ids(NodeTieBreaker); got != "zyxw" {
+		t.Errorf("Expected zyxw by node, got %s", got)
+	}
+	if got := ids(ArrivalTieBreaker); got != "zxyw" {
+		t.Errorf("Expected zxyw by arrival, got %s", got)
+	}
+	if got := ids(MetadataTieBreaker("rank")); got != "zyxw" {
+		t.Errorf("Expected zyxw by metadata, got %s", got)
+	}
+	want := "zxyw"
+	if eventIDHash("y") < eventIDHash("x") {
+		want = "zyxw"
+	}
+	if got := ids(HashTieBreaker); got != want {
+		t.Errorf("Expected %s by hash, got %s", want, got)
+	}
+}
+
+func TestParseTieBreaker(t *testing.T) {
+	for _, name := range []string{"", "node", "hash", "arrival", "meta:region"} {
+		if _, err := parseTieBreaker(name); err != nil {
+			t.Errorf("Expected %q to parse, got %v", name, err)
+		}
+	}
+	for _, name := range []string{"random", "meta:"} {
+		if _, err := parseTieBreaker(name); err == nil {
+			t.Errorf("Expected an error for %q", name)
+		}
+	}
+}
+
+func TestGetEventsTotalOrder(t *testing.T) {
+	server := NewServer()
+	server.nodeID = "b"
+	server.logEvent("late", "Local")                                          // 1
+	server.appendEvent(Event{ID: "imported", Timestamp: 1, Backfilled: true}) // tie at 1
+	server.appendEvent(Event{ID: "early", Timestamp: 0, Backfilled: true})
+
+	get := func(query string) []Event {
+		req := httptest.NewRequest(http.MethodGet, "/events"+query, nil)
+		w := httptest.NewRecorder()
+		server.handleGetEvents(w, req)
+		var response struct {
+			Events []Event `json:"events"`
+		}
+		json.NewDecoder(w.Body).Decode(&response)
+		return response.Events
+	}
+
+	if events := get(""); len(events) != 3 || events[0].ID != "late" {
+		t.Errorf("Expected log order by default, got %v", events)
+	}
+	events := get("?order=total")
+	if len(events) != 3 || events[0].ID != "early" || events[1].ID != "imported" || events[2].ID != "late" {
+		t.Errorf("Expected early, imported, late, got %v", events)
+	}
+	if events[2].Node != "b" {
+		t.Errorf("Expected events attributed to the node, got %q", events[2].Node)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/events?order=random", nil)
+	w := httptest.NewRecorder()
+	server.handleGetEvents(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown order, got %d", w.Code)
+	}
+}
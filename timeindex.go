@@ -0,0 +1,132 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// timeEntry points from a Lamport time to the event stamped with it by its
+// position in the log
+type timeEntry struct {
+	at  ClockTime
+	seq int64
+}
+
+func (e timeEntry) less(other timeEntry) bool {
+	c := e.at.Compare(other.at)
+	return c < 0 || (c == 0 && e.seq < other.seq)
+}
+
+// timeIndex orders the positions of a log by the time of their events, then
+// by position, for lookups by timestamp without scanning the log. Events
+// are mostly appended in time order, which only appends to the index.
+// Callers synchronize.
+type timeIndex struct {
+	entries []timeEntry
+}
+
+func (ix *timeIndex) add(e timeEntry) {
+	n := len(ix.entries)
+	if n == 0 || ix.entries[n-1].less(e) {
+		ix.entries = append(ix.entries, e)
+		return
+	}
+	i := sort.Search(n, func(i int) bool { return e.less(ix.entries[i]) })
+	ix.entries = slices.Insert(ix.entries, i, e)
+}
+
+// remove drops the entry of the event at position seq stamped at
+func (ix *timeIndex) remove(at ClockTime, seq int64) {
+	key := timeEntry{at: at, seq: seq}
+	i := sort.Search(len(ix.entries), func(i int) bool { return !ix.entries[i].less(key) })
+	if i == len(ix.entries) || ix.entries[i].at != at || ix.entries[i].seq != seq {
+		return
+	}
+	if i == 0 {
+		// Rings evict their oldest event, usually the first entry
+		ix.entries = ix.entries[1:]
+		return
+	}
+	ix.entries = slices.Delete(ix.entries, i, i+1)
+}
+
+func (ix *timeIndex) reset() {
+	ix.entries = nil
+}
+
+// between returns a copy of the entries stamped from from to to, inclusive
+func (ix *timeIndex) between(from, to ClockTime) []timeEntry {
+	lo := sort.Search(len(ix.entries), func(i int) bool { return !ix.entries[i].at.Before(from) })
+	hi := sort.Search(len(ix.entries), func(i int) bool { return to.Before(ix.entries[i].at) })
+	if lo >= hi {
+		return nil
+	}
+	return slices.Clone(ix.entries[lo:hi])
+}
+
+// clockTime is the logical time an event was stamped with
+func (e Event) clockTime() ClockTime {
+	return ClockTime{Epoch: e.Epoch, Timestamp: e.Timestamp}
+}
+
+// handleEventsAt lists the events stamped with a Lamport timestamp,
+// GET /events/at/<timestamp>[?epoch=<e>]
+func (s *Server) handleEventsAt(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	at, ok := s.parseEventTime(w, r, strings.TrimPrefix(r.URL.Path, "/events/at/"))
+	if !ok {
+		return
+	}
+	writeEventList(w, r, s.events.Between(at, at), s.clock.Now(), s.events.Dropped())
+}
+
+// handleEventsRange lists the events stamped from one Lamport timestamp to
+// another, inclusive, GET /events/range/<from>/<to>[?epoch=<e>]
+func (s *Server) handleEventsRange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	fromPath, toPath, found := strings.Cut(strings.TrimPrefix(r.URL.Path, "/events/range/"), "/")
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	from, ok := s.parseEventTime(w, r, fromPath)
+	if !ok {
+		return
+	}
+	to, ok := s.parseEventTime(w, r, toPath)
+	if !ok {
+		return
+	}
+	if to.Before(from) {
+		http.Error(w, "Invalid range, to is before from", http.StatusBadRequest)
+		return
+	}
+	writeEventList(w, r, s.events.Between(from, to), s.clock.Now(), s.events.Dropped())
+}
+
+// parseEventTime reads a timestamp of the path in the epoch of the query,
+// the current epoch of the clock without one
+func (s *Server) parseEventTime(w http.ResponseWriter, r *http.Request, v string) (ClockTime, bool) {
+	ts, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || ts < 0 {
+		http.Error(w, "Invalid timestamp", http.StatusBadRequest)
+		return ClockTime{}, false
+	}
+	at := ClockTime{Epoch: s.clock.Now().Epoch, Timestamp: ts}
+	if v := r.URL.Query().Get("epoch"); v != "" {
+		if at.Epoch, err = strconv.ParseInt(v, 10, 64); err != nil || at.Epoch < 0 {
+			http.Error(w, "Invalid epoch parameter", http.StatusBadRequest)
+			return ClockTime{}, false
+		}
+	}
+	return at, true
+}
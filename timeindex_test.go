@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func eventIDs(events []Event) []string {
+	ids := make([]string, len(events))
+	for i, e := range events {
+		ids[i] = e.ID
+	}
+	return ids
+}
+
+func TestStoresBetween(t *testing.T) {
+	stores := map[string]EventStore{"sharded": NewShardedStore(4), "ring": NewRingStore(100), "compressed": NewCompressedStore(3)}
+	for name, st := range stores {
+		for i := 1; i <= 20; i++ {
+			st.Append(Event{ID: fmt.Sprintf("e%d", i), Timestamp: int64(i)})
+		}
+		// Out of order and sharing timestamps, as imports and merges do
+		st.Append(Event{ID: "late", Timestamp: 5})
+		st.Append(Event{ID: "old", Timestamp: 3})
+		st.Append(Event{ID: "next", Epoch: 1, Timestamp: 1})
+
+		if got := fmt.Sprint(eventIDs(st.Between(ClockTime{Timestamp: 5}, ClockTime{Timestamp: 5}))); got != "[e5 late]" {
+			t.Errorf("%s: expected e5 and late at 5, got %s", name, got)
+		}
+		if got := fmt.Sprint(eventIDs(st.Between(ClockTime{Timestamp: 2}, ClockTime{Timestamp: 4}))); got != "[e2 e3 old e4]" {
+			t.Errorf("%s: expected e2 to e4 in time order, got %s", name, got)
+		}
+		if got := fmt.Sprint(eventIDs(st.Between(ClockTime{Timestamp: 20}, ClockTime{Epoch: 1, Timestamp: 9}))); got != "[e20 next]" {
+			t.Errorf("%s: expected the range to span the epochs, got %s", name, got)
+		}
+		if got := st.Between(ClockTime{Timestamp: 21}, ClockTime{Timestamp: 30}); len(got) != 0 {
+			t.Errorf("%s: expected nothing between 21 and 30, got %v", name, eventIDs(got))
+		}
+
+		st.Replace([]Event{{ID: "a", Timestamp: 7}, {ID: "b", Timestamp: 7}})
+		if got := fmt.Sprint(eventIDs(st.Between(ClockTime{Timestamp: 5}, ClockTime{Timestamp: 7}))); got != "[a b]" {
+			t.Errorf("%s: expected the index to follow a replace, got %s", name, got)
+		}
+	}
+}
+
+func TestRingStoreBetweenDropsOverwritten(t *testing.T) {
+	st := NewRingStore(3)
+	for i := 1; i <= 5; i++ {
+		st.Append(Event{ID: fmt.Sprintf("e%d", i), Timestamp: int64(i)})
+	}
+	if got := fmt.Sprint(eventIDs(st.Between(ClockTime{}, ClockTime{Timestamp: 10}))); got != "[e3 e4 e5]" {
+		t.Errorf("Expected only the kept events, got %s", got)
+	}
+	if len(st.index.times.entries) != 3 {
+		t.Errorf("Expected 3 index entries, got %d", len(st.index.times.entries))
+	}
+}
+
+func TestHandleEventsAtAndRange(t *testing.T) {
+	server := NewServer()
+	for i := 1; i <= 5; i++ {
+		server.logEvent(fmt.Sprintf("e%d", i), "event") // at i
+	}
+
+	get := func(handler http.HandlerFunc, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+	var body struct {
+		Current    int64   `json:"current_timestamp"`
+		EventCount int     `json:"event_count"`
+		Events     []Event `json:"events"`
+	}
+
+	json.NewDecoder(get(server.handleEventsAt, "/events/at/3").Body).Decode(&body)
+	if body.EventCount != 1 || body.Events[0].ID != "e3" || body.Current != 5 {
+		t.Errorf("Expected e3 at 3, got %+v", body)
+	}
+	json.NewDecoder(get(server.handleEventsRange, "/events/range/2/4").Body).Decode(&body)
+	if got := fmt.Sprint(eventIDs(body.Events)); got != "[e2 e3 e4]" {
+		t.Errorf("Expected e2 to e4, got %s", got)
+	}
+	json.NewDecoder(get(server.handleEventsRange, "/events/range/2/4?epoch=1").Body).Decode(&body)
+	if body.EventCount != 0 {
+		t.Errorf("Expected no events in epoch 1, got %+v", body.Events)
+	}
+
+	for _, c := range []struct {
+		handler http.HandlerFunc
+		target  string
+		want    int
+	}{
+		{server.handleEventsAt, "/events/at/x", http.StatusBadRequest},
+		{server.handleEventsAt, "/events/at/-1", http.StatusBadRequest},
+		{server.handleEventsAt, "/events/at/1?epoch=x", http.StatusBadRequest},
+		{server.handleEventsRange, "/events/range/4/2", http.StatusBadRequest},
+		{server.handleEventsRange, "/events/range/4", http.StatusNotFound},
+	} {
+		if w := get(c.handler, c.target); w.Code != c.want {
+			t.Errorf("%s: expected %d, got %d", c.target, c.want, w.Code)
+		}
+	}
+}
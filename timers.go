@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/clocktimer"
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec"
+)
+
+// maxClockTimers bounds the timers waiting to call their URL
+const maxClockTimers = 10000
+
+var errTooManyTimers = errors.New("too many timers")
+
+// ClockTimer is a logical timeout: once the clock reaches At in Epoch, a
+// JSON description of the timer is posted to URL, signed with Secret like
+// webhook deliveries
+type ClockTimer struct {
+	ID      string    `json:"id"`
+	At      int64     `json:"at"`
+	Epoch   int64     `json:"epoch"`
+	URL     string    `json:"url"`
+	Secret  string    `json:"secret,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// ClockTimers calls URLs at points of logical time, through the timers of
+// the clocktimer package following the main clock. The timers only hook
+// into the clock while some are set, so the event path stays free of the
+// hook otherwise.
+type ClockTimers struct {
+	timers   *clocktimer.Timers
+	pending  map[string]*pendingTimer
+	webhooks *Webhooks
+	server   *Server
+	unhook   func() // unregisters the timers from the server hooks, nil without timers
+	next     int64
+	mutex    sync.Mutex
+}
+
+type pendingTimer struct {
+	info  ClockTimer
+	timer *clocktimer.Timer // nil until set
+}
+
+// NewClockTimers creates the timers of a server, posting through its
+// webhook deliveries
+func NewClockTimers(server *Server, webhooks *Webhooks) *ClockTimers {
+	server.metrics.Counter("lamport_timers_fired_total", "Logical timers that reached their time")
+	return &ClockTimers{
+		timers:   clocktimer.New(),
+		pending:  make(map[string]*pendingTimer),
+		webhooks: webhooks,
+		server:   server,
+	}
+}
+
+// Add sets a timer at info.At, or after ticks from the current time when
+// after is positive. The time must be ahead of the clock.
+func (ct *ClockTimers) Add(info ClockTimer, after int64) (ClockTimer, error) {
+	if err := checkWebhookURL(info.URL); err != nil {
+		return ClockTimer{}, err
+	}
+	now := ct.server.clock.Now()
+	if after > 0 {
+		info.At, info.Epoch = now.Timestamp+after, now.Epoch
+	}
+	if !now.Before(ClockTime{Epoch: info.Epoch, Timestamp: info.At}) {
+		return ClockTimer{}, ErrNotInFuture
+	}
+
+	ct.mutex.Lock()
+	if len(ct.pending) >= maxClockTimers {
+		ct.mutex.Unlock()
+		return ClockTimer{}, errTooManyTimers
+	}
+	ct.next++
+	info.ID = "timer-" + strconv.FormatInt(ct.next, 10)
+	info.Created = time.Now()
+	ct.pending[info.ID] = &pendingTimer{info: info}
+	hook := ct.unhook == nil
+	if hook {
+		ct.unhook = ct.server.RegisterHook(ct.timers)
+	}
+	ct.mutex.Unlock()
+
+	// Callbacks run when the timers advance or, if the clock reached the
+	// time meanwhile, right away, so the timers are used without the lock
+	if hook {
+		ct.timers.Advance(ct.server.clock.Now().wire())
+	}
+	id := info.ID
+	timer := ct.timers.At(codec.Timestamp{Epoch: info.Epoch, Timestamp: info.At}, func(now codec.Timestamp) {
+		ct.fire(id, now)
+	})
+	ct.mutex.Lock()
+	if p, ok := ct.pending[id]; ok {
+		p.timer = timer
+	} else {
+		timer.Stop() // removed while being set
+	}
+	ct.mutex.Unlock()
+	return info, nil
+}
+
+// Remove cancels a timer and reports whether it was still waiting
+func (ct *ClockTimers) Remove(id string) bool {
+	ct.mutex.Lock()
+	defer ct.mutex.Unlock()
+	p, ok := ct.pending[id]
+	if !ok {
+		return false
+	}
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	ct.dropLocked(id)
+	return true
+}
+
+// List returns the waiting timers, the next to fire first, with their
+// secrets hidden
+func (ct *ClockTimers) List() []ClockTimer {
+	ct.mutex.Lock()
+	list := make([]ClockTimer, 0, len(ct.pending))
+	for _, p := range ct.pending {
+		info := p.info
+		if info.Secret != "" {
+			info.Secret = "redacted"
+		}
+		list = append(list, info)
+	}
+	ct.mutex.Unlock()
+	slices.SortFunc(list, func(a, b ClockTimer) int {
+		if c := (ClockTime{Epoch: a.Epoch, Timestamp: a.At}).Compare(ClockTime{Epoch: b.Epoch, Timestamp: b.At}); c != 0 {
+			return c
+		}
+		return a.Created.Compare(b.Created)
+	})
+	return list
+}
+
+// fire posts a timer that reached its time to its URL
+func (ct *ClockTimers) fire(id string, now codec.Timestamp) {
+	ct.mutex.Lock()
+	p, ok := ct.pending[id]
+	if ok {
+		ct.dropLocked(id)
+	}
+	ct.mutex.Unlock()
+	if !ok {
+		return
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"timer_id": p.info.ID,
+		"at":       ClockTime{Epoch: p.info.Epoch, Timestamp: p.info.At},
+		"fired_at": clockTimeFromWire(now),
+	})
+	if err != nil {
+		return
+	}
+	ct.server.metrics.Inc("lamport_timers_fired_total")
+	d := ct.webhooks.Send(p.info.ID, p.info.URL, p.info.Secret, body)
+	ct.server.logger.Info("Timer fired", "timer", id, "at", p.info.At, "lamport_timestamp", now.Timestamp, "delivery", d.ID)
+}
+
+// dropLocked forgets a timer, unhooking from the clock after the last one
+func (ct *ClockTimers) dropLocked(id string) {
+	delete(ct.pending, id)
+	if len(ct.pending) == 0 && ct.unhook != nil {
+		ct.unhook()
+		ct.unhook = nil
+	}
+}
+
+// handleTimers lists (GET) and sets (POST) timers. POST takes a JSON body
+// with url, optionally secret, and either at, with epoch defaulting to the
+// current one, or after, a number of ticks from now.
+func (ct *ClockTimers) handleTimers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		list := ct.List()
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"current_timestamp": ct.server.clock.GetTime(),
+			"count":             len(list),
+			"timers":            list,
+		})
+
+	case http.MethodPost:
+		var body struct {
+			ClockTimer
+			Epoch *int64 `json:"epoch"`
+			After int64  `json:"after"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if (body.At > 0) == (body.After > 0) {
+			http.Error(w, "Expected either at or after, as a positive number", http.StatusBadRequest)
+			return
+		}
+		info := body.ClockTimer
+		info.Epoch = ct.server.clock.Now().Epoch
+		if body.Epoch != nil {
+			info.Epoch = *body.Epoch
+		}
+		if info.Epoch < 0 {
+			http.Error(w, "Invalid epoch", http.StatusBadRequest)
+			return
+		}
+
+		info, err := ct.Add(info, body.After)
+		switch {
+		case errors.Is(err, ErrNotInFuture):
+			http.Error(w, "at must be after the current time", http.StatusConflict)
+			return
+		case errors.Is(err, errTooManyTimers):
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if info.Secret != "" {
+			info.Secret = "redacted"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(info)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTimer cancels a timer, DELETE /timers/<id>
+func (ct *ClockTimers) handleTimer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !ct.Remove(strings.TrimPrefix(r.URL.Path, "/timers/")) {
+		http.Error(w, "Unknown timer", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestClockTimersFire(t *testing.T) {
+	var mutex sync.Mutex
+	var got []map[string]interface{}
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var payload map[string]interface{}
+		json.Unmarshal(body, &payload)
+		mutex.Lock()
+		got = append(got, payload)
+		mutex.Unlock()
+		if r.Header.Get(headerWebhookSignature) != webhookSignature("s3cret", body) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer target.Close()
+
+	server, wh := newTestWebhooks(t, 1)
+	ct := NewClockTimers(server, wh)
+	timer, err := ct.Add(ClockTimer{URL: target.URL, Secret: "s3cret"}, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cancelled, _ := ct.Add(ClockTimer{URL: target.URL, At: 3}, 0)
+	if timer.At != 2 || !server.hooks.Enabled() {
+		t.Fatalf("Expected a timer at 2 hooked into the clock, got %+v", timer)
+	}
+	if !ct.Remove(cancelled.ID) || ct.Remove(cancelled.ID) {
+		t.Error("Expected the timer to be removed exactly once")
+	}
+
+	server.logEvent("e1", "One")
+	if len(ct.List()) != 1 {
+		t.Fatal("Expected nothing to fire before 2")
+	}
+	server.logEvent("e2", "Two")
+	server.logEvent("e3", "Three")
+
+	deliveries := waitDeliveries(t, wh, 1)
+	if d := deliveries[0]; d.Status != deliveryDelivered || d.Webhook != timer.ID {
+		t.Errorf("Expected the timer to be delivered, got %+v", d)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(got) != 1 || got[0]["timer_id"] != timer.ID {
+		t.Errorf("Expected only the timer at 2 to be posted, got %+v", got)
+	}
+	if len(ct.List()) != 0 || server.hooks.Enabled() {
+		t.Error("Expected the timers to unhook from the clock once none is left")
+	}
+}
+
+func TestHandleTimers(t *testing.T) {
+	server, wh := newTestWebhooks(t, 1)
+	ct := NewClockTimers(server, wh)
+	server.logEvent("e1", "One")
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ct.handleTimers(w, httptest.NewRequest(http.MethodPost, "/timers", strings.NewReader(body)))
+		return w
+	}
+
+	w := post(`{"url":"http://example.com/timeout","secret":"s3cret","at":10}`)
+	var timer ClockTimer
+	json.NewDecoder(w.Body).Decode(&timer)
+	if w.Code != http.StatusCreated || timer.ID == "" || timer.At != 10 || timer.Secret != "redacted" {
+		t.Fatalf("Expected the timer set, got %d %+v", w.Code, timer)
+	}
+
+	w = httptest.NewRecorder()
+	ct.handleTimers(w, httptest.NewRequest(http.MethodGet, "/timers", nil))
+	var list struct {
+		Count  int          `json:"count"`
+		Timers []ClockTimer `json:"timers"`
+	}
+	json.NewDecoder(w.Body).Decode(&list)
+	if list.Count != 1 || list.Timers[0].Secret != "redacted" {
+		t.Errorf("Expected 1 timer with its secret hidden, got %+v", list)
+	}
+
+	for _, c := range []struct {
+		body string
+		want int
+	}{
+		{`{"url":"http://example.com"}`, http.StatusBadRequest},
+		{`{"url":"http://example.com","at":5,"after":5}`, http.StatusBadRequest},
+		{`{"url":"ftp://example.com","after":5}`, http.StatusBadRequest},
+		{`{"url":"http://example.com","at":5,"epoch":-1}`, http.StatusBadRequest},
+		{`{"url":`, http.StatusBadRequest},
+		{`{"url":"http://example.com","at":1}`, http.StatusConflict},
+	} {
+		if w := post(c.body); w.Code != c.want {
+			t.Errorf("%s: expected %d, got %d", c.body, c.want, w.Code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	ct.handleTimer(w, httptest.NewRequest(http.MethodDelete, "/timers/"+timer.ID, nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	ct.handleTimer(w, httptest.NewRequest(http.MethodDelete, "/timers/"+timer.ID, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a cancelled timer, got %d", w.Code)
+	}
+}
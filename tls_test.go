@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestPKI creates a CA and a node certificate signed by it, valid for
+// 127.0.0.1 as both server and client, and returns a Config pointing at them
+func writeTestPKI(t *testing.T) *Config {
+	t.Helper()
+	dir := t.TempDir()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate CA key: %v", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("Failed to create CA certificate: %v", err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+
+	nodeKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate node key: %v", err)
+	}
+	nodeTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "node"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	nodeDER, err := x509.CreateCertificate(rand.Reader, nodeTemplate, caCert, &nodeKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("Failed to create node certificate: %v", err)
+	}
+	nodeKeyDER, _ := x509.MarshalECPrivateKey(nodeKey)
+
+	writePEM := func(name, blockType string, der []byte) string {
+		path := filepath.Join(dir, name)
+		data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+
+	return &Config{
+		TLSCAFile:   writePEM("ca.pem", "CERTIFICATE", caDER),
+		TLSCertFile: writePEM("node.pem", "CERTIFICATE", nodeDER),
+		TLSKeyFile:  writePEM("node-key.pem", "EC PRIVATE KEY", nodeKeyDER),
+	}
+}
+
+func TestMutualTLSPeerMessage(t *testing.T) {
+	cfg := writeTestPKI(t)
+	server := NewServer()
+
+	tlsConfig, err := serverTLSConfig(cfg)
+	if err != nil {
+		t.Fatalf("Failed to build server TLS config: %v", err)
+	}
+
+	ts := httptest.NewUnstartedServer(requireClientCert(server.handleReceiveMessage))
+	ts.TLS = tlsConfig
+	ts.StartTLS()
+	defer ts.Close()
+
+	// A peer presenting the node certificate is accepted
+	peerClient, err := newPeerClient(cfg)
+	if err != nil {
+		t.Fatalf("Failed to build peer client: %v", err)
+	}
+	resp, err := peerClient.Post(ts.URL+"?timestamp=10&message=peer", "", nil)
+	if err != nil {
+		t.Fatalf("Peer request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status OK for verified peer, got %d", resp.StatusCode)
+	}
+
+	// A client that trusts the CA but has no certificate is rejected
+	anonymous := &Config{TLSCAFile: cfg.TLSCAFile}
+	anonClient, err := newPeerClient(anonymous)
+	if err != nil {
+		t.Fatalf("Failed to build anonymous client: %v", err)
+	}
+	resp, err = anonClient.Post(ts.URL+"?timestamp=1000000&message=spoofed", "", nil)
+	if err != nil {
+		t.Fatalf("Anonymous request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status Unauthorized without client certificate, got %d", resp.StatusCode)
+	}
+
+	// The spoofed timestamp must not have reached the clock
+	if server.clock.GetTime() != 11 {
+		t.Errorf("Expected clock to be 11, got %d", server.clock.GetTime())
+	}
+}
+
+func TestRequireClientCertWithoutTLS(t *testing.T) {
+	server := NewServer()
+	handler := requireClientCert(server.handleReceiveMessage)
+
+	req := httptest.NewRequest("POST", "/message?timestamp=5&message=plain", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status Unauthorized for plain HTTP request, got %d", w.Code)
+	}
+}
+
+func TestServerTLSConfigInvalidCA(t *testing.T) {
+	cfg := writeTestPKI(t)
+	cfg.TLSCAFile = cfg.TLSKeyFile // not a certificate
+
+	if _, err := serverTLSConfig(cfg); err == nil {
+		t.Error("Expected error for CA bundle without certificates")
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// traceVersion is the format of trace files
+	traceVersion = 1
+	// traceFlushInterval is how often recorded operations reach the file
+	traceFlushInterval = time.Second
+	// maxTraceLine bounds a line of a trace being replayed
+	maxTraceLine = 1 << 20
+)
+
+// TraceHeader starts a recording: the clock it was taken on, so a replay
+// starts where it did. A file holds one recording per server start.
+type TraceHeader struct {
+	Trace    int       `json:"trace"`
+	Node     string    `json:"node,omitempty"`
+	Rollover int64     `json:"rollover"`
+	Start    ClockTime `json:"start"`
+	WallTime time.Time `json:"wall_time"`
+}
+
+// ClockTrace records every operation on a clock with its inputs, in the
+// order they took effect, as JSON lines: a TraceHeader followed by one
+// ClockTransition per operation, including those that left the clock
+// where it was. Operations the jump guard rejected change nothing and are
+// not recorded. A nil trace records nothing.
+type ClockTrace struct {
+	file  *os.File
+	out   *bufio.Writer
+	enc   *json.Encoder
+	seq   uint64
+	err   error // first write error, after which nothing is recorded
+	mutex sync.Mutex
+}
+
+// OpenClockTrace appends recordings to the file at path
+func OpenClockTrace(path string) (*ClockTrace, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	out := bufio.NewWriter(file)
+	return &ClockTrace{file: file, out: out, enc: json.NewEncoder(out)}, nil
+}
+
+// Record starts recording the operations of clock, which belongs to node
+func (t *ClockTrace) Record(clock *LamportClock, node string) error {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.write(TraceHeader{Trace: traceVersion, Node: node, Rollover: clock.rollover, Start: clock.nowLocked(), WallTime: clock.wall()})
+	if t.err != nil {
+		return t.err
+	}
+	clock.trace = t
+	return nil
+}
+
+// record appends an operation. It runs under the clock's lock, so the
+// trace follows the order in which operations took effect.
+func (t *ClockTrace) record(op ClockTransition) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.seq++
+	op.Seq = t.seq
+	t.write(op)
+}
+
+func (t *ClockTrace) write(v any) {
+	if t.err == nil {
+		t.err = t.enc.Encode(v)
+	}
+}
+
+// Flush writes the buffered operations to the file
+func (t *ClockTrace) Flush() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.err == nil {
+		t.err = t.out.Flush()
+	}
+	return t.err
+}
+
+// Run flushes the trace every traceFlushInterval until ctx is done
+func (t *ClockTrace) Run(ctx context.Context) {
+	ticker := time.NewTicker(traceFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.Flush()
+		}
+	}
+}
+
+// Close flushes the trace and closes the file
+func (t *ClockTrace) Close() error {
+	err := t.Flush()
+	return errors.Join(err, t.file.Close())
+}
+
+// TraceDivergence is the first operation a replay did not reproduce: the
+// clock was elsewhere before it, or it took the clock elsewhere
+type TraceDivergence struct {
+	Recorded ClockTransition `json:"recorded"`
+	From     ClockTime       `json:"from"`
+	To       ClockTime       `json:"to"`
+}
+
+// TraceReport is the outcome of a replay
+type TraceReport struct {
+	Recordings int              `json:"recordings"`
+	Operations int              `json:"operations"`
+	Final      ClockTime        `json:"final"`
+	Divergence *TraceDivergence `json:"divergence,omitempty"`
+}
+
+// ReplayTrace runs the operations of a trace against a fresh server, a new
+// one for every recording in it, and checks that every operation starts
+// from and produces the recorded time. It stops at the first divergence.
+// Clamped timestamps are merged as clamped, since the guard's setting is
+// not part of the trace.
+func ReplayTrace(r io.Reader) (TraceReport, error) {
+	var report TraceReport
+	var server *Server
+	lines := bufio.NewScanner(r)
+	lines.Buffer(make([]byte, 0, 64<<10), maxTraceLine)
+	for n := 1; lines.Scan(); n++ {
+		var probe struct {
+			Trace int `json:"trace"`
+		}
+		if err := json.Unmarshal(lines.Bytes(), &probe); err != nil {
+			return report, fmt.Errorf("line %d: %w", n, err)
+		}
+		if probe.Trace != 0 {
+			var header TraceHeader
+			if err := json.Unmarshal(lines.Bytes(), &header); err != nil {
+				return report, fmt.Errorf("line %d: %w", n, err)
+			}
+			if header.Trace != traceVersion {
+				return report, fmt.Errorf("line %d: unsupported trace version %d", n, header.Trace)
+			}
+			if header.Rollover <= 0 {
+				return report, fmt.Errorf("line %d: invalid rollover %d", n, header.Rollover)
+			}
+			server = NewServer(WithClock(NewLamportClock(WithRollover(header.Rollover))), WithNodeID(header.Node))
+			server.clock.restore(header.Start, 0)
+			report.Recordings++
+			report.Final = server.clock.Now()
+			continue
+		}
+		if server == nil {
+			return report, fmt.Errorf("line %d: operation before the trace header", n)
+		}
+
+		var op ClockTransition
+		if err := json.Unmarshal(lines.Bytes(), &op); err != nil {
+			return report, fmt.Errorf("line %d: %w", n, err)
+		}
+		from := server.clock.Now()
+		if from != op.From {
+			report.Divergence = &TraceDivergence{Recorded: op, From: from, To: from}
+			return report, nil
+		}
+		if err := replayOperation(server.clock, op); err != nil {
+			return report, fmt.Errorf("line %d: %w", n, err)
+		}
+		report.Operations++
+		report.Final = server.clock.Now()
+		if report.Final != op.To {
+			report.Divergence = &TraceDivergence{Recorded: op, From: from, To: report.Final}
+			return report, nil
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return report, err
+	}
+	if report.Recordings == 0 {
+		return report, errors.New("no trace header")
+	}
+	return report, nil
+}
+
+// replayTraceFile replays the trace in the file at path and writes the
+// report to out
+func replayTraceFile(path string, out io.Writer) (TraceReport, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return TraceReport{}, err
+	}
+	defer file.Close()
+	report, err := ReplayTrace(file)
+	if err != nil {
+		return report, err
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return report, enc.Encode(report)
+}
+
+// replayOperation applies a recorded operation to a clock without a jump
+// guard
+func replayOperation(lc *LamportClock, op ClockTransition) error {
+	received := op.Received
+	switch op.Cause {
+	case causeTick:
+		if op.To.Epoch > op.From.Epoch {
+			// Groups of ticks start the next epoch early, see tickN
+			lc.mutex.Lock()
+			lc.timestamp = lc.rollover
+			lc.mutex.Unlock()
+		}
+		lc.TickTime()
+	case causeUpdate:
+		if op.Clamped {
+			// The clamped timestamp is the one the clock incremented
+			received = ClockTime{Epoch: op.To.Epoch, Timestamp: op.To.Timestamp - 1}
+		}
+		lc.UpdateTime(received)
+	case causeObserve:
+		if op.Clamped {
+			received = op.To
+		}
+		lc.ObserveChecked(received)
+	case causeCommit:
+		lc.observe(received)
+	case causeRestore:
+		lc.restore(op.To, 0)
+	case causeUntick:
+		lc.untickN(ClockTime{Epoch: op.To.Epoch, Timestamp: op.To.Timestamp + 1}, int(op.From.Timestamp-op.To.Timestamp))
+	case causeAdminSet:
+		if _, err := lc.Set(op.To.Timestamp, true); err != nil {
+			return err
+		}
+	case causeAdminReset:
+		lc.Reset()
+	case causeAdminAdvance:
+		n, ok := op.From.distance(op.To, lc.rollover)
+		if !ok {
+			return fmt.Errorf("invalid advance from %s to %s", op.From, op.To)
+		}
+		if _, err := lc.Advance(n); err != nil {
+			return err
+		}
+	case causeAdminFreeze:
+		lc.Freeze()
+	case causeAdminResume:
+		lc.Resume()
+	default:
+		return fmt.Errorf("unknown operation %q", op.Cause)
+	}
+	return nil
+}
+
+// handleReplay replays a trace posted as the request body against a fresh
+// server and reports where it diverged, if it did
+func (s *Server) handleReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	report, err := ReplayTrace(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid trace: %v", err), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
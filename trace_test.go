@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// recordTrace runs a mix of clock operations on a traced server, starting
+// from start with a small rollover so epochs change along the way
+func recordTrace(t *testing.T, path string, start ClockTime) ClockTime {
+	t.Helper()
+	trace, err := OpenClockTrace(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(WithClock(NewLamportClock(WithRollover(50))), WithNodeID("node-a"))
+	server.clock.restore(start, 0)
+	if err := trace.Record(server.clock, server.nodeID); err != nil {
+		t.Fatal(err)
+	}
+	server.clock.SetJumpGuard(JumpGuard{MaxJump: 10, Policy: JumpClamp})
+
+	server.logEvent("e1", "local")
+	server.clock.UpdateTime(ClockTime{Timestamp: 30})
+	server.clock.UpdateChecked(ClockTime{Timestamp: 45}) // clamped
+	server.clock.ObserveChecked(ClockTime{Timestamp: 2}) // no change, still traced
+	server.clock.ObserveChecked(ClockTime{Epoch: 1, Timestamp: 3})
+	server.clock.observe(ClockTime{Epoch: 1, Timestamp: 9})
+	for range 60 {
+		server.clock.TickTime()
+	}
+	server.clock.Set(7, true)
+	server.clock.restore(ClockTime{Epoch: 9, Timestamp: 1}, 5)
+	server.clock.UpdateTime(ClockTime{Epoch: 9, Timestamp: 49})
+	server.clock.tickN(3, ClockSource{}) // starts epoch 10 early
+	server.clock.Reset()
+	server.clock.TickTime()
+
+	if err := trace.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return server.clock.Now()
+}
+
+func TestTraceReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clock.trace")
+	final := recordTrace(t, path, ClockTime{})
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	report, err := ReplayTrace(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Divergence != nil {
+		t.Fatalf("Expected the replay to match, diverged at %+v", *report.Divergence)
+	}
+	if report.Recordings != 1 || report.Operations != 74 || report.Final != final {
+		t.Errorf("Expected 74 operations of 1 recording ending at %s, got %+v", final, report)
+	}
+}
+
+func TestTraceReplayRestarts(t *testing.T) {
+	// A restarted server appends a recording resuming where the last ended
+	path := filepath.Join(t.TempDir(), "clock.trace")
+	first := recordTrace(t, path, ClockTime{})
+	final := recordTrace(t, path, first.advance(100, 50))
+
+	var out bytes.Buffer
+	report, err := replayTraceFile(path, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Divergence != nil || report.Recordings != 2 || report.Operations != 148 || report.Final != final {
+		t.Errorf("Expected 148 operations of 2 recordings ending at %s, got %+v", final, report)
+	}
+	if !strings.Contains(out.String(), `"recordings": 2`) {
+		t.Errorf("Expected the report printed, got %s", out.String())
+	}
+}
+
+func TestTraceReplayDivergence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clock.trace")
+	recordTrace(t, path, ClockTime{})
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A merge that took the clock further than the Lamport rule allows
+	lines := strings.Split(string(data), "\n")
+	lines[2] = strings.Replace(lines[2], `"to":{"epoch":0,"lamport_timestamp":31}`, `"to":{"epoch":0,"lamport_timestamp":32}`, 1)
+	report, err := ReplayTrace(strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := report.Divergence
+	if d == nil || d.Recorded.Seq != 2 || d.Recorded.Cause != causeUpdate || d.To.Timestamp != 31 {
+		t.Fatalf("Expected a divergence at the update to 31, got %+v", report)
+	}
+	if report.Operations != 2 {
+		t.Errorf("Expected the replay to stop after 2 operations, got %d", report.Operations)
+	}
+
+	for _, trace := range []string{"", `{"seq":1,"cause":"tick"}`, `{"trace":9,"rollover":50}`, "not json"} {
+		if _, err := ReplayTrace(strings.NewReader(trace)); err == nil {
+			t.Errorf("Expected %q to be refused", trace)
+		}
+	}
+}
+
+func TestHandleReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clock.trace")
+	recordTrace(t, path, ClockTime{})
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewServer()
+	w := httptest.NewRecorder()
+	server.handleReplay(w, httptest.NewRequest(http.MethodPost, "/admin/replay", bytes.NewReader(data)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"operations":74`) {
+		t.Errorf("Expected the report, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	server.handleReplay(w, httptest.NewRequest(http.MethodPost, "/admin/replay", strings.NewReader("{")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a malformed trace, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	server.handleReplay(w, httptest.NewRequest(http.MethodGet, "/admin/replay", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", w.Code)
+	}
+}
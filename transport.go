@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Transport carries the requests nodes make to each other. Requests keep
+// the shape of HTTP requests, a method, a path with its query, headers and
+// a body, so the peer subsystems and the handlers serving them work the
+// same whatever carries them. Implementations are safe for concurrent use.
+type Transport interface {
+	// Send delivers a request to a peer and returns its reply. Replies
+	// with an error status are returned, not reported as errors.
+	Send(ctx context.Context, peer string, req TransportRequest) (TransportReply, error)
+	// Receive serves the requests peers send to this node with handler
+	// until the transport is closed
+	Receive(handler http.Handler) error
+	// Close stops receiving and releases the connections to peers
+	Close() error
+}
+
+// TransportRequest is a request to a peer
+type TransportRequest struct {
+	Method string      `json:"method"`
+	Path   string      `json:"path"` // with the query, e.g. /message?timestamp=5
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+// TransportReply is a peer's answer to a TransportRequest
+type TransportReply struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+// Peer transports selected by -peer-transport
+const (
+	transportHTTP = "http"
+	transportGRPC = "grpc"
+	transportUDP  = "udp"
+)
+
+// newTransport creates the transport named by -peer-transport. HTTP peers
+// are served by the node's HTTP server, the others listen on
+// -transport-addr.
+func newTransport(cfg *Config, client *http.Client) (Transport, error) {
+	switch cfg.PeerTransport {
+	case transportGRPC:
+		if !cfg.TLSEnabled() {
+			return NewGRPCTransport(cfg.TransportAddr, nil, nil)
+		}
+		serverTLS, err := serverTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		peerTLS, err := peerTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return NewGRPCTransport(cfg.TransportAddr, serverTLS, peerTLS)
+	case transportUDP:
+		return NewUDPTransport(cfg.TransportAddr)
+	default:
+		return NewHTTPTransport(client), nil
+	}
+}
+
+// transportAddr strips the scheme off a peer given as a URL, so grpc:// and
+// udp:// peers may be listed like HTTP ones
+func transportAddr(peer string) string {
+	if _, addr, ok := strings.Cut(peer, "://"); ok {
+		return addr
+	}
+	return peer
+}
+
+// serveTransport hands a request received by a non-HTTP transport to
+// handler as an HTTP request from remote, over TLS when state is set
+func serveTransport(ctx context.Context, handler http.Handler, remote string, state *tls.ConnectionState, req TransportRequest) TransportReply {
+	r, err := http.NewRequestWithContext(ctx, req.Method, req.Path, bytes.NewReader(req.Body))
+	if err != nil || !strings.HasPrefix(req.Path, "/") {
+		return TransportReply{Status: http.StatusBadRequest, Body: []byte(fmt.Sprintf("Invalid request %s %s\n", req.Method, req.Path))}
+	}
+	if req.Header != nil {
+		r.Header = req.Header.Clone()
+	}
+	r.RemoteAddr = remote
+	r.TLS = state
+	r.RequestURI = req.Path
+
+	w := &transportWriter{header: http.Header{}}
+	handler.ServeHTTP(w, r)
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return TransportReply{Status: w.status, Header: w.header, Body: w.body.Bytes()}
+}
+
+// transportWriter records the response of a handler serving a transport
+type transportWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *transportWriter) Header() http.Header { return w.header }
+
+func (w *transportWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *transportWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+// HTTPTransport sends requests to peers listed by base URL, such as
+// https://node-b:8080. Peers receive them on their HTTP server.
+type HTTPTransport struct {
+	client *http.Client
+}
+
+// NewHTTPTransport sends requests with client
+func NewHTTPTransport(client *http.Client) *HTTPTransport {
+	return &HTTPTransport{client: client}
+}
+
+func (t *HTTPTransport) Send(ctx context.Context, peer string, req TransportRequest) (TransportReply, error) {
+	r, err := http.NewRequestWithContext(ctx, req.Method, peer+req.Path, bytes.NewReader(req.Body))
+	if err != nil {
+		return TransportReply{}, err
+	}
+	for k, values := range req.Header {
+		for _, v := range values {
+			r.Header.Add(k, v)
+		}
+	}
+
+	resp, err := t.client.Do(r)
+	if err != nil {
+		return TransportReply{}, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return TransportReply{}, err
+	}
+	return TransportReply{Status: resp.StatusCode, Header: resp.Header, Body: data}, nil
+}
+
+// Receive does nothing: the node's HTTP server already serves peers
+func (t *HTTPTransport) Receive(http.Handler) error {
+	return nil
+}
+
+func (t *HTTPTransport) Close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
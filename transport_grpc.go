@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// grpcTransportMethod is the single method of the gRPC transport. Requests
+// and replies travel as JSON in a google.protobuf.BytesValue, so no
+// generated code is needed.
+const grpcTransportMethod = "/lamport.v1.PeerTransport/Call"
+
+var grpcTransportService = grpc.ServiceDesc{
+	ServiceName: "lamport.v1.PeerTransport",
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Call",
+		Handler: func(srv any, ctx context.Context, decode func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+			in := new(wrapperspb.BytesValue)
+			if err := decode(in); err != nil {
+				return nil, err
+			}
+			return srv.(*GRPCTransport).call(ctx, in)
+		},
+	}},
+	Metadata: "lamport.v1.PeerTransport",
+}
+
+// GRPCTransport sends requests to peers listed as host:port, or
+// grpc://host:port, over gRPC, and serves the requests of peers on its
+// listener
+type GRPCTransport struct {
+	listener net.Listener
+	server   *grpc.Server
+	handler  http.Handler
+	creds    credentials.TransportCredentials // of connections to peers
+	serve    []grpc.ServerOption
+	conns    map[string]*grpc.ClientConn
+	mutex    sync.Mutex
+}
+
+// NewGRPCTransport listens on addr. With serverTLS the listener serves
+// TLS, and the certificates peers present are verified as on HTTPS; with
+// peerTLS connections to peers use TLS. Without them both are plaintext.
+func NewGRPCTransport(addr string, serverTLS, peerTLS *tls.Config) (*GRPCTransport, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	t := &GRPCTransport{listener: listener, creds: insecure.NewCredentials(), conns: make(map[string]*grpc.ClientConn)}
+	if serverTLS != nil {
+		t.serve = append(t.serve, grpc.Creds(credentials.NewTLS(serverTLS)))
+	}
+	if peerTLS != nil {
+		t.creds = credentials.NewTLS(peerTLS)
+	}
+	return t, nil
+}
+
+// Addr is the address the transport listens on
+func (t *GRPCTransport) Addr() net.Addr {
+	return t.listener.Addr()
+}
+
+func (t *GRPCTransport) Send(ctx context.Context, peer string, req TransportRequest) (TransportReply, error) {
+	conn, err := t.conn(transportAddr(peer))
+	if err != nil {
+		return TransportReply{}, err
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return TransportReply{}, err
+	}
+	out := new(wrapperspb.BytesValue)
+	if err := conn.Invoke(ctx, grpcTransportMethod, wrapperspb.Bytes(body), out); err != nil {
+		return TransportReply{}, err
+	}
+	var reply TransportReply
+	err = json.Unmarshal(out.GetValue(), &reply)
+	return reply, err
+}
+
+// conn returns the connection to a peer, made on first use
+func (t *GRPCTransport) conn(addr string) (*grpc.ClientConn, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if conn, ok := t.conns[addr]; ok {
+		return conn, nil
+	}
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(t.creds))
+	if err != nil {
+		return nil, err
+	}
+	t.conns[addr] = conn
+	return conn, nil
+}
+
+func (t *GRPCTransport) call(ctx context.Context, in *wrapperspb.BytesValue) (*wrapperspb.BytesValue, error) {
+	var req TransportRequest
+	reply := TransportReply{Status: http.StatusBadRequest, Body: []byte("Invalid transport request\n")}
+	if err := json.Unmarshal(in.GetValue(), &req); err == nil {
+		remote := ""
+		var state *tls.ConnectionState
+		if p, ok := peer.FromContext(ctx); ok {
+			remote = p.Addr.String()
+			if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+				state = &info.State
+			}
+		}
+		reply = serveTransport(ctx, t.handler, remote, state, req)
+	}
+	out, err := json.Marshal(reply)
+	if err != nil {
+		return nil, err
+	}
+	return wrapperspb.Bytes(out), nil
+}
+
+func (t *GRPCTransport) Receive(handler http.Handler) error {
+	t.mutex.Lock()
+	t.handler = handler
+	t.server = grpc.NewServer(t.serve...)
+	t.server.RegisterService(&grpcTransportService, t)
+	t.mutex.Unlock()
+	go t.server.Serve(t.listener)
+	return nil
+}
+
+func (t *GRPCTransport) Close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.server != nil {
+		t.server.Stop()
+	} else {
+		t.listener.Close()
+	}
+	for addr, conn := range t.conns {
+		conn.Close()
+		delete(t.conns, addr)
+	}
+	return nil
+}
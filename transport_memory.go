@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrNoNode is returned for a request to an address no in-process node
+// receives on
+var ErrNoNode = errors.New("no node at address")
+
+// memoryDelivery is a request travelling on a link of a MemoryNetwork
+type memoryDelivery struct {
+	ctx   context.Context
+	at    time.Time // when the request reaches the node
+	req   TransportRequest
+	reply chan TransportReply
+}
+
+// memoryLink carries the requests from one address to another, in order
+type memoryLink struct {
+	from, to string
+	queue    chan memoryDelivery
+}
+
+// MemoryNetwork connects in-process transports, so algorithms can be run
+// on many virtual nodes in a single process. Each request waits for the
+// latency of the network, plus up to the jitter, before its node handles
+// it; replies come back at once. Requests between two nodes arrive in the
+// order they were sent, one held back by its jitter holding back the ones
+// behind it, unless reordering is on: each then waits on its own and a
+// later request with less jitter overtakes an earlier one.
+type MemoryNetwork struct {
+	handlers map[string]http.Handler
+	links    map[[2]string]*memoryLink
+	latency  time.Duration
+	jitter   time.Duration
+	reorder  bool
+	done     chan struct{}
+	mutex    sync.RWMutex
+}
+
+// NewMemoryNetwork creates a network without latency that keeps requests
+// in order
+func NewMemoryNetwork() *MemoryNetwork {
+	return &MemoryNetwork{
+		handlers: make(map[string]http.Handler),
+		links:    make(map[[2]string]*memoryLink),
+		done:     make(chan struct{}),
+	}
+}
+
+// SetLatency sets how long requests take from now on: latency plus a
+// random duration up to jitter
+func (n *MemoryNetwork) SetLatency(latency, jitter time.Duration) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.latency, n.jitter = latency, jitter
+}
+
+// SetReorder lets requests between two nodes overtake each other
+func (n *MemoryNetwork) SetReorder(reorder bool) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.reorder = reorder
+}
+
+// Transport returns the transport of the node at addr. Peers list each
+// other by these addresses.
+func (n *MemoryNetwork) Transport(addr string) *MemoryTransport {
+	return &MemoryTransport{network: n, addr: addr}
+}
+
+// Close stops delivering requests. Requests in flight fail.
+func (n *MemoryNetwork) Close() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	select {
+	case <-n.done:
+	default:
+		close(n.done)
+	}
+}
+
+// delay is how long the next request takes
+func (n *MemoryNetwork) delay() time.Duration {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+	d := n.latency
+	if n.jitter > 0 {
+		d += rand.N(n.jitter)
+	}
+	return d
+}
+
+// link returns the link between two addresses, started on first use
+func (n *MemoryNetwork) link(from, to string) *memoryLink {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	key := [2]string{from, to}
+	if l, ok := n.links[key]; ok {
+		return l
+	}
+	l := &memoryLink{from: from, to: to, queue: make(chan memoryDelivery, 1024)}
+	n.links[key] = l
+	go n.carry(l)
+	return l
+}
+
+// carry delivers the requests of a link one after the other
+func (n *MemoryNetwork) carry(l *memoryLink) {
+	for {
+		select {
+		case <-n.done:
+			return
+		case d := <-l.queue:
+			n.deliver(l.from, l.to, d)
+		}
+	}
+}
+
+// deliver hands a request to the node at to once its time has come
+func (n *MemoryNetwork) deliver(from, to string, d memoryDelivery) {
+	timer := time.NewTimer(time.Until(d.at))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-d.ctx.Done():
+		return
+	case <-n.done:
+		return
+	}
+
+	n.mutex.RLock()
+	handler, ok := n.handlers[to]
+	n.mutex.RUnlock()
+	reply := TransportReply{Status: http.StatusServiceUnavailable, Body: []byte("Not receiving\n")}
+	if ok {
+		reply = serveTransport(d.ctx, handler, from, nil, d.req)
+	}
+	d.reply <- reply
+}
+
+// MemoryTransport is the transport of one node of a MemoryNetwork
+type MemoryTransport struct {
+	network *MemoryNetwork
+	addr    string
+}
+
+func (t *MemoryTransport) Send(ctx context.Context, peer string, req TransportRequest) (TransportReply, error) {
+	n := t.network
+	n.mutex.RLock()
+	_, ok := n.handlers[peer]
+	reorder := n.reorder
+	n.mutex.RUnlock()
+	if !ok {
+		return TransportReply{}, fmt.Errorf("%w %s", ErrNoNode, peer)
+	}
+
+	d := memoryDelivery{ctx: ctx, at: time.Now().Add(n.delay()), req: req, reply: make(chan TransportReply, 1)}
+	if reorder {
+		go n.deliver(t.addr, peer, d)
+	} else {
+		select {
+		case n.link(t.addr, peer).queue <- d:
+		case <-ctx.Done():
+			return TransportReply{}, ctx.Err()
+		}
+	}
+
+	select {
+	case reply := <-d.reply:
+		return reply, nil
+	case <-ctx.Done():
+		return TransportReply{}, ctx.Err()
+	case <-n.done:
+		return TransportReply{}, errors.New("network closed")
+	}
+}
+
+// Receive registers the node on the network
+func (t *MemoryTransport) Receive(handler http.Handler) error {
+	t.network.mutex.Lock()
+	defer t.network.mutex.Unlock()
+	t.network.handlers[t.addr] = handler
+	return nil
+}
+
+// Close takes the node off the network, as if it had crashed
+func (t *MemoryTransport) Close() error {
+	t.network.mutex.Lock()
+	defer t.network.mutex.Unlock()
+	delete(t.network.handlers, t.addr)
+	return nil
+}
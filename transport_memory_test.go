@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryNetworkOrdering(t *testing.T) {
+	n := NewMemoryNetwork()
+	defer n.Close()
+	var mu sync.Mutex
+	var order []string
+	n.Transport("b").Receive(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		order = append(order, r.URL.Path)
+		mu.Unlock()
+	}))
+
+	// Each request is due earlier than the one before it
+	send := func(enqueue func(memoryDelivery)) []string {
+		order = nil
+		var replies []chan TransportReply
+		now := time.Now()
+		for i := range 5 {
+			d := memoryDelivery{
+				ctx:   t.Context(),
+				at:    now.Add(time.Duration(5-i) * 10 * time.Millisecond),
+				req:   TransportRequest{Method: http.MethodPost, Path: fmt.Sprintf("/%d", i)},
+				reply: make(chan TransportReply, 1),
+			}
+			enqueue(d)
+			replies = append(replies, d.reply)
+		}
+		for _, reply := range replies {
+			<-reply
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(order)
+	}
+	if got := send(func(d memoryDelivery) { n.link("a", "b").queue <- d }); strings.Join(got, ",") != "/0,/1,/2,/3,/4" {
+		t.Errorf("Expected the requests in the order they were sent, got %v", got)
+	}
+	if got := send(func(d memoryDelivery) { go n.deliver("a", "b", d) }); strings.Join(got, ",") != "/4,/3,/2,/1,/0" {
+		t.Errorf("Expected the requests reordered by their delay, got %v", got)
+	}
+}
+
+func TestMemoryTransport(t *testing.T) {
+	n := NewMemoryNetwork()
+	defer n.Close()
+	receiver := NewServer()
+	receiver.nodeID = "b"
+	b := n.Transport("b")
+	b.Receive(receiver)
+	peers := NewPeersOver([]string{"b"}, n.Transport("a"))
+
+	n.SetLatency(20*time.Millisecond, 0)
+	start := time.Now()
+	if _, err := peers.Do(t.Context(), "b", http.MethodPost, "/message?timestamp=5&message=hi", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("Expected the request to take the latency, took %s", elapsed)
+	}
+	if receiver.clock.GetTime() != 6 {
+		t.Errorf("Expected the message merged up to 6, got %d", receiver.clock.GetTime())
+	}
+
+	// A node taken off the network no longer answers
+	b.Close()
+	if _, err := peers.Do(t.Context(), "b", http.MethodGet, "/time", nil, nil); !errors.Is(err, ErrNoNode) {
+		t.Errorf("Expected no node at b, got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+	b.Receive(receiver)
+	if _, err := peers.Do(ctx, "b", http.MethodGet, "/time", nil, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the request to time out before its latency, got %v", err)
+	}
+}
+
+// newMemoryCluster creates servers named by ids, each listing the others
+// as peers on network and receiving with the handler serve returns
+func newMemoryCluster(network *MemoryNetwork, serve func(*Server) http.Handler, ids ...string) []*Server {
+	servers := make([]*Server, len(ids))
+	for i, id := range ids {
+		var peers []string
+		for _, other := range ids {
+			if other != id {
+				peers = append(peers, other)
+			}
+		}
+		servers[i] = NewServer()
+		servers[i].nodeID = id
+		transport := network.Transport(id)
+		servers[i].peers = NewPeersOver(peers, transport)
+		transport.Receive(serve(servers[i]))
+	}
+	return servers
+}
+
+func TestMulticastOverMemoryNetwork(t *testing.T) {
+	network := NewMemoryNetwork()
+	defer network.Close()
+	network.SetLatency(time.Millisecond, 3*time.Millisecond)
+	network.SetReorder(true)
+
+	ids := []string{"a", "b", "c", "d", "e", "f", "g"}
+	groups := make(map[string]*Multicast, len(ids))
+	servers := newMemoryCluster(network, func(s *Server) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			groups[s.nodeID].handlePeerMulticast(w, r)
+		})
+	}, ids...)
+
+	var mu sync.Mutex
+	orders := make(map[string][]string, len(ids))
+	var all []*Multicast
+	for _, s := range servers {
+		g := NewMulticast(s)
+		g.onDeliver = func(m MulticastMessage) {
+			mu.Lock()
+			orders[s.nodeID] = append(orders[s.nodeID], m.Message)
+			mu.Unlock()
+		}
+		groups[s.nodeID] = g
+		all = append(all, g)
+	}
+	for _, g := range all {
+		go g.Run(t.Context())
+	}
+
+	var wg sync.WaitGroup
+	for _, g := range all {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 3 {
+				if _, err := g.Publish(t.Context(), fmt.Sprintf("%s-%d", g.server.nodeID, i), ""); err != nil {
+					t.Errorf("Publish failed: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	waitDelivered(t, all, int64(3*len(ids)))
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, id := range ids[1:] {
+		if strings.Join(orders[id], ",") != strings.Join(orders["a"], ",") {
+			t.Fatalf("Expected the same delivery order on %s as on a, got %v and %v", id, orders[id], orders["a"])
+		}
+	}
+}
+
+func TestElectionOverMemoryNetwork(t *testing.T) {
+	network := NewMemoryNetwork()
+	defer network.Close()
+	network.SetLatency(time.Millisecond, 2*time.Millisecond)
+
+	ids := []string{"e", "c", "h", "a", "f", "b", "i", "d", "g"}
+	elections := make(map[string]*Election, len(ids))
+	servers := newMemoryCluster(network, func(s *Server) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			elections[s.nodeID].handlePeerElection(w, r)
+		})
+	}, ids...)
+
+	stops := make(map[string]context.CancelFunc, len(ids))
+	var running sync.WaitGroup
+	for _, s := range servers {
+		elections[s.nodeID] = NewElection(s, 20*time.Millisecond, 100*time.Millisecond)
+	}
+	for _, s := range servers {
+		ctx, cancel := context.WithCancel(t.Context())
+		stops[s.nodeID] = cancel
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			elections[s.nodeID].Run(ctx)
+		}()
+	}
+	defer running.Wait()
+	defer func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}()
+
+	waitFor := func(want string, skip string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for _, id := range ids {
+			if id == skip {
+				continue
+			}
+			for elections[id].Leader() != want {
+				if time.Now().After(deadline) {
+					t.Fatalf("Expected leader %s on %s, got %q", want, id, elections[id].Leader())
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+		}
+	}
+	waitFor("a", "")
+
+	// The leader crashes: it stops and drops off the network
+	stops["a"]()
+	network.Transport("a").Close()
+	waitFor("b", "a")
+}
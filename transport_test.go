@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testTransports returns a transport of each kind serving receiver, with
+// the address peers reach it at
+func testTransports(t *testing.T, receiver *Server) map[string]func() (Transport, string) {
+	return map[string]func() (Transport, string){
+		transportHTTP: func() (Transport, string) {
+			ts := httptest.NewServer(receiver)
+			t.Cleanup(ts.Close)
+			return NewHTTPTransport(http.DefaultClient), ts.URL
+		},
+		transportGRPC: func() (Transport, string) {
+			listening, err := NewGRPCTransport("127.0.0.1:0", nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			listening.Receive(receiver)
+			t.Cleanup(func() { listening.Close() })
+			sending, _ := NewGRPCTransport("127.0.0.1:0", nil, nil)
+			t.Cleanup(func() { sending.Close() })
+			return sending, "grpc://" + listening.Addr().String()
+		},
+		transportUDP: func() (Transport, string) {
+			listening, err := NewUDPTransport("127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			listening.Receive(receiver)
+			t.Cleanup(func() { listening.Close() })
+			sending, _ := NewUDPTransport("127.0.0.1:0")
+			t.Cleanup(func() { sending.Close() })
+			return sending, listening.Addr().String()
+		},
+	}
+}
+
+func TestTransports(t *testing.T) {
+	receiver := NewServer()
+	receiver.nodeID = "b"
+	for name, newTransport := range testTransports(t, receiver) {
+		t.Run(name, func(t *testing.T) {
+			transport, addr := newTransport()
+			peers := NewPeersOver([]string{addr}, transport)
+			peers.node = "a"
+			peers.clock = func() ClockTime { return ClockTime{Timestamp: 100} }
+
+			before := receiver.clock.GetTime()
+			data, err := peers.Do(t.Context(), addr, http.MethodPost, "/message?timestamp=100&message=hello%20"+name, nil, nil)
+			var event Event
+			if err != nil || json.Unmarshal(data, &event) != nil || event.Timestamp <= before {
+				t.Fatalf("Expected the message received, got %s (err: %v)", data, err)
+			}
+			// Headers travel along
+			if report := receiver.propagation.Report(); len(report) != 1 || report[0].Peer != "a" {
+				t.Errorf("Expected the request stamped by a, got %+v", report)
+			}
+
+			// Peer subsystems find nodes by ID over any transport
+			if u, err := peers.Resolve(t.Context(), "b"); err != nil || u != addr {
+				t.Errorf("Expected b resolved to %s, got %q (err: %v)", addr, u, err)
+			}
+
+			if _, err := peers.Do(t.Context(), addr, http.MethodGet, "/message", nil, nil); err == nil || !strings.Contains(err.Error(), "405") {
+				t.Errorf("Expected the error status reported, got %v", err)
+			}
+		})
+	}
+}
+
+func TestUDPTransportTimeout(t *testing.T) {
+	sending, err := NewUDPTransport("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sending.Close()
+	// A socket nobody reads from never answers
+	silent, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := sending.Send(ctx, silent.LocalAddr().String(), TransportRequest{Method: http.MethodGet, Path: "/time"}); err == nil {
+		t.Error("Expected the request to fail without a reply")
+	}
+	if _, err := sending.Send(t.Context(), silent.LocalAddr().String(), TransportRequest{Path: "/", Body: make([]byte, maxTransportDatagram)}); !errors.Is(err, ErrDatagramTooLarge) {
+		t.Errorf("Expected an oversized request refused, got %v", err)
+	}
+}
+
+func TestServeTransport(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Path", r.URL.Path)
+		w.Write([]byte(r.URL.Query().Get("q")))
+	})
+	reply := serveTransport(t.Context(), handler, "peer:1", nil, TransportRequest{Method: http.MethodGet, Path: "/x?q=hi"})
+	if reply.Status != http.StatusOK || string(reply.Body) != "hi" || reply.Header.Get("X-Path") != "/x" {
+		t.Errorf("Unexpected reply %+v", reply)
+	}
+	if reply := serveTransport(t.Context(), handler, "peer:1", nil, TransportRequest{Method: http.MethodGet, Path: "http://elsewhere/x"}); reply.Status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an absolute URL, got %d", reply.Status)
+	}
+}
+
+func TestUDPTransportServesPeerRoutes(t *testing.T) {
+	receiver := NewServer()
+	listening, err := NewUDPTransport("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listening.Close()
+	listening.Receive(receiver)
+	sending, _ := NewUDPTransport("127.0.0.1:0")
+	defer sending.Close()
+
+	addr := listening.Addr().String()
+	if reply, err := sending.Send(t.Context(), addr, TransportRequest{Method: http.MethodGet, Path: "/time"}); err != nil || reply.Status != http.StatusOK {
+		t.Errorf("Expected /time served, got %+v %v", reply, err)
+	}
+	// Client routes could reflect large replies at a forged address
+	for _, path := range []string{"/events", "/openapi.json", "/messages", "/admin/clock/reset"} {
+		if reply, err := sending.Send(t.Context(), addr, TransportRequest{Method: http.MethodGet, Path: path}); err != nil || reply.Status != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %+v %v", path, reply, err)
+		}
+	}
+}
+
+func TestUDPTransportIgnoresForgedReplies(t *testing.T) {
+	sending, err := NewUDPTransport("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sending.Close()
+	peer, _ := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	defer peer.Close()
+	forger, _ := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	defer forger.Close()
+
+	go func() {
+		buf := make([]byte, maxTransportDatagram)
+		n, _, err := peer.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		var env udpEnvelope
+		json.Unmarshal(buf[:n], &env)
+		to := sending.Addr().(*net.UDPAddr)
+		forged, _ := json.Marshal(udpEnvelope{ID: env.ID, Reply: &TransportReply{Status: http.StatusTeapot}})
+		forger.WriteToUDP(forged, to)
+		time.Sleep(20 * time.Millisecond)
+		real, _ := json.Marshal(udpEnvelope{ID: env.ID, Reply: &TransportReply{Status: http.StatusOK}})
+		peer.WriteToUDP(real, to)
+	}()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 2*time.Second)
+	defer cancel()
+	if reply, err := sending.Send(ctx, peer.LocalAddr().String(), TransportRequest{Method: http.MethodGet, Path: "/time"}); err != nil || reply.Status != http.StatusOK {
+		t.Errorf("Expected the reply of the peer, not the forged one, got %+v %v", reply, err)
+	}
+}
+
+func TestGRPCTransportTLS(t *testing.T) {
+	cfg := writeTestPKI(t)
+	receiver := NewServer()
+	receiver.peerCerts = true
+	serverTLS, err := serverTLSConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peerTLS, err := peerTLSConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listening, err := NewGRPCTransport("127.0.0.1:0", serverTLS, peerTLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listening.Receive(receiver)
+	defer listening.Close()
+	addr := listening.Addr().String()
+	message := TransportRequest{Method: http.MethodPost, Path: "/message?timestamp=10&message=hello"}
+
+	// Peers present the node certificate, as over HTTPS
+	sending, _ := NewGRPCTransport("127.0.0.1:0", nil, peerTLS)
+	defer sending.Close()
+	if reply, err := sending.Send(t.Context(), addr, message); err != nil || reply.Status != http.StatusOK {
+		t.Errorf("Expected the message of a peer received, got %+v %v", reply, err)
+	}
+
+	anonymousTLS, _ := peerTLSConfig(&Config{TLSCAFile: cfg.TLSCAFile})
+	anonymous, _ := NewGRPCTransport("127.0.0.1:0", nil, anonymousTLS)
+	defer anonymous.Close()
+	if reply, err := anonymous.Send(t.Context(), addr, message); err != nil || reply.Status != http.StatusUnauthorized {
+		t.Errorf("Expected the message refused without a certificate, got %+v %v", reply, err)
+	}
+
+	plain, _ := NewGRPCTransport("127.0.0.1:0", nil, nil)
+	defer plain.Close()
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+	if _, err := plain.Send(ctx, addr, message); err == nil {
+		t.Error("Expected plaintext refused by the TLS listener")
+	}
+	if got := receiver.clock.GetTime(); got != 11 {
+		t.Errorf("Expected only the peer's message merged, got %d", got)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxTransportDatagram is the largest request or reply the UDP
+	// transport carries
+	maxTransportDatagram = 65507
+	// maxUDPHandlers bounds the requests served at once; datagrams
+	// arriving beyond are dropped, and their senders retry
+	maxUDPHandlers = 64
+	// udpHandlerTimeout bounds how long a request is served
+	udpHandlerTimeout = 10 * time.Second
+)
+
+// ErrDatagramTooLarge is returned for a request that does not fit in one
+// datagram
+var ErrDatagramTooLarge = errors.New("request too large for a datagram")
+
+// udpEnvelope is a request or a reply of the UDP transport, matched by ID
+type udpEnvelope struct {
+	ID      uint64            `json:"id"`
+	Request *TransportRequest `json:"request,omitempty"`
+	Reply   *TransportReply   `json:"reply,omitempty"`
+}
+
+// UDPTransport sends requests to peers listed as host:port, or
+// udp://host:port, one datagram each, and serves the requests of peers on
+// the same socket. Lost datagrams are not sent again: the request fails
+// when ctx ends, and the peer subsystems retry as they do over HTTP.
+//
+// The source of a datagram is easily forged. Replies are only taken from
+// the address the request went to, under a random ID, and only the routes
+// peers call on each other are served, so the node cannot be used to
+// reflect large replies at a forged address.
+type UDPTransport struct {
+	conn     *net.UDPConn
+	handler  atomic.Pointer[http.Handler]
+	pending  map[uint64]udpPending
+	handlers chan struct{}
+	mutex    sync.Mutex
+}
+
+// udpPending is a request waiting for its reply
+type udpPending struct {
+	peer   *net.UDPAddr
+	answer chan TransportReply
+}
+
+// udpRoutes are the routes served over UDP: the peer endpoints, and the
+// few others the peer subsystems call
+var udpRoutes = []string{"/peer/", "/message", "/time", "/healthz", "/cluster/join", "/cluster/leave"}
+
+// udpRoute reports whether a request path, with its query, is served over
+// UDP
+func udpRoute(path string) bool {
+	path, _, _ = strings.Cut(path, "?")
+	for _, route := range udpRoutes {
+		if path == route || (strings.HasSuffix(route, "/") && strings.HasPrefix(path, route)) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewUDPTransport listens on addr. Replies are read from then on; requests
+// are answered once Receive is called.
+func NewUDPTransport(addr string) (*UDPTransport, error) {
+	laddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, err
+	}
+	t := &UDPTransport{
+		conn:     conn,
+		pending:  make(map[uint64]udpPending),
+		handlers: make(chan struct{}, maxUDPHandlers),
+	}
+	go t.read()
+	return t, nil
+}
+
+// Addr is the address the transport listens on
+func (t *UDPTransport) Addr() net.Addr {
+	return t.conn.LocalAddr()
+}
+
+func (t *UDPTransport) Send(ctx context.Context, peer string, req TransportRequest) (TransportReply, error) {
+	raddr, err := net.ResolveUDPAddr("udp", transportAddr(peer))
+	if err != nil {
+		return TransportReply{}, err
+	}
+	answer := make(chan TransportReply, 1)
+	t.mutex.Lock()
+	id := t.newIDLocked()
+	t.pending[id] = udpPending{peer: raddr, answer: answer}
+	t.mutex.Unlock()
+	defer func() {
+		t.mutex.Lock()
+		delete(t.pending, id)
+		t.mutex.Unlock()
+	}()
+
+	data, err := json.Marshal(udpEnvelope{ID: id, Request: &req})
+	if err != nil {
+		return TransportReply{}, err
+	}
+	if len(data) > maxTransportDatagram {
+		return TransportReply{}, ErrDatagramTooLarge
+	}
+
+	if _, err := t.conn.WriteToUDP(data, raddr); err != nil {
+		return TransportReply{}, err
+	}
+	select {
+	case reply := <-answer:
+		return reply, nil
+	case <-ctx.Done():
+		return TransportReply{}, fmt.Errorf("no reply from %s: %w", peer, ctx.Err())
+	}
+}
+
+// newIDLocked picks a random ID no pending request has, so replies cannot
+// be guessed from the previous ones
+func (t *UDPTransport) newIDLocked() uint64 {
+	var b [8]byte
+	for {
+		rand.Read(b[:])
+		if id := binary.BigEndian.Uint64(b[:]); t.pending[id].answer == nil {
+			return id
+		}
+	}
+}
+
+// read dispatches datagrams until the socket is closed: replies to the
+// requests waiting for them, requests to the handler
+func (t *UDPTransport) read() {
+	buf := make([]byte, maxTransportDatagram)
+	for {
+		n, from, err := t.conn.ReadFromUDP(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		var env udpEnvelope
+		if err != nil || json.Unmarshal(buf[:n], &env) != nil {
+			continue
+		}
+		switch {
+		case env.Reply != nil:
+			t.mutex.Lock()
+			pending, ok := t.pending[env.ID]
+			t.mutex.Unlock()
+			// Only the peer the request went to answers it
+			if ok && pending.peer.Port == from.Port && pending.peer.IP.Equal(from.IP) {
+				select {
+				case pending.answer <- *env.Reply:
+				default:
+				}
+			}
+		case env.Request != nil:
+			select {
+			case t.handlers <- struct{}{}:
+				go func() {
+					defer func() { <-t.handlers }()
+					t.serve(env.ID, *env.Request, from)
+				}()
+			default:
+			}
+		}
+	}
+}
+
+func (t *UDPTransport) serve(id uint64, req TransportRequest, from *net.UDPAddr) {
+	reply := TransportReply{Status: http.StatusServiceUnavailable, Body: []byte("Not receiving\n")}
+	if handler := t.handler.Load(); !udpRoute(req.Path) {
+		reply = TransportReply{Status: http.StatusNotFound, Body: []byte("Not served over UDP\n")}
+	} else if handler != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), udpHandlerTimeout)
+		reply = serveTransport(ctx, *handler, from.String(), nil, req)
+		cancel()
+	}
+	data, err := json.Marshal(udpEnvelope{ID: id, Reply: &reply})
+	if err == nil && len(data) > maxTransportDatagram {
+		data, err = json.Marshal(udpEnvelope{ID: id, Reply: &TransportReply{
+			Status: http.StatusInsufficientStorage,
+			Body:   []byte("Reply too large for a datagram\n"),
+		}})
+	}
+	if err == nil {
+		t.conn.WriteToUDP(data, from)
+	}
+}
+
+func (t *UDPTransport) Receive(handler http.Handler) error {
+	t.handler.Store(&handler)
+	return nil
+}
+
+func (t *UDPTransport) Close() error {
+	return t.conn.Close()
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	// tuiRefresh is how often the screen is redrawn when nothing is typed
+	tuiRefresh = 250 * time.Millisecond
+
+	tuiEvents   = 12 // recent events shown
+	tuiLogLines = 5  // recent log lines shown
+)
+
+// Prompts of the TUI input line
+const (
+	tuiIdle    = ""
+	tuiEvent   = "New event message: "
+	tuiMessage = "Received message (timestamp message): "
+)
+
+// TUI is the terminal mode started by -tui. It shows the live clock, the
+// newest events, the peers and the newest log lines, and creates local
+// events and received messages from the keyboard.
+type TUI struct {
+	server *Server
+	logs   *logTail // nil when logs go to a file
+	prompt string
+	input  []byte
+	status string
+}
+
+// NewTUI creates the terminal UI of a server
+func NewTUI(server *Server, logs *logTail) *TUI {
+	return &TUI{server: server, logs: logs}
+}
+
+// Run puts the terminal in raw mode and draws the UI until ctx is done or
+// the user quits
+func (t *TUI) Run(ctx context.Context) error {
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+
+	// Hide the cursor and switch to the alternate screen while running
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+	return t.loop(ctx, os.Stdin, os.Stdout)
+}
+
+// loop reads keys from in and redraws the screen on out
+func (t *TUI) loop(ctx context.Context, in io.Reader, out io.Writer) error {
+	keys := make(chan byte)
+	go func() {
+		var b [1]byte
+		for {
+			if _, err := in.Read(b[:]); err != nil {
+				close(keys)
+				return
+			}
+			select {
+			case keys <- b[0]:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(tuiRefresh)
+	defer ticker.Stop()
+	for {
+		io.WriteString(out, "\x1b[H\x1b[2J"+strings.ReplaceAll(t.render(), "\n", "\r\n"))
+		select {
+		case b, ok := <-keys:
+			if !ok || t.key(ctx, b) {
+				return nil
+			}
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// key handles a key press and reports whether the user quit
+func (t *TUI) key(ctx context.Context, b byte) (quit bool) {
+	if t.prompt == tuiIdle {
+		switch b {
+		case 'e':
+			t.prompt = tuiEvent
+		case 'm':
+			t.prompt = tuiMessage
+		case 'q', 3: // 3 is Ctrl-C in raw mode
+			return true
+		}
+		return false
+	}
+
+	switch b {
+	case '\r', '\n':
+		t.status = t.submit(ctx, t.prompt, strings.TrimSpace(string(t.input)))
+	case 27: // escape
+		t.status = ""
+	case 127, 8: // backspace
+		if len(t.input) > 0 {
+			t.input = t.input[:len(t.input)-1]
+		}
+		return false
+	case 3:
+		return true
+	default:
+		if b >= ' ' {
+			t.input = append(t.input, b)
+		}
+		return false
+	}
+	t.prompt, t.input = tuiIdle, t.input[:0]
+	return false
+}
+
+// submit creates the event or receives the message typed at a prompt and
+// describes the outcome
+func (t *TUI) submit(ctx context.Context, prompt, input string) string {
+	s := t.server
+	if prompt == tuiEvent {
+		if input == "" {
+			input = "TUI event"
+		}
+		event, err := s.commitLocal(Event{ID: localEventID("event-", time.Now()), Message: input})
+		if err != nil {
+			return "Event failed: " + err.Error()
+		}
+		return fmt.Sprintf("Created %s at %d", event.ID, event.Timestamp)
+	}
+
+	raw, message, _ := strings.Cut(input, " ")
+	ts, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || ts < 0 || message == "" {
+		return "Expected a timestamp followed by a message, e.g. 42 hello"
+	}
+	event, err := s.receiveMessage(ctx, "tui", "", ClockTime{Epoch: s.clock.Now().Epoch, Timestamp: ts}, message)
+	if err != nil {
+		return "Message rejected: " + err.Error()
+	}
+	return fmt.Sprintf("Received %d as %s at %d", ts, event.ID, event.Timestamp)
+}
+
+// render draws the screen as plain lines
+func (t *TUI) render() string {
+	s := t.server
+	var b strings.Builder
+	now := s.clock.Now()
+	node := s.nodeID
+	if node == "" {
+		node = "-"
+	}
+	fmt.Fprintf(&b, "Lamport clock  node %s  epoch %d  time %d\n\n", node, now.Epoch, now.Timestamp)
+
+	events := s.events.Events()
+	fmt.Fprintf(&b, "Events (%d, newest first)\n", len(events))
+	for i := len(events) - 1; i >= 0 && i >= len(events)-tuiEvents; i-- {
+		e := events[i]
+		from := ""
+		if e.Sender != "" {
+			from = "  from " + e.Sender
+		}
+		fmt.Fprintf(&b, "  %6d  %-28s %s%s\n", e.Timestamp, e.ID, e.Message, from)
+	}
+
+	b.WriteString("\nPeers\n")
+	var peers []PeerHealth
+	if s.monitor != nil {
+		peers = s.monitor.Peers()
+	}
+	for _, p := range peers {
+		fmt.Fprintf(&b, "  %-30s %-10s %-8s time %d  heard %s ago\n", p.URL, p.Node, p.State, p.LastTime.Timestamp, time.Since(p.LastHeard).Round(100*time.Millisecond))
+	}
+	if len(peers) == 0 {
+		b.WriteString("  none\n")
+	}
+
+	if t.logs != nil {
+		b.WriteString("\nLog\n")
+		for _, line := range t.logs.Lines() {
+			fmt.Fprintf(&b, "  %s\n", line)
+		}
+	}
+
+	b.WriteString("\n[e] new event  [m] receive message  [q] quit\n")
+	if t.prompt != tuiIdle {
+		fmt.Fprintf(&b, "%s%s_  (enter submits, esc cancels)\n", t.prompt, t.input)
+	} else if t.status != "" {
+		b.WriteString(t.status + "\n")
+	}
+	return b.String()
+}
+
+// logTail keeps the newest log lines for the TUI instead of writing them
+// over the screen
+type logTail struct {
+	lines   []string
+	partial []byte
+	mutex   sync.Mutex
+}
+
+func newLogTail() *logTail {
+	return &logTail{}
+}
+
+func (l *logTail) Write(p []byte) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.partial = append(l.partial, p...)
+	for {
+		i := bytes.IndexByte(l.partial, '\n')
+		if i < 0 {
+			break
+		}
+		l.lines = append(l.lines, string(l.partial[:i]))
+		l.partial = l.partial[i+1:]
+	}
+	if n := len(l.lines) - tuiLogLines; n > 0 {
+		l.lines = append(l.lines[:0], l.lines[n:]...)
+	}
+	return len(p), nil
+}
+
+// Lines returns the newest log lines, oldest first
+func (l *logTail) Lines() []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return append([]string(nil), l.lines...)
+}
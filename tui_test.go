@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTUIKeys(t *testing.T) {
+	server := NewServer()
+	ui := NewTUI(server, nil)
+
+	var out bytes.Buffer
+	keys := "eorder placed\r" + "m40 hello\r" + "etypo\x7f\x7f\x1b" + "q"
+	if err := ui.loop(context.Background(), strings.NewReader(keys), &out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	events := server.events.Events()
+	if len(events) != 2 {
+		t.Fatalf("Expected an event and a message, got %+v", events)
+	}
+	if events[0].Message != "order placed" || events[0].Timestamp != 1 {
+		t.Errorf("Expected the typed event at 1, got %+v", events[0])
+	}
+	if events[1].Sender != "tui" || events[1].Timestamp != 41 {
+		t.Errorf("Expected the message to be merged at 41, got %+v", events[1])
+	}
+	if ui.prompt != tuiIdle || len(ui.input) != 0 {
+		t.Errorf("Expected escape to cancel the prompt, got %q %q", ui.prompt, ui.input)
+	}
+	if !strings.Contains(out.String(), "time 41") || strings.Contains(out.String(), "\n\n") {
+		t.Errorf("Expected raw mode frames showing the clock")
+	}
+
+	for _, b := range []byte("mxyz\r") {
+		ui.key(context.Background(), b)
+	}
+	if !strings.HasPrefix(ui.status, "Expected a timestamp") || server.events.Len() != 2 {
+		t.Errorf("Expected malformed messages to be refused, got %q", ui.status)
+	}
+}
+
+func TestTUIRender(t *testing.T) {
+	server := NewServer()
+	server.nodeID = "a"
+	for i := 0; i < tuiEvents+3; i++ {
+		server.logEvent(fmt.Sprintf("e%d", i), "Shown")
+	}
+	logs := newLogTail()
+	for i := 0; i < tuiLogLines+2; i++ {
+		fmt.Fprintf(logs, "line %d\n", i)
+	}
+	fmt.Fprint(logs, "partial")
+	ui := NewTUI(server, logs)
+	ui.status = "Created e14"
+
+	screen := ui.render()
+	for _, want := range []string{"node a", "time 15", "Events (15", "e14", "line 6", "Created e14", "none"} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("Expected %q on the screen:\n%s", want, screen)
+		}
+	}
+	for _, unwanted := range []string{"e2 ", "line 1", "partial"} {
+		if strings.Contains(screen, unwanted) {
+			t.Errorf("Expected %q to be cut off:\n%s", unwanted, screen)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxTxEvents bounds the events logged under one transaction
+	maxTxEvents = 1000
+	// txTimeout is how long a transaction may stay open before it is
+	// aborted
+	txTimeout = 5 * time.Minute
+)
+
+var (
+	errTxNotFound = errors.New("transaction not found")
+	errTxFull     = errors.New("transaction holds too many events")
+	// errClockFrozen refuses groups of ticks, which would share one
+	// timestamp on a frozen clock
+	errClockFrozen = errors.New("clock is frozen")
+)
+
+// Transaction groups events that are logged together. Its events are held
+// back until it commits, then stamped with consecutive timestamps.
+type Transaction struct {
+	ID       string    `json:"tx_id"`
+	Events   []Event   `json:"events"`
+	OpenedAt time.Time `json:"opened_at"`
+}
+
+// Transactions holds the open transactions, by ID
+type Transactions struct {
+	open  map[string]*Transaction
+	mutex sync.Mutex
+}
+
+// NewTransactions creates an empty set of transactions
+func NewTransactions() *Transactions {
+	return &Transactions{open: make(map[string]*Transaction)}
+}
+
+// expireLocked aborts the transactions open for longer than txTimeout.
+// Every access expires them first, so an expired transaction is never
+// found, let alone committed.
+func (txs *Transactions) expireLocked(now time.Time) {
+	for id, tx := range txs.open {
+		if now.Sub(tx.OpenedAt) > txTimeout {
+			delete(txs.open, id)
+		}
+	}
+}
+
+// Begin opens a transaction
+func (txs *Transactions) Begin() Transaction {
+	txs.mutex.Lock()
+	defer txs.mutex.Unlock()
+	now := time.Now()
+	txs.expireLocked(now)
+	// IDs come from the wall time, made unique among the open ones
+	id := localEventID("tx-", now)
+	for t := now; txs.open[id] != nil; id = localEventID("tx-", t) {
+		t = t.Add(1)
+	}
+	tx := &Transaction{ID: id, Events: []Event{}, OpenedAt: now}
+	txs.open[tx.ID] = tx
+	return *tx
+}
+
+// Add holds back an event under a transaction and returns its position in
+// the transaction
+func (txs *Transactions) Add(id string, event Event) (int, error) {
+	txs.mutex.Lock()
+	defer txs.mutex.Unlock()
+	txs.expireLocked(time.Now())
+	tx, ok := txs.open[id]
+	if !ok {
+		return 0, errTxNotFound
+	}
+	if len(tx.Events) >= maxTxEvents {
+		return 0, errTxFull
+	}
+	tx.Events = append(tx.Events, event)
+	return len(tx.Events) - 1, nil
+}
+
+// Get returns an open transaction
+func (txs *Transactions) Get(id string) (Transaction, bool) {
+	txs.mutex.Lock()
+	defer txs.mutex.Unlock()
+	txs.expireLocked(time.Now())
+	tx, ok := txs.open[id]
+	if !ok {
+		return Transaction{}, false
+	}
+	view := *tx
+	view.Events = append([]Event{}, tx.Events...)
+	return view, true
+}
+
+// Close removes a transaction to commit or abort it. Only one caller gets
+// it, so a transaction commits at most once.
+func (txs *Transactions) Close(id string) (Transaction, bool) {
+	txs.mutex.Lock()
+	defer txs.mutex.Unlock()
+	txs.expireLocked(time.Now())
+	tx, ok := txs.open[id]
+	if !ok {
+		return Transaction{}, false
+	}
+	delete(txs.open, id)
+	return *tx, true
+}
+
+// reopen puts back a transaction that failed to commit, so it can be
+// committed again. It keeps its opening time and still expires.
+func (txs *Transactions) reopen(tx Transaction) {
+	txs.mutex.Lock()
+	defer txs.mutex.Unlock()
+	txs.open[tx.ID] = &tx
+}
+
+// tickN reserves n consecutive timestamps for a group of local events and
+// returns the first. A group that would cross the rollover threshold starts
+// the next epoch instead, so its timestamps stay consecutive. A frozen
+// clock has no consecutive timestamps to give, so it reserves none and
+// returns errClockFrozen.
+func (lc *LamportClock) tickN(n int, src ClockSource) (ClockTime, error) {
+	lc.mutex.Lock()
+	if lc.frozen {
+		lc.mutex.Unlock()
+		return ClockTime{}, errClockFrozen
+	}
+	from := lc.nowLocked()
+	if lc.timestamp > lc.rollover-int64(n) && int64(n) <= lc.rollover {
+		lc.timestamp = lc.rollover
+	}
+	ticks := make([]ClockTime, n)
+	for i := range ticks {
+		lc.incrementLocked()
+		lc.recordLocked(from, causeTick, ClockTime{}, false, src)
+		ticks[i] = lc.nowLocked()
+		from = ticks[i]
+	}
+	lc.mutex.Unlock()
+
+	for _, now := range ticks {
+		lc.ticked(now)
+	}
+	return ticks[0], nil
+}
+
+// untickN gives back the n timestamps from first on reserved by tickN, for
+// events that could not be stored. The clock only moves back while it has
+// not moved since; otherwise the timestamps are left unused. It moves back
+// to just before first, so a group that started a new epoch leaves the
+// clock in that epoch.
+func (lc *LamportClock) untickN(first ClockTime, n int) {
+	lc.mutex.Lock()
+	defer lc.mutex.Unlock()
+	last := ClockTime{Epoch: first.Epoch, Timestamp: first.Timestamp + int64(n) - 1}
+	if lc.nowLocked() != last {
+		return
+	}
+	lc.timestamp = first.Timestamp - 1
+	lc.changes.Notify()
+	lc.recordLocked(last, causeUntick, ClockTime{}, false, ClockSource{})
+}
+
+// recordGroup stamps the events of a transaction with consecutive
+// timestamps, reserved from the clock at once, and appends them to the log
+// in one write. No other event of this node takes a timestamp between
+// them, so the group stays together in the total order. The group is
+// appended whole or not at all: when the store or the clock refuses it,
+// nothing is appended or published.
+func (s *Server) recordGroup(tx Transaction, src ClockSource) ([]Event, error) {
+	if err := storeWriteErr(s.events); err != nil {
+		return nil, err
+	}
+	first, err := s.clock.tickN(len(tx.Events), src)
+	if err != nil {
+		return nil, err
+	}
+	wall := time.Now()
+	events := make([]Event, len(tx.Events))
+	for i, event := range tx.Events {
+		event.ID = tx.ID + "-" + strconv.Itoa(i)
+		event.Timestamp = first.Timestamp + int64(i)
+		event.Epoch = first.Epoch
+		event.WallTime = wall
+		event.Node = s.nodeID
+		events[i] = s.sign(s.pii.Redact(event))
+	}
+
+	s.mutex.Lock()
+	unlock := s.syncHeadLocked()
+	head := s.head
+	for i := range events {
+		events[i] = s.chainLocked(events[i])
+	}
+	if err := appendAllChecked(s.events, events); err != nil {
+		s.head = head
+		unlock()
+		s.mutex.Unlock()
+		return nil, err
+	}
+	for _, event := range events {
+		s.observeLocked(event)
+		s.skew.record(ClockTime{Epoch: event.Epoch, Timestamp: event.Timestamp}, wall)
+	}
+	unlock()
+	s.mutex.Unlock()
+	s.logged.Notify()
+
+	for _, event := range events {
+		s.broker.Publish(event)
+		if s.hooks.Enabled() {
+			s.hooks.Event(event.wire())
+		}
+	}
+	s.logger.Info("Transaction committed", "tx_id", tx.ID, "events", len(events), "lamport_timestamp", first.Timestamp)
+	return events, nil
+}
+
+// handleTx serves the transactions:
+//
+//	POST /tx/begin        opens a transaction
+//	GET  /tx/<id>         lists the events held back under it
+//	POST /tx/<id>/event   logs an event under it, with the body of /event
+//	POST /tx/<id>/commit  stamps and appends its events
+//	POST /tx/<id>/abort   drops its events
+func (s *Server) handleTx(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/tx/")
+	if path == "begin" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		tx := s.txs.Begin()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(tx)
+		return
+	}
+
+	id, action, _ := strings.Cut(path, "/")
+	if id == "" {
+		http.NotFound(w, r)
+		return
+	}
+	want := http.MethodPost
+	if action == "" {
+		want = http.MethodGet
+	}
+	if r.Method != want {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch action {
+	case "":
+		tx, ok := s.txs.Get(id)
+		if !ok {
+			http.Error(w, "Transaction not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tx)
+
+	case "event":
+		s.handleTxEvent(w, r, id)
+
+	case "commit":
+		tx, ok := s.txs.Close(id)
+		if !ok {
+			http.Error(w, "Transaction not found", http.StatusNotFound)
+			return
+		}
+		events := []Event{}
+		if len(tx.Events) > 0 {
+			var err error
+			events, err = s.recordGroup(tx, ClockSource{RequestID: requestIDFrom(r.Context())})
+			// A transaction that failed to commit was not appended at
+			// all and stays open, to be committed again
+			if err != nil {
+				s.txs.reopen(tx)
+				if errors.Is(err, errClockFrozen) {
+					http.Error(w, "Clock is frozen, commit after it resumes", http.StatusConflict)
+				} else {
+					s.writeCommitError(w, err)
+				}
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"tx_id":       tx.ID,
+			"event_count": len(events),
+			"events":      events,
+		})
+
+	case "abort":
+		tx, ok := s.txs.Close(id)
+		if !ok {
+			http.Error(w, "Transaction not found", http.StatusNotFound)
+			return
+		}
+		s.logger.Info("Transaction aborted", "tx_id", tx.ID, "events", len(tx.Events))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"tx_id":         tx.ID,
+			"dropped_count": len(tx.Events),
+		})
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleTxEvent validates an event like /event does and holds it back
+// under a transaction. Its ID and time are assigned at commit; the
+// transaction ID goes into its metadata under "tx".
+func (s *Server) handleTxEvent(w http.ResponseWriter, r *http.Request, id string) {
+	event, ok, err := decodeEventBody(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !ok {
+		event.Message = r.URL.Query().Get("message")
+	}
+	if event, err = s.localEvent(r.Context(), event); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	metadata := make(map[string]string, len(event.Metadata)+1)
+	for k, v := range event.Metadata {
+		metadata[k] = v
+	}
+	metadata["tx"] = id
+	event.Metadata = metadata
+	index, err := s.txs.Add(id, event)
+	switch {
+	case errors.Is(err, errTxNotFound):
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
+	case errors.Is(err, errTxFull):
+		http.Error(w, "Transaction holds too many events", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tx_id": id,
+		"index": index,
+	})
+}
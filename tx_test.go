@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func txRequest(server *Server, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	server.handleTx(w, req)
+	return w
+}
+
+func TestTransactionCommit(t *testing.T) {
+	server := NewServer()
+	server.logEvent("before", "Before")
+
+	var tx Transaction
+	json.NewDecoder(txRequest(server, http.MethodPost, "/tx/begin", "").Body).Decode(&tx)
+	if tx.ID == "" {
+		t.Fatal("Expected a transaction ID")
+	}
+	if w := txRequest(server, http.MethodPost, "/tx/"+tx.ID+"/event?message=debit", ""); w.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	txRequest(server, http.MethodPost, "/tx/"+tx.ID+"/event", `{"message":"credit","metadata":{"account":"b"}}`)
+
+	// Held back until the commit
+	server.logEvent("between", "Between")
+	if n := len(server.events.Events()); n != 2 {
+		t.Errorf("Expected the transaction's events to be held back, got %d events", n)
+	}
+	var open Transaction
+	json.NewDecoder(txRequest(server, http.MethodGet, "/tx/"+tx.ID, "").Body).Decode(&open)
+	if len(open.Events) != 2 {
+		t.Errorf("Expected 2 pending events, got %+v", open)
+	}
+
+	var commit struct {
+		EventCount int     `json:"event_count"`
+		Events     []Event `json:"events"`
+	}
+	json.NewDecoder(txRequest(server, http.MethodPost, "/tx/"+tx.ID+"/commit", "").Body).Decode(&commit)
+	if commit.EventCount != 2 {
+		t.Fatalf("Expected 2 committed events, got %+v", commit)
+	}
+	debit, credit := commit.Events[0], commit.Events[1]
+	if debit.Timestamp != 3 || credit.Timestamp != 4 {
+		t.Errorf("Expected timestamps 3 and 4 after the event logged in between, got %d and %d", debit.Timestamp, credit.Timestamp)
+	}
+	if debit.ID != tx.ID+"-0" || credit.Metadata["tx"] != tx.ID || credit.Metadata["account"] != "b" {
+		t.Errorf("Expected the events to name the transaction, got %+v and %+v", debit, credit)
+	}
+	if brk := verifyChain(server.events.Events()); brk != nil {
+		t.Errorf("Expected the chain to verify, got %+v", brk)
+	}
+
+	if w := txRequest(server, http.MethodPost, "/tx/"+tx.ID+"/commit", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected a second commit to find nothing, got %d", w.Code)
+	}
+}
+
+func TestTransactionAbort(t *testing.T) {
+	server := NewServer()
+	tx := server.txs.Begin()
+	txRequest(server, http.MethodPost, "/tx/"+tx.ID+"/event?message=a", "")
+
+	var abort struct {
+		Dropped int `json:"dropped_count"`
+	}
+	json.NewDecoder(txRequest(server, http.MethodPost, "/tx/"+tx.ID+"/abort", "").Body).Decode(&abort)
+	if abort.Dropped != 1 || len(server.events.Events()) != 0 || server.clock.GetTime() != 0 {
+		t.Errorf("Expected the event dropped without a tick, got %+v", abort)
+	}
+
+	for _, c := range []struct {
+		method, target string
+		want           int
+	}{
+		{http.MethodPost, "/tx/" + tx.ID + "/event?message=a", http.StatusNotFound},
+		{http.MethodGet, "/tx/begin", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/tx/" + tx.ID + "/commit", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/tx/" + tx.ID + "/other", http.StatusNotFound},
+	} {
+		if w := txRequest(server, c.method, c.target, ""); w.Code != c.want {
+			t.Errorf("%s %s: expected %d, got %d", c.method, c.target, c.want, w.Code)
+		}
+	}
+}
+
+func TestTransactionsNeverInterleaved(t *testing.T) {
+	server := NewServer()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			tx := server.txs.Begin()
+			for j := 0; j < 10; j++ {
+				server.txs.Add(tx.ID, Event{Message: "grouped", Metadata: map[string]string{"tx": tx.ID}})
+			}
+			tx, _ = server.txs.Close(tx.ID)
+			if _, err := server.recordGroup(tx, ClockSource{}); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				server.logEvent("single", "Single")
+			}
+		}()
+	}
+	wg.Wait()
+
+	events := server.events.Events()
+	sort.Slice(events, func(i, j int) bool { return events[i].Timestamp < events[j].Timestamp })
+	seen := make(map[string]bool)
+	for i, e := range events {
+		tx := e.Metadata["tx"]
+		if tx == "" || (i > 0 && events[i-1].Metadata["tx"] == tx) {
+			continue
+		}
+		if seen[tx] {
+			t.Fatalf("Transaction %s interleaved at timestamp %d", tx, e.Timestamp)
+		}
+		seen[tx] = true
+	}
+	if len(seen) != 4 {
+		t.Errorf("Expected 4 transactions, got %d", len(seen))
+	}
+}
+
+func TestClockTickNStaysInEpoch(t *testing.T) {
+	lc := NewLamportClock()
+	lc.rollover = 10
+	lc.Update(8)
+	first, err := lc.tickN(3, ClockSource{})
+	if err != nil || first != (ClockTime{Epoch: 1, Timestamp: 1}) || lc.Now() != (ClockTime{Epoch: 1, Timestamp: 3}) {
+		t.Errorf("Expected the group to start the next epoch, got %+v to %+v", first, lc.Now())
+	}
+}
+
+func TestTransactionCommitFrozen(t *testing.T) {
+	server := NewServer()
+	tx := server.txs.Begin()
+	txRequest(server, http.MethodPost, "/tx/"+tx.ID+"/event?message=a", "")
+	txRequest(server, http.MethodPost, "/tx/"+tx.ID+"/event?message=b", "")
+
+	// A frozen clock would stamp both events alike
+	server.clock.Freeze()
+	if w := txRequest(server, http.MethodPost, "/tx/"+tx.ID+"/commit", ""); w.Code != http.StatusConflict {
+		t.Errorf("Expected the commit refused while frozen, got %d", w.Code)
+	}
+	if open, ok := server.txs.Get(tx.ID); !ok || len(open.Events) != 2 || len(server.events.Events()) != 0 {
+		t.Errorf("Expected the transaction kept open with nothing appended, got %+v", open)
+	}
+
+	server.clock.Resume()
+	var commit struct {
+		Events []Event `json:"events"`
+	}
+	json.NewDecoder(txRequest(server, http.MethodPost, "/tx/"+tx.ID+"/commit", "").Body).Decode(&commit)
+	if len(commit.Events) != 2 || commit.Events[0].Timestamp != 1 || commit.Events[1].Timestamp != 2 {
+		t.Errorf("Expected the events at 1 and 2 once resumed, got %+v", commit.Events)
+	}
+}
+
+func TestTransactionCommitRefusedByStore(t *testing.T) {
+	server := NewServer()
+	st := openTestWALStore(t, filepath.Join(t.TempDir(), "events.wal"))
+	server.events = st
+	tx := server.txs.Begin()
+	txRequest(server, http.MethodPost, "/tx/"+tx.ID+"/event?message=a", "")
+	crashAfter(st, 0)
+
+	if w := txRequest(server, http.MethodPost, "/tx/"+tx.ID+"/commit", ""); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected the failed write refused, got %d", w.Code)
+	}
+	if _, ok := server.txs.Get(tx.ID); !ok || len(server.events.Events()) != 0 {
+		t.Errorf("Expected the transaction kept open with nothing appended")
+	}
+	// Later commits are refused before they tick
+	before := server.clock.GetTime()
+	if w := txRequest(server, http.MethodPost, "/tx/"+tx.ID+"/commit", ""); w.Code != http.StatusServiceUnavailable || server.clock.GetTime() != before {
+		t.Errorf("Expected the commit refused without ticking, got %d at %d", w.Code, server.clock.GetTime())
+	}
+}
+
+func TestTransactionsExpire(t *testing.T) {
+	server := NewServer()
+	tx := server.txs.Begin()
+	txRequest(server, http.MethodPost, "/tx/"+tx.ID+"/event?message=a", "")
+	server.txs.open[tx.ID].OpenedAt = time.Now().Add(-txTimeout - time.Second)
+
+	// Expired without another transaction being opened
+	if _, ok := server.txs.Get(tx.ID); ok {
+		t.Error("Expected the expired transaction not found")
+	}
+	if w := txRequest(server, http.MethodPost, "/tx/"+tx.ID+"/commit", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected the expired transaction not committed, got %d", w.Code)
+	}
+	if len(server.events.Events()) != 0 || server.clock.GetTime() != 0 {
+		t.Errorf("Expected nothing logged, got %d events at %d", len(server.events.Events()), server.clock.GetTime())
+	}
+}
+
+func TestTransactionCommitAllOrNothing(t *testing.T) {
+	server := NewServer()
+	path := filepath.Join(t.TempDir(), "events.wal")
+	st := openTestWALStore(t, path)
+	server.events = st
+	sub := server.broker.Subscribe(EventFilter{})
+	defer server.broker.Unsubscribe(sub)
+	tx := server.txs.Begin()
+	for _, message := range []string{"a", "b", "c"} {
+		txRequest(server, http.MethodPost, "/tx/"+tx.ID+"/event?message="+message, "")
+	}
+
+	// The write of the group fails halfway through
+	crashAfter(st, 64)
+	if w := txRequest(server, http.MethodPost, "/tx/"+tx.ID+"/commit", ""); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected the failed write refused, got %d", w.Code)
+	}
+	if got := len(server.events.Events()); got != 0 {
+		t.Errorf("Expected nothing appended, got %d events", got)
+	}
+	if server.head != "" {
+		t.Errorf("Expected the chain head restored, got %q", server.head)
+	}
+	select {
+	case event := <-sub.Events:
+		t.Errorf("Expected nothing published, got %+v", event)
+	default:
+	}
+	if open, ok := server.txs.Get(tx.ID); !ok || len(open.Events) != 3 {
+		t.Errorf("Expected the transaction kept open, got %+v", open)
+	}
+
+	crash(st)
+	if got := len(openTestWALStore(t, path).Events()); got != 0 {
+		t.Errorf("Expected nothing replayed, got %d events", got)
+	}
+}
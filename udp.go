@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec"
+)
+
+// UDP packets start with the magic "LC", a version byte and the length of
+// the node ID followed by the node ID. In version 2 the rest is the sequence
+// number as a varint and the time in codec encoding. Version 1, still
+// accepted, used fixed big endian fields:
+//
+//	sequence (4) | epoch (8) | timestamp (8)
+//
+// Every packet carries the sender's full current time rather than a delta,
+// so a lost packet is simply superseded by the next one.
+const (
+	udpMagic      = "LC"
+	udpVersion    = 2
+	udpHeaderSize = 2 + 1 + 1
+	udpV1BodySize = 4 + 8 + 8
+	maxUDPNodeID  = 255
+	maxUDPPacket  = udpHeaderSize + maxUDPNodeID + 3*binary.MaxVarintLen64
+)
+
+// udpRestartGap is how far a sequence number may go backwards before the
+// sender is assumed to have restarted rather than a packet being reordered
+const udpRestartGap = 1024
+
+// ErrInvalidPacket is returned for datagrams that are not clock packets
+var ErrInvalidPacket = errors.New("invalid clock packet")
+
+// UDPPacket is a clock synchronization beacon
+type UDPPacket struct {
+	NodeID string
+	Seq    uint32
+	Time   ClockTime
+}
+
+// MarshalBinary encodes the packet in the current version
+func (p UDPPacket) MarshalBinary() ([]byte, error) {
+	if len(p.NodeID) > maxUDPNodeID {
+		return nil, fmt.Errorf("node ID longer than %d bytes", maxUDPNodeID)
+	}
+	b := make([]byte, 0, udpHeaderSize+len(p.NodeID)+2*binary.MaxVarintLen64)
+	b = append(b, udpMagic...)
+	b = append(b, udpVersion, byte(len(p.NodeID)))
+	b = append(b, p.NodeID...)
+	b = binary.AppendUvarint(b, uint64(p.Seq))
+	return p.Time.wire().AppendBinary(b)
+}
+
+// UnmarshalBinary decodes a packet of either version, rejecting unknown
+// versions and truncated or oversized datagrams
+func (p *UDPPacket) UnmarshalBinary(b []byte) error {
+	if len(b) < udpHeaderSize || string(b[:2]) != udpMagic {
+		return ErrInvalidPacket
+	}
+	n := int(b[3])
+	if len(b) < udpHeaderSize+n {
+		return fmt.Errorf("%w: bad length %d", ErrInvalidPacket, len(b))
+	}
+	nodeID := string(b[udpHeaderSize : udpHeaderSize+n])
+	body := b[udpHeaderSize+n:]
+
+	var seq uint32
+	var t ClockTime
+	switch b[2] {
+	case 1:
+		if len(body) != udpV1BodySize {
+			return fmt.Errorf("%w: bad length %d", ErrInvalidPacket, len(b))
+		}
+		seq = binary.BigEndian.Uint32(body[:4])
+		t = ClockTime{
+			Epoch:     int64(binary.BigEndian.Uint64(body[4:12])),
+			Timestamp: int64(binary.BigEndian.Uint64(body[12:20])),
+		}
+		if t.Epoch < 0 || t.Timestamp < 0 {
+			return fmt.Errorf("%w: negative time", ErrInvalidPacket)
+		}
+	case 2:
+		v, used := binary.Uvarint(body)
+		if used <= 0 || v > math.MaxUint32 {
+			return fmt.Errorf("%w: bad sequence number", ErrInvalidPacket)
+		}
+		seq = uint32(v)
+		var wt codec.Timestamp
+		if err := wt.UnmarshalBinary(body[used:]); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPacket, err)
+		}
+		t = clockTimeFromWire(wt)
+	default:
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidPacket, b[2])
+	}
+
+	*p = UDPPacket{NodeID: nodeID, Seq: seq, Time: t}
+	return nil
+}
+
+// UDPPeerStats tracks the beacons received from one node. Lost is an
+// estimate from gaps in sequence numbers; packets arriving late count as
+// reordered and are taken back out of Lost.
+type UDPPeerStats struct {
+	Received  uint64    `json:"received"`
+	Lost      uint64    `json:"lost"`
+	Reordered uint64    `json:"reordered"`
+	LastSeq   uint32    `json:"last_seq"`
+	LastTime  ClockTime `json:"last_time"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// UDPStats summarizes the UDP listener. Unknown counts the packets dropped
+// for coming from an address that is not a peer.
+type UDPStats struct {
+	Received uint64                   `json:"received"`
+	Merged   uint64                   `json:"merged"`
+	Invalid  uint64                   `json:"invalid"`
+	Rejected uint64                   `json:"rejected"`
+	Unknown  uint64                   `json:"unknown"`
+	Sent     uint64                   `json:"sent"`
+	Peers    map[string]*UDPPeerStats `json:"peers"`
+}
+
+// UDPSync exchanges clock beacons with peers over UDP. Received beacons
+// raise the clock without counting as events, so frequent exchange does not
+// inflate timestamps.
+type UDPSync struct {
+	conn     *net.UDPConn
+	server   *Server
+	peers    []*net.UDPAddr
+	interval time.Duration
+	seq      uint32
+	stats    UDPStats
+	logger   *slog.Logger
+	mutex    sync.Mutex
+}
+
+// ListenUDP opens the UDP listener. Beacons are sent to peers every
+// interval, and only those coming from the address of a peer are merged;
+// with an interval of 0 the node only listens to them.
+func ListenUDP(addr string, peers []string, interval time.Duration, server *Server) (*UDPSync, error) {
+	laddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	u := &UDPSync{
+		server:   server,
+		interval: interval,
+		stats:    UDPStats{Peers: make(map[string]*UDPPeerStats)},
+		logger:   server.logger.With("transport", "udp"),
+	}
+	for _, p := range peers {
+		raddr, err := net.ResolveUDPAddr("udp", p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UDP peer %q: %w", p, err)
+		}
+		u.peers = append(u.peers, raddr)
+	}
+	if u.conn, err = net.ListenUDP("udp", laddr); err != nil {
+		return nil, err
+	}
+
+	server.metrics.Counter("lamport_udp_packets_total", "UDP clock packets received by result")
+	server.metrics.Counter("lamport_udp_sent_total", "UDP clock packets sent")
+	// Listening asks for beacons, as -udp-addr implies udp-sync; the
+	// feature stays a switch to turn them off at runtime
+	server.features.set(FeatureUDPSync, true)
+	return u, nil
+}
+
+// Addr returns the address the listener is bound to
+func (u *UDPSync) Addr() net.Addr {
+	return u.conn.LocalAddr()
+}
+
+// Run serves and sends beacons until ctx is done, then closes the socket
+func (u *UDPSync) Run(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		u.serve()
+	}()
+
+	if len(u.peers) > 0 && u.interval > 0 {
+		ticker := time.NewTicker(u.interval)
+		defer ticker.Stop()
+	loop:
+		for {
+			select {
+			case <-ctx.Done():
+				break loop
+			case <-ticker.C:
+				u.broadcast()
+			}
+		}
+	} else {
+		<-ctx.Done()
+	}
+
+	u.conn.Close()
+	<-done
+}
+
+func (u *UDPSync) serve() {
+	buf := make([]byte, maxUDPPacket+1)
+	for {
+		n, from, err := u.conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			u.logger.Warn("UDP read failed", "error", err)
+			continue
+		}
+		u.handlePacket(buf[:n], from)
+	}
+}
+
+func (u *UDPSync) handlePacket(data []byte, from net.Addr) {
+	var p UDPPacket
+	if err := p.UnmarshalBinary(data); err != nil {
+		u.count("invalid", func(s *UDPStats) { s.Invalid++ })
+		u.logger.Debug("Dropped UDP packet", "from", from.String(), "error", err)
+		return
+	}
+	if p.NodeID == u.server.nodeID || !u.server.features.Enabled(FeatureUDPSync) {
+		return
+	}
+	if !u.fromPeer(from) {
+		u.count("unknown", func(s *UDPStats) { s.Unknown++ })
+		u.logger.Debug("Dropped UDP packet from an unknown address", "from", from.String(), "node_id", p.NodeID)
+		return
+	}
+
+	u.mutex.Lock()
+	u.stats.Received++
+	u.trackLocked(p)
+	u.mutex.Unlock()
+
+	if _, err := u.server.clock.observeFrom(p.Time, ClockSource{Peer: p.NodeID}); err != nil {
+		u.count("rejected", func(s *UDPStats) { s.Rejected++ })
+		return
+	}
+	u.count("merged", func(s *UDPStats) { s.Merged++ })
+}
+
+// fromPeer reports whether a datagram comes from the address of a peer.
+// Beacons are not signed, and -max-jump is off by default, so a beacon
+// from anywhere else could move the clock arbitrarily far.
+func (u *UDPSync) fromPeer(from net.Addr) bool {
+	addr, ok := from.(*net.UDPAddr)
+	if !ok {
+		return false
+	}
+	for _, peer := range u.peers {
+		if peer.Port == addr.Port && peer.IP.Equal(addr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// trackLocked updates the loss and reordering estimate of the sender.
+// Stats are kept for as many nodes as there are peers: a node ID not seen
+// before takes the place of the one heard from least recently, so peers
+// changing their IDs cannot grow the map.
+func (u *UDPSync) trackLocked(p UDPPacket) {
+	peer, ok := u.stats.Peers[p.NodeID]
+	if !ok {
+		if len(u.stats.Peers) >= max(len(u.peers), 1) {
+			u.evictLocked()
+		}
+		peer = &UDPPeerStats{LastSeq: p.Seq}
+		u.stats.Peers[p.NodeID] = peer
+	} else {
+		switch gap := int32(p.Seq - peer.LastSeq); {
+		case gap > 0:
+			peer.Lost += uint64(gap - 1)
+			peer.LastSeq = p.Seq
+		case gap < -udpRestartGap:
+			peer.LastSeq = p.Seq
+		default:
+			peer.Reordered++
+			if peer.Lost > 0 {
+				peer.Lost--
+			}
+		}
+	}
+	peer.Received++
+	peer.LastTime = p.Time
+	peer.LastSeen = time.Now()
+}
+
+// evictLocked drops the stats of the node heard from least recently
+func (u *UDPSync) evictLocked() {
+	var oldest string
+	var seen time.Time
+	for id, peer := range u.stats.Peers {
+		if oldest == "" || peer.LastSeen.Before(seen) {
+			oldest, seen = id, peer.LastSeen
+		}
+	}
+	delete(u.stats.Peers, oldest)
+}
+
+func (u *UDPSync) count(result string, update func(*UDPStats)) {
+	u.mutex.Lock()
+	update(&u.stats)
+	u.mutex.Unlock()
+	u.server.metrics.Inc("lamport_udp_packets_total", "result", result)
+}
+
+// broadcast sends the current time to every peer
+func (u *UDPSync) broadcast() {
+	if !u.server.features.Enabled(FeatureUDPSync) {
+		return
+	}
+	u.mutex.Lock()
+	u.seq++
+	seq := u.seq
+	u.mutex.Unlock()
+
+	packet, err := UDPPacket{NodeID: u.server.nodeID, Seq: seq, Time: u.server.clock.Now()}.MarshalBinary()
+	if err != nil {
+		u.logger.Error("Cannot encode UDP packet", "error", err)
+		return
+	}
+	for _, peer := range u.peers {
+		if _, err := u.conn.WriteToUDP(packet, peer); err != nil {
+			u.logger.Debug("UDP send failed", "peer", peer.String(), "error", err)
+			continue
+		}
+		u.mutex.Lock()
+		u.stats.Sent++
+		u.mutex.Unlock()
+		u.server.metrics.Inc("lamport_udp_sent_total")
+	}
+}
+
+// Stats returns a copy of the current statistics
+func (u *UDPSync) Stats() UDPStats {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	stats := u.stats
+	stats.Peers = make(map[string]*UDPPeerStats, len(u.stats.Peers))
+	for id, p := range u.stats.Peers {
+		peer := *p
+		stats.Peers[id] = &peer
+	}
+	return stats
+}
+
+func (u *UDPSync) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(u.Stats())
+}
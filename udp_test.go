@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestUDPPacketRoundTrip(t *testing.T) {
+	p := UDPPacket{NodeID: "node-a", Seq: 7, Time: ClockTime{Epoch: 1, Timestamp: 42}}
+	data, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Small values take a single varint byte each
+	if data[2] != 2 || len(data) != udpHeaderSize+len("node-a")+3 {
+		t.Errorf("Unexpected version %d or size %d", data[2], len(data))
+	}
+
+	var decoded UDPPacket
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if decoded != p {
+		t.Errorf("Expected %+v, got %+v", p, decoded)
+	}
+
+	if _, err := (UDPPacket{NodeID: string(bytes.Repeat([]byte("x"), 256))}).MarshalBinary(); err == nil {
+		t.Error("Expected node IDs over 255 bytes to be rejected")
+	}
+}
+
+// udpV1Packet builds a packet in the fixed size version 1 layout
+func udpV1Packet(nodeID string, seq uint32, epoch, timestamp uint64) []byte {
+	b := append([]byte(udpMagic), 1, byte(len(nodeID)))
+	b = append(b, nodeID...)
+	b = binary.BigEndian.AppendUint32(b, seq)
+	b = binary.BigEndian.AppendUint64(b, epoch)
+	return binary.BigEndian.AppendUint64(b, timestamp)
+}
+
+func TestUDPPacketVersion1(t *testing.T) {
+	var p UDPPacket
+	if err := p.UnmarshalBinary(udpV1Packet("old", 3, 0, 99)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if p != (UDPPacket{NodeID: "old", Seq: 3, Time: ClockTime{Timestamp: 99}}) {
+		t.Errorf("Unexpected packet %+v", p)
+	}
+}
+
+func TestUDPPacketRejectsGarbage(t *testing.T) {
+	valid, _ := UDPPacket{NodeID: "a", Seq: 1, Time: ClockTime{Timestamp: 1}}.MarshalBinary()
+
+	wrongVersion := append([]byte(nil), valid...)
+	wrongVersion[2] = 9
+
+	for name, data := range map[string][]byte{
+		"empty":            nil,
+		"magic":            []byte("XX\x01\x00"),
+		"version":          wrongVersion,
+		"node ID":          []byte("LC\x02\x09ab"),
+		"truncated":        valid[:len(valid)-1],
+		"trailing":         append(append([]byte(nil), valid...), 0),
+		"v1 truncated":     udpV1Packet("a", 1, 0, 1)[:10],
+		"v1 negative time": udpV1Packet("a", 1, 0, 1<<63),
+	} {
+		var p UDPPacket
+		if err := p.UnmarshalBinary(data); !errors.Is(err, ErrInvalidPacket) {
+			t.Errorf("%s: expected ErrInvalidPacket, got %v", name, err)
+		}
+	}
+}
+
+func TestUDPLossTracking(t *testing.T) {
+	server := NewServer()
+	u, err := ListenUDP("127.0.0.1:0", []string{"127.0.0.1:9"}, 0, server)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer u.conn.Close()
+
+	from := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9}
+	for _, seq := range []uint32{1, 2, 5, 4, 6} {
+		data, _ := UDPPacket{NodeID: "b", Seq: seq, Time: ClockTime{Timestamp: int64(seq * 10)}}.MarshalBinary()
+		u.handlePacket(data, from)
+	}
+	u.handlePacket([]byte("noise"), from)
+
+	stats := u.Stats()
+	peer := stats.Peers["b"]
+	if peer == nil {
+		t.Fatal("Expected stats for node b")
+	}
+	// 3 and 4 looked lost when 5 arrived, then 4 showed up late
+	if peer.Received != 5 || peer.Lost != 1 || peer.Reordered != 1 || peer.LastSeq != 6 {
+		t.Errorf("Unexpected peer stats: %+v", peer)
+	}
+	if stats.Received != 5 || stats.Merged != 5 || stats.Invalid != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	// Beacons raise the clock to the highest time seen without ticking it
+	if server.clock.GetTime() != 60 {
+		t.Errorf("Expected clock 60, got %d", server.clock.GetTime())
+	}
+}
+
+func TestUDPSyncBetweenNodes(t *testing.T) {
+	a := NewServer()
+	a.nodeID = "a"
+	b := NewServer()
+	b.nodeID = "b"
+
+	ub, err := ListenUDP("127.0.0.1:0", nil, 0, b)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	ua, err := ListenUDP("127.0.0.1:0", []string{ub.Addr().String()}, 5*time.Millisecond, a)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	// b only listens, to a
+	ub.peers = append(ub.peers, ua.Addr().(*net.UDPAddr))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	doneA, doneB := make(chan struct{}), make(chan struct{})
+	go func() { ua.Run(ctx); close(doneA) }()
+	go func() { ub.Run(ctx); close(doneB) }()
+
+	a.clock.Update(100)
+	deadline := time.Now().Add(2 * time.Second)
+	for b.clock.GetTime() < 101 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-doneA
+	<-doneB
+
+	if b.clock.GetTime() != 101 {
+		t.Errorf("Expected b to reach 101, got %d", b.clock.GetTime())
+	}
+	if ua.Stats().Sent == 0 {
+		t.Error("Expected a to report sent packets")
+	}
+}
+
+func TestUDPDropsUnknownSources(t *testing.T) {
+	server := NewServer()
+	u, err := ListenUDP("127.0.0.1:0", []string{"127.0.0.1:9"}, 0, server)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer u.conn.Close()
+
+	spoofed, _ := UDPPacket{NodeID: "b", Seq: 1, Time: ClockTime{Epoch: 5, Timestamp: 1 << 40}}.MarshalBinary()
+	u.handlePacket(spoofed, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 9})
+	u.handlePacket(spoofed, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 10})
+	if stats := u.Stats(); server.clock.Now() != (ClockTime{}) || stats.Unknown != 2 || len(stats.Peers) != 0 {
+		t.Errorf("Expected beacons from other addresses dropped, got %s and %+v", server.clock.Now(), stats)
+	}
+
+	// A peer cycling through node IDs keeps one entry
+	for i := range 100 {
+		data, _ := UDPPacket{NodeID: fmt.Sprintf("n%d", i), Seq: 1, Time: ClockTime{Timestamp: 1}}.MarshalBinary()
+		u.handlePacket(data, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9})
+	}
+	if peers := u.Stats().Peers; len(peers) != 1 || peers["n99"] == nil {
+		t.Errorf("Expected only the latest node ID kept, got %v", peers)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// maxVectorEntries bounds the size of decoded vector stamps
+const maxVectorEntries = 4096
+
+// ErrInvalidStamp is returned for stamps that cannot be decoded
+var ErrInvalidStamp = errors.New("invalid stamp")
+
+// VectorTime maps process IDs to the number of events seen from each
+type VectorTime map[string]uint64
+
+// Compare relates two vector times: a is before b when no entry of a is
+// greater and at least one is smaller
+func (v VectorTime) Compare(other VectorTime) Ordering {
+	less, greater := false, false
+	for id, n := range v {
+		if m := other[id]; n < m {
+			less = true
+		} else if n > m {
+			greater = true
+		}
+	}
+	for id, m := range other {
+		if _, ok := v[id]; !ok && m > 0 {
+			less = true
+		}
+	}
+	switch {
+	case less && greater:
+		return relationConcurrent
+	case less:
+		return relationBefore
+	case greater:
+		return relationAfter
+	default:
+		return relationEqual
+	}
+}
+
+// merge raises every entry of v to at least the one in other
+func (v VectorTime) merge(other VectorTime) {
+	for id, n := range other {
+		if n > v[id] {
+			v[id] = n
+		}
+	}
+}
+
+// MarshalBinary encodes the entries ordered by process ID: the entry count
+// followed by length-prefixed IDs and their counters, all as varints
+func (v VectorTime) MarshalBinary() ([]byte, error) {
+	ids := make([]string, 0, len(v))
+	for id := range v {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	b := binary.AppendUvarint(nil, uint64(len(ids)))
+	for _, id := range ids {
+		b = binary.AppendUvarint(b, uint64(len(id)))
+		b = append(b, id...)
+		b = binary.AppendUvarint(b, v[id])
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes entries written by MarshalBinary
+func (v *VectorTime) UnmarshalBinary(data []byte) error {
+	count, n := binary.Uvarint(data)
+	if n <= 0 || count > maxVectorEntries {
+		return fmt.Errorf("%w: bad entry count", ErrInvalidStamp)
+	}
+	data = data[n:]
+
+	vt := make(VectorTime, count)
+	for i := uint64(0); i < count; i++ {
+		size, n := binary.Uvarint(data)
+		if n <= 0 || size > uint64(len(data)-n) {
+			return fmt.Errorf("%w: bad process ID", ErrInvalidStamp)
+		}
+		id := string(data[n : n+int(size)])
+		data = data[n+int(size):]
+
+		counter, n := binary.Uvarint(data)
+		if n <= 0 {
+			return fmt.Errorf("%w: bad counter", ErrInvalidStamp)
+		}
+		data = data[n:]
+		vt[id] = counter
+	}
+	if len(data) > 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrInvalidStamp, len(data))
+	}
+	*v = vt
+	return nil
+}
+
+// VectorClock keeps one counter per process. Unlike Lamport timestamps,
+// vector times detect concurrency, at the cost of growing with every
+// process that has ever taken part.
+type VectorClock struct {
+	node  string
+	time  VectorTime
+	mutex sync.Mutex
+}
+
+// NewVectorClock creates a vector clock for the process node
+func NewVectorClock(node string) *VectorClock {
+	return &VectorClock{node: node, time: VectorTime{}}
+}
+
+// Now returns a copy of the current vector time
+func (vc *VectorClock) Now() VectorTime {
+	vc.mutex.Lock()
+	defer vc.mutex.Unlock()
+	now := make(VectorTime, len(vc.time))
+	now.merge(vc.time)
+	return now
+}
+
+// LocalEvent increments the process's own entry
+func (vc *VectorClock) LocalEvent() {
+	vc.mutex.Lock()
+	vc.time[vc.node]++
+	vc.mutex.Unlock()
+}
+
+// Send records a send event and returns the encoded vector time
+func (vc *VectorClock) Send() []byte {
+	vc.mutex.Lock()
+	defer vc.mutex.Unlock()
+	vc.time[vc.node]++
+	stamp, _ := vc.time.MarshalBinary()
+	return stamp
+}
+
+// Receive merges a received vector time and records the receive event
+func (vc *VectorClock) Receive(stamp []byte) error {
+	var received VectorTime
+	if err := received.UnmarshalBinary(stamp); err != nil {
+		return err
+	}
+	vc.mutex.Lock()
+	vc.time.merge(received)
+	vc.time[vc.node]++
+	vc.mutex.Unlock()
+	return nil
+}
+
+// Join absorbs the history of a process that is leaving, without
+// recording an event. Its entry stays in the vector.
+func (vc *VectorClock) Join(other *VectorClock) {
+	theirs := other.Now()
+	vc.mutex.Lock()
+	vc.time.merge(theirs)
+	vc.mutex.Unlock()
+}
+
+// Forget drops the entry of a process that left the group. Entries are
+// created when a process is first heard from, so the vector grows by
+// itself; Forget is how it shrinks. Stamps taken before and after no
+// longer compare correctly with respect to that process's events, so call
+// it once they are settled.
+func (vc *VectorClock) Forget(node string) {
+	if node == vc.node {
+		return
+	}
+	vc.mutex.Lock()
+	delete(vc.time, node)
+	vc.mutex.Unlock()
+}
+
+// Compare decodes and compares two vector stamps
+func (vc *VectorClock) Compare(a, b []byte) (Ordering, error) {
+	var va, vb VectorTime
+	if err := va.UnmarshalBinary(a); err != nil {
+		return "", fmt.Errorf("stamp a: %w", err)
+	}
+	if err := vb.UnmarshalBinary(b); err != nil {
+		return "", fmt.Errorf("stamp b: %w", err)
+	}
+	return va.Compare(vb), nil
+}
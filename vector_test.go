@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVectorTimeCompare(t *testing.T) {
+	cases := []struct {
+		a, b VectorTime
+		want Ordering
+	}{
+		{VectorTime{"a": 1}, VectorTime{"a": 1}, relationEqual},
+		{VectorTime{"a": 1}, VectorTime{"a": 2}, relationBefore},
+		{VectorTime{"a": 1}, VectorTime{"a": 1, "b": 1}, relationBefore},
+		{VectorTime{"a": 2, "b": 1}, VectorTime{"a": 1}, relationAfter},
+		{VectorTime{"a": 1}, VectorTime{"b": 1}, relationConcurrent},
+		{VectorTime{"a": 0}, VectorTime{}, relationEqual},
+	}
+	for _, c := range cases {
+		if got := c.a.Compare(c.b); got != c.want {
+			t.Errorf("%v vs %v: expected %s, got %s", c.a, c.b, c.want, got)
+		}
+	}
+}
+
+func TestVectorClockMessages(t *testing.T) {
+	a, b := NewVectorClock("a"), NewVectorClock("b")
+	sent := a.Send()
+	b.LocalEvent()
+	if err := b.Receive(sent); err != nil {
+		t.Fatal(err)
+	}
+
+	now := b.Now()
+	if now["a"] != 1 || now["b"] != 2 {
+		t.Errorf("Expected {a:1 b:2}, got %v", now)
+	}
+	if ordering, _ := a.Compare(sent, b.Send()); ordering != relationBefore {
+		t.Errorf("Expected send before the receiver's next event, got %s", ordering)
+	}
+	if ordering, _ := a.Compare(a.Send(), b.Send()); ordering != relationConcurrent {
+		t.Errorf("Expected concurrent sends, got %s", ordering)
+	}
+}
+
+func TestVectorTimeSerialization(t *testing.T) {
+	v := VectorTime{"node-1": 3, "node-2": 1 << 40}
+	data, _ := v.MarshalBinary()
+	var decoded VectorTime
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Compare(v) != relationEqual || len(decoded) != 2 {
+		t.Errorf("Expected %v, got %v", v, decoded)
+	}
+
+	for _, data := range [][]byte{nil, {1}, {1, 5, 'a'}, {1, 1, 'a'}, {0, 0}} {
+		if err := new(VectorTime).UnmarshalBinary(data); !errors.Is(err, ErrInvalidStamp) {
+			t.Errorf("Expected ErrInvalidStamp for %x, got %v", data, err)
+		}
+	}
+}
+
+func TestVectorClockForget(t *testing.T) {
+	vc := NewVectorClock("a")
+	b := NewVectorClock("b")
+	vc.LocalEvent()
+	if err := vc.Receive(b.Send()); err != nil {
+		t.Fatalf("Receive failed: %v", err)
+	}
+	if now := vc.Now(); len(now) != 2 {
+		t.Errorf("Expected an entry for b, got %v", now)
+	}
+
+	vc.Forget("b")
+	vc.Forget("a")
+	if now := vc.Now(); len(now) != 1 || now["a"] != 2 {
+		t.Errorf("Expected only a's entry, got %v", now)
+	}
+}
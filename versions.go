@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec/lamportpb/lamportpbconnect"
+)
+
+// apiVersion is the current version of the HTTP API. Its routes are served
+// under /v1/, and still without the prefix for clients written before it.
+const apiVersion = "v1"
+
+// legacyDeprecated is when the unprefixed routes were deprecated, announced
+// in their Deprecation header
+var legacyDeprecated = time.Date(2026, time.October, 14, 0, 0, 0, 0, time.UTC)
+
+// unversioned are the routes that are not part of the versioned API and are
+// served without a prefix and without deprecation: the usage text, the
+// dashboard, operational endpoints, the peer protocol and the RPC services,
+// whose paths gRPC clients cannot prefix
+var unversioned = []string{"/", "/ui/", "/metrics", "/healthz", "/readyz", "/openapi.json", "/peer/", "/debug/pprof/", "/" + lamportpbconnect.ClockName + "/"}
+
+// APIVersions routes requests to the handler of the API version named by
+// the first path segment, with the prefix removed, so several versions can
+// be served side by side while clients migrate. Unprefixed requests go to
+// the legacy version and are marked deprecated.
+type APIVersions struct {
+	versions map[string]http.Handler
+	legacy   http.Handler
+	latest   string
+	sunset   time.Time // when the unprefixed routes go away, zero if not planned
+	metrics  *Metrics
+	base     string // path the API is served under, for links to successors
+}
+
+// NewAPIVersions serves legacy for unprefixed requests. Versions are added
+// with Handle; the last one added is the one deprecated routes point to.
+func NewAPIVersions(legacy http.Handler, sunset time.Time, metrics *Metrics) *APIVersions {
+	metrics.Counter("lamport_legacy_requests_total", "Requests to deprecated unprefixed API routes")
+	return &APIVersions{versions: make(map[string]http.Handler), legacy: legacy, sunset: sunset, metrics: metrics}
+}
+
+// Handle serves a version, e.g. "v1", under /<version>/
+func (v *APIVersions) Handle(version string, h http.Handler) {
+	v.versions[version] = h
+	v.latest = version
+}
+
+func (v *APIVersions) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	version, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if h, ok := v.versions[version]; ok {
+		w.Header().Set("API-Version", version)
+		h.ServeHTTP(w, stripVersion(r, "/"+version))
+		return
+	}
+
+	if !isUnversioned(r.URL.Path) {
+		h := w.Header()
+		h.Set("Deprecation", "@"+strconv.FormatInt(legacyDeprecated.Unix(), 10))
+		h.Set("Link", "<"+v.base+"/"+v.latest+r.URL.Path+`>; rel="successor-version"`)
+		if !v.sunset.IsZero() {
+			h.Set("Sunset", v.sunset.UTC().Format(http.TimeFormat))
+		}
+		v.metrics.Inc("lamport_legacy_requests_total")
+	}
+	v.legacy.ServeHTTP(w, r)
+}
+
+func isUnversioned(path string) bool {
+	for _, route := range unversioned {
+		if path == route || (strings.HasSuffix(route, "/") && route != "/" && strings.HasPrefix(path, route)) {
+			return true
+		}
+	}
+	return false
+}
+
+// stripVersion returns a shallow copy of r without the version prefix, the
+// way http.StripPrefix does. /v1 alone becomes /.
+func stripVersion(r *http.Request, prefix string) *http.Request {
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = strings.TrimPrefix(r.URL.Path, prefix)
+	r2.URL.RawPath = strings.TrimPrefix(r.URL.RawPath, prefix)
+	if r2.URL.Path == "" {
+		r2.URL.Path = "/"
+	}
+	return r2
+}
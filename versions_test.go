@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIVersions(t *testing.T) {
+	var seen string
+	v1 := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = "v1 " + r.URL.Path
+	})
+	v2 := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = "v2 " + r.URL.Path
+	})
+	sunset := time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)
+	metrics := NewMetrics()
+	api := NewAPIVersions(v1, sunset, metrics)
+	api.Handle("v1", v1)
+	api.Handle("v2", v2)
+
+	cases := []struct {
+		target     string
+		want       string
+		version    string
+		deprecated bool
+	}{
+		{"/v1/time", "v1 /time", "v1", false},
+		{"/v2/events/e1/proof", "v2 /events/e1/proof", "v2", false},
+		{"/v1", "v1 /", "v1", false},
+		{"/time", "v1 /time", "", true},
+		{"/kv/color", "v1 /kv/color", "", true},
+		{"/healthz", "v1 /healthz", "", false},
+		{"/peer/sync/digest", "v1 /peer/sync/digest", "", false},
+		{"/ui/index.html", "v1 /ui/index.html", "", false},
+		{"/v3/time", "v1 /v3/time", "", true},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, httptest.NewRequest(http.MethodGet, c.target, nil))
+		if seen != c.want {
+			t.Errorf("%s: expected %q, got %q", c.target, c.want, seen)
+		}
+		if got := w.Header().Get("API-Version"); got != c.version {
+			t.Errorf("%s: expected API-Version %q, got %q", c.target, c.version, got)
+		}
+		if got := w.Header().Get("Deprecation") != ""; got != c.deprecated {
+			t.Errorf("%s: expected deprecated %v, got %v", c.target, c.deprecated, got)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events?order=total", nil))
+	if got := w.Header().Get("Link"); got != `</v2/events>; rel="successor-version"` {
+		t.Errorf("Expected a link to the latest version, got %q", got)
+	}
+	if got := w.Header().Get("Sunset"); got != "Fri, 01 Jan 2027 00:00:00 GMT" {
+		t.Errorf("Expected the sunset date, got %q", got)
+	}
+	if got := w.Header().Get("Deprecation"); !strings.HasPrefix(got, "@") {
+		t.Errorf("Expected a structured date, got %q", got)
+	}
+	var text strings.Builder
+	metrics.WriteText(&text)
+	if !strings.Contains(text.String(), "lamport_legacy_requests_total 4") {
+		t.Errorf("Expected 4 legacy requests to be counted, got:\n%s", text.String())
+	}
+
+	// Behind a path prefix the link keeps it
+	api.base = "/lamport"
+	w = httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events", nil))
+	if got := w.Header().Get("Link"); got != `</lamport/v2/events>; rel="successor-version"` {
+		t.Errorf("Expected the link under the prefix, got %q", got)
+	}
+}
+
+func TestAPIVersionsEscapedPath(t *testing.T) {
+	var seen string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.URL.EscapedPath()
+	})
+	api := NewAPIVersions(h, time.Time{}, NewMetrics())
+	api.Handle("v1", h)
+
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/kv/a%2Fb", nil))
+	if seen != "/kv/a%2Fb" {
+		t.Errorf("Expected the escaped path without the prefix, got %q", seen)
+	}
+	if w.Header().Get("Sunset") != "" {
+		t.Errorf("Expected no Sunset header without a date")
+	}
+}
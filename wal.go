@@ -0,0 +1,549 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SyncPolicy decides when the write-ahead log is flushed to disk
+type SyncPolicy string
+
+const (
+	// SyncAlways flushes every record before the write returns
+	SyncAlways SyncPolicy = "always"
+	// SyncInterval flushes the records written in the last interval
+	SyncInterval SyncPolicy = "interval"
+	// SyncNever leaves flushing to the operating system
+	SyncNever SyncPolicy = "no"
+)
+
+// parseSyncPolicy validates a policy name from configuration
+func parseSyncPolicy(name string) (SyncPolicy, error) {
+	switch p := SyncPolicy(name); p {
+	case SyncAlways, SyncInterval, SyncNever:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown WAL sync policy %q", name)
+	}
+}
+
+// Kinds of WAL records
+const (
+	walEvent    = "event"
+	walEvents   = "events"
+	walTrim     = "trim"
+	walSnapshot = "snapshot"
+	walClock    = "clock"
+)
+
+// walRecord is one change to the log or the clock. An events record holds
+// a group of events appended at once, such as a transaction; a snapshot
+// holds the whole log, as compaction leaves it. A snapshot too large for one record
+// is split in parts, numbered from 0, all but the last marked More; it is
+// replayed once its last part is read, so a torn one is never applied.
+type walRecord struct {
+	Kind    string     `json:"kind"`
+	Event   *Event     `json:"event,omitempty"`
+	N       int        `json:"n,omitempty"`
+	Events  []Event    `json:"events,omitempty"`
+	Dropped int64      `json:"dropped,omitempty"`
+	Part    int        `json:"part,omitempty"`
+	More    bool       `json:"more,omitempty"`
+	Clock   *ClockTime `json:"clock,omitempty"`
+}
+
+// Each record is framed by its length and a CRC-32C of its payload, so a
+// torn write at the end of the file is told apart from a record
+const (
+	walHeaderSize = 8
+	// The log is compacted once it grew past both this size and twice its
+	// size after the last compaction
+	walCompactSize = 4 << 20
+)
+
+// Variables for tests
+var (
+	// walMaxRecord bounds the payload of a record, on write and on read
+	walMaxRecord = 256 << 20
+	// walSnapshotPart is how many events a part of a snapshot holds at
+	// most; parts still larger than walMaxRecord are split further
+	walSnapshotPart = 10000
+)
+
+// errWALRecordTooLarge refuses a record that replay would take for a torn
+// one
+var errWALRecordTooLarge = errors.New("write-ahead log record too large")
+
+var walTable = crc32.MakeTable(crc32.Castagnoli)
+
+// errWALBroken refuses writes after a failed one, whose torn record
+// recovery truncates
+var errWALBroken = errors.New("write-ahead log failed earlier")
+
+// WAL is an append-only file of records, written before the changes they
+// describe take effect
+type WAL struct {
+	path    string
+	policy  SyncPolicy
+	file    *os.File
+	w       io.Writer // the file, but for crash tests
+	size    int64
+	dirty   bool
+	err     error
+	mutex   sync.Mutex
+	compact int64 // size after the last compaction
+}
+
+// OpenWAL opens or creates the log at path and returns the records it
+// holds. A torn or corrupt record ends the log: it and anything after it
+// are truncated away, as they were never acknowledged.
+func OpenWAL(path string, policy SyncPolicy, logger *slog.Logger) (*WAL, []walRecord, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, nil, err
+	}
+	records, valid, err := readWAL(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	if info.Size() > valid {
+		logger.Warn("Truncating torn write-ahead log records", "path", path, "offset", valid, "bytes", info.Size()-valid)
+		err := file.Truncate(valid)
+		if err == nil {
+			err = file.Sync()
+		}
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+	}
+	if _, err := file.Seek(valid, io.SeekStart); err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return &WAL{path: path, policy: policy, file: file, w: file, size: valid, compact: valid}, records, nil
+}
+
+// readWAL decodes records up to the first one that is incomplete or fails
+// its checksum and returns the offset where the valid records end
+func readWAL(r io.Reader) ([]walRecord, int64, error) {
+	br := bufio.NewReader(r)
+	var records []walRecord
+	var offset int64
+	header := make([]byte, walHeaderSize)
+	for {
+		if _, err := io.ReadFull(br, header); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return records, offset, nil
+			}
+			return nil, 0, err
+		}
+		size := binary.BigEndian.Uint32(header)
+		if int64(size) > int64(walMaxRecord) {
+			return records, offset, nil
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return records, offset, nil
+			}
+			return nil, 0, err
+		}
+		var rec walRecord
+		if crc32.Checksum(payload, walTable) != binary.BigEndian.Uint32(header[4:]) || json.Unmarshal(payload, &rec) != nil {
+			return records, offset, nil
+		}
+		records = append(records, rec)
+		offset += walHeaderSize + int64(size)
+	}
+}
+
+// encodeWALRecord frames a record
+func encodeWALRecord(rec walRecord) ([]byte, error) {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) > walMaxRecord {
+		return nil, fmt.Errorf("%w: %s of %d bytes", errWALRecordTooLarge, rec.Kind, len(payload))
+	}
+	buf := make([]byte, walHeaderSize, walHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf, uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:], crc32.Checksum(payload, walTable))
+	return append(buf, payload...), nil
+}
+
+// encodeWALRecords frames a record, splitting a snapshot in as many parts
+// as it takes to keep each below walMaxRecord
+func encodeWALRecords(rec walRecord) ([]byte, error) {
+	if rec.Kind != walSnapshot {
+		return encodeWALRecord(rec)
+	}
+	var buf []byte
+	rest := rec.Events
+	for part := 0; ; part++ {
+		n := min(len(rest), walSnapshotPart)
+		for {
+			frame, err := encodeWALRecord(walRecord{Kind: walSnapshot, Events: rest[:n], Dropped: rec.Dropped, Part: part, More: n < len(rest)})
+			if errors.Is(err, errWALRecordTooLarge) && n > 1 {
+				n /= 2
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			buf = append(buf, frame...)
+			break
+		}
+		if rest = rest[n:]; len(rest) == 0 {
+			return buf, nil
+		}
+	}
+}
+
+// Append writes a record in a single write, flushed before returning under
+// SyncAlways
+func (w *WAL) Append(rec walRecord) error {
+	buf, err := encodeWALRecords(rec)
+	if err != nil {
+		return err
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.err != nil {
+		return errWALBroken
+	}
+	if _, err := w.w.Write(buf); err != nil {
+		w.err = err
+		return err
+	}
+	w.size += int64(len(buf))
+	w.dirty = true
+	if w.policy == SyncAlways {
+		return w.syncLocked()
+	}
+	return nil
+}
+
+func (w *WAL) syncLocked() error {
+	if !w.dirty {
+		return nil
+	}
+	if err := w.file.Sync(); err != nil {
+		w.err = err
+		return err
+	}
+	w.dirty = false
+	return nil
+}
+
+// Sync flushes the records written so far
+func (w *WAL) Sync() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.err != nil {
+		return errWALBroken
+	}
+	return w.syncLocked()
+}
+
+// needsCompaction reports whether the log grew enough to be rewritten
+func (w *WAL) needsCompaction() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.size > walCompactSize && w.size > 2*w.compact
+}
+
+// Compact replaces the log by a snapshot of the state its records led to,
+// written to a new file that is renamed over the log once flushed
+func (w *WAL) Compact(snapshot walRecord, clock *ClockTime) error {
+	buf, err := encodeWALRecords(snapshot)
+	if err != nil {
+		return err
+	}
+	if clock != nil {
+		rec, err := encodeWALRecord(walRecord{Kind: walClock, Clock: clock})
+		if err != nil {
+			return err
+		}
+		buf = append(buf, rec...)
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.err != nil {
+		return errWALBroken
+	}
+	tmp := w.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(buf)
+	if err == nil {
+		err = file.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp, w.path)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	syncDir(filepath.Dir(w.path))
+	w.file.Close()
+	w.file, w.w = file, file
+	w.size, w.compact, w.dirty = int64(len(buf)), int64(len(buf)), false
+	return nil
+}
+
+// syncDir makes a rename in dir durable; not every platform supports it
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// Run flushes the log every interval until ctx is done, under SyncInterval
+func (w *WAL) Run(ctx context.Context, interval time.Duration) {
+	if w.policy != SyncInterval {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Sync()
+		}
+	}
+}
+
+// Close flushes and closes the log
+func (w *WAL) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.err == nil {
+		w.syncLocked()
+	}
+	return w.file.Close()
+}
+
+// WALStore keeps the event log in another store, in memory, and writes
+// every change to a write-ahead log first, so the log survives crashes.
+// It also persists the clock, as a ClockStorage, in the same file.
+type WALStore struct {
+	EventStore
+	wal     *WAL
+	metrics *Metrics
+	logger  *slog.Logger
+	base    int64 // events dropped before the last snapshot
+	clock   *ClockTime
+	mutex   sync.Mutex // keeps the log and the store in the same order
+}
+
+// OpenWALStore opens the write-ahead log at path and replays it into
+// inner, which must be empty
+func OpenWALStore(path string, inner EventStore, policy SyncPolicy, metrics *Metrics, logger *slog.Logger) (*WALStore, error) {
+	wal, records, err := OpenWAL(path, policy, logger)
+	if err != nil {
+		return nil, err
+	}
+	metrics.Counter("lamport_wal_failures_total", "Changes that could not be written to the write-ahead log")
+	st := &WALStore{EventStore: inner, wal: wal, metrics: metrics, logger: logger}
+	// The parts of a snapshot read so far; any other record ends a snapshot
+	// left incomplete by a failed write
+	var snapshot []Event
+	for _, rec := range records {
+		if rec.Kind != walSnapshot || rec.Part == 0 {
+			snapshot = nil
+		}
+		switch rec.Kind {
+		case walEvent:
+			if rec.Event != nil {
+				inner.Append(*rec.Event)
+			}
+		case walEvents:
+			for _, event := range rec.Events {
+				inner.Append(event)
+			}
+		case walTrim:
+			inner.Trim(rec.N)
+		case walSnapshot:
+			if snapshot = append(snapshot, rec.Events...); rec.More {
+				continue
+			}
+			inner.Replace(snapshot)
+			st.base = rec.Dropped - inner.Dropped()
+		case walClock:
+			if rec.Clock != nil && (st.clock == nil || st.clock.Before(*rec.Clock)) {
+				st.clock = rec.Clock
+			}
+		}
+	}
+	logger.Info("Write-ahead log replayed", "path", path, "records", len(records), "events", inner.Len())
+	return st, nil
+}
+
+// writeLocked logs a record, reporting failures. The change must not be
+// applied when it fails, or it would not survive a crash; as the log
+// refuses writes after a failed one, so do the store and the node.
+func (st *WALStore) writeLocked(rec walRecord) error {
+	err := st.wal.Append(rec)
+	if err != nil && !errors.Is(err, errWALBroken) {
+		st.logger.Error("Failed to write to the write-ahead log", "kind", rec.Kind, "error", err)
+	}
+	if err != nil {
+		st.metrics.Inc("lamport_wal_failures_total")
+		return fmt.Errorf("write-ahead log: %w", err)
+	}
+	return nil
+}
+
+func (st *WALStore) Append(event Event) {
+	st.appendChecked(event)
+}
+
+func (st *WALStore) appendChecked(event Event) error {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	if err := st.writeLocked(walRecord{Kind: walEvent, Event: &event}); err != nil {
+		return err
+	}
+	st.EventStore.Append(event)
+	if st.wal.needsCompaction() {
+		st.compactLocked()
+	}
+	return nil
+}
+
+func (st *WALStore) appendAllChecked(events []Event) error {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	if err := st.writeLocked(walRecord{Kind: walEvents, Events: events}); err != nil {
+		return err
+	}
+	for _, event := range events {
+		st.EventStore.Append(event)
+	}
+	if st.wal.needsCompaction() {
+		st.compactLocked()
+	}
+	return nil
+}
+
+func (st *WALStore) Replace(events []Event) {
+	st.replaceChecked(events)
+}
+
+func (st *WALStore) replaceChecked(events []Event) error {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	snapshot := walRecord{Kind: walSnapshot, Events: events, Dropped: st.base + st.EventStore.Dropped()}
+	if err := st.writeLocked(snapshot); err != nil {
+		return err
+	}
+	st.EventStore.Replace(events)
+	return nil
+}
+
+func (st *WALStore) Trim(n int) []Event {
+	trimmed, _ := st.trimChecked(n)
+	return trimmed
+}
+
+func (st *WALStore) trimChecked(n int) ([]Event, error) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	if err := st.writeLocked(walRecord{Kind: walTrim, N: n}); err != nil {
+		return nil, err
+	}
+	return st.EventStore.Trim(n), nil
+}
+
+// writeErr returns the failure after which the log refuses writes
+func (st *WALStore) writeErr() error {
+	st.wal.mutex.Lock()
+	defer st.wal.mutex.Unlock()
+	if st.wal.err != nil {
+		return fmt.Errorf("write-ahead log: %w: %v", errWALBroken, st.wal.err)
+	}
+	return nil
+}
+
+func (st *WALStore) Dropped() int64 {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	return st.base + st.EventStore.Dropped()
+}
+
+func (st *WALStore) snapshotLocked() walRecord {
+	return walRecord{Kind: walSnapshot, Events: st.EventStore.Events(), Dropped: st.base + st.EventStore.Dropped()}
+}
+
+// compactLocked rewrites a grown log as a snapshot of the events
+func (st *WALStore) compactLocked() {
+	snapshot := st.snapshotLocked()
+	if err := st.wal.Compact(snapshot, st.clock); err != nil {
+		st.logger.Error("Failed to compact the write-ahead log", "error", err)
+		return
+	}
+	st.logger.Info("Write-ahead log compacted", "events", len(snapshot.Events))
+}
+
+// Load returns the latest clock saved to the log
+func (st *WALStore) Load() (ClockTime, bool, error) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	if st.clock == nil {
+		return ClockTime{}, false, nil
+	}
+	return *st.clock, true, nil
+}
+
+// Save logs the clock, flushed before returning whatever the policy: the
+// clock is saved seldom, and resumes from the saved time after a crash
+func (st *WALStore) Save(now ClockTime) (ClockTime, error) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	err := st.wal.Append(walRecord{Kind: walClock, Clock: &now})
+	if err == nil {
+		err = st.wal.Sync()
+	}
+	if err != nil {
+		return ClockTime{}, err
+	}
+	st.clock = &now
+	return now, nil
+}
+
+// Run flushes the log every interval until ctx is done, under SyncInterval
+func (st *WALStore) Run(ctx context.Context, interval time.Duration) {
+	st.wal.Run(ctx, interval)
+}
+
+// Close flushes and closes the log
+func (st *WALStore) Close() error {
+	return st.wal.Close()
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// errCrash is the write a simulated crash cut short
+var errCrash = errors.New("simulated crash")
+
+// crashWriter writes budget bytes through and then fails, as if the
+// process died in the middle of a write
+type crashWriter struct {
+	w      io.Writer
+	budget int
+}
+
+func (c *crashWriter) Write(p []byte) (int, error) {
+	if len(p) <= c.budget {
+		c.budget -= len(p)
+		return c.w.Write(p)
+	}
+	n, _ := c.w.Write(p[:c.budget])
+	c.budget = 0
+	return n, errCrash
+}
+
+func openTestWALStore(t *testing.T, path string) *WALStore {
+	t.Helper()
+	st, err := OpenWALStore(path, NewShardedStore(4), SyncAlways, NewMetrics(), slog.Default())
+	if err != nil {
+		t.Fatalf("Failed to open WAL: %v", err)
+	}
+	return st
+}
+
+// crashAfter lets the next writes of st reach the file up to budget bytes
+func crashAfter(st *WALStore, budget int) {
+	st.wal.w = &crashWriter{w: st.wal.file, budget: budget}
+}
+
+// crash drops st without flushing or closing it cleanly
+func crash(st *WALStore) {
+	st.wal.file.Close()
+}
+
+func TestWALRecoversFromTornEventWrites(t *testing.T) {
+	event := Event{ID: "e4", Timestamp: 4, Message: "Torn"}
+	record, _ := encodeWALRecord(walRecord{Kind: walEvent, Event: &event})
+
+	// Crash at every byte of the fourth record
+	for cut := 0; cut <= len(record); cut++ {
+		path := filepath.Join(t.TempDir(), "events.wal")
+		st := openTestWALStore(t, path)
+		for i := 1; i <= 3; i++ {
+			st.Append(Event{ID: fmt.Sprintf("e%d", i), Timestamp: int64(i)})
+		}
+		crashAfter(st, cut)
+		st.Append(event)
+		crash(st)
+
+		recovered := openTestWALStore(t, path)
+		want := 3
+		if cut == len(record) {
+			want = 4
+		}
+		if n := recovered.Len(); n != want {
+			t.Fatalf("cut %d: expected %d events recovered, got %d", cut, want, n)
+		}
+		// The log goes on after the truncated record
+		recovered.Append(Event{ID: "e5", Timestamp: 5})
+		recovered.Close()
+		if reopened := openTestWALStore(t, path); reopened.Len() != want+1 {
+			t.Fatalf("cut %d: expected %d events after reopening, got %d", cut, want+1, reopened.Len())
+		} else {
+			reopened.Close()
+		}
+	}
+}
+
+func TestWALRecoversFromTornClockWrites(t *testing.T) {
+	record, _ := encodeWALRecord(walRecord{Kind: walClock, Clock: &ClockTime{Timestamp: 20}})
+	for cut := 0; cut < len(record); cut++ {
+		path := filepath.Join(t.TempDir(), "events.wal")
+		st := openTestWALStore(t, path)
+		if _, err := st.Save(ClockTime{Timestamp: 10}); err != nil {
+			t.Fatal(err)
+		}
+		crashAfter(st, cut)
+		if _, err := st.Save(ClockTime{Timestamp: 20}); err == nil {
+			t.Fatalf("cut %d: expected the save to fail", cut)
+		}
+		crash(st)
+
+		// The committed save survives, the torn one was never acknowledged
+		recovered := openTestWALStore(t, path)
+		if saved, ok, err := recovered.Load(); !ok || err != nil || saved.Timestamp != 10 {
+			t.Fatalf("cut %d: expected the clock at 10, got %v %v %v", cut, saved, ok, err)
+		}
+		recovered.Close()
+	}
+}
+
+func TestWALRefusesWritesAfterFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.wal")
+	st := openTestWALStore(t, path)
+	st.Append(Event{ID: "e1"})
+	crashAfter(st, 3)
+	st.Append(Event{ID: "e2"})
+	st.wal.w = st.wal.file
+	// Written after the torn record, e3 would be lost to recovery anyway
+	if err := st.wal.Append(walRecord{Kind: walEvent, Event: &Event{ID: "e3"}}); !errors.Is(err, errWALBroken) {
+		t.Errorf("Expected writes refused, got %v", err)
+	}
+	crash(st)
+	if recovered := openTestWALStore(t, path); recovered.Len() != 1 {
+		t.Errorf("Expected e1 recovered, got %v", eventIDs(recovered.Events()))
+	}
+}
+
+func TestWALFailedWritesAreNotAcknowledged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.wal")
+	server := NewServer()
+	st := openTestWALStore(t, path)
+	server.events = st
+	server.logEvent("e1", "One")
+	crashAfter(st, 0)
+
+	post := func(target string) int {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, target, nil))
+		return rec.Code
+	}
+	if code := post("/event?message=lost"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected the failed write refused, got %d", code)
+	}
+	// The failed write took a timestamp, later ones are refused before
+	if code := post("/event?message=refused"); code != http.StatusServiceUnavailable || server.clock.GetTime() != 2 {
+		t.Errorf("Expected writes refused without ticking, got %d at %d", code, server.clock.GetTime())
+	}
+	if code := post("/message?timestamp=50&message=peer"); code != http.StatusServiceUnavailable || server.clock.GetTime() != 2 {
+		t.Errorf("Expected messages refused without merging, got %d at %d", code, server.clock.GetTime())
+	}
+	if _, err := trimChecked(server.events, 1); err == nil {
+		t.Errorf("Expected the trim refused")
+	}
+	if ids := eventIDs(server.events.Events()); len(ids) != 1 || ids[0] != "e1" {
+		t.Errorf("Expected only e1 in the log, got %v", ids)
+	}
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected the node not ready, got %d", rec.Code)
+	}
+	// The event and the trim reached the log, the rest was refused before
+	if v := st.metrics.Value("lamport_wal_failures_total"); v != 2 {
+		t.Errorf("Expected 2 failures counted, got %v", v)
+	}
+}
+
+func TestWALTruncatesCorruptRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.wal")
+	st := openTestWALStore(t, path)
+	st.Append(Event{ID: "e1"})
+	st.Append(Event{ID: "e2"})
+	st.Close()
+
+	data, _ := os.ReadFile(path)
+	data[len(data)-3] ^= 0xff
+	os.WriteFile(path, data, 0o644)
+
+	recovered := openTestWALStore(t, path)
+	defer recovered.Close()
+	if got := fmt.Sprint(eventIDs(recovered.Events())); got != "[e1]" {
+		t.Errorf("Expected only e1 recovered, got %s", got)
+	}
+	if info, _ := os.Stat(path); info.Size() != recovered.wal.size {
+		t.Errorf("Expected the file truncated to %d bytes, got %d", recovered.wal.size, info.Size())
+	}
+}
+
+func TestWALReplaysTrimsAndCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.wal")
+	st := openTestWALStore(t, path)
+	for i := 1; i <= 5; i++ {
+		st.Append(Event{ID: fmt.Sprintf("e%d", i), Timestamp: int64(i)})
+	}
+	st.Trim(2)
+	st.Save(ClockTime{Timestamp: 9})
+	st.Close()
+
+	st = openTestWALStore(t, path)
+	if got := fmt.Sprint(eventIDs(st.Events())); got != "[e3 e4 e5]" || st.Dropped() != 2 {
+		t.Errorf("Expected e3 to e5 with 2 dropped, got %s with %d", got, st.Dropped())
+	}
+	st.mutex.Lock()
+	st.compactLocked()
+	st.mutex.Unlock()
+	st.Append(Event{ID: "e6", Timestamp: 6})
+	crash(st)
+
+	st = openTestWALStore(t, path)
+	defer st.Close()
+	saved, _, _ := st.Load()
+	if got := fmt.Sprint(eventIDs(st.Events())); got != "[e3 e4 e5 e6]" || st.Dropped() != 2 || saved.Timestamp != 9 {
+		t.Errorf("Expected the compacted log and e6, got %s with %d dropped at %v", got, st.Dropped(), saved)
+	}
+}
+
+func TestWALReplaysGroups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.wal")
+	st := openTestWALStore(t, path)
+	st.Append(Event{ID: "e1", Timestamp: 1})
+	group := []Event{{ID: "e2", Timestamp: 2}, {ID: "e3", Timestamp: 3}}
+	if err := st.appendAllChecked(group); err != nil {
+		t.Fatalf("Failed to append the group: %v", err)
+	}
+	// A torn group is dropped whole
+	crashAfter(st, 40)
+	if err := st.appendAllChecked([]Event{{ID: "e4", Timestamp: 4}, {ID: "e5", Timestamp: 5}}); err == nil {
+		t.Error("Expected the torn group refused")
+	}
+	crash(st)
+
+	st = openTestWALStore(t, path)
+	defer st.Close()
+	if got := fmt.Sprint(eventIDs(st.Events())); got != "[e1 e2 e3]" {
+		t.Errorf("Expected e1 to e3, got %s", got)
+	}
+}
+
+// smallWALRecords bounds records to max bytes and snapshot parts to part
+// events for the rest of the test
+func smallWALRecords(t *testing.T, max, part int) {
+	maxRecord, snapshotPart := walMaxRecord, walSnapshotPart
+	walMaxRecord, walSnapshotPart = max, part
+	t.Cleanup(func() { walMaxRecord, walSnapshotPart = maxRecord, snapshotPart })
+}
+
+func TestWALSplitsLargeSnapshots(t *testing.T) {
+	smallWALRecords(t, 1024, 4)
+	path := filepath.Join(t.TempDir(), "events.wal")
+	st := openTestWALStore(t, path)
+	events := make([]Event, 50)
+	for i := range events {
+		events[i] = Event{ID: fmt.Sprintf("e%d", i), Timestamp: int64(i + 1), Message: "Snapshotted"}
+	}
+	if err := replaceChecked(st, events); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.wal.Compact(st.snapshotLocked(), nil); err != nil {
+		t.Fatal(err)
+	}
+	st.Close()
+
+	// No record passes the bound, which replay would take for a torn one
+	data, _ := os.ReadFile(path)
+	records, valid, err := readWAL(bytes.NewReader(data))
+	if err != nil || valid != int64(len(data)) || len(records) < 13 {
+		t.Fatalf("Expected the snapshot in parts, got %d records up to %d of %d bytes (err: %v)", len(records), valid, len(data), err)
+	}
+	reopened := openTestWALStore(t, path)
+	defer reopened.Close()
+	if reopened.Len() != 50 || reopened.Events()[49].ID != "e49" {
+		t.Errorf("Expected the 50 events replayed, got %v", eventIDs(reopened.Events()))
+	}
+
+	if err := appendChecked(reopened, Event{ID: "huge", Message: strings.Repeat("x", 2048)}); !errors.Is(err, errWALRecordTooLarge) {
+		t.Errorf("Expected an oversized record refused, got %v", err)
+	}
+}
+
+func TestWALIgnoresTornSnapshots(t *testing.T) {
+	smallWALRecords(t, 1<<20, 2)
+	path := filepath.Join(t.TempDir(), "events.wal")
+	st := openTestWALStore(t, path)
+	st.Append(Event{ID: "kept"})
+
+	// The first parts of the snapshot make it to the file, the last does not
+	snapshot, _ := encodeWALRecords(walRecord{Kind: walSnapshot, Events: []Event{{ID: "a"}, {ID: "b"}, {ID: "c"}, {ID: "d"}, {ID: "e"}}})
+	crashAfter(st, len(snapshot)-1)
+	if err := replaceChecked(st, []Event{{ID: "a"}, {ID: "b"}, {ID: "c"}, {ID: "d"}, {ID: "e"}}); err == nil {
+		t.Fatal("Expected the snapshot to fail")
+	}
+	crash(st)
+
+	recovered := openTestWALStore(t, path)
+	if ids := eventIDs(recovered.Events()); len(ids) != 1 || ids[0] != "kept" {
+		t.Fatalf("Expected the torn snapshot ignored, got %v", ids)
+	}
+	// Records written after the complete parts do not revive them
+	recovered.Append(Event{ID: "later"})
+	recovered.Close()
+	reopened := openTestWALStore(t, path)
+	defer reopened.Close()
+	if ids := eventIDs(reopened.Events()); len(ids) != 2 || ids[1] != "later" {
+		t.Errorf("Expected kept and later, got %v", ids)
+	}
+}
+
+func TestWALServerCrashRecovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.wal")
+	server := NewServer()
+	st := openTestWALStore(t, path)
+	server.events = st
+	server.logEvent("e1", "One")
+	server.clock.Update(100)
+	persister := NewClockPersisterTo(st, server.clock, time.Second, slog.Default())
+	persister.Save()
+	server.logEvent("e2", "Two")
+	crashAfter(st, 10)
+	server.logEvent("e3", "Torn")
+	crash(st)
+
+	restarted := NewServer()
+	recovered := openTestWALStore(t, path)
+	defer recovered.Close()
+	restarted.events = recovered
+	restarted.resumeLog()
+	resumed, err := NewClockPersisterTo(recovered, restarted.clock, time.Second, slog.Default()).Restore(10)
+	if err != nil || resumed.Timestamp < 111 {
+		t.Errorf("Expected the clock past its saved 101 plus the margin, got %v %v", resumed, err)
+	}
+	restarted.logEvent("e4", "Four")
+	if verified := verifyLog(t, restarted); verified["valid"] != true || verified["event_count"] != float64(3) {
+		t.Errorf("Expected e1, e2 and e4 chained, got %v", verified)
+	}
+}
+
+func TestParseSyncPolicy(t *testing.T) {
+	for _, name := range []string{"always", "interval", "no"} {
+		if p, err := parseSyncPolicy(name); err != nil || string(p) != name {
+			t.Errorf("%s: got %q %v", name, p, err)
+		}
+	}
+	if _, err := parseSyncPolicy("sometimes"); err == nil {
+		t.Error("Expected an unknown policy rejected")
+	}
+}
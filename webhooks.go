@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec"
+)
+
+const (
+	// webhookQueue is how many deliveries may wait for a worker before new
+	// ones fail right away
+	webhookQueue = 1024
+
+	webhookWorkers = 4
+
+	// webhookHistory is how many deliveries /webhooks/deliveries keeps
+	webhookHistory = 500
+
+	webhookTimeout    = 10 * time.Second
+	webhookMaxBackoff = 5 * time.Minute
+)
+
+// Headers of webhook requests
+const (
+	headerWebhookID        = "Lamport-Webhook-Id"
+	headerWebhookDelivery  = "Lamport-Webhook-Delivery"
+	headerWebhookSignature = "Lamport-Webhook-Signature"
+)
+
+// Delivery states
+const (
+	deliveryPending   = "pending"
+	deliveryDelivered = "delivered"
+	deliveryFailed    = "failed"
+)
+
+// Webhook is a URL every new event matching Filter is posted to. With a
+// Secret the body is signed with HMAC-SHA256.
+type Webhook struct {
+	ID      string      `json:"id"`
+	URL     string      `json:"url"`
+	Filter  EventFilter `json:"filter"`
+	Secret  string      `json:"secret,omitempty"`
+	Created time.Time   `json:"created"`
+}
+
+// Delivery is one event posted to one webhook
+type Delivery struct {
+	ID          string     `json:"id"`
+	Webhook     string     `json:"webhook"`
+	URL         string     `json:"url"`
+	EventID     string     `json:"event_id,omitempty"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	LastStatus  int        `json:"last_status,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	NextAttempt *time.Time `json:"next_attempt,omitempty"`
+	Created     time.Time  `json:"created"`
+	Updated     time.Time  `json:"updated"`
+
+	body   []byte
+	secret string
+}
+
+// Webhooks posts new events to registered URLs. Failed deliveries are
+// retried with exponential backoff, starting at backoff and doubling up to
+// webhookMaxBackoff, until attempts have been made.
+type Webhooks struct {
+	hooks      []*Webhook
+	deliveries []*Delivery // newest last, at most webhookHistory
+	queue      chan *Delivery
+	client     *http.Client
+	server     *Server
+	attempts   int
+	backoff    time.Duration
+	unhook     func() // unregisters from the server hooks, nil without webhooks
+	next       int64
+	done       chan struct{}
+	mutex      sync.Mutex
+}
+
+// NewWebhooks creates the webhooks of a server, with no webhook registered
+func NewWebhooks(server *Server, attempts int, backoff time.Duration) *Webhooks {
+	server.metrics.Counter("lamport_webhook_deliveries_total", "Webhook delivery attempts by result")
+	return &Webhooks{
+		queue:    make(chan *Delivery, webhookQueue),
+		client:   &http.Client{Timeout: webhookTimeout},
+		server:   server,
+		attempts: attempts,
+		backoff:  backoff,
+		done:     make(chan struct{}),
+	}
+}
+
+// Add registers a webhook. The server notifies the webhooks of events only
+// while at least one is registered.
+func (wh *Webhooks) Add(hook Webhook) (Webhook, error) {
+	if err := checkWebhookURL(hook.URL); err != nil {
+		return Webhook{}, err
+	}
+
+	wh.mutex.Lock()
+	defer wh.mutex.Unlock()
+	wh.next++
+	hook.ID = "webhook-" + strconv.FormatInt(wh.next, 10)
+	hook.Created = time.Now()
+	wh.hooks = append(wh.hooks, &hook)
+	if wh.unhook == nil {
+		wh.unhook = wh.server.RegisterHook(wh)
+	}
+	return hook, nil
+}
+
+// checkWebhookURL accepts absolute http and https URLs
+func checkWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook URL %q, expected http(s)://host/path", raw)
+	}
+	return nil
+}
+
+// Remove unregisters a webhook and reports whether it existed. Deliveries
+// already queued for it are still attempted.
+func (wh *Webhooks) Remove(id string) bool {
+	wh.mutex.Lock()
+	defer wh.mutex.Unlock()
+	i := slices.IndexFunc(wh.hooks, func(h *Webhook) bool { return h.ID == id })
+	if i < 0 {
+		return false
+	}
+	wh.hooks = slices.Delete(wh.hooks, i, i+1)
+	if len(wh.hooks) == 0 {
+		wh.unhook()
+		wh.unhook = nil
+	}
+	return true
+}
+
+// List returns the registered webhooks with their secrets hidden
+func (wh *Webhooks) List() []Webhook {
+	wh.mutex.Lock()
+	defer wh.mutex.Unlock()
+	list := make([]Webhook, len(wh.hooks))
+	for i, h := range wh.hooks {
+		list[i] = *h
+		if list[i].Secret != "" {
+			list[i].Secret = "redacted"
+		}
+	}
+	return list
+}
+
+// Deliveries returns copies of the recent deliveries, newest first,
+// optionally only those of one webhook or in one state
+func (wh *Webhooks) Deliveries(webhook, status string) []Delivery {
+	wh.mutex.Lock()
+	defer wh.mutex.Unlock()
+	list := []Delivery{}
+	for _, d := range slices.Backward(wh.deliveries) {
+		if (webhook == "" || d.Webhook == webhook) && (status == "" || d.Status == status) {
+			list = append(list, *d)
+		}
+	}
+	return list
+}
+
+func (wh *Webhooks) OnTick(codec.Timestamp) {}
+
+func (wh *Webhooks) OnUpdate(received, now codec.Timestamp) {}
+
+// OnEvent queues a delivery of the event to every webhook it matches
+func (wh *Webhooks) OnEvent(e codec.Event) {
+	event := eventFromWire(e)
+	body, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	wh.mutex.Lock()
+	var queued []*Delivery
+	for _, h := range wh.hooks {
+		if !h.Filter.Match(event) {
+			continue
+		}
+		queued = append(queued, wh.deliveryLocked(h.ID, h.URL, h.Secret, event.ID, body, now))
+	}
+	wh.mutex.Unlock()
+
+	for _, d := range queued {
+		wh.enqueue(d)
+	}
+}
+
+// Send queues a delivery of body to url on behalf of source, which names
+// what the delivery is for in place of a webhook, e.g. a timer. It is
+// signed, retried and listed like the deliveries of webhooks.
+func (wh *Webhooks) Send(source, url, secret string, body []byte) Delivery {
+	wh.mutex.Lock()
+	d := wh.deliveryLocked(source, url, secret, "", body, time.Now())
+	view := *d
+	wh.mutex.Unlock()
+
+	wh.enqueue(d)
+	return view
+}
+
+// deliveryLocked records a new pending delivery, keeping the history at
+// webhookHistory
+func (wh *Webhooks) deliveryLocked(webhook, url, secret, eventID string, body []byte, now time.Time) *Delivery {
+	wh.next++
+	d := &Delivery{
+		ID:      "delivery-" + strconv.FormatInt(wh.next, 10),
+		Webhook: webhook,
+		URL:     url,
+		EventID: eventID,
+		Status:  deliveryPending,
+		Created: now,
+		Updated: now,
+		body:    body,
+		secret:  secret,
+	}
+	wh.deliveries = append(wh.deliveries, d)
+	if n := len(wh.deliveries) - webhookHistory; n > 0 {
+		wh.deliveries = slices.Delete(wh.deliveries, 0, n)
+	}
+	return d
+}
+
+// enqueue hands a delivery to the workers, failing it when the queue is full
+func (wh *Webhooks) enqueue(d *Delivery) {
+	select {
+	case wh.queue <- d:
+	default:
+		wh.finish(d, 0, errors.New("delivery queue full"), false)
+	}
+}
+
+// Run delivers queued events until ctx is done. Deliveries still pending
+// then are abandoned.
+func (wh *Webhooks) Run(ctx context.Context) {
+	var workers sync.WaitGroup
+	for range webhookWorkers {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for {
+				select {
+				case d := <-wh.queue:
+					wh.deliver(ctx, d)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	workers.Wait()
+	close(wh.done)
+}
+
+// deliver makes one attempt and schedules the next one if it fails
+func (wh *Webhooks) deliver(ctx context.Context, d *Delivery) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.body))
+	if err != nil {
+		wh.finish(d, 0, err, false)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(headerWebhookID, d.Webhook)
+	req.Header.Set(headerWebhookDelivery, d.ID)
+	if d.secret != "" {
+		req.Header.Set(headerWebhookSignature, webhookSignature(d.secret, d.body))
+	}
+
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		wh.finish(d, 0, err, true)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		wh.finish(d, resp.StatusCode, fmt.Errorf("webhook answered %s", resp.Status), retryableStatus(resp.StatusCode))
+		return
+	}
+	wh.finish(d, resp.StatusCode, nil, false)
+}
+
+// finish records the outcome of an attempt and retries failed ones after
+// the backoff while attempts remain
+func (wh *Webhooks) finish(d *Delivery, status int, err error, retry bool) {
+	wh.mutex.Lock()
+	d.Attempts++
+	d.LastStatus = status
+	d.Updated = time.Now()
+	d.NextAttempt = nil
+	var wait time.Duration
+	switch {
+	case err == nil:
+		d.Status = deliveryDelivered
+		d.LastError = ""
+	case retry && d.Attempts < wh.attempts:
+		d.LastError = err.Error()
+		wait = webhookBackoff(wh.backoff, d.Attempts)
+		next := d.Updated.Add(wait)
+		d.NextAttempt = &next
+	default:
+		d.Status = deliveryFailed
+		d.LastError = err.Error()
+	}
+	wh.mutex.Unlock()
+
+	switch {
+	case err == nil:
+		wh.server.metrics.Inc("lamport_webhook_deliveries_total", "result", "delivered")
+	case wait > 0:
+		wh.server.metrics.Inc("lamport_webhook_deliveries_total", "result", "retried")
+		time.AfterFunc(wait, func() {
+			select {
+			case <-wh.done:
+			default:
+				wh.enqueue(d)
+			}
+		})
+	default:
+		wh.server.metrics.Inc("lamport_webhook_deliveries_total", "result", "failed")
+		wh.server.logger.Warn("Webhook delivery failed", "webhook", d.Webhook, "delivery", d.ID, "event_id", d.EventID, "attempts", d.Attempts, "error", err)
+	}
+}
+
+// webhookBackoff is the wait after the given number of failed attempts
+func webhookBackoff(base time.Duration, attempts int) time.Duration {
+	wait := base
+	for i := 1; i < attempts && wait < webhookMaxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, webhookMaxBackoff)
+}
+
+// retryableStatus reports whether a failed response may succeed later.
+// Other client errors mean the request itself is refused.
+func retryableStatus(status int) bool {
+	return status >= 500 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+}
+
+// webhookSignature is the value of the signature header: the hex
+// HMAC-SHA256 of the body keyed with the webhook secret
+func webhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// handleWebhooks lists (GET), registers (POST) and removes (DELETE ?id=)
+// webhooks
+func (wh *Webhooks) handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var hook Webhook
+		if err := json.NewDecoder(r.Body).Decode(&hook); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		hook, err := wh.Add(hook)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if hook.Secret != "" {
+			hook.Secret = "redacted"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(hook)
+		return
+	case http.MethodDelete:
+		if !wh.Remove(r.URL.Query().Get("id")) {
+			http.Error(w, "Unknown webhook", http.StatusNotFound)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"webhooks": wh.List(),
+	})
+}
+
+// handleDeliveries shows recent deliveries, newest first, filtered by
+// ?webhook=<id> and ?status=pending|delivered|failed
+func (wh *Webhooks) handleDeliveries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	status := query.Get("status")
+	if status != "" && status != deliveryPending && status != deliveryDelivered && status != deliveryFailed {
+		http.Error(w, "Invalid status, expected pending, delivered or failed", http.StatusBadRequest)
+		return
+	}
+
+	deliveries := wh.Deliveries(query.Get("webhook"), status)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"deliveries": deliveries,
+		"count":      len(deliveries),
+	})
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestWebhooks(t *testing.T, attempts int) (*Server, *Webhooks) {
+	server := NewServer()
+	wh := NewWebhooks(server, attempts, time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	go wh.Run(ctx)
+	t.Cleanup(func() {
+		cancel()
+		<-wh.done
+	})
+	return server, wh
+}
+
+// waitDeliveries waits until n deliveries are no longer pending
+func waitDeliveries(t *testing.T, wh *Webhooks, n int) []Delivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var done []Delivery
+		for _, d := range wh.Deliveries("", "") {
+			if d.Status != deliveryPending {
+				done = append(done, d)
+			}
+		}
+		if len(done) >= n {
+			return done
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d finished deliveries, got %+v", n, wh.Deliveries("", ""))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	type received struct {
+		event     Event
+		signature string
+		delivery  string
+	}
+	var mutex sync.Mutex
+	var got []received
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var event Event
+		json.Unmarshal(body, &event)
+		mutex.Lock()
+		got = append(got, received{event, r.Header.Get(headerWebhookSignature), r.Header.Get(headerWebhookDelivery)})
+		mutex.Unlock()
+		if r.Header.Get(headerWebhookSignature) != webhookSignature("s3cret", body) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer target.Close()
+
+	server, wh := newTestWebhooks(t, 3)
+	hook, err := wh.Add(Webhook{URL: target.URL, Filter: EventFilter{MessageContains: "order"}, Secret: "s3cret"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	server.logEvent("e1", "order placed")
+	server.logEvent("e2", "unrelated")
+
+	deliveries := waitDeliveries(t, wh, 1)
+	if d := deliveries[0]; d.Status != deliveryDelivered || d.Webhook != hook.ID || d.EventID != "e1" || d.Attempts != 1 {
+		t.Errorf("Expected e1 to be delivered in one attempt, got %+v", d)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(got) != 1 || got[0].event.ID != "e1" || got[0].event.Hash == "" || got[0].delivery != deliveries[0].ID {
+		t.Errorf("Expected only the matching event to be posted, got %+v", got)
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	var calls atomic.Int64
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer flaky.Close()
+	refusing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer refusing.Close()
+
+	server, wh := newTestWebhooks(t, 3)
+	flakyHook, _ := wh.Add(Webhook{URL: flaky.URL})
+	refusingHook, _ := wh.Add(Webhook{URL: refusing.URL})
+	server.logEvent("e1", "Retried")
+	waitDeliveries(t, wh, 2)
+
+	if d := wh.Deliveries(flakyHook.ID, "")[0]; d.Status != deliveryDelivered || d.Attempts != 3 || d.LastError != "" {
+		t.Errorf("Expected delivery on the third attempt, got %+v", d)
+	}
+	if d := wh.Deliveries(refusingHook.ID, "")[0]; d.Status != deliveryFailed || d.Attempts != 1 || d.LastStatus != http.StatusBadRequest {
+		t.Errorf("Expected a refused delivery not to be retried, got %+v", d)
+	}
+
+	// Attempts run out
+	calls.Store(-10)
+	wh.Remove(refusingHook.ID)
+	server.logEvent("e2", "Given up")
+	waitDeliveries(t, wh, 3)
+	if d := wh.Deliveries(flakyHook.ID, deliveryFailed); len(d) != 1 || d[0].EventID != "e2" || d[0].Attempts != 3 {
+		t.Errorf("Expected e2 to fail after 3 attempts, got %+v", d)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	cases := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{20, webhookMaxBackoff},
+	}
+	for _, c := range cases {
+		if got := webhookBackoff(time.Second, c.attempts); got != c.want {
+			t.Errorf("After %d attempts: expected %v, got %v", c.attempts, c.want, got)
+		}
+	}
+}
+
+func TestHandleWebhooks(t *testing.T) {
+	server := NewServer()
+	wh := NewWebhooks(server, 1, time.Second)
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(`{"url":"ftp://example.com"}`))
+	w := httptest.NewRecorder()
+	wh.handleWebhooks(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a non HTTP URL, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(`{"url":"http://example.com/hook","secret":"s3cret"}`))
+	w = httptest.NewRecorder()
+	wh.handleWebhooks(w, req)
+	var hook Webhook
+	json.NewDecoder(w.Body).Decode(&hook)
+	if w.Code != http.StatusCreated || hook.ID == "" || hook.Secret != "redacted" {
+		t.Fatalf("Expected a registered webhook with its secret hidden, got %d %+v", w.Code, hook)
+	}
+	if !server.hooks.Enabled() {
+		t.Errorf("Expected the webhooks to be hooked into the server")
+	}
+
+	w = httptest.NewRecorder()
+	wh.handleWebhooks(w, httptest.NewRequest(http.MethodGet, "/webhooks", nil))
+	if !strings.Contains(w.Body.String(), hook.ID) || strings.Contains(w.Body.String(), "s3cret") {
+		t.Errorf("Expected the webhook without its secret, got %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	wh.handleWebhooks(w, httptest.NewRequest(http.MethodDelete, "/webhooks?id=webhook-99", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown webhook, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	wh.handleWebhooks(w, httptest.NewRequest(http.MethodDelete, "/webhooks?id="+hook.ID, nil))
+	if w.Code != http.StatusOK || server.hooks.Enabled() {
+		t.Errorf("Expected the last webhook removal to unhook, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	wh.handleDeliveries(w, httptest.NewRequest(http.MethodGet, "/webhooks/deliveries?status=lost", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown status, got %d", w.Code)
+	}
+}
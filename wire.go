@@ -0,0 +1,75 @@
+package main
+
+import (
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec"
+)
+
+// wire returns the codec representation of t
+func (t ClockTime) wire() codec.Timestamp {
+	return codec.Timestamp{Epoch: t.Epoch, Timestamp: t.Timestamp}
+}
+
+func clockTimeFromWire(t codec.Timestamp) ClockTime {
+	return ClockTime{Epoch: t.Epoch, Timestamp: t.Timestamp}
+}
+
+// wire returns the codec representation of e
+func (e Event) wire() codec.Event {
+	w := codec.Event{
+		ID:            e.ID,
+		Message:       e.Message,
+		Timestamp:     e.Timestamp,
+		Epoch:         e.Epoch,
+		WallTime:      e.WallTime,
+		Type:          e.Type,
+		SchemaVersion: e.SchemaVersion,
+		Payload:       e.Payload,
+		Metadata:      e.Metadata,
+		RequestID:     e.RequestID,
+		Node:          e.Node,
+		Sender:        e.Sender,
+		Backfilled:    e.Backfilled,
+
+		Signature:        e.Signature,
+		KeyID:            e.KeyID,
+		InvalidSignature: e.InvalidSignature,
+
+		PrevHash: e.PrevHash,
+		Hash:     e.Hash,
+	}
+	if e.SentAt != nil {
+		sentAt := e.SentAt.wire()
+		w.SentAt = &sentAt
+	}
+	return w
+}
+
+func eventFromWire(w codec.Event) Event {
+	e := Event{
+		ID:            w.ID,
+		Message:       w.Message,
+		Timestamp:     w.Timestamp,
+		Epoch:         w.Epoch,
+		WallTime:      w.WallTime,
+		Type:          w.Type,
+		SchemaVersion: w.SchemaVersion,
+		Payload:       w.Payload,
+		Metadata:      w.Metadata,
+		RequestID:     w.RequestID,
+		Node:          w.Node,
+		Sender:        w.Sender,
+		Backfilled:    w.Backfilled,
+
+		Signature:        w.Signature,
+		KeyID:            w.KeyID,
+		InvalidSignature: w.InvalidSignature,
+
+		PrevHash: w.PrevHash,
+		Hash:     w.Hash,
+	}
+	if w.SentAt != nil {
+		sentAt := clockTimeFromWire(*w.SentAt)
+		e.SentAt = &sentAt
+	}
+	return e
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lucasgabrielbecker/lamport_timestamp_golang/codec"
+)
+
+func TestEventWireJSONMatches(t *testing.T) {
+	event := Event{
+		ID:        "msg-7",
+		Message:   "Processed: Hello",
+		Timestamp: 7,
+		Epoch:     1,
+		WallTime:  time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC),
+		Metadata:  map[string]string{"service": "auth"},
+		RequestID: "req-1",
+		Node:      "a",
+		Sender:    "b",
+		SentAt:    &ClockTime{Epoch: 1, Timestamp: 5},
+		Signature: "c2lnbmF0dXJl",
+		KeyID:     "0123456789abcdef",
+		PrevHash:  "3a",
+		Hash:      "7f",
+	}
+
+	local, _ := json.Marshal(event)
+	wire, _ := json.Marshal(event.wire())
+	if string(local) != string(wire) {
+		t.Errorf("Expected identical JSON:\n%s\n%s", local, wire)
+	}
+
+	// JSON written by the server decodes into the codec type and back
+	var decoded codec.Event
+	if err := json.Unmarshal(local, &decoded); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if back := eventFromWire(decoded); !reflect.DeepEqual(back, event) {
+		t.Errorf("Expected %+v, got %+v", event, back)
+	}
+}
+
+func TestEventWireBinaryRoundTrip(t *testing.T) {
+	event := Event{ID: "event-1", Message: "Hi", Timestamp: 3, WallTime: time.Unix(0, 1).UTC()}
+
+	data, err := event.wire().MarshalBinary()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var decoded codec.Event
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if back := eventFromWire(decoded); !reflect.DeepEqual(back, event) {
+		t.Errorf("Expected %+v, got %+v", event, back)
+	}
+}